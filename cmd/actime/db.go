@@ -0,0 +1,687 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/title"
+)
+
+// openWritable opens the database read-write for commands that change data
+func openWritable(cfg *core.Config) (*storage.DB, error) {
+	db, err := storage.NewDBWithOptions(cfg.Database.Path, storage.Options{
+		MaxReadConns: cfg.Database.MaxReadConns,
+		BusyTimeout:  cfg.Database.BusyTimeout,
+		SlowQuery:    cfg.Database.SlowQuery,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// requireDaemonStopped refuses what rewrites the database file while the
+// daemon runs: it keeps the database open and would go on writing to the
+// file being replaced, or hold the space being reclaimed
+func requireDaemonStopped(what string) error {
+	pid, err := service.ReadPIDFile(service.PIDFile)
+	if err == nil && service.IsProcessRunning(pid) {
+		return fmt.Errorf("%s rewrites the database file, which the running daemon (PID: %d) keeps open; stop it with 'actimed stop' first", what, pid)
+	}
+	return nil
+}
+
+// secureCompact closes db and rewrites its file without the free pages that
+// still hold the deleted data
+func secureCompact(cfg *core.Config, db *storage.DB) error {
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+	if err := storage.SecureCompact(cfg.Database.Path); err != nil {
+		return fmt.Errorf("failed to rewrite database: %w", err)
+	}
+	fmt.Println("Rewrote the database file; the deleted data cannot be recovered from it")
+	return nil
+}
+
+// runDB dispatches the `actime db` maintenance subcommands
+func runDB() error {
+	if len(os.Args) < 3 {
+		return fmt.Errorf("missing db subcommand (expected backup, check, clean, clean-names, compact, merge, recompute-daily, salvage, scrub or deadletter)")
+	}
+
+	switch os.Args[2] {
+	case "backup":
+		return backupDB()
+	case "check":
+		return checkSessions()
+	case "clean":
+		return cleanShell()
+	case "clean-names":
+		return cleanNames()
+	case "compact":
+		return compactDB()
+	case "merge":
+		return mergeDB()
+	case "recompute-daily":
+		return recomputeDaily()
+	case "salvage":
+		return salvageDB()
+	case "scrub":
+		return scrubTitles()
+	case "deadletter":
+		return deadLetter()
+	default:
+		return fmt.Errorf("unknown db subcommand: %s (expected backup, check, clean, clean-names, compact, merge, recompute-daily, salvage, scrub or deadletter)", os.Args[2])
+	}
+}
+
+// backupDB writes a consistent copy of the database, by default to a
+// timestamped file in database.backup.dir. It only reads the database, so
+// it runs while the daemon keeps writing.
+func backupDB() error {
+	output := ""
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--output", "-o":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("%s requires a file", os.Args[i])
+			}
+			output = os.Args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if output == "" {
+		output = filepath.Join(cfg.Database.Backup.Dir, storage.BackupName(time.Now()))
+	}
+
+	db, err := openReadOnly(cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.BackupTo(output); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		return fmt.Errorf("failed to stat backup: %w", err)
+	}
+	fmt.Printf("Backed up %s to %s (%.1f MB)\n", cfg.Database.Path, output, float64(info.Size())/1024/1024)
+	return nil
+}
+
+// compactDB rebuilds the database file without the space of deleted rows
+// and prints how much was reclaimed
+func compactDB() error {
+	if len(os.Args) > 3 {
+		return fmt.Errorf("unknown option: %s", os.Args[3])
+	}
+	if err := requireDaemonStopped("compact"); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	before, after, err := db.Compact()
+	if err != nil {
+		return err
+	}
+	megabytes := func(n int64) float64 { return float64(n) / 1024 / 1024 }
+	fmt.Printf("Compacted %s: %.1f MB -> %.1f MB (reclaimed %.1f MB)\n", cfg.Database.Path,
+		megabytes(before), megabytes(after), megabytes(max(before-after, 0)))
+	return nil
+}
+
+// recomputeDaily rebuilds daily statistics from sessions, for a date range
+// or with --all for the whole history
+func recomputeDaily() error {
+	// Parse command line arguments
+	all := false
+	startDate := ""
+	endDate := ""
+
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--all":
+			all = true
+		case "--start":
+			if i+1 < len(os.Args) {
+				startDate = os.Args[i+1]
+				i++
+			}
+		case "--end":
+			if i+1 < len(os.Args) {
+				endDate = os.Args[i+1]
+				i++
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	query := &storage.StatsQuery{}
+	if all {
+		if startDate != "" || endDate != "" {
+			return fmt.Errorf("--all cannot be combined with --start or --end")
+		}
+	} else {
+		if startDate == "" {
+			return fmt.Errorf("missing --start (or --all to recompute everything)")
+		}
+
+		var err error
+		query.StartDate, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+		query.EndDate, _ = time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+		if endDate != "" {
+			query.EndDate, err = time.Parse("2006-01-02", endDate)
+			if err != nil {
+				return fmt.Errorf("invalid end date format: %w", err)
+			}
+		}
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	days, err := db.RecomputeDailyStats(query, func(done, total int) {
+		fmt.Printf("\rRecomputing daily stats: %d/%d days", done, total)
+	})
+	if err != nil {
+		fmt.Println()
+		return err
+	}
+	if days > 0 {
+		fmt.Println()
+	}
+
+	fmt.Printf("Recomputed daily stats for %d days\n", days)
+	return nil
+}
+
+// salvageDB copies the readable rows of a damaged database into a new
+// file, the same salvage the daemon runs when it finds its database corrupted
+func salvageDB() error {
+	// Parse command line arguments
+	source := ""
+	output := ""
+
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--output":
+			if i+1 < len(os.Args) {
+				output = os.Args[i+1]
+				i++
+			}
+		default:
+			if source != "" || strings.HasPrefix(os.Args[i], "--") {
+				return fmt.Errorf("unknown option: %s", os.Args[i])
+			}
+			source = os.Args[i]
+		}
+	}
+
+	if source == "" {
+		return fmt.Errorf("missing database file to salvage")
+	}
+	if output == "" {
+		output = fmt.Sprintf("%s.salvaged-%s", source, time.Now().Format("20060102-150405"))
+	}
+
+	result, err := storage.Salvage(source, output)
+	if err != nil {
+		return fmt.Errorf("failed to salvage %s: %w", source, err)
+	}
+
+	fmt.Printf("Salvaged %d sessions, %d daily stats and %d gaps into %s\n",
+		result.Sessions, result.DailyStats, result.Gaps, output)
+	if result.Unreadable > 0 {
+		fmt.Printf("%d rows could not be read\n", result.Unreadable)
+	}
+	return nil
+}
+
+// maxMergeConflicts is how many conflicting sessions `actime db merge`
+// lists before summing up the rest
+const maxMergeConflicts = 10
+
+// mergeDB copies the sessions of another actime database, such as one from
+// a second machine, into merge:<device> and prints what was added
+func mergeDB() error {
+	// Parse command line arguments
+	path := ""
+	device := ""
+
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--device":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("--device requires a name")
+			}
+			device = os.Args[i+1]
+			i++
+		default:
+			if path != "" || strings.HasPrefix(os.Args[i], "--") {
+				return fmt.Errorf("unknown option: %s", os.Args[i])
+			}
+			path = os.Args[i]
+		}
+	}
+
+	if path == "" {
+		return fmt.Errorf("missing database file to merge")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.MergeFrom(path, device)
+	if err != nil {
+		return fmt.Errorf("failed to merge %s: %w", path, err)
+	}
+
+	fmt.Printf("Merged %s into %s: %d sessions added, %d already present\n",
+		path, result.Source, result.Added, result.Skipped)
+	if len(result.Conflicts) == 0 {
+		return nil
+	}
+	fmt.Printf("%d sessions were merged before with another duration; the longer one is kept:\n", len(result.Conflicts))
+	for i, conflict := range result.Conflicts {
+		if i == maxMergeConflicts {
+			fmt.Printf("  ... and %d more\n", len(result.Conflicts)-i)
+			break
+		}
+		fmt.Printf("  %s  %s  %s: %s here, %s in %s\n", conflict.StartTime.Format("2006-01-02 15:04:05"),
+			conflict.AppName, shortenTitle(conflict.WindowTitle, titleWidth),
+			durations.Seconds(conflict.Existing), durations.Seconds(conflict.Incoming), filepath.Base(path))
+	}
+	return nil
+}
+
+// cleanNames rewrites stored application names to their canonical names
+// (cleaned and resolved through app_mapping) and, with --titles, window
+// titles with the configured title rules
+func cleanNames() error {
+	// Parse command line arguments
+	titles := false
+	dryRun := false
+
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--titles":
+			titles = true
+		case "--dry-run":
+			dryRun = true
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	apps, err := appname.NewMapper(cfg.AppMapping)
+	if err != nil {
+		return fmt.Errorf("invalid app mapping: %w", err)
+	}
+
+	names, err := db.GetAppNames()
+	if err != nil {
+		return err
+	}
+
+	var appsChanged, sessionsChanged int64
+	for _, name := range names {
+		canonical := apps.Canonical(name)
+		if canonical == name || canonical == "" {
+			continue
+		}
+
+		fmt.Printf("  app %q -> %q\n", name, canonical)
+		appsChanged++
+		if dryRun {
+			continue
+		}
+
+		renamed, err := db.RenameApp(name, canonical)
+		if err != nil {
+			return err
+		}
+		sessionsChanged += renamed
+	}
+
+	var titlesChanged int64
+	if titles {
+		normalizer, err := title.Compile(cfg.TitleNormalize)
+		if err != nil {
+			return fmt.Errorf("invalid title rules: %w", err)
+		}
+
+		pairs, err := db.GetAppTitles()
+		if err != nil {
+			return err
+		}
+
+		for _, pair := range pairs {
+			normalized := normalizer.Normalize(pair.AppName, title.Sanitize(pair.WindowTitle))
+			if normalized == pair.WindowTitle {
+				continue
+			}
+
+			fmt.Printf("  %s: %q -> %q\n", pair.AppName, pair.WindowTitle, normalized)
+			titlesChanged++
+			if dryRun {
+				continue
+			}
+
+			renamed, err := db.RenameTitle(pair.AppName, pair.WindowTitle, normalized)
+			if err != nil {
+				return err
+			}
+			sessionsChanged += renamed
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("Would rename %d app names and %d window titles\n", appsChanged, titlesChanged)
+		return nil
+	}
+
+	fmt.Printf("Renamed %d app names and %d window titles in %d sessions\n", appsChanged, titlesChanged, sessionsChanged)
+	return nil
+}
+
+// checkSessions handles `actime db check`: it runs the integrity check of
+// the database file, lists sessions longer than
+// monitor.max_session_duration and with --repair splits them into pieces
+// of at most that length or truncates them to it
+func checkSessions() error {
+	// Parse command line arguments
+	repair := ""
+
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--repair":
+			if i+1 < len(os.Args) {
+				repair = os.Args[i+1]
+				i++
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	switch repair {
+	case "", "split", "truncate":
+	default:
+		return fmt.Errorf("unsupported repair: %s (expected split or truncate)", repair)
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	max := cfg.Monitor.MaxSessionDuration
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.CheckIntegrity(); err != nil {
+		return err
+	}
+	fmt.Println("Integrity check passed")
+
+	overlong, err := db.OverlongSessions(max)
+	if err != nil {
+		return err
+	}
+	if len(overlong) == 0 {
+		fmt.Printf("No sessions longer than %s\n", max)
+		return nil
+	}
+
+	for _, session := range overlong {
+		fmt.Printf("  %s  %10s  %s", session.StartTime.Local().Format("2006-01-02 15:04"),
+			durations.Seconds(session.DurationSeconds), appname.Clean(session.AppName))
+		if session.WindowTitle != "" {
+			fmt.Printf("  %s", session.WindowTitle)
+		}
+		fmt.Println()
+	}
+	if repair == "" {
+		fmt.Printf("%d sessions are longer than %s; fix them with --repair split or --repair truncate\n", len(overlong), max)
+		return nil
+	}
+
+	for _, session := range overlong {
+		pieces := storage.SplitSession(session, max)
+		if repair == "truncate" {
+			pieces = pieces[:1]
+		}
+		if err := db.ReplaceSession(session.ID, pieces); err != nil {
+			return err
+		}
+
+		// Daily totals of every day the session touched are rebuilt
+		last := pieces[len(pieces)-1].EndTime
+		if session.EndTime.After(last) {
+			last = session.EndTime
+		}
+		query := &storage.StatsQuery{StartDate: session.StartTime.Local(), EndDate: last.Local(), Source: session.Source}
+		if _, err := db.RecomputeDailyStats(query, nil); err != nil {
+			return err
+		}
+	}
+
+	if repair == "split" {
+		fmt.Printf("Split %d sessions into pieces of at most %s\n", len(overlong), max)
+	} else {
+		fmt.Printf("Truncated %d sessions to %s\n", len(overlong), max)
+	}
+	return nil
+}
+
+// cleanShell handles `actime db clean --shell`: it deletes the sessions and
+// daily totals of desktop-shell processes recorded before they were
+// ignored, or with --relabel renames them to one application
+func cleanShell() error {
+	// Parse command line arguments
+	shell := false
+	relabel := ""
+	dryRun := false
+
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--shell":
+			shell = true
+		case "--relabel":
+			if i+1 >= len(os.Args) || os.Args[i+1] == "" {
+				return fmt.Errorf("missing value for --relabel")
+			}
+			relabel = os.Args[i+1]
+			i++
+		case "--dry-run":
+			dryRun = true
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	if !shell {
+		return fmt.Errorf("missing what to clean (expected --shell)")
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Use the built-in list even when shell processes are tracked
+	shellCfg := *cfg
+	shellCfg.Shell.Track = false
+	shellApps := core.NewShellApps(&shellCfg)
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	names, err := db.GetAppNames()
+	if err != nil {
+		return err
+	}
+
+	// Names match regardless of case, so each app is handled once
+	seen := make(map[string]bool)
+	var appsFound, sessionsFound int64
+	for _, name := range names {
+		if !shellApps.Contains(name) || strings.EqualFold(name, relabel) || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+
+		count, err := db.CountAppSessions(name)
+		if err != nil {
+			return err
+		}
+		appsFound++
+		sessionsFound += count
+		if relabel != "" {
+			fmt.Printf("  %s: %d sessions -> %q\n", name, count, relabel)
+		} else {
+			fmt.Printf("  %s: %d sessions\n", name, count)
+		}
+		if dryRun {
+			continue
+		}
+
+		if relabel != "" {
+			_, err = db.RenameApp(name, relabel)
+		} else {
+			_, err = db.DeleteApp(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case appsFound == 0:
+		fmt.Println("No shell processes recorded")
+	case dryRun && relabel != "":
+		fmt.Printf("Would relabel %d sessions of %d shell processes\n", sessionsFound, appsFound)
+	case dryRun:
+		fmt.Printf("Would delete %d sessions of %d shell processes\n", sessionsFound, appsFound)
+	case relabel != "":
+		fmt.Printf("Relabeled %d sessions of %d shell processes\n", sessionsFound, appsFound)
+	default:
+		fmt.Printf("Deleted %d sessions of %d shell processes\n", sessionsFound, appsFound)
+	}
+	return nil
+}
+
+// deadLetter handles `actime db deadletter`: without arguments it lists the
+// sessions the daemon could not write, with replay it writes them again
+func deadLetter() error {
+	replay := false
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "replay":
+			replay = true
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	path := service.DeadLetterPath(cfg.Database.Path)
+
+	if !replay {
+		letters, err := service.ReadDeadLetters(path)
+		if err != nil {
+			return err
+		}
+		if len(letters) == 0 {
+			fmt.Println("No dead letters")
+			return nil
+		}
+		for _, letter := range letters {
+			fmt.Printf("%s  %s  %s  %s (%d attempts)\n",
+				letter.Start.Format("2006-01-02 15:04:05"), letter.App,
+				durations.Seconds(letter.DurationSeconds), letter.Error, letter.Attempts)
+		}
+		fmt.Printf("\n%d sessions in %s\n", len(letters), path)
+		return nil
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	replayed, failed, err := service.ReplayDeadLetters(db, path)
+	fmt.Printf("Replayed %d sessions, %d still failing\n", replayed, failed)
+	return err
+}
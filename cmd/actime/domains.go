@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/title"
+)
+
+// showDomainStats prints the time each browser spent on each site over
+// the range, today by default
+func showDomainStats(db *storage.DB, browsers *core.Browsers, appName, source, startDate, endDate string, now time.Time) error {
+	today, _ := time.Parse("2006-01-02", now.Format("2006-01-02"))
+	start := today
+	end := today
+
+	var err error
+	if startDate != "" {
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		end, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	totals, err := domainTotals(db, browsers, &storage.StatsQuery{AppName: appName, StartDate: start, EndDate: end, Source: source}, now)
+	if err != nil {
+		return err
+	}
+
+	heading := "Usage by domain"
+	if appName != "" {
+		heading += " for " + appName
+	}
+	fmt.Printf("%s, %s to %s:\n", heading, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	fmt.Println()
+	renderDomainTotals(os.Stdout, totals)
+	return nil
+}
+
+// domainTotals computes the per-site totals of the query's range,
+// including the sessions the daemon has not written yet when it is
+// reachable. Browser sessions stored before domains were recorded get
+// theirs from the window title.
+func domainTotals(db *storage.DB, browsers *core.Browsers, query *storage.StatsQuery, now time.Time) ([]stats.DomainTotal, error) {
+	persisted, err := db.GetSessions(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	var live []*storage.Session
+	if storage.IsTracked(query.Source) {
+		live, err = readLiveSessions(now)
+		if errors.Is(err, service.ErrDaemonUnreachable) {
+			live = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	// Live sessions may have started before the range or be of other apps
+	var sessions []*storage.Session
+	from := query.StartDate.Format(storage.DateLayout)
+	to := query.EndDate.Format(storage.DateLayout)
+	for _, session := range stats.MergeSessions(persisted, live) {
+		if date := session.StartTime.Format(storage.DateLayout); date < from || date > to {
+			continue
+		}
+		if query.AppName != "" && !strings.EqualFold(session.AppName, query.AppName) {
+			continue
+		}
+		if session.Domain == "" && browsers.Contains(session.AppName) {
+			copied := *session
+			copied.Domain = title.Site(session.WindowTitle)
+			session = &copied
+		}
+		sessions = append(sessions, session)
+	}
+	return stats.DomainTotals(sessions), nil
+}
+
+// renderDomainTotals writes each browser with its sites below it
+func renderDomainTotals(w io.Writer, totals []stats.DomainTotal) {
+	if len(totals) == 0 {
+		fmt.Fprintln(w, "  No browser sessions with a known site in this range")
+		return
+	}
+
+	appTotals := make(map[string]int64)
+	for _, total := range totals {
+		appTotals[total.AppName] += total.Seconds
+	}
+
+	app := ""
+	for _, total := range totals {
+		if total.AppName != app {
+			app = total.AppName
+			fmt.Fprintf(w, "  %-36s  %12s\n", app, durations.Seconds(appTotals[app]))
+		}
+		share := float64(total.Seconds) / float64(appTotals[app]) * 100
+		fmt.Fprintf(w, "    %-34s  %12s  %5.1f%%\n", total.Domain, durations.Seconds(total.Seconds), share)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/trace"
+)
+
+// hourlyRow is one exported hour. App is left out when apps are merged.
+type hourlyRow struct {
+	Date    string `json:"date"`
+	Hour    int    `json:"hour"`
+	App     string `json:"app,omitempty"`
+	Seconds int64  `json:"seconds"`
+}
+
+// exportHourly writes time per hour of every day of the range, split by
+// application unless mergeApps is set. The hours are those of
+// stats.HourlyMatrix, so summing the rows of a day gives its matrix row.
+func exportHourly(db *storage.DB, query *storage.StatsQuery, format string, mergeApps bool, outputFile string, overwrite bool, timer *trace.Timer) error {
+	if query.StartDate.IsZero() || query.EndDate.IsZero() {
+		return fmt.Errorf("--type hourly needs a range: use --range or --start and --end")
+	}
+
+	span := timer.Start(trace.Query)
+	sessions, err := db.GetSessions(query)
+	span.End()
+	if err != nil {
+		return fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	span = timer.Start(trace.Aggregate)
+	cells := stats.HourlyByApp(sessions, query.StartDate, query.EndDate, mergeApps)
+	rows := make([]hourlyRow, len(cells))
+	for i, cell := range cells {
+		rows[i] = hourlyRow{
+			Date:    cell.Date.Format(storage.DateLayout),
+			Hour:    cell.Hour,
+			App:     cell.AppName,
+			Seconds: cell.Seconds,
+		}
+	}
+	span.End()
+
+	span = timer.Start(trace.Render)
+	var out bytes.Buffer
+	err = writeHourly(&out, rows, format, mergeApps)
+	span.End()
+	if err != nil {
+		return err
+	}
+
+	span = timer.Start(trace.Write)
+	err = writeOutput(outputFile, out.Bytes(), overwrite)
+	span.End()
+	return err
+}
+
+// writeHourly writes hourly rows as CSV, a JSON array or JSON lines
+func writeHourly(w io.Writer, rows []hourlyRow, format string, mergeApps bool) error {
+	switch format {
+	case "csv":
+		header := []string{"date", "hour", "app", "seconds"}
+		if mergeApps {
+			header = []string{"date", "hour", "seconds"}
+		}
+
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		for _, row := range rows {
+			record := []string{row.Date, strconv.Itoa(row.Hour), row.App, strconv.FormatInt(row.Seconds, 10)}
+			if mergeApps {
+				record = []string{row.Date, strconv.Itoa(row.Hour), strconv.FormatInt(row.Seconds, 10)}
+			}
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("failed to write row: %w", err)
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(rows); err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return nil
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format for --type hourly: %s (expected csv, json or jsonl)", format)
+	}
+}
+
+// setTimezone makes name the local time zone of the command, so the range,
+// days and hours are all cut in that zone
+func setTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	time.Local = loc
+	return nil
+}
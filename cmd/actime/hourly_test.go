@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestExportHourlyMatchesHourlyMatrix(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Sessions crossing hour and day boundaries, under two spellings of one app
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	sessions := []*storage.Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: day.Add(9*time.Hour + 40*time.Minute), EndTime: day.Add(10*time.Hour + 20*time.Minute), DurationSeconds: 2400},
+		{AppName: "Editor ", WindowTitle: "util.go", StartTime: day.Add(10*time.Hour + 30*time.Minute), EndTime: day.Add(10*time.Hour + 45*time.Minute), DurationSeconds: 900},
+		{AppName: "browser", WindowTitle: "docs", StartTime: day.Add(10 * time.Hour), EndTime: day.Add(10*time.Hour + 5*time.Minute), DurationSeconds: 300},
+		{AppName: "browser", WindowTitle: "news", StartTime: day.Add(23*time.Hour + 50*time.Minute), EndTime: day.Add(24*time.Hour + 10*time.Minute), DurationSeconds: 1200},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	query := &storage.StatsQuery{
+		StartDate: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC),
+	}
+	matrix, err := stats.HourlyMatrix(db, query)
+	if err != nil {
+		t.Fatalf("HourlyMatrix failed: %v", err)
+	}
+	want := make(map[string][24]int64)
+	for _, d := range matrix {
+		want[d.Date.Format(storage.DateLayout)] = d.Hours
+	}
+
+	dir := t.TempDir()
+	for _, format := range []string{"csv", "json", "jsonl"} {
+		for _, merge := range []bool{false, true} {
+			output := filepath.Join(dir, format+strconv.FormatBool(merge))
+			if err := exportHourly(db, query, format, merge, output, false, nil); err != nil {
+				t.Fatalf("Failed to export %s: %v", format, err)
+			}
+
+			rows := readHourly(t, output, format)
+			got := make(map[string][24]int64)
+			apps := make(map[string]bool)
+			for _, row := range rows {
+				hours := got[row.Date]
+				hours[row.Hour] += row.Seconds
+				got[row.Date] = hours
+				apps[row.App] = true
+			}
+			for date, hours := range want {
+				if got[date] != hours {
+					t.Errorf("%s (merge %v) %s: expected %v, got %v", format, merge, date, hours, got[date])
+				}
+			}
+
+			// Both spellings of the editor land in one row
+			wantApps := map[string]bool{"editor": true, "browser": true}
+			if merge {
+				wantApps = map[string]bool{"": true}
+			}
+			if len(apps) != len(wantApps) {
+				t.Errorf("%s (merge %v): expected apps %v, got %v", format, merge, wantApps, apps)
+			}
+		}
+	}
+}
+
+// readHourly parses an hourly export back into rows
+func readHourly(t *testing.T, path, format string) []hourlyRow {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open export: %v", err)
+	}
+	defer file.Close()
+
+	var rows []hourlyRow
+	switch format {
+	case "csv":
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to read CSV: %v", err)
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			var row hourlyRow
+			for i, column := range header {
+				switch column {
+				case "date":
+					row.Date = record[i]
+				case "hour":
+					row.Hour, _ = strconv.Atoi(record[i])
+				case "app":
+					row.App = record[i]
+				case "seconds":
+					row.Seconds, _ = strconv.ParseInt(record[i], 10, 64)
+				}
+			}
+			rows = append(rows, row)
+		}
+	case "json":
+		if err := json.NewDecoder(file).Decode(&rows); err != nil {
+			t.Fatalf("Failed to decode JSON: %v", err)
+		}
+	case "jsonl":
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var row hourlyRow
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				t.Fatalf("Failed to decode line %q: %v", scanner.Text(), err)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/importer"
+	"github.com/weii/actime/internal/storage"
+)
+
+// importData imports history exported by another tracker. Imported rows
+// are tagged with their source, so `actime delete --source` can remove them.
+func importData() error {
+	// Parse command line arguments
+	format := ""
+	mappingFile := ""
+	file := ""
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--format":
+			if i+1 < len(os.Args) {
+				format = os.Args[i+1]
+				i++
+			}
+		case "--map":
+			if i+1 < len(os.Args) {
+				mappingFile = os.Args[i+1]
+				i++
+			}
+		default:
+			if file != "" {
+				return fmt.Errorf("unexpected argument: %s", arg)
+			}
+			file = arg
+		}
+	}
+
+	if format != importer.FormatRescueTime {
+		return fmt.Errorf("unsupported import format: %q (expected rescuetime)", format)
+	}
+	if file == "" {
+		return fmt.Errorf("missing file to import")
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Rules from the mapping file are tried before app_mapping
+	rules := cfg.AppMapping
+	if mappingFile != "" {
+		mapping, err := importer.LoadMapping(mappingFile)
+		if err != nil {
+			return err
+		}
+		rules = append(mapping, rules...)
+	}
+	apps, err := appname.NewMapper(rules)
+	if err != nil {
+		return fmt.Errorf("invalid app mapping: %w", err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	batch, err := importer.ReadRescueTime(f, apps)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Import(importer.SourceRescueTime, batch.Sessions, batch.Daily)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d sessions (%d already imported) and %d daily totals from %s\n",
+		result.Sessions, result.SkippedSessions, result.DailyStats, file)
+	return nil
+}
+
+// deleteData deletes the data of one source, optionally limited to a date
+// range, and recomputes the daily totals of the affected dates
+func deleteData() error {
+	// Parse command line arguments
+	source := ""
+	appName := ""
+	startDate := ""
+	endDate := ""
+	dryRun := false
+	secure := false
+	yes := false
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--source":
+			if i+1 < len(os.Args) {
+				source = os.Args[i+1]
+				i++
+			}
+		case "--app":
+			if i+1 < len(os.Args) {
+				appName = os.Args[i+1]
+				i++
+			}
+		case "--start":
+			if i+1 < len(os.Args) {
+				startDate = os.Args[i+1]
+				i++
+			}
+		case "--end":
+			if i+1 < len(os.Args) {
+				endDate = os.Args[i+1]
+				i++
+			}
+		case "--dry-run":
+			dryRun = true
+		case "--secure":
+			secure = true
+		case "--yes":
+			yes = true
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if source == "" && appName == "" {
+		return fmt.Errorf("missing --source or --app")
+	}
+	if source != "" {
+		if err := storage.ValidateSource(source); err != nil {
+			return err
+		}
+	}
+
+	query := &storage.StatsQuery{AppName: appName, Source: source}
+	var err error
+	if startDate != "" {
+		if query.StartDate, err = time.ParseInLocation(storage.DateLayout, startDate, time.Local); err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		if query.EndDate, err = time.ParseInLocation(storage.DateLayout, endDate, time.Local); err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	// Deleting all tracked data at once is almost certainly a mistake
+	if appName == "" && source == storage.SourceTracker && query.StartDate.IsZero() && query.EndDate.IsZero() {
+		return fmt.Errorf("deleting tracked data requires --start or --end")
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if appName != "" {
+		return deleteAppSessions(cfg, query, dryRun, secure, yes)
+	}
+
+	if dryRun {
+		db, err := openReadOnly(cfg, nil)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		sessions, days, err := db.CountSource(query)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Would delete %d sessions and %d daily totals from %s\n", sessions, days, source)
+		return nil
+	}
+	if secure {
+		if err := requireDaemonStopped("--secure"); err != nil {
+			return err
+		}
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	sessions, days, err := db.DeleteSource(query)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d sessions and %d daily totals from %s\n", sessions, days, source)
+	if secure {
+		return secureCompact(cfg, db)
+	}
+	return nil
+}
+
+// deleteAppSessions deletes the sessions of one application in the
+// query's range, and of one source if it names one, after showing how
+// many there are and asking for confirmation unless yes is set
+func deleteAppSessions(cfg *core.Config, query *storage.StatsQuery, dryRun, secure, yes bool) error {
+	what := "sessions of " + query.AppName
+	if query.Source != "" {
+		what += " from " + query.Source
+	}
+
+	if dryRun {
+		db, err := openReadOnly(cfg, nil)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		count, err := db.CountSessions(*query)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Would delete %d %s\n", count, what)
+		return nil
+	}
+	if secure {
+		if err := requireDaemonStopped("--secure"); err != nil {
+			return err
+		}
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	count, err := db.CountSessions(*query)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Printf("No %s to delete\n", what)
+		return nil
+	}
+	if !yes && !confirmDelete(os.Stdin, os.Stdout, fmt.Sprintf("Delete %d %s?", count, what)) {
+		fmt.Println("Nothing deleted")
+		return nil
+	}
+
+	sessions, days, err := db.DeleteSessions(*query)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d %s and %d daily totals\n", sessions, what, days)
+	if secure {
+		return secureCompact(cfg, db)
+	}
+	return nil
+}
+
+// confirmDelete asks a yes or no question, no unless the answer is y or yes
+func confirmDelete(in io.Reader, w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N]: ", question)
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/config"
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/fsutil"
+	"github.com/weii/actime/internal/platform"
+	"github.com/weii/actime/internal/service"
+)
+
+// daemonStartTimeout is how long init waits for a started daemon to write
+// its PID file
+const daemonStartTimeout = 3 * time.Second
+
+// initOptions are the options of `actime init`
+type initOptions struct {
+	yes       bool // take the defaults instead of asking
+	autostart bool // enable autostart without asking
+	in        io.Reader
+}
+
+// initSteps are the steps of init that reach beyond files, replaced in tests
+type initSteps struct {
+	checkDetector func(cfg *core.Config) *platform.Diagnosis
+	startDaemon   func() error
+}
+
+// defaultInitSteps check the real detector and start the real daemon
+var defaultInitSteps = initSteps{
+	checkDetector: checkDetector,
+	startDaemon:   startDaemon,
+}
+
+// runInit handles `actime init`: it sets up a new install, or repairs a
+// partly set up one
+func runInit() error {
+	// Parse command line arguments
+	opts := initOptions{in: os.Stdin}
+
+	for i := 2; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--yes", "-y":
+			opts.yes = true
+		case "--autostart":
+			opts.autostart = true
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	return initialize(os.Stdout, opts, defaultInitSteps)
+}
+
+// initialize runs every step of init and reports each one. A step that is
+// already done is left as it is, so running init again repairs whatever
+// is missing; a failed step does not stop the ones that do not need it.
+func initialize(w io.Writer, opts initOptions, steps initSteps) error {
+	reader := bufio.NewReader(opts.in)
+	ask := func(question, def string) string {
+		if opts.yes {
+			return def
+		}
+		fmt.Fprintf(w, "%s [%s]: ", question, def)
+		line, _ := reader.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+		return def
+	}
+	confirm := func(question string, def bool) bool {
+		if opts.yes {
+			return def
+		}
+		hint := "y/N"
+		if def {
+			hint = "Y/n"
+		}
+		switch strings.ToLower(ask(question, hint)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		default:
+			return def
+		}
+	}
+
+	var done []string
+	failed := false
+	report := func(result, step, message string) {
+		fmt.Fprintf(w, "  [%s] %s: %s\n", result, step, message)
+	}
+
+	// Configuration: an existing file is kept, a broken one is left for
+	// the user to fix
+	path, err := config.ExpandPath(config.DefaultConfigPath)
+	if err != nil {
+		return err
+	}
+	var cfg *core.Config
+	if _, err := os.Stat(path); err == nil {
+		cfg, err = config.Load(config.DefaultConfigPath)
+		if err != nil {
+			return fmt.Errorf("the configuration %s is invalid; fix or remove it and run init again: %w", path, err)
+		}
+		report("PASS", "Configuration", "using "+path)
+	} else if os.IsNotExist(err) {
+		cfg, err = config.Load(config.DefaultConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		dbPath, err := config.ExpandPath(ask("Database file", cfg.Database.Path))
+		if err != nil {
+			return err
+		}
+		cfg.Database.Path = dbPath
+		if err := config.Save(cfg, config.DefaultConfigPath); err != nil {
+			return err
+		}
+		report("PASS", "Configuration", "created "+path)
+		done = append(done, "wrote the configuration to "+path)
+	} else {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+
+	// Directories of the database and the log
+	var created []string
+	for _, dir := range []string{filepath.Dir(cfg.Database.Path), filepath.Dir(cfg.Logging.File)} {
+		if _, err := os.Stat(dir); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		created = append(created, dir)
+	}
+	if len(created) > 0 {
+		report("PASS", "Directories", "created "+strings.Join(created, ", "))
+		done = append(done, "created "+strings.Join(created, ", "))
+	} else {
+		report("PASS", "Directories", "present")
+	}
+
+	// Window detection, without which the daemon cannot track anything.
+	// The other capabilities only limit what is tracked, so they warn.
+	detectorOK := true
+	diagnosis := steps.checkDetector(cfg)
+	window := diagnosis.Capability(platform.CapabilityActiveWindow)
+	switch {
+	case diagnosis.DetectorError != nil:
+		report("FAIL", "Window detection", diagnosis.DetectorError.Error())
+		detectorOK = false
+		failed = true
+	case window == nil || !window.Working:
+		message := "the active window cannot be read"
+		if window != nil && window.Detail != "" {
+			message += ": " + window.Detail
+		}
+		report("FAIL", "Window detection", message)
+		detectorOK = false
+		failed = true
+	default:
+		report("PASS", "Window detection", "working")
+		if diagnosis.IdleSourceError != nil {
+			report("WARN", "Idle source", diagnosis.IdleSourceError.Error()+"; using the detector's own")
+		}
+		for _, capability := range diagnosis.Capabilities {
+			if capability.Working || capability.Name == platform.CapabilityActiveWindow {
+				continue
+			}
+			message := capability.Detail
+			if !capability.Supported {
+				message = "not supported: " + message
+			}
+			report("WARN", "Window detection", fmt.Sprintf("%s: %s; see 'actimed doctor'", capability.Name, message))
+		}
+	}
+
+	// Autostart is only enabled on request, and kept once it is
+	autostart, err := autostartPath()
+	if err != nil {
+		report("SKIP", "Autostart", err.Error())
+	} else if _, err := os.Stat(autostart); err == nil {
+		report("PASS", "Autostart", "enabled in "+autostart)
+	} else if opts.autostart || (!opts.yes && confirm("Start the daemon when you log in?", false)) {
+		if err := enableAutostart(autostart); err != nil {
+			report("FAIL", "Autostart", err.Error())
+			failed = true
+		} else {
+			report("PASS", "Autostart", "enabled in "+autostart)
+			done = append(done, "enabled autostart in "+autostart)
+		}
+	} else {
+		report("SKIP", "Autostart", "not enabled; run 'actime init --autostart' to enable it")
+	}
+
+	// The daemon
+	if pid, running := daemonRunning(); running {
+		report("PASS", "Daemon", fmt.Sprintf("running (PID: %d)", pid))
+	} else if !detectorOK {
+		report("SKIP", "Daemon", "not started, since window detection does not work")
+	} else if !confirm("Start the daemon now?", true) {
+		report("SKIP", "Daemon", "not started; start it with 'actimed start'")
+	} else if err := steps.startDaemon(); err != nil {
+		report("FAIL", "Daemon", err.Error())
+		failed = true
+	} else if pid, ok := waitForDaemon(daemonStartTimeout); !ok {
+		report("FAIL", "Daemon", "started but not running; see 'actimed log'")
+		failed = true
+	} else {
+		report("PASS", "Daemon", fmt.Sprintf("started (PID: %d)", pid))
+		done = append(done, "started the daemon")
+	}
+
+	fmt.Fprintln(w)
+	if failed {
+		return fmt.Errorf("setup is incomplete; fix the failed steps and run 'actime init' again")
+	}
+
+	if len(done) == 0 {
+		fmt.Fprintln(w, "Actime was already set up; nothing changed.")
+	} else {
+		fmt.Fprintln(w, "Actime is set up:")
+		for _, item := range done {
+			fmt.Fprintf(w, "  - %s\n", item)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Try next:")
+	fmt.Fprintln(w, "  actimed status            check that the daemon is tracking")
+	fmt.Fprintln(w, "  actime sessions --live    list the sessions recorded so far")
+	fmt.Fprintln(w, "  actime stats              show today's time per application")
+	return nil
+}
+
+// checkDetector runs the probes of `actimed doctor` on the configured
+// window detector
+func checkDetector(cfg *core.Config) *platform.Diagnosis {
+	return platform.Diagnose(cfg.Monitor.Detectors, cfg.Monitor.DetectorTimeout, cfg.Monitor.IdleSource == "evdev")
+}
+
+// startDaemon runs `actimed start`
+func startDaemon() error {
+	path, err := actimedPath()
+	if err != nil {
+		return err
+	}
+	if output, err := exec.Command(path, "start").CombinedOutput(); err != nil {
+		return fmt.Errorf("actimed start failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// daemonRunning returns the PID of the running daemon
+func daemonRunning() (int, bool) {
+	pid, err := service.ReadPIDFile(service.PIDFile)
+	if err != nil || !service.IsProcessRunning(pid) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// waitForDaemon waits for a started daemon to write its PID file
+func waitForDaemon(timeout time.Duration) (int, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if pid, running := daemonRunning(); running {
+			return pid, true
+		}
+		if time.Now().After(deadline) {
+			return 0, false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// actimedPath finds the daemon binary, preferring the one installed next
+// to actime
+func actimedPath() (string, error) {
+	name := "actimed"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if exe, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(exe), name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("actimed was not found next to actime or in PATH")
+	}
+	return path, nil
+}
+
+// autostartPath returns the file that starts the daemon at login: an XDG
+// autostart entry on Linux, a script in the Startup folder on Windows
+func autostartPath() (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to get home directory: %w", err)
+			}
+			dir = filepath.Join(home, ".config")
+		}
+		return filepath.Join(dir, "autostart", "actimed.desktop"), nil
+	case "windows":
+		dir := os.Getenv("APPDATA")
+		if dir == "" {
+			return "", fmt.Errorf("APPDATA is not set")
+		}
+		return filepath.Join(dir, "Microsoft", "Windows", "Start Menu", "Programs", "Startup", "actimed.cmd"), nil
+	default:
+		return "", fmt.Errorf("not supported on %s", runtime.GOOS)
+	}
+}
+
+// enableAutostart writes the autostart file for the installed daemon
+func enableAutostart(path string) error {
+	actimed, err := actimedPath()
+	if err != nil {
+		return err
+	}
+
+	var content string
+	if runtime.GOOS == "windows" {
+		content = fmt.Sprintf("@\"%s\" start\r\n", actimed)
+	} else {
+		content = fmt.Sprintf("[Desktop Entry]\nType=Application\nName=Actime\nComment=Tracks application usage time\nExec=\"%s\" start\nX-GNOME-Autostart-enabled=true\n", actimed)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create autostart directory: %w", err)
+	}
+	if err := fsutil.WriteFile(path, []byte(content), 0644, true); err != nil {
+		return fmt.Errorf("failed to write autostart file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/weii/actime/internal/config"
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/platform"
+	"github.com/weii/actime/internal/service"
+)
+
+func TestInitSetsUpAndRepairs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("autostart entries are checked on Linux")
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	// A stand-in daemon binary for the autostart entry
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "actimed"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to write actimed: %v", err)
+	}
+	t.Setenv("PATH", bin)
+
+	pidFile := service.PIDFile
+	service.PIDFile = filepath.Join(t.TempDir(), "actime.pid")
+	defer func() { service.PIDFile = pidFile }()
+
+	// The daemon stub is this process, reachable through its PID file. The
+	// detector cannot tell the lock state, which only warns.
+	starts := 0
+	steps := initSteps{
+		checkDetector: func(cfg *core.Config) *platform.Diagnosis {
+			return &platform.Diagnosis{Capabilities: []platform.Capability{
+				{Name: platform.CapabilityActiveWindow, Supported: true, Working: true},
+				{Name: platform.CapabilityIdle, Supported: true, Working: true},
+				{Name: platform.CapabilityLock, Detail: "no screen saver"},
+			}}
+		},
+		startDaemon: func() error {
+			starts++
+			return service.WritePIDFile(service.PIDFile)
+		},
+	}
+
+	var out bytes.Buffer
+	if err := initialize(&out, initOptions{yes: true, autostart: true}, steps); err != nil {
+		t.Fatalf("Init failed: %v\n%s", err, out.String())
+	}
+
+	cfg, err := config.Load(config.DefaultConfigPath)
+	if err != nil {
+		t.Fatalf("Failed to load the written configuration: %v", err)
+	}
+	if want := filepath.Join(home, ".actime", "actime.db"); cfg.Database.Path != want {
+		t.Errorf("Expected database %s, got %s", want, cfg.Database.Path)
+	}
+	for _, path := range []string{
+		filepath.Join(home, ".actime", "config.yaml"),
+		filepath.Join(home, ".actime"),
+		filepath.Join(home, ".config", "autostart", "actimed.desktop"),
+	} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to exist: %v", path, err)
+		}
+	}
+	entry, _ := os.ReadFile(filepath.Join(home, ".config", "autostart", "actimed.desktop"))
+	if !strings.Contains(string(entry), `Exec="`+filepath.Join(bin, "actimed")+`" start`) {
+		t.Errorf("Unexpected autostart entry:\n%s", entry)
+	}
+	if starts != 1 {
+		t.Errorf("Expected the daemon to be started once, got %d", starts)
+	}
+	for _, want := range []string{"[PASS] Window detection: working", "[WARN] Window detection: lock: not supported: no screen saver", "[PASS] Daemon: started", "Try next:", "actime stats"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, out.String())
+		}
+	}
+
+	// Running again changes nothing
+	out.Reset()
+	if err := initialize(&out, initOptions{yes: true}, steps); err != nil {
+		t.Fatalf("Second init failed: %v\n%s", err, out.String())
+	}
+	if starts != 1 {
+		t.Errorf("Expected the running daemon to be left alone, got %d starts", starts)
+	}
+	if !strings.Contains(out.String(), "already set up") {
+		t.Errorf("Expected nothing to change:\n%s", out.String())
+	}
+
+	// A half-configured install is repaired: the data directory is back and
+	// the stopped daemon is started, while the configuration is kept
+	custom := filepath.Join(home, "data", "usage.db")
+	cfg.Database.Path = custom
+	if err := config.Save(cfg, config.DefaultConfigPath); err != nil {
+		t.Fatalf("Failed to save configuration: %v", err)
+	}
+	os.Remove(service.PIDFile)
+	out.Reset()
+	if err := initialize(&out, initOptions{yes: true}, steps); err != nil {
+		t.Fatalf("Repairing init failed: %v\n%s", err, out.String())
+	}
+	if _, err := os.Stat(filepath.Dir(custom)); err != nil {
+		t.Errorf("Expected the data directory to be created: %v", err)
+	}
+	if starts != 2 {
+		t.Errorf("Expected the stopped daemon to be started again, got %d starts", starts)
+	}
+
+	// Without window detection the daemon is not started and init fails
+	os.Remove(service.PIDFile)
+	steps.checkDetector = func(cfg *core.Config) *platform.Diagnosis {
+		return &platform.Diagnosis{DetectorError: errors.New("cannot open display")}
+	}
+	out.Reset()
+	if err := initialize(&out, initOptions{yes: true}, steps); err == nil {
+		t.Fatalf("Expected init to fail without window detection:\n%s", out.String())
+	}
+	if starts != 2 || !strings.Contains(out.String(), "[FAIL] Window detection: cannot open display") {
+		t.Errorf("Expected the failure to be reported and the daemon left stopped:\n%s", out.String())
+	}
+
+	// A detector that starts but cannot read the active window fails too
+	steps.checkDetector = func(cfg *core.Config) *platform.Diagnosis {
+		return &platform.Diagnosis{Capabilities: []platform.Capability{
+			{Name: platform.CapabilityActiveWindow, Supported: true, Detail: "no focused window reported"},
+		}}
+	}
+	out.Reset()
+	if err := initialize(&out, initOptions{yes: true}, steps); err == nil {
+		t.Fatalf("Expected init to fail without the active window:\n%s", out.String())
+	}
+	if starts != 2 || !strings.Contains(out.String(), "[FAIL] Window detection: the active window cannot be read: no focused window reported") {
+		t.Errorf("Expected the failed probe to be reported and the daemon left stopped:\n%s", out.String())
+	}
+}
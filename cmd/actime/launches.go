@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+// launchCounts returns how often each app was launched in the query's
+// range, keyed by the lower-case app name. Sessions the daemon has not
+// written yet are included when it is reachable.
+func launchCounts(db *storage.DB, query *storage.StatsQuery, gap time.Duration, now time.Time) (map[string]int, error) {
+	persisted, err := db.GetSessions(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	var live []*storage.Session
+	if storage.IsTracked(query.Source) {
+		live, err = readLiveSessions(now)
+		if errors.Is(err, service.ErrDaemonUnreachable) {
+			live = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	// Stored checkpoints of one session must not count as several launches
+	sessions := stats.MergeSessions(persisted, live)
+	from := query.StartDate.Format(storage.DateLayout)
+	to := query.EndDate.Format(storage.DateLayout)
+	var launches []*stats.AppLaunches
+	for _, launch := range stats.Launches(sessions, gap) {
+		if date := launch.Date.Format(storage.DateLayout); date >= from && date <= to {
+			launches = append(launches, launch)
+		}
+	}
+	return stats.LaunchesByApp(launches), nil
+}
+
+// launchLabel formats a launch count
+func launchLabel(n int) string {
+	if n == 1 {
+		return "1 launch"
+	}
+	return fmt.Sprintf("%d launches", n)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestLaunchCountsMergesCheckpoints(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Two stored checkpoints of one editor session, then a browser session
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	if err := db.BatchInsertSessions([]*storage.Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60},
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(2 * time.Minute), DurationSeconds: 120},
+		{AppName: "browser", WindowTitle: "docs", StartTime: start.Add(2 * time.Minute), EndTime: start.Add(3 * time.Minute), DurationSeconds: 60},
+	}); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	// The daemon holds the return to the editor
+	stubLiveSessions(t, []*storage.Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start.Add(3 * time.Minute), EndTime: start.Add(4 * time.Minute), DurationSeconds: 60},
+	}, nil)
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	got, err := launchCounts(db, &storage.StatsQuery{StartDate: day, EndDate: day}, 5*time.Minute, start)
+	if err != nil {
+		t.Fatalf("Failed to count launches: %v", err)
+	}
+	if want := map[string]int{"editor": 2, "browser": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
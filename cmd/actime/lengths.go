@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+// showSessionLengths prints how long each app's sessions were over the
+// range, today by default. Sessions belong to the day they start on.
+func showSessionLengths(db *storage.DB, startDate, endDate, source string, coalesce time.Duration, now time.Time) error {
+	today, _ := time.Parse("2006-01-02", now.Format("2006-01-02"))
+	start := today
+	end := today
+
+	var err error
+	if startDate != "" {
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		end, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	lengths, err := sessionLengths(db, &storage.StatsQuery{StartDate: start, EndDate: end, Source: source}, coalesce, now)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Session lengths, %s to %s:\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	fmt.Println()
+	renderSessionLengths(os.Stdout, lengths)
+	return nil
+}
+
+// sessionLengths computes the session lengths of the query's range,
+// including the sessions the daemon has not written yet when it is
+// reachable
+func sessionLengths(db *storage.DB, query *storage.StatsQuery, coalesce time.Duration, now time.Time) ([]stats.SessionLength, error) {
+	persisted, err := db.GetSessions(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	var live []*storage.Session
+	if storage.IsTracked(query.Source) {
+		live, err = readLiveSessions(now)
+		if errors.Is(err, service.ErrDaemonUnreachable) {
+			live = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	// Live sessions may have started before the range
+	var sessions []*storage.Session
+	from := query.StartDate.Format(storage.DateLayout)
+	to := query.EndDate.Format(storage.DateLayout)
+	for _, session := range stats.MergeSessions(persisted, live) {
+		if date := session.StartTime.Format(storage.DateLayout); date >= from && date <= to {
+			sessions = append(sessions, session)
+		}
+	}
+	return stats.SessionLengthStats(sessions, stats.SessionLengthOptions{Coalesce: coalesce}), nil
+}
+
+// renderSessionLengths writes one row per app
+func renderSessionLengths(w io.Writer, lengths []stats.SessionLength) {
+	if len(lengths) == 0 {
+		fmt.Fprintln(w, "  No data for this range")
+		return
+	}
+
+	seconds := func(v float64) string {
+		return durations.Seconds(int64(math.Round(v)))
+	}
+
+	fmt.Fprintf(w, "  %-20s  %8s  %10s  %10s  %10s  %10s\n", "App", "Sessions", "Mean", "Median", "p90", "Max")
+	for _, length := range lengths {
+		fmt.Fprintf(w, "  %-20s  %8d  %10s  %10s  %10s  %10s\n",
+			length.AppName, length.Count, seconds(length.Mean), seconds(length.Median),
+			seconds(length.P90), durations.Seconds(length.Max))
+	}
+}
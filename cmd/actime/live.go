@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+// readLiveSessions reads the sessions the daemon has not written yet
+var readLiveSessions = service.ReadLiveSessions
+
+// readCurrentSession reads the session the daemon is recording right now
+var readCurrentSession = service.ReadCurrentSession
+
+// liveDailyStats returns the time the running daemon has tracked in the
+// query's range but not written yet, as daily rows, and its total. Without
+// a reachable daemon it returns nothing, so callers show stored data only.
+func liveDailyStats(db *storage.DB, query *storage.StatsQuery, now time.Time) ([]*storage.DailyStats, int64, error) {
+	unsaved, err := unsavedSessions(db, query, now)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rows []*storage.DailyStats
+	var total int64
+	for _, row := range stats.SessionDailyStats(unsaved) {
+		date := row.Date.Format(storage.DateLayout)
+		if !query.StartDate.IsZero() && date < query.StartDate.Format(storage.DateLayout) {
+			continue
+		}
+		if !query.EndDate.IsZero() && date > query.EndDate.Format(storage.DateLayout) {
+			continue
+		}
+		if query.AppName != "" && !strings.EqualFold(row.AppName, query.AppName) {
+			continue
+		}
+		rows = append(rows, row)
+		total += row.TotalSeconds
+	}
+	return rows, total, nil
+}
+
+// unsavedSessions returns the part of the running daemon's sessions that is
+// not written yet, for the query's source. Without a reachable daemon it
+// returns nothing.
+func unsavedSessions(db *storage.DB, query *storage.StatsQuery, now time.Time) ([]*storage.Session, error) {
+	// The daemon only holds tracked sessions
+	if !storage.IsTracked(query.Source) {
+		return nil, nil
+	}
+
+	live, err := readLiveSessions(now)
+	if errors.Is(err, service.ErrDaemonUnreachable) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(live) == 0 {
+		return nil, nil
+	}
+
+	// Checkpoints of the live sessions are already stored; start a day
+	// early to catch sessions running over midnight
+	persisted, err := db.GetSessions(&storage.StatsQuery{
+		StartDate: query.StartDate.AddDate(0, 0, -1),
+		EndDate:   query.EndDate,
+		Source:    storage.SourceTracker,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	return stats.Unsaved(persisted, live), nil
+}
+
+// printUnsaved notes how much of the shown time is not in the database yet
+func printUnsaved(w io.Writer, seconds int64) {
+	if seconds > 0 {
+		fmt.Fprintf(w, "  * includes %s not yet saved\n", durations.Seconds(seconds))
+	}
+}
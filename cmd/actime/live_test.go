@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/storage"
+)
+
+// stubLiveSessions makes readLiveSessions return sessions and err, and
+// readCurrentSession no current session
+func stubLiveSessions(t *testing.T, sessions []*storage.Session, err error) {
+	t.Helper()
+	stubCurrentSession(t, nil, err)
+	original := readLiveSessions
+	readLiveSessions = func(time.Time) ([]*storage.Session, error) {
+		return sessions, err
+	}
+	t.Cleanup(func() { readLiveSessions = original })
+}
+
+// stubCurrentSession makes readCurrentSession return current and err
+func stubCurrentSession(t *testing.T, current *service.CurrentSession, err error) {
+	t.Helper()
+	original := readCurrentSession
+	readCurrentSession = func(time.Time) (*service.CurrentSession, error) {
+		return current, err
+	}
+	t.Cleanup(func() { readCurrentSession = original })
+}
+
+func TestPrintTopIncludesUnsavedTime(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// A checkpoint of the open session is already stored
+	start := time.Now().Truncate(time.Second)
+	checkpoint := []*storage.Session{{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(10 * time.Minute), DurationSeconds: 600}}
+	if err := db.BatchInsertSessions(checkpoint); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(checkpoint); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	// The daemon has the same session at 20 minutes and a meeting
+	stubLiveSessions(t, []*storage.Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(20 * time.Minute), DurationSeconds: 1200},
+		{AppName: "zoom", WindowTitle: "standup", StartTime: start.Add(5 * time.Minute), EndTime: start.Add(9 * time.Minute), DurationSeconds: 240},
+	}, nil)
+
+	var buf bytes.Buffer
+	if err := printTop(&buf, db, "today", time.Monday, 10, 80); err != nil {
+		t.Fatalf("Failed to print top: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "1. editor") || !strings.Contains(out, "20m 0s") {
+		t.Errorf("Expected the checkpoint to be counted once, got %q", out)
+	}
+	if !strings.Contains(out, "2. zoom") || !strings.Contains(out, "Total: 24m 0s") {
+		t.Errorf("Expected the unsaved meeting to be included, got %q", out)
+	}
+	if !strings.Contains(out, "includes 14m 0s not yet saved") {
+		t.Errorf("Expected a footnote for the unsaved time, got %q", out)
+	}
+}
+
+func TestPrintTopWithoutDaemon(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now().Truncate(time.Second)
+	stored := []*storage.Session{{AppName: "editor", StartTime: start, EndTime: start, DurationSeconds: 60}}
+	if err := db.BatchInsertSessions(stored); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(stored); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	stubLiveSessions(t, nil, service.ErrDaemonUnreachable)
+
+	var buf bytes.Buffer
+	if err := printTop(&buf, db, "today", time.Monday, 10, 80); err != nil {
+		t.Fatalf("Failed to print top: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Total: 1m 0s") || strings.Contains(out, "not yet saved") {
+		t.Errorf("Expected stored data only, got %q", out)
+	}
+}
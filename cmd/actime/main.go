@@ -1,21 +1,36 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/weii/actime/internal/appname"
 	"github.com/weii/actime/internal/config"
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/export"
+	"github.com/weii/actime/internal/format"
+	"github.com/weii/actime/internal/fsutil"
+	"github.com/weii/actime/internal/report"
+	"github.com/weii/actime/internal/stats"
 	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/trace"
 )
 
 const (
 	Version = "0.1.0"
 )
 
+// durations renders durations in the configured report style
+var durations = format.Formatter{Style: format.DefaultStyle}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -25,19 +40,64 @@ func main() {
 	command := os.Args[1]
 
 	switch command {
+	case "init":
+		if err := runInit(); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
 	case "stats":
 		if err := showStats(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			printError(err)
+			os.Exit(1)
+		}
+	case "sessions":
+		if err := showSessions(); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "top":
+		if err := showTop(); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "query":
+		if err := runQuery(); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 	case "export":
 		if err := exportData(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			printError(err)
+			os.Exit(1)
+		}
+	case "import":
+		if err := importData(); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "delete":
+		if err := deleteData(); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "prune":
+		if err := pruneData(); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	case "db":
+		if err := runDB(); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 	case "config":
 		if err := showConfig(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			printError(err)
+			os.Exit(1)
+		}
+	case "meta":
+		if err := showMeta(); err != nil {
+			printError(err)
 			os.Exit(1)
 		}
 	case "version":
@@ -51,92 +111,563 @@ func main() {
 	}
 }
 
+// printError reports a failed command. A corrupted database gets
+// instructions, since the CLI never repairs it on its own.
+func printError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if errors.Is(err, storage.ErrDatabaseNotFound) {
+		fmt.Fprintln(os.Stderr, "Nothing has been tracked yet. To set up tracking, run: actime init")
+		return
+	}
+	if !storage.IsCorrupt(err) {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "The database file is damaged. To recover:")
+	fmt.Fprintln(os.Stderr, "  - start the daemon (actimed start): it moves the file aside and salvages what it can, or")
+	fmt.Fprintln(os.Stderr, "  - stop the daemon and run: actime db salvage <database file> [--output new.db],")
+	fmt.Fprintln(os.Stderr, "    then replace the database with the salvaged copy")
+}
+
 func printUsage() {
 	fmt.Printf("Actime CLI v%s\n\n", Version)
 	fmt.Println("Usage: actime <command> [options]")
 	fmt.Println()
 	fmt.Println("Commands:")
-	fmt.Println("  stats    Show usage statistics")
-	fmt.Println("  export   Export data to CSV or JSON")
+	fmt.Println("  init     Set up or repair the configuration, directories, autostart and daemon [--yes] [--autostart]")
+	fmt.Println("  stats    Show usage statistics [--timing] [--show-launches] [--check: data-quality warnings] [--presence: time at the computer] [--session-lengths [--coalesce 2m]] [--source S] [--range R | --start D [--end D]] [--by hour [--app X] [--average]] [--by domain | --by-domain [--app X]] [--by monitor | --by-monitor [--app X]] [--by title | --titles --app X: top window titles]")
+	fmt.Println("  sessions List sessions [--since 14:00] [--until T | --range R] [--app X] [--source S] [--limit N] [--live] [--coalesce 5s] [--format text|json]")
+	fmt.Println("  top      Show the top applications [--watch [interval]] [--n 10] [--range today|week|R]")
+	fmt.Println("  query    Query sessions or daily totals: [--from sessions|daily] [--select app,date,seconds] [--where 'app~firefox'] [--group-by app] [--order -seconds] [--limit N] [--format table|csv|json]")
+	fmt.Println("  export   Export data to CSV or JSON [--timing] [--source S] [--range R | --start D --end D] [--output F [--overwrite]] [--layout wide [--unit minutes|seconds|hours] [--top N] [--precision 2]] [--format toggl [--project-map rules.yaml]] [--type hourly [--format csv|json|jsonl] [--app NAME] [--merge-apps] [--timezone TZ]] [--auto-catchup]")
+	fmt.Println("  import   Import history: --format rescuetime [--map rules.yaml] file.csv")
+	fmt.Println("  delete   Delete the data of one source or app: --source import:rescuetime | --app X [--source S] [--yes] [--start D] [--end D] [--dry-run] [--secure]")
+	fmt.Println("  prune    Delete old sessions: --before D | --keep-days N [--export-first dir] [--with-stats] [--dry-run] [--secure]")
+	fmt.Println("  db       Database maintenance: backup [--output file], check [--repair split|truncate], clean --shell [--relabel NAME] [--dry-run], clean-names [--titles] [--dry-run], compact, merge file [--device NAME], recompute-daily [--all | --start D [--end D]], salvage file [--output new.db], scrub --pattern RE [--replace TEXT] [--app X] [--start D] [--end D] [--yes] [--force] [--secure], deadletter [replay]")
 	fmt.Println("  config   Show configuration")
+	fmt.Println("  meta     Show the version, database schema and capabilities for integrations [--json]")
 	fmt.Println("  version  Show version information")
 	fmt.Println("  help     Show this help message")
+	fmt.Println()
+	fmt.Println("Ranges (R): today, yesterday, this-week, last-week, this-month, last-30d")
 }
 
 func showStats() error {
-	fmt.Println("Usage Statistics:")
-	fmt.Println()
+	// Parse command line arguments
+	check := false
+	presence := false
+	showLaunches := false
+	sessionLengths := false
+	var coalesce time.Duration
+	by := ""
+	appName := ""
+	average := false
+	startDate := ""
+	endDate := ""
+	rangeName := ""
+	source := ""
+	timing := false
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--check":
+			check = true
+		case "--timing":
+			timing = true
+		case "--presence":
+			presence = true
+		case "--show-launches":
+			showLaunches = true
+		case "--session-lengths":
+			sessionLengths = true
+		case "--coalesce":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("missing value for %s", arg)
+			}
+			d, err := time.ParseDuration(os.Args[i+1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid value for --coalesce: %s", os.Args[i+1])
+			}
+			coalesce = d
+			i++
+		case "--by-domain":
+			by = "domain"
+		case "--by-monitor":
+			by = "monitor"
+		case "--titles":
+			by = "title"
+		case "--by":
+			if i+1 < len(os.Args) {
+				by = os.Args[i+1]
+				i++
+			}
+		case "--app":
+			if i+1 < len(os.Args) {
+				appName = os.Args[i+1]
+				i++
+			}
+		case "--average":
+			average = true
+		case "--source":
+			if i+1 < len(os.Args) {
+				source = os.Args[i+1]
+				i++
+			}
+		case "--start":
+			if i+1 < len(os.Args) {
+				startDate = os.Args[i+1]
+				i++
+			}
+		case "--end":
+			if i+1 < len(os.Args) {
+				endDate = os.Args[i+1]
+				i++
+			}
+		case "--range":
+			if i+1 < len(os.Args) {
+				rangeName = os.Args[i+1]
+				i++
+			}
+		}
+	}
+
+	if source != "" {
+		if err := storage.ValidateSource(source); err != nil {
+			return err
+		}
+	}
 
 	// Load configuration
-	cfg, err := config.Load(config.DefaultConfigPath)
+	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
+	startDate, endDate, err = resolveRange(cfg, rangeName, startDate, endDate, time.Now())
+	if err != nil {
+		return err
+	}
+
 	// Open database
-	db, err := storage.NewDB(cfg.Database.Path)
+	timer := newTimer(timing)
+	db, err := openReadOnly(cfg, timer)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
 	defer db.Close()
 
-	// Get today's stats
-	today := time.Now().Format("2006-01-02")
-	startDate, _ := time.Parse("2006-01-02", today)
-	endDate := startDate.Add(24 * time.Hour)
+	if check {
+		return checkDataQuality(db, startDate, endDate)
+	}
+	if presence {
+		return showPresence(db, cfg.Monitor.ActivityWindow, startDate, endDate)
+	}
+	if sessionLengths {
+		return showSessionLengths(db, startDate, endDate, source, coalesce, time.Now())
+	}
+
+	// Let --app match any alias of an application
+	if appName != "" {
+		apps, err := appname.NewMapper(cfg.AppMapping)
+		if err != nil {
+			return fmt.Errorf("invalid app mapping: %w", err)
+		}
+		appName = apps.Canonical(appName)
+	}
+
+	switch by {
+	case "":
+	case "hour":
+		return showHourlyStats(db, appName, source, average, startDate, endDate, timer)
+	case "domain":
+		return showDomainStats(db, core.NewBrowsers(cfg), appName, source, startDate, endDate, time.Now())
+	case "monitor":
+		return showMonitorStats(db, appName, source, startDate, endDate, time.Now())
+	case "title":
+		if appName == "" {
+			return fmt.Errorf("--titles needs --app")
+		}
+		if source != "" {
+			return fmt.Errorf("--titles does not support --source")
+		}
+		return showTitleStats(db, appName, startDate, endDate, time.Now())
+	default:
+		return fmt.Errorf("unsupported breakdown: %s (expected hour, domain, monitor or title)", by)
+	}
+
+	// Get the stats of the range, today by default
+	startDay, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	if startDate != "" {
+		startDay, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	endDay := startDay
+	if endDate != "" {
+		endDay, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	query := &storage.StatsQuery{
+		StartDate: startDay,
+		EndDate:   endDay,
+		Source:    source,
+	}
+
+	// Read everything from one snapshot, so a flush by the daemon between
+	// the queries cannot make them disagree
+	var totals []stats.AppTotal
+	var unsaved int64
+	var launches map[string]int
+	var hint bytes.Buffer
+	err = db.Snapshot(func(view *storage.DB) error {
+		span := timer.Start(trace.Query)
+		saved, err := view.GetTopApps(query)
+		span.End()
+		if err != nil {
+			return fmt.Errorf("failed to get statistics: %w", err)
+		}
+
+		// Add what the daemon has tracked since its last flush
+		span = timer.Start(trace.Query)
+		var live []*storage.DailyStats
+		live, unsaved, err = liveDailyStats(view, query, time.Now())
+		span.End()
+		if err != nil {
+			return err
+		}
+
+		span = timer.Start(trace.Aggregate)
+		totals = stats.AddToTotals(saved, live)
+		span.End()
+
+		if showLaunches {
+			span = timer.Start(trace.Query)
+			launches, err = launchCounts(view, query, cfg.Report.LaunchGap, time.Now())
+			span.End()
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(totals) == 0 {
+			printRecomputeHint(&hint, view, query)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	span := timer.Start(trace.Render)
+	var out bytes.Buffer
+	if startDate == "" && endDate == "" {
+		fmt.Fprintln(&out, "Usage Statistics:")
+	} else {
+		fmt.Fprintf(&out, "Usage Statistics (%s to %s):\n", startDay.Format("2006-01-02"), endDay.Format("2006-01-02"))
+	}
+	fmt.Fprintln(&out)
+	if len(totals) == 0 {
+		if startDate == "" && endDate == "" {
+			fmt.Fprintln(&out, "  No data for today")
+		} else {
+			fmt.Fprintln(&out, "  No data for this range")
+		}
+		out.Write(hint.Bytes())
+	} else {
+		fmt.Fprintf(&out, "  Total time: %s\n", durations.Seconds(stats.Sum(totals)))
+		fmt.Fprintln(&out)
+		fmt.Fprintln(&out, "  By application:")
+		for _, total := range totals {
+			fmt.Fprintf(&out, "    %s: %s", total.AppName, durations.Seconds(total.TotalSeconds))
+			if showLaunches {
+				fmt.Fprintf(&out, " (%s)", launchLabel(launches[strings.ToLower(total.AppName)]))
+			}
+			fmt.Fprintln(&out)
+		}
+		if unsaved > 0 {
+			fmt.Fprintln(&out)
+			printUnsaved(&out, unsaved)
+		}
+	}
+	span.End()
+
+	span = timer.Start(trace.Write)
+	_, err = os.Stdout.Write(out.Bytes())
+	span.End()
+
+	printTiming(os.Stderr, timer)
+	return err
+}
+
+// printRecomputeHint explains an empty result when the range has sessions
+// but its daily statistics are missing
+func printRecomputeHint(w io.Writer, db *storage.DB, query *storage.StatsQuery) {
+	missing, err := db.HasSessionsWithoutDailyStats(query)
+	if err != nil || !missing {
+		return
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  Sessions exist for this range but daily statistics are missing.")
+	fmt.Fprintln(w, "  Rebuild them with: actime db recompute-daily --all")
+}
+
+// checkDataQuality prints coverage and data-quality warnings for a range.
+// Without explicit dates the last 7 days are checked.
+func checkDataQuality(db *storage.DB, startDate, endDate string) error {
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	start := today.AddDate(0, 0, -6)
+	end := today
+
+	var err error
+	if startDate != "" {
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		end, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
 
 	query := &storage.StatsQuery{
-		StartDate: startDate,
-		EndDate:   endDate,
+		StartDate: start,
+		EndDate:   end,
 	}
 
-	stats, err := db.GetDailyStats(query)
+	daily, err := db.GetDailyStats(query)
 	if err != nil {
 		return fmt.Errorf("failed to get statistics: %w", err)
 	}
 
-	if len(stats) == 0 {
-		fmt.Println("  No data for today")
-		return nil
+	sessions, err := db.GetSessions(query)
+	if err != nil {
+		return fmt.Errorf("failed to get sessions: %w", err)
 	}
 
-	// Calculate total
-	var totalSeconds int64
-	for _, stat := range stats {
-		totalSeconds += stat.TotalSeconds
+	gaps, err := db.GetGaps(query)
+	if err != nil {
+		return fmt.Errorf("failed to get gaps: %w", err)
 	}
 
-	fmt.Printf("  Total time: %s\n", formatDuration(totalSeconds))
+	result := report.CheckQuality(daily, sessions, gaps, start, end)
+
+	fmt.Printf("Data quality check (%s to %s):\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
 	fmt.Println()
-	fmt.Println("  By application:")
+	fmt.Println("  Coverage by day:")
+	if len(result.Coverage) == 0 {
+		fmt.Println("    No sessions in this range")
+	}
+	for _, day := range result.Coverage {
+		fmt.Printf("    %s  %s tracked, %s idle, locked or suspended of %s active span (%.0f%%)\n",
+			day.Date.Format("2006-01-02"),
+			durations.Seconds(day.TrackedSeconds),
+			durations.Seconds(day.GapSeconds),
+			durations.Seconds(day.SpanSeconds),
+			day.Ratio()*100)
+	}
 
-	for _, stat := range stats {
-		fmt.Printf("    %s: %s\n", stat.AppName, formatDuration(stat.TotalSeconds))
+	fmt.Println()
+	if len(result.Warnings) == 0 {
+		fmt.Println("  No warnings")
+		return nil
+	}
+
+	fmt.Println("  Warnings:")
+	for _, warning := range result.Warnings {
+		fmt.Printf("    [%s] %s: %s\n", warning.Kind, warning.Date.Format("2006-01-02"), warning.Message)
 	}
 
 	return nil
 }
 
+// showHourlyStats prints time per hour of the day, by default for today
+func showHourlyStats(db *storage.DB, appName, source string, average bool, startDate, endDate string, timer *trace.Timer) error {
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	start := today
+	end := today
+
+	var err error
+	if startDate != "" {
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		end, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	span := timer.Start(trace.Query)
+	rows, err := db.GetHourlyStats(&storage.StatsQuery{
+		AppName:   appName,
+		StartDate: start,
+		EndDate:   end,
+		Source:    source,
+	})
+	span.End()
+	if err != nil {
+		return fmt.Errorf("failed to get hourly stats: %w", err)
+	}
+
+	span = timer.Start(trace.Aggregate)
+	buckets := stats.HourOfDayStats(rows, start, end, time.Now())
+
+	var totalSeconds int64
+	var maxValue float64
+	values := make([]float64, len(buckets))
+	for i, bucket := range buckets {
+		totalSeconds += bucket.Seconds
+		values[i] = float64(bucket.Seconds)
+		if average {
+			values[i] = bucket.Average()
+		}
+		if values[i] > maxValue {
+			maxValue = values[i]
+		}
+	}
+	span.End()
+
+	span = timer.Start(trace.Render)
+	var out bytes.Buffer
+	title := "Usage by hour"
+	if appName != "" {
+		title += " for " + appName
+	}
+	if average {
+		title += " (average per day)"
+	}
+	fmt.Fprintf(&out, "%s, %s to %s:\n", title, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	fmt.Fprintln(&out)
+
+	const barWidth = 40
+	for i, bucket := range buckets {
+		share := 0.0
+		if totalSeconds > 0 {
+			share = float64(bucket.Seconds) / float64(totalSeconds) * 100
+		}
+		bar := 0
+		if maxValue > 0 {
+			bar = int(barWidth * values[i] / maxValue)
+		}
+		fmt.Fprintf(&out, "  %02d:00  %12s  %5.1f%%  %s\n",
+			bucket.Hour, durations.Seconds(int64(values[i])), share, strings.Repeat("#", bar))
+	}
+
+	fmt.Fprintln(&out)
+	fmt.Fprintf(&out, "  Total time: %s\n", durations.Seconds(totalSeconds))
+	span.End()
+
+	span = timer.Start(trace.Write)
+	_, err = os.Stdout.Write(out.Bytes())
+	span.End()
+
+	printTiming(os.Stderr, timer)
+	return err
+}
+
 func exportData() error {
 	// Parse command line arguments
 	format := "csv"
 	outputFile := "actime_export.csv"
 	startDate := ""
 	endDate := ""
+	rangeName := ""
+	projectMap := ""
+	source := ""
+	overwrite := false
+	layout := "long"
+	unit := string(stats.UnitMinutes)
+	top := 0
+	precision := 2
+	timing := false
+	exportType := "daily"
+	mergeApps := false
+	appName := ""
+	timezone := ""
+	autoCatchUp := false
 
 	for i := 2; i < len(os.Args); i++ {
 		arg := os.Args[i]
 		switch arg {
+		case "--auto-catchup":
+			autoCatchUp = true
+		case "--type":
+			if i+1 < len(os.Args) {
+				exportType = os.Args[i+1]
+				i++
+			}
+		case "--merge-apps":
+			mergeApps = true
+		case "--app":
+			if i+1 < len(os.Args) {
+				appName = os.Args[i+1]
+				i++
+			}
+		case "--timezone":
+			if i+1 < len(os.Args) {
+				timezone = os.Args[i+1]
+				i++
+			}
 		case "--format":
 			if i+1 < len(os.Args) {
 				format = os.Args[i+1]
 				i++
 			}
+		case "--timing":
+			timing = true
+		case "--overwrite":
+			overwrite = true
+		case "--layout":
+			if i+1 < len(os.Args) {
+				layout = os.Args[i+1]
+				i++
+			}
+		case "--unit":
+			if i+1 < len(os.Args) {
+				unit = os.Args[i+1]
+				i++
+			}
+		case "--top", "--precision":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid value for %s: %s", arg, os.Args[i+1])
+				}
+				if arg == "--top" {
+					top = n
+				} else {
+					precision = n
+				}
+				i++
+			}
+		case "--project-map":
+			if i+1 < len(os.Args) {
+				projectMap = os.Args[i+1]
+				i++
+			}
 		case "--output":
 			if i+1 < len(os.Args) {
 				outputFile = os.Args[i+1]
 				i++
 			}
+		case "--source":
+			if i+1 < len(os.Args) {
+				source = os.Args[i+1]
+				i++
+			}
 		case "--start":
 			if i+1 < len(os.Args) {
 				startDate = os.Args[i+1]
@@ -147,21 +678,86 @@ func exportData() error {
 				endDate = os.Args[i+1]
 				i++
 			}
+		case "--range":
+			if i+1 < len(os.Args) {
+				rangeName = os.Args[i+1]
+				i++
+			}
+		}
+	}
+
+	if autoCatchUp {
+		return exportAutoCatchUp()
+	}
+
+	if source != "" {
+		if err := storage.ValidateSource(source); err != nil {
+			return err
 		}
 	}
 
+	switch exportType {
+	case "daily":
+		if mergeApps || appName != "" || timezone != "" {
+			return fmt.Errorf("--merge-apps, --app and --timezone are only supported with --type hourly")
+		}
+	case "hourly":
+		if layout != "long" {
+			return fmt.Errorf("--layout is not supported with --type hourly")
+		}
+		if timezone != "" {
+			if err := setTimezone(timezone); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported export type: %s (expected daily or hourly)", exportType)
+	}
+
+	// The wide layout pivots daily totals into a date x app matrix
+	var wide *wideLayout
+	switch layout {
+	case "long":
+	case "wide":
+		if format != "csv" {
+			return fmt.Errorf("--layout wide is only supported with --format csv")
+		}
+		parsed, err := stats.ParseUnit(unit)
+		if err != nil {
+			return err
+		}
+		wide = &wideLayout{unit: parsed, top: top, precision: precision}
+	default:
+		return fmt.Errorf("unsupported layout: %s (expected long or wide)", layout)
+	}
+
 	fmt.Printf("Exporting data to %s (format: %s)...\n", outputFile, format)
 
 	// Load configuration
-	cfg, err := config.Load(config.DefaultConfigPath)
+	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
+	startDate, endDate, err = resolveRange(cfg, rangeName, startDate, endDate, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Let --app match any alias of an application
+	if appName != "" {
+		apps, err := appname.NewMapper(cfg.AppMapping)
+		if err != nil {
+			return fmt.Errorf("invalid app mapping: %w", err)
+		}
+		appName = apps.Canonical(appName)
+	}
+
 	// Open database
-	db, err := storage.NewDB(cfg.Database.Path)
+	timer := newTimer(timing)
+	db, err := openReadOnly(cfg, timer)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
 	defer db.Close()
 
@@ -182,42 +778,129 @@ func exportData() error {
 
 	// Get statistics
 	query := &storage.StatsQuery{
+		AppName:   appName,
 		StartDate: start,
 		EndDate:   end,
+		Source:    source,
 	}
 
-	stats, err := db.GetDailyStats(query)
-	if err != nil {
-		return fmt.Errorf("failed to get statistics: %w", err)
-	}
-
-	// Export based on format
-	switch format {
-	case "csv":
-		if err := exportToCSV(stats, outputFile); err != nil {
+	// Hourly rows and Toggl entries are built from sessions rather than
+	// daily totals
+	if exportType == "hourly" {
+		if err := exportHourly(db, query, format, mergeApps, outputFile, overwrite, timer); err != nil {
 			return err
 		}
-	case "json":
-		if err := exportToJSON(stats, outputFile); err != nil {
+	} else if format == "toggl" {
+		if err := exportToToggl(db, query, cfg, projectMap, outputFile, overwrite, timer); err != nil {
 			return err
 		}
-	default:
-		return fmt.Errorf("unsupported format: %s", format)
+	} else if err := exportDaily(db, query, format, wide, outputFile, overwrite, timer); err != nil {
+		return err
 	}
 
 	fmt.Printf("Data exported successfully to %s\n", outputFile)
+	printTiming(os.Stderr, timer)
 	return nil
 }
 
-func exportToCSV(stats []*storage.DailyStats, outputFile string) error {
-	file, err := os.Create(outputFile)
+// exportAutoCatchUp writes the daily files of export.auto for every
+// finished day missing from its directory, as the daemon does after
+// midnight
+func exportAutoCatchUp() error {
+	cfg, err := loadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return fmt.Errorf("failed to load configuration: %w", err)
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	db, err := openReadOnly(cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	auto := cfg.Export.Auto
+	written, err := export.CatchUp(db, auto.Dir, time.Now(), auto.CatchUpDays)
+	for _, day := range written {
+		sessionsFile, dailyFile := export.DailyFiles(day)
+		fmt.Printf("Exported %s: %s, %s\n", day.Format(storage.DateLayout), sessionsFile, dailyFile)
+	}
+	if err != nil {
+		return err
+	}
+	if len(written) == 0 {
+		fmt.Printf("Every day of the last %d is already exported to %s\n", auto.CatchUpDays, auto.Dir)
+		return nil
+	}
+	fmt.Printf("Exported %d day(s) to %s\n", len(written), auto.Dir)
+	return nil
+}
+
+// wideLayout configures `actime export --layout wide`
+type wideLayout struct {
+	unit      stats.Unit
+	top       int
+	precision int
+}
+
+// exportDaily writes the daily totals of the range as CSV or JSON, or with
+// a wide layout as a date x app CSV matrix
+func exportDaily(db *storage.DB, query *storage.StatsQuery, format string, wide *wideLayout, outputFile string, overwrite bool, timer *trace.Timer) error {
+	span := timer.Start(trace.Query)
+	daily, err := db.GetDailyStats(query)
+	span.End()
+	if err != nil {
+		return fmt.Errorf("failed to get statistics: %w", err)
+	}
+	if len(daily) == 0 {
+		printRecomputeHint(os.Stdout, db, query)
+	}
+
+	// Rows come out in the same order on every run, so exports can be diffed
+	span = timer.Start(trace.Aggregate)
+	stats.SortDailyStats(daily)
+	span.End()
+
+	// Export based on format
+	span = timer.Start(trace.Render)
+	var out bytes.Buffer
+	switch {
+	case wide != nil:
+		err = writeWideCSV(&out, stats.Pivot(daily, query.StartDate, query.EndDate, wide.top), wide)
+	case format == "csv":
+		err = writeCSV(&out, daily)
+	case format == "json":
+		err = writeJSON(&out, daily)
+	default:
+		err = fmt.Errorf("unsupported format: %s", format)
+	}
+	span.End()
+	if err != nil {
+		return err
+	}
+
+	span = timer.Start(trace.Write)
+	err = writeOutput(outputFile, out.Bytes(), overwrite)
+	span.End()
+	return err
+}
+
+// writeOutput replaces outputFile with data only once all of it is on disk,
+// so an interrupted export never leaves a truncated file. An existing file
+// is only replaced with --overwrite.
+func writeOutput(outputFile string, data []byte, overwrite bool) error {
+	err := fsutil.WriteFile(outputFile, data, 0644, overwrite)
+	if errors.Is(err, fsutil.ErrExists) {
+		return fmt.Errorf("%w (use --overwrite to replace it)", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// writeCSV writes daily totals as CSV
+func writeCSV(w io.Writer, stats []*storage.DailyStats) error {
+	writer := csv.NewWriter(w)
 
 	// Write header
 	if err := writer.Write([]string{"Date", "Application", "Total Seconds", "Formatted Duration"}); err != nil {
@@ -226,31 +909,79 @@ func exportToCSV(stats []*storage.DailyStats, outputFile string) error {
 
 	// Write data
 	for _, stat := range stats {
-		// Clean up AppName: remove null bytes and extra whitespace
-		cleanAppName := strings.ReplaceAll(stat.AppName, "\x00", " ")
-		cleanAppName = strings.TrimSpace(cleanAppName)
-
 		if err := writer.Write([]string{
 			stat.Date.Format("2006-01-02"),
-			cleanAppName,
+			appname.Clean(stat.AppName),
 			fmt.Sprintf("%d", stat.TotalSeconds),
-			formatDuration(stat.TotalSeconds),
+			durations.Seconds(stat.TotalSeconds),
 		}); err != nil {
 			return fmt.Errorf("failed to write row: %w", err)
 		}
 	}
 
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeWideCSV writes a pivoted matrix with a Total column and row
+func writeWideCSV(w io.Writer, matrix *stats.Matrix, wide *wideLayout) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(stats.WideTable(matrix, wide.unit, wide.precision)); err != nil {
+		return fmt.Errorf("failed to write rows: %w", err)
+	}
 	return nil
 }
 
-func exportToJSON(stats []*storage.DailyStats, outputFile string) error {
-	file, err := os.Create(outputFile)
+// exportToToggl writes sessions as a Toggl Track CSV import
+func exportToToggl(db *storage.DB, query *storage.StatsQuery, cfg *core.Config, projectMap, outputFile string, overwrite bool, timer *trace.Timer) error {
+	var projects *export.Projects
+	if projectMap != "" {
+		var err error
+		if projects, err = export.LoadProjects(projectMap); err != nil {
+			return err
+		}
+	}
+
+	opts := export.TogglOptions{
+		Email:    cfg.Export.Toggl.Email,
+		MinEntry: cfg.Export.Toggl.MinEntry,
+	}
+	if cfg.Export.Toggl.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Export.Toggl.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+		opts.Location = loc
+	}
+
+	span := timer.Start(trace.Query)
+	sessions, err := db.GetSessions(query)
+	span.End()
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return fmt.Errorf("failed to get sessions: %w", err)
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
+	span = timer.Start(trace.Aggregate)
+	entries := export.TogglEntries(sessions, projects, opts)
+	span.End()
+
+	span = timer.Start(trace.Render)
+	var out bytes.Buffer
+	err = export.WriteToggl(&out, entries, opts)
+	span.End()
+	if err != nil {
+		return err
+	}
+
+	span = timer.Start(trace.Write)
+	err = writeOutput(outputFile, out.Bytes(), overwrite)
+	span.End()
+	return err
+}
+
+// writeJSON writes daily totals as indented JSON
+func writeJSON(w io.Writer, stats []*storage.DailyStats) error {
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 
 	if err := encoder.Encode(stats); err != nil {
@@ -265,7 +996,7 @@ func showConfig() error {
 	fmt.Println()
 
 	// Load configuration
-	cfg, err := config.Load(config.DefaultConfigPath)
+	cfg, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
@@ -276,21 +1007,22 @@ func showConfig() error {
 	fmt.Printf("  Log Level: %s\n", cfg.Logging.Level)
 	fmt.Printf("  Log File: %s\n", cfg.Logging.File)
 	fmt.Printf("  Export Directory: %s\n", cfg.Export.OutputDir)
+	fmt.Printf("  Duration Style: %s\n", cfg.Report.DurationStyle)
 
 	return nil
 }
 
-func formatDuration(seconds int64) string {
-	duration := time.Duration(seconds) * time.Second
-	hours := int(duration.Hours())
-	minutes := int(duration.Minutes()) % 60
-	secs := int(duration.Seconds()) % 60
+// loadConfig loads the configuration and applies its report settings
+func loadConfig() (*core.Config, error) {
+	cfg, err := config.Load(config.DefaultConfigPath)
+	if err != nil {
+		return nil, err
+	}
 
-	if hours > 0 {
-		return fmt.Sprintf("%dh %dm %ds", hours, minutes, secs)
-	} else if minutes > 0 {
-		return fmt.Sprintf("%dm %ds", minutes, secs)
-	} else {
-		return fmt.Sprintf("%ds", secs)
+	durations = format.Formatter{
+		Style:    format.Style(cfg.Report.DurationStyle),
+		Language: cfg.Report.Language,
 	}
+
+	return cfg, nil
 }
\ No newline at end of file
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// Meta is the output of `actime meta`
+type Meta struct {
+	AppVersion      string   `json:"app_version"`
+	DBSchemaVersion int      `json:"db_schema_version"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+// showMeta handles `actime meta`: the version of actime and the schema and
+// capabilities of the database, for scripts that build on either
+func showMeta() error {
+	// Parse command line arguments
+	asJSON := false
+
+	for i := 2; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--json":
+			asJSON = true
+		default:
+			return fmt.Errorf("unknown option: %s", os.Args[i])
+		}
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// The schema is read from the file, whether or not the daemon runs
+	db, err := openReadOnly(cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	meta, err := readMeta(db)
+	if err != nil {
+		return err
+	}
+	return writeMeta(os.Stdout, meta, asJSON)
+}
+
+// readMeta collects the versions and capabilities of db
+func readMeta(db *storage.DB) (*Meta, error) {
+	schema, err := db.Meta()
+	if err != nil {
+		return nil, err
+	}
+	return &Meta{
+		AppVersion:      Version,
+		DBSchemaVersion: schema.SchemaVersion,
+		Capabilities:    schema.Capabilities,
+	}, nil
+}
+
+// writeMeta prints meta as text or JSON
+func writeMeta(w io.Writer, meta *Meta, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(meta); err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(w, "App version: %s\n", meta.AppVersion)
+	if meta.DBSchemaVersion == 0 {
+		fmt.Fprintln(w, "Database schema: not recorded (last opened by an older actimed)")
+	} else {
+		fmt.Fprintf(w, "Database schema: %d\n", meta.DBSchemaVersion)
+	}
+	fmt.Fprintf(w, "Capabilities: %s\n", strings.Join(meta.Capabilities, ", "))
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+// showMonitorStats prints the time spent on each monitor over the range,
+// today by default
+func showMonitorStats(db *storage.DB, appName, source, startDate, endDate string, now time.Time) error {
+	today, _ := time.Parse("2006-01-02", now.Format("2006-01-02"))
+	start := today
+	end := today
+
+	var err error
+	if startDate != "" {
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		end, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	totals, err := monitorTotals(db, &storage.StatsQuery{AppName: appName, StartDate: start, EndDate: end, Source: source}, now)
+	if err != nil {
+		return err
+	}
+
+	heading := "Usage by monitor"
+	if appName != "" {
+		heading += " for " + appName
+	}
+	fmt.Printf("%s, %s to %s:\n", heading, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	fmt.Println()
+	renderMonitorTotals(os.Stdout, totals)
+	return nil
+}
+
+// monitorTotals computes the per-monitor totals of the query's range,
+// including the sessions the daemon has not written yet when it is
+// reachable
+func monitorTotals(db *storage.DB, query *storage.StatsQuery, now time.Time) ([]stats.MonitorTotal, error) {
+	persisted, err := db.GetSessions(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	var live []*storage.Session
+	if storage.IsTracked(query.Source) {
+		live, err = readLiveSessions(now)
+		if errors.Is(err, service.ErrDaemonUnreachable) {
+			live = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	// Live sessions may have started before the range or be of other apps
+	var sessions []*storage.Session
+	from := query.StartDate.Format(storage.DateLayout)
+	to := query.EndDate.Format(storage.DateLayout)
+	for _, session := range stats.MergeSessions(persisted, live) {
+		if date := session.StartTime.Format(storage.DateLayout); date < from || date > to {
+			continue
+		}
+		if query.AppName != "" && !strings.EqualFold(session.AppName, query.AppName) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return stats.MonitorTotals(sessions), nil
+}
+
+// renderMonitorTotals writes each monitor, numbered from 1 as display
+// settings do, with its share of the total
+func renderMonitorTotals(w io.Writer, totals []stats.MonitorTotal) {
+	if len(totals) == 0 {
+		fmt.Fprintln(w, "  No sessions in this range")
+		return
+	}
+
+	var sum int64
+	for _, total := range totals {
+		sum += total.Seconds
+	}
+	for _, total := range totals {
+		label := "Unknown monitor"
+		if total.MonitorIndex != nil {
+			label = fmt.Sprintf("Monitor %d", *total.MonitorIndex+1)
+		}
+		share := float64(total.Seconds) / float64(sum) * 100
+		fmt.Fprintf(w, "  %-36s  %12s  %5.1f%%\n", label, durations.Seconds(total.Seconds), share)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+// showPresence prints time at the computer next to time tracked in apps for
+// each day in the range, followed by a report card over the whole range
+func showPresence(db *storage.DB, activityWindow time.Duration, startDate, endDate string) error {
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	start := today
+	end := today
+
+	var err error
+	if startDate != "" {
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		end, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	days, err := stats.DailyPresence(db, &storage.StatsQuery{StartDate: start, EndDate: end}, activityWindow)
+	if err != nil {
+		return fmt.Errorf("failed to compute presence: %w", err)
+	}
+
+	// Sessions running past the end of the range add a day after it
+	inRange := days[:0]
+	for _, day := range days {
+		if !day.Date.After(dayStartOf(end)) && !day.Date.Before(dayStartOf(start)) {
+			inRange = append(inRange, day)
+		}
+	}
+
+	fmt.Printf("Time at the computer, %s to %s:\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	fmt.Println()
+	renderPresence(os.Stdout, inRange)
+	return nil
+}
+
+// renderPresence writes one row per day and the report card
+func renderPresence(w io.Writer, days []stats.DayPresence) {
+	if len(days) == 0 {
+		fmt.Fprintln(w, "  No data for this range")
+		return
+	}
+
+	fmt.Fprintf(w, "  %-10s  %-11s  %-10s  %-10s  %-17s  %-10s  %-10s  %s\n",
+		"Date", "Active", "Presence", "Tracked", "Untracked", "Locked", "Idle", "Not covered")
+
+	var total stats.DayPresence
+	for _, day := range days {
+		fmt.Fprintf(w, "  %-10s  %-11s  %-10s  %-10s  %-17s  %-10s  %-10s  %s\n",
+			day.Date.Format("2006-01-02"),
+			day.First.Format("15:04")+"-"+day.Last.Format("15:04"),
+			durations.Seconds(day.PresenceSeconds),
+			durations.Seconds(day.TrackedSeconds),
+			fmt.Sprintf("%s (%.1f%%)", durations.Seconds(day.UntrackedSeconds()), day.UntrackedPercent()),
+			durations.Seconds(day.LockedSeconds),
+			durations.Seconds(day.IdleSeconds),
+			durations.Seconds(day.UncoveredSeconds))
+
+		total.PresenceSeconds += day.PresenceSeconds
+		total.TrackedSeconds += day.TrackedSeconds
+		total.LockedSeconds += day.LockedSeconds
+		total.IdleSeconds += day.IdleSeconds
+		total.UncoveredSeconds += day.UncoveredSeconds
+	}
+
+	// Untracked time is summed per day, so a day with more tracked than
+	// present time does not hide untracked time on another
+	var untracked int64
+	for _, day := range days {
+		untracked += day.UntrackedSeconds()
+	}
+	share := 0.0
+	if total.PresenceSeconds > 0 {
+		share = float64(untracked) / float64(total.PresenceSeconds) * 100
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  Report card:")
+	fmt.Fprintf(w, "    Days:                 %d\n", len(days))
+	fmt.Fprintf(w, "    At the computer:      %s (%s per day)\n",
+		durations.Seconds(total.PresenceSeconds), durations.Seconds(total.PresenceSeconds/int64(len(days))))
+	fmt.Fprintf(w, "    Tracked in apps:      %s\n", durations.Seconds(total.TrackedSeconds))
+	fmt.Fprintf(w, "    Untracked:            %s (%.1f%%)\n", durations.Seconds(untracked), share)
+	fmt.Fprintf(w, "    Locked:               %s\n", durations.Seconds(total.LockedSeconds))
+	fmt.Fprintf(w, "    Idle:                 %s\n", durations.Seconds(total.IdleSeconds))
+	if total.UncoveredSeconds > 0 {
+		fmt.Fprintf(w, "    Not covered:          %s (the daemon was not running)\n", durations.Seconds(total.UncoveredSeconds))
+	}
+}
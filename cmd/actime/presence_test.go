@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/stats"
+)
+
+func TestRenderPresence(t *testing.T) {
+	monday := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	days := []stats.DayPresence{
+		{
+			Date:             monday,
+			First:            monday.Add(10 * time.Hour),
+			Last:             monday.Add(17 * time.Hour),
+			PresenceSeconds:  16800,
+			TrackedSeconds:   16680,
+			LockedSeconds:    3600,
+			IdleSeconds:      1200,
+			UncoveredSeconds: 3600,
+		},
+		{
+			Date:            monday.AddDate(0, 0, 1),
+			First:           monday.AddDate(0, 0, 1).Add(9 * time.Hour),
+			Last:            monday.AddDate(0, 0, 1).Add(10 * time.Hour),
+			PresenceSeconds: 3600,
+			TrackedSeconds:  3000,
+		},
+	}
+
+	var buf bytes.Buffer
+	renderPresence(&buf, days)
+	out := buf.String()
+
+	for _, want := range []string{
+		"2026-01-05  10:00-17:00",
+		"2m 0s (0.7%)",
+		"10m 0s (16.7%)",
+		"At the computer:      5h 40m 0s (2h 50m 0s per day)",
+		"Untracked:            12m 0s (3.5%)",
+		"Not covered:          1h 0m 0s",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderPresenceEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	renderPresence(&buf, nil)
+
+	if !strings.Contains(buf.String(), "No data") {
+		t.Errorf("Expected a no-data line, got %q", buf.String())
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/weii/actime/internal/export"
+	"github.com/weii/actime/internal/storage"
+)
+
+// pruneData deletes sessions that started before a day, optionally writing
+// them to an archive first. Daily totals are kept unless --with-stats asks
+// to delete those of the same days too.
+func pruneData() error {
+	// Parse command line arguments
+	beforeDate := ""
+	keepDays := -1
+	exportDir := ""
+	dryRun := false
+	secure := false
+	withStats := false
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--before":
+			if i+1 < len(os.Args) {
+				beforeDate = os.Args[i+1]
+				i++
+			}
+		case "--keep-days":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid --keep-days: %s", os.Args[i+1])
+				}
+				keepDays = n
+				i++
+			}
+		case "--export-first":
+			if i+1 < len(os.Args) {
+				exportDir = os.Args[i+1]
+				i++
+			}
+		case "--dry-run":
+			dryRun = true
+		case "--with-stats":
+			withStats = true
+		case "--secure":
+			secure = true
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// The retention settings are the defaults
+	if exportDir == "" {
+		exportDir = cfg.Retention.ExportDir
+	}
+	if keepDays < 0 && cfg.Retention.Days > 0 {
+		keepDays = cfg.Retention.Days
+	}
+
+	var before time.Time
+	switch {
+	case beforeDate != "":
+		before, err = time.ParseInLocation(storage.DateLayout, beforeDate, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid before date format: %w", err)
+		}
+	case keepDays >= 0:
+		before = dayStartOf(time.Now()).AddDate(0, 0, -keepDays)
+	default:
+		return fmt.Errorf("missing --before or --keep-days (retention.days is not set)")
+	}
+	if secure && !dryRun {
+		if err := requireDaemonStopped("--secure"); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		// A dry run only counts, so it must not create or migrate the database
+		db, err := openReadOnly(cfg, nil)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		count, err := db.CountSessionsBefore(before)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Would delete %d sessions that started before %s\n", count, before.Format(storage.DateLayout))
+		if exportDir != "" {
+			fmt.Printf("They would be archived to %s first\n", exportDir)
+		}
+		if withStats {
+			count, err := db.CountDailyStatsBefore(before)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Would delete %d daily stats rows before %s\n", count, before.Format(storage.DateLayout))
+		}
+		return nil
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	deleted, manifest, err := export.PruneSessions(db, before, exportDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d sessions that started before %s\n", deleted, before.Format(storage.DateLayout))
+	if manifest != nil {
+		fmt.Printf("Archived to %s (sha256 %s)\n", filepath.Join(exportDir, manifest.File), manifest.SHA256)
+	}
+	if withStats {
+		deleted, err := db.PruneDailyStats(before)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %d daily stats rows before %s\n", deleted, before.Format(storage.DateLayout))
+	}
+	if secure {
+		return secureCompact(cfg, db)
+	}
+	return nil
+}
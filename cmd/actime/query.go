@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/weii/actime/internal/query"
+	"github.com/weii/actime/internal/storage"
+)
+
+// runQuery handles `actime query`: a structured query over sessions or
+// daily totals, translated by the query package
+func runQuery() error {
+	// Parse command line arguments
+	q := query.Query{}
+	outputFormat := "table"
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--from", "--select", "--where", "--group-by", "--order", "--limit", "--format":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("missing value for %s", arg)
+			}
+			value := os.Args[i+1]
+			i++
+
+			switch arg {
+			case "--from":
+				q.From = value
+			case "--select":
+				q.Select = append(q.Select, splitList(value)...)
+			case "--where":
+				q.Where = append(q.Where, value)
+			case "--group-by":
+				q.GroupBy = append(q.GroupBy, splitList(value)...)
+			case "--order":
+				q.Order = append(q.Order, splitList(value)...)
+			case "--limit":
+				n, err := strconv.Atoi(value)
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid value for --limit: %s", value)
+				}
+				q.Limit = n
+			case "--format":
+				outputFormat = value
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	switch outputFormat {
+	case "table", "csv", "json":
+	default:
+		return fmt.Errorf("unsupported format: %s (expected table, csv or json)", outputFormat)
+	}
+
+	stmt, err := query.Build(q)
+	if err != nil {
+		return err
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	db, err := openReadOnly(cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Rows(stmt.SQL, stmt.Args...)
+	if err != nil {
+		return err
+	}
+	return writeQuery(os.Stdout, stmt.Columns, rows, outputFormat)
+}
+
+// splitList splits a comma-separated option value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// writeQuery renders query results as an aligned table, CSV or JSON
+func writeQuery(w io.Writer, columns []query.Column, rows [][]interface{}, outputFormat string) error {
+	switch outputFormat {
+	case "csv":
+		writer := csv.NewWriter(w)
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = column.Name
+		}
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		for _, row := range rows {
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				record[i] = queryCell(column, row[i])
+			}
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("failed to write row: %w", err)
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "json":
+		objects := make([]map[string]interface{}, len(rows))
+		for r, row := range rows {
+			objects[r] = make(map[string]interface{}, len(columns))
+			for i, column := range columns {
+				objects[r][column.Name] = queryJSONValue(column, row[i])
+			}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(objects); err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return nil
+	}
+
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "No rows")
+		return nil
+	}
+
+	cells := make([][]string, len(rows))
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column.Name)
+	}
+	for r, row := range rows {
+		cells[r] = make([]string, len(columns))
+		for i, column := range columns {
+			cells[r][i] = queryCell(column, row[i])
+			if n := utf8.RuneCountInString(cells[r][i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	writeLine := func(values []string) {
+		parts := make([]string, len(values))
+		for i, value := range values {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value))
+			if columns[i].Kind == query.Int {
+				parts[i] = pad + value
+			} else {
+				parts[i] = value + pad
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(parts, "  "), " "))
+	}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	writeLine(header)
+	for _, row := range cells {
+		writeLine(row)
+	}
+	return nil
+}
+
+// queryCell renders one value of a result column as text
+func queryCell(column query.Column, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if column.Kind == query.Date {
+			return v.Format(storage.DateLayout)
+		}
+		return v.Local().Format("2006-01-02 15:04:05")
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// queryJSONValue keeps numbers as numbers in JSON output
+func queryJSONValue(column query.Column, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if n, ok := value.(int64); ok && column.Kind == query.Int {
+		return n
+	}
+	return queryCell(column, value)
+}
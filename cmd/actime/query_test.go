@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/query"
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestQueryRendersResults(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*storage.Session{
+		{AppName: "firefox", WindowTitle: "Docs", StartTime: start, DurationSeconds: 1800},
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start.Add(30 * time.Minute), DurationSeconds: 3600},
+		{AppName: "firefox", WindowTitle: "Mail", StartTime: start.Add(90 * time.Minute), DurationSeconds: 600},
+		{AppName: "firefox", WindowTitle: "News", StartTime: start.AddDate(0, 0, 1), DurationSeconds: 300},
+	}
+	for _, session := range sessions {
+		session.EndTime = session.StartTime.Add(time.Duration(session.DurationSeconds) * time.Second)
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	run := func(q query.Query, outputFormat string) string {
+		t.Helper()
+		stmt, err := query.Build(q)
+		if err != nil {
+			t.Fatalf("Failed to build query: %v", err)
+		}
+		rows, err := db.Rows(stmt.SQL, stmt.Args...)
+		if err != nil {
+			t.Fatalf("Failed to run query: %v", err)
+		}
+		var out bytes.Buffer
+		if err := writeQuery(&out, stmt.Columns, rows, outputFormat); err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		return out.String()
+	}
+
+	grouped := query.Query{
+		Select:  []string{"app", "seconds", "count"},
+		Where:   []string{"date=2026-01-05"},
+		GroupBy: []string{"app"},
+		Order:   []string{"-seconds"},
+	}
+	if got, want := run(grouped, "table"), "app      seconds  count\neditor      3600      1\nfirefox     2400      2\n"; got != want {
+		t.Errorf("Unexpected table:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := run(grouped, "csv"), "app,seconds,count\neditor,3600,1\nfirefox,2400,2\n"; got != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", got, want)
+	}
+
+	daily := query.Query{From: query.FromDaily, Select: []string{"date", "app", "seconds"}, Where: []string{"app~FIRE"}, Order: []string{"date"}}
+	want := `[
+  {
+    "app": "firefox",
+    "date": "2026-01-05",
+    "seconds": 2400
+  },
+  {
+    "app": "firefox",
+    "date": "2026-01-06",
+    "seconds": 300
+  }
+]
+`
+	if got := run(daily, "json"); got != want {
+		t.Errorf("Unexpected JSON:\n%s\nwant:\n%s", got, want)
+	}
+
+	starts := run(query.Query{Select: []string{"start", "title"}, Where: []string{"start>=2026-01-05 10:00", "title!~news"}}, "csv")
+	if starts != "start,title\n2026-01-05 10:30:00,Mail\n" {
+		t.Errorf("Unexpected sessions:\n%s", starts)
+	}
+
+	if got := run(query.Query{Where: []string{"app=nothing"}}, "table"); !strings.Contains(got, "No rows") {
+		t.Errorf("Expected an empty result to say so, got %q", got)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/daterange"
+	"github.com/weii/actime/internal/storage"
+)
+
+// rangeDays resolves a --range preset to its first and last day, with weeks
+// starting on the configured report.week_start
+func rangeDays(cfg *core.Config, preset string, now time.Time) (time.Time, time.Time, error) {
+	weekStart, err := daterange.ParseWeekday(cfg.Report.WeekStart)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid report.week_start: %w", err)
+	}
+	return daterange.Resolve(preset, now, weekStart)
+}
+
+// resolveRange turns a --range preset into the --start and --end dates it
+// stands for. Without a preset the given dates are returned unchanged; a
+// preset cannot be combined with explicit dates.
+func resolveRange(cfg *core.Config, preset, startDate, endDate string, now time.Time) (string, string, error) {
+	if preset == "" {
+		return startDate, endDate, nil
+	}
+	if startDate != "" || endDate != "" {
+		return "", "", fmt.Errorf("--range cannot be combined with --start or --end")
+	}
+
+	start, end, err := rangeDays(cfg, preset, now)
+	if err != nil {
+		return "", "", err
+	}
+	return start.Format(storage.DateLayout), end.Format(storage.DateLayout), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/core"
+)
+
+func TestResolveRange(t *testing.T) {
+	cfg := &core.Config{}
+	cfg.Report.WeekStart = "sunday"
+	now := time.Date(2026, 1, 7, 15, 0, 0, 0, time.Local)
+
+	start, end, err := resolveRange(cfg, "this-week", "", "", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if start != "2026-01-04" || end != "2026-01-07" {
+		t.Errorf("Expected 2026-01-04..2026-01-07, got %s..%s", start, end)
+	}
+
+	// Without a preset the explicit dates pass through
+	start, end, err = resolveRange(cfg, "", "2026-01-01", "", now)
+	if err != nil || start != "2026-01-01" || end != "" {
+		t.Errorf("Expected the explicit dates back, got %s..%s (%v)", start, end, err)
+	}
+
+	if _, _, err := resolveRange(cfg, "today", "2026-01-01", "", now); err == nil {
+		t.Error("Expected an error when --range is combined with --start")
+	}
+	if _, _, err := resolveRange(cfg, "fortnight", "", "", now); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// scrubSamples is how many before/after pairs the scrub preview shows
+const scrubSamples = 5
+
+// scrubPlan is what a scrub pattern does to the sessions in scope
+type scrubPlan struct {
+	scope   int
+	changed []*storage.Session
+	samples [][2]string
+	// everything is set when the pattern matches the empty string or
+	// every session, which is most likely a mistake
+	everything bool
+}
+
+// planScrub applies pattern to the window and raw titles of sessions and
+// returns changed copies of the sessions it rewrites
+func planScrub(sessions []*storage.Session, pattern *regexp.Regexp, replace string) *scrubPlan {
+	plan := &scrubPlan{scope: len(sessions)}
+	seen := make(map[[2]string]bool)
+	for _, session := range sessions {
+		windowTitle := pattern.ReplaceAllString(session.WindowTitle, replace)
+		rawTitle := pattern.ReplaceAllString(session.RawTitle, replace)
+		if windowTitle == session.WindowTitle && rawTitle == session.RawTitle {
+			continue
+		}
+
+		changed := *session
+		changed.WindowTitle = windowTitle
+		changed.RawTitle = rawTitle
+		plan.changed = append(plan.changed, &changed)
+
+		pair := [2]string{session.WindowTitle, windowTitle}
+		if pair[0] == pair[1] {
+			pair = [2]string{session.RawTitle, rawTitle}
+		}
+		if !seen[pair] && len(plan.samples) < scrubSamples {
+			seen[pair] = true
+			plan.samples = append(plan.samples, pair)
+		}
+	}
+
+	plan.everything = pattern.MatchString("") || len(plan.changed) > 1 && len(plan.changed) == plan.scope
+	return plan
+}
+
+// printScrubPreview shows how many sessions a scrub changes, with samples
+func printScrubPreview(w io.Writer, plan *scrubPlan) {
+	fmt.Fprintf(w, "%d of %d sessions have a matching title\n", len(plan.changed), plan.scope)
+	for _, sample := range plan.samples {
+		fmt.Fprintf(w, "  %q -> %q\n", sample[0], sample[1])
+	}
+	if len(plan.changed) > len(plan.samples) {
+		fmt.Fprintf(w, "  ...\n")
+	}
+}
+
+// scrubTitles handles `actime db scrub`: it rewrites the parts of window
+// titles matching a pattern, for example to remove a name before sharing
+// the database. It previews the change unless --yes is given.
+func scrubTitles() error {
+	// Parse command line arguments
+	pattern := ""
+	replace := ""
+	appName := ""
+	startDate := ""
+	endDate := ""
+	yes := false
+	force := false
+	secure := false
+
+	for i := 3; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--yes":
+			yes = true
+		case "--force":
+			force = true
+		case "--secure":
+			secure = true
+		case "--pattern", "--replace", "--app", "--start", "--end":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("missing value for %s", arg)
+			}
+			value := os.Args[i+1]
+			i++
+
+			switch arg {
+			case "--pattern":
+				pattern = value
+			case "--replace":
+				replace = value
+			case "--app":
+				appName = value
+			case "--start":
+				startDate = value
+			case "--end":
+				endDate = value
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if pattern == "" {
+		return fmt.Errorf("missing --pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid --pattern: %w", err)
+	}
+
+	if secure && yes {
+		if err := requireDaemonStopped("--secure"); err != nil {
+			return err
+		}
+	}
+
+	query := &storage.StatsQuery{}
+	if startDate != "" {
+		if query.StartDate, err = time.Parse("2006-01-02", startDate); err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		if query.EndDate, err = time.Parse("2006-01-02", endDate); err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if appName != "" {
+		apps, err := appname.NewMapper(cfg.AppMapping)
+		if err != nil {
+			return fmt.Errorf("invalid app mapping: %w", err)
+		}
+		query.AppName = apps.Canonical(appName)
+	}
+
+	db, err := openWritable(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	sessions, err := db.GetSessions(query)
+	if err != nil {
+		return err
+	}
+
+	plan := planScrub(sessions, re, replace)
+	printScrubPreview(os.Stdout, plan)
+	if len(plan.changed) == 0 {
+		return nil
+	}
+	if plan.everything && !force {
+		return fmt.Errorf("the pattern matches every title; add --force if that is intended")
+	}
+	if !yes {
+		fmt.Println("Nothing was changed; run again with --yes to apply")
+		return nil
+	}
+
+	updated, err := scrubSessions(db, plan, re, query)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Scrubbed the titles of %d sessions\n", updated)
+	if secure {
+		if err := secureCompact(cfg, db); err != nil {
+			return err
+		}
+	}
+
+	// Sessions the daemon has not written yet still carry the old title
+	if live, err := readLiveSessions(time.Now()); err == nil {
+		for _, session := range live {
+			if re.MatchString(session.WindowTitle) || re.MatchString(session.RawTitle) {
+				fmt.Println("Warning: the running daemon holds a matching session that is not written yet; run the scrub again after it is flushed")
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// scrubSessions writes a scrub plan and records it in the maintenance log.
+// The log keeps a hash of the pattern rather than the pattern, which is
+// often the very text being removed.
+func scrubSessions(db *storage.DB, plan *scrubPlan, pattern *regexp.Regexp, query *storage.StatsQuery) (int64, error) {
+	updated, err := db.UpdateTitles(plan.changed, storage.DefaultTitleBatch)
+	if err != nil {
+		return updated, err
+	}
+
+	details := fmt.Sprintf("pattern sha256 %x", sha256.Sum256([]byte(pattern.String())))
+	if query.AppName != "" {
+		details += fmt.Sprintf(", app %s", query.AppName)
+	}
+	if !query.StartDate.IsZero() {
+		details += ", from " + query.StartDate.Format(storage.DateLayout)
+	}
+	if !query.EndDate.IsZero() {
+		details += ", to " + query.EndDate.Format(storage.DateLayout)
+	}
+	if err := db.LogMaintenance("scrub", details, updated); err != nil {
+		return updated, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestScrubTitles(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*storage.Session{
+		{AppName: "mail", WindowTitle: "Re: lunch - Jane Doe", RawTitle: "(3) Re: lunch - Jane Doe", StartTime: start, DurationSeconds: 60},
+		{AppName: "mail", WindowTitle: "Inbox", RawTitle: "(1) Inbox from jane doe", StartTime: start.Add(time.Minute), DurationSeconds: 120},
+		{AppName: "editor", WindowTitle: "notes.md", StartTime: start.Add(3 * time.Minute), DurationSeconds: 300},
+		{AppName: "chat", WindowTitle: "Jane Doe", StartTime: start.Add(8 * time.Minute), DurationSeconds: 30},
+	}
+	for _, session := range sessions {
+		session.EndTime = session.StartTime.Add(time.Duration(session.DurationSeconds) * time.Second)
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	query := &storage.StatsQuery{StartDate: day, EndDate: day}
+	before, err := db.GetDailyStats(query)
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+
+	stored, err := db.GetSessions(query)
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	pattern := regexp.MustCompile(`(?i)jane doe`)
+	plan := planScrub(stored, pattern, "[name]")
+	if len(plan.changed) != 3 || plan.scope != 4 || plan.everything {
+		t.Fatalf("Expected 3 of 4 sessions to change, got %d of %d (everything %v)", len(plan.changed), plan.scope, plan.everything)
+	}
+
+	var preview bytes.Buffer
+	printScrubPreview(&preview, plan)
+	for _, want := range []string{"3 of 4 sessions", `"Re: lunch - Jane Doe" -> "Re: lunch - [name]"`, `"(1) Inbox from jane doe" -> "(1) Inbox from [name]"`} {
+		if !strings.Contains(preview.String(), want) {
+			t.Errorf("Expected the preview to contain %q, got:\n%s", want, preview.String())
+		}
+	}
+
+	updated, err := scrubSessions(db, plan, pattern, query)
+	if err != nil {
+		t.Fatalf("Failed to scrub: %v", err)
+	}
+	if updated != 3 {
+		t.Errorf("Expected 3 sessions scrubbed, got %d", updated)
+	}
+
+	stored, err = db.GetSessions(query)
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	for _, session := range stored {
+		if pattern.MatchString(session.WindowTitle) || pattern.MatchString(session.RawTitle) {
+			t.Errorf("Expected the name to be gone, got %q / %q", session.WindowTitle, session.RawTitle)
+		}
+	}
+	if stored[0].RawTitle != "(3) Re: lunch - [name]" || stored[3].WindowTitle != "[name]" || stored[2].RawTitle != "" {
+		t.Errorf("Unexpected titles after the scrub: %+v %+v %+v", stored[0], stored[2], stored[3])
+	}
+
+	// Durations are not touched
+	after, err := db.GetDailyStats(query)
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("Expected %d daily rows, got %d", len(before), len(after))
+	}
+	for i := range before {
+		if *after[i] != *before[i] {
+			t.Errorf("Expected daily stats %+v to be unchanged, got %+v", before[i], after[i])
+		}
+	}
+
+	// The log records the scrub without the pattern it removed
+	records, err := db.GetMaintenanceLog()
+	if err != nil {
+		t.Fatalf("Failed to read maintenance log: %v", err)
+	}
+	if len(records) != 1 || records[0].Action != "scrub" || records[0].RowsAffected != 3 {
+		t.Fatalf("Expected one scrub record for 3 rows, got %+v", records)
+	}
+	if strings.Contains(strings.ToLower(records[0].Details), "jane") || !strings.Contains(records[0].Details, "sha256") {
+		t.Errorf("Expected only a hash of the pattern in the log, got %q", records[0].Details)
+	}
+}
+
+func TestPlanScrubFlagsPatternsMatchingEverything(t *testing.T) {
+	sessions := []*storage.Session{
+		{WindowTitle: "main.go"},
+		{WindowTitle: "README.md"},
+	}
+	for _, pattern := range []string{`.*`, `x?`, `\w+`} {
+		if plan := planScrub(sessions, regexp.MustCompile(pattern), ""); !plan.everything {
+			t.Errorf("Expected %q to be flagged as matching everything", pattern)
+		}
+	}
+	if plan := planScrub(sessions, regexp.MustCompile(`main`), ""); plan.everything {
+		t.Error("Expected a narrow pattern not to be flagged")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/export"
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+// showSessions lists individual sessions, by default those of today. With
+// --live the sessions the daemon has not written yet are included, and
+// --coalesce merges runs of one app split by short gaps. --format json
+// writes the sessions in the same form as exports.
+func showSessions() error {
+	// Parse command line arguments
+	now := time.Now()
+	since := dayStartOf(now)
+	var until time.Time
+	explicit := false
+	rangeName := ""
+	appName := ""
+	source := ""
+	limit := 0
+	live := false
+	outputFormat := "text"
+	var coalesce time.Duration
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--since", "--until":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("missing value for %s", arg)
+			}
+			t, err := parseTimeArg(os.Args[i+1], now)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", arg, err)
+			}
+			if arg == "--since" {
+				since = t
+			} else {
+				until = t
+			}
+			explicit = true
+			i++
+		case "--range":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("missing value for %s", arg)
+			}
+			rangeName = os.Args[i+1]
+			i++
+		case "--app":
+			if i+1 < len(os.Args) {
+				appName = os.Args[i+1]
+				i++
+			}
+		case "--source":
+			if i+1 < len(os.Args) {
+				source = os.Args[i+1]
+				i++
+			}
+		case "--limit":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid value for --limit: %s", os.Args[i+1])
+				}
+				limit = n
+				i++
+			}
+		case "--live":
+			live = true
+		case "--coalesce":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("missing value for %s", arg)
+			}
+			d, err := time.ParseDuration(os.Args[i+1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid value for --coalesce: %s", os.Args[i+1])
+			}
+			coalesce = d
+			i++
+		case "--format":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("missing value for %s", arg)
+			}
+			outputFormat = os.Args[i+1]
+			i++
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	if outputFormat != "text" && outputFormat != "json" {
+		return fmt.Errorf("unsupported format: %s (expected text or json)", outputFormat)
+	}
+
+	if source != "" {
+		if err := storage.ValidateSource(source); err != nil {
+			return err
+		}
+	}
+
+	// Live sessions come from the tracker
+	if live && !storage.IsTracked(source) {
+		live = false
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// A range covers whole days: from the first one through the end of the last
+	if rangeName != "" {
+		if explicit {
+			return fmt.Errorf("--range cannot be combined with --since or --until")
+		}
+		first, last, err := rangeDays(cfg, rangeName, now)
+		if err != nil {
+			return err
+		}
+		since = first
+		until = last.AddDate(0, 0, 1)
+	}
+
+	// Let --app match any alias of an application
+	if appName != "" {
+		apps, err := appname.NewMapper(cfg.AppMapping)
+		if err != nil {
+			return fmt.Errorf("invalid app mapping: %w", err)
+		}
+		appName = apps.Canonical(appName)
+	}
+
+	var pending []*storage.Session
+	if live {
+		pending, err = service.ReadLiveSessions(now)
+		if errors.Is(err, service.ErrDaemonUnreachable) {
+			fmt.Fprintln(os.Stderr, "Daemon is not reachable, showing stored sessions only")
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// Open database
+	db, err := storage.OpenReadOnly(cfg.Database.Path)
+	if err != nil && !(live && errors.Is(err, storage.ErrDatabaseNotFound)) {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	var persisted []*storage.Session
+	if db != nil {
+		defer db.Close()
+
+		// Start a day early to catch sessions running over midnight
+		query := &storage.StatsQuery{StartDate: since.AddDate(0, 0, -1), Source: source}
+		if !until.IsZero() {
+			query.EndDate = until
+		}
+		persisted, err = db.GetSessions(query)
+		if err != nil {
+			return fmt.Errorf("failed to get sessions: %w", err)
+		}
+	}
+
+	// Coalesce before filtering so other apps in between keep runs apart
+	sessions := stats.MergeSessions(persisted, pending)
+	if coalesce > 0 {
+		sessions = stats.CoalesceSessions(sessions, coalesce, false)
+	}
+	sessions = stats.FilterSessions(sessions, since, until, appName, limit)
+	if outputFormat == "json" {
+		return writeSessionsJSON(os.Stdout, sessions)
+	}
+	renderSessions(os.Stdout, sessions)
+	return nil
+}
+
+// writeSessionsJSON writes sessions as a JSON array of export records
+func writeSessionsJSON(w io.Writer, sessions []*storage.Session) error {
+	records := make([]export.ArchiveRecord, len(sessions))
+	for i, session := range sessions {
+		records[i] = export.NewArchiveRecord(session)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(records); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return nil
+}
+
+// renderSessions writes one line per session: time span, duration, app and title
+func renderSessions(w io.Writer, sessions []*storage.Session) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(w, "No sessions")
+		return
+	}
+
+	for _, session := range sessions {
+		start, end := session.StartTime.Local(), session.EndTime.Local()
+		layout := "15:04"
+		if !sameDate(start, end) || !sameDate(start, time.Now()) {
+			layout = "2006-01-02 15:04"
+		}
+		fmt.Fprintf(w, "%s-%s  %10s  %s",
+			start.Format(layout), end.Format("15:04"),
+			durations.Seconds(session.DurationSeconds), appname.Clean(session.AppName))
+		if session.WindowTitle != "" {
+			fmt.Fprintf(w, "  %s", session.WindowTitle)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// parseTimeArg parses a --since or --until value: a time of day today
+// ("14:00"), a day ("2026-01-05") or both ("2026-01-05 14:00")
+func parseTimeArg(value string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("15:04", value, time.Local); err == nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected HH:MM, YYYY-MM-DD or \"YYYY-MM-DD HH:MM\", got %q", value)
+}
+
+// dayStartOf returns local midnight of t's day
+func dayStartOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// sameDate reports whether a and b fall on the same calendar day
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
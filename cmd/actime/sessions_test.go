@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestParseTimeArg(t *testing.T) {
+	now := time.Date(2026, 1, 7, 18, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"14:00", time.Date(2026, 1, 7, 14, 0, 0, 0, time.Local)},
+		{"2026-01-05", time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)},
+		{"2026-01-05 09:15", time.Date(2026, 1, 5, 9, 15, 0, 0, time.Local)},
+		{"2026-01-05T09:15", time.Date(2026, 1, 5, 9, 15, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimeArg(tt.value, now)
+		if err != nil {
+			t.Errorf("parseTimeArg(%q) returned an error: %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTimeArg(%q) = %s, expected %s", tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := parseTimeArg("2pm", now); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestWriteSessionsJSON(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	created := time.Date(2026, 1, 5, 9, 1, 0, 0, time.UTC)
+	sessions := []*storage.Session{
+		{ID: 1, AppName: "firefox", WindowTitle: "Docs", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60, Source: storage.SourceTracker, CreatedAt: created, UpdatedAt: created.Add(time.Hour)},
+		// A live session is not stored yet
+		{AppName: "editor", StartTime: start.Add(time.Minute), EndTime: start.Add(2 * time.Minute), DurationSeconds: 60, Source: storage.SourceTracker},
+	}
+
+	var out bytes.Buffer
+	if err := writeSessionsJSON(&out, sessions); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{`"created_at": "2026-01-05T09:01:00Z"`, `"updated_at": "2026-01-05T10:01:00Z"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "created_at"); n != 1 {
+		t.Errorf("Expected created_at only on the stored session, found it %d times", n)
+	}
+}
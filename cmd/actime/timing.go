@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/trace"
+)
+
+// newTimer returns a timer for --timing, and nil otherwise so the spans
+// record nothing
+func newTimer(enabled bool) *trace.Timer {
+	if !enabled {
+		return nil
+	}
+	return trace.New()
+}
+
+// openReadOnly opens the database for reading with the configured
+// slow-query threshold. With a timer, slow statements are printed to stderr
+// since the CLI does not log at debug level.
+func openReadOnly(cfg *core.Config, timer *trace.Timer) (*storage.DB, error) {
+	db, err := storage.OpenReadOnly(cfg.Database.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	var report storage.SlowQueryFunc
+	if timer != nil {
+		report = func(statement string, took time.Duration) {
+			fmt.Fprintf(os.Stderr, "Slow query (%dms): %s\n", took.Milliseconds(), statement)
+		}
+	}
+	db.SetSlowQuery(cfg.Database.SlowQuery, report)
+	return db, nil
+}
+
+// printTiming writes the one-line timing breakdown of a command
+func printTiming(w io.Writer, timer *trace.Timer) {
+	if timer == nil {
+		return
+	}
+	fmt.Fprintf(w, "Timing: %s\n", timer.Summary())
+}
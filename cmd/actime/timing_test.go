@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/fsutil"
+	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/trace"
+)
+
+func TestExportTimingReportsEveryPhase(t *testing.T) {
+	dir := t.TempDir()
+	db, err := storage.NewDB(filepath.Join(dir, "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	session := &storage.Session{
+		AppName:         "code",
+		StartTime:       day.Add(9 * time.Hour),
+		EndTime:         day.Add(10 * time.Hour),
+		DurationSeconds: 3600,
+	}
+	if err := db.UpdateDailyStatsBatch([]*storage.Session{session}); err != nil {
+		t.Fatalf("Failed to write daily stats: %v", err)
+	}
+
+	timer := trace.New()
+	output := filepath.Join(dir, "export.csv")
+	if err := exportDaily(db, &storage.StatsQuery{StartDate: day, EndDate: day}, "csv", nil, output, false, timer); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if data, err := os.ReadFile(output); err != nil || !strings.Contains(string(data), "2026-01-05,code,3600") {
+		t.Errorf("Expected the exported row, got %q (%v)", data, err)
+	}
+
+	// An existing export is only replaced with --overwrite
+	if err := exportDaily(db, &storage.StatsQuery{StartDate: day, EndDate: day}, "csv", nil, output, false, nil); !errors.Is(err, fsutil.ErrExists) {
+		t.Errorf("Expected the existing file to be refused, got %v", err)
+	}
+
+	var out bytes.Buffer
+	printTiming(&out, timer)
+	line := out.String()
+	if !strings.HasPrefix(line, "Timing: ") || strings.Count(line, "\n") != 1 {
+		t.Errorf("Expected one timing line, got %q", line)
+	}
+	for _, phase := range append(trace.Phases, "total") {
+		if !strings.Contains(line, phase+" ") {
+			t.Errorf("Expected phase %s in %q", phase, line)
+		}
+	}
+
+	// Without --timing nothing is printed
+	out.Reset()
+	printTiming(&out, newTimer(false))
+	if out.Len() != 0 {
+		t.Errorf("Expected no output without a timer, got %q", out.String())
+	}
+}
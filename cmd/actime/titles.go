@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+const (
+	// titleLimit is the number of titles `actime stats --titles` shows
+	titleLimit = 20
+
+	// titleWidth is the widest title shown, in characters
+	titleWidth = 60
+)
+
+// showTitleStats prints the time one application spent under each window
+// title over the range, today by default
+func showTitleStats(db *storage.DB, appName, startDate, endDate string, now time.Time) error {
+	today, _ := time.Parse("2006-01-02", now.Format("2006-01-02"))
+	start := today
+	end := today
+
+	var err error
+	if startDate != "" {
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("invalid start date format: %w", err)
+		}
+	}
+	if endDate != "" {
+		end, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("invalid end date format: %w", err)
+		}
+	}
+
+	totals, unsaved, err := titleTotals(db, appName, start, end, now)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Window titles of %s, %s to %s:\n", appName, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	fmt.Println()
+	renderTitleTotals(os.Stdout, totals, titleLimit)
+	printUnsaved(os.Stdout, unsaved)
+	return nil
+}
+
+// titleTotals computes the per-title totals of an application over the
+// range, including the time the daemon has not written yet when it is
+// reachable, and that unsaved time
+func titleTotals(db *storage.DB, appName string, start, end time.Time, now time.Time) ([]stats.TitleTotal, int64, error) {
+	stored, err := db.GetTitleStats(appName, start, end)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get title stats: %w", err)
+	}
+
+	query := &storage.StatsQuery{AppName: appName, StartDate: start, EndDate: end}
+	unsaved, err := unsavedSessions(db, query, now)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Live sessions may have started before the range or be of other apps
+	var live []*storage.Session
+	var seconds int64
+	from := start.Format(storage.DateLayout)
+	to := end.Format(storage.DateLayout)
+	for _, session := range unsaved {
+		if date := session.StartTime.Format(storage.DateLayout); date < from || date > to {
+			continue
+		}
+		if !strings.EqualFold(session.AppName, appName) {
+			continue
+		}
+		live = append(live, session)
+		seconds += session.DurationSeconds
+	}
+	return stats.AddTitleSessions(stored, live), seconds, nil
+}
+
+// renderTitleTotals writes the largest titles with their share of the
+// application's time, and how many smaller ones were left out
+func renderTitleTotals(w io.Writer, totals []stats.TitleTotal, limit int) {
+	if len(totals) == 0 {
+		fmt.Fprintln(w, "  No sessions in this range")
+		return
+	}
+
+	var sum int64
+	for _, total := range totals {
+		sum += total.Seconds
+	}
+
+	shown := totals
+	if limit > 0 && len(shown) > limit {
+		shown = shown[:limit]
+	}
+	for _, total := range shown {
+		label := total.Title
+		if label == "" {
+			label = "(no title)"
+		}
+		share := 0.0
+		if sum > 0 {
+			share = float64(total.Seconds) / float64(sum) * 100
+		}
+		fmt.Fprintf(w, "  %-*s  %12s  %5.1f%%\n", titleWidth, shortenTitle(label, titleWidth), durations.Seconds(total.Seconds), share)
+	}
+	if rest := len(totals) - len(shown); rest > 0 {
+		fmt.Fprintf(w, "  ... and %d more\n", rest)
+	}
+}
+
+// shortenTitle cuts a title to at most width characters, marking the cut
+func shortenTitle(title string, width int) string {
+	runes := []rune(title)
+	if len(runes) <= width {
+		return title
+	}
+	return string(runes[:width-1]) + "…"
+}
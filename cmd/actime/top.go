@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/weii/actime/internal/daterange"
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+const (
+	// defaultTopInterval is the refresh interval of `actime top --watch`
+	defaultTopInterval = 5 * time.Second
+
+	// defaultTerminalWidth is used when the output is not a terminal
+	defaultTerminalWidth = 80
+)
+
+func showTop() error {
+	// Parse command line arguments
+	watch := false
+	interval := defaultTopInterval
+	limit := 10
+	rangeName := "today"
+
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--watch":
+			watch = true
+			// The interval is optional
+			if i+1 < len(os.Args) {
+				if d, err := time.ParseDuration(os.Args[i+1]); err == nil {
+					interval = d
+					i++
+				}
+			}
+		case "--n":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid value for --n: %s", os.Args[i+1])
+				}
+				limit = n
+				i++
+			}
+		case "--range":
+			if i+1 < len(os.Args) {
+				rangeName = os.Args[i+1]
+				i++
+			}
+		}
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("watch interval must be positive")
+	}
+
+	// Load configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Validate the range before touching the database
+	weekStart, err := daterange.ParseWeekday(cfg.Report.WeekStart)
+	if err != nil {
+		return fmt.Errorf("invalid report.week_start: %w", err)
+	}
+	if _, _, err := topRange(rangeName, time.Now(), weekStart); err != nil {
+		return err
+	}
+
+	// Open database
+	db, err := openReadOnly(cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if !watch {
+		return printTop(os.Stdout, db, rangeName, weekStart, limit, defaultTerminalWidth)
+	}
+
+	return watchTop(db, rangeName, weekStart, limit, interval)
+}
+
+// topRange resolves a --range value to an inclusive pair of days. Besides
+// the shared presets, week means the last 7 days.
+func topRange(rangeName string, now time.Time, weekStart time.Weekday) (time.Time, time.Time, error) {
+	today, _ := time.Parse("2006-01-02", now.Format("2006-01-02"))
+
+	switch rangeName {
+	case "week":
+		return today.AddDate(0, 0, -6), today, nil
+	default:
+		return daterange.Resolve(rangeName, now, weekStart)
+	}
+}
+
+// printTop queries the totals for the range and renders the leaderboard
+func printTop(w io.Writer, db *storage.DB, rangeName string, weekStart time.Weekday, limit int, width int) error {
+	now := time.Now()
+	start, end, err := topRange(rangeName, now, weekStart)
+	if err != nil {
+		return err
+	}
+
+	query := &storage.StatsQuery{
+		StartDate: start,
+		EndDate:   end,
+	}
+
+	// Every application is fetched, not just the top ones, as the shares
+	// are of the whole range
+	saved, err := db.GetTopApps(query)
+	if err != nil {
+		return fmt.Errorf("failed to get statistics: %w", err)
+	}
+
+	// Add what the daemon has tracked since its last flush
+	live, unsaved, err := liveDailyStats(db, query, now)
+	if err != nil {
+		return err
+	}
+	totals := stats.AddToTotals(saved, live)
+
+	// The app in use right now is only marked when the range reaches today
+	var current *service.CurrentSession
+	if end.Format(storage.DateLayout) >= now.Format(storage.DateLayout) {
+		current, err = readCurrentSession(now)
+		if err != nil && !errors.Is(err, service.ErrDaemonUnreachable) {
+			return err
+		}
+	}
+
+	title := fmt.Sprintf("Top %d applications (%s)", limit, rangeName)
+	renderTop(w, title, totals, current, limit, width)
+	if len(totals) == 0 {
+		printRecomputeHint(w, db, query)
+	}
+	printUnsaved(w, unsaved)
+	return nil
+}
+
+// watchTop redraws the leaderboard every interval until Ctrl+C or q
+func watchTop(db *storage.DB, rangeName string, weekStart time.Weekday, limit int, interval time.Duration) error {
+	out := io.Writer(os.Stdout)
+	quit := make(chan struct{})
+
+	// In raw mode single key presses arrive immediately, but newlines are
+	// no longer translated and Ctrl+C no longer raises SIGINT
+	stdin := int(os.Stdin.Fd())
+	if term.IsTerminal(stdin) {
+		state, err := term.MakeRaw(stdin)
+		if err == nil {
+			defer term.Restore(stdin, state)
+			out = &crlfWriter{w: os.Stdout}
+		}
+		go func() {
+			buf := make([]byte, 1)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if err != nil {
+					return
+				}
+				if n == 1 && (buf[0] == 'q' || buf[0] == 'Q' || buf[0] == 3) {
+					close(quit)
+					return
+				}
+			}
+		}()
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Query the size on every refresh so resizes are picked up
+		width := defaultTerminalWidth
+		if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+			width = w
+		}
+
+		// Clear the screen and move the cursor home
+		fmt.Fprint(out, "\033[H\033[2J")
+		if err := printTop(out, db, rangeName, weekStart, limit, width); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "\nRefreshing every %s, press q or Ctrl+C to quit\n", interval)
+
+		select {
+		case <-quit:
+			return nil
+		case <-sigChan:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderTop writes the leaderboard as plain text: rank, app, time, share and
+// a bar scaled to the top entry that fits into the given width. The row of
+// the current session's app, if any, is marked with an arrow.
+func renderTop(w io.Writer, title string, totals []stats.AppTotal, current *service.CurrentSession, limit int, width int) {
+	fmt.Fprintln(w, title)
+	fmt.Fprintln(w)
+
+	if len(totals) == 0 {
+		fmt.Fprintln(w, "  No data")
+		return
+	}
+
+	grandTotal := stats.Sum(totals)
+
+	if limit > 0 && len(totals) > limit {
+		totals = totals[:limit]
+	}
+
+	nameWidth := 0
+	for _, total := range totals {
+		if len(total.AppName) > nameWidth {
+			nameWidth = len(total.AppName)
+		}
+	}
+	if nameWidth > 30 {
+		nameWidth = 30
+	}
+
+	// rank (4) + name + duration (12) + share (6) + spacing
+	barWidth := width - nameWidth - 28
+	if barWidth < 0 {
+		barWidth = 0
+	}
+
+	maxSeconds := totals[0].TotalSeconds
+	marked := false
+	for i, total := range totals {
+		name := total.AppName
+		if len(name) > nameWidth {
+			name = name[:nameWidth]
+		}
+
+		share := 0.0
+		if grandTotal > 0 {
+			share = float64(total.TotalSeconds) / float64(grandTotal) * 100
+		}
+
+		bar := 0
+		if maxSeconds > 0 {
+			bar = int(float64(barWidth) * float64(total.TotalSeconds) / float64(maxSeconds))
+		}
+
+		marker := " "
+		if current != nil && strings.EqualFold(total.AppName, current.App) {
+			marker = "▶"
+			marked = true
+		}
+
+		line := fmt.Sprintf("%s%3d. %-*s  %12s  %5.1f%%  %s",
+			marker, i+1, nameWidth, name, durations.Seconds(total.TotalSeconds), share, strings.Repeat("#", bar))
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  Total: %s\n", durations.Seconds(grandTotal))
+	if marked {
+		fmt.Fprintln(w, "  ▶ in use right now")
+	}
+}
+
+// crlfWriter translates \n to \r\n for terminals in raw mode
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write([]byte(strings.ReplaceAll(string(p), "\n", "\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
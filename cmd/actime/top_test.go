@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/service"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestRenderTop(t *testing.T) {
+	totals := []stats.AppTotal{
+		{AppName: "editor", TotalSeconds: 3600},
+		{AppName: "browser", TotalSeconds: 1800},
+		{AppName: "terminal", TotalSeconds: 600},
+	}
+
+	var buf bytes.Buffer
+	renderTop(&buf, "Top 2 applications (today)", totals, nil, 2, 60)
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "Top 2 applications (today)\n") {
+		t.Errorf("Expected title line, got %q", out)
+	}
+	if !strings.Contains(out, "  1. editor ") || !strings.Contains(out, "  2. browser ") {
+		t.Errorf("Expected ranked rows, got %q", out)
+	}
+	if strings.Contains(out, "terminal") {
+		t.Errorf("Expected the limit to drop the third app, got %q", out)
+	}
+	if !strings.Contains(out, "60.0%") {
+		t.Errorf("Expected the share to be computed over all apps, got %q", out)
+	}
+	if !strings.Contains(out, "Total: 1h 40m 0s") {
+		t.Errorf("Expected the total over all apps, got %q", out)
+	}
+	if strings.Contains(out, "\033") {
+		t.Errorf("Expected plain output without escape sequences, got %q", out)
+	}
+}
+
+func TestRenderTopEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	renderTop(&buf, "Top 10 applications (today)", nil, nil, 10, 80)
+
+	if !strings.Contains(buf.String(), "No data") {
+		t.Errorf("Expected a no-data line, got %q", buf.String())
+	}
+}
+
+func TestPrintTopMarksCurrentSession(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now().Truncate(time.Second)
+	stored := []*storage.Session{{AppName: "editor", StartTime: start, EndTime: start.Add(30 * time.Minute), DurationSeconds: 1800}}
+	if err := db.BatchInsertSessions(stored); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(stored); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	// The daemon is recording a browser session that is not saved yet
+	stubLiveSessions(t, []*storage.Session{
+		{AppName: "browser", StartTime: start, EndTime: start.Add(10 * time.Minute), DurationSeconds: 600},
+	}, nil)
+	stubCurrentSession(t, &service.CurrentSession{App: "browser", Since: start, DurationSeconds: 600}, nil)
+
+	var buf bytes.Buffer
+	if err := printTop(&buf, db, "today", time.Monday, 10, 80); err != nil {
+		t.Fatalf("Failed to print top: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Total: 40m 0s") {
+		t.Errorf("Expected the live session in the total, got %q", out)
+	}
+	if !strings.Contains(out, "▶  2. browser") {
+		t.Errorf("Expected the current session's row to be marked, got %q", out)
+	}
+	if strings.Contains(out, "▶  1. editor") {
+		t.Errorf("Expected only the current session's row to be marked, got %q", out)
+	}
+}
+
+func TestTopRange(t *testing.T) {
+	now := time.Date(2026, 1, 7, 15, 0, 0, 0, time.Local)
+
+	start, end, err := topRange("week", now, time.Monday)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if start.Format("2006-01-02") != "2026-01-01" || end.Format("2006-01-02") != "2026-01-07" {
+		t.Errorf("Expected 2026-01-01..2026-01-07, got %s..%s", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+
+	// The shared presets work as well
+	start, end, err = topRange("last-week", now, time.Monday)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if start.Format("2006-01-02") != "2025-12-29" || end.Format("2006-01-02") != "2026-01-04" {
+		t.Errorf("Expected 2025-12-29..2026-01-04, got %s..%s", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+
+	if _, _, err := topRange("month", now, time.Monday); err == nil {
+		t.Error("Expected an error for an unsupported range")
+	}
+}
+
+func TestPrintTopHintsAtRecompute(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	stubLiveSessions(t, nil, service.ErrDaemonUnreachable)
+
+	now := time.Now()
+	if err := db.InsertSession(&storage.Session{AppName: "editor", StartTime: now, EndTime: now, DurationSeconds: 60}); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := printTop(&buf, db, "today", time.Monday, 10, 80); err != nil {
+		t.Fatalf("Failed to print top: %v", err)
+	}
+	if !strings.Contains(buf.String(), "actime db recompute-daily") {
+		t.Errorf("Expected a recompute hint, got %q", buf.String())
+	}
+
+	if _, err := db.RecomputeDailyStats(&storage.StatsQuery{}, nil); err != nil {
+		t.Fatalf("Failed to recompute: %v", err)
+	}
+	buf.Reset()
+	if err := printTop(&buf, db, "today", time.Monday, 10, 80); err != nil {
+		t.Fatalf("Failed to print top: %v", err)
+	}
+	if !strings.Contains(buf.String(), "1. editor") || strings.Contains(buf.String(), "recompute") {
+		t.Errorf("Expected stats after recompute, got %q", buf.String())
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/weii/actime/internal/config"
+	"github.com/weii/actime/internal/platform"
+)
+
+// doctorReport is what `actimed doctor` found
+type doctorReport struct {
+	Platform      string            `json:"platform"`
+	Environment   map[string]string `json:"environment,omitempty"`
+	Detectors     []string          `json:"detectors,omitempty"`
+	IdleSource    string            `json:"idle_source,omitempty"`
+	DetectorError string            `json:"detector_error,omitempty"`
+	Hint          string            `json:"hint,omitempty"`
+	// IdleSourceError is why monitor.idle_source could not be used, so the
+	// detector's own idle source was probed instead
+	IdleSourceError string                `json:"idle_source_error,omitempty"`
+	Capabilities    []platform.Capability `json:"capabilities,omitempty"`
+	Healthy         bool                  `json:"healthy"`
+}
+
+// sessionVariables are the environment variables that decide which
+// detector Linux uses and where it connects to
+var sessionVariables = []string{"XDG_SESSION_TYPE", "DISPLAY", "WAYLAND_DISPLAY", "DBUS_SESSION_BUS_ADDRESS"}
+
+// doctor initializes the detector the daemon would use, probes each of its
+// capabilities once and prints what works, with hints for what does not.
+// It reports whether everything works.
+func doctor(asJSON bool) (bool, error) {
+	cfg, err := config.Load(config.DefaultConfigPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	report := doctorReport{Platform: runtime.GOOS, Detectors: cfg.Monitor.Detectors, IdleSource: cfg.Monitor.IdleSource}
+	if runtime.GOOS == "linux" {
+		report.Environment = make(map[string]string)
+		for _, name := range sessionVariables {
+			report.Environment[name] = os.Getenv(name)
+		}
+	}
+
+	diagnosis := platform.Diagnose(cfg.Monitor.Detectors, cfg.Monitor.DetectorTimeout, cfg.Monitor.IdleSource == "evdev")
+	if diagnosis.DetectorError != nil {
+		report.DetectorError = diagnosis.DetectorError.Error()
+		report.Hint = detectorHint()
+	} else {
+		if diagnosis.IdleSourceError != nil {
+			report.IdleSourceError = diagnosis.IdleSourceError.Error()
+		}
+		report.Capabilities = diagnosis.Capabilities
+		report.Healthy = diagnosis.Healthy()
+	}
+
+	if asJSON {
+		return report.Healthy, printJSON(report)
+	}
+	printDoctorReport(&report)
+	return report.Healthy, nil
+}
+
+// detectorHint tells what usually keeps the detector of this platform from
+// starting
+func detectorHint() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "run actimed inside the desktop session, with DISPLAY (X11) or WAYLAND_DISPLAY (Wayland) set; " +
+			"monitor.detectors picks the detector explicitly"
+	case "darwin":
+		return "use a build with cgo enabled and run it inside the user's login session"
+	case "windows":
+		return "run actimed in the interactive session of the user, not as a service"
+	}
+	return ""
+}
+
+// printDoctorReport prints the report as a pass/fail table
+func printDoctorReport(report *doctorReport) {
+	fmt.Printf("Actime doctor (%s):\n", report.Platform)
+	for _, name := range sessionVariables {
+		if value, ok := report.Environment[name]; ok {
+			if value == "" {
+				value = "(unset)"
+			}
+			fmt.Printf("  %s=%s\n", name, value)
+		}
+	}
+	if len(report.Detectors) > 0 {
+		fmt.Printf("  monitor.detectors: %s\n", strings.Join(report.Detectors, ", "))
+	}
+	if report.IdleSource != "" {
+		fmt.Printf("  monitor.idle_source: %s\n", report.IdleSource)
+	}
+	fmt.Println()
+
+	if report.DetectorError != "" {
+		fmt.Printf("  [FAIL] detector: %s\n", report.DetectorError)
+		if report.Hint != "" {
+			fmt.Printf("         Hint: %s\n", report.Hint)
+		}
+		return
+	}
+
+	fmt.Println("  [PASS] detector: initialized")
+	if report.IdleSourceError != "" {
+		fmt.Printf("  [FAIL] idle_source: %s\n", report.IdleSourceError)
+		fmt.Println("         Hint: give the user read access to /dev/input/event* (usually: add it to the input group and log in again); until then the detector's own idle source is used")
+	}
+	for _, capability := range report.Capabilities {
+		result := "PASS"
+		if !capability.Working {
+			result = "FAIL"
+		}
+		message := capability.Detail
+		switch {
+		case !capability.Supported:
+			message = "not supported: " + capability.Detail
+		case capability.Method != "" && capability.Working:
+			message = fmt.Sprintf("%s (%s)", capability.Method, capability.Detail)
+		case capability.Method != "":
+			message = fmt.Sprintf("%s failed: %s", capability.Method, capability.Detail)
+		}
+		fmt.Printf("  [%s] %s: %s\n", result, capability.Name, message)
+		if capability.Hint != "" {
+			fmt.Printf("         Hint: %s\n", capability.Hint)
+		}
+	}
+}
@@ -2,23 +2,34 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/weii/actime/internal/config"
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/format"
+	"github.com/weii/actime/internal/logview"
 	"github.com/weii/actime/internal/service"
 )
 
 const (
 	Version = "0.1.0"
+
+	// spawnedEnv marks the daemon process spawned by `actimed start`
+	spawnedEnv = "ACTIMED_SPAWNED"
 )
 
+// durations renders durations in the status output
+var durations = format.Formatter{Style: format.DefaultStyle}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -40,9 +51,17 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Println("Actime daemon started successfully")
+	case "run":
+		if err := service.RunForeground(hasFlag(os.Args, "--verbose")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	case "daemon":
-		// This is the actual daemon process, runs in background
-		if err := runDaemon(); err != nil {
+		// This is the actual daemon process spawned by start
+		if os.Getenv(spawnedEnv) != "1" {
+			fmt.Fprintln(os.Stderr, "Warning: 'actimed daemon' is internal and deprecated for direct use; use 'actimed run' to run in the foreground")
+		}
+		if err := service.RunDaemon(); err != nil {
 			fmt.Fprintf(os.Stderr, "Daemon error: %v\n", err)
 			os.Exit(1)
 		}
@@ -60,16 +79,35 @@ func main() {
 		}
 		fmt.Println("Actime daemon restarted successfully")
 	case "status":
-		if err := statusService(); err != nil {
+		if err := statusService(hasFlag(os.Args, "--json")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "health":
+		healthy, err := healthService(hasFlag(os.Args, "--json"))
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		if !healthy {
+			os.Exit(1)
+		}
+	case "doctor":
+		healthy, err := doctor(hasFlag(os.Args, "--json"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !healthy {
+			os.Exit(1)
+		}
 	case "log":
-		follow := false
-		if len(os.Args) > 2 && os.Args[2] == "-f" {
-			follow = true
+		if err := showLog(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
-		if err := showLog(follow); err != nil {
+	case "simulate":
+		if err := simulate(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -93,6 +131,15 @@ func hasHelpFlag(args []string) bool {
 	return false
 }
 
+func hasFlag(args []string, flag string) bool {
+	for _, arg := range args[2:] {
+		if arg == flag {
+			return true
+		}
+	}
+	return false
+}
+
 func printCommandHelp(command string) {
 	switch command {
 	case "start":
@@ -134,22 +181,62 @@ func printCommandHelp(command string) {
 	case "status":
 		fmt.Println("Show the status of the Actime daemon")
 		fmt.Println()
-		fmt.Println("Usage: actimed status")
+		fmt.Println("Usage: actimed status [--json]")
+		fmt.Println()
+		fmt.Println("Options:")
+		fmt.Println("  --json  Print the status as JSON")
 		fmt.Println()
 		fmt.Println("Description:")
 		fmt.Println("  Displays the current status of the Actime daemon, including")
-		fmt.Println("  whether it is running and its process ID.")
+		fmt.Println("  whether it is running and its process ID. When the daemon")
+		fmt.Println("  is reachable, the current session and buffer state are shown.")
 		fmt.Println()
 		fmt.Println("Exit codes:")
 		fmt.Println("  0 - Success")
 		fmt.Println("  1 - Failed to get status")
+	case "health":
+		fmt.Println("Check the health of the Actime daemon")
+		fmt.Println()
+		fmt.Println("Usage: actimed health [--json]")
+		fmt.Println()
+		fmt.Println("Options:")
+		fmt.Println("  --json  Print the check results as JSON")
+		fmt.Println()
+		fmt.Println("Description:")
+		fmt.Println("  Runs a set of checks against the running daemon and prints")
+		fmt.Println("  whether each one passed, with a hint when it failed.")
+		fmt.Println()
+		fmt.Println("Exit codes:")
+		fmt.Println("  0 - All checks passed")
+		fmt.Println("  1 - At least one check failed")
+	case "doctor":
+		fmt.Println("Check what the window detector can tell on this system")
+		fmt.Println()
+		fmt.Println("Usage: actimed doctor [--json]")
+		fmt.Println()
+		fmt.Println("Description:")
+		fmt.Println("  Initializes the detector the daemon would use, asks it once for the")
+		fmt.Println("  active window, the idle time and the lock state, and prints what")
+		fmt.Println("  works, with hints for what does not. Run it from the desktop session")
+		fmt.Println("  when tracking records nothing or counts idle time as active.")
+		fmt.Println()
+		fmt.Println("Options:")
+		fmt.Println("  --json  Print the report as JSON")
+		fmt.Println()
+		fmt.Println("Exit codes:")
+		fmt.Println("  0 - Every capability works")
+		fmt.Println("  1 - The detector failed to start or a capability does not work")
 	case "log":
 		fmt.Println("Show the recent log entries")
 		fmt.Println()
-		fmt.Println("Usage: actimed log [-f]")
+		fmt.Println("Usage: actimed log [-f] [--level LEVEL] [--grep REGEXP] [--since DURATION]")
 		fmt.Println()
 		fmt.Println("Options:")
-		fmt.Println("  -f  Follow log output (like tail -f)")
+		fmt.Println("  -f                 Follow log output (like tail -f)")
+		fmt.Println("  --level LEVEL      Only show entries at LEVEL or above (debug, info, warn, error)")
+		fmt.Println("  --grep REGEXP      Only show entries matching REGEXP")
+		fmt.Println("  --since DURATION   Show every entry of the last DURATION, e.g. 1h, including")
+		fmt.Println("                     rotated log files, instead of the last 50 entries")
 		fmt.Println()
 		fmt.Println("Description:")
 		fmt.Println("  Displays the last 50 log entries from the Actime log file.")
@@ -165,14 +252,51 @@ func printCommandHelp(command string) {
 		fmt.Println()
 		fmt.Println("Description:")
 		fmt.Println("  Displays the current version of Actime daemon.")
+	case "run":
+		fmt.Println("Run Actime in the foreground")
+		fmt.Println()
+		fmt.Println("Usage: actimed run [--verbose]")
+		fmt.Println()
+		fmt.Println("Description:")
+		fmt.Println("  Runs the full service attached to the terminal, with logs written")
+		fmt.Println("  to the terminal as well as the log file. Press Ctrl+C to stop;")
+		fmt.Println("  buffered sessions are flushed before exiting.")
+		fmt.Println()
+		fmt.Println("Options:")
+		fmt.Println("  --verbose  Enable debug logging")
+		fmt.Println()
+		fmt.Println("Exit codes:")
+		fmt.Println("  0 - Stopped cleanly")
+		fmt.Println("  1 - Failed to start (e.g. the daemon is already running)")
+	case "simulate":
+		fmt.Println("Replay a script of activity through the service")
+		fmt.Println()
+		fmt.Println("Usage: actimed simulate --script FILE [--db PATH] [--speed N] [--verbose]")
+		fmt.Println()
+		fmt.Println("Description:")
+		fmt.Println("  Runs the real tracker, service and database against a scripted")
+		fmt.Println("  detector instead of the desktop, on a simulated clock starting at")
+		fmt.Println("  the script's start time. Tracking rules come from the configuration;")
+		fmt.Println("  retention and automatic export are off. A running daemon is not")
+		fmt.Println("  disturbed. To report on the result, point database.path at it.")
+		fmt.Println()
+		fmt.Println("Options:")
+		fmt.Println("  --script FILE  YAML script of the activity to replay")
+		fmt.Println("  --db PATH      Database to write to (default: the script's path with .db)")
+		fmt.Println("  --speed N      Simulated seconds per real second (default: 1000)")
+		fmt.Println("  --verbose      Enable debug logging")
+		fmt.Println()
+		fmt.Println("Exit codes:")
+		fmt.Println("  0 - Script replayed")
+		fmt.Println("  1 - Invalid script or options, or the service failed")
 	case "daemon":
 		fmt.Println("Run Actime as daemon (internal command)")
 		fmt.Println()
 		fmt.Println("Usage: actimed daemon")
 		fmt.Println()
 		fmt.Println("Description:")
-		fmt.Println("  This is an internal command used by the 'start' command.")
-		fmt.Println("  Users should not call this directly.")
+		fmt.Println("  This is an internal command spawned by the 'start' command.")
+		fmt.Println("  Use 'actimed run' to run the service in the foreground.")
 	default:
 		printUsage()
 	}
@@ -186,8 +310,12 @@ func printUsage() {
 	fmt.Println("  start    Start the Actime daemon")
 	fmt.Println("  stop     Stop the Actime daemon")
 	fmt.Println("  restart  Restart the Actime daemon")
-	fmt.Println("  status   Show the status of the Actime daemon")
+	fmt.Println("  run      Run in the foreground until Ctrl+C [--verbose]")
+	fmt.Println("  status   Show the status of the Actime daemon [--json]")
+	fmt.Println("  health   Check the health of the Actime daemon [--json]")
+	fmt.Println("  doctor   Check what the window detector can tell [--json]")
 	fmt.Println("  log [-f] Show the recent log entries [-f: follow log output]")
+	fmt.Println("  simulate Replay a script of activity into a database [--script FILE]")
 	fmt.Println("  version  Show version information")
 	fmt.Println("  help     Show this help message")
 }
@@ -211,11 +339,11 @@ func startService() error {
 	args := []string{"daemon"}
 	cmd := exec.Command(os.Args[0], args...)
 
-	// Hide the console window on Windows
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow:    true,
-		CreationFlags: 0x08000000, // CREATE_NO_WINDOW
-	}
+	// Detach from the console (hidden window on Windows, new session elsewhere)
+	cmd.SysProcAttr = detachedProcAttr()
+
+	// Mark the process as spawned so direct use of `daemon` can be told apart
+	cmd.Env = append(os.Environ(), spawnedEnv+"=1")
 
 	// Redirect output to avoid blocking
 	cmd.Stdout = nil
@@ -295,26 +423,124 @@ func restartService() error {
 	return nil
 }
 
-func statusService() error {
+func statusService(asJSON bool) error {
+	status := currentStatus()
+
+	if asJSON {
+		return printJSON(status)
+	}
+
+	// Render durations in the configured style when the config is readable
+	if cfg, err := config.Load(config.DefaultConfigPath); err == nil {
+		durations = format.Formatter{
+			Style:    format.Style(cfg.Report.DurationStyle),
+			Language: cfg.Report.Language,
+		}
+	}
+
 	fmt.Println("Actime daemon status:")
 
-	// Check if service is running
-	if isRunning() {
-		pid, err := service.ReadPIDFile(service.PIDFile)
-		if err != nil {
-			fmt.Println("  Status: Running (PID: unknown)")
-			return nil
+	if !status.Running {
+		fmt.Println("  Status: Stopped")
+		return nil
+	}
+
+	if status.PID == 0 {
+		fmt.Println("  Status: Running (PID: unknown)")
+		return nil
+	}
+	fmt.Printf("  Status: Running (PID: %d)\n", status.PID)
+
+	// Get process information
+	if err := printProcessInfo(status.PID); err != nil {
+		fmt.Printf("  Process info: Unable to retrieve (%v)\n", err)
+	}
+
+	if !status.Reachable {
+		fmt.Println("  Daemon: No recent status snapshot")
+		return nil
+	}
+
+	if status.Foreground {
+		fmt.Println("  Mode: Foreground (actimed run)")
+	}
+
+	if status.Current != nil {
+		fmt.Printf("  Current: %s (%s)\n", status.Current.App, durations.Seconds(status.Current.DurationSeconds))
+	} else {
+		fmt.Println("  Current: Paused")
+	}
+	fmt.Printf("  Today: %s\n", durations.Seconds(*status.TodaySeconds))
+	fmt.Printf("  Pending sessions: %d\n", status.Buffer.PendingSessions)
+	if counters := status.Counters; counters != nil {
+		fmt.Printf("  Since start: %d sessions started, %d flushed, %d flush errors\n",
+			counters.SessionsStartedTotal, counters.SessionsFlushedTotal, counters.FlushErrorsTotal)
+		if status.Detector.ErrorsTotal > 0 {
+			errors := counters.DetectorErrorsTotal
+			fmt.Printf("  Detector errors: %d (lock %d, idle %d, window %d)\n", status.Detector.ErrorsTotal,
+				errors[core.DetectorCallLock], errors[core.DetectorCallIdle], errors[core.DetectorCallWindow])
+		}
+	}
+	if status.Detector.SessionState != "" {
+		fmt.Printf("  Session: %s\n", status.Detector.SessionState)
+	}
+	for _, member := range status.Detector.Members {
+		state := "ok"
+		if !member.Healthy {
+			state = "failing"
+			if member.LastError != "" {
+				state += ": " + member.LastError
+			}
 		}
-		fmt.Printf("  Status: Running (PID: %d)\n", pid)
+		fmt.Printf("  Detector %s: %s (%d failures)\n", member.Name, state, member.Failures)
+	}
+	if status.Buffer.LastFlushError != "" {
+		fmt.Printf("  Last flush error: %s\n", status.Buffer.LastFlushError)
+	}
+	if status.Buffer.DeadLetters > 0 {
+		fmt.Printf("  Dead letters: %d (retry with: actime db deadletter replay)\n", status.Buffer.DeadLetters)
+	}
+
+	return nil
+}
+
+func healthService(asJSON bool) (bool, error) {
+	health := service.CheckHealth(currentStatus())
+
+	if asJSON {
+		return health.Healthy, printJSON(health)
+	}
 
-		// Get process information
-		if err := printProcessInfo(pid); err != nil {
-			fmt.Printf("  Process info: Unable to retrieve (%v)\n", err)
+	fmt.Println("Actime daemon health:")
+	for _, check := range health.Checks {
+		result := "PASS"
+		if !check.Pass {
+			result = "FAIL"
 		}
-	} else {
-		fmt.Println("  Status: Stopped")
+		fmt.Printf("  [%s] %s: %s\n", result, check.Name, check.Message)
+	}
+
+	return health.Healthy, nil
+}
+
+// currentStatus combines the PID file with the daemon's status snapshot
+func currentStatus() *service.Status {
+	running := isRunning()
+	pid := 0
+	if running {
+		pid, _ = service.ReadPIDFile(service.PIDFile)
 	}
 
+	snapshot, _ := service.ReadSnapshot(service.StatusFile)
+	return service.BuildStatus(Version, running, pid, snapshot, time.Now())
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
 	return nil
 }
 
@@ -414,7 +640,7 @@ func printProcessInfoUnix(pid int) error {
 
 	// Get uptime
 	uptimeSeconds := float64(starttime) / float64(clockTicks)
-	fmt.Printf("  Uptime: %s\n", fmtDuration(int(uptimeSeconds)))
+	fmt.Printf("  Uptime: %s\n", durations.Seconds(int64(uptimeSeconds)))
 
 	return nil
 }
@@ -432,48 +658,69 @@ func getSystemUptime() float64 {
 	return uptime
 }
 
-func fmtDuration(seconds int) string {
-	if seconds < 60 {
-		return fmt.Sprintf("%ds", seconds)
-	}
-	minutes := seconds / 60
-	if minutes < 60 {
-		return fmt.Sprintf("%dm %ds", minutes, seconds%60)
-	}
-	hours := minutes / 60
-	minutes = minutes % 60
-	if hours < 24 {
-		return fmt.Sprintf("%dh %dm", hours, minutes)
+func showLog() error {
+	follow := false
+	filter := logview.Filter{Level: slog.LevelDebug}
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "-f":
+			follow = true
+		case "--level", "--grep", "--since":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("%s needs a value", arg)
+			}
+			value := os.Args[i+1]
+			i++
+
+			switch arg {
+			case "--level":
+				if err := filter.Level.UnmarshalText([]byte(value)); err != nil {
+					return fmt.Errorf("invalid level %q (expected debug, info, warn or error)", value)
+				}
+			case "--grep":
+				pattern, err := regexp.Compile(value)
+				if err != nil {
+					return fmt.Errorf("invalid --grep pattern: %w", err)
+				}
+				filter.Pattern = pattern
+			case "--since":
+				d, err := time.ParseDuration(value)
+				if err != nil || d <= 0 {
+					return fmt.Errorf("invalid --since duration: %s", value)
+				}
+				filter.Since = time.Now().Add(-d)
+			}
+		}
 	}
-	days := hours / 24
-	hours = hours % 24
-	return fmt.Sprintf("%dd %dh", days, hours)
-}
 
-func showLog(follow bool) error {
 	// Load configuration to get log file path
 	cfg, err := config.Load(config.DefaultConfigPath)
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	// Open log file
-	file, err := os.Open(cfg.Logging.File)
-	if err != nil {
-		return fmt.Errorf("failed to open log file: %w", err)
+	// With --since the rotated files may hold matching entries too
+	files := []string{cfg.Logging.File}
+	if !filter.Since.IsZero() {
+		files, err = logview.Files(cfg.Logging.File, filter.Since)
+		if err != nil {
+			return fmt.Errorf("failed to list log files: %w", err)
+		}
 	}
-	defer file.Close()
 
-	// Read last 50 lines
-	scanner := bufio.NewScanner(file)
 	lines := []string{}
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	for _, path := range files {
+		matched, err := readLogLines(path, filter)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, matched...)
 	}
 
-	// Show last 50 lines
+	// Show the last 50 lines unless a time range was asked for
 	start := 0
-	if len(lines) > 50 {
+	if filter.Since.IsZero() && len(lines) > 50 {
 		start = len(lines) - 50
 	}
 
@@ -489,6 +736,12 @@ func showLog(follow bool) error {
 		fmt.Println("Following log output (press Ctrl+C to stop)...")
 		fmt.Println(strings.Repeat("-", 80))
 
+		file, err := os.Open(cfg.Logging.File)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		defer file.Close()
+
 		// Seek to end of file
 		fileInfo, err := file.Stat()
 		if err != nil {
@@ -500,6 +753,7 @@ func showLog(follow bool) error {
 		}
 
 		// Read new lines as they are written
+		matcher := filter.Matcher()
 		reader := bufio.NewReader(file)
 		for {
 			line, err := reader.ReadString('\n')
@@ -508,13 +762,37 @@ func showLog(follow bool) error {
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
-			fmt.Print(line)
+			if matcher.Match(line) {
+				fmt.Print(line)
+			}
 		}
 	}
 
 	return nil
 }
 
+// readLogLines returns the lines of a log file that pass filter
+func readLogLines(path string, filter logview.Filter) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	matcher := filter.Matcher()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if matcher.Match(scanner.Text()) {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log file: %w", err)
+	}
+	return lines, nil
+}
+
 func isRunning() bool {
 	// Check if PID file exists
 	if _, err := os.Stat(service.PIDFile); err != nil {
@@ -530,20 +808,3 @@ func isRunning() bool {
 	// Check if process is running
 	return service.IsProcessRunning(pid)
 }
-
-func runDaemon() error {
-	// Load configuration
-	cfg, err := config.Load(config.DefaultConfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
-	}
-
-	// Create service
-	svc, err := service.NewService(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to create service: %w", err)
-	}
-
-	// Start service (this will block)
-	return svc.Start()
-}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/config"
+	"github.com/weii/actime/internal/service"
+)
+
+// simulate replays a script of activity through the service into a
+// database of its own
+func simulate() error {
+	scriptPath, dbPath := "", ""
+	speed := service.DefaultSimulationSpeed
+	verbose := false
+	for i := 2; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch arg {
+		case "--verbose":
+			verbose = true
+		case "--script", "--db", "--speed":
+			if i+1 >= len(os.Args) {
+				return fmt.Errorf("%s needs a value", arg)
+			}
+			value := os.Args[i+1]
+			i++
+
+			switch arg {
+			case "--script":
+				scriptPath = value
+			case "--db":
+				dbPath = value
+			case "--speed":
+				n, err := strconv.Atoi(value)
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid --speed: %s", value)
+				}
+				speed = n
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+	if scriptPath == "" {
+		return fmt.Errorf("--script is required")
+	}
+	if dbPath == "" {
+		dbPath = strings.TrimSuffix(scriptPath, filepath.Ext(scriptPath)) + ".db"
+	}
+
+	script, err := service.LoadSimulationScript(scriptPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(config.DefaultConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	started := time.Now()
+	sessions, err := service.RunSimulation(cfg, script, dbPath, speed, verbose)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Simulated %s in %s; %d sessions written to %s\n",
+		durations.Seconds(int64(script.Duration().Seconds())), time.Since(started).Round(time.Millisecond), sessions, dbPath)
+	return nil
+}
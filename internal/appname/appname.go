@@ -0,0 +1,12 @@
+// Package appname normalizes application names and resolves aliases for
+// display and aggregation
+package appname
+
+import "strings"
+
+// Clean removes null bytes and surrounding whitespace from an application
+// name. Names read from X11 WM_CLASS may contain embedded null separators.
+func Clean(name string) string {
+	name = strings.ReplaceAll(name, "\x00", " ")
+	return strings.TrimSpace(name)
+}
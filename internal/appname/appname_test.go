@@ -0,0 +1,22 @@
+package appname
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"firefox", "firefox"},
+		{"  firefox  ", "firefox"},
+		{"code\x00Code\x00", "code Code"},
+		{"\x00", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Clean(tt.in); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package appname
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rule maps every application name matching Pattern to Name. Patterns are
+// regular expressions matched case-insensitively against the cleaned name.
+// A rule with a Path only matches applications whose executable path it
+// matches too, which tells apart processes of one generic name such as
+// "java" or "electron". A rule with a Class only matches X11 windows
+// whose WM_CLASS, written "class/instance", it matches too, which tells
+// apart windows an application was started for with distinct --class
+// values, such as browser profiles.
+type Rule struct {
+	Pattern string `yaml:"pattern"`
+	Path    string `yaml:"path"`
+	Class   string `yaml:"class"`
+	Name    string `yaml:"name"`
+}
+
+// Mapper resolves application names and their aliases to a canonical name
+type Mapper struct {
+	patterns []*regexp.Regexp
+	paths    []*regexp.Regexp // nil for rules without a path
+	classes  []*regexp.Regexp // nil for rules without a class
+	names    []string
+}
+
+// NewMapper compiles mapping rules. The first matching rule wins.
+func NewMapper(rules []Rule) (*Mapper, error) {
+	m := &Mapper{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("app mapping rule %d has no name", i+1)
+		}
+		pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in app mapping rule %d: %w", i+1, err)
+		}
+		var path *regexp.Regexp
+		if rule.Path != "" {
+			path, err = regexp.Compile("(?i)" + rule.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path in app mapping rule %d: %w", i+1, err)
+			}
+		}
+		var class *regexp.Regexp
+		if rule.Class != "" {
+			class, err = regexp.Compile("(?i)" + rule.Class)
+			if err != nil {
+				return nil, fmt.Errorf("invalid class in app mapping rule %d: %w", i+1, err)
+			}
+		}
+		m.patterns = append(m.patterns, pattern)
+		m.paths = append(m.paths, path)
+		m.classes = append(m.classes, class)
+		m.names = append(m.names, rule.Name)
+	}
+	return m, nil
+}
+
+// Canonical returns the cleaned name, replaced by the name of the first
+// matching rule. Names differing only in case are told apart here but
+// treated as one application by queries. A nil Mapper only cleans. Rules
+// with a path or a class do not match, as neither is known.
+func (m *Mapper) Canonical(name string) string {
+	return m.CanonicalPath(name, "")
+}
+
+// CanonicalPath is Canonical for an application whose executable path is
+// known, so rules with a path can match too
+func (m *Mapper) CanonicalPath(name, path string) string {
+	return m.CanonicalWindow(name, path, "")
+}
+
+// CanonicalWindow is CanonicalPath for a window whose WM_CLASS is known
+// too, written "class/instance", so rules with a class can match as well.
+// Either may be "" when unknown.
+func (m *Mapper) CanonicalWindow(name, path, wmClass string) string {
+	name = Clean(name)
+	if m == nil {
+		return name
+	}
+
+	for i, pattern := range m.patterns {
+		if !pattern.MatchString(name) {
+			continue
+		}
+		if m.paths[i] != nil && (path == "" || !m.paths[i].MatchString(path)) {
+			continue
+		}
+		if m.classes[i] != nil && (wmClass == "" || !m.classes[i].MatchString(wmClass)) {
+			continue
+		}
+		return m.names[i]
+	}
+	return name
+}
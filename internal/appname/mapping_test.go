@@ -0,0 +1,114 @@
+package appname
+
+import "testing"
+
+func TestMapperCanonical(t *testing.T) {
+	m, err := NewMapper([]Rule{
+		{Pattern: `^firefox(-bin|-esr)?$`, Name: "firefox"},
+		{Pattern: `^code(-oss)?$`, Name: "code"},
+		{Pattern: `^code`, Name: "never used"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"firefox", "firefox"},
+		{"Firefox", "firefox"},
+		{"firefox-bin", "firefox"},
+		{"FIREFOX-ESR\x00", "firefox"},
+		{"code-oss", "code"},
+		{"Chromium", "Chromium"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := m.Canonical(tt.in); got != tt.want {
+			t.Errorf("Canonical(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMapperCanonicalPath(t *testing.T) {
+	m, err := NewMapper([]Rule{
+		{Pattern: `^java$`, Path: `/idea[^/]*/jbr/`, Name: "IntelliJ IDEA"},
+		{Path: `[/\\]slack[/\\]`, Name: "Slack"},
+		{Pattern: `^java$`, Name: "Java"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"java", "/opt/idea-IU-241/jbr/bin/java", "IntelliJ IDEA"},
+		{"java", "/usr/lib/jvm/java-21/bin/java", "Java"},
+		{"java", "", "Java"},
+		{"electron", `C:\Users\me\AppData\Local\Slack\app-4.36\slack.exe`, "Slack"},
+		{"electron", "/usr/lib/electron/electron", "electron"},
+	}
+	for _, tt := range tests {
+		if got := m.CanonicalPath(tt.name, tt.path); got != tt.want {
+			t.Errorf("CanonicalPath(%q, %q) = %q, want %q", tt.name, tt.path, got, tt.want)
+		}
+	}
+
+	// Without a path, rules with one do not match
+	if got := m.Canonical("java"); got != "Java" {
+		t.Errorf("Canonical(%q) = %q, want %q", "java", got, "Java")
+	}
+}
+
+func TestMapperCanonicalWindow(t *testing.T) {
+	m, err := NewMapper([]Rule{
+		{Pattern: `^chromium$`, Class: `^work/chromium$`, Name: "Chromium (work)"},
+		{Pattern: `^chromium$`, Name: "Chromium"},
+		{Class: `^scratch/`, Name: "Scratchpad"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	tests := []struct {
+		name    string
+		wmClass string
+		want    string
+	}{
+		{"chromium", "Work/chromium", "Chromium (work)"},
+		{"chromium", "Chromium/chromium", "Chromium"},
+		{"chromium", "", "Chromium"},
+		{"kitty", "scratch/kitty", "Scratchpad"},
+		{"kitty", "", "kitty"},
+	}
+	for _, tt := range tests {
+		if got := m.CanonicalWindow(tt.name, "", tt.wmClass); got != tt.want {
+			t.Errorf("CanonicalWindow(%q, %q) = %q, want %q", tt.name, tt.wmClass, got, tt.want)
+		}
+	}
+}
+
+func TestNilMapperOnlyCleans(t *testing.T) {
+	var m *Mapper
+	if got := m.Canonical(" Firefox\x00"); got != "Firefox" {
+		t.Errorf("Expected a nil mapper to only clean the name, got %q", got)
+	}
+}
+
+func TestNewMapperInvalid(t *testing.T) {
+	if _, err := NewMapper([]Rule{{Pattern: "(", Name: "x"}}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if _, err := NewMapper([]Rule{{Path: "(", Name: "x"}}); err == nil {
+		t.Error("Expected an error for an invalid path")
+	}
+	if _, err := NewMapper([]Rule{{Class: "(", Name: "x"}}); err == nil {
+		t.Error("Expected an error for an invalid class")
+	}
+	if _, err := NewMapper([]Rule{{Pattern: "x"}}); err == nil {
+		t.Error("Expected an error for a rule without a name")
+	}
+}
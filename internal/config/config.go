@@ -4,22 +4,34 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/weii/actime/internal/appname"
 	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/daterange"
+	"github.com/weii/actime/internal/export"
+	"github.com/weii/actime/internal/format"
+	"github.com/weii/actime/internal/fsutil"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/title"
 	"gopkg.in/yaml.v3"
 )
 
 const (
 	// DefaultConfigPath is the default configuration file path
 	DefaultConfigPath = "~/.actime/config.yaml"
+
+	// DefaultBackupKeep is how many daemon backups are kept by default
+	DefaultBackupKeep = 7
 )
 
 // Load loads configuration from the specified path
 // If the file doesn't exist, returns default configuration
 func Load(path string) (*core.Config, error) {
 	// Expand ~ to home directory
-	expandedPath, err := expandPath(path)
+	expandedPath, err := ExpandPath(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to expand path: %w", err)
 	}
@@ -53,7 +65,7 @@ func Load(path string) (*core.Config, error) {
 // Save saves configuration to the specified path
 func Save(cfg *core.Config, path string) error {
 	// Expand ~ to home directory
-	expandedPath, err := expandPath(path)
+	expandedPath, err := ExpandPath(path)
 	if err != nil {
 		return fmt.Errorf("failed to expand path: %w", err)
 	}
@@ -71,7 +83,7 @@ func Save(cfg *core.Config, path string) error {
 	}
 
 	// Write file
-	if err := os.WriteFile(expandedPath, data, 0644); err != nil {
+	if err := fsutil.WriteFile(expandedPath, data, 0644, true); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -80,44 +92,9 @@ func Save(cfg *core.Config, path string) error {
 
 // getDefaultConfig returns the default configuration
 func getDefaultConfig() *core.Config {
-	homeDir, _ := os.UserHomeDir()
-
-	return &core.Config{
-		Database: struct {
-			Path string `yaml:"path"`
-		}{
-			Path: filepath.Join(homeDir, ".actime", "actime.db"),
-		},
-		Monitor: struct {
-			CheckInterval  time.Duration `yaml:"check_interval"`
-			ActivityWindow time.Duration `yaml:"activity_window"`
-			IdleTimeout    time.Duration `yaml:"idle_timeout"`
-		}{
-			CheckInterval:  1 * time.Second,
-			ActivityWindow: 5 * time.Minute,
-			IdleTimeout:    10 * time.Minute,
-		},
-		Logging: struct {
-			Level      string `yaml:"level"`
-			File       string `yaml:"file"`
-			MaxSizeMB  int    `yaml:"max_size_mb"`
-			MaxBackups int    `yaml:"max_backups"`
-			MaxAgeDays int    `yaml:"max_age_days"`
-		}{
-			Level:      "info",
-			File:       filepath.Join(homeDir, ".actime", "actime.log"),
-			MaxSizeMB:  100,
-			MaxBackups: 3,
-			MaxAgeDays: 30,
-		},
-		Export: struct {
-			OutputDir     string `yaml:"output_dir"`
-			DefaultFormat string `yaml:"default_format"`
-		}{
-			OutputDir:     filepath.Join(homeDir, ".actime", "exports"),
-			DefaultFormat: "csv",
-		},
-	}
+	cfg := &core.Config{}
+	validateAndSetDefaults(cfg)
+	return cfg
 }
 
 // validateAndSetDefaults validates configuration and sets defaults
@@ -128,6 +105,15 @@ func validateAndSetDefaults(cfg *core.Config) error {
 	if cfg.Database.Path == "" {
 		cfg.Database.Path = filepath.Join(homeDir, ".actime", "actime.db")
 	}
+	if cfg.Database.MaxReadConns <= 0 {
+		cfg.Database.MaxReadConns = storage.DefaultMaxReadConns
+	}
+	if cfg.Database.BusyTimeout <= 0 {
+		cfg.Database.BusyTimeout = storage.DefaultBusyTimeout
+	}
+	if cfg.Database.SlowQuery <= 0 {
+		cfg.Database.SlowQuery = storage.DefaultSlowQuery
+	}
 
 	// Validate monitor settings
 	if cfg.Monitor.CheckInterval == 0 {
@@ -139,6 +125,30 @@ func validateAndSetDefaults(cfg *core.Config) error {
 	if cfg.Monitor.IdleTimeout == 0 {
 		cfg.Monitor.IdleTimeout = 10 * time.Minute
 	}
+	if cfg.Monitor.MaxSessionDuration < 0 {
+		return fmt.Errorf("invalid monitor.max_session_duration: %s", cfg.Monitor.MaxSessionDuration)
+	}
+	if cfg.Monitor.MaxSessionDuration == 0 {
+		cfg.Monitor.MaxSessionDuration = core.DefaultMaxSessionDuration
+	}
+	if cfg.Monitor.DetectorTimeout < 0 {
+		return fmt.Errorf("invalid monitor.detector_timeout: %s", cfg.Monitor.DetectorTimeout)
+	}
+	seen := make(map[string]bool)
+	for i, name := range cfg.Monitor.Detectors {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			return fmt.Errorf("invalid monitor.detectors: %q is empty or listed twice", cfg.Monitor.Detectors[i])
+		}
+		seen[name] = true
+		cfg.Monitor.Detectors[i] = name
+	}
+	cfg.Monitor.IdleSource = strings.ToLower(strings.TrimSpace(cfg.Monitor.IdleSource))
+	switch cfg.Monitor.IdleSource {
+	case "", "auto", "evdev":
+	default:
+		return fmt.Errorf("invalid monitor.idle_source: %q (expected auto or evdev)", cfg.Monitor.IdleSource)
+	}
 
 	// Validate logging settings
 	if cfg.Logging.Level == "" {
@@ -164,12 +174,123 @@ func validateAndSetDefaults(cfg *core.Config) error {
 	if cfg.Export.DefaultFormat == "" {
 		cfg.Export.DefaultFormat = "csv"
 	}
+	if cfg.Export.Toggl.MinEntry == 0 {
+		cfg.Export.Toggl.MinEntry = time.Minute
+	}
+	if cfg.Export.Toggl.Timezone != "" {
+		if _, err := time.LoadLocation(cfg.Export.Toggl.Timezone); err != nil {
+			return fmt.Errorf("invalid export.toggl.timezone: %w", err)
+		}
+	}
+
+	if cfg.Export.Auto.Format == "" {
+		cfg.Export.Auto.Format = "jsonl"
+	}
+	if cfg.Export.Auto.Format != "jsonl" {
+		return fmt.Errorf("invalid export.auto.format: %s (only jsonl is supported)", cfg.Export.Auto.Format)
+	}
+	if cfg.Export.Auto.Granularity == "" {
+		cfg.Export.Auto.Granularity = "day"
+	}
+	if cfg.Export.Auto.Granularity != "day" {
+		return fmt.Errorf("invalid export.auto.granularity: %s (only day is supported)", cfg.Export.Auto.Granularity)
+	}
+	if cfg.Export.Auto.Dir == "" {
+		cfg.Export.Auto.Dir = filepath.Join(cfg.Export.OutputDir, "daily")
+	}
+	if dir, err := ExpandPath(cfg.Export.Auto.Dir); err == nil {
+		cfg.Export.Auto.Dir = dir
+	}
+	if cfg.Export.Auto.CatchUpDays < 0 {
+		return fmt.Errorf("invalid export.auto.catch_up_days: %d", cfg.Export.Auto.CatchUpDays)
+	}
+	if cfg.Export.Auto.CatchUpDays == 0 {
+		cfg.Export.Auto.CatchUpDays = export.DefaultCatchUpDays
+	}
+
+	// Validate retention settings
+	if cfg.Retention.Days < 0 {
+		return fmt.Errorf("invalid retention.days: %d", cfg.Retention.Days)
+	}
+	if cfg.Retention.DailyStatsDays < 0 {
+		return fmt.Errorf("invalid retention.daily_stats_days: %d", cfg.Retention.DailyStatsDays)
+	}
+	if cfg.Retention.DailyStatsDays > 0 && (cfg.Retention.Days == 0 || cfg.Retention.DailyStatsDays < cfg.Retention.Days) {
+		return fmt.Errorf("invalid retention.daily_stats_days: %d keeps fewer days than the sessions (retention.days: %d)",
+			cfg.Retention.DailyStatsDays, cfg.Retention.Days)
+	}
+
+	// Validate backup settings
+	if cfg.Database.Backup.Interval < 0 {
+		return fmt.Errorf("invalid database.backup.interval: %s", cfg.Database.Backup.Interval)
+	}
+	if cfg.Database.Backup.Interval > 0 && cfg.Database.Backup.Interval < time.Minute {
+		return fmt.Errorf("invalid database.backup.interval: %s (at least 1m)", cfg.Database.Backup.Interval)
+	}
+	if cfg.Database.Backup.Keep < 0 {
+		return fmt.Errorf("invalid database.backup.keep: %d", cfg.Database.Backup.Keep)
+	}
+	if cfg.Database.Backup.Keep == 0 {
+		cfg.Database.Backup.Keep = DefaultBackupKeep
+	}
+	if cfg.Database.Backup.Dir == "" {
+		cfg.Database.Backup.Dir = cfg.Export.OutputDir
+	}
+	if dir, err := ExpandPath(cfg.Database.Backup.Dir); err == nil {
+		cfg.Database.Backup.Dir = dir
+	}
+
+	// Validate title normalization rules
+	if cfg.TitleNormalize == nil {
+		cfg.TitleNormalize = append([]title.Rule{}, title.DefaultRules...)
+	}
+	if _, err := title.Compile(cfg.TitleNormalize); err != nil {
+		return fmt.Errorf("invalid title_normalize: %w", err)
+	}
+
+	if cfg.Browsers == nil {
+		cfg.Browsers = append([]string{}, core.DefaultBrowsers...)
+	}
+
+	// Validate app mapping rules
+	if _, err := appname.NewMapper(cfg.AppMapping); err != nil {
+		return fmt.Errorf("invalid app_mapping: %w", err)
+	}
+
+	// Validate schedule rules
+	if _, err := core.CompileSchedule(cfg.ScheduleRules); err != nil {
+		return fmt.Errorf("invalid schedule_rules: %w", err)
+	}
+
+	// Validate report settings
+	style, err := format.ParseStyle(cfg.Report.DurationStyle)
+	if err != nil {
+		return fmt.Errorf("invalid report.duration_style: %w", err)
+	}
+	cfg.Report.DurationStyle = string(style)
+	if cfg.Report.Language == "" {
+		cfg.Report.Language = format.DefaultLanguage
+	}
+	if cfg.Report.WeekStart == "" {
+		cfg.Report.WeekStart = "monday"
+	}
+	weekStart, err := daterange.ParseWeekday(cfg.Report.WeekStart)
+	if err != nil {
+		return fmt.Errorf("invalid report.week_start: %w", err)
+	}
+	cfg.Report.WeekStart = strings.ToLower(weekStart.String())
+	if cfg.Report.LaunchGap < 0 {
+		return fmt.Errorf("invalid report.launch_gap: %s", cfg.Report.LaunchGap)
+	}
+	if cfg.Report.LaunchGap == 0 {
+		cfg.Report.LaunchGap = stats.DefaultLaunchGap
+	}
 
 	return nil
 }
 
-// expandPath expands ~ to home directory
-func expandPath(path string) (string, error) {
+// ExpandPath expands ~ to the home directory
+func ExpandPath(path string) (string, error) {
 	if len(path) > 0 && path[0] == '~' {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
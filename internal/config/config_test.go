@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -129,4 +130,171 @@ func TestValidateAndSetDefaults(t *testing.T) {
 	if cfg.Logging.Level == "" {
 		t.Error("Expected log level to be set")
 	}
-}
\ No newline at end of file
+}
+func TestReportDurationStyle(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", content: "report: {}\n", want: "long"},
+		{name: "configured", content: "report:\n  duration_style: clock\n", want: "clock"},
+		{name: "unknown", content: "report:\n  duration_style: fancy\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error for an unknown duration style")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if cfg.Report.DurationStyle != tt.want {
+				t.Errorf("Expected duration style %s, got %s", tt.want, cfg.Report.DurationStyle)
+			}
+			if cfg.Report.Language != "en" {
+				t.Errorf("Expected default language en, got %s", cfg.Report.Language)
+			}
+		})
+	}
+}
+
+func TestReportWeekStart(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+		wantErr bool
+	}{
+		{content: "report: {}\n", want: "monday"},
+		{content: "report:\n  week_start: Sun\n", want: "sunday"},
+		{content: "report:\n  week_start: someday\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		cfg, err := Load(configPath)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected an error for %q", tt.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if cfg.Report.WeekStart != tt.want {
+			t.Errorf("Expected week start %s, got %s", tt.want, cfg.Report.WeekStart)
+		}
+	}
+}
+
+func TestRetentionDailyStatsDays(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr bool
+	}{
+		{content: "retention:\n  days: 30\n  daily_stats_days: 365\n"},
+		{content: "retention:\n  days: 30\n  daily_stats_days: 30\n"},
+		{content: "retention:\n  days: 30\n  daily_stats_days: 7\n", wantErr: true},
+		{content: "retention:\n  daily_stats_days: 365\n", wantErr: true},
+		{content: "retention:\n  daily_stats_days: -1\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		_, err := Load(configPath)
+		if tt.wantErr && err == nil {
+			t.Errorf("Expected an error for %q", tt.content)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("Unexpected error for %q: %v", tt.content, err)
+		}
+	}
+}
+
+func TestMonitorIdleSource(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+		wantErr bool
+	}{
+		{content: "monitor: {}\n"},
+		{content: "monitor:\n  idle_source: EvDev\n", want: "evdev"},
+		{content: "monitor:\n  idle_source: auto\n", want: "auto"},
+		{content: "monitor:\n  idle_source: libinput\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		cfg, err := Load(configPath)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected an error for %q", tt.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if cfg.Monitor.IdleSource != tt.want {
+			t.Errorf("Expected idle source %q, got %q", tt.want, cfg.Monitor.IdleSource)
+		}
+	}
+}
+
+func TestMonitorDetectors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{content: "monitor: {}\n"},
+		{content: "monitor:\n  detectors: [Wayland, x11]\n", want: []string{"wayland", "x11"}},
+		{content: "monitor:\n  detectors: [x11, X11]\n", wantErr: true},
+		{content: "monitor:\n  detector_timeout: -1s\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		cfg, err := Load(configPath)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Expected an error for %q", tt.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if !reflect.DeepEqual(cfg.Monitor.Detectors, tt.want) {
+			t.Errorf("Expected detectors %v, got %v", tt.want, cfg.Monitor.Detectors)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package core
+
+import "strings"
+
+// DefaultBrowsers are the process and application names of common web
+// browsers on every platform
+var DefaultBrowsers = []string{
+	"firefox", "firefox.exe", "firefox-esr", "librewolf", "zen", "Tor Browser",
+	"chrome", "chrome.exe", "google-chrome", "Google Chrome",
+	"chromium", "chromium-browser",
+	"msedge", "msedge.exe", "microsoft-edge", "Microsoft Edge",
+	"brave", "brave.exe", "brave-browser", "Brave Browser",
+	"vivaldi", "vivaldi.exe", "vivaldi-stable",
+	"opera", "opera.exe",
+	"Safari", "Arc",
+}
+
+// Browsers is the set of applications whose sessions get the site they
+// show parsed from the window title. Names are matched case-insensitively.
+type Browsers struct {
+	names map[string]bool
+}
+
+// NewBrowsers returns the browsers of the configuration
+func NewBrowsers(cfg *Config) *Browsers {
+	names := make(map[string]bool)
+	for _, name := range cfg.Browsers {
+		if name = strings.TrimSpace(name); name != "" {
+			names[strings.ToLower(name)] = true
+		}
+	}
+	return &Browsers{names: names}
+}
+
+// Contains reports whether app is a browser. A nil set contains nothing.
+func (b *Browsers) Contains(app string) bool {
+	if b == nil {
+		return false
+	}
+	return b.names[strings.ToLower(app)]
+}
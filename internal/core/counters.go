@@ -0,0 +1,94 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Detector calls counted separately when they fail
+const (
+	DetectorCallLock   = "lock"
+	DetectorCallIdle   = "idle"
+	DetectorCallWindow = "window"
+)
+
+// counters are the running totals of a tracker. They are plain atomics so
+// the tick never waits for whoever reads them.
+type counters struct {
+	ticks           atomic.Int64
+	lockErrors      atomic.Int64
+	idleErrors      atomic.Int64
+	windowErrors    atomic.Int64
+	sessionsStarted atomic.Int64
+	sessionsEnded   atomic.Int64
+	lockedPauses    atomic.Int64
+	idlePauses      atomic.Int64
+	suspendPauses   atomic.Int64
+	reconnects      atomic.Int64
+	lastDetectorOK  atomic.Int64 // Unix nanoseconds, 0 before the first call
+}
+
+// TrackerCounters are the totals of a tracker since it was created
+type TrackerCounters struct {
+	Ticks           int64
+	DetectorErrors  map[string]int64 // by DetectorCall kind
+	SessionsStarted int64
+	SessionsEnded   int64
+	Pauses          map[string]int64 // by Gap kind
+	Reconnects      int64            // attempts to reinitialize a failing detector
+	LastDetectorOK  time.Time
+}
+
+// detectorError counts a failed detector call of the given kind
+func (c *counters) detectorError(call string) {
+	switch call {
+	case DetectorCallLock:
+		c.lockErrors.Add(1)
+	case DetectorCallIdle:
+		c.idleErrors.Add(1)
+	case DetectorCallWindow:
+		c.windowErrors.Add(1)
+	}
+}
+
+// detectorOK records a successful detector call
+func (c *counters) detectorOK(now time.Time) {
+	c.lastDetectorOK.Store(now.UnixNano())
+}
+
+// pause counts a gap of the given kind starting
+func (c *counters) pause(kind string) {
+	switch kind {
+	case GapLocked:
+		c.lockedPauses.Add(1)
+	case GapIdle:
+		c.idlePauses.Add(1)
+	case GapSuspended:
+		c.suspendPauses.Add(1)
+	}
+}
+
+// values reads the counters. Each is read atomically, the set as a whole is
+// not, which is fine for totals that only grow.
+func (c *counters) values() TrackerCounters {
+	values := TrackerCounters{
+		Ticks: c.ticks.Load(),
+		DetectorErrors: map[string]int64{
+			DetectorCallLock:   c.lockErrors.Load(),
+			DetectorCallIdle:   c.idleErrors.Load(),
+			DetectorCallWindow: c.windowErrors.Load(),
+		},
+		SessionsStarted: c.sessionsStarted.Load(),
+		SessionsEnded:   c.sessionsEnded.Load(),
+		Pauses: map[string]int64{
+			GapLocked:    c.lockedPauses.Load(),
+			GapIdle:      c.idlePauses.Load(),
+			GapSuspended: c.suspendPauses.Load(),
+		},
+		Reconnects: c.reconnects.Load(),
+	}
+	if ok := c.lastDetectorOK.Load(); ok != 0 {
+		values.LastDetectorOK = time.Unix(0, ok)
+	}
+	return values
+}
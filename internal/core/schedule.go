@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ActionExclude drops matching activity instead of tracking it
+const ActionExclude = "exclude"
+
+// ScheduleRule applies an action to activity of matching apps and titles
+// within a time window on some weekdays. App and Title are regular
+// expressions matched case-insensitively; an empty one matches everything.
+// Days lists weekdays and ranges such as "Mon-Fri" (every day when empty).
+// Between is a local time window such as "09:00-18:00" (all day when
+// empty); a window ending before it starts runs over midnight and belongs
+// to the day it starts on.
+type ScheduleRule struct {
+	App     string   `yaml:"app"`
+	Title   string   `yaml:"title"`
+	Days    []string `yaml:"days"`
+	Between string   `yaml:"between"`
+	Action  string   `yaml:"action"`
+}
+
+// Schedule holds compiled schedule rules
+type Schedule struct {
+	rules []scheduleRule
+}
+
+type scheduleRule struct {
+	app    *regexp.Regexp
+	title  *regexp.Regexp
+	days   [7]bool
+	start  time.Duration // offset from midnight
+	end    time.Duration
+	action string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// CompileSchedule validates and compiles schedule rules
+func CompileSchedule(rules []ScheduleRule) (*Schedule, error) {
+	s := &Schedule{}
+	for i, rule := range rules {
+		compiled, err := compileScheduleRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+		}
+		s.rules = append(s.rules, compiled)
+	}
+	return s, nil
+}
+
+func compileScheduleRule(rule ScheduleRule) (scheduleRule, error) {
+	compiled := scheduleRule{action: rule.Action}
+
+	switch {
+	case rule.Action == ActionExclude:
+	case strings.HasPrefix(rule.Action, "categorize:"):
+		return compiled, fmt.Errorf("action %q is not supported, there are no categories", rule.Action)
+	default:
+		return compiled, fmt.Errorf("unknown action %q (expected exclude)", rule.Action)
+	}
+
+	var err error
+	if compiled.app, err = regexp.Compile("(?i)" + rule.App); err != nil {
+		return compiled, fmt.Errorf("invalid app pattern: %w", err)
+	}
+	if compiled.title, err = regexp.Compile("(?i)" + rule.Title); err != nil {
+		return compiled, fmt.Errorf("invalid title pattern: %w", err)
+	}
+
+	if len(rule.Days) == 0 {
+		compiled.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, days := range rule.Days {
+		first, last, isRange := strings.Cut(days, "-")
+		from, ok := weekdays[strings.ToLower(strings.TrimSpace(first))]
+		if !ok {
+			return compiled, fmt.Errorf("invalid day %q", days)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[strings.ToLower(strings.TrimSpace(last))]; !ok {
+				return compiled, fmt.Errorf("invalid day %q", days)
+			}
+		}
+		// Ranges may wrap around the week, e.g. "Fri-Mon"
+		for d := from; ; d = (d + 1) % 7 {
+			compiled.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+
+	compiled.end = 24 * time.Hour
+	if rule.Between != "" {
+		start, end, ok := strings.Cut(rule.Between, "-")
+		if !ok {
+			return compiled, fmt.Errorf("invalid time window %q (expected HH:MM-HH:MM)", rule.Between)
+		}
+		if compiled.start, err = parseClock(start); err != nil {
+			return compiled, err
+		}
+		if compiled.end, err = parseClock(end); err != nil {
+			return compiled, err
+		}
+		if compiled.start == compiled.end {
+			return compiled, fmt.Errorf("empty time window %q", rule.Between)
+		}
+	}
+
+	return compiled, nil
+}
+
+// parseClock parses "HH:MM" into an offset from midnight; "24:00" is the end of the day
+func parseClock(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Action returns the action of the first rule matching the app and title
+// at the given time, or "" when no rule matches. A nil Schedule matches
+// nothing.
+func (s *Schedule) Action(app, title string, at time.Time) string {
+	if s == nil {
+		return ""
+	}
+	for _, rule := range s.rules {
+		if rule.matches(app, title, at) {
+			return rule.action
+		}
+	}
+	return ""
+}
+
+func (r *scheduleRule) matches(app, title string, at time.Time) bool {
+	if !r.app.MatchString(app) || !r.title.MatchString(title) {
+		return false
+	}
+
+	// Wall clock time, so days with a DST change keep their windows
+	offset := time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute +
+		time.Duration(at.Second())*time.Second
+
+	if r.start < r.end {
+		return r.days[at.Weekday()] && offset >= r.start && offset < r.end
+	}
+
+	// The window runs over midnight: the evening part belongs to today, the
+	// early morning part to the day before
+	if offset >= r.start {
+		return r.days[at.Weekday()]
+	}
+	return offset < r.end && r.days[(at.Weekday()+6)%7]
+}
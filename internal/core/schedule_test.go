@@ -0,0 +1,90 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a local time in the week of Monday 2026-01-05
+func at(weekday time.Weekday, hour, minute int) time.Time {
+	monday := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	offset := (int(weekday) + 6) % 7
+	return monday.AddDate(0, 0, offset).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func TestScheduleAction(t *testing.T) {
+	rules := []ScheduleRule{
+		{App: "^steam$", Days: []string{"Mon-Fri"}, Between: "09:00-18:00", Action: ActionExclude},
+		{App: "^steam$", Days: []string{"Fri"}, Between: "22:00-02:00", Action: ActionExclude},
+		{App: "^browser$", Title: "youtube", Days: []string{"mon", "Wednesday"}, Action: ActionExclude},
+		{App: "^browser$", Title: "youtube music", Between: "12:00-13:00", Action: ActionExclude},
+	}
+	schedule, err := CompileSchedule(rules)
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		app   string
+		title string
+		at    time.Time
+		want  string
+	}{
+		{"weekday work hours", "steam", "", at(time.Tuesday, 10, 0), ActionExclude},
+		{"app matched case-insensitively", "Steam", "", at(time.Tuesday, 10, 0), ActionExclude},
+		{"window start is inclusive", "steam", "", at(time.Monday, 9, 0), ActionExclude},
+		{"window end is exclusive", "steam", "", at(time.Monday, 18, 0), ""},
+		{"weekday evening", "steam", "", at(time.Wednesday, 20, 0), ""},
+		{"weekend", "steam", "", at(time.Saturday, 10, 0), ""},
+		{"other app", "editor", "", at(time.Tuesday, 10, 0), ""},
+		{"overnight window on its day", "steam", "", at(time.Friday, 23, 0), ActionExclude},
+		{"overnight window after midnight", "steam", "", at(time.Saturday, 1, 30), ActionExclude},
+		{"overnight window ends", "steam", "", at(time.Saturday, 2, 0), ""},
+		{"early morning of the window day", "steam", "", at(time.Friday, 1, 0), ""},
+		{"title rule on listed day", "browser", "YouTube - Home", at(time.Wednesday, 15, 0), ActionExclude},
+		{"title rule on other day", "browser", "YouTube - Home", at(time.Tuesday, 15, 0), ""},
+		{"overlapping rule adds a window", "browser", "YouTube Music", at(time.Tuesday, 12, 30), ActionExclude},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.Action(tt.app, tt.title, tt.at); got != tt.want {
+				t.Errorf("Action(%q, %q, %s) = %q, expected %q",
+					tt.app, tt.title, tt.at.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleWeekRangeWraps(t *testing.T) {
+	schedule, err := CompileSchedule([]ScheduleRule{{Days: []string{"Sat-Sun", "Fri-Fri"}, Action: ActionExclude}})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		want := day == time.Friday || day == time.Saturday || day == time.Sunday
+		if got := schedule.Action("any", "", at(day, 12, 0)) == ActionExclude; got != want {
+			t.Errorf("%s: expected excluded=%v", day, want)
+		}
+	}
+}
+
+func TestCompileScheduleErrors(t *testing.T) {
+	tests := []ScheduleRule{
+		{Action: "drop"},
+		{Action: "categorize:personal"},
+		{App: "(", Action: ActionExclude},
+		{Days: []string{"Funday"}, Action: ActionExclude},
+		{Between: "09:00", Action: ActionExclude},
+		{Between: "9am-5pm", Action: ActionExclude},
+		{Between: "09:00-09:00", Action: ActionExclude},
+	}
+
+	for _, rule := range tests {
+		if _, err := CompileSchedule([]ScheduleRule{rule}); err == nil {
+			t.Errorf("Expected an error for %+v", rule)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// ShellApps is the set of desktop-shell processes the tracker ignores:
+// the taskbar, the desktop, launchers and actimed itself. Their windows
+// are window-manager noise rather than usage. Names are matched
+// case-insensitively.
+type ShellApps struct {
+	names map[string]bool
+}
+
+// DefaultShellApps returns the built-in shell processes of this platform
+func DefaultShellApps() []string {
+	return append([]string{}, defaultShellApps...)
+}
+
+// NewShellApps returns the built-in shell processes with the configured
+// names added and the allowed ones removed, or nil when shell processes are
+// tracked
+func NewShellApps(cfg *Config) *ShellApps {
+	if cfg.Shell.Track {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	for _, name := range defaultShellApps {
+		names[strings.ToLower(name)] = true
+	}
+	for _, name := range cfg.Shell.Ignore {
+		names[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	for _, name := range cfg.Shell.Allow {
+		delete(names, strings.ToLower(strings.TrimSpace(name)))
+	}
+	delete(names, "")
+
+	return &ShellApps{names: names}
+}
+
+// Contains reports whether app is a shell process. A nil set contains nothing.
+func (s *ShellApps) Contains(app string) bool {
+	if s == nil {
+		return false
+	}
+	return s.names[strings.ToLower(app)]
+}
+
+// Names returns the shell processes in alphabetical order
+func (s *ShellApps) Names() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
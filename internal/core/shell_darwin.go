@@ -0,0 +1,15 @@
+package core
+
+// defaultShellApps are the application names of the macOS shell. Finder is
+// among them since the desktop is its window; shell.allow tracks it again.
+var defaultShellApps = []string{
+	"actimed",
+	"Finder",
+	"Dock",
+	"loginwindow",
+	"ScreenSaverEngine",
+	"SystemUIServer",
+	"Control Center",
+	"Notification Center",
+	"Spotlight",
+}
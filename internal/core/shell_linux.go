@@ -0,0 +1,15 @@
+package core
+
+// defaultShellApps are the WM_CLASS names of common desktop shells
+var defaultShellApps = []string{
+	"actimed",
+	"gnome-shell",
+	"plasmashell",
+	"xfdesktop",
+	"xfce4-panel",
+	"lxpanel",
+	"lxqt-panel",
+	"mate-panel",
+	"cinnamon",
+	"budgie-panel",
+}
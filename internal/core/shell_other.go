@@ -0,0 +1,8 @@
+//go:build !linux && !windows && !darwin
+
+package core
+
+// defaultShellApps lists only the daemon on platforms without a detector
+var defaultShellApps = []string{
+	"actimed",
+}
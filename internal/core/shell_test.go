@@ -0,0 +1,61 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellAppsDefaults(t *testing.T) {
+	shell := NewShellApps(&Config{})
+
+	defaults := DefaultShellApps()
+	if len(defaults) == 0 {
+		t.Fatal("Expected built-in shell processes")
+	}
+	for _, name := range defaults {
+		if !shell.Contains(name) || !shell.Contains(strings.ToUpper(name)) {
+			t.Errorf("Expected %s to be a shell process in any case", name)
+		}
+	}
+	if shell.Contains("firefox") {
+		t.Error("Expected firefox not to be a shell process")
+	}
+
+	// The daemon never tracks itself
+	self := false
+	for _, name := range defaults {
+		self = self || strings.HasPrefix(name, "actimed")
+	}
+	if !self {
+		t.Errorf("Expected actimed among the defaults, got %v", defaults)
+	}
+}
+
+func TestShellAppsConfig(t *testing.T) {
+	defaults := DefaultShellApps()
+	allowed := defaults[len(defaults)-1]
+
+	cfg := &Config{}
+	cfg.Shell.Ignore = []string{" Conky "}
+	cfg.Shell.Allow = []string{strings.ToUpper(allowed)}
+	shell := NewShellApps(cfg)
+
+	if !shell.Contains("conky") {
+		t.Error("Expected a configured name to be added")
+	}
+	if shell.Contains(allowed) {
+		t.Errorf("Expected %s to be allowed back in", allowed)
+	}
+	if len(defaults) > 1 && !shell.Contains(defaults[0]) {
+		t.Errorf("Expected %s to stay a shell process", defaults[0])
+	}
+	if got := len(shell.Names()); got != len(defaults) {
+		t.Errorf("Expected %d names, got %d", len(defaults), got)
+	}
+
+	// Tracking shell processes turns the list off
+	cfg.Shell.Track = true
+	if shell := NewShellApps(cfg); shell.Contains(defaults[0]) || shell.Names() != nil {
+		t.Error("Expected no shell processes when they are tracked")
+	}
+}
@@ -0,0 +1,13 @@
+package core
+
+// defaultShellApps are the executables of the Windows shell
+var defaultShellApps = []string{
+	"actimed.exe",
+	"explorer.exe",
+	"ShellExperienceHost.exe",
+	"StartMenuExperienceHost.exe",
+	"SearchHost.exe",
+	"SearchApp.exe",
+	"LockApp.exe",
+	"TextInputHost.exe",
+}
@@ -5,10 +5,37 @@ import (
 	"sync"
 	"time"
 
+	"github.com/weii/actime/internal/appname"
 	"github.com/weii/actime/internal/platform"
+	"github.com/weii/actime/internal/title"
 	"github.com/weii/actime/pkg/logger"
 )
 
+// DefaultMaxSessionDuration is the longest a session may run. Nobody
+// focuses one window for longer; a session reaching it usually means the
+// detector is stuck returning the same window.
+const DefaultMaxSessionDuration = 12 * time.Hour
+
+// detectorFailureThreshold is the number of ticks in a row the detector may
+// fail before the tracker takes it as gone, as when the X server restarts
+// or a remote session disconnects
+const detectorFailureThreshold = 5
+
+// The delays between attempts to reinitialize a detector that is gone,
+// doubling from the first to the last
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+// A clock jumping by more than suspendTicks check intervals, and at least
+// minSuspendGap, between two ticks means the system was suspended. Shorter
+// stalls, such as a detector call timing out, are not taken for one.
+const (
+	suspendTicks  = 10
+	minSuspendGap = time.Minute
+)
+
 // Tracker tracks application usage
 type Tracker struct {
 	config          *Config
@@ -20,10 +47,46 @@ type Tracker struct {
 	stopChan        chan struct{}
 	checkInterval   time.Duration
 	activityWindow  time.Duration
+	counters        counters
+	titles          *title.Normalizer
+	apps            *appname.Mapper
+	schedule        *Schedule
+	shell           *ShellApps
+	browsers        *Browsers
+	maxSession      time.Duration
+	gap             *Gap
+	gaps            []Gap
+	failures        int           // ticks in a row the detector failed
+	reconnectDelay  time.Duration // zero while the detector answers
+	reconnectAt     time.Time
+	lastTick        time.Time // guarded by sessionMutex, like the fields below
+	sleeping        bool      // logind announced a suspend that has not ended
+	sleepStart      time.Time
+	resumedAt       time.Time // no gap starts before the system last resumed
+	watchSleep      func(handler func(sleeping bool)) (stop func(), err error)
+	stopSleep       func()
+	now             func() time.Time
 }
 
 // NewTracker creates a new tracker
 func NewTracker(cfg *Config, detector platform.Detector) *Tracker {
+	// The rules are validated when the config is loaded
+	titles, err := title.Compile(cfg.TitleNormalize)
+	if err != nil {
+		logger.GetLogger().Error("Ignoring invalid title rules", "error", err)
+		titles = nil
+	}
+	apps, err := appname.NewMapper(cfg.AppMapping)
+	if err != nil {
+		logger.GetLogger().Error("Ignoring invalid app mapping rules", "error", err)
+		apps = nil
+	}
+	schedule, err := CompileSchedule(cfg.ScheduleRules)
+	if err != nil {
+		logger.GetLogger().Error("Ignoring invalid schedule rules", "error", err)
+		schedule = nil
+	}
+
 	return &Tracker{
 		config:         cfg,
 		detector:       detector,
@@ -31,6 +94,25 @@ func NewTracker(cfg *Config, detector platform.Detector) *Tracker {
 		checkInterval:  cfg.Monitor.CheckInterval,
 		activityWindow: cfg.Monitor.ActivityWindow,
 		stopChan:       make(chan struct{}),
+		titles:         titles,
+		apps:           apps,
+		schedule:       schedule,
+		shell:          NewShellApps(cfg),
+		browsers:       NewBrowsers(cfg),
+		maxSession:     cfg.Monitor.MaxSessionDuration,
+		watchSleep:     platform.WatchSleep,
+		now:            time.Now,
+	}
+}
+
+// UseClock makes the tracker take the time from now instead of the system
+// clock, as when replaying a script faster than real time. System sleep is
+// not watched then, since it has nothing to do with that clock. Call it
+// before Start.
+func (t *Tracker) UseClock(now func() time.Time) {
+	t.now = now
+	t.watchSleep = func(func(bool)) (func(), error) {
+		return nil, fmt.Errorf("tracker runs on its own clock")
 	}
 }
 
@@ -45,6 +127,13 @@ func (t *Tracker) Start() error {
 
 	t.running = true
 
+	// Without sleep notifications a suspend is still noticed by the clock
+	if stop, err := t.watchSleep(t.sleepChanged); err == nil {
+		t.stopSleep = stop
+	} else {
+		log.Debug("Not watching for system sleep", "error", err)
+	}
+
 	// Start tracking loop
 	go t.trackLoop()
 
@@ -62,11 +151,17 @@ func (t *Tracker) Stop() error {
 
 	t.running = false
 	close(t.stopChan)
+	if t.stopSleep != nil {
+		t.stopSleep()
+		t.stopSleep = nil
+	}
 
-	// Finalize current session
+	// Finalize current session and gap
 	t.sessionMutex.Lock()
+	t.endGap(t.now())
 	if t.session != nil {
-		t.session.EndTime = time.Now()
+		t.session.EndTime = t.now()
+		t.counters.sessionsEnded.Add(1)
 		log.Info("Finalizing session",
 			"app", t.session.AppName,
 			"duration", t.session.DurationSeconds)
@@ -88,21 +183,88 @@ func (t *Tracker) trackLoop() {
 			return
 		case <-ticker.C:
 			t.tick()
+		case event := <-t.events():
+			t.refresh(event)
 		}
 	}
 }
 
+// events returns the detector's notifications, or nil when it sends none;
+// a nil channel never receives, so the tracker then polls only
+func (t *Tracker) events() <-chan platform.WindowEvent {
+	if source, ok := t.detector.(platform.EventSource); ok {
+		return source.Events()
+	}
+	return nil
+}
+
+// refresh acts on a notification between ticks: a lock pauses tracking and
+// a switch of window starts the new session right away, so switches
+// shorter than the check interval are not missed. Time is still counted by
+// the ticks only, and the ticks check everything else, such as the idle
+// time and title changes; a failing call is left to them too.
+func (t *Tracker) refresh(event platform.WindowEvent) {
+	t.sessionMutex.RLock()
+	sleeping := t.sleeping
+	t.sessionMutex.RUnlock()
+	if sleeping || t.failures > 0 || !t.timer.IsActive() {
+		return
+	}
+
+	log := logger.GetLogger()
+	locked, err := t.detector.IsScreenLocked()
+	if err != nil {
+		log.Debug("Failed to check screen lock status after a notification", "error", err)
+		return
+	}
+	if locked {
+		log.Debug("Screen was locked, pausing tracking")
+		now := t.now()
+		t.beginGap(GapLocked, now, now)
+		t.pauseSession()
+		return
+	}
+	if event.Kind != platform.WindowEventForeground {
+		return
+	}
+
+	window, err := t.detector.GetActiveWindow()
+	if err != nil {
+		log.Debug("Failed to get active window after a notification", "error", err)
+		return
+	}
+	t.observeWindow(window, false)
+}
+
 // tick performs a single tracking check
 func (t *Tracker) tick() {
+	t.counters.ticks.Add(1)
+
+	// Nothing is tracked while the system is going to sleep
+	if !t.checkSuspend(t.now()) {
+		return
+	}
+
+	// A detector that is gone is only asked again once it is reinitialized
+	if t.failures >= detectorFailureThreshold {
+		if now := t.now(); now.Before(t.reconnectAt) || !t.reconnect(now) {
+			return
+		}
+	}
+
 	// Check if screen is locked
 	locked, err := t.detector.IsScreenLocked()
 	if err != nil {
-		logger.GetLogger().Error("Failed to check screen lock status", "error", err)
+		t.detectorFailed(DetectorCallLock, "Failed to check screen lock status", err)
 		return
 	}
+	t.counters.detectorOK(t.now())
 
 	if locked {
 		logger.GetLogger().Debug("Screen is locked, pausing tracking")
+		t.detectorRecovered()
+		now := t.now()
+		t.beginGap(GapLocked, now, now)
 		t.pauseSession()
 		return
 	}
@@ -110,16 +272,26 @@ func (t *Tracker) tick() {
 	// Get idle time
 	idleTime, err := t.detector.GetIdleTime()
 	if err != nil {
-		logger.GetLogger().Error("Failed to get idle time", "error", err)
+		t.detectorFailed(DetectorCallIdle, "Failed to get idle time", err)
 		return
 	}
 
 	// Update timer
 	t.timer.Update(idleTime)
 
+	// Watching a video or presenting counts as activity when asked for
+	if !t.timer.IsActive() && t.mediaPlaying() {
+		logger.GetLogger().Debug("Idle but media is playing, still tracking", "idle_time", idleTime)
+		t.timer.Update(0)
+	}
+
 	// Check if system is active
 	if !t.timer.IsActive() {
 		logger.GetLogger().Debug("System is idle, pausing tracking", "idle_time", idleTime)
+		t.detectorRecovered()
+		// The user has been away since the last input
+		now := t.now()
+		t.beginGap(GapIdle, now.Add(-idleTime), now)
 		t.pauseSession()
 		return
 	}
@@ -127,67 +299,314 @@ func (t *Tracker) tick() {
 	// Get active window
 	window, err := t.detector.GetActiveWindow()
 	if err != nil {
-		logger.GetLogger().Error("Failed to get active window", "error", err)
+		t.detectorFailed(DetectorCallWindow, "Failed to get active window", err)
 		return
 	}
+	t.counters.detectorOK(t.now())
+	t.detectorRecovered()
 
 	// Update session
 	t.updateSession(window)
 }
 
-// updateSession updates the current session based on the active window
+// mediaPlaying reports whether monitor.count_media_as_active is set and the
+// detector sees a fullscreen window or media playing. A detector that
+// cannot tell, or fails to, sees none.
+func (t *Tracker) mediaPlaying() bool {
+	if !t.config.Monitor.CountMediaAsActive {
+		return false
+	}
+	reporter, ok := t.detector.(platform.MediaReporter)
+	if !ok {
+		return false
+	}
+	playing, err := reporter.IsMediaPlaying()
+	if err != nil {
+		logger.GetLogger().Debug("Failed to check for media playing", "error", err)
+		return false
+	}
+	return playing
+}
+
+// detectorFailed counts a failed detector call and logs it. After
+// detectorFailureThreshold failing ticks in a row the detector is taken as
+// gone: a single warning is logged, the current session ends so the dead
+// time is not given to the last app, and the detector is reinitialized
+// with a growing delay between attempts.
+func (t *Tracker) detectorFailed(call, message string, err error) {
+	t.counters.detectorError(call)
+	log := logger.GetLogger()
+
+	// Still failing after being reinitialized: try again later
+	if t.reconnectDelay > 0 {
+		log.Debug(message, "error", err)
+		t.failures = detectorFailureThreshold
+		t.reconnectAt = t.now().Add(t.reconnectDelay)
+		return
+	}
+
+	t.failures++
+	if t.failures < detectorFailureThreshold {
+		log.Error(message, "error", err)
+		return
+	}
+	log.Warn("Detector keeps failing, pausing tracking until it can be reinitialized",
+		"failures", t.failures, "error", err)
+	t.pauseSession()
+	t.reconnectDelay = minReconnectDelay
+	t.reconnectAt = t.now().Add(t.reconnectDelay)
+}
+
+// reconnect closes and reinitializes a detector that is gone and reports
+// whether that worked. The delay before the next attempt doubles either
+// way, until the detector answers a whole tick again.
+func (t *Tracker) reconnect(now time.Time) bool {
+	t.counters.reconnects.Add(1)
+	t.detector.Close()
+	err := t.detector.Initialize()
+	t.reconnectDelay = min(2*t.reconnectDelay, maxReconnectDelay)
+	if err != nil {
+		logger.GetLogger().Debug("Failed to reinitialize detector", "error", err, "retry_in", t.reconnectDelay)
+		t.reconnectAt = now.Add(t.reconnectDelay)
+		return false
+	}
+	t.failures = 0
+	return true
+}
+
+// detectorRecovered clears the failures once the detector answered a tick
+func (t *Tracker) detectorRecovered() {
+	if t.reconnectDelay > 0 {
+		logger.GetLogger().Info("Detector recovered, resuming tracking")
+	}
+	t.failures = 0
+	t.reconnectDelay = 0
+}
+
+// updateSession updates the current session based on the active window,
+// counting the tick's second for a session that continues
 func (t *Tracker) updateSession(window *platform.WindowInfo) {
+	t.observeWindow(window, true)
+}
+
+// observeWindow ends and starts sessions as the active window changes. A
+// tick counts a second for the session that continues; a notification
+// between ticks does not.
+func (t *Tracker) observeWindow(window *platform.WindowInfo, tick bool) {
 	t.sessionMutex.Lock()
 	defer t.sessionMutex.Unlock()
 
-	now := time.Now()
+	now := t.now()
+	t.endGap(now)
+
+	// Compare and store the canonical app name and the normalized title so
+	// aliases and counters in titles do not split the session. Detectors
+	// clean titles already; cleaning again keeps junk out of the database
+	// whatever the detector.
+	appName := t.apps.CanonicalWindow(window.AppName, window.ExePath, window.WMClassKey())
+	cleanTitle := platform.CleanTitle(window.WindowTitle)
+	windowTitle := t.titles.Normalize(appName, cleanTitle)
+
+	// Shell and excluded activity, and no window having the focus at all,
+	// ends the current session and is not tracked
+	shell := window == platform.NoWindow || t.shell.Contains(window.AppName) || t.shell.Contains(appName)
+	if shell || t.schedule.Action(appName, windowTitle, now) == ActionExclude {
+		if t.session != nil {
+			t.session.EndTime = now
+			t.counters.sessionsEnded.Add(1)
+			logger.GetLogger().Info("Ended session",
+				"app", t.session.AppName,
+				"duration", t.session.DurationSeconds)
+			t.session = nil
+		}
+		if shell {
+			logger.GetLogger().Debug("Ignored desktop shell activity", "app", appName)
+		} else {
+			logger.GetLogger().Debug("Activity excluded by schedule rule", "app", appName)
+		}
+		return
+	}
+	rawTitle := ""
+	if t.config.Monitor.KeepRawTitle {
+		rawTitle = cleanTitle
+	}
+	// The site is read from the title as the browser shows it, before
+	// normalization rules rewrite it
+	domain := ""
+	if t.browsers.Contains(appName) || t.browsers.Contains(window.AppName) {
+		domain = title.Site(cleanTitle)
+	}
 
 	// Check if we need to start a new session
 	if t.session == nil {
 		// Start new session
 		t.session = &Session{
-			AppName:     window.AppName,
-			WindowTitle: window.WindowTitle,
-			StartTime:   now,
-			EndTime:     now,
+			AppName:      appName,
+			WindowTitle:  windowTitle,
+			RawTitle:     rawTitle,
+			Domain:       domain,
+			ExePath:      window.ExePath,
+			MonitorIndex: window.MonitorIndex,
+			Workspace:    window.Workspace,
+			StartTime:    now,
+			EndTime:      now,
 		}
+		t.counters.sessionsStarted.Add(1)
 		logger.GetLogger().Info("Started new session",
-			"app", window.AppName,
-			"title", window.WindowTitle)
+			"app", appName,
+			"title", windowTitle)
 	} else {
-		// Check if window changed
-		if t.session.AppName != window.AppName || t.session.WindowTitle != window.WindowTitle {
+		// Check if window changed. A window of the same app without a
+		// title, such as a menu or a dialog still loading, continues the
+		// session. Another executable of the same name is another app,
+		// and a window moved to another monitor or workspace is somewhere
+		// else.
+		exeChanged := t.session.ExePath != "" && window.ExePath != "" && t.session.ExePath != window.ExePath
+		moved := placeChanged(t.session.MonitorIndex, window.MonitorIndex) || placeChanged(t.session.Workspace, window.Workspace)
+		if t.session.AppName != appName || exeChanged || moved || (t.session.WindowTitle != windowTitle && windowTitle != "") {
 			// Finalize current session
 			t.session.EndTime = now
+			t.counters.sessionsEnded.Add(1)
 			logger.GetLogger().Info("Ended session",
 				"app", t.session.AppName,
 				"duration", t.session.DurationSeconds)
 
 			// Start new session
 			t.session = &Session{
-				AppName:     window.AppName,
-				WindowTitle: window.WindowTitle,
-				StartTime:   now,
-				EndTime:     now,
+				AppName:      appName,
+				WindowTitle:  windowTitle,
+				RawTitle:     rawTitle,
+				Domain:       domain,
+				ExePath:      window.ExePath,
+				MonitorIndex: window.MonitorIndex,
+				Workspace:    window.Workspace,
+				StartTime:    now,
+				EndTime:      now,
 			}
+			t.counters.sessionsStarted.Add(1)
 			logger.GetLogger().Info("Started new session",
-				"app", window.AppName,
-				"title", window.WindowTitle)
-		} else {
+				"app", appName,
+				"title", windowTitle)
+		} else if tick {
 			// Update existing session
 			t.session.EndTime = now
 			t.session.DurationSeconds++
+
+			// Roll a runaway session over instead of letting it grow
+			if t.maxSession > 0 && time.Duration(t.session.DurationSeconds)*time.Second >= t.maxSession {
+				logger.GetLogger().Warn("Session reached the maximum duration, starting a new one",
+					"app", t.session.AppName,
+					"duration", t.session.DurationSeconds,
+					"max", t.maxSession)
+				t.session = &Session{
+					AppName:      t.session.AppName,
+					WindowTitle:  t.session.WindowTitle,
+					RawTitle:     t.session.RawTitle,
+					Domain:       t.session.Domain,
+					ExePath:      t.session.ExePath,
+					MonitorIndex: t.session.MonitorIndex,
+					Workspace:    t.session.Workspace,
+					StartTime:    now,
+					EndTime:      now,
+				}
+				t.counters.sessionsEnded.Add(1)
+				t.counters.sessionsStarted.Add(1)
+			}
 		}
 	}
 }
 
+// checkSuspend notices a suspend by the clock jumping since the last tick:
+// the session then ended at the last tick and the time in between is a
+// suspended gap. It returns false while logind says the system is going to
+// sleep.
+func (t *Tracker) checkSuspend(now time.Time) bool {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	if t.sleeping {
+		return false
+	}
+
+	last := t.lastTick
+	t.lastTick = now
+	if last.IsZero() {
+		return true
+	}
+	// Monotonic clock readings stop while the system is suspended, so the
+	// wall clock is compared
+	if now.Round(0).Sub(last.Round(0)) < max(suspendTicks*t.checkInterval, minSuspendGap) {
+		return true
+	}
+
+	logger.GetLogger().Info("System was suspended", "since", last, "resumed", now)
+	t.suspend(last)
+	t.resume(last, now)
+	return true
+}
+
+// sleepChanged follows logind announcing a suspend and the resume after it
+func (t *Tracker) sleepChanged(sleeping bool) {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	now := t.now()
+	if sleeping {
+		if t.sleeping {
+			return
+		}
+		logger.GetLogger().Info("System is going to sleep")
+		t.sleeping = true
+		t.sleepStart = now
+		t.suspend(now)
+		return
+	}
+
+	if !t.sleeping {
+		return
+	}
+	logger.GetLogger().Info("System resumed", "asleep", now.Round(0).Sub(t.sleepStart.Round(0)))
+	t.sleeping = false
+	t.resume(t.sleepStart, now)
+}
+
+// suspend ends the current session and gap when the system went to sleep
+// at start. The caller holds sessionMutex.
+func (t *Tracker) suspend(start time.Time) {
+	t.endGap(start)
+	if t.session != nil {
+		t.session.EndTime = start
+		t.counters.sessionsEnded.Add(1)
+		logger.GetLogger().Info("Ended session for suspend",
+			"app", t.session.AppName,
+			"duration", t.session.DurationSeconds)
+		t.session = nil
+	}
+}
+
+// resume records the suspended gap from start to end, after which the next
+// tick starts afresh. The caller holds sessionMutex.
+func (t *Tracker) resume(start, end time.Time) {
+	t.gaps = append(t.gaps, Gap{Kind: GapSuspended, Start: start, End: end})
+	t.counters.pause(GapSuspended)
+	t.lastTick = end
+	t.resumedAt = end
+}
+
+// placeChanged reports whether a monitor or workspace known both before
+// and after differs
+func placeChanged(before, after *int) bool {
+	return before != nil && after != nil && *before != *after
+}
+
 // pauseSession pauses the current session
 func (t *Tracker) pauseSession() {
 	t.sessionMutex.Lock()
 	defer t.sessionMutex.Unlock()
 
 	if t.session != nil {
-		t.session.EndTime = time.Now()
+		t.session.EndTime = t.now()
+		t.counters.sessionsEnded.Add(1)
 		logger.GetLogger().Info("Paused session",
 			"app", t.session.AppName,
 			"duration", t.session.DurationSeconds)
@@ -195,6 +614,48 @@ func (t *Tracker) pauseSession() {
 	}
 }
 
+// beginGap opens a gap of the given kind unless one is already open. A gap
+// of another kind is closed first and the new one starts at now. The idle
+// time after a resume includes the suspend, so no gap starts before it.
+func (t *Tracker) beginGap(kind string, start, now time.Time) {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	if start.Before(t.resumedAt) {
+		start = t.resumedAt
+	}
+
+	if t.gap != nil {
+		if t.gap.Kind == kind {
+			return
+		}
+		t.endGap(now)
+		start = now
+	}
+	t.gap = &Gap{Kind: kind, Start: start}
+	t.counters.pause(kind)
+}
+
+// endGap closes the open gap, if any. The caller holds sessionMutex.
+func (t *Tracker) endGap(now time.Time) {
+	if t.gap == nil {
+		return
+	}
+	t.gap.End = now
+	t.gaps = append(t.gaps, *t.gap)
+	t.gap = nil
+}
+
+// TakeGaps returns the gaps closed since the last call
+func (t *Tracker) TakeGaps() []Gap {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	gaps := t.gaps
+	t.gaps = nil
+	return gaps
+}
+
 // GetCurrentSession returns the current session (if any)
 func (t *Tracker) GetCurrentSession() *Session {
 	t.sessionMutex.RLock()
@@ -212,4 +673,18 @@ func (t *Tracker) GetCurrentSession() *Session {
 // IsRunning returns true if the tracker is running
 func (t *Tracker) IsRunning() bool {
 	return t.running
-}
\ No newline at end of file
+}
+
+// DetectorErrors returns the number of failed detector calls since start
+func (t *Tracker) DetectorErrors() int64 {
+	var total int64
+	for _, n := range t.counters.values().DetectorErrors {
+		total += n
+	}
+	return total
+}
+
+// Counters returns the tracker's totals since it was created
+func (t *Tracker) Counters() TrackerCounters {
+	return t.counters.values()
+}
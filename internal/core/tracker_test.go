@@ -0,0 +1,672 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/platform"
+	"github.com/weii/actime/internal/title"
+)
+
+func newTestTracker(keepRawTitle bool) *Tracker {
+	cfg := &Config{TitleNormalize: title.DefaultRules}
+	cfg.Monitor.CheckInterval = time.Second
+	cfg.Monitor.ActivityWindow = 5 * time.Minute
+	cfg.Monitor.KeepRawTitle = keepRawTitle
+	return NewTracker(cfg, nil)
+}
+
+func TestUpdateSessionCollapsesUnreadCounters(t *testing.T) {
+	tracker := newTestTracker(false)
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "firefox", WindowTitle: "(3) Inbox"})
+	first := tracker.GetCurrentSession()
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "firefox", WindowTitle: "(7) Inbox"})
+	second := tracker.GetCurrentSession()
+
+	if !second.StartTime.Equal(first.StartTime) {
+		t.Error("Expected the session to continue when only the unread count changed")
+	}
+	if second.DurationSeconds != 1 {
+		t.Errorf("Expected the continuing session to count 1s, got %d", second.DurationSeconds)
+	}
+	if second.WindowTitle != "Inbox" {
+		t.Errorf("Expected the normalized title to be stored, got %q", second.WindowTitle)
+	}
+	if second.RawTitle != "" {
+		t.Errorf("Expected no raw title without keep_raw_title, got %q", second.RawTitle)
+	}
+}
+
+func TestUpdateSessionSplitsOnRealTitleChange(t *testing.T) {
+	tracker := newTestTracker(false)
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "firefox", WindowTitle: "(3) Inbox"})
+	tracker.updateSession(&platform.WindowInfo{AppName: "firefox", WindowTitle: "(3) Sent"})
+
+	session := tracker.GetCurrentSession()
+	if session.WindowTitle != "Sent" || session.DurationSeconds != 0 {
+		t.Errorf("Expected a new session for a different title, got %+v", session)
+	}
+}
+
+func TestUpdateSessionIgnoresInvisibleTitleChanges(t *testing.T) {
+	tracker := newTestTracker(false)
+
+	// Refreshes of one title alternating between NFD, NFC and a stray
+	// zero-width space
+	refreshes := []string{"Re\u0301sume\u0301 - Editor", "R\u00e9sum\u00e9 - Editor", "R\u00e9sum\u00e9\u200b - Editor"}
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: refreshes[0]})
+	first := tracker.GetCurrentSession()
+	for _, refresh := range refreshes[1:] {
+		tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: refresh})
+	}
+
+	session := tracker.GetCurrentSession()
+	if !session.StartTime.Equal(first.StartTime) || session.DurationSeconds != 2 {
+		t.Errorf("Expected one continuing session, got %+v", session)
+	}
+	if session.WindowTitle != "R\u00e9sum\u00e9 - Editor" {
+		t.Errorf("Expected the NFC title to be stored, got %q", session.WindowTitle)
+	}
+}
+
+func TestUpdateSessionContinuesThroughEmptyTitles(t *testing.T) {
+	tracker := newTestTracker(true)
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	first := tracker.GetCurrentSession()
+
+	// A title that is empty once cleaned does not split the session
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "\x00\x00"})
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: " "})
+	session := tracker.GetCurrentSession()
+	if !session.StartTime.Equal(first.StartTime) || session.WindowTitle != "main.go" || session.DurationSeconds != 2 {
+		t.Errorf("Expected the session to continue through empty titles, got %+v", session)
+	}
+
+	// Another app without a title still starts a new session
+	tracker.updateSession(&platform.WindowInfo{AppName: "browser", WindowTitle: ""})
+	if session := tracker.GetCurrentSession(); session.AppName != "browser" || session.WindowTitle != "" {
+		t.Errorf("Expected a new untitled browser session, got %+v", session)
+	}
+
+	// Control characters never reach the session
+	tracker.updateSession(&platform.WindowInfo{AppName: "browser", WindowTitle: "News\x07\r\n"})
+	if session := tracker.GetCurrentSession(); session.WindowTitle != "News" || session.RawTitle != "News" {
+		t.Errorf("Expected cleaned titles, got %q and %q", session.WindowTitle, session.RawTitle)
+	}
+}
+
+func TestUpdateSessionKeepsRawTitle(t *testing.T) {
+	tracker := newTestTracker(true)
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "code", WindowTitle: "● main.go"})
+
+	session := tracker.GetCurrentSession()
+	if session.WindowTitle != "main.go" || session.RawTitle != "● main.go" {
+		t.Errorf("Expected normalized and raw titles, got %q and %q", session.WindowTitle, session.RawTitle)
+	}
+}
+
+func TestUpdateSessionMergesAppAliases(t *testing.T) {
+	tracker := newTestTracker(false)
+	apps, err := appname.NewMapper([]appname.Rule{{Pattern: `^firefox(-bin)?$`, Name: "firefox"}})
+	if err != nil {
+		t.Fatalf("Failed to compile mapping: %v", err)
+	}
+	tracker.apps = apps
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "firefox-bin", WindowTitle: "Inbox"})
+	first := tracker.GetCurrentSession()
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "Firefox", WindowTitle: "Inbox"})
+	second := tracker.GetCurrentSession()
+
+	if !second.StartTime.Equal(first.StartTime) || second.AppName != "firefox" {
+		t.Errorf("Expected aliases to continue one firefox session, got %+v", second)
+	}
+}
+
+func TestUpdateSessionMapsWMClass(t *testing.T) {
+	tracker := newTestTracker(false)
+	apps, err := appname.NewMapper([]appname.Rule{
+		{Pattern: `^chromium$`, Class: `^work/`, Name: "Chromium (work)"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile mapping: %v", err)
+	}
+	tracker.apps = apps
+
+	// Two profiles of one browser, the second started with --class=Work
+	tracker.updateSession(&platform.WindowInfo{AppName: "chromium", WindowTitle: "Inbox", WMInstance: "chromium", WMClass: "Chromium"})
+	if session := tracker.GetCurrentSession(); session.AppName != "chromium" {
+		t.Errorf("Expected the default profile as chromium, got %q", session.AppName)
+	}
+	tracker.updateSession(&platform.WindowInfo{AppName: "chromium", WindowTitle: "Inbox", WMInstance: "chromium", WMClass: "Work"})
+	if session := tracker.GetCurrentSession(); session.AppName != "Chromium (work)" {
+		t.Errorf("Expected the work profile mapped by its class, got %q", session.AppName)
+	}
+}
+
+func TestUpdateSessionRecordsBrowserDomain(t *testing.T) {
+	tracker := newTestTracker(false)
+	tracker.browsers = NewBrowsers(&Config{Browsers: DefaultBrowsers})
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "firefox", WindowTitle: "Pull requests - GitHub - Mozilla Firefox"})
+	if session := tracker.GetCurrentSession(); session.Domain != "github.com" {
+		t.Errorf("Expected the browser session to record github.com, got %q", session.Domain)
+	}
+
+	// A new site is a new title, so a new session
+	tracker.updateSession(&platform.WindowInfo{AppName: "firefox", WindowTitle: "(2) Inbox - Gmail - Mozilla Firefox"})
+	if session := tracker.GetCurrentSession(); session.Domain != "mail.google.com" {
+		t.Errorf("Expected the new session to record mail.google.com, got %q", session.Domain)
+	}
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "notes - GitHub"})
+	if session := tracker.GetCurrentSession(); session.Domain != "" {
+		t.Errorf("Expected no domain outside browsers, got %q", session.Domain)
+	}
+}
+
+func TestUpdateSessionRecordsExecutable(t *testing.T) {
+	tracker := newTestTracker(false)
+	apps, err := appname.NewMapper([]appname.Rule{{Pattern: "^java$", Path: "/idea/", Name: "IntelliJ IDEA"}})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	tracker.apps = apps
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "java", WindowTitle: "Main.java", ExePath: "/opt/idea/jbr/bin/java"})
+	if session := tracker.GetCurrentSession(); session.AppName != "IntelliJ IDEA" || session.ExePath != "/opt/idea/jbr/bin/java" {
+		t.Errorf("Expected the path rule to name the app and the path to be kept, got %+v", session)
+	}
+
+	// Two processes of one name and title are two apps
+	tracker.updateSession(&platform.WindowInfo{AppName: "java", WindowTitle: "Console", ExePath: "/usr/bin/java"})
+	first := tracker.GetCurrentSession()
+	tracker.updateSession(&platform.WindowInfo{AppName: "java", WindowTitle: "Console", ExePath: "/opt/jdk8/bin/java"})
+	if second := tracker.GetCurrentSession(); second.ExePath != "/opt/jdk8/bin/java" || second.DurationSeconds != 0 {
+		t.Errorf("Expected a new session for another executable after %+v, got %+v", first, second)
+	}
+
+	// A detector that cannot tell the path continues the session
+	tracker.updateSession(&platform.WindowInfo{AppName: "java", WindowTitle: "Console"})
+	if session := tracker.GetCurrentSession(); session.DurationSeconds != 1 {
+		t.Errorf("Expected the session to continue without a path, got %+v", session)
+	}
+}
+
+func TestUpdateSessionRecordsMonitorAndWorkspace(t *testing.T) {
+	tracker := newTestTracker(false)
+	first, second, desktop := 0, 1, 2
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go", MonitorIndex: &first, Workspace: &desktop})
+	if session := tracker.GetCurrentSession(); session.MonitorIndex == nil || *session.MonitorIndex != 0 || session.Workspace == nil || *session.Workspace != 2 {
+		t.Errorf("Expected monitor 0 and workspace 2, got %+v", session)
+	}
+
+	// Moving the window to the other monitor starts a new session there
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go", MonitorIndex: &second, Workspace: &desktop})
+	if session := tracker.GetCurrentSession(); *session.MonitorIndex != 1 || session.DurationSeconds != 0 {
+		t.Errorf("Expected a new session on monitor 1, got %+v", session)
+	}
+
+	// A detector that cannot tell continues the session
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	if session := tracker.GetCurrentSession(); session.DurationSeconds != 1 {
+		t.Errorf("Expected the session to continue without a monitor, got %+v", session)
+	}
+}
+
+func TestUpdateSessionExcludedBySchedule(t *testing.T) {
+	tracker := newTestTracker(false)
+	schedule, err := CompileSchedule([]ScheduleRule{
+		{App: "^steam$", Days: []string{"Mon-Fri"}, Between: "09:00-18:00", Action: ActionExclude},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	tracker.schedule = schedule
+
+	now := at(time.Tuesday, 17, 59)
+	tracker.now = func() time.Time { return now }
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	tracker.updateSession(&platform.WindowInfo{AppName: "steam", WindowTitle: "Library"})
+	if session := tracker.GetCurrentSession(); session != nil {
+		t.Errorf("Expected excluded activity to end the session, got %+v", session)
+	}
+
+	// After working hours the same app is tracked again
+	now = at(time.Tuesday, 18, 0)
+	tracker.updateSession(&platform.WindowInfo{AppName: "steam", WindowTitle: "Library"})
+	if session := tracker.GetCurrentSession(); session == nil || session.AppName != "steam" {
+		t.Errorf("Expected steam to be tracked after working hours, got %+v", session)
+	}
+}
+
+func TestUpdateSessionIgnoresShellApps(t *testing.T) {
+	tracker := newTestTracker(false)
+	cfg := &Config{}
+	cfg.Shell.Ignore = []string{"panel"}
+	tracker.shell = NewShellApps(cfg)
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	tracker.updateSession(&platform.WindowInfo{AppName: "Panel", WindowTitle: "Clock"})
+	if session := tracker.GetCurrentSession(); session != nil {
+		t.Errorf("Expected shell activity to end the session, got %+v", session)
+	}
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	if session := tracker.GetCurrentSession(); session == nil || session.AppName != "editor" {
+		t.Errorf("Expected the editor to be tracked again, got %+v", session)
+	}
+}
+
+func TestUpdateSessionEndsWithoutAWindow(t *testing.T) {
+	tracker := newTestTracker(false)
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	tracker.updateSession(platform.NoWindow)
+	if session := tracker.GetCurrentSession(); session != nil {
+		t.Errorf("Expected the session to end without a focused window, got %+v", session)
+	}
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	if session := tracker.GetCurrentSession(); session == nil || session.AppName != "editor" {
+		t.Errorf("Expected the editor to be tracked again, got %+v", session)
+	}
+}
+
+func TestUpdateSessionRollsOverAtMaxDuration(t *testing.T) {
+	tracker := newTestTracker(false)
+	tracker.maxSession = 3 * time.Second
+
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	tracker.now = func() time.Time { return now }
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	first := tracker.GetCurrentSession()
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	}
+
+	// The third second reaches the cap and starts a fresh session
+	second := tracker.GetCurrentSession()
+	if second.StartTime.Equal(first.StartTime) || !second.StartTime.Equal(now) || second.DurationSeconds != 0 {
+		t.Fatalf("Expected a new session at %v, got %+v", now, second)
+	}
+	if second.AppName != "editor" || second.WindowTitle != "main.go" {
+		t.Errorf("Expected the new session to keep app and title, got %+v", second)
+	}
+
+	now = now.Add(time.Second)
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	if session := tracker.GetCurrentSession(); !session.StartTime.Equal(second.StartTime) || session.DurationSeconds != 1 {
+		t.Errorf("Expected the new session to continue, got %+v", session)
+	}
+}
+
+func TestTrackerRecordsGaps(t *testing.T) {
+	tracker := newTestTracker(false)
+	now := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+
+	// Idle for five minutes, then the screen locks
+	tracker.beginGap(GapIdle, now.Add(-5*time.Minute), now)
+	tracker.beginGap(GapIdle, now.Add(-4*time.Minute), now.Add(time.Minute))
+	now = now.Add(2 * time.Minute)
+	tracker.beginGap(GapLocked, now, now)
+	if gaps := tracker.TakeGaps(); len(gaps) != 1 || gaps[0].Kind != GapIdle {
+		t.Fatalf("Expected the idle gap to close when the screen locks, got %+v", gaps)
+	}
+
+	// Activity ends the locked gap
+	now = now.Add(time.Hour)
+	tracker.updateSession(&platform.WindowInfo{AppName: "editor", WindowTitle: "main.go"})
+	gaps := tracker.TakeGaps()
+	want := []Gap{{
+		Kind:  GapLocked,
+		Start: time.Date(2026, 1, 5, 12, 2, 0, 0, time.UTC),
+		End:   time.Date(2026, 1, 5, 13, 2, 0, 0, time.UTC),
+	}}
+	if len(gaps) != 1 || gaps[0] != want[0] {
+		t.Errorf("Expected %+v, got %+v", want, gaps)
+	}
+	if gaps := tracker.TakeGaps(); len(gaps) != 0 {
+		t.Errorf("Expected gaps to be taken once, got %+v", gaps)
+	}
+}
+
+// scriptedDetector answers every call with the current step
+type scriptedDetector struct {
+	step    scriptStep
+	initErr error
+	inits   int
+	closes  int
+}
+
+type scriptStep struct {
+	locked    bool
+	idle      time.Duration
+	window    string
+	lockErr   error
+	windowErr error
+}
+
+func (d *scriptedDetector) IsScreenLocked() (bool, error)       { return d.step.locked, d.step.lockErr }
+func (d *scriptedDetector) GetIdleTime() (time.Duration, error) { return d.step.idle, nil }
+func (d *scriptedDetector) Initialize() error                   { d.inits++; return d.initErr }
+func (d *scriptedDetector) Close() error                        { d.closes++; return nil }
+
+func (d *scriptedDetector) GetActiveWindow() (*platform.WindowInfo, error) {
+	if d.step.windowErr != nil {
+		return nil, d.step.windowErr
+	}
+	return &platform.WindowInfo{AppName: "editor", WindowTitle: d.step.window}, nil
+}
+
+func TestTrackerCounters(t *testing.T) {
+	tracker := newTestTracker(false)
+	detector := &scriptedDetector{}
+	tracker.detector = detector
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	steps := []scriptStep{
+		{window: "main.go"},
+		{window: "main.go"},
+		{window: "notes.md"},
+		{idle: 10 * time.Minute},
+		{idle: 10 * time.Minute},
+		{windowErr: errors.New("no window")},
+		{lockErr: errors.New("no session bus")},
+		{locked: true},
+		{window: "main.go"},
+	}
+	for _, step := range steps {
+		now = now.Add(time.Second)
+		detector.step = step
+		tracker.tick()
+	}
+
+	counters := tracker.Counters()
+	if counters.Ticks != 9 {
+		t.Errorf("Expected 9 ticks, got %d", counters.Ticks)
+	}
+	wantErrors := map[string]int64{DetectorCallLock: 1, DetectorCallIdle: 0, DetectorCallWindow: 1}
+	for call, want := range wantErrors {
+		if got := counters.DetectorErrors[call]; got != want {
+			t.Errorf("Expected %d %s errors, got %d", want, call, got)
+		}
+	}
+	if tracker.DetectorErrors() != 2 {
+		t.Errorf("Expected 2 detector errors in total, got %d", tracker.DetectorErrors())
+	}
+	// main.go, notes.md and main.go again; the idle pause ends notes.md
+	if counters.SessionsStarted != 3 || counters.SessionsEnded != 2 {
+		t.Errorf("Expected 3 sessions started and 2 ended, got %d and %d", counters.SessionsStarted, counters.SessionsEnded)
+	}
+	// Staying idle does not count a second pause
+	if counters.Pauses[GapIdle] != 1 || counters.Pauses[GapLocked] != 1 {
+		t.Errorf("Expected one idle and one locked pause, got %v", counters.Pauses)
+	}
+	if !counters.LastDetectorOK.Equal(now) {
+		t.Errorf("Expected the last successful detector call at %v, got %v", now, counters.LastDetectorOK)
+	}
+}
+
+func TestTrackerReconnectsFailingDetector(t *testing.T) {
+	tracker := newTestTracker(false)
+	detector := &scriptedDetector{step: scriptStep{window: "main.go"}}
+	tracker.detector = detector
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	tick := func() {
+		now = now.Add(time.Second)
+		tracker.tick()
+	}
+
+	tick()
+	if tracker.GetCurrentSession() == nil {
+		t.Fatal("Expected a session")
+	}
+
+	// The X server goes away: the session ends once the detector is
+	// taken as gone, not on the first failure
+	detector.step = scriptStep{windowErr: errors.New("connection closed")}
+	detector.initErr = errors.New("cannot open display")
+	for i := 1; i < detectorFailureThreshold; i++ {
+		tick()
+	}
+	if tracker.GetCurrentSession() == nil {
+		t.Fatal("Expected the session to survive a few failures")
+	}
+	tick()
+	if tracker.GetCurrentSession() != nil {
+		t.Fatal("Expected the session to end when the detector is gone")
+	}
+
+	// Attempts to reinitialize back off: after 1s, 2s, 4s and 8s
+	var attempts []int
+	for i := 1; i <= 15; i++ {
+		before := detector.inits
+		tick()
+		if detector.inits > before {
+			attempts = append(attempts, i)
+		}
+	}
+	if want := []int{1, 3, 7, 15}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("Expected attempts after %v seconds, got %v", want, attempts)
+	}
+	if detector.closes != detector.inits {
+		t.Errorf("Expected the detector to be closed before every attempt, got %d closes and %d inits", detector.closes, detector.inits)
+	}
+	if got := tracker.Counters().Reconnects; got != 4 {
+		t.Errorf("Expected 4 reconnects, got %d", got)
+	}
+
+	// The display is back: the next attempt resumes tracking
+	detector.step = scriptStep{window: "main.go"}
+	detector.initErr = nil
+	for i := 0; i < 16 && tracker.GetCurrentSession() == nil; i++ {
+		tick()
+	}
+	if tracker.GetCurrentSession() == nil {
+		t.Fatal("Expected tracking to resume once the detector is reinitialized")
+	}
+	if tracker.reconnectDelay != 0 || tracker.failures != 0 {
+		t.Errorf("Expected the failures to be cleared, got %d failures and a delay of %s", tracker.failures, tracker.reconnectDelay)
+	}
+}
+
+func TestTrackerEndsSessionOnSuspend(t *testing.T) {
+	tracker := newTestTracker(false)
+	detector := &scriptedDetector{step: scriptStep{window: "main.go"}}
+	tracker.detector = detector
+	now := time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	tick := func(elapsed time.Duration) {
+		now = now.Add(elapsed)
+		tracker.tick()
+	}
+
+	tick(time.Second)
+	tick(time.Second)
+	slept := now
+
+	// The lid closes overnight with the editor focused
+	tick(6 * time.Hour)
+	session := tracker.GetCurrentSession()
+	if session == nil || !session.StartTime.Equal(now) || session.DurationSeconds != 0 {
+		t.Fatalf("Expected a new session after the resume, got %+v", session)
+	}
+	want := Gap{Kind: GapSuspended, Start: slept, End: now}
+	if gaps := tracker.TakeGaps(); len(gaps) != 1 || gaps[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, gaps)
+	}
+	counters := tracker.Counters()
+	if counters.SessionsStarted != 2 || counters.SessionsEnded != 1 || counters.Pauses[GapSuspended] != 1 {
+		t.Errorf("Expected the first session to end at the suspend, got %+v", counters)
+	}
+
+	// Input stopped before the suspend; the idle gap starts at the resume
+	resumed := now
+	detector.step = scriptStep{idle: 6*time.Hour + time.Second}
+	tick(time.Second)
+	tick(time.Second)
+	detector.step = scriptStep{window: "main.go"}
+	tick(time.Second)
+	if gaps := tracker.TakeGaps(); len(gaps) != 1 || gaps[0].Kind != GapIdle || !gaps[0].Start.Equal(resumed) {
+		t.Errorf("Expected an idle gap from the resume, got %+v", gaps)
+	}
+
+	// Ticks a little late are no suspend
+	tick(30 * time.Second)
+	if gaps := tracker.TakeGaps(); len(gaps) != 0 {
+		t.Errorf("Expected no gap for a late tick, got %+v", gaps)
+	}
+}
+
+func TestTrackerFollowsSleepNotifications(t *testing.T) {
+	tracker := newTestTracker(false)
+	detector := &scriptedDetector{step: scriptStep{window: "main.go"}}
+	tracker.detector = detector
+	now := time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	tracker.tick()
+	now = now.Add(time.Second)
+	tracker.sleepChanged(true)
+	slept := now
+	if tracker.GetCurrentSession() != nil {
+		t.Fatal("Expected the session to end when the system goes to sleep")
+	}
+
+	// A tick before the system is asleep tracks nothing
+	now = now.Add(time.Second)
+	tracker.tick()
+	if tracker.GetCurrentSession() != nil {
+		t.Error("Expected no session while going to sleep")
+	}
+
+	now = now.Add(6 * time.Hour)
+	tracker.sleepChanged(false)
+	tracker.tick()
+	want := Gap{Kind: GapSuspended, Start: slept, End: now}
+	if gaps := tracker.TakeGaps(); len(gaps) != 1 || gaps[0] != want {
+		t.Errorf("Expected one suspended gap %+v, got %+v", want, gaps)
+	}
+	if session := tracker.GetCurrentSession(); session == nil || !session.StartTime.Equal(now) {
+		t.Errorf("Expected tracking to resume, got %+v", session)
+	}
+}
+
+// mediaDetector is a scriptedDetector that can tell media is playing
+type mediaDetector struct {
+	scriptedDetector
+	playing bool
+}
+
+func (d *mediaDetector) IsMediaPlaying() (bool, error) { return d.playing, nil }
+
+func TestTrackerCountsMediaAsActive(t *testing.T) {
+	for _, countMedia := range []bool{false, true} {
+		tracker := newTestTracker(false)
+		tracker.config.Monitor.CountMediaAsActive = countMedia
+		detector := &mediaDetector{scriptedDetector: scriptedDetector{step: scriptStep{window: "talk.pdf"}}, playing: true}
+		tracker.detector = detector
+		now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+		tracker.now = func() time.Time { return now }
+
+		tracker.tick()
+
+		// Presenting: no input for ten minutes
+		detector.step.idle = 10 * time.Minute
+		now = now.Add(time.Second)
+		tracker.tick()
+
+		session := tracker.GetCurrentSession()
+		if countMedia && (session == nil || session.DurationSeconds != 1) {
+			t.Errorf("Expected the session to go on while media plays, got %+v", session)
+		}
+		if !countMedia && session != nil {
+			t.Errorf("Expected the session to pause without count_media_as_active, got %+v", session)
+		}
+
+		// The presentation ends
+		detector.playing = false
+		now = now.Add(time.Second)
+		tracker.tick()
+		if session := tracker.GetCurrentSession(); session != nil {
+			t.Errorf("Expected the session to pause once media stops, got %+v", session)
+		}
+	}
+}
+
+// eventDetector is a scriptedDetector that sends notifications
+type eventDetector struct {
+	scriptedDetector
+	events chan platform.WindowEvent
+}
+
+func (d *eventDetector) Events() <-chan platform.WindowEvent { return d.events }
+
+func TestTrackerRefreshesOnNotifications(t *testing.T) {
+	tracker := newTestTracker(false)
+	detector := &eventDetector{scriptedDetector: scriptedDetector{step: scriptStep{window: "main.go"}}}
+	tracker.detector = detector
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	if tracker.events() != nil {
+		t.Fatal("Expected no events from a detector without notifications")
+	}
+	detector.events = make(chan platform.WindowEvent)
+	if tracker.events() == nil {
+		t.Fatal("Expected the detector's events")
+	}
+
+	tracker.tick()
+	now = now.Add(time.Second)
+	tracker.tick()
+
+	// A switch between ticks starts the new session right away
+	now = now.Add(300 * time.Millisecond)
+	detector.step.window = "notes.md"
+	tracker.refresh(platform.WindowEvent{Kind: platform.WindowEventForeground, Time: now})
+	session := tracker.GetCurrentSession()
+	if session == nil || session.WindowTitle != "notes.md" || !session.StartTime.Equal(now) || session.DurationSeconds != 0 {
+		t.Fatalf("Expected notes.md to start at the notification, got %+v", session)
+	}
+
+	// Notifications do not count time
+	tracker.refresh(platform.WindowEvent{Kind: platform.WindowEventForeground, Time: now})
+	if session := tracker.GetCurrentSession(); session.DurationSeconds != 0 {
+		t.Errorf("Expected no time counted by a notification, got %ds", session.DurationSeconds)
+	}
+	now = now.Add(700 * time.Millisecond)
+	tracker.tick()
+	if session := tracker.GetCurrentSession(); session.DurationSeconds != 1 {
+		t.Errorf("Expected the tick to count a second, got %ds", session.DurationSeconds)
+	}
+
+	// A lock pauses tracking at once
+	detector.step.locked = true
+	tracker.refresh(platform.WindowEvent{Kind: platform.WindowEventSession, Time: now})
+	if session := tracker.GetCurrentSession(); session != nil {
+		t.Errorf("Expected the lock to end the session, got %+v", session)
+	}
+	if counters := tracker.Counters(); counters.Pauses[GapLocked] != 1 {
+		t.Errorf("Expected a locked pause, got %v", counters.Pauses)
+	}
+}
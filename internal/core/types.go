@@ -1,18 +1,43 @@
 package core
 
-import "time"
+import (
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/title"
+)
 
 // Session represents a usage session for an application
 type Session struct {
 	ID              int64
 	AppName         string
 	WindowTitle     string
+	RawTitle        string
+	Domain          string // site of a browser session, from its title
+	ExePath         string // executable of the window's process, "" when unknown
+	MonitorIndex    *int   // monitor the window was on, nil when unknown
+	Workspace       *int   // virtual desktop the window was on, nil when unknown
 	StartTime       time.Time
 	EndTime         time.Time
 	DurationSeconds int64
 	CreatedAt       time.Time
 }
 
+// Gap kinds recorded by the tracker
+const (
+	GapLocked    = "locked"
+	GapIdle      = "idle"
+	GapSuspended = "suspended"
+)
+
+// Gap is a period tracking paused because the screen was locked, the user
+// was idle or the system was suspended
+type Gap struct {
+	Kind  string
+	Start time.Time
+	End   time.Time
+}
+
 // DailyStats represents daily usage statistics for an application
 type DailyStats struct {
 	ID           int64
@@ -39,15 +64,79 @@ type ActivityStatus struct {
 // Config represents the application configuration
 type Config struct {
 	Database struct {
-		Path string `yaml:"path"`
+		Path         string        `yaml:"path"`
+		MaxReadConns int           `yaml:"max_read_conns"`
+		BusyTimeout  time.Duration `yaml:"busy_timeout"`
+		// SlowQuery is the duration above which a statement is logged at
+		// debug level
+		SlowQuery time.Duration `yaml:"slow_query"`
+
+		// Backup makes the daemon copy the database to Dir every Interval,
+		// keeping the newest Keep copies
+		Backup struct {
+			// Interval between backups; 0 disables them
+			Interval time.Duration `yaml:"interval"`
+			Keep     int           `yaml:"keep"`
+			// Dir defaults to export.output_dir, where `actime db backup`
+			// also writes
+			Dir string `yaml:"dir"`
+		} `yaml:"backup"`
 	} `yaml:"database"`
 
 	Monitor struct {
 		CheckInterval  time.Duration `yaml:"check_interval"`
 		ActivityWindow time.Duration `yaml:"activity_window"`
 		IdleTimeout    time.Duration `yaml:"idle_timeout"`
+		KeepRawTitle   bool          `yaml:"keep_raw_title"`
+		// MaxSessionDuration caps a session: the tracker starts a new one
+		// when it is reached and the daemon refuses to store longer ones
+		MaxSessionDuration time.Duration `yaml:"max_session_duration"`
+		// Detectors names the window detectors to use, highest priority
+		// first, such as [x11]; when several are named they are asked
+		// together. Empty uses the platform default.
+		Detectors []string `yaml:"detectors"`
+		// DetectorTimeout bounds one call to a detector when several are
+		// named
+		DetectorTimeout time.Duration `yaml:"detector_timeout"`
+		// IdleSource picks where the idle time comes from: "evdev" reads
+		// the input devices in /dev/input (Linux only, needs read access,
+		// usually through the input group); empty or "auto" asks the
+		// detector
+		IdleSource string `yaml:"idle_source"`
+		// CountMediaAsActive keeps tracking while the user is idle but a
+		// fullscreen window is in front or media is playing, as when
+		// watching a video or presenting
+		CountMediaAsActive bool `yaml:"count_media_as_active"`
 	} `yaml:"monitor"`
 
+	// TitleNormalize rewrites window titles before sessions are compared and
+	// stored. When unset the built-in rules are used; an empty list disables
+	// normalization.
+	TitleNormalize []title.Rule `yaml:"title_normalize"`
+
+	// AppMapping resolves aliases such as "firefox-bin" to one canonical
+	// application name before sessions are compared and stored
+	AppMapping []appname.Rule `yaml:"app_mapping"`
+
+	// Browsers are the applications whose sessions record the site they
+	// show. When unset the built-in list is used; an empty list disables it.
+	Browsers []string `yaml:"browsers"`
+
+	// ScheduleRules exclude apps during some hours or days, e.g. games
+	// during weekday working hours
+	ScheduleRules []ScheduleRule `yaml:"schedule_rules"`
+
+	// Shell adjusts the desktop-shell processes (taskbar, desktop, launcher
+	// and actimed itself) the tracker ignores
+	Shell struct {
+		// Track records shell processes like any other application
+		Track bool `yaml:"track"`
+		// Ignore adds names to the built-in list of the platform
+		Ignore []string `yaml:"ignore"`
+		// Allow removes names from the built-in list
+		Allow []string `yaml:"allow"`
+	} `yaml:"shell"`
+
 	Logging struct {
 		Level       string `yaml:"level"`
 		File        string `yaml:"file"`
@@ -59,5 +148,48 @@ type Config struct {
 	Export struct {
 		OutputDir     string `yaml:"output_dir"`
 		DefaultFormat string `yaml:"default_format"`
+
+		// Toggl configures `actime export --format toggl`
+		Toggl struct {
+			Email    string        `yaml:"email"`
+			MinEntry time.Duration `yaml:"min_entry"`
+			Timezone string        `yaml:"timezone"`
+		} `yaml:"toggl"`
+
+		// Auto makes the daemon export every finished day to Dir shortly
+		// after local midnight, catching up on days it missed
+		Auto struct {
+			Enabled bool `yaml:"enabled"`
+			// Format of the files; only jsonl (gzipped) is supported
+			Format string `yaml:"format"`
+			Dir    string `yaml:"dir"`
+			// Granularity is the period of one file; only day is supported
+			Granularity string `yaml:"granularity"`
+			// CatchUpDays bounds how far back missed days are exported
+			CatchUpDays int `yaml:"catch_up_days"`
+		} `yaml:"auto"`
 	} `yaml:"export"`
+
+	// Retention makes the daemon prune old sessions once a day
+	Retention struct {
+		// Days of sessions to keep; 0 keeps everything
+		Days int `yaml:"days"`
+		// DailyStatsDays of daily statistics to keep; 0 keeps everything.
+		// It cannot be shorter than Days.
+		DailyStatsDays int `yaml:"daily_stats_days"`
+		// ExportDir, when set, receives an archive of the sessions before
+		// they are deleted
+		ExportDir string `yaml:"export_dir"`
+	} `yaml:"retention"`
+
+	Report struct {
+		DurationStyle string `yaml:"duration_style"`
+		Language      string `yaml:"language"`
+		// WeekStart is the first day of the week for --range this-week
+		// and last-week
+		WeekStart string `yaml:"week_start"`
+		// LaunchGap is the break after which returning to the same app
+		// counts as a new launch in `actime stats --show-launches`
+		LaunchGap time.Duration `yaml:"launch_gap"`
+	} `yaml:"report"`
 }
\ No newline at end of file
@@ -0,0 +1,70 @@
+// Package daterange resolves the --range presets shared by the commands
+package daterange
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Presets accepted by --range
+const (
+	Today      = "today"
+	Yesterday  = "yesterday"
+	ThisWeek   = "this-week"
+	LastWeek   = "last-week"
+	ThisMonth  = "this-month"
+	Last30Days = "last-30d"
+)
+
+// Presets lists every preset, in the order shown in help output
+var Presets = []string{Today, Yesterday, ThisWeek, LastWeek, ThisMonth, Last30Days}
+
+// Resolve returns the first and last day of preset as of now, both
+// inclusive and at midnight in now's location. Weeks begin on weekStart:
+// this-week runs from its first day through today and last-week is the
+// whole week before it. this-month runs from the 1st through today and
+// last-30d is today and the 29 days before it.
+func Resolve(preset string, now time.Time, weekStart time.Weekday) (start, end time.Time, err error) {
+	// Dates are built from calendar fields, so DST changes cannot shift a
+	// day boundary
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	switch preset {
+	case Today:
+		return today, today, nil
+	case Yesterday:
+		yesterday := today.AddDate(0, 0, -1)
+		return yesterday, yesterday, nil
+	case ThisWeek:
+		return weekOf(today, weekStart), today, nil
+	case LastWeek:
+		first := weekOf(today, weekStart).AddDate(0, 0, -7)
+		return first, first.AddDate(0, 0, 6), nil
+	case ThisMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location()), today, nil
+	case Last30Days:
+		return today.AddDate(0, 0, -29), today, nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unsupported range: %s (expected %s)", preset, strings.Join(Presets, ", "))
+	}
+}
+
+// weekOf returns the first day of the week containing day
+func weekOf(day time.Time, weekStart time.Weekday) time.Time {
+	offset := (int(day.Weekday()) - int(weekStart) + 7) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// ParseWeekday parses a weekday name such as "monday" or "Sun"
+func ParseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday: %q", name)
+}
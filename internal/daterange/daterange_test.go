@@ -0,0 +1,77 @@
+package daterange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+
+	// 2026-01-04 is a Sunday
+	sunday := time.Date(2026, 1, 4, 18, 30, 0, 0, time.UTC)
+	newYear := time.Date(2026, 1, 1, 0, 5, 0, 0, time.UTC)
+	// Clocks in New York skip from 02:00 to 03:00 on 2026-03-08
+	dst := time.Date(2026, 3, 8, 12, 0, 0, 0, newYork)
+
+	tests := []struct {
+		name      string
+		preset    string
+		now       time.Time
+		weekStart time.Weekday
+		start     string
+		end       string
+	}{
+		{"today", Today, sunday, time.Monday, "2026-01-04", "2026-01-04"},
+		{"yesterday across the year", Yesterday, newYear, time.Monday, "2025-12-31", "2025-12-31"},
+		{"sunday ends a monday week", ThisWeek, sunday, time.Monday, "2025-12-29", "2026-01-04"},
+		{"sunday starts a sunday week", ThisWeek, sunday, time.Sunday, "2026-01-04", "2026-01-04"},
+		{"last monday week", LastWeek, sunday, time.Monday, "2025-12-22", "2025-12-28"},
+		{"last sunday week", LastWeek, sunday, time.Sunday, "2025-12-28", "2026-01-03"},
+		{"last week across the year", LastWeek, newYear, time.Monday, "2025-12-22", "2025-12-28"},
+		{"this month on the 1st", ThisMonth, newYear, time.Monday, "2026-01-01", "2026-01-01"},
+		{"last 30 days across the year", Last30Days, newYear, time.Monday, "2025-12-03", "2026-01-01"},
+		{"this week over a DST change", ThisWeek, dst, time.Monday, "2026-03-02", "2026-03-08"},
+		{"last 30 days over a DST change", Last30Days, dst, time.Monday, "2026-02-07", "2026-03-08"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := Resolve(tt.preset, tt.now, tt.weekStart)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := start.Format("2006-01-02"); got != tt.start {
+				t.Errorf("Expected start %s, got %s", tt.start, got)
+			}
+			if got := end.Format("2006-01-02"); got != tt.end {
+				t.Errorf("Expected end %s, got %s", tt.end, got)
+			}
+			// Both ends are midnight in the location of now
+			for _, day := range []time.Time{start, end} {
+				if day.Location() != tt.now.Location() || day.Hour() != 0 || day.Minute() != 0 {
+					t.Errorf("Expected midnight in %s, got %v", tt.now.Location(), day)
+				}
+			}
+		})
+	}
+
+	if _, _, err := Resolve("fortnight", sunday, time.Monday); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	for name, want := range map[string]time.Weekday{"monday": time.Monday, "Sun": time.Sunday, " SATURDAY ": time.Saturday} {
+		got, err := ParseWeekday(name)
+		if err != nil || got != want {
+			t.Errorf("ParseWeekday(%q) = %v, %v; expected %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseWeekday("someday"); err == nil {
+		t.Error("Expected an error for an unknown weekday")
+	}
+}
@@ -0,0 +1,202 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/weii/actime/internal/fsutil"
+	"github.com/weii/actime/internal/storage"
+)
+
+// ArchiveRecord is one session in a JSONL archive. CreatedAt and UpdatedAt
+// are left out for sessions that are not stored yet.
+type ArchiveRecord struct {
+	ID              int64      `json:"id"`
+	AppName         string     `json:"app_name"`
+	WindowTitle     string     `json:"window_title"`
+	RawTitle        string     `json:"raw_title,omitempty"`
+	Domain          string     `json:"domain,omitempty"`
+	ExePath         string     `json:"exe_path,omitempty"`
+	MonitorIndex    *int       `json:"monitor_index,omitempty"`
+	Workspace       *int       `json:"workspace,omitempty"`
+	StartTime       time.Time  `json:"start_time"`
+	EndTime         time.Time  `json:"end_time"`
+	DurationSeconds int64      `json:"duration_seconds"`
+	Source          string     `json:"source,omitempty"`
+	Category        string     `json:"category,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+// NewArchiveRecord converts a session to its JSON form
+func NewArchiveRecord(session *storage.Session) ArchiveRecord {
+	record := ArchiveRecord{
+		ID:              session.ID,
+		AppName:         session.AppName,
+		WindowTitle:     session.WindowTitle,
+		RawTitle:        session.RawTitle,
+		Domain:          session.Domain,
+		ExePath:         session.ExePath,
+		MonitorIndex:    session.MonitorIndex,
+		Workspace:       session.Workspace,
+		StartTime:       session.StartTime,
+		EndTime:         session.EndTime,
+		DurationSeconds: session.DurationSeconds,
+		Source:          session.Source,
+		Category:        session.Category,
+	}
+	if !session.CreatedAt.IsZero() {
+		createdAt := session.CreatedAt
+		record.CreatedAt = &createdAt
+	}
+	if !session.UpdatedAt.IsZero() {
+		updatedAt := session.UpdatedAt
+		record.UpdatedAt = &updatedAt
+	}
+	return record
+}
+
+// Manifest describes an archive written by ArchiveSessions
+type Manifest struct {
+	File string `json:"file"`
+	// From is the start of the first archived session; Before is the day
+	// the archived range ends at, exclusive
+	From      time.Time `json:"from"`
+	Before    string    `json:"before"`
+	Rows      int       `json:"rows"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ArchiveSessions writes sessions as gzipped JSONL to dir, reads the file
+// back to verify it holds exactly len(sessions) rows, and then writes a
+// manifest next to it. Nothing is left behind on failure.
+func ArchiveSessions(dir string, sessions []*storage.Session, before time.Time) (*Manifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("sessions-before-%s-%s", before.Format(storage.DateLayout), now.Format("20060102-150405"))
+	path := filepath.Join(dir, name+".jsonl.gz")
+	manifestPath := filepath.Join(dir, name+".manifest.json")
+
+	manifest, err := writeArchive(path, sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.Before = before.Format(storage.DateLayout)
+	manifest.CreatedAt = now
+	if len(sessions) > 0 {
+		manifest.From = sessions[0].StartTime
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := fsutil.WriteFile(manifestPath, append(data, '\n'), 0644, false); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// writeArchive writes and verifies the archive file. The file only appears
+// under its name once it is complete.
+func writeArchive(path string, sessions []*storage.Session) (*Manifest, error) {
+	hash := sha256.New()
+	err := fsutil.Write(path, 0644, false, func(w io.Writer) error {
+		zw := gzip.NewWriter(io.MultiWriter(w, hash))
+		encoder := json.NewEncoder(zw)
+		for _, session := range sessions {
+			if err := encoder.Encode(NewArchiveRecord(session)); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	rows, err := countArchiveRows(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to verify archive: %w", err)
+	}
+	if rows != len(sessions) {
+		os.Remove(path)
+		return nil, fmt.Errorf("archive holds %d rows, expected %d", rows, len(sessions))
+	}
+
+	return &Manifest{
+		File:   filepath.Base(path),
+		Rows:   rows,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// countArchiveRows counts the records in a gzipped JSONL archive, checking
+// that each one decodes
+func countArchiveRows(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	rows := 0
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record ArchiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return 0, fmt.Errorf("line %d: %w", rows+1, err)
+		}
+		rows++
+	}
+	return rows, scanner.Err()
+}
+
+// PruneSessions deletes the sessions that started before the given day.
+// With dir set they are archived there first, and nothing is deleted unless
+// the archive was written and verified. The manifest is nil without dir or
+// when there was nothing to delete.
+func PruneSessions(db *storage.DB, before time.Time, dir string) (int64, *Manifest, error) {
+	if dir == "" {
+		deleted, err := db.PruneSessions(before, nil)
+		return deleted, nil, err
+	}
+
+	var manifest *Manifest
+	deleted, err := db.PruneSessions(before, func(sessions []*storage.Session) error {
+		if len(sessions) == 0 {
+			return nil
+		}
+		var err error
+		manifest, err = ArchiveSessions(dir, sessions, before)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return deleted, manifest, nil
+}
@@ -0,0 +1,135 @@
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// seedPruneDB writes one session a day from 2026-01-01 to 2026-01-06
+func seedPruneDB(t *testing.T) *storage.DB {
+	t.Helper()
+
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for day := 1; day <= 6; day++ {
+		start := time.Date(2026, 1, day, 10, 0, 0, 0, time.Local)
+		if err := db.InsertSession(&storage.Session{
+			AppName:         "code",
+			WindowTitle:     "main.go",
+			StartTime:       start,
+			EndTime:         start.Add(time.Hour),
+			DurationSeconds: 3600,
+		}); err != nil {
+			t.Fatalf("Failed to insert session: %v", err)
+		}
+	}
+	return db
+}
+
+func countSessions(t *testing.T, db *storage.DB) int {
+	t.Helper()
+	sessions, err := db.GetSessions(&storage.StatsQuery{
+		StartDate: time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local),
+		EndDate:   time.Date(2026, 1, 31, 0, 0, 0, 0, time.Local),
+	})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	return len(sessions)
+}
+
+func TestPruneSessionsWritesManifest(t *testing.T) {
+	db := seedPruneDB(t)
+	dir := filepath.Join(t.TempDir(), "archive")
+	before := time.Date(2026, 1, 4, 0, 0, 0, 0, time.Local)
+
+	deleted, manifest, err := PruneSessions(db, before, dir)
+	if err != nil {
+		t.Fatalf("Failed to prune sessions: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 deleted sessions, got %d", deleted)
+	}
+	if got := countSessions(t, db); got != 3 {
+		t.Errorf("Expected 3 sessions left, got %d", got)
+	}
+
+	if manifest.Rows != 3 || manifest.Before != "2026-01-04" {
+		t.Errorf("Expected 3 rows before 2026-01-04, got %+v", manifest)
+	}
+	if !manifest.From.Equal(time.Date(2026, 1, 1, 10, 0, 0, 0, time.Local)) {
+		t.Errorf("Expected the range to start at the first session, got %v", manifest.From)
+	}
+	if !strings.HasPrefix(manifest.File, "sessions-before-2026-01-04-") || !strings.HasSuffix(manifest.File, ".jsonl.gz") {
+		t.Errorf("Unexpected archive name %q", manifest.File)
+	}
+
+	// The checksum is that of the archive on disk
+	data, err := os.ReadFile(filepath.Join(dir, manifest.File))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if manifest.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected sha256 %x, got %s", sum, manifest.SHA256)
+	}
+	if rows, err := countArchiveRows(filepath.Join(dir, manifest.File)); err != nil || rows != 3 {
+		t.Errorf("Expected 3 rows in the archive, got %d (%v)", rows, err)
+	}
+
+	// The manifest on disk matches the one returned
+	raw, err := os.ReadFile(filepath.Join(dir, strings.TrimSuffix(manifest.File, ".jsonl.gz")+".manifest.json"))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	var written Manifest
+	if err := json.Unmarshal(raw, &written); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if written.File != manifest.File || written.Rows != manifest.Rows || written.SHA256 != manifest.SHA256 || written.Before != manifest.Before {
+		t.Errorf("Expected manifest %+v on disk, got %+v", manifest, written)
+	}
+}
+
+func TestPruneSessionsKeepsRowsWhenExportFails(t *testing.T) {
+	db := seedPruneDB(t)
+	before := time.Date(2026, 1, 4, 0, 0, 0, 0, time.Local)
+
+	// A file where the archive directory should be makes the export fail
+	dir := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if _, _, err := PruneSessions(db, before, dir); err == nil {
+		t.Fatal("Expected the export failure to be reported")
+	}
+	if got := countSessions(t, db); got != 6 {
+		t.Errorf("Expected all 6 sessions to be kept, got %d", got)
+	}
+
+	// So does an archive callback that fails after the rows were read
+	if _, err := db.PruneSessions(before, func(sessions []*storage.Session) error {
+		if len(sessions) != 3 {
+			t.Errorf("Expected 3 sessions to archive, got %d", len(sessions))
+		}
+		return os.ErrPermission
+	}); err == nil {
+		t.Fatal("Expected the archive failure to be reported")
+	}
+	if got := countSessions(t, db); got != 6 {
+		t.Errorf("Expected all 6 sessions to be kept, got %d", got)
+	}
+}
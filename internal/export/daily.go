@@ -0,0 +1,151 @@
+package export
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/weii/actime/internal/fsutil"
+	"github.com/weii/actime/internal/stats"
+	"github.com/weii/actime/internal/storage"
+)
+
+// DefaultCatchUpDays is how many finished days an automatic export looks
+// back for days it missed
+const DefaultCatchUpDays = 7
+
+// DailyRecord is one application's total of a day in a daily export
+type DailyRecord struct {
+	Date         string `json:"date"`
+	AppName      string `json:"app_name"`
+	TotalSeconds int64  `json:"total_seconds"`
+}
+
+// DailyFiles returns the names of the files a day is exported to: its
+// sessions and its daily totals
+func DailyFiles(day time.Time) (sessions, daily string) {
+	date := day.Format(storage.DateLayout)
+	return date + ".sessions.jsonl.gz", date + ".daily.jsonl.gz"
+}
+
+// ExportDay writes the sessions and daily totals of one local day to dir as
+// gzipped JSONL. Checkpoints of a session are merged into one record. The
+// sessions file is written last, so its presence marks a finished export.
+func ExportDay(db *storage.DB, dir string, day time.Time) error {
+	query := &storage.StatsQuery{StartDate: day, EndDate: day}
+	var sessions []*storage.Session
+	var daily []*storage.DailyStats
+	err := db.Snapshot(func(view *storage.DB) error {
+		var err error
+		if sessions, err = view.GetSessions(query); err != nil {
+			return fmt.Errorf("failed to get sessions: %w", err)
+		}
+		if daily, err = view.GetDailyStats(query); err != nil {
+			return fmt.Errorf("failed to get daily stats: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sessions = stats.MergeSessions(sessions)
+	stats.SortDailyStats(daily)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	sessionsFile, dailyFile := DailyFiles(day)
+
+	// A daily file without its sessions file is left from an interrupted
+	// export and is replaced
+	err = writeJSONLines(filepath.Join(dir, dailyFile), true, func(encoder *json.Encoder) error {
+		for _, row := range daily {
+			if err := encoder.Encode(DailyRecord{
+				Date:         row.Date.Format(storage.DateLayout),
+				AppName:      row.AppName,
+				TotalSeconds: row.TotalSeconds,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeJSONLines(filepath.Join(dir, sessionsFile), false, func(encoder *json.Encoder) error {
+		for _, session := range sessions {
+			// Daily exports leave out the unredacted title
+			record := NewArchiveRecord(session)
+			record.RawTitle = ""
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeJSONLines writes a gzipped JSONL file that only appears under its
+// name once it is complete
+func writeJSONLines(path string, overwrite bool, encode func(*json.Encoder) error) error {
+	err := fsutil.Write(path, 0644, overwrite, func(w io.Writer) error {
+		zw := gzip.NewWriter(w)
+		if err := encode(json.NewEncoder(zw)); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// PendingDays returns the finished local days, up to catchUp days before
+// now, whose export is missing from dir, oldest first
+func PendingDays(dir string, now time.Time, catchUp int) ([]time.Time, error) {
+	if catchUp <= 0 {
+		catchUp = DefaultCatchUpDays
+	}
+
+	y, m, d := now.Date()
+	var days []time.Time
+	for back := catchUp; back >= 1; back-- {
+		day := time.Date(y, m, d-back, 0, 0, 0, 0, now.Location())
+		sessionsFile, _ := DailyFiles(day)
+		_, err := os.Stat(filepath.Join(dir, sessionsFile))
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to check export of %s: %w", day.Format(storage.DateLayout), err)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// CatchUp exports every pending day and returns the days it wrote. It
+// stops at the first day that fails, so a later run retries it.
+func CatchUp(db *storage.DB, dir string, now time.Time, catchUp int) ([]time.Time, error) {
+	days, err := PendingDays(dir, now, catchUp)
+	if err != nil {
+		return nil, err
+	}
+
+	var written []time.Time
+	for _, day := range days {
+		if err := ExportDay(db, dir, day); err != nil {
+			return written, fmt.Errorf("failed to export %s: %w", day.Format(storage.DateLayout), err)
+		}
+		written = append(written, day)
+	}
+	return written, nil
+}
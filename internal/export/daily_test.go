@@ -0,0 +1,138 @@
+package export
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// readJSONLines returns the lines of a gzipped JSONL file
+func readJSONLines(t *testing.T, path string) []json.RawMessage {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	var records []json.RawMessage
+	decoder := json.NewDecoder(zr)
+	for decoder.More() {
+		var record json.RawMessage
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func dates(days []time.Time) []string {
+	var out []string
+	for _, day := range days {
+		out = append(out, day.Format(storage.DateLayout))
+	}
+	return out
+}
+
+func TestCatchUpAfterMissedDays(t *testing.T) {
+	db := seedPruneDB(t)
+	if err := db.UpdateDailyStatsBatch([]*storage.Session{{
+		AppName:         "code",
+		StartTime:       time.Date(2026, 1, 5, 10, 0, 0, 0, time.Local),
+		DurationSeconds: 3600,
+	}}); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+	dir := t.TempDir()
+
+	// Shortly after midnight on the 4th the daemon exports the 3 days before
+	written, err := CatchUp(db, dir, time.Date(2026, 1, 4, 0, 5, 0, 0, time.Local), 3)
+	if err != nil {
+		t.Fatalf("CatchUp failed: %v", err)
+	}
+	if want := []string{"2026-01-01", "2026-01-02", "2026-01-03"}; !reflect.DeepEqual(dates(written), want) {
+		t.Errorf("Expected %v, got %v", want, dates(written))
+	}
+
+	// It was down on the following two nights, so the 4th and 5th are
+	// caught up together and the days already present are skipped
+	now := time.Date(2026, 1, 6, 9, 0, 0, 0, time.Local)
+	written, err = CatchUp(db, dir, now, 3)
+	if err != nil {
+		t.Fatalf("CatchUp failed: %v", err)
+	}
+	if want := []string{"2026-01-04", "2026-01-05"}; !reflect.DeepEqual(dates(written), want) {
+		t.Errorf("Expected %v, got %v", want, dates(written))
+	}
+
+	// Running again writes nothing
+	written, err = CatchUp(db, dir, now, 3)
+	if err != nil || len(written) != 0 {
+		t.Errorf("Expected nothing to export, got %v (%v)", dates(written), err)
+	}
+
+	sessionsFile, dailyFile := DailyFiles(time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local))
+	if sessionsFile != "2026-01-05.sessions.jsonl.gz" {
+		t.Errorf("Unexpected file name %q", sessionsFile)
+	}
+	var sessions []ArchiveRecord
+	for _, line := range readJSONLines(t, filepath.Join(dir, sessionsFile)) {
+		var record ArchiveRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("Failed to decode session: %v", err)
+		}
+		sessions = append(sessions, record)
+	}
+	if len(sessions) != 1 || sessions[0].AppName != "code" || sessions[0].DurationSeconds != 3600 {
+		t.Errorf("Expected the one session of the day, got %+v", sessions)
+	}
+	var daily []DailyRecord
+	for _, line := range readJSONLines(t, filepath.Join(dir, dailyFile)) {
+		var record DailyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("Failed to decode daily total: %v", err)
+		}
+		daily = append(daily, record)
+	}
+	if want := []DailyRecord{{Date: "2026-01-05", AppName: "code", TotalSeconds: 3600}}; !reflect.DeepEqual(daily, want) {
+		t.Errorf("Expected %+v, got %+v", want, daily)
+	}
+}
+
+func TestCatchUpReplacesInterruptedExport(t *testing.T) {
+	db := seedPruneDB(t)
+	dir := t.TempDir()
+
+	// A daily file without its sessions file is an export that stopped
+	// half way
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local)
+	sessionsFile, dailyFile := DailyFiles(day)
+	if err := os.WriteFile(filepath.Join(dir, dailyFile), []byte("partial"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	written, err := CatchUp(db, dir, time.Date(2026, 1, 3, 1, 0, 0, 0, time.Local), 1)
+	if err != nil {
+		t.Fatalf("CatchUp failed: %v", err)
+	}
+	if want := []string{"2026-01-02"}; !reflect.DeepEqual(dates(written), want) {
+		t.Errorf("Expected %v, got %v", want, dates(written))
+	}
+	if _, err := os.Stat(filepath.Join(dir, sessionsFile)); err != nil {
+		t.Errorf("Expected the sessions file to be written: %v", err)
+	}
+	if lines := readJSONLines(t, filepath.Join(dir, dailyFile)); len(lines) != 0 {
+		t.Errorf("Expected no daily totals for a day without them, got %d", len(lines))
+	}
+}
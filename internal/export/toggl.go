@@ -0,0 +1,188 @@
+// Package export writes tracked sessions in formats of other tools
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/weii/actime/internal/format"
+	"github.com/weii/actime/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectRule assigns sessions to a Toggl project. App and Title are
+// regular expressions matched case-insensitively; an empty one matches
+// everything.
+type ProjectRule struct {
+	App     string `yaml:"app"`
+	Title   string `yaml:"title"`
+	Project string `yaml:"project"`
+	Client  string `yaml:"client"`
+}
+
+// Projects resolves sessions to Toggl projects. The first matching rule wins.
+type Projects struct {
+	rules  []ProjectRule
+	apps   []*regexp.Regexp
+	titles []*regexp.Regexp
+}
+
+// NewProjects compiles project rules
+func NewProjects(rules []ProjectRule) (*Projects, error) {
+	p := &Projects{rules: rules}
+	for i, rule := range rules {
+		if rule.Project == "" {
+			return nil, fmt.Errorf("project rule %d has no project", i+1)
+		}
+		app, err := regexp.Compile("(?i)" + rule.App)
+		if err != nil {
+			return nil, fmt.Errorf("invalid app pattern in project rule %d: %w", i+1, err)
+		}
+		title, err := regexp.Compile("(?i)" + rule.Title)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title pattern in project rule %d: %w", i+1, err)
+		}
+		p.apps = append(p.apps, app)
+		p.titles = append(p.titles, title)
+	}
+	return p, nil
+}
+
+// LoadProjects reads a YAML list of project rules
+func LoadProjects(path string) (*Projects, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project map: %w", err)
+	}
+
+	var rules []ProjectRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse project map: %w", err)
+	}
+
+	return NewProjects(rules)
+}
+
+// Resolve returns the project and client of a session. Sessions matching no
+// rule, or any session with a nil Projects, have no project.
+func (p *Projects) Resolve(session *storage.Session) (project, client string) {
+	if p == nil {
+		return "", ""
+	}
+	for i, rule := range p.rules {
+		if p.apps[i].MatchString(session.AppName) && p.titles[i].MatchString(session.WindowTitle) {
+			return rule.Project, rule.Client
+		}
+	}
+	return "", ""
+}
+
+// TogglOptions controls the Toggl export
+type TogglOptions struct {
+	// Email is written to every entry, Toggl requires it for team imports
+	Email string
+	// MinEntry is the shortest entry written on its own; shorter sessions
+	// are merged into an adjacent entry of the same project
+	MinEntry time.Duration
+	// Location is the time zone of the start times, local when nil
+	Location *time.Location
+}
+
+// TogglEntry is one time entry in a Toggl import
+type TogglEntry struct {
+	Client      string
+	Project     string
+	Description string
+	Start       time.Time
+	Duration    time.Duration
+}
+
+// TogglEntries turns sessions into time entries in start order. A session
+// shorter than MinEntry is added to the previous entry when that has the
+// same project, otherwise it takes the next session of the same project
+// along, so a run of short switches does not become many micro-entries.
+func TogglEntries(sessions []*storage.Session, projects *Projects, opts TogglOptions) []TogglEntry {
+	sorted := make([]*storage.Session, len(sessions))
+	copy(sorted, sessions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	var entries []TogglEntry
+	for _, session := range sorted {
+		if session.DurationSeconds <= 0 {
+			continue
+		}
+
+		project, client := projects.Resolve(session)
+		entry := TogglEntry{
+			Client:      client,
+			Project:     project,
+			Description: session.WindowTitle,
+			Start:       session.StartTime,
+			Duration:    time.Duration(session.DurationSeconds) * time.Second,
+		}
+		if entry.Description == "" {
+			entry.Description = session.AppName
+		}
+
+		if n := len(entries); n > 0 && entries[n-1].Project == entry.Project {
+			last := &entries[n-1]
+			switch {
+			case entry.Duration < opts.MinEntry:
+				// Fold a short session into the previous entry
+				last.Duration += entry.Duration
+				continue
+			case last.Duration < opts.MinEntry:
+				// A short previous entry joins this one
+				entry.Start = last.Start
+				entry.Duration += last.Duration
+				entries[n-1] = entry
+				continue
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// togglHeader is the column layout of Toggl's CSV import
+var togglHeader = []string{"Email", "Client", "Project", "Description", "Start date", "Start time", "Duration"}
+
+// WriteToggl writes entries as a Toggl CSV import
+func WriteToggl(w io.Writer, entries []TogglEntry, opts TogglOptions) error {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(togglHeader); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	for _, entry := range entries {
+		start := entry.Start.In(loc)
+		if err := writer.Write([]string{
+			opts.Email,
+			entry.Client,
+			entry.Project,
+			entry.Description,
+			start.Format("2006-01-02"),
+			start.Format("15:04:05"),
+			format.FormatDuration(entry.Duration, format.StyleClock),
+		}); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
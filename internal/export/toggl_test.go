@@ -0,0 +1,124 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// session starts minutes after 09:00 UTC on 2026-01-05 and lasts seconds
+func session(app, title string, minutes, seconds int64) *storage.Session {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+	return &storage.Session{
+		AppName:         app,
+		WindowTitle:     title,
+		StartTime:       start,
+		EndTime:         start.Add(time.Duration(seconds) * time.Second),
+		DurationSeconds: seconds,
+	}
+}
+
+func testProjects(t *testing.T) *Projects {
+	t.Helper()
+	projects, err := LoadProjects(filepath.Join("testdata", "projects.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load projects: %v", err)
+	}
+	return projects
+}
+
+func TestTogglEntriesMergesShortSessions(t *testing.T) {
+	sessions := []*storage.Session{
+		session("code", "db.go - actime", 0, 1800),
+		session("code", "toggl.go - actime", 30, 20), // short, same project: folded into the previous entry
+		session("slack", "general", 31, 40),          // short, no neighbour with its project
+		session("firefox", "docs", 32, 10),           // short, joins the next Internal entry
+		session("code", "notes", 33, 900),
+		session("code", "main.go - actime", 50, 0), // empty sessions are dropped
+	}
+
+	entries := TogglEntries(sessions, testProjects(t), TogglOptions{MinEntry: time.Minute})
+
+	want := []struct {
+		project     string
+		description string
+		start       int64
+		duration    time.Duration
+	}{
+		{"Actime", "db.go - actime", 0, 1820 * time.Second},
+		{"", "general", 31, 40 * time.Second},
+		{"Internal", "notes", 32, 910 * time.Second},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %d: %+v", len(want), len(entries), entries)
+	}
+	for i, w := range want {
+		got := entries[i]
+		start := session("", "", w.start, 0).StartTime
+		if got.Project != w.project || got.Description != w.description || !got.Start.Equal(start) || got.Duration != w.duration {
+			t.Errorf("Entry %d: expected %s %q at %s for %s, got %+v", i, w.project, w.description, start, w.duration, got)
+		}
+	}
+}
+
+func TestTogglEntriesUsesAppWithoutTitle(t *testing.T) {
+	entries := TogglEntries([]*storage.Session{session("terminal", "", 0, 120)}, nil, TogglOptions{})
+	if len(entries) != 1 || entries[0].Description != "terminal" || entries[0].Project != "" {
+		t.Errorf("Expected the app name as description, got %+v", entries)
+	}
+}
+
+func TestWriteTogglGolden(t *testing.T) {
+	sessions := []*storage.Session{
+		session("code", "db.go - actime", 0, 1800),
+		session("code", "toggl.go - actime", 30, 20),
+		session("firefox", "Toggl, CSV import", 31, 4000),
+		session("slack", "general", 120, 3*3600+5),
+	}
+
+	// 09:00 UTC is 10:00 in Berlin in winter
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+	opts := TogglOptions{Email: "me@example.com", MinEntry: time.Minute, Location: berlin}
+
+	var buf bytes.Buffer
+	if err := WriteToggl(&buf, TogglEntries(sessions, testProjects(t), opts), opts); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "toggl.golden.csv")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("CSV does not match %s\ngot:\n%s\nwant:\n%s", golden, buf.Bytes(), want)
+	}
+}
+
+func TestNewProjectsRejectsInvalidRules(t *testing.T) {
+	for _, rules := range [][]ProjectRule{
+		{{App: "code"}},
+		{{App: "(", Project: "x"}},
+		{{Title: "[", Project: "x"}},
+	} {
+		if _, err := NewProjects(rules); err == nil {
+			t.Errorf("Expected an error for %+v", rules)
+		}
+	}
+}
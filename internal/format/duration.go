@@ -0,0 +1,112 @@
+// Package format renders values such as durations for CLI and report output
+package format
+
+import (
+	"fmt"
+	"time"
+)
+
+// Style selects how a duration is rendered
+type Style string
+
+const (
+	// StyleCompact renders hours and zero-padded minutes, e.g. "1h02m"
+	StyleCompact Style = "compact"
+
+	// StyleLong renders every unit from the largest non-zero one, e.g. "1h 2m 3s"
+	StyleLong Style = "long"
+
+	// StyleClock renders a clock-like value, e.g. "01:02:03"
+	StyleClock Style = "clock"
+
+	// StyleDecimal renders fractional hours, e.g. "1.03h"
+	StyleDecimal Style = "decimal"
+)
+
+// DefaultStyle is the style used when none is configured
+const DefaultStyle = StyleLong
+
+// DefaultLanguage is the language used for unknown or empty languages
+const DefaultLanguage = "en"
+
+// units holds the unit words of one language
+type units struct {
+	hour   string
+	minute string
+	second string
+}
+
+// unitWords maps a language to its unit words
+var unitWords = map[string]units{
+	"en": {hour: "h", minute: "m", second: "s"},
+	"zh": {hour: "小时", minute: "分钟", second: "秒"},
+}
+
+// Formatter renders durations in a fixed style and language
+type Formatter struct {
+	Style    Style
+	Language string
+}
+
+// ParseStyle validates a style name. An empty name selects DefaultStyle.
+func ParseStyle(name string) (Style, error) {
+	switch Style(name) {
+	case "":
+		return DefaultStyle, nil
+	case StyleCompact, StyleLong, StyleClock, StyleDecimal:
+		return Style(name), nil
+	default:
+		return "", fmt.Errorf("unknown duration style: %s (expected compact, long, clock or decimal)", name)
+	}
+}
+
+// FormatDuration renders d in the given style with English unit words
+func FormatDuration(d time.Duration, style Style) string {
+	return Formatter{Style: style}.Duration(d)
+}
+
+// Seconds renders a number of seconds
+func (f Formatter) Seconds(seconds int64) string {
+	return f.Duration(time.Duration(seconds) * time.Second)
+}
+
+// Duration renders d, truncated to whole seconds. Hours are not folded into
+// days, so multi-day totals read as e.g. "50h 0m 0s".
+func (f Formatter) Duration(d time.Duration) string {
+	u, ok := unitWords[f.Language]
+	if !ok {
+		u = unitWords[DefaultLanguage]
+	}
+
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+
+	total := int64(d / time.Second)
+	hours := total / 3600
+	minutes := total / 60 % 60
+	seconds := total % 60
+
+	switch f.Style {
+	case StyleCompact:
+		if hours > 0 {
+			return fmt.Sprintf("%s%d%s%02d%s", sign, hours, u.hour, minutes, u.minute)
+		} else if minutes > 0 {
+			return fmt.Sprintf("%s%d%s", sign, minutes, u.minute)
+		}
+		return fmt.Sprintf("%s%d%s", sign, seconds, u.second)
+	case StyleClock:
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, hours, minutes, seconds)
+	case StyleDecimal:
+		return fmt.Sprintf("%s%.2f%s", sign, float64(total)/3600, u.hour)
+	default:
+		if hours > 0 {
+			return fmt.Sprintf("%s%d%s %d%s %d%s", sign, hours, u.hour, minutes, u.minute, seconds, u.second)
+		} else if minutes > 0 {
+			return fmt.Sprintf("%s%d%s %d%s", sign, minutes, u.minute, seconds, u.second)
+		}
+		return fmt.Sprintf("%s%d%s", sign, seconds, u.second)
+	}
+}
@@ -0,0 +1,105 @@
+package format
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		d     time.Duration
+		style Style
+		want  string
+	}{
+		{"zero compact", 0, StyleCompact, "0s"},
+		{"zero long", 0, StyleLong, "0s"},
+		{"zero clock", 0, StyleClock, "00:00:00"},
+		{"zero decimal", 0, StyleDecimal, "0.00h"},
+
+		{"sub-minute compact", 45 * time.Second, StyleCompact, "45s"},
+		{"sub-minute long", 45 * time.Second, StyleLong, "45s"},
+		{"sub-minute clock", 45 * time.Second, StyleClock, "00:00:45"},
+		{"sub-minute decimal", 45 * time.Second, StyleDecimal, "0.01h"},
+
+		{"minutes compact", 2*time.Minute + 3*time.Second, StyleCompact, "2m"},
+		{"minutes long", 2*time.Minute + 3*time.Second, StyleLong, "2m 3s"},
+		{"minutes clock", 2*time.Minute + 3*time.Second, StyleClock, "00:02:03"},
+		{"minutes decimal", 2*time.Minute + 3*time.Second, StyleDecimal, "0.03h"},
+
+		{"one hour compact", time.Hour, StyleCompact, "1h00m"},
+		{"one hour long", time.Hour, StyleLong, "1h 0m 0s"},
+		{"one hour clock", time.Hour, StyleClock, "01:00:00"},
+		{"one hour decimal", time.Hour, StyleDecimal, "1.00h"},
+
+		{"mixed compact", time.Hour + 2*time.Minute + 3*time.Second, StyleCompact, "1h02m"},
+		{"mixed long", time.Hour + 2*time.Minute + 3*time.Second, StyleLong, "1h 2m 3s"},
+		{"mixed clock", time.Hour + 2*time.Minute + 3*time.Second, StyleClock, "01:02:03"},
+		{"mixed decimal", time.Hour + 2*time.Minute + 3*time.Second, StyleDecimal, "1.03h"},
+
+		{"multi-day compact", 50*time.Hour + 30*time.Minute, StyleCompact, "50h30m"},
+		{"multi-day long", 50*time.Hour + 30*time.Minute, StyleLong, "50h 30m 0s"},
+		{"multi-day clock", 50*time.Hour + 30*time.Minute, StyleClock, "50:30:00"},
+		{"multi-day decimal", 50*time.Hour + 30*time.Minute, StyleDecimal, "50.50h"},
+
+		{"fractions are truncated", 1500 * time.Millisecond, StyleLong, "1s"},
+		{"negative", -90 * time.Second, StyleLong, "-1m 30s"},
+		{"unknown style falls back to long", 90 * time.Second, Style("fancy"), "1m 30s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatDuration(tt.d, tt.style); got != tt.want {
+				t.Errorf("FormatDuration(%v, %s) = %q, want %q", tt.d, tt.style, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatterLanguage(t *testing.T) {
+	d := time.Hour + 2*time.Minute + 3*time.Second
+
+	tests := []struct {
+		language string
+		style    Style
+		want     string
+	}{
+		{"zh", StyleLong, "1小时 2分钟 3秒"},
+		{"zh", StyleCompact, "1小时02分钟"},
+		{"zh", StyleDecimal, "1.03小时"},
+		{"zh", StyleClock, "01:02:03"},
+		{"", StyleLong, "1h 2m 3s"},
+		{"fr", StyleLong, "1h 2m 3s"},
+	}
+
+	for _, tt := range tests {
+		f := Formatter{Style: tt.style, Language: tt.language}
+		if got := f.Duration(d); got != tt.want {
+			t.Errorf("Formatter{%s, %q}.Duration = %q, want %q", tt.style, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestFormatterSeconds(t *testing.T) {
+	f := Formatter{Style: StyleLong}
+	if got := f.Seconds(3723); got != "1h 2m 3s" {
+		t.Errorf("Expected 1h 2m 3s, got %q", got)
+	}
+}
+
+func TestParseStyle(t *testing.T) {
+	for _, name := range []string{"compact", "long", "clock", "decimal"} {
+		style, err := ParseStyle(name)
+		if err != nil || string(style) != name {
+			t.Errorf("ParseStyle(%q) = %q, %v", name, style, err)
+		}
+	}
+
+	if style, err := ParseStyle(""); err != nil || style != DefaultStyle {
+		t.Errorf("Expected the default style for an empty name, got %q, %v", style, err)
+	}
+
+	if _, err := ParseStyle("fancy"); err == nil {
+		t.Error("Expected an error for an unknown style")
+	}
+}
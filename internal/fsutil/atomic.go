@@ -0,0 +1,76 @@
+// Package fsutil writes files so that an interrupted write never leaves a
+// truncated file behind
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrExists is returned when the target file exists and may not be replaced
+var ErrExists = errors.New("file already exists")
+
+// Write writes the output of write to path atomically. The data goes to a
+// temporary file in the same directory, which is synced and renamed over
+// path only when write succeeds; on any error the temporary file is
+// removed and path is left as it was. Unless overwrite is set an existing
+// path is refused with ErrExists.
+func Write(path string, perm os.FileMode, overwrite bool, write func(io.Writer) error) error {
+	if !overwrite {
+		if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%s: %w", path, ErrExists)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to check %s: %w", path, err)
+		}
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	if err := writeTemp(tmp, perm, write); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteFile writes data to path atomically, like Write
+func WriteFile(path string, data []byte, perm os.FileMode, overwrite bool) error {
+	return Write(path, perm, overwrite, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeTemp fills and closes the temporary file
+func writeTemp(tmp *os.File, perm os.FileMode, write func(io.Writer) error) error {
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// listDir returns the names of the files in dir
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestWriteFailureKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+	if err := os.WriteFile(path, []byte("good report\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// The write fails halfway through the new content
+	diskFull := errors.New("no space left on device")
+	err := Write(path, 0644, true, func(w io.Writer) error {
+		if _, err := io.WriteString(w, "Date,Application\n2026-01-05,"); err != nil {
+			return err
+		}
+		return diskFull
+	})
+	if !errors.Is(err, diskFull) {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "good report\n" {
+		t.Errorf("Expected the original file untouched, got %q", data)
+	}
+	if names := listDir(t, dir); len(names) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %v", names)
+	}
+}
+
+func TestWriteReplacesOnlyWithOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.csv")
+
+	if err := WriteFile(path, []byte("first\n"), 0600, false); err != nil {
+		t.Fatalf("Failed to write new file: %v", err)
+	}
+	if err := WriteFile(path, []byte("second\n"), 0600, false); !errors.Is(err, ErrExists) {
+		t.Fatalf("Expected ErrExists, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first\n" {
+		t.Errorf("Expected the refused write to keep the file, got %q", data)
+	}
+
+	if err := WriteFile(path, []byte("second\n"), 0600, true); err != nil {
+		t.Fatalf("Failed to overwrite file: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second\n" {
+		t.Errorf("Expected the new content, got %q", data)
+	}
+	// Windows only keeps the read-only bit
+	if info, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0600) {
+		t.Errorf("Expected mode 0600, got %v (%v)", info.Mode(), err)
+	}
+	if names := listDir(t, dir); len(names) != 1 {
+		t.Errorf("Expected only the target file, got %v", names)
+	}
+}
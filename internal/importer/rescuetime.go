@@ -0,0 +1,157 @@
+// Package importer reads usage history exported by other time trackers
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatRescueTime is the import format name of RescueTime exports
+const FormatRescueTime = "rescuetime"
+
+// SourceRescueTime tags rows imported from RescueTime
+const SourceRescueTime = storage.SourceImportPrefix + FormatRescueTime
+
+// Batch is the data read from an export, ready for storage.DB.Import
+type Batch struct {
+	Sessions []*storage.Session
+	Daily    []*storage.DailyStats
+}
+
+// rescueTimeColumns are the columns used from a RescueTime export, found by
+// header name. Productivity has nowhere to go yet.
+var rescueTimeColumns = []string{"date", "time spent", "activity"}
+
+// rescueTimeCategory is the category column, kept on sessions when the
+// export has it
+const rescueTimeCategory = "category"
+
+// ReadRescueTime reads a RescueTime CSV export. Rows dated with a time of
+// day come from the 5-minute interval export and become sessions titled
+// with the activity; date-only rows come from the daily activities export
+// and become daily totals. Activities are mapped to application names
+// through apps. Times are read in the local time zone.
+func ReadRescueTime(r io.Reader, apps *appname.Mapper) (*Batch, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &Batch{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	index := make(map[string]int)
+	wanted := append([]string{rescueTimeCategory}, rescueTimeColumns...)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for _, column := range wanted {
+			if _, ok := index[column]; !ok && strings.HasPrefix(name, column) {
+				index[column] = i
+			}
+		}
+	}
+	for _, column := range rescueTimeColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("not a RescueTime export: missing %q column", column)
+		}
+	}
+
+	batch := &Batch{}
+	daily := make(map[string]*storage.DailyStats)
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read line %d: %w", line, err)
+		}
+		if len(record) < len(header) {
+			return nil, fmt.Errorf("line %d: expected %d fields, got %d", line, len(header), len(record))
+		}
+
+		activity := strings.TrimSpace(record[index["activity"]])
+		app := apps.Canonical(activity)
+		if app == "" {
+			continue
+		}
+
+		seconds, err := strconv.ParseInt(strings.TrimSpace(record[index["time spent"]]), 10, 64)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("line %d: invalid time spent %q", line, record[index["time spent"]])
+		}
+
+		dateField := strings.TrimSpace(record[index["date"]])
+		if date, err := time.ParseInLocation(storage.DateLayout, dateField, time.Local); err == nil {
+			// Activities mapped to the same app are summed per day
+			key := app + "\x00" + dateField
+			if stat, ok := daily[key]; ok {
+				stat.TotalSeconds += seconds
+				continue
+			}
+			stat := &storage.DailyStats{AppName: app, Date: date, TotalSeconds: seconds, Source: SourceRescueTime}
+			daily[key] = stat
+			batch.Daily = append(batch.Daily, stat)
+			continue
+		}
+
+		start, err := parseRescueTimeTime(dateField)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, dateField)
+		}
+		category := ""
+		if i, ok := index[rescueTimeCategory]; ok {
+			category = strings.TrimSpace(record[i])
+		}
+		batch.Sessions = append(batch.Sessions, &storage.Session{
+			AppName:         app,
+			WindowTitle:     activity,
+			StartTime:       start,
+			EndTime:         start.Add(time.Duration(seconds) * time.Second),
+			DurationSeconds: seconds,
+			Source:          SourceRescueTime,
+			Category:        category,
+		})
+	}
+
+	return batch, nil
+}
+
+// parseRescueTimeTime parses the start of an interval row
+func parseRescueTimeTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time: %s", value)
+}
+
+// LoadMapping reads a YAML list of app mapping rules, in the same form as
+// the app_mapping configuration, for renaming imported activities
+func LoadMapping(path string) ([]appname.Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var rules []appname.Rule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping file: %w", err)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,203 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// readFixture reads a RescueTime export from testdata with the test mapping
+func readFixture(t *testing.T, name string) *Batch {
+	t.Helper()
+
+	rules, err := LoadMapping(filepath.Join("testdata", "mapping.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load mapping: %v", err)
+	}
+	apps, err := appname.NewMapper(rules)
+	if err != nil {
+		t.Fatalf("Failed to compile mapping: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	batch, err := ReadRescueTime(f, apps)
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return batch
+}
+
+func TestReadRescueTimeDaily(t *testing.T) {
+	batch := readFixture(t, "rescuetime_daily.csv")
+
+	if len(batch.Sessions) != 0 {
+		t.Errorf("Expected no sessions from the daily export, got %d", len(batch.Sessions))
+	}
+
+	want := []struct {
+		app     string
+		date    string
+		seconds int64
+	}{
+		{"code", "2025-03-03", 3600},
+		{"firefox", "2025-03-03", 1500},
+		{"Slack", "2025-03-04", 900},
+	}
+	if len(batch.Daily) != len(want) {
+		t.Fatalf("Expected %d daily totals, got %d", len(want), len(batch.Daily))
+	}
+	for i, w := range want {
+		got := batch.Daily[i]
+		if got.AppName != w.app || got.Date.Format(storage.DateLayout) != w.date || got.TotalSeconds != w.seconds {
+			t.Errorf("Daily total %d: expected %s %s %ds, got %s %s %ds", i,
+				w.app, w.date, w.seconds, got.AppName, got.Date.Format(storage.DateLayout), got.TotalSeconds)
+		}
+		if got.Source != SourceRescueTime {
+			t.Errorf("Expected source %q, got %q", SourceRescueTime, got.Source)
+		}
+	}
+}
+
+func TestReadRescueTimeInterval(t *testing.T) {
+	batch := readFixture(t, "rescuetime_interval.csv")
+
+	if len(batch.Daily) != 0 {
+		t.Errorf("Expected no daily totals from the interval export, got %d", len(batch.Daily))
+	}
+	if len(batch.Sessions) != 4 {
+		t.Fatalf("Expected 4 sessions, got %d", len(batch.Sessions))
+	}
+
+	first := batch.Sessions[0]
+	start := time.Date(2025, 3, 5, 9, 0, 0, 0, time.Local)
+	if first.AppName != "code" || first.WindowTitle != "Visual Studio Code" {
+		t.Errorf("Expected the activity mapped to code and kept as title, got %+v", first)
+	}
+	if first.Category != "Editing & IDEs" {
+		t.Errorf("Expected the RescueTime category to be kept, got %q", first.Category)
+	}
+	if !first.StartTime.Equal(start) || !first.EndTime.Equal(start.Add(4*time.Minute)) || first.DurationSeconds != 240 {
+		t.Errorf("Unexpected session times: %+v", first)
+	}
+}
+
+func TestReadRescueTimeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+	}{
+		{"missing column", "Date,Activity\n2025-03-03,Slack\n"},
+		{"bad duration", "Date,Time Spent (seconds),Activity\n2025-03-03,soon,Slack\n"},
+		{"bad date", "Date,Time Spent (seconds),Activity\n03/03/2025,60,Slack\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadRescueTime(strings.NewReader(tt.csv), nil); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestImportRescueTimeTwiceAndDelete(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// A tracked session on an imported day must survive the purge
+	tracked := []*storage.Session{{
+		AppName:         "code",
+		StartTime:       time.Date(2025, 3, 3, 14, 0, 0, 0, time.Local),
+		EndTime:         time.Date(2025, 3, 3, 14, 1, 0, 0, time.Local),
+		DurationSeconds: 60,
+	}}
+	if err := db.BatchInsertSessions(tracked); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(tracked); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	daily := readFixture(t, "rescuetime_daily.csv")
+	interval := readFixture(t, "rescuetime_interval.csv")
+
+	for run := 0; run < 2; run++ {
+		for _, batch := range []*Batch{daily, interval} {
+			if _, err := db.Import(SourceRescueTime, batch.Sessions, batch.Daily); err != nil {
+				t.Fatalf("Import %d failed: %v", run+1, err)
+			}
+		}
+	}
+
+	// The two exports cover different days; both describe the same time, so
+	// importing both for one day would count it twice
+	tests := []struct {
+		day  time.Time
+		want map[string]int64
+	}{
+		{time.Date(2025, 3, 3, 0, 0, 0, 0, time.Local), map[string]int64{"code": 3660, "firefox": 1500}},
+		{time.Date(2025, 3, 5, 0, 0, 0, 0, time.Local), map[string]int64{"code": 540, "firefox": 60, "Slack": 120}},
+	}
+	for _, tt := range tests {
+		totals := dailyTotals(t, db, tt.day)
+		for app, seconds := range tt.want {
+			if totals[app] != seconds {
+				t.Errorf("Expected %s to have %ds on %s after importing twice, got %d",
+					app, seconds, tt.day.Format(storage.DateLayout), totals[app])
+			}
+		}
+	}
+
+	sessions, err := db.GetSessions(&storage.StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read sessions: %v", err)
+	}
+	if len(sessions) != 5 {
+		t.Errorf("Expected 4 imported and 1 tracked session, got %d", len(sessions))
+	}
+
+	deletedSessions, deletedDays, err := db.DeleteSource(&storage.StatsQuery{Source: SourceRescueTime})
+	if err != nil {
+		t.Fatalf("Failed to delete imported data: %v", err)
+	}
+	if deletedSessions != 4 {
+		t.Errorf("Expected 4 imported sessions deleted, got %d", deletedSessions)
+	}
+	if deletedDays == 0 {
+		t.Error("Expected imported daily totals to be deleted")
+	}
+
+	totals := dailyTotals(t, db, tests[0].day)
+	if len(totals) != 1 || totals["code"] != 60 {
+		t.Errorf("Expected only the tracked minute to remain, got %v", totals)
+	}
+}
+
+// dailyTotals returns the seconds per app on one day
+func dailyTotals(t *testing.T, db *storage.DB, day time.Time) map[string]int64 {
+	t.Helper()
+
+	stats, err := db.GetDailyStats(&storage.StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to read daily stats: %v", err)
+	}
+
+	totals := make(map[string]int64)
+	for _, stat := range stats {
+		totals[stat.AppName] += stat.TotalSeconds
+	}
+	return totals
+}
@@ -0,0 +1,193 @@
+// Package logview reads the daemon's log files for `actimed log`
+package logview
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is the part of a log line the filters look at
+type Entry struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+}
+
+// Parse reads a line written by slog's text or JSON handler, telling the
+// two apart by the line itself, so a file written before a format change
+// still reads. Lines that are neither, such as the rest of a panic, do not
+// parse.
+func Parse(line string) (Entry, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		return parseJSON(line)
+	}
+	return parseText(line)
+}
+
+// parseJSON reads a line of slog's JSON handler
+func parseJSON(line string) (Entry, bool) {
+	var record struct {
+		Time  time.Time `json:"time"`
+		Level string    `json:"level"`
+		Msg   string    `json:"msg"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return Entry{}, false
+	}
+
+	entry := Entry{Time: record.Time, Message: record.Msg}
+	if err := entry.Level.UnmarshalText([]byte(record.Level)); err != nil {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// parseText reads the leading time, level and msg attributes of a line of
+// slog's text handler
+func parseText(line string) (Entry, bool) {
+	var entry Entry
+	var hasTime, hasLevel bool
+	for line != "" && !(hasTime && hasLevel && entry.Message != "") {
+		key, value, rest, ok := nextAttr(line)
+		if !ok {
+			break
+		}
+		line = rest
+
+		switch key {
+		case "time":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return Entry{}, false
+			}
+			entry.Time = t
+			hasTime = true
+		case "level":
+			if err := entry.Level.UnmarshalText([]byte(value)); err != nil {
+				return Entry{}, false
+			}
+			hasLevel = true
+		case "msg":
+			entry.Message = value
+		}
+	}
+	return entry, hasTime && hasLevel
+}
+
+// nextAttr splits the first key=value pair off s. Quoted values are
+// unquoted.
+func nextAttr(s string) (key, value, rest string, ok bool) {
+	s = strings.TrimLeft(s, " ")
+	eq := strings.IndexByte(s, '=')
+	if eq <= 0 || strings.ContainsAny(s[:eq], " \"") {
+		return "", "", "", false
+	}
+	key, s = s[:eq], s[eq+1:]
+
+	if strings.HasPrefix(s, `"`) {
+		// Find the closing quote, skipping escaped ones
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", "", "", false
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", "", "", false
+		}
+		return key, value, s[end+1:], true
+	}
+
+	if space := strings.IndexByte(s, ' '); space >= 0 {
+		return key, s[:space], s[space:], true
+	}
+	return key, s, "", true
+}
+
+// Filter selects log lines. The zero value keeps info and above from any
+// time.
+type Filter struct {
+	Level   slog.Level
+	Pattern *regexp.Regexp
+	Since   time.Time
+}
+
+// Matcher applies a filter to the lines of a file in order
+type Matcher struct {
+	filter Filter
+	last   bool
+}
+
+// Matcher returns a matcher for the lines of one file
+func (f Filter) Matcher() *Matcher {
+	return &Matcher{filter: f}
+}
+
+// Match reports whether line passes the filter. A line that does not parse
+// goes with the line before it, so a multi-line message is kept or dropped
+// as a whole.
+func (m *Matcher) Match(line string) bool {
+	entry, ok := Parse(line)
+	if !ok {
+		return m.last
+	}
+
+	m.last = entry.Level >= m.filter.Level &&
+		(m.filter.Since.IsZero() || !entry.Time.Before(m.filter.Since)) &&
+		(m.filter.Pattern == nil || m.filter.Pattern.MatchString(line))
+	return m.last
+}
+
+// Files returns the rotated backups of the log at path, oldest first,
+// followed by path itself. Backups are numbered path.1, path.2 and so on,
+// the highest being the newest. Backups last written before since cannot
+// hold a later line and are left out.
+func Files(path string, since time.Time) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		path string
+		n    int
+	}
+	var backups []backup
+	prefix := filepath.Base(path) + "."
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), prefix))
+		if err != nil || n <= 0 {
+			continue
+		}
+		if !since.IsZero() {
+			info, err := entry.Info()
+			if err != nil || info.ModTime().Before(since) {
+				continue
+			}
+		}
+		backups = append(backups, backup{filepath.Join(filepath.Dir(path), entry.Name()), n})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].n < backups[j].n })
+
+	files := make([]string, 0, len(backups)+1)
+	for _, b := range backups {
+		files = append(files, b.path)
+	}
+	return append(files, path), nil
+}
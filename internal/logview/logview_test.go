@@ -0,0 +1,153 @@
+package logview
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// messages returns the msg of every line of the fixture that passes filter,
+// and "+" for lines that do not parse
+func messages(t *testing.T, path string, filter Filter) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer file.Close()
+
+	var got []string
+	matcher := filter.Matcher()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if !matcher.Match(scanner.Text()) {
+			continue
+		}
+		if entry, ok := Parse(scanner.Text()); ok {
+			got = append(got, entry.Message)
+		} else {
+			got = append(got, "+")
+		}
+	}
+	return got
+}
+
+func TestFilterFixtures(t *testing.T) {
+	zone := time.FixedZone("CET", 3600)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{
+			name:   "debug keeps everything",
+			filter: Filter{Level: slog.LevelDebug},
+			want:   []string{"Service started", "Slow query", "Detector failing", "Failed to flush sessions", "+", "+", "Detector recovered"},
+		},
+		{
+			name:   "zero value hides debug",
+			filter: Filter{},
+			want:   []string{"Service started", "Detector failing", "Failed to flush sessions", "+", "+", "Detector recovered"},
+		},
+		{
+			// The stack trace goes with its error line
+			name:   "minimum level",
+			filter: Filter{Level: slog.LevelWarn},
+			want:   []string{"Detector failing", "Failed to flush sessions", "+", "+"},
+		},
+		{
+			name:   "regexp",
+			filter: Filter{Level: slog.LevelDebug, Pattern: regexp.MustCompile(`detector=x11|"detector":"x11"`)},
+			want:   []string{"Detector failing", "Detector recovered"},
+		},
+		{
+			name:   "since",
+			filter: Filter{Since: time.Date(2026, 3, 2, 9, 5, 0, 0, zone)},
+			want:   []string{"Detector failing", "Failed to flush sessions", "+", "+", "Detector recovered"},
+		},
+	}
+
+	for _, format := range []string{"text", "json"} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				got := messages(t, filepath.Join("testdata", format+".log"), tt.filter)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Expected %q, got %q", tt.want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	entry, ok := Parse(`time=2026-03-02T09:05:00.123Z level=WARN+2 msg="say \"hi\" = ok" n=1`)
+	if !ok {
+		t.Fatal("Expected the text line to parse")
+	}
+	if entry.Level != slog.LevelWarn+2 || entry.Message != `say "hi" = ok` || entry.Time.Nanosecond() != 123000000 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	for _, line := range []string{"", "goroutine 1 [running]:", "level=INFO msg=no-time", `{"msg":"no level"}`, "{broken"} {
+		if _, ok := Parse(line); ok {
+			t.Errorf("Expected %q not to parse", line)
+		}
+	}
+}
+
+func TestFilesAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "actime.log")
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	// actime.log.1 was rotated two days ago, actime.log.2 half an hour ago
+	write := func(name string, modTime time.Time, lines ...string) {
+		t.Helper()
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set time of %s: %v", name, err)
+		}
+	}
+	write("actime.log.1", now.Add(-48*time.Hour), "time=2026-02-28T12:00:00Z level=INFO msg=old")
+	write("actime.log.2", now.Add(-30*time.Minute),
+		"time=2026-03-02T10:30:00Z level=INFO msg=before",
+		"time=2026-03-02T11:20:00Z level=INFO msg=rotated")
+	write("actime.log", now, "time=2026-03-02T11:50:00Z level=INFO msg=current")
+	write("actime.log.bak", now, "time=2026-03-02T11:50:00Z level=INFO msg=unrelated")
+
+	since := now.Add(-time.Hour)
+	files, err := Files(path, since)
+	if err != nil {
+		t.Fatalf("Files failed: %v", err)
+	}
+	want := []string{filepath.Join(dir, "actime.log.2"), path}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("Expected %v, got %v", want, files)
+	}
+
+	var got []string
+	for _, file := range files {
+		got = append(got, messages(t, file, Filter{Since: since})...)
+	}
+	if want := []string{"rotated", "current"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v across the rotation, got %v", want, got)
+	}
+
+	// Without a start time every backup is read, oldest first
+	files, err = Files(path, time.Time{})
+	if err != nil {
+		t.Fatalf("Files failed: %v", err)
+	}
+	if len(files) != 3 || files[0] != filepath.Join(dir, "actime.log.1") {
+		t.Errorf("Expected all backups oldest first, got %v", files)
+	}
+}
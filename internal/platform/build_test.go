@@ -0,0 +1,33 @@
+package platform
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// TestDetectorsCrossCompile vets the detector package for every supported
+// platform, with cgo disabled, so a Linux CI catches Windows, macOS and arm64
+// build breaks
+func TestDetectorsCrossCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross-compiling is slow")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	for _, goos := range []string{"linux", "windows", "darwin"} {
+		for _, goarch := range []string{"amd64", "arm64"} {
+			t.Run(goos+"/"+goarch, func(t *testing.T) {
+				cmd := exec.Command(goBin, "vet", ".")
+				// A test must not rewrite go.mod
+				cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0", "GOFLAGS=-mod=readonly")
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Errorf("go vet failed: %v\n%s", err, out)
+				}
+			})
+		}
+	}
+}
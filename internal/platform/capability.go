@@ -0,0 +1,144 @@
+package platform
+
+import (
+	"fmt"
+	"time"
+)
+
+// The capabilities of a detector the tracker relies on
+const (
+	CapabilityActiveWindow = "active_window"
+	CapabilityIdle         = "idle"
+	CapabilityLock         = "lock"
+)
+
+// Capability is one thing a detector tells the tracker, how it does so on
+// this system and whether it answered when asked
+type Capability struct {
+	Name      string `json:"name"`
+	Supported bool   `json:"supported"`
+	Working   bool   `json:"working"`
+	Method    string `json:"method,omitempty"` // such as "MIT-SCREEN-SAVER"
+	// Detail is the answer of the probe, or why the capability is not
+	// supported or failed
+	Detail string `json:"detail,omitempty"`
+	// Hint tells what to do about a capability that is missing or limited
+	Hint string `json:"hint,omitempty"`
+}
+
+// CapabilityReporter is implemented by detectors that know how, and
+// whether, they can tell each capability on this system. Detectors that do
+// not implement it are taken to support every capability.
+type CapabilityReporter interface {
+	Capabilities() []Capability
+}
+
+// ProbeCapabilities asks an initialized detector once for each capability
+// it supports and reports which answered
+func ProbeCapabilities(d Detector) []Capability {
+	capabilities := []Capability{
+		{Name: CapabilityActiveWindow, Supported: true},
+		{Name: CapabilityIdle, Supported: true},
+		{Name: CapabilityLock, Supported: true},
+	}
+	if reporter, ok := d.(CapabilityReporter); ok {
+		for _, reported := range reporter.Capabilities() {
+			for i := range capabilities {
+				if capabilities[i].Name == reported.Name {
+					capabilities[i] = reported
+				}
+			}
+		}
+	}
+
+	for i := range capabilities {
+		c := &capabilities[i]
+		if !c.Supported {
+			c.Working = false
+			continue
+		}
+		var err error
+		switch c.Name {
+		case CapabilityActiveWindow:
+			var window *WindowInfo
+			if window, err = d.GetActiveWindow(); err == nil {
+				c.Detail = "no window has the focus"
+				if window != NoWindow {
+					c.Detail = "focused: " + window.AppName
+				}
+			}
+		case CapabilityIdle:
+			var idle time.Duration
+			if idle, err = d.GetIdleTime(); err == nil {
+				c.Detail = fmt.Sprintf("idle for %s", idle.Round(time.Second))
+			}
+		case CapabilityLock:
+			var locked bool
+			if locked, err = d.IsScreenLocked(); err == nil {
+				c.Detail = "screen unlocked"
+				if locked {
+					c.Detail = "screen locked"
+				}
+			}
+		}
+		c.Working = err == nil
+		if err != nil {
+			c.Detail = err.Error()
+		}
+	}
+	return capabilities
+}
+
+// Diagnosis is what Diagnose found out about the platform detector
+type Diagnosis struct {
+	// DetectorError is why the detector could not be initialized, in which
+	// case nothing was probed
+	DetectorError error
+	// IdleSourceError is why the evdev idle source could not be used, so
+	// the detector's own idle source was probed instead
+	IdleSourceError error
+	Capabilities    []Capability
+}
+
+// Diagnose initializes the platform detector as the daemon would, probes
+// each of its capabilities once and closes it again. evdevIdle reads the
+// idle time from the input devices, as monitor.idle_source: evdev asks.
+func Diagnose(names []string, timeout time.Duration, evdevIdle bool) *Diagnosis {
+	diagnosis := &Diagnosis{}
+	if err := InitializePlatformDetector(names, timeout); err != nil {
+		diagnosis.DetectorError = err
+		return diagnosis
+	}
+	defer ClosePlatformDetector()
+
+	if evdevIdle {
+		diagnosis.IdleSourceError = UseEvdevIdle()
+	}
+	diagnosis.Capabilities = ProbeCapabilities(PlatformDetector)
+	return diagnosis
+}
+
+// Healthy reports whether the detector started, the idle source asked for
+// could be used and every capability works
+func (d *Diagnosis) Healthy() bool {
+	if d.DetectorError != nil || d.IdleSourceError != nil {
+		return false
+	}
+	for _, capability := range d.Capabilities {
+		if !capability.Working {
+			return false
+		}
+	}
+	return true
+}
+
+// Capability returns the probed capability of the given name, or nil when
+// it was not probed
+func (d *Diagnosis) Capability(name string) *Capability {
+	for i := range d.Capabilities {
+		if d.Capabilities[i].Name == name {
+			return &d.Capabilities[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package platform
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// limitedDetector is a fakeDetector that cannot tell the idle time
+type limitedDetector struct {
+	fakeDetector
+	idleCalls int
+}
+
+func (d *limitedDetector) GetIdleTime() (time.Duration, error) {
+	d.idleCalls++
+	return 0, nil
+}
+
+func (d *limitedDetector) Capabilities() []Capability {
+	return []Capability{
+		{Name: CapabilityActiveWindow, Supported: true, Method: "fake windows"},
+		{Name: CapabilityIdle, Detail: "no idle source", Hint: "add one"},
+	}
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	capabilities := ProbeCapabilities(&fakeDetector{app: "editor", idle: 90 * time.Second})
+	want := []Capability{
+		{Name: CapabilityActiveWindow, Supported: true, Working: true, Detail: "focused: editor"},
+		{Name: CapabilityIdle, Supported: true, Working: true, Detail: "idle for 1m30s"},
+		{Name: CapabilityLock, Supported: true, Working: true, Detail: "screen unlocked"},
+	}
+	if len(capabilities) != len(want) {
+		t.Fatalf("Expected %d capabilities, got %+v", len(want), capabilities)
+	}
+	for i := range want {
+		if capabilities[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], capabilities[i])
+		}
+	}
+
+	// Failing calls do not work
+	failing := ProbeCapabilities(&fakeDetector{err: errors.New("no display")})
+	for _, capability := range failing {
+		if !capability.Supported || capability.Working || capability.Detail != "no display" {
+			t.Errorf("Expected %s to be supported but failing with the error, got %+v", capability.Name, capability)
+		}
+	}
+
+	// Unsupported capabilities are not asked for
+	limited := &limitedDetector{fakeDetector: fakeDetector{app: "editor"}}
+	capabilities = ProbeCapabilities(limited)
+	if limited.idleCalls != 0 {
+		t.Errorf("Expected the unsupported idle time not to be asked for, got %d calls", limited.idleCalls)
+	}
+	if c := capabilities[0]; !c.Working || c.Method != "fake windows" {
+		t.Errorf("Expected the active window to work by the reported method, got %+v", c)
+	}
+	if c := capabilities[1]; c.Supported || c.Working || c.Hint != "add one" {
+		t.Errorf("Expected the idle time unsupported with the hint, got %+v", c)
+	}
+	if c := capabilities[2]; !c.Supported || !c.Working {
+		t.Errorf("Expected the unreported lock state to be taken as supported, got %+v", c)
+	}
+}
+
+func TestMultiDetectorCapabilities(t *testing.T) {
+	m := NewMultiDetector([]NamedDetector{
+		{Name: "wayland", Detector: &limitedDetector{}},
+		{Name: "x11", Detector: &fakeDetector{}},
+	}, 50*time.Millisecond)
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+
+	capabilities := m.Capabilities()
+	methods := map[string]string{}
+	for _, c := range capabilities {
+		if !c.Supported {
+			t.Errorf("Expected %s to be supported by one of the detectors, got %+v", c.Name, c)
+		}
+		methods[c.Name] = c.Method
+	}
+	want := map[string]string{
+		CapabilityActiveWindow: "wayland: fake windows",
+		CapabilityIdle:         "x11",
+		CapabilityLock:         "wayland",
+	}
+	for name, method := range want {
+		if methods[name] != method {
+			t.Errorf("Expected %s by %q, got %q", name, method, methods[name])
+		}
+	}
+}
+
+func TestDiagnosisHealthy(t *testing.T) {
+	diagnosis := &Diagnosis{Capabilities: ProbeCapabilities(&fakeDetector{app: "editor"})}
+	if !diagnosis.Healthy() {
+		t.Errorf("Expected every working capability to be healthy, got %+v", diagnosis)
+	}
+	if c := diagnosis.Capability(CapabilityIdle); c == nil || !c.Working {
+		t.Errorf("Expected the idle capability to be found, got %+v", c)
+	}
+
+	diagnosis.IdleSourceError = errors.New("no input device")
+	if diagnosis.Healthy() {
+		t.Error("Expected an unusable idle source to be unhealthy")
+	}
+
+	limited := &Diagnosis{Capabilities: ProbeCapabilities(&limitedDetector{fakeDetector: fakeDetector{app: "editor"}})}
+	if limited.Healthy() {
+		t.Error("Expected an unsupported capability to be unhealthy")
+	}
+
+	failed := &Diagnosis{DetectorError: errors.New("no display")}
+	if failed.Healthy() || failed.Capability(CapabilityActiveWindow) != nil {
+		t.Errorf("Expected a detector that did not start to be unhealthy with nothing probed, got %+v", failed)
+	}
+}
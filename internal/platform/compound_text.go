@@ -0,0 +1,204 @@
+package platform
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// ctCharset is a character set of COMPOUND_TEXT. decode gets the bytes of
+// a run with the high bit set, as they are when the set is invoked into GR.
+type ctCharset struct {
+	width  int
+	decode func(b []byte) string
+}
+
+// ctEncoded decodes runs with an encoding whose upper half is the set
+func ctEncoded(width int, enc encoding.Encoding) *ctCharset {
+	return &ctCharset{width: width, decode: func(b []byte) string {
+		s, err := enc.NewDecoder().Bytes(b)
+		if err != nil {
+			return strings.Repeat(string(utf8.RuneError), len(b)/width)
+		}
+		return string(s)
+	}}
+}
+
+var (
+	ctASCII = &ctCharset{width: 1, decode: func(b []byte) string {
+		s := make([]byte, len(b))
+		for i, c := range b {
+			s[i] = c &^ 0x80
+		}
+		return string(s)
+	}}
+	ctKatakana = &ctCharset{width: 1, decode: func(b []byte) string {
+		runes := make([]rune, 0, len(b))
+		for _, c := range b {
+			if c >= 0xa1 && c <= 0xdf {
+				runes = append(runes, 0xff61+rune(c-0xa1))
+			} else {
+				runes = append(runes, utf8.RuneError)
+			}
+		}
+		return string(runes)
+	}}
+	ctLatin1 = ctEncoded(1, charmap.ISO8859_1)
+)
+
+// ctUnknown stands in for a set this decoder does not know, one
+// replacement character per character
+func ctUnknown(width int) *ctCharset {
+	return &ctCharset{width: width, decode: func(b []byte) string {
+		return strings.Repeat(string(utf8.RuneError), (len(b)+width-1)/width)
+	}}
+}
+
+// ctSets94 are the 94-character sets by final byte of their designation
+var ctSets94 = map[byte]*ctCharset{
+	'B': ctASCII,
+	'J': ctASCII, // JIS X 0201 Roman differs in two characters only
+	'I': ctKatakana,
+}
+
+// ctSets96 are the 96-character sets, the right halves of ISO 8859
+var ctSets96 = map[byte]*ctCharset{
+	'A': ctLatin1,
+	'B': ctEncoded(1, charmap.ISO8859_2),
+	'C': ctEncoded(1, charmap.ISO8859_3),
+	'D': ctEncoded(1, charmap.ISO8859_4),
+	'F': ctEncoded(1, charmap.ISO8859_7),
+	'G': ctEncoded(1, charmap.ISO8859_6),
+	'H': ctEncoded(1, charmap.ISO8859_8),
+	'L': ctEncoded(1, charmap.ISO8859_5),
+	'M': ctEncoded(1, charmap.ISO8859_9),
+	'b': ctEncoded(1, charmap.ISO8859_15),
+}
+
+// ctSets94x94 are the two-byte sets, decoded through the EUC encoding
+// that puts them in GR
+var ctSets94x94 = map[byte]*ctCharset{
+	'@': ctEncoded(2, japanese.EUCJP),
+	'A': ctEncoded(2, simplifiedchinese.GBK),
+	'B': ctEncoded(2, japanese.EUCJP),
+	'C': ctEncoded(2, korean.EUCKR),
+}
+
+// decodeCompoundText decodes a COMPOUND_TEXT property, the ISO 2022 text
+// that Xlib writes for titles outside Latin-1. GL starts as ASCII and GR
+// as Latin-1; escape sequences designate other sets, and UTF-8 segments
+// are taken as they are. Sets it does not know decode to replacement
+// characters.
+func decodeCompoundText(value []byte) string {
+	gl, gr := ctASCII, ctLatin1
+
+	var b strings.Builder
+	var run []byte
+	var runSet *ctCharset
+	flush := func() {
+		if len(run) > 0 {
+			b.WriteString(runSet.decode(run))
+			run = run[:0]
+		}
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == 0x1b:
+			flush()
+			j := i + 1
+			for j < len(value) && value[j] >= 0x20 && value[j] <= 0x2f {
+				j++
+			}
+			if j >= len(value) {
+				return b.String()
+			}
+			intermediate, final := string(value[i+1:j]), value[j]
+			i = j
+
+			switch intermediate {
+			case "(":
+				gl = ctLookup(ctSets94, final, 1)
+			case ")":
+				gr = ctLookup(ctSets94, final, 1)
+			case "-":
+				gr = ctLookup(ctSets96, final, 1)
+			case "$", "$(":
+				gl = ctLookup(ctSets94x94, final, 2)
+			case "$)":
+				gr = ctLookup(ctSets94x94, final, 2)
+			case "%":
+				if final == 'G' {
+					// UTF-8 up to the sequence that returns to ISO 2022
+					rest := value[i+1:]
+					end := bytes.Index(rest, []byte("\x1b%@"))
+					if end < 0 {
+						end = len(rest)
+					}
+					b.WriteString(strings.ToValidUTF8(string(rest[:end]), string(utf8.RuneError)))
+					i += end + 3
+				}
+			case "%/":
+				// An extended segment: two length bytes, then the name of
+				// its encoding ended by STX, then the text
+				if i+2 >= len(value) {
+					return b.String()
+				}
+				length := int(value[i+1]&0x7f)*128 + int(value[i+2]&0x7f)
+				i += 2
+				segment := value[i+1 : min(i+1+length, len(value))]
+				i += len(segment)
+				if name, text, ok := bytes.Cut(segment, []byte{0x02}); ok {
+					switch strings.ToLower(string(name)) {
+					case "iso10646-1", "utf-8":
+						b.WriteString(strings.ToValidUTF8(string(text), string(utf8.RuneError)))
+					default:
+						b.WriteRune(utf8.RuneError)
+					}
+				}
+			}
+		case c == 0x9b:
+			// A control sequence, such as a change of direction
+			flush()
+			for i+1 < len(value) && (value[i+1] < 0x40 || value[i+1] > 0x7e) {
+				i++
+			}
+			i++
+		case c == ' ' || c < 0x20 || c == 0x7f:
+			flush()
+			b.WriteByte(c)
+		case c >= 0x80 && c < 0xa0:
+			// Other C1 controls carry no text
+			flush()
+		case c < 0x80:
+			if runSet != gl {
+				flush()
+				runSet = gl
+			}
+			run = append(run, c|0x80)
+		default:
+			if runSet != gr {
+				flush()
+				runSet = gr
+			}
+			run = append(run, c)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// ctLookup returns the set with the given final byte
+func ctLookup(sets map[byte]*ctCharset, final byte, width int) *ctCharset {
+	if set, ok := sets[final]; ok {
+		return set
+	}
+	return ctUnknown(width)
+}
@@ -0,0 +1,187 @@
+//go:build darwin && cgo
+
+package platform
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework AppKit -framework CoreGraphics
+
+#import <AppKit/AppKit.h>
+#import <CoreGraphics/CoreGraphics.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	char *app;
+	char *title;
+	char *path;
+	int pid;
+} actime_window;
+
+static char *actime_strdup(NSString *s) {
+	const char *utf8 = s == nil ? NULL : [s UTF8String];
+	return strdup(utf8 == NULL ? "" : utf8);
+}
+
+// actime_active_window fills w with the application that has the focus, its
+// executable and the title of its front window, and returns 0 when no
+// application has the focus. The caller frees the strings.
+static int actime_active_window(actime_window *w) {
+	@autoreleasepool {
+		// frontmostApplication is only refreshed by a run loop, which the
+		// daemon does not have, so the owner of the frontmost normal window
+		// is asked first
+		pid_t pid = 0;
+		NSString *title = nil;
+		CFArrayRef list = CGWindowListCopyWindowInfo(
+			kCGWindowListOptionOnScreenOnly | kCGWindowListExcludeDesktopElements, kCGNullWindowID);
+		if (list != NULL) {
+			NSArray *windows = (NSArray *)list;
+			for (NSDictionary *window in windows) {
+				if ([window[(id)kCGWindowLayer] intValue] != 0) {
+					continue;
+				}
+				pid = [window[(id)kCGWindowOwnerPID] intValue];
+				// Empty without the Screen Recording permission
+				title = window[(id)kCGWindowName];
+				break;
+			}
+			CFRelease(list);
+		}
+
+		NSRunningApplication *app = nil;
+		if (pid != 0) {
+			app = [NSRunningApplication runningApplicationWithProcessIdentifier:pid];
+		}
+		if (app == nil) {
+			app = [[NSWorkspace sharedWorkspace] frontmostApplication];
+			title = nil;
+		}
+		if (app == nil) {
+			return 0;
+		}
+
+		NSString *name = app.localizedName;
+		if (name == nil) {
+			name = app.bundleIdentifier;
+		}
+		w->app = actime_strdup(name);
+		w->title = actime_strdup(title);
+		w->path = actime_strdup(app.executableURL.path);
+		w->pid = app.processIdentifier;
+		return 1;
+	}
+}
+
+// actime_idle_seconds returns the seconds since the last input event
+static double actime_idle_seconds(void) {
+	return CGEventSourceSecondsSinceLastEventType(kCGEventSourceStateCombinedSessionState, kCGAnyInputEventType);
+}
+
+// actime_screen_locked returns 1 when the screen is locked or the session
+// is switched away from, 0 when not, and -1 without a window server session
+static int actime_screen_locked(void) {
+	CFDictionaryRef session = CGSessionCopyCurrentDictionary();
+	if (session == NULL) {
+		return -1;
+	}
+	int locked = 0;
+	CFBooleanRef screenLocked = CFDictionaryGetValue(session, CFSTR("CGSSessionScreenIsLocked"));
+	if (screenLocked != NULL && CFBooleanGetValue(screenLocked)) {
+		locked = 1;
+	}
+	CFBooleanRef onConsole = CFDictionaryGetValue(session, kCGSessionOnConsoleKey);
+	if (onConsole != NULL && !CFBooleanGetValue(onConsole)) {
+		locked = 1;
+	}
+	CFRelease(session);
+	return locked;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// DarwinDetector implements Detector for macOS with AppKit and CoreGraphics.
+// The frontmost window and its owner come from CGWindowListCopyWindowInfo,
+// the idle time from CGEventSourceSecondsSinceLastEventType and the lock
+// state from the CGSession dictionary. Window titles need the Screen
+// Recording permission since macOS 10.15; without it they are empty.
+type DarwinDetector struct {
+	initialized bool
+}
+
+// NewDarwinDetector creates a new macOS detector
+func NewDarwinDetector() *DarwinDetector {
+	return &DarwinDetector{}
+}
+
+// Initialize checks that the process runs in a window server session
+func (d *DarwinDetector) Initialize() error {
+	if C.actime_screen_locked() < 0 {
+		return fmt.Errorf("no window server session; run actimed from a logged in user session")
+	}
+	d.initialized = true
+	return nil
+}
+
+// GetActiveWindow returns the active window information
+func (d *DarwinDetector) GetActiveWindow() (*WindowInfo, error) {
+	if !d.initialized {
+		return nil, fmt.Errorf("detector not initialized")
+	}
+
+	var window C.actime_window
+	if C.actime_active_window(&window) == 0 {
+		return NoWindow, nil
+	}
+	defer C.free(unsafe.Pointer(window.app))
+	defer C.free(unsafe.Pointer(window.title))
+	defer C.free(unsafe.Pointer(window.path))
+
+	appName := C.GoString(window.app)
+	if appName == "" {
+		appName = "Unknown"
+	}
+	return &WindowInfo{
+		AppName:     appName,
+		WindowTitle: CleanTitle(C.GoString(window.title)),
+		PID:         int32(window.pid),
+		ExePath:     C.GoString(window.path),
+	}, nil
+}
+
+// GetIdleTime returns the time since the last input event
+func (d *DarwinDetector) GetIdleTime() (time.Duration, error) {
+	if !d.initialized {
+		return 0, fmt.Errorf("detector not initialized")
+	}
+	seconds := float64(C.actime_idle_seconds())
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// IsScreenLocked returns true if the screen is locked. A session that fast
+// user switching moved off the console counts as locked.
+func (d *DarwinDetector) IsScreenLocked() (bool, error) {
+	if !d.initialized {
+		return false, fmt.Errorf("detector not initialized")
+	}
+	switch C.actime_screen_locked() {
+	case -1:
+		return false, fmt.Errorf("failed to get the window server session")
+	case 1:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// Close releases nothing; the detector holds no resources
+func (d *DarwinDetector) Close() error {
+	d.initialized = false
+	return nil
+}
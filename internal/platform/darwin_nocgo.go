@@ -0,0 +1,48 @@
+//go:build darwin && !cgo
+
+package platform
+
+import (
+	"errors"
+	"time"
+)
+
+// DarwinDetector implements Detector for macOS. The detector calls AppKit
+// and CoreGraphics through cgo; a build without cgo cannot detect anything.
+type DarwinDetector struct{}
+
+// NewDarwinDetector creates a new macOS detector
+func NewDarwinDetector() *DarwinDetector {
+	return &DarwinDetector{}
+}
+
+// errNoCgo is returned by every call of a detector built without cgo
+var errNoCgo = errors.New("the macOS detector needs a build with cgo enabled")
+
+// Capabilities reports that nothing can be detected
+func (d *DarwinDetector) Capabilities() []Capability {
+	var capabilities []Capability
+	for _, name := range []string{CapabilityActiveWindow, CapabilityIdle, CapabilityLock} {
+		capabilities = append(capabilities, Capability{
+			Name:   name,
+			Detail: errNoCgo.Error(),
+			Hint:   "rebuild with CGO_ENABLED=1",
+		})
+	}
+	return capabilities
+}
+
+// Initialize fails: there is nothing to detect with
+func (d *DarwinDetector) Initialize() error { return errNoCgo }
+
+// GetActiveWindow fails without cgo
+func (d *DarwinDetector) GetActiveWindow() (*WindowInfo, error) { return nil, errNoCgo }
+
+// GetIdleTime fails without cgo
+func (d *DarwinDetector) GetIdleTime() (time.Duration, error) { return 0, errNoCgo }
+
+// IsScreenLocked fails without cgo
+func (d *DarwinDetector) IsScreenLocked() (bool, error) { return false, errNoCgo }
+
+// Close does nothing
+func (d *DarwinDetector) Close() error { return nil }
@@ -4,13 +4,34 @@ package platform
 
 import (
 	"fmt"
+	"os"
 	"runtime"
+	"time"
+
+	"github.com/weii/actime/pkg/logger"
 )
 
-// NewDetector creates a new platform-specific detector based on the operating system
+// detectorFactories are the detectors monitor.detectors can name
+var detectorFactories = map[string]func() Detector{
+	"wayland": func() Detector { return NewWaylandDetector() },
+	"x11":     func() Detector { return NewX11Detector() },
+}
+
+// NewDetector creates a new platform-specific detector based on the operating system.
+// On Linux a Wayland session uses the Wayland detector, since X11 only sees
+// the windows of XWayland clients there; monitor.detectors overrides the choice.
 func NewDetector() (Detector, error) {
 	switch runtime.GOOS {
 	case "linux":
+		if isWaylandSession() {
+			wayland := NewWaylandDetector()
+			err := wayland.Initialize()
+			if err == nil {
+				return wayland, nil
+			}
+			logger.GetLogger().Warn("Wayland detector unavailable, falling back to X11", "error", err)
+		}
+
 		detector := NewX11Detector()
 		if err := detector.Initialize(); err != nil {
 			return nil, fmt.Errorf("failed to initialize X11 detector: %w", err)
@@ -21,9 +42,17 @@ func NewDetector() (Detector, error) {
 	}
 }
 
-// InitializePlatformDetector initializes the global platform detector
-func InitializePlatformDetector() error {
-	detector, err := NewDetector()
+// InitializePlatformDetector initializes the global platform detector. The
+// names pick detectors in priority order, as in monitor.detectors; without
+// names the platform default is used.
+func InitializePlatformDetector(names []string, timeout time.Duration) error {
+	var detector Detector
+	var err error
+	if len(names) == 0 {
+		detector, err = NewDetector()
+	} else {
+		detector, err = newConfiguredDetector(names, timeout, detectorFactories)
+	}
 	if err != nil {
 		return err
 	}
@@ -33,8 +62,14 @@ func InitializePlatformDetector() error {
 
 // ClosePlatformDetector closes the global platform detector
 func ClosePlatformDetector() error {
+	closePlatformIdle()
 	if PlatformDetector != nil {
 		return PlatformDetector.Close()
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// isWaylandSession reports whether the user session runs on Wayland
+func isWaylandSession() bool {
+	return os.Getenv("XDG_SESSION_TYPE") == "wayland" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
@@ -0,0 +1,54 @@
+//go:build darwin
+
+package platform
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// detectorFactories are the detectors monitor.detectors can name
+var detectorFactories = map[string]func() Detector{
+	"darwin": func() Detector { return NewDarwinDetector() },
+}
+
+// NewDetector creates a new platform-specific detector based on the operating system
+func NewDetector() (Detector, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		detector := NewDarwinDetector()
+		if err := detector.Initialize(); err != nil {
+			return nil, fmt.Errorf("failed to initialize macOS detector: %w", err)
+		}
+		return detector, nil
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
+
+// InitializePlatformDetector initializes the global platform detector. The
+// names pick detectors in priority order, as in monitor.detectors; without
+// names the platform default is used.
+func InitializePlatformDetector(names []string, timeout time.Duration) error {
+	var detector Detector
+	var err error
+	if len(names) == 0 {
+		detector, err = NewDetector()
+	} else {
+		detector, err = newConfiguredDetector(names, timeout, detectorFactories)
+	}
+	if err != nil {
+		return err
+	}
+	PlatformDetector = detector
+	return nil
+}
+
+// ClosePlatformDetector closes the global platform detector
+func ClosePlatformDetector() error {
+	if PlatformDetector != nil {
+		return PlatformDetector.Close()
+	}
+	return nil
+}
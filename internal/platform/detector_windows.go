@@ -5,8 +5,19 @@ package platform
 import (
 	"fmt"
 	"runtime"
+	"time"
 )
 
+// detectorFactories are the detectors monitor.detectors can name
+var detectorFactories = map[string]func() Detector{
+	"windows": func() Detector { return NewWindowsDetector() },
+}
+
+// NewWindowsDetector creates a new Windows detector
+func NewWindowsDetector() *WindowsDetector {
+	return newWindowsDetector(newWin32())
+}
+
 // NewDetector creates a new platform-specific detector based on the operating system
 func NewDetector() (Detector, error) {
 	switch runtime.GOOS {
@@ -21,9 +32,17 @@ func NewDetector() (Detector, error) {
 	}
 }
 
-// InitializePlatformDetector initializes the global platform detector
-func InitializePlatformDetector() error {
-	detector, err := NewDetector()
+// InitializePlatformDetector initializes the global platform detector. The
+// names pick detectors in priority order, as in monitor.detectors; without
+// names the platform default is used.
+func InitializePlatformDetector(names []string, timeout time.Duration) error {
+	var detector Detector
+	var err error
+	if len(names) == 0 {
+		detector, err = NewDetector()
+	} else {
+		detector, err = newConfiguredDetector(names, timeout, detectorFactories)
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,215 @@
+//go:build linux
+
+package platform
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/weii/actime/pkg/logger"
+	"golang.org/x/sys/unix"
+)
+
+// evdevDir holds the event devices of the kernel
+const evdevDir = "/dev/input"
+
+// evdevMethod is how capability reports name the evdev idle source
+const evdevMethod = "evdev (/dev/input)"
+
+// evdevRescanInterval is how often the devices are listed again, so
+// keyboards and mice plugged in later are watched too
+const evdevRescanInterval = 10 * time.Second
+
+// The event types that are input from the user: keys and buttons, and
+// relative and absolute axes, as of mice, touchpads and touch screens
+const (
+	evKey = 0x01
+	evRel = 0x02
+	evAbs = 0x03
+)
+
+// evdevEventSize is the size of struct input_event: a timeval, then the
+// type, code and value
+var evdevEventSize = int(unsafe.Sizeof(unix.Timeval{})) + 8
+
+// evdevIdle tells the time since the last input from the event devices of
+// the kernel, which works whatever the display server. Only the type of
+// each event is looked at: which key was pressed or where the pointer went
+// is neither read nor logged.
+type evdevIdle struct {
+	dir     string
+	mu      sync.Mutex
+	devices map[string]*os.File
+	last    time.Time
+	scanned time.Time
+	closed  bool
+}
+
+// newEvdevIdle watches every event device in dir. It fails when none can
+// be opened, usually because the user is not in the input group.
+func newEvdevIdle(dir string) (*evdevIdle, error) {
+	e := &evdevIdle{dir: dir, devices: make(map[string]*os.File), last: time.Now()}
+	if err := e.scan(); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.devices) == 0 {
+		return nil, fmt.Errorf("no input device in %s", dir)
+	}
+	return e, nil
+}
+
+// scan starts watching the devices that appeared since the last scan. It
+// fails only when there are devices and none of them can be opened.
+func (e *evdevIdle) scan() error {
+	paths, err := filepath.Glob(filepath.Join(e.dir, "event*"))
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scanned = time.Now()
+	var errs []error
+	for _, path := range paths {
+		if _, ok := e.devices[path]; ok || e.closed {
+			continue
+		}
+		device, err := os.Open(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		e.devices[path] = device
+		go e.watch(path, device)
+	}
+	if len(e.devices) == 0 && len(errs) > 0 {
+		return fmt.Errorf("failed to open input devices: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// watch notes the time of every input event of a device until it is
+// unplugged or closed
+func (e *evdevIdle) watch(path string, device *os.File) {
+	buf := make([]byte, 64*evdevEventSize)
+	for {
+		n, err := device.Read(buf)
+		input := false
+		for i := 0; i+evdevEventSize <= n; i += evdevEventSize {
+			switch binary.NativeEndian.Uint16(buf[i+evdevEventSize-8:]) {
+			case evKey, evRel, evAbs:
+				input = true
+			}
+		}
+		if input {
+			e.mu.Lock()
+			e.last = time.Now()
+			e.mu.Unlock()
+		}
+		if err != nil || n == 0 {
+			e.mu.Lock()
+			if e.devices[path] == device {
+				delete(e.devices, path)
+			}
+			e.mu.Unlock()
+			device.Close()
+			return
+		}
+	}
+}
+
+// IdleTime returns the time since the last input event of any device
+func (e *evdevIdle) IdleTime() (time.Duration, error) {
+	e.mu.Lock()
+	rescan := time.Since(e.scanned) >= evdevRescanInterval
+	e.mu.Unlock()
+	if rescan {
+		if err := e.scan(); err != nil {
+			logger.GetLogger().Debug("Failed to list input devices", "error", err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Since(e.last), nil
+}
+
+// count returns the number of devices watched
+func (e *evdevIdle) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.devices)
+}
+
+// Close stops watching the devices
+func (e *evdevIdle) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for path, device := range e.devices {
+		device.Close()
+		delete(e.devices, path)
+	}
+}
+
+// platformIdle is the evdev idle source of the platform detector, kept
+// across reinitializing the detector and closed with it
+var platformIdle *evdevIdle
+
+// UseEvdevIdle makes the platform detector read the idle time from the
+// input devices in /dev/input instead of the X server or the compositor,
+// as monitor.idle_source: evdev asks. It fails, leaving the detector's own
+// idle source, when no device can be read or the detector cannot use it.
+func UseEvdevIdle() error {
+	if PlatformDetector == nil {
+		return errors.New("no platform detector")
+	}
+	idle, err := newEvdevIdle(evdevDir)
+	if err != nil {
+		return fmt.Errorf("%w (is the user in the input group?)", err)
+	}
+	if !setIdleSource(PlatformDetector, idle) {
+		idle.Close()
+		return errors.New("the detector cannot use another idle source")
+	}
+	platformIdle = idle
+	return nil
+}
+
+// setIdleSource makes detector, or every detector it is made of, read the
+// idle time from idle
+func setIdleSource(detector Detector, idle *evdevIdle) bool {
+	switch d := detector.(type) {
+	case *X11Detector:
+		d.evdev = idle
+		return true
+	case *WaylandDetector:
+		d.mu.Lock()
+		d.evdev = idle
+		d.mu.Unlock()
+		return true
+	case *MultiDetector:
+		set := false
+		for _, mem := range d.members {
+			set = setIdleSource(mem.detector, idle) || set
+		}
+		return set
+	}
+	return false
+}
+
+// closePlatformIdle stops the evdev idle source of the platform detector
+func closePlatformIdle() {
+	if platformIdle != nil {
+		platformIdle.Close()
+		platformIdle = nil
+	}
+}
@@ -0,0 +1,101 @@
+//go:build linux
+
+package platform
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fakeInputDevice creates a FIFO standing in for an event device and
+// returns its writing end
+func fakeInputDevice(t *testing.T, dir, name string) *os.File {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := unix.Mkfifo(path, 0600); err != nil {
+		t.Fatalf("Failed to create %s: %v", name, err)
+	}
+	// Opening for reading and writing does not wait for a reader
+	w, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+// inputEvent encodes a struct input_event of the given type
+func inputEvent(eventType uint16) []byte {
+	event := make([]byte, evdevEventSize)
+	binary.NativeEndian.PutUint16(event[evdevEventSize-8:], eventType)
+	return event
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEvdevIdle(t *testing.T) {
+	if _, err := newEvdevIdle(t.TempDir()); err == nil {
+		t.Error("Expected an error without input devices")
+	}
+
+	dir := t.TempDir()
+	keyboard := fakeInputDevice(t, dir, "event0")
+	e, err := newEvdevIdle(dir)
+	if err != nil {
+		t.Fatalf("Failed to watch input devices: %v", err)
+	}
+	defer e.Close()
+
+	idleFor := func() time.Duration {
+		idle, err := e.IdleTime()
+		if err != nil {
+			t.Fatalf("Failed to get idle time: %v", err)
+		}
+		return idle
+	}
+	e.mu.Lock()
+	e.last = time.Now().Add(-time.Hour)
+	e.mu.Unlock()
+
+	// Synchronization reports are no input
+	keyboard.Write(inputEvent(0x00))
+	time.Sleep(20 * time.Millisecond)
+	if idle := idleFor(); idle < time.Hour {
+		t.Errorf("Expected a synchronization report to leave the idle time, got %s", idle)
+	}
+
+	keyboard.Write(inputEvent(evKey))
+	waitFor(t, "a key event", func() bool { return idleFor() < time.Minute })
+
+	// A device plugged in later is found on the next scan
+	mouse := fakeInputDevice(t, dir, "event1")
+	e.mu.Lock()
+	e.last = time.Now().Add(-time.Hour)
+	e.scanned = time.Time{}
+	e.mu.Unlock()
+	idleFor()
+	if count := e.count(); count != 2 {
+		t.Fatalf("Expected 2 devices after plugging one in, got %d", count)
+	}
+	mouse.Write(inputEvent(evRel))
+	waitFor(t, "a mouse event", func() bool { return idleFor() < time.Minute })
+
+	// An unplugged device is dropped
+	keyboard.Close()
+	waitFor(t, "the keyboard to be dropped", func() bool { return e.count() == 1 })
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package platform
+
+import "errors"
+
+// UseEvdevIdle is only supported on Linux
+func UseEvdevIdle() error {
+	return errors.New("the evdev idle source is only available on Linux")
+}
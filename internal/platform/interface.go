@@ -20,12 +20,74 @@ type Detector interface {
 	IsScreenLocked() (bool, error)
 }
 
+// SessionStateReporter is implemented by detectors that follow the state of
+// the user's login session, such as connected, locked or disconnected
+type SessionStateReporter interface {
+	SessionState() string
+}
+
+// MediaReporter is implemented by detectors that can tell the user is
+// watching rather than typing: a fullscreen window is in front, as for a
+// video or a presentation, or a media player is playing
+type MediaReporter interface {
+	IsMediaPlaying() (bool, error)
+}
+
+// Kinds of WindowEvent
+const (
+	WindowEventForeground = "foreground" // another window came to the front
+	WindowEventSession    = "session"    // the session was locked, unlocked or switched
+)
+
+// WindowEvent tells the tracker that something changed which it would
+// otherwise only see at its next check
+type WindowEvent struct {
+	Kind string
+	Time time.Time
+}
+
+// EventSource is implemented by detectors that are notified when the
+// foreground window or the session changes. Events returns nil when the
+// notifications are not available; the tracker then polls only. Events
+// are hints: a full channel drops them, as the tracker asks the detector
+// for the state anyway.
+type EventSource interface {
+	Events() <-chan WindowEvent
+}
+
 // WindowInfo contains information about a window
 type WindowInfo struct {
 	AppName     string
 	WindowTitle string
 	PID         int32
+	ExePath     string // the executable of the window's process, "" when unknown
+
+	// MonitorIndex numbers the monitor showing the window left to right,
+	// then top to bottom, from 0. Workspace is the virtual desktop it is
+	// on, from 0. Both are nil when the platform does not tell.
+	MonitorIndex *int
+	Workspace    *int
+
+	// WMInstance and WMClass are the two parts of the X11 WM_CLASS
+	// property, which applications let be set with --class; "" elsewhere
+	WMInstance string
+	WMClass    string
 }
 
+// WMClassKey returns the window's WM_CLASS written "class/instance", as
+// app_mapping rules match it, or "" when it is not known
+func (w *WindowInfo) WMClassKey() string {
+	if w.WMClass == "" && w.WMInstance == "" {
+		return ""
+	}
+	return w.WMClass + "/" + w.WMInstance
+}
+
+// NoWindow is returned by GetActiveWindow when no window has the focus, as
+// on the bare desktop or the sign-in screen. It is not an error: the
+// tracker ends the current session and tracks nothing until a window has
+// the focus again.
+var NoWindow = &WindowInfo{}
+
 // PlatformDetector is the global detector instance
 var PlatformDetector Detector
\ No newline at end of file
@@ -0,0 +1,474 @@
+//go:build linux
+
+package platform
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/weii/actime/pkg/logger"
+)
+
+// wlTimeout bounds the round trips of setting up the Wayland protocols
+const wlTimeout = 2 * time.Second
+
+// idleNotifyTimeout is the inactivity after which the compositor reports
+// the user idle; the idle time then counts from the last input before it
+const idleNotifyTimeout = time.Second
+
+// The Wayland interfaces the detector binds
+const (
+	wlSeatInterface             = "wl_seat"
+	wlrToplevelManagerInterface = "zwlr_foreign_toplevel_manager_v1"
+	extIdleNotifierInterface    = "ext_idle_notifier_v1"
+)
+
+// The states of a wlr foreign toplevel the detector follows
+const (
+	wlrToplevelActivated  = 2
+	wlrToplevelFullscreen = 3
+)
+
+// toplevelState is what the detector keeps of a foreign toplevel
+type toplevelState struct {
+	title      string
+	appID      string
+	activated  bool
+	fullscreen bool
+}
+
+// wlToplevel is a window the compositor reports. Changes arrive one event
+// at a time and apply together on the done event.
+type wlToplevel struct {
+	pending toplevelState
+	current toplevelState
+}
+
+// WaylandDetector implements Detector for Wayland compositors. The focused
+// window comes from the wlr foreign toplevel protocol of wlroots
+// compositors such as Sway and Hyprland, or else from GNOME Shell's
+// introspection interface on DBus. The idle time comes from the
+// ext-idle-notify protocol, or else from the IdleHint of the logind
+// session, and the lock state from the screensaver services as on X11.
+type WaylandDetector struct {
+	mu         sync.Mutex // guards the state the event handlers update
+	toplevels  map[uint32]*wlToplevel
+	idleNotify bool
+	idleSince  time.Time // when the user went idle, zero while active
+
+	wl           *wlConn
+	gnome        *dbus.Conn // session bus, when GNOME Shell reports the windows
+	system       *dbus.Conn // system bus, when logind reports the idle time
+	lock         *screenLock
+	media        mediaActivity
+	evdev        *evdevIdle // reads the idle time instead of the compositor when set
+	initialized  bool
+	warnedNoIdle bool
+}
+
+// NewWaylandDetector creates a new Wayland detector
+func NewWaylandDetector() *WaylandDetector {
+	return &WaylandDetector{}
+}
+
+// Initialize connects to the compositor and binds the protocols it offers
+func (d *WaylandDetector) Initialize() error {
+	wl, err := dialWayland()
+	if err != nil {
+		logger.GetLogger().Debug("Wayland compositor unreachable", "error", err)
+		wl = nil
+	}
+	return d.initialize(wl)
+}
+
+// initialize sets the detector up on a compositor connection, nil when
+// there is none
+func (d *WaylandDetector) initialize(wl *wlConn) error {
+	d.mu.Lock()
+	d.toplevels = make(map[uint32]*wlToplevel)
+	d.idleNotify = false
+	d.idleSince = time.Time{}
+	d.mu.Unlock()
+
+	hasToplevels := false
+	if wl != nil {
+		var err error
+		if hasToplevels, err = d.bind(wl); err != nil {
+			wl.Close()
+			return fmt.Errorf("failed to set up Wayland protocols: %w", err)
+		}
+		d.wl = wl
+	}
+
+	if !hasToplevels {
+		if err := d.connectGnomeShell(); err != nil {
+			d.Close()
+			return fmt.Errorf("the compositor supports neither wlr-foreign-toplevel-management nor GNOME Shell introspection: %w", err)
+		}
+	}
+
+	if !d.idleNotify {
+		if conn, err := dbus.ConnectSystemBus(); err == nil {
+			d.system = conn
+		} else {
+			logger.GetLogger().Debug("System bus unavailable for idle detection", "error", err)
+		}
+	}
+
+	d.lock = newScreenLock()
+	d.initialized = true
+	return nil
+}
+
+// bind binds the toplevel manager and the idle notifier, and waits for the
+// toplevels that exist already. hasToplevels is false when the compositor
+// does not offer the toplevel manager.
+func (d *WaylandDetector) bind(wl *wlConn) (hasToplevels bool, err error) {
+	registry, err := wl.registry(wlTimeout)
+	if err != nil {
+		return false, err
+	}
+
+	_, hasToplevels, err = registry.bind(wlrToplevelManagerInterface, 3, d.handleToplevelManager(wl))
+	if err != nil {
+		return false, err
+	}
+
+	seat, hasSeat, err := registry.bind(wlSeatInterface, 1, nil)
+	if err != nil {
+		return false, err
+	}
+	notifier, hasNotifier, err := registry.bind(extIdleNotifierInterface, 1, nil)
+	if err != nil {
+		return false, err
+	}
+	if hasSeat && hasNotifier {
+		id := wl.newID()
+		wl.handle(id, d.handleIdleNotification)
+		// ext_idle_notifier_v1.get_idle_notification
+		if err := wl.request(notifier, 1, id, uint32(idleNotifyTimeout.Milliseconds()), seat); err != nil {
+			return false, err
+		}
+		d.mu.Lock()
+		d.idleNotify = true
+		d.mu.Unlock()
+	}
+
+	if err := wl.roundtrip(wlTimeout); err != nil {
+		return false, err
+	}
+	return hasToplevels, nil
+}
+
+// handleToplevelManager follows the toplevels the manager announces
+func (d *WaylandDetector) handleToplevelManager(wl *wlConn) wlHandler {
+	return func(opcode uint16, args *wlArgs) {
+		if opcode != 0 { // toplevel
+			return
+		}
+		id := args.Uint()
+		toplevel := &wlToplevel{}
+		d.mu.Lock()
+		d.toplevels[id] = toplevel
+		d.mu.Unlock()
+
+		wl.handle(id, func(opcode uint16, args *wlArgs) {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			switch opcode {
+			case 0: // title
+				toplevel.pending.title = args.String()
+			case 1: // app_id
+				toplevel.pending.appID = args.String()
+			case 4: // state
+				toplevel.pending.activated = false
+				toplevel.pending.fullscreen = false
+				states := args.Array()
+				for i := 0; i+4 <= len(states); i += 4 {
+					switch binary.NativeEndian.Uint32(states[i:]) {
+					case wlrToplevelActivated:
+						toplevel.pending.activated = true
+					case wlrToplevelFullscreen:
+						toplevel.pending.fullscreen = true
+					}
+				}
+			case 5: // done
+				toplevel.current = toplevel.pending
+			case 6: // closed
+				delete(d.toplevels, id)
+				wl.request(id, 7) // destroy
+			}
+		})
+	}
+}
+
+// handleIdleNotification follows the user going idle and coming back
+func (d *WaylandDetector) handleIdleNotification(opcode uint16, args *wlArgs) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch opcode {
+	case 0: // idled
+		d.idleSince = time.Now().Add(-idleNotifyTimeout)
+	case 1: // resumed
+		d.idleSince = time.Time{}
+	}
+}
+
+// connectGnomeShell checks that GNOME Shell lets the detector list windows.
+// Recent versions only allow that to callers they trust.
+func (d *WaylandDetector) connectGnomeShell() error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	d.gnome = conn
+	if _, err := d.gnomeActiveWindow(); err != nil {
+		conn.Close()
+		d.gnome = nil
+		return err
+	}
+	return nil
+}
+
+// gnomeActiveWindow asks GNOME Shell for the focused window
+func (d *WaylandDetector) gnomeActiveWindow() (*WindowInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbusCallTimeout)
+	defer cancel()
+
+	var windows map[uint64]map[string]dbus.Variant
+	err := d.gnome.Object("org.gnome.Shell", "/org/gnome/Shell/Introspect").
+		CallWithContext(ctx, "org.gnome.Shell.Introspect.GetWindows", 0).Store(&windows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, props := range windows {
+		if focused, _ := props["has-focus"].Value().(bool); !focused {
+			continue
+		}
+		appID, _ := props["app-id"].Value().(string)
+		title, _ := props["title"].Value().(string)
+		return windowInfo(strings.TrimSuffix(appID, ".desktop"), title), nil
+	}
+	return NoWindow, nil
+}
+
+// windowInfo builds the WindowInfo of a window known by its app ID
+func windowInfo(appID, title string) *WindowInfo {
+	if appID == "" {
+		appID = "Unknown"
+	}
+	return &WindowInfo{AppName: appID, WindowTitle: CleanTitle(title)}
+}
+
+// GetActiveWindow returns the active window information
+func (d *WaylandDetector) GetActiveWindow() (*WindowInfo, error) {
+	if !d.initialized {
+		return nil, fmt.Errorf("detector not initialized")
+	}
+
+	if d.gnome != nil {
+		window, err := d.gnomeActiveWindow()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get active window: %w", err)
+		}
+		return window, nil
+	}
+
+	if err := d.wl.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get active window: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	active := d.activeToplevel()
+	if active == nil {
+		return NoWindow, nil
+	}
+	return windowInfo(active.current.appID, active.current.title), nil
+}
+
+// activeToplevel returns the focused toplevel, or nil. With several seats
+// several toplevels can be active; the oldest wins. The caller holds mu.
+func (d *WaylandDetector) activeToplevel() *wlToplevel {
+	var active *wlToplevel
+	var activeID uint32
+	for id, toplevel := range d.toplevels {
+		if toplevel.current.activated && (active == nil || id < activeID) {
+			active, activeID = toplevel, id
+		}
+	}
+	return active
+}
+
+// GetIdleTime returns the time since the last user input. Without
+// ext-idle-notify or logind the idle time is always 0; that is warned
+// about once rather than every tick.
+func (d *WaylandDetector) GetIdleTime() (time.Duration, error) {
+	if !d.initialized {
+		return 0, fmt.Errorf("detector not initialized")
+	}
+
+	d.mu.Lock()
+	idleNotify, idleSince, evdev := d.idleNotify, d.idleSince, d.evdev
+	d.mu.Unlock()
+
+	if evdev != nil {
+		return evdev.IdleTime()
+	}
+
+	if idleNotify {
+		if err := d.wl.Err(); err != nil {
+			return 0, fmt.Errorf("failed to get idle time: %w", err)
+		}
+		if idleSince.IsZero() {
+			return 0, nil
+		}
+		return time.Since(idleSince), nil
+	}
+
+	if d.system != nil {
+		return d.sessionIdleTime()
+	}
+
+	if !d.warnedNoIdle {
+		logger.GetLogger().Warn("Compositor has no ext-idle-notify and logind is unreachable, idle time is not detected")
+		d.warnedNoIdle = true
+	}
+	return 0, nil
+}
+
+// Capabilities reports how the active window, the idle time and the lock
+// state are read from this compositor
+func (d *WaylandDetector) Capabilities() []Capability {
+	window := Capability{Name: CapabilityActiveWindow, Supported: true, Method: "wlr-foreign-toplevel-management"}
+	if d.gnome != nil {
+		window.Method = "GNOME Shell Introspect on DBus"
+	}
+
+	d.mu.Lock()
+	idleNotify, evdev := d.idleNotify, d.evdev
+	d.mu.Unlock()
+	idle := Capability{Name: CapabilityIdle, Supported: true, Method: "ext-idle-notify"}
+	switch {
+	case evdev != nil:
+		idle.Method = evdevMethod
+	case idleNotify:
+	case d.system != nil:
+		idle.Method = "logind IdleHint"
+	default:
+		idle = Capability{
+			Name:   CapabilityIdle,
+			Detail: "the compositor has no ext-idle-notify and logind is unreachable",
+			Hint:   "use a compositor with ext-idle-notify-v1, make the system bus reachable or set monitor.idle_source: evdev; until then idle time counts as active",
+		}
+	}
+
+	source := ""
+	if d.lock != nil {
+		source = d.lock.Source()
+	}
+	lock := Capability{Name: CapabilityLock, Supported: true}
+	if source != "" {
+		lock.Method = source + " on DBus"
+	} else {
+		lock = Capability{
+			Name:   CapabilityLock,
+			Detail: "no screensaver service answers on DBus",
+			Hint:   "run a screen locker that implements org.freedesktop.ScreenSaver or sets the logind LockedHint; until then the screen counts as unlocked",
+		}
+	}
+
+	return []Capability{window, idle, lock}
+}
+
+// sessionIdleTime reads the idle time from the IdleHint and IdleSinceHint
+// of the logind session
+func (d *WaylandDetector) sessionIdleTime() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbusCallTimeout)
+	defer cancel()
+
+	var hint dbus.Variant
+	if err := getSessionProperty(ctx, d.system, "IdleHint", &hint); err != nil {
+		return 0, fmt.Errorf("failed to get session idle hint: %w", err)
+	}
+	if idle, _ := hint.Value().(bool); !idle {
+		return 0, nil
+	}
+
+	var since dbus.Variant
+	if err := getSessionProperty(ctx, d.system, "IdleSinceHint", &since); err != nil {
+		return 0, fmt.Errorf("failed to get session idle hint: %w", err)
+	}
+	usec, _ := since.Value().(uint64)
+	idle := time.Since(time.UnixMicro(int64(usec)))
+	if idle < 0 {
+		idle = 0
+	}
+	return idle, nil
+}
+
+// IsScreenLocked returns true if the screen is locked, as the screensaver
+// services on DBus report it. Without any the screen counts as unlocked.
+func (d *WaylandDetector) IsScreenLocked() (bool, error) {
+	if !d.initialized {
+		return false, fmt.Errorf("detector not initialized")
+	}
+
+	if locked, ok := d.lock.Locked(); ok {
+		return locked, nil
+	}
+	return false, nil
+}
+
+// IsMediaPlaying returns true if the focused window is fullscreen, which
+// only the wlr toplevel protocol reports, or media is playing, as the
+// session bus reports it
+func (d *WaylandDetector) IsMediaPlaying() (bool, error) {
+	if !d.initialized {
+		return false, fmt.Errorf("detector not initialized")
+	}
+
+	if d.gnome == nil {
+		d.mu.Lock()
+		active := d.activeToplevel()
+		fullscreen := active != nil && active.current.fullscreen
+		d.mu.Unlock()
+		if fullscreen {
+			return true, nil
+		}
+	}
+
+	return d.media.Playing(), nil
+}
+
+// Close disconnects from the compositor and the buses
+func (d *WaylandDetector) Close() error {
+	d.media.Close()
+	if d.wl != nil {
+		d.wl.Close()
+		d.wl = nil
+	}
+	if d.gnome != nil {
+		d.gnome.Close()
+		d.gnome = nil
+	}
+	if d.system != nil {
+		d.system.Close()
+		d.system = nil
+	}
+	if d.lock != nil {
+		d.lock.Close()
+		d.lock = nil
+	}
+	d.initialized = false
+	return nil
+}
@@ -0,0 +1,189 @@
+//go:build linux
+
+package platform
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeToplevel is the ID the fake compositor gives the toplevel it reports
+const fakeToplevel = 0xff000000
+
+// fakeCompositor answers a WaylandDetector over a pipe. It offers a seat,
+// the toplevel manager and the idle notifier, and reports one toplevel as
+// soon as the manager is bound.
+type fakeCompositor struct {
+	t    *testing.T
+	conn net.Conn
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	bound   map[string]uint32
+	idle    uint32
+	closed  chan struct{} // closed when the toplevel is destroyed
+}
+
+func newFakeCompositor(t *testing.T, conn net.Conn) *fakeCompositor {
+	f := &fakeCompositor{t: t, conn: conn, bound: make(map[string]uint32), closed: make(chan struct{})}
+	go f.serve()
+	return f
+}
+
+// send writes an event
+func (f *fakeCompositor) send(id uint32, opcode uint16, args ...interface{}) {
+	message, err := wlMessage(id, opcode, args...)
+	if err != nil {
+		f.t.Errorf("Failed to encode event: %v", err)
+		return
+	}
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	f.conn.Write(message)
+}
+
+// object returns the ID the client bound an interface to
+func (f *fakeCompositor) object(iface string) uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bound[iface]
+}
+
+func (f *fakeCompositor) serve() {
+	header := make([]byte, 8)
+	var registry uint32
+	for {
+		if _, err := io.ReadFull(f.conn, header); err != nil {
+			return
+		}
+		id := binary.NativeEndian.Uint32(header)
+		word := binary.NativeEndian.Uint32(header[4:])
+		body := make([]byte, word>>16-8)
+		if _, err := io.ReadFull(f.conn, body); err != nil {
+			return
+		}
+		args := &wlArgs{data: body}
+		opcode := uint16(word)
+
+		switch {
+		case id == wlDisplayID && opcode == 0: // sync
+			callback := args.Uint()
+			f.send(callback, 0, uint32(0))
+			f.send(wlDisplayID, 1, callback)
+		case id == wlDisplayID && opcode == 1: // get_registry
+			registry = args.Uint()
+			f.send(registry, 0, uint32(1), wlSeatInterface, uint32(7))
+			f.send(registry, 0, uint32(2), wlrToplevelManagerInterface, uint32(3))
+			f.send(registry, 0, uint32(3), extIdleNotifierInterface, uint32(1))
+		case id == registry && opcode == 0: // bind
+			args.Uint()
+			iface, _, object := args.String(), args.Uint(), args.Uint()
+			f.mu.Lock()
+			f.bound[iface] = object
+			f.mu.Unlock()
+			if iface == wlrToplevelManagerInterface {
+				f.send(object, 0, uint32(fakeToplevel))
+				f.send(fakeToplevel, 0, "main.go - vim")
+				f.send(fakeToplevel, 1, "foot")
+				f.send(fakeToplevel, 4, []byte{})
+				f.send(fakeToplevel, 5)
+			}
+		case id == f.object(extIdleNotifierInterface) && opcode == 1: // get_idle_notification
+			f.mu.Lock()
+			f.idle = args.Uint()
+			f.mu.Unlock()
+		case id == fakeToplevel && opcode == 7: // destroy
+			close(f.closed)
+		}
+	}
+}
+
+func TestWaylandDetector(t *testing.T) {
+	client, server := net.Pipe()
+	compositor := newFakeCompositor(t, server)
+	defer server.Close()
+
+	d := NewWaylandDetector()
+	if err := d.initialize(newWlConn(client)); err != nil {
+		t.Fatalf("Failed to initialize detector: %v", err)
+	}
+	defer d.Close()
+
+	roundtrip := func() {
+		t.Helper()
+		if err := d.wl.roundtrip(time.Second); err != nil {
+			t.Fatalf("Round trip failed: %v", err)
+		}
+	}
+	expectWindow := func(want *WindowInfo) {
+		t.Helper()
+		got, err := d.GetActiveWindow()
+		if err != nil {
+			t.Fatalf("GetActiveWindow failed: %v", err)
+		}
+		if want == NoWindow && got != NoWindow || want != NoWindow && *got != *want {
+			t.Errorf("Expected window %+v, got %+v", want, got)
+		}
+	}
+
+	// The toplevel that existed before is known, but does not have the focus
+	expectWindow(NoWindow)
+
+	activated := make([]byte, 4)
+	binary.NativeEndian.PutUint32(activated, wlrToplevelActivated)
+	compositor.send(fakeToplevel, 4, activated)
+	compositor.send(fakeToplevel, 5)
+	roundtrip()
+	expectWindow(&WindowInfo{AppName: "foot", WindowTitle: "main.go - vim"})
+
+	// Changes apply on done
+	compositor.send(fakeToplevel, 0, "README.md - vim")
+	roundtrip()
+	expectWindow(&WindowInfo{AppName: "foot", WindowTitle: "main.go - vim"})
+	compositor.send(fakeToplevel, 5)
+	roundtrip()
+	expectWindow(&WindowInfo{AppName: "foot", WindowTitle: "README.md - vim"})
+
+	// A fullscreen focused window counts as media playing
+	fullscreen := make([]byte, 8)
+	binary.NativeEndian.PutUint32(fullscreen, wlrToplevelActivated)
+	binary.NativeEndian.PutUint32(fullscreen[4:], wlrToplevelFullscreen)
+	compositor.send(fakeToplevel, 4, fullscreen)
+	compositor.send(fakeToplevel, 5)
+	roundtrip()
+	if playing, err := d.IsMediaPlaying(); err != nil || !playing {
+		t.Errorf("Expected a fullscreen window to count as media playing, got %v, %v", playing, err)
+	}
+
+	// Idle time follows the idle notification
+	compositor.mu.Lock()
+	notification := compositor.idle
+	compositor.mu.Unlock()
+	if notification == 0 {
+		t.Fatal("Expected an idle notification to be requested")
+	}
+	compositor.send(notification, 0) // idled
+	roundtrip()
+	if idle, err := d.GetIdleTime(); err != nil || idle < idleNotifyTimeout {
+		t.Errorf("Expected at least %v idle, got %v, %v", idleNotifyTimeout, idle, err)
+	}
+	compositor.send(notification, 1) // resumed
+	roundtrip()
+	if idle, err := d.GetIdleTime(); err != nil || idle != 0 {
+		t.Errorf("Expected no idle time after input, got %v, %v", idle, err)
+	}
+
+	// A closed toplevel is forgotten and destroyed
+	compositor.send(fakeToplevel, 6)
+	roundtrip()
+	expectWindow(NoWindow)
+	select {
+	case <-compositor.closed:
+	case <-time.After(time.Second):
+		t.Error("Expected the closed toplevel to be destroyed")
+	}
+}
@@ -10,10 +10,13 @@ import (
 
 	"github.com/BurntSushi/xgb"
 	"github.com/BurntSushi/xgb/screensaver"
+	"github.com/BurntSushi/xgb/xinerama"
 	"github.com/BurntSushi/xgb/xproto"
 	"github.com/BurntSushi/xgbutil"
 	"github.com/BurntSushi/xgbutil/ewmh"
 	"github.com/BurntSushi/xgbutil/xprop"
+	"github.com/BurntSushi/xgbutil/xwindow"
+	"github.com/weii/actime/pkg/logger"
 )
 
 // X11Detector implements Detector for Linux using X11
@@ -22,7 +25,34 @@ type X11Detector struct {
 	XUtil           *xgbutil.XUtil
 	initialized     bool
 	display         string
-	screenSaverExt  bool
+	screenSaver     screenSaverAPI // nil without the MIT-SCREEN-SAVER extension
+	xinerama        bool           // whether the XINERAMA extension lists the monitors
+	warnedNoIdle    bool
+	lock            *screenLock
+	media           mediaActivity
+	evdev           *evdevIdle // reads the idle time instead of the X server when set
+}
+
+// screenSaverAPI wraps XScreenSaverQueryInfo
+type screenSaverAPI interface {
+	// IdleTime returns the time since the last user input
+	IdleTime() (time.Duration, error)
+}
+
+// xScreenSaver implements screenSaverAPI with the MIT-SCREEN-SAVER extension
+type xScreenSaver struct {
+	conn *xgb.Conn
+}
+
+// IdleTime queries the screen saver info of the default screen
+func (s xScreenSaver) IdleTime() (time.Duration, error) {
+	screen := xproto.Setup(s.conn).DefaultScreen(s.conn)
+	reply, err := screensaver.QueryInfo(s.conn, xproto.Drawable(screen.Root)).Reply()
+	if err != nil {
+		return 0, err
+	}
+	// Idle time is in milliseconds
+	return time.Duration(reply.MsSinceUserInput) * time.Millisecond, nil
 }
 
 // NewX11Detector creates a new X11 detector
@@ -52,13 +82,15 @@ func (d *X11Detector) Initialize() error {
 	}
 
 	// Check for ScreenSaver extension
-	err = screensaver.Init(d.X)
-	if err != nil {
-		d.screenSaverExt = false
-	} else {
-		d.screenSaverExt = true
+	d.screenSaver = nil
+	if err := screensaver.Init(d.X); err == nil {
+		d.screenSaver = xScreenSaver{conn: d.X}
 	}
 
+	d.xinerama = xinerama.Init(d.X) == nil
+
+	d.lock = newScreenLock()
+
 	d.initialized = true
 	return nil
 }
@@ -70,94 +102,195 @@ func (d *X11Detector) GetActiveWindow() (*WindowInfo, error) {
 	}
 
 	// Get the active window using EWMH
-	activeWin, err := ewmh.ActiveWindowGet(d.XUtil)
+	activeWin, err := d.activeWindow()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active window: %w", err)
 	}
 
 	if activeWin == 0 {
-		return nil, fmt.Errorf("no active window")
+		return NoWindow, nil
+	}
+
+	// Get window name
+	wmName := d.windowTitle(activeWin)
+
+	// Get application name (WM_CLASS), named after its instance
+	appName, instance, class := "Unknown", "", ""
+	if wmClass, err := xprop.PropValStr(xprop.GetProperty(d.XUtil, activeWin, "WM_CLASS")); err == nil {
+		instance, class = parseWMClass(wmClass)
+		if instance != "" {
+			appName = instance
+		}
 	}
 
-	// Get window name (WM_NAME)
-	wmName, err := ewmh.WmNameGet(d.XUtil, activeWin)
+	// Get window PID
+	pid, err := ewmh.WmPidGet(d.XUtil, activeWin)
 	if err != nil {
-		// Fallback to classic WM_NAME
-		name, err := xprop.PropValStr(xprop.GetProperty(d.XUtil, activeWin, "WM_NAME"))
-		if err != nil {
-			// Another fallback to _NET_WM_NAME
-			name2, err := xprop.PropValStr(xprop.GetProperty(d.XUtil, activeWin, "_NET_WM_NAME"))
-			if err != nil {
-				wmName = "Unknown"
-			} else {
-				wmName = name2
+		pid = 0
+	}
+
+	monitor, workspace := d.windowPlace(activeWin)
+
+	return &WindowInfo{
+		AppName:      appName,
+		WindowTitle:  wmName,
+		PID:          int32(pid),
+		ExePath:      processPath(pid),
+		MonitorIndex: monitor,
+		Workspace:    workspace,
+		WMInstance:   instance,
+		WMClass:      class,
+	}, nil
+}
+
+// parseWMClass splits a WM_CLASS property into its instance and class. The
+// property is normally "instance\0class\0"; some clients separate the two
+// with a space instead. A single name is both.
+func parseWMClass(raw string) (instance, class string) {
+	var parts []string
+	for _, part := range strings.Split(raw, "\x00") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 1 {
+		parts = strings.Fields(parts[0])
+	}
+	if len(parts) == 0 {
+		return "", ""
+	}
+	return parts[0], parts[len(parts)-1]
+}
+
+// windowPlace returns the monitor showing most of win, from the monitors
+// Xinerama lists, which RandR keeps up to date, and the current desktop of
+// the window manager. Either is nil when it cannot be read. Without
+// Xinerama the screen is one monitor.
+func (d *X11Detector) windowPlace(win xproto.Window) (monitor, workspace *int) {
+	// The frame the window manager draws around the window is where it is
+	if geometry, err := xwindow.New(d.XUtil, win).DecorGeometry(); err == nil {
+		window := screenRect{geometry.X(), geometry.Y(), geometry.Width(), geometry.Height()}
+		var monitors []screenRect
+		if d.xinerama {
+			if reply, err := xinerama.QueryScreens(d.X).Reply(); err == nil {
+				for _, screen := range reply.ScreenInfo {
+					monitors = append(monitors, screenRect{int(screen.XOrg), int(screen.YOrg), int(screen.Width), int(screen.Height)})
+				}
 			}
-		} else {
-			wmName = name
+		}
+		if len(monitors) == 0 {
+			screen := xproto.Setup(d.X).DefaultScreen(d.X)
+			monitors = []screenRect{{0, 0, int(screen.WidthInPixels), int(screen.HeightInPixels)}}
+		}
+		if index := monitorIndex(window, monitors); index >= 0 {
+			monitor = &index
 		}
 	}
 
-	// Get application name (WM_CLASS)
-	wmClass, err := xprop.PropValStr(xprop.GetProperty(d.XUtil, activeWin, "WM_CLASS"))
-	if err != nil {
-		wmClass = "Unknown"
+	if desktop, err := ewmh.CurrentDesktopGet(d.XUtil); err == nil {
+		index := int(desktop)
+		workspace = &index
 	}
+	return monitor, workspace
+}
 
-	// Clean up WM_CLASS: it may contain null bytes and multiple parts
-	// WM_CLASS format is typically "instance\0class\0" or "instance class"
-	wmClass = strings.ReplaceAll(wmClass, "\x00", " ")
-	wmClass = strings.TrimSpace(wmClass)
-	parts := strings.Fields(wmClass)
-	if len(parts) > 0 {
-		// Use the first non-empty part
-		wmClass = parts[0]
+// processPath returns the executable of a local process, or "" when it is
+// not known. A window of a remote X client has a PID of another machine;
+// its path is then of whichever local process has that PID, if any, which
+// _NET_WM_PID offers no way to tell apart.
+func processPath(pid uint) string {
+	if pid == 0 {
+		return ""
 	}
+	path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return ""
+	}
+	// The executable was replaced, as by a package upgrade, while running
+	return strings.TrimSuffix(path, " (deleted)")
+}
 
-	// Get window PID
-	pid, err := ewmh.WmPidGet(d.XUtil, activeWin)
+// activeWindow reads _NET_ACTIVE_WINDOW from the root window. Some window
+// managers leave it unset, or delete it, while the desktop has the focus;
+// that is no window rather than an error.
+func (d *X11Detector) activeWindow() (xproto.Window, error) {
+	atom, err := xprop.Atm(d.XUtil, "_NET_ACTIVE_WINDOW")
 	if err != nil {
-		pid = 0
+		return 0, err
 	}
+	reply, err := xproto.GetProperty(d.XUtil.Conn(), false, d.XUtil.RootWin(), atom,
+		xproto.AtomWindow, 0, 1).Reply()
+	if err != nil {
+		return 0, err
+	}
+	if reply.Format != 32 || len(reply.Value) < 4 {
+		return 0, nil
+	}
+	return xproto.Window(xgb.Get32(reply.Value)), nil
+}
 
-	return &WindowInfo{
-		AppName:     wmClass,
-		WindowTitle: wmName,
-		PID:         int32(pid),
-	}, nil
+// windowTitle reads the title of win, preferring _NET_WM_NAME over the
+// legacy WM_NAME. A window without a readable title has an empty one.
+func (d *X11Detector) windowTitle(win xproto.Window) string {
+	if reply, err := xprop.GetProperty(d.XUtil, win, "_NET_WM_NAME"); err == nil {
+		if title := CleanTitle(decodeTextProperty(reply.Value, "UTF8_STRING")); title != "" {
+			return title
+		}
+	}
+
+	reply, err := xprop.GetProperty(d.XUtil, win, "WM_NAME")
+	if err != nil {
+		return ""
+	}
+	typeName, _ := xprop.AtomName(d.XUtil, reply.Type)
+	return CleanTitle(decodeTextProperty(reply.Value, typeName))
 }
 
-// GetIdleTime returns the idle time using XScreenSaver
+// GetIdleTime returns the idle time using XScreenSaver. Without the
+// extension on the server the idle time is always 0, so the user is never
+// considered idle; that is warned about once rather than every tick.
 func (d *X11Detector) GetIdleTime() (time.Duration, error) {
 	if !d.initialized {
 		return 0, fmt.Errorf("detector not initialized")
 	}
 
-	if !d.screenSaverExt {
-		// ScreenSaver extension not available, return 0
+	if d.evdev != nil {
+		return d.evdev.IdleTime()
+	}
+
+	if d.screenSaver == nil {
+		if !d.warnedNoIdle {
+			logger.GetLogger().Warn("X server has no MIT-SCREEN-SAVER extension, idle time is not detected",
+				"display", d.display)
+			d.warnedNoIdle = true
+		}
 		return 0, nil
 	}
 
-	// Query screen saver info
-	screen := xproto.Setup(d.X).DefaultScreen(d.X)
-	reply, err := screensaver.QueryInfo(d.X, xproto.Drawable(screen.Root)).Reply()
+	idleTime, err := d.screenSaver.IdleTime()
 	if err != nil {
 		return 0, fmt.Errorf("failed to query screen saver info: %w", err)
 	}
-
-	// Idle time is in milliseconds
-	idleTime := time.Duration(reply.MsSinceUserInput) * time.Millisecond
 	return idleTime, nil
 }
 
-// IsScreenLocked returns true if the screen is locked
+// IsScreenLocked returns true if the screen is locked. The screensaver
+// services on DBus are asked first; without any, a screen locker window
+// having the focus counts as locked.
 func (d *X11Detector) IsScreenLocked() (bool, error) {
 	if !d.initialized {
 		return false, fmt.Errorf("detector not initialized")
 	}
 
+	if d.lock != nil {
+		if locked, ok := d.lock.Locked(); ok {
+			return locked, nil
+		}
+	}
+
 	// Try to detect screen lock by checking if there's a screensaver window active
 	// This is a simplified detection method
-	activeWin, err := ewmh.ActiveWindowGet(d.XUtil)
+	activeWin, err := d.activeWindow()
 	if err != nil {
 		return false, fmt.Errorf("failed to get active window: %w", err)
 	}
@@ -190,8 +323,67 @@ func (d *X11Detector) IsScreenLocked() (bool, error) {
 	return false, nil
 }
 
+// IsMediaPlaying returns true if the active window is fullscreen or media
+// is playing, as the session bus reports it
+func (d *X11Detector) IsMediaPlaying() (bool, error) {
+	if !d.initialized {
+		return false, fmt.Errorf("detector not initialized")
+	}
+
+	activeWin, err := d.activeWindow()
+	if err != nil {
+		return false, fmt.Errorf("failed to get active window: %w", err)
+	}
+	if activeWin != 0 {
+		states, _ := ewmh.WmStateGet(d.XUtil, activeWin)
+		for _, state := range states {
+			if state == "_NET_WM_STATE_FULLSCREEN" {
+				return true, nil
+			}
+		}
+	}
+
+	return d.media.Playing(), nil
+}
+
+// Capabilities reports how the active window, the idle time and the lock
+// state are read from this X server
+func (d *X11Detector) Capabilities() []Capability {
+	idle := Capability{Name: CapabilityIdle, Supported: true, Method: "MIT-SCREEN-SAVER extension"}
+	switch {
+	case d.evdev != nil:
+		idle.Method = evdevMethod
+	case d.screenSaver == nil:
+		idle = Capability{
+			Name:   CapabilityIdle,
+			Detail: "the X server has no MIT-SCREEN-SAVER extension",
+			Hint:   "enable the extension in the X server (Xvfb: +extension MIT-SCREEN-SAVER) or set monitor.idle_source: evdev; until then idle time counts as active",
+		}
+	}
+
+	lock := Capability{Name: CapabilityLock, Supported: true, Method: "screen locker windows"}
+	if d.lock != nil {
+		if source := d.lock.Source(); source != "" {
+			lock.Method = source + " on DBus"
+		} else {
+			lock.Hint = "no screensaver service answers on DBus, so only the focus of a known screen locker counts as locked"
+		}
+	}
+
+	return []Capability{
+		{Name: CapabilityActiveWindow, Supported: true, Method: "EWMH _NET_ACTIVE_WINDOW"},
+		idle,
+		lock,
+	}
+}
+
 // Close closes the X11 connection
 func (d *X11Detector) Close() error {
+	d.media.Close()
+	if d.lock != nil {
+		d.lock.Close()
+		d.lock = nil
+	}
 	if d.XUtil != nil {
 		d.XUtil.Conn().Close()
 		d.XUtil = nil
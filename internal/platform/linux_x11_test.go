@@ -0,0 +1,65 @@
+//go:build linux
+
+package platform
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeScreenSaver implements screenSaverAPI
+type fakeScreenSaver struct {
+	idle time.Duration
+	err  error
+}
+
+func (f fakeScreenSaver) IdleTime() (time.Duration, error) { return f.idle, f.err }
+
+func TestX11DetectorIdleTime(t *testing.T) {
+	d := &X11Detector{initialized: true, screenSaver: fakeScreenSaver{idle: 1500 * time.Millisecond}}
+	if idle, err := d.GetIdleTime(); err != nil || idle != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s idle, got %v, %v", idle, err)
+	}
+
+	d.screenSaver = fakeScreenSaver{err: errors.New("bad request")}
+	if _, err := d.GetIdleTime(); err == nil {
+		t.Error("Expected a failed query to be an error")
+	}
+}
+
+func TestX11DetectorIdleTimeWithoutExtension(t *testing.T) {
+	d := &X11Detector{initialized: true}
+
+	// Every tick gets 0 without an error, and the warning is only given once
+	for i := 0; i < 3; i++ {
+		idle, err := d.GetIdleTime()
+		if err != nil || idle != 0 {
+			t.Fatalf("Tick %d: expected 0 without an error, got %v, %v", i, idle, err)
+		}
+		if !d.warnedNoIdle {
+			t.Fatalf("Tick %d: expected the missing extension to be warned about", i)
+		}
+	}
+}
+
+func TestParseWMClass(t *testing.T) {
+	tests := []struct {
+		raw      string
+		instance string
+		class    string
+	}{
+		{"chromium\x00Chromium\x00", "chromium", "Chromium"},
+		{"work\x00Chromium", "work", "Chromium"},
+		{"scratchpad kitty", "scratchpad", "kitty"},
+		{"xterm\x00", "xterm", "xterm"},
+		{"\x00\x00", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		instance, class := parseWMClass(tt.raw)
+		if instance != tt.instance || class != tt.class {
+			t.Errorf("parseWMClass(%q) = %q, %q, want %q, %q", tt.raw, instance, class, tt.instance, tt.class)
+		}
+	}
+}
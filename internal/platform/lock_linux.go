@@ -0,0 +1,165 @@
+//go:build linux
+
+package platform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/weii/actime/pkg/logger"
+)
+
+// dbusCallTimeout bounds one DBus call, so a hung service cannot stall a tick
+const dbusCallTimeout = time.Second
+
+// lockSource is a DBus service that knows whether the screen is locked
+type lockSource struct {
+	name   string
+	locked func(ctx context.Context) (bool, error)
+}
+
+// screenLock asks the DBus screensaver services whether the screen is
+// locked. They are tried in order, and the first one that answers is asked
+// first from then on, until it stops answering.
+type screenLock struct {
+	mu      sync.Mutex
+	sources []lockSource
+	current int  // the source that answered last, -1 before any did
+	missing bool // no source answered the last time
+	conns   []*dbus.Conn
+}
+
+// newScreenLock connects to the session and system buses. A bus that
+// cannot be reached leaves out the services on it.
+func newScreenLock() *screenLock {
+	l := &screenLock{current: -1}
+
+	if conn, err := dbus.ConnectSessionBus(); err == nil {
+		l.conns = append(l.conns, conn)
+		l.sources = append(l.sources,
+			lockSource{"org.freedesktop.ScreenSaver", screenSaverActive(conn, "org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver")},
+			lockSource{"org.gnome.ScreenSaver", screenSaverActive(conn, "org.gnome.ScreenSaver", "/org/gnome/ScreenSaver")},
+		)
+	} else {
+		logger.GetLogger().Debug("Session bus unavailable for screen lock detection", "error", err)
+	}
+
+	if conn, err := dbus.ConnectSystemBus(); err == nil {
+		l.conns = append(l.conns, conn)
+		l.sources = append(l.sources, lockSource{"org.freedesktop.login1", sessionLockedHint(conn)})
+	} else {
+		logger.GetLogger().Debug("System bus unavailable for screen lock detection", "error", err)
+	}
+
+	return l
+}
+
+// Locked reports whether the screen is locked. ok is false when no service
+// answered.
+func (l *screenLock) Locked() (locked, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.current >= 0 {
+		locked, err := l.query(l.sources[l.current])
+		if err == nil {
+			return locked, true
+		}
+		logger.GetLogger().Debug("Screen lock service stopped answering",
+			"service", l.sources[l.current].name, "error", err)
+		l.current = -1
+	}
+
+	for i, source := range l.sources {
+		locked, err := l.query(source)
+		if err != nil {
+			continue
+		}
+		l.current = i
+		l.missing = false
+		logger.GetLogger().Debug("Detecting screen lock through DBus", "service", source.name)
+		return locked, true
+	}
+
+	if !l.missing {
+		logger.GetLogger().Debug("No screensaver service on DBus, the screen counts as unlocked")
+		l.missing = true
+	}
+	return false, false
+}
+
+// Source returns the name of the service the lock state is read from,
+// asking the services when none has answered yet. It is "" when none
+// answers.
+func (l *screenLock) Source() string {
+	if _, ok := l.Locked(); !ok {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current < 0 {
+		return ""
+	}
+	return l.sources[l.current].name
+}
+
+// query asks one source, giving up after dbusCallTimeout
+func (l *screenLock) query(source lockSource) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbusCallTimeout)
+	defer cancel()
+	return source.locked(ctx)
+}
+
+// Close disconnects from the buses
+func (l *screenLock) Close() {
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+// screenSaverActive calls GetActive of a screensaver service, which is
+// true while the screen is locked
+func screenSaverActive(conn *dbus.Conn, service, path string) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		var active bool
+		err := conn.Object(service, dbus.ObjectPath(path)).CallWithContext(ctx, service+".GetActive", 0).Store(&active)
+		return active, err
+	}
+}
+
+// sessionLockedHint reads the LockedHint of the logind session, which
+// lockers such as swaylock set through the session manager
+func sessionLockedHint(conn *dbus.Conn) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		var hint dbus.Variant
+		if err := getSessionProperty(ctx, conn, "LockedHint", &hint); err != nil {
+			return false, err
+		}
+		locked, ok := hint.Value().(bool)
+		if !ok {
+			return false, fmt.Errorf("unexpected LockedHint value %v", hint)
+		}
+		return locked, nil
+	}
+}
+
+// getSessionProperty reads a property of the logind session the daemon
+// runs in
+func getSessionProperty(ctx context.Context, conn *dbus.Conn, name string, value *dbus.Variant) error {
+	// A daemon started as a user service is outside the session that
+	// "auto" finds, so the session it was started from is preferred
+	path := dbus.ObjectPath("/org/freedesktop/login1/session/auto")
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		manager := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+		if err := manager.CallWithContext(ctx, "org.freedesktop.login1.Manager.GetSession", 0, id).Store(&path); err != nil {
+			return err
+		}
+	}
+	return conn.Object("org.freedesktop.login1", path).CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0,
+		"org.freedesktop.login1.Session", name).Store(value)
+}
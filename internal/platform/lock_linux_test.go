@@ -0,0 +1,61 @@
+//go:build linux
+
+package platform
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestScreenLockTriesServicesInOrder(t *testing.T) {
+	calls := map[string]int{}
+	source := func(name string, locked *bool, err *error) lockSource {
+		return lockSource{name: name, locked: func(ctx context.Context) (bool, error) {
+			calls[name]++
+			return *locked, *err
+		}}
+	}
+
+	missing := errors.New("org.freedesktop.DBus.Error.ServiceUnknown")
+	var freedesktopErr, gnomeErr, logindErr error = missing, nil, nil
+	gnomeLocked, logindLocked, never := true, false, false
+	l := &screenLock{current: -1, sources: []lockSource{
+		source("freedesktop", &never, &freedesktopErr),
+		source("gnome", &gnomeLocked, &gnomeErr),
+		source("logind", &logindLocked, &logindErr),
+	}}
+
+	// The first service that answers is used
+	if locked, ok := l.Locked(); !ok || !locked {
+		t.Fatalf("Expected GNOME to report the screen locked, got %v, %v", locked, ok)
+	}
+
+	// and asked directly from then on
+	gnomeLocked = false
+	if locked, ok := l.Locked(); !ok || locked {
+		t.Fatalf("Expected GNOME to report the screen unlocked, got %v, %v", locked, ok)
+	}
+	if calls["freedesktop"] != 1 || calls["gnome"] != 2 || calls["logind"] != 0 {
+		t.Errorf("Expected the answering service to be cached, got calls %v", calls)
+	}
+
+	// A service that stops answering is replaced by the next one
+	gnomeErr = missing
+	logindLocked = true
+	if locked, ok := l.Locked(); !ok || !locked {
+		t.Fatalf("Expected logind to report the screen locked, got %v, %v", locked, ok)
+	}
+	if l.current != 2 {
+		t.Errorf("Expected logind to be cached, got source %d", l.current)
+	}
+
+	// Without any service the screen counts as unlocked
+	logindErr = missing
+	if locked, ok := l.Locked(); ok || locked {
+		t.Errorf("Expected no answer without services, got %v, %v", locked, ok)
+	}
+	if locked, ok := (&screenLock{current: -1}).Locked(); ok || locked {
+		t.Errorf("Expected no answer without buses, got %v, %v", locked, ok)
+	}
+}
@@ -0,0 +1,106 @@
+//go:build linux
+
+package platform
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/weii/actime/pkg/logger"
+)
+
+// mprisPrefix starts the bus names of MPRIS media players
+const mprisPrefix = "org.mpris.MediaPlayer2."
+
+// gnomeInhibitIdle is the flag of GNOME session inhibitors that keep the
+// session from going idle
+const gnomeInhibitIdle = 8
+
+// mediaActivity asks the session bus whether media is playing: an MPRIS
+// player reporting Playing, or an application inhibiting the screensaver,
+// as browsers and video players do during playback. It connects on first
+// use, so detectors only hold the connection when it is asked for.
+type mediaActivity struct {
+	mu        sync.Mutex
+	conn      *dbus.Conn
+	connected bool
+}
+
+// Playing reports whether media is playing. Without a session bus nothing
+// is.
+func (m *mediaActivity) Playing() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.connected {
+		m.connected = true
+		conn, err := dbus.ConnectSessionBus()
+		if err != nil {
+			logger.GetLogger().Debug("Session bus unavailable for media detection", "error", err)
+			return false
+		}
+		m.conn = conn
+	}
+	if m.conn == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbusCallTimeout)
+	defer cancel()
+	return m.playerPlaying(ctx) || m.idleInhibited(ctx)
+}
+
+// playerPlaying reports whether any MPRIS player is playing
+func (m *mediaActivity) playerPlaying(ctx context.Context) bool {
+	var names []string
+	err := m.conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.ListNames", 0).Store(&names)
+	if err != nil {
+		return false
+	}
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, mprisPrefix) {
+			continue
+		}
+		var status dbus.Variant
+		err := m.conn.Object(name, "/org/mpris/MediaPlayer2").CallWithContext(ctx,
+			"org.freedesktop.DBus.Properties.Get", 0, "org.mpris.MediaPlayer2.Player", "PlaybackStatus").Store(&status)
+		if err != nil {
+			continue
+		}
+		if value, _ := status.Value().(string); value == "Playing" {
+			return true
+		}
+	}
+	return false
+}
+
+// idleInhibited reports whether an application inhibits the screensaver.
+// The org.freedesktop.ScreenSaver interface cannot list its inhibitors, so
+// the services behind it are asked: the GNOME session manager, or the
+// power management service of KDE.
+func (m *mediaActivity) idleInhibited(ctx context.Context) bool {
+	var inhibited bool
+	err := m.conn.Object("org.gnome.SessionManager", "/org/gnome/SessionManager").CallWithContext(ctx,
+		"org.gnome.SessionManager.IsInhibited", 0, uint32(gnomeInhibitIdle)).Store(&inhibited)
+	if err == nil {
+		return inhibited
+	}
+
+	err = m.conn.Object("org.freedesktop.PowerManagement", "/org/freedesktop/PowerManagement/Inhibit").CallWithContext(ctx,
+		"org.freedesktop.PowerManagement.Inhibit.HasInhibit", 0).Store(&inhibited)
+	return err == nil && inhibited
+}
+
+// Close disconnects from the session bus
+func (m *mediaActivity) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	m.conn = nil
+	m.connected = false
+}
@@ -0,0 +1,120 @@
+package platform
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MockStep is what a MockDetector reports for one tick
+type MockStep struct {
+	Window *WindowInfo // nil for no window having the focus
+	Idle   time.Duration
+	Locked bool
+}
+
+// MockDetector is a Detector replaying a script, for driving the tracker
+// and the service without a desktop session. Every tick of the tracker
+// starts by asking IsScreenLocked, which moves on to the next step; the
+// other calls answer from the current step. Once the script is played
+// out the last step repeats.
+//
+// The detector keeps its own clock, which advances by one interval per
+// step from start, so a script runs faster than real time when the
+// tracker ticks faster than the interval.
+type MockDetector struct {
+	mu          sync.Mutex
+	steps       []MockStep
+	next        int
+	current     MockStep
+	start       time.Time
+	interval    time.Duration
+	initialized bool
+	done        chan struct{}
+}
+
+// NewMockDetector creates a detector that plays steps, one interval of its
+// clock apart, from start
+func NewMockDetector(steps []MockStep, start time.Time, interval time.Duration) *MockDetector {
+	d := &MockDetector{
+		steps:    steps,
+		start:    start,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+	if len(steps) == 0 {
+		close(d.done)
+	}
+	return d
+}
+
+// Initialize initializes the detector
+func (d *MockDetector) Initialize() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.initialized = true
+	return nil
+}
+
+// Close closes the detector
+func (d *MockDetector) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.initialized = false
+	return nil
+}
+
+// IsScreenLocked moves to the next step and returns whether it is locked
+func (d *MockDetector) IsScreenLocked() (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.initialized {
+		return false, fmt.Errorf("detector not initialized")
+	}
+
+	if d.next < len(d.steps) {
+		d.current = d.steps[d.next]
+		d.next++
+		if d.next == len(d.steps) {
+			close(d.done)
+		}
+	}
+	return d.current.Locked, nil
+}
+
+// GetIdleTime returns the idle time of the current step
+func (d *MockDetector) GetIdleTime() (time.Duration, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.initialized {
+		return 0, fmt.Errorf("detector not initialized")
+	}
+	return d.current.Idle, nil
+}
+
+// GetActiveWindow returns the window of the current step
+func (d *MockDetector) GetActiveWindow() (*WindowInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.initialized {
+		return nil, fmt.Errorf("detector not initialized")
+	}
+	if d.current.Window == nil {
+		return NoWindow, nil
+	}
+	window := *d.current.Window
+	return &window, nil
+}
+
+// Now returns the time of the current step: start up to the first one,
+// one interval later with each step after it
+func (d *MockDetector) Now() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.start.Add(time.Duration(max(d.next-1, 0)) * d.interval)
+}
+
+// Done is closed once the last step has been played
+func (d *MockDetector) Done() <-chan struct{} {
+	return d.done
+}
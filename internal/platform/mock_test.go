@@ -0,0 +1,67 @@
+package platform
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMockDetectorPlaysSteps(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	d := NewMockDetector([]MockStep{
+		{Window: &WindowInfo{AppName: "editor", WindowTitle: "main.go"}},
+		{Idle: 30 * time.Second},
+		{Locked: true},
+	}, start, time.Second)
+
+	if _, err := d.IsScreenLocked(); err == nil {
+		t.Fatal("Expected an error before Initialize")
+	}
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	if !d.Now().Equal(start) {
+		t.Errorf("Expected the clock at %v before the first step, got %v", start, d.Now())
+	}
+
+	d.IsScreenLocked()
+	window, _ := d.GetActiveWindow()
+	if window.AppName != "editor" || window.WindowTitle != "main.go" {
+		t.Errorf("Expected the editor window, got %+v", window)
+	}
+	if !d.Now().Equal(start) {
+		t.Errorf("Expected the first step at %v, got %v", start, d.Now())
+	}
+
+	d.IsScreenLocked()
+	if window, _ := d.GetActiveWindow(); window != NoWindow {
+		t.Errorf("Expected no window, got %+v", window)
+	}
+	if idle, _ := d.GetIdleTime(); idle != 30*time.Second {
+		t.Errorf("Expected 30s idle, got %v", idle)
+	}
+	if !d.Now().Equal(start.Add(time.Second)) {
+		t.Errorf("Expected the second step one second later, got %v", d.Now())
+	}
+
+	select {
+	case <-d.Done():
+		t.Fatal("Done before the last step")
+	default:
+	}
+	if locked, _ := d.IsScreenLocked(); !locked {
+		t.Error("Expected the last step to be locked")
+	}
+	select {
+	case <-d.Done():
+	default:
+		t.Fatal("Expected Done after the last step")
+	}
+
+	// The last step repeats
+	if locked, _ := d.IsScreenLocked(); !locked {
+		t.Error("Expected the last step to repeat")
+	}
+	if !d.Now().Equal(start.Add(2 * time.Second)) {
+		t.Errorf("Expected the clock to stop at the last step, got %v", d.Now())
+	}
+}
@@ -0,0 +1,53 @@
+package platform
+
+import "sort"
+
+// screenRect is an area of the screen in pixels, in the coordinates of the
+// whole desktop
+type screenRect struct {
+	x, y, width, height int
+}
+
+// overlap returns the area r and other share
+func (r screenRect) overlap(other screenRect) int {
+	width := min(r.x+r.width, other.x+other.width) - max(r.x, other.x)
+	height := min(r.y+r.height, other.y+other.height) - max(r.y, other.y)
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	return width * height
+}
+
+// monitorIndex returns the number of the monitor showing most of window,
+// counting the monitors left to right, then top to bottom, from 0. Clones
+// of a monitor at the same position count once. A window on no monitor
+// returns -1.
+func monitorIndex(window screenRect, monitors []screenRect) int {
+	sorted := make([]screenRect, 0, len(monitors))
+	for _, monitor := range monitors {
+		clone := false
+		for _, other := range sorted {
+			if other.x == monitor.x && other.y == monitor.y {
+				clone = true
+				break
+			}
+		}
+		if !clone {
+			sorted = append(sorted, monitor)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].x != sorted[j].x {
+			return sorted[i].x < sorted[j].x
+		}
+		return sorted[i].y < sorted[j].y
+	})
+
+	index, largest := -1, 0
+	for i, monitor := range sorted {
+		if area := window.overlap(monitor); area > largest {
+			index, largest = i, area
+		}
+	}
+	return index
+}
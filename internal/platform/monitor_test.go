@@ -0,0 +1,29 @@
+package platform
+
+import "testing"
+
+func TestMonitorIndex(t *testing.T) {
+	left := screenRect{0, 0, 1920, 1080}
+	right := screenRect{1920, 0, 1920, 1080}
+	tests := []struct {
+		name     string
+		window   screenRect
+		monitors []screenRect
+		want     int
+	}{
+		{"single monitor", screenRect{100, 100, 800, 600}, []screenRect{left}, 0},
+		{"counted left to right", screenRect{2000, 100, 800, 600}, []screenRect{right, left}, 1},
+		{"most of the window decides", screenRect{1700, 100, 800, 600}, []screenRect{left, right}, 1},
+		{"clones count once", screenRect{2000, 100, 800, 600}, []screenRect{left, left, right}, 1},
+		{"off screen", screenRect{5000, 100, 800, 600}, []screenRect{left, right}, -1},
+		{"no monitors", screenRect{100, 100, 800, 600}, nil, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := monitorIndex(tt.window, tt.monitors); got != tt.want {
+				t.Errorf("Expected monitor %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
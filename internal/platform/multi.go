@@ -0,0 +1,384 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/weii/actime/pkg/logger"
+)
+
+// DefaultDetectorTimeout bounds one call to a detector of a MultiDetector
+const DefaultDetectorTimeout = 250 * time.Millisecond
+
+// NamedDetector is one member of a MultiDetector
+type NamedDetector struct {
+	Name     string
+	Detector Detector
+}
+
+// DetectorHealth is the state of one member of a MultiDetector
+type DetectorHealth struct {
+	Name      string
+	Healthy   bool
+	Failures  int64
+	LastError string
+	LastOK    time.Time
+}
+
+// HealthReporter is implemented by detectors made of several detectors
+type HealthReporter interface {
+	DetectorHealth() []DetectorHealth
+}
+
+// member is a detector of a MultiDetector with its health
+type member struct {
+	name     string
+	detector Detector
+	ready    bool
+	busy     atomic.Bool
+	health   DetectorHealth
+}
+
+// MultiDetector asks several detectors at once, for example Wayland and X11
+// for applications running under XWayland. The active window and lock state
+// come from the first detector in priority order that answers, the idle time
+// is the smallest any detector reports. Every call is bounded by a timeout
+// and the detectors are queried in parallel, so a tick takes at most one
+// timeout however many detectors there are.
+type MultiDetector struct {
+	members []*member
+	timeout time.Duration
+	mu      sync.Mutex // guards the health of members
+}
+
+// NewMultiDetector composes detectors, highest priority first. A timeout of
+// zero uses DefaultDetectorTimeout.
+func NewMultiDetector(detectors []NamedDetector, timeout time.Duration) *MultiDetector {
+	if timeout <= 0 {
+		timeout = DefaultDetectorTimeout
+	}
+	m := &MultiDetector{timeout: timeout}
+	for _, d := range detectors {
+		m.members = append(m.members, &member{
+			name:     d.Name,
+			detector: d.Detector,
+			health:   DetectorHealth{Name: d.Name},
+		})
+	}
+	return m
+}
+
+// Initialize initializes every detector. Detectors that fail are left out
+// and reported as unhealthy; it is an error only when none is left.
+func (m *MultiDetector) Initialize() error {
+	var errs []string
+	for _, mem := range m.members {
+		err := mem.detector.Initialize()
+		m.record(mem, err)
+		if err != nil {
+			logger.GetLogger().Warn("Detector unavailable", "detector", mem.name, "error", err)
+			errs = append(errs, fmt.Sprintf("%s: %v", mem.name, err))
+			continue
+		}
+		mem.ready = true
+	}
+	if len(errs) == len(m.members) {
+		return fmt.Errorf("no detector could be initialized: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Close closes every detector
+func (m *MultiDetector) Close() error {
+	var errs []error
+	for _, mem := range m.members {
+		if mem.ready {
+			if err := mem.detector.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", mem.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetActiveWindow returns the window of the first detector that finds one
+func (m *MultiDetector) GetActiveWindow() (*WindowInfo, error) {
+	windows := make([]*WindowInfo, len(m.members))
+	results := m.query(func(i int, d Detector) error {
+		window, err := d.GetActiveWindow()
+		windows[i] = window
+		return err
+	})
+	i, err := firstSuccess(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active window: %w", err)
+	}
+	return windows[i], nil
+}
+
+// IsScreenLocked returns the lock state of the first detector that answers
+func (m *MultiDetector) IsScreenLocked() (bool, error) {
+	locked := make([]bool, len(m.members))
+	results := m.query(func(i int, d Detector) error {
+		var err error
+		locked[i], err = d.IsScreenLocked()
+		return err
+	})
+	i, err := firstSuccess(results)
+	if err != nil {
+		return false, fmt.Errorf("failed to get lock state: %w", err)
+	}
+	return locked[i], nil
+}
+
+// GetIdleTime returns the smallest idle time of the detectors that answer:
+// input seen by any of them means the user is there
+func (m *MultiDetector) GetIdleTime() (time.Duration, error) {
+	idle := make([]time.Duration, len(m.members))
+	results := m.query(func(i int, d Detector) error {
+		var err error
+		idle[i], err = d.GetIdleTime()
+		return err
+	})
+
+	var min time.Duration
+	found := false
+	var errs []error
+	for i, result := range results {
+		if err := <-result; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !found || idle[i] < min {
+			min = idle[i]
+			found = true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("failed to get idle time: %w", errors.Join(errs...))
+	}
+	return min, nil
+}
+
+// IsMediaPlaying returns true if any detector that can tell sees a
+// fullscreen window or media playing
+func (m *MultiDetector) IsMediaPlaying() (bool, error) {
+	playing := make([]bool, len(m.members))
+	results := m.query(func(i int, d Detector) error {
+		reporter, ok := d.(MediaReporter)
+		if !ok {
+			return nil
+		}
+		var err error
+		playing[i], err = reporter.IsMediaPlaying()
+		return err
+	})
+
+	anyPlaying, found := false, false
+	var errs []error
+	for i, result := range results {
+		if err := <-result; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		found = true
+		anyPlaying = anyPlaying || playing[i]
+	}
+	if !found {
+		return false, fmt.Errorf("failed to get media state: %w", errors.Join(errs...))
+	}
+	return anyPlaying, nil
+}
+
+// SessionState returns the session state of the first detector that
+// follows it
+func (m *MultiDetector) SessionState() string {
+	for _, mem := range m.members {
+		if reporter, ok := mem.detector.(SessionStateReporter); ok && mem.ready {
+			return reporter.SessionState()
+		}
+	}
+	return ""
+}
+
+// Events returns the notifications of the first detector that sends them.
+// The window comes from the first detector in priority order anyway, so
+// one source of events is enough.
+func (m *MultiDetector) Events() <-chan WindowEvent {
+	for _, mem := range m.members {
+		if source, ok := mem.detector.(EventSource); ok && mem.ready {
+			if events := source.Events(); events != nil {
+				return events
+			}
+		}
+	}
+	return nil
+}
+
+// Capabilities reports, for each capability, the first detector in
+// priority order that supports it
+func (m *MultiDetector) Capabilities() []Capability {
+	var capabilities []Capability
+	for _, name := range []string{CapabilityActiveWindow, CapabilityIdle, CapabilityLock} {
+		capability := Capability{Name: name, Detail: "no detector supports it"}
+		for _, mem := range m.members {
+			if !mem.ready {
+				continue
+			}
+			supported := Capability{Name: name, Supported: true}
+			if reporter, ok := mem.detector.(CapabilityReporter); ok {
+				for _, reported := range reporter.Capabilities() {
+					if reported.Name == name {
+						supported = reported
+					}
+				}
+			}
+			if supported.Supported {
+				supported.Method = strings.TrimSuffix(mem.name+": "+supported.Method, ": ")
+				capability = supported
+				break
+			}
+			if capability.Hint == "" {
+				capability.Detail, capability.Hint = mem.name+": "+supported.Detail, supported.Hint
+			}
+		}
+		capabilities = append(capabilities, capability)
+	}
+	return capabilities
+}
+
+// DetectorHealth returns the health of every detector in priority order
+func (m *MultiDetector) DetectorHealth() []DetectorHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	health := make([]DetectorHealth, len(m.members))
+	for i, mem := range m.members {
+		health[i] = mem.health
+	}
+	return health
+}
+
+// query calls fn on every detector at once and returns, per detector, a
+// channel receiving its error once it answers or the timeout passes. A
+// detector still stuck in an earlier call is not called again.
+func (m *MultiDetector) query(fn func(i int, d Detector) error) []chan error {
+	results := make([]chan error, len(m.members))
+	for i, mem := range m.members {
+		results[i] = make(chan error, 1)
+		if !mem.ready {
+			results[i] <- fmt.Errorf("%s: not initialized", mem.name)
+			continue
+		}
+		if !mem.busy.CompareAndSwap(false, true) {
+			err := fmt.Errorf("%s: still busy with an earlier call", mem.name)
+			m.record(mem, err)
+			results[i] <- err
+			continue
+		}
+
+		done := make(chan error, 1)
+		go func(i int, mem *member) {
+			err := fn(i, mem.detector)
+			mem.busy.Store(false)
+			done <- err
+		}(i, mem)
+
+		go func(mem *member, result chan<- error) {
+			timer := time.NewTimer(m.timeout)
+			defer timer.Stop()
+
+			var err error
+			select {
+			case err = <-done:
+				if err != nil {
+					err = fmt.Errorf("%s: %w", mem.name, err)
+				}
+			case <-timer.C:
+				err = fmt.Errorf("%s: timed out after %s", mem.name, m.timeout)
+			}
+			m.record(mem, err)
+			result <- err
+		}(mem, results[i])
+	}
+	return results
+}
+
+// firstSuccess waits for every result, which takes at most one timeout,
+// and returns the index of the first detector in priority order that
+// succeeded. Waiting for all keeps a detector that is merely slower than
+// the winner from being seen as busy on the next call.
+func firstSuccess(results []chan error) (int, error) {
+	first := -1
+	var errs []error
+	for i, result := range results {
+		if err := <-result; err != nil {
+			errs = append(errs, err)
+		} else if first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return -1, errors.Join(errs...)
+	}
+	return first, nil
+}
+
+// record updates the health of a detector after a call, logging when it
+// starts or stops failing
+func (m *MultiDetector) record(mem *member, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		if !mem.health.Healthy && mem.health.Failures > 0 {
+			logger.GetLogger().Info("Detector recovered", "detector", mem.name)
+		}
+		mem.health.Healthy = true
+		mem.health.LastError = ""
+		mem.health.LastOK = time.Now()
+		return
+	}
+
+	if mem.health.Healthy {
+		logger.GetLogger().Warn("Detector failing", "detector", mem.name, "error", err)
+	}
+	mem.health.Healthy = false
+	mem.health.Failures++
+	mem.health.LastError = err.Error()
+}
+
+// newConfiguredDetector builds the detectors named in order from factories.
+// A single name gives that detector alone, several a MultiDetector.
+func newConfiguredDetector(names []string, timeout time.Duration, factories map[string]func() Detector) (Detector, error) {
+	var members []NamedDetector
+	for _, name := range names {
+		factory, ok := factories[strings.ToLower(name)]
+		if !ok {
+			available := make([]string, 0, len(factories))
+			for known := range factories {
+				available = append(available, known)
+			}
+			sort.Strings(available)
+			return nil, fmt.Errorf("unknown detector %q (available: %s)", name, strings.Join(available, ", "))
+		}
+		members = append(members, NamedDetector{Name: strings.ToLower(name), Detector: factory()})
+	}
+
+	if len(members) == 1 {
+		if err := members[0].Detector.Initialize(); err != nil {
+			return nil, fmt.Errorf("failed to initialize %s detector: %w", members[0].Name, err)
+		}
+		return members[0].Detector, nil
+	}
+
+	detector := NewMultiDetector(members, timeout)
+	if err := detector.Initialize(); err != nil {
+		return nil, err
+	}
+	return detector, nil
+}
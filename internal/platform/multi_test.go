@@ -0,0 +1,206 @@
+package platform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDetector answers with the configured window and idle time, failing
+// with err when it is set and taking delay for every call
+type fakeDetector struct {
+	app     string
+	idle    time.Duration
+	err     error
+	initErr error
+	delay   time.Duration
+	playing bool
+	events  chan WindowEvent
+}
+
+func (d *fakeDetector) GetActiveWindow() (*WindowInfo, error) {
+	time.Sleep(d.delay)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return &WindowInfo{AppName: d.app}, nil
+}
+
+func (d *fakeDetector) GetIdleTime() (time.Duration, error) {
+	time.Sleep(d.delay)
+	return d.idle, d.err
+}
+
+func (d *fakeDetector) IsScreenLocked() (bool, error) { return false, d.err }
+func (d *fakeDetector) Initialize() error             { return d.initErr }
+func (d *fakeDetector) Close() error                  { return nil }
+func (d *fakeDetector) IsMediaPlaying() (bool, error) { return d.playing, d.err }
+func (d *fakeDetector) Events() <-chan WindowEvent    { return d.events }
+
+func newTestMulti(t *testing.T, primary, secondary *fakeDetector) *MultiDetector {
+	t.Helper()
+	m := NewMultiDetector([]NamedDetector{
+		{Name: "wayland", Detector: primary},
+		{Name: "x11", Detector: secondary},
+	}, 50*time.Millisecond)
+	if err := m.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize: %v", err)
+	}
+	return m
+}
+
+func TestMultiDetectorPriority(t *testing.T) {
+	m := newTestMulti(t,
+		&fakeDetector{app: "wayland-app", idle: 30 * time.Second},
+		&fakeDetector{app: "xwayland-app", idle: 2 * time.Second})
+
+	window, err := m.GetActiveWindow()
+	if err != nil {
+		t.Fatalf("GetActiveWindow failed: %v", err)
+	}
+	if window.AppName != "wayland-app" {
+		t.Errorf("Expected the first detector to win, got %q", window.AppName)
+	}
+
+	// Input seen by either detector counts
+	idle, err := m.GetIdleTime()
+	if err != nil {
+		t.Fatalf("GetIdleTime failed: %v", err)
+	}
+	if idle != 2*time.Second {
+		t.Errorf("Expected the smallest idle time 2s, got %v", idle)
+	}
+}
+
+func TestMultiDetectorFailover(t *testing.T) {
+	primary := &fakeDetector{err: errors.New("no compositor")}
+	m := newTestMulti(t, primary, &fakeDetector{app: "xwayland-app", idle: 5 * time.Second})
+
+	window, err := m.GetActiveWindow()
+	if err != nil {
+		t.Fatalf("GetActiveWindow failed: %v", err)
+	}
+	if window.AppName != "xwayland-app" {
+		t.Errorf("Expected the second detector to take over, got %q", window.AppName)
+	}
+	if idle, err := m.GetIdleTime(); err != nil || idle != 5*time.Second {
+		t.Errorf("Expected the idle time of the working detector, got %v (%v)", idle, err)
+	}
+
+	health := m.DetectorHealth()
+	if health[0].Healthy || health[0].Failures != 2 || !strings.Contains(health[0].LastError, "no compositor") {
+		t.Errorf("Expected the first detector to be failing, got %+v", health[0])
+	}
+	if !health[1].Healthy || health[1].Failures != 0 {
+		t.Errorf("Expected the second detector to be healthy, got %+v", health[1])
+	}
+
+	// Both failing is an error
+	m = newTestMulti(t, primary, &fakeDetector{err: errors.New("no display")})
+	if _, err := m.GetActiveWindow(); err == nil {
+		t.Error("Expected an error when every detector fails")
+	}
+	if _, err := m.GetIdleTime(); err == nil {
+		t.Error("Expected an error when every detector fails")
+	}
+}
+
+func TestMultiDetectorMediaPlaying(t *testing.T) {
+	// Media seen by any detector counts, whatever their priority
+	m := newTestMulti(t, &fakeDetector{}, &fakeDetector{playing: true})
+	if playing, err := m.IsMediaPlaying(); err != nil || !playing {
+		t.Errorf("Expected media playing, got %v (%v)", playing, err)
+	}
+
+	m = newTestMulti(t, &fakeDetector{err: errors.New("no compositor")}, &fakeDetector{})
+	if playing, err := m.IsMediaPlaying(); err != nil || playing {
+		t.Errorf("Expected no media playing, got %v (%v)", playing, err)
+	}
+
+	m = newTestMulti(t, &fakeDetector{err: errors.New("no compositor")}, &fakeDetector{err: errors.New("no display")})
+	if _, err := m.IsMediaPlaying(); err == nil {
+		t.Error("Expected an error when every detector fails")
+	}
+}
+
+func TestMultiDetectorEvents(t *testing.T) {
+	secondary := &fakeDetector{events: make(chan WindowEvent)}
+	m := newTestMulti(t, &fakeDetector{}, secondary)
+	if m.Events() != (<-chan WindowEvent)(secondary.events) {
+		t.Error("Expected the events of the only detector sending them")
+	}
+
+	m = newTestMulti(t, &fakeDetector{}, &fakeDetector{})
+	if m.Events() != nil {
+		t.Error("Expected no events when no detector sends them")
+	}
+}
+
+func TestMultiDetectorTimeout(t *testing.T) {
+	slow := &fakeDetector{app: "slow", delay: 500 * time.Millisecond}
+	m := newTestMulti(t, slow, &fakeDetector{app: "fast", delay: 10 * time.Millisecond})
+
+	// The slow detector is given up on after one timeout, not waited for
+	start := time.Now()
+	window, err := m.GetActiveWindow()
+	if err != nil {
+		t.Fatalf("GetActiveWindow failed: %v", err)
+	}
+	if took := time.Since(start); took > 300*time.Millisecond {
+		t.Errorf("Expected the call to be bounded by the timeout, took %v", took)
+	}
+	if window.AppName != "fast" {
+		t.Errorf("Expected the fast detector to answer, got %q", window.AppName)
+	}
+
+	// It is not called again while the first call is still running
+	if _, err := m.GetIdleTime(); err != nil {
+		t.Fatalf("GetIdleTime failed: %v", err)
+	}
+	if health := m.DetectorHealth()[0]; health.Healthy || !strings.Contains(health.LastError, "busy") {
+		t.Errorf("Expected the slow detector to be reported busy, got %+v", health)
+	}
+}
+
+func TestMultiDetectorSkipsUninitialized(t *testing.T) {
+	m := newTestMulti(t,
+		&fakeDetector{initErr: errors.New("no wayland socket")},
+		&fakeDetector{app: "xwayland-app"})
+
+	if window, err := m.GetActiveWindow(); err != nil || window.AppName != "xwayland-app" {
+		t.Errorf("Expected the initialized detector to answer, got %v (%v)", window, err)
+	}
+
+	none := NewMultiDetector([]NamedDetector{{Name: "x11", Detector: &fakeDetector{initErr: errors.New("no display")}}}, 0)
+	if err := none.Initialize(); err == nil {
+		t.Error("Expected an error when no detector initializes")
+	}
+}
+
+func TestNewConfiguredDetector(t *testing.T) {
+	factories := map[string]func() Detector{
+		"x11":     func() Detector { return &fakeDetector{app: "x"} },
+		"wayland": func() Detector { return &fakeDetector{app: "w"} },
+	}
+
+	single, err := newConfiguredDetector([]string{"X11"}, 0, factories)
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+	if _, ok := single.(*fakeDetector); !ok {
+		t.Errorf("Expected one name to give the detector itself, got %T", single)
+	}
+
+	multi, err := newConfiguredDetector([]string{"wayland", "x11"}, 0, factories)
+	if err != nil {
+		t.Fatalf("Failed to create detector: %v", err)
+	}
+	if window, err := multi.GetActiveWindow(); err != nil || window.AppName != "w" {
+		t.Errorf("Expected the first named detector to win, got %v (%v)", window, err)
+	}
+
+	if _, err := newConfiguredDetector([]string{"quartz"}, 0, factories); err == nil || !strings.Contains(err.Error(), "wayland, x11") {
+		t.Errorf("Expected an unknown detector error listing the known ones, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package platform
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// WatchSleep calls handler with true when the system is about to suspend
+// and with false once it has resumed, as logind announces them with
+// PrepareForSleep, until stop is called
+func WatchSleep(handler func(sleeping bool)) (stop func(), err error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.login1.Manager"),
+		dbus.WithMatchMember("PrepareForSleep"),
+		dbus.WithMatchObjectPath("/org/freedesktop/login1"),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to PrepareForSleep: %w", err)
+	}
+
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	go func() {
+		// The channel is closed when the connection is
+		for signal := range signals {
+			if signal.Name != "org.freedesktop.login1.Manager.PrepareForSleep" || len(signal.Body) != 1 {
+				continue
+			}
+			if sleeping, ok := signal.Body[0].(bool); ok {
+				handler(sleeping)
+			}
+		}
+	}()
+
+	return func() { conn.Close() }, nil
+}
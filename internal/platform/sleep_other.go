@@ -0,0 +1,11 @@
+//go:build !linux
+
+package platform
+
+import "errors"
+
+// WatchSleep is only supported on Linux; elsewhere the tracker notices a
+// suspend by the clock jumping between ticks
+func WatchSleep(handler func(sleeping bool)) (stop func(), err error) {
+	return nil, errors.New("sleep notifications are not supported on this platform")
+}
@@ -0,0 +1,71 @@
+package platform
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/weii/actime/internal/title"
+)
+
+// maxCombiningMarks is the most combining marks kept on one character;
+// longer runs are decoration spam rather than text
+const maxCombiningMarks = 2
+
+// CleanTitle makes a window title safe to store. Invalid UTF-8 is replaced,
+// control characters are dropped (tabs and line breaks become spaces),
+// runs of combining marks are cut short, the result is sanitized as in
+// title.Sanitize and surrounding whitespace is trimmed. A title with
+// nothing readable left is returned as "".
+func CleanTitle(raw string) string {
+	raw = strings.ToValidUTF8(raw, string(utf8.RuneError))
+
+	var b strings.Builder
+	marks := 0
+	readable := false
+	for _, r := range raw {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			r = ' '
+		case unicode.IsControl(r):
+			continue
+		}
+
+		if unicode.Is(unicode.Mn, r) {
+			marks++
+			if marks > maxCombiningMarks {
+				continue
+			}
+		} else {
+			marks = 0
+			if unicode.IsGraphic(r) && !unicode.IsSpace(r) && r != utf8.RuneError {
+				readable = true
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	if !readable {
+		return ""
+	}
+	return strings.TrimSpace(title.Sanitize(b.String()))
+}
+
+// decodeTextProperty decodes an X11 text property of the given type.
+// UTF8_STRING values are UTF-8 and COMPOUND_TEXT values are ISO 2022;
+// legacy STRING values are Latin-1, although many clients store UTF-8
+// there, so valid UTF-8 is taken as such.
+func decodeTextProperty(value []byte, typeName string) string {
+	if typeName == "COMPOUND_TEXT" {
+		return decodeCompoundText(value)
+	}
+	if typeName == "UTF8_STRING" || utf8.Valid(value) {
+		return strings.ToValidUTF8(string(value), string(utf8.RuneError))
+	}
+
+	runes := make([]rune, len(value))
+	for i, c := range value {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,77 @@
+package platform
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func TestCleanTitle(t *testing.T) {
+	zalgo := "h" + strings.Repeat("\u0301\u0302\u0303", 20) + "i"
+
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{"plain", "main.go - editor", "main.go - editor"},
+		{"null bytes", "\x00\x00\x00", ""},
+		{"single space", " ", ""},
+		{"trailing null", "Inbox\x00", "Inbox"},
+		{"control characters", "a\x07b\x1bc\x7fd", "abcd"},
+		{"line breaks", "first\r\nsecond\tthird", "first  second third"},
+		{"invalid UTF-8", "caf\xe9 \xff\xfe", "caf\uFFFD \uFFFD"},
+		{"only replacement characters", "\xff\xfe\xfd", ""},
+		{"only combining marks", "\u0301\u0301", ""},
+		{"combining spam", zalgo, "h\u0301\u0302i"},
+		{"accents composed", "cafe\u0301 re\u0301sume\u0301", "caf\u00e9 r\u00e9sum\u00e9"},
+		{"zero-width space inside", "Inbox\u200b - Mail", "Inbox - Mail"},
+		{"no-break spaces", "\u00a0 Terminal \u00a0", "Terminal"},
+		{"zero-width only", "\u200b\u200b", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CleanTitle(tt.title)
+			if got != tt.want {
+				t.Errorf("CleanTitle(%q) = %q, expected %q", tt.title, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("CleanTitle(%q) returned invalid UTF-8", tt.title)
+			}
+			for _, r := range got {
+				if unicode.IsControl(r) {
+					t.Errorf("CleanTitle(%q) kept control character %U", tt.title, r)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeTextProperty(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    []byte
+		typeName string
+		want     string
+	}{
+		{"UTF8_STRING", []byte("caf\xc3\xa9"), "UTF8_STRING", "café"},
+		{"UTF8_STRING with invalid bytes", []byte("caf\xe9"), "UTF8_STRING", "caf\uFFFD"},
+		{"Latin-1 STRING", []byte("caf\xe9 cr\xe8me"), "STRING", "café crème"},
+		{"UTF-8 stored as STRING", []byte("\xe7\x95\x8c"), "STRING", "界"},
+		{"empty", nil, "STRING", ""},
+		{"COMPOUND_TEXT Latin-1", []byte("caf\xe9"), "COMPOUND_TEXT", "café"},
+		{"COMPOUND_TEXT Cyrillic", []byte("\x1b-L\xbf\xe0\xd8\xd2\xd5\xe2 - Vim"), "COMPOUND_TEXT", "Привет - Vim"},
+		{"COMPOUND_TEXT Japanese", []byte("\x1b$)B\xc6\xfc\xcb\xdc\x1b-A.txt"), "COMPOUND_TEXT", "日本.txt"},
+		{"COMPOUND_TEXT Chinese in GL", []byte("\x1b$(A\x3d\x67\x1b(B!"), "COMPOUND_TEXT", "界!"},
+		{"COMPOUND_TEXT UTF-8 segment", []byte("a \x1b%G\xe2\x9c\x93\x1b%@ b"), "COMPOUND_TEXT", "a ✓ b"},
+		{"COMPOUND_TEXT unknown set", []byte("\x1b-Z\xe0x"), "COMPOUND_TEXT", "\uFFFDx"},
+	}
+
+	for _, tt := range tests {
+		if got := decodeTextProperty(tt.value, tt.typeName); got != tt.want {
+			t.Errorf("%s: decodeTextProperty(%q) = %q, expected %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package platform
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Store apps run inside a frame window of ApplicationFrameHost; the app's
+// own process owns the core window within it
+const (
+	frameHostExe    = "ApplicationFrameHost.exe"
+	coreWindowClass = "Windows.UI.Core.CoreWindow"
+)
+
+// appxManifest is the part of AppxManifest.xml naming a package and its
+// applications. Elements are matched whatever their namespace, so both
+// VisualElements and uap:VisualElements are read.
+type appxManifest struct {
+	Identity struct {
+		Name string `xml:"Name,attr"`
+	} `xml:"Identity"`
+	Properties struct {
+		DisplayName string `xml:"DisplayName"`
+	} `xml:"Properties"`
+	Applications []struct {
+		ID             string `xml:"Id,attr"`
+		VisualElements struct {
+			DisplayName string `xml:"DisplayName,attr"`
+		} `xml:"VisualElements"`
+	} `xml:"Applications>Application"`
+}
+
+// manifestDisplayName returns the package name and the display name of the
+// application appID from a package manifest, or of the package when the
+// application has none. The display name may be an ms-resource reference.
+func manifestDisplayName(data []byte, appID string) (packageName, displayName string, err error) {
+	var manifest appxManifest
+	if err := xml.Unmarshal(data, &manifest); err != nil {
+		return "", "", fmt.Errorf("failed to parse package manifest: %w", err)
+	}
+	for _, app := range manifest.Applications {
+		if strings.EqualFold(app.ID, appID) && app.VisualElements.DisplayName != "" {
+			return manifest.Identity.Name, app.VisualElements.DisplayName, nil
+		}
+	}
+	if manifest.Properties.DisplayName == "" {
+		return "", "", fmt.Errorf("package manifest has no display name")
+	}
+	return manifest.Identity.Name, manifest.Properties.DisplayName, nil
+}
+
+// resourceURI turns the ms-resource reference of a manifest into the full
+// URI SHLoadIndirectString resolves. A bare name is a string of the
+// package's "resources" map.
+func resourceURI(packageName, value string) string {
+	key := strings.TrimPrefix(value, "ms-resource:")
+	switch {
+	case strings.HasPrefix(key, "//"):
+		return "ms-resource:" + key
+	case strings.HasPrefix(key, "/"):
+		return "ms-resource://" + packageName + key
+	case strings.Contains(key, "/"):
+		return "ms-resource://" + packageName + "/" + key
+	}
+	return "ms-resource://" + packageName + "/resources/" + key
+}
+
+// aumidParts splits an application user model ID such as
+// "Microsoft.WindowsCalculator_8wekyb3d8bbwe!App" into the package name and
+// the application ID
+func aumidParts(aumid string) (packageName, appID string) {
+	family, appID, _ := strings.Cut(aumid, "!")
+	packageName, _, _ = strings.Cut(family, "_")
+	return packageName, appID
+}
+
+// frameTitleApp guesses the app's name from the title of its frame window,
+// which is the app's name or "document - app name". Windows puts direction
+// marks around the separator.
+func frameTitleApp(title string) string {
+	title = strings.NewReplacer("\u200e", "", "\u200f", "").Replace(title)
+	for _, separator := range []string{" - ", " – ", " — "} {
+		if i := strings.LastIndex(title, separator); i >= 0 {
+			title = title[i+len(separator):]
+		}
+	}
+	return strings.TrimSpace(title)
+}
@@ -0,0 +1,71 @@
+package platform
+
+import "testing"
+
+func TestManifestDisplayName(t *testing.T) {
+	manifest := []byte(`<Package xmlns:uap="http://schemas.microsoft.com/appx/manifest/uap/windows10">
+  <Identity Name="5319275A.WhatsAppDesktop"/>
+  <Properties><DisplayName>WhatsApp Desktop</DisplayName></Properties>
+  <Applications>
+    <Application Id="App"><uap:VisualElements DisplayName="WhatsApp"/></Application>
+    <Application Id="Helper"><uap:VisualElements/></Application>
+  </Applications>
+</Package>`)
+
+	tests := []struct {
+		appID string
+		want  string
+	}{
+		{"App", "WhatsApp"},
+		{"Helper", "WhatsApp Desktop"},
+		{"Unknown", "WhatsApp Desktop"},
+	}
+	for _, tt := range tests {
+		packageName, displayName, err := manifestDisplayName(manifest, tt.appID)
+		if err != nil {
+			t.Fatalf("Failed to read manifest: %v", err)
+		}
+		if packageName != "5319275A.WhatsAppDesktop" || displayName != tt.want {
+			t.Errorf("Application %s: expected %q of 5319275A.WhatsAppDesktop, got %q of %q", tt.appID, tt.want, displayName, packageName)
+		}
+	}
+
+	if _, _, err := manifestDisplayName([]byte(`<Package><Identity Name="x"/></Package>`), "App"); err == nil {
+		t.Error("Expected an error for a manifest without a display name")
+	}
+}
+
+func TestResourceURI(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"ms-resource:AppName", "ms-resource://Pkg/resources/AppName"},
+		{"ms-resource:Resources/AppName", "ms-resource://Pkg/Resources/AppName"},
+		{"ms-resource:///Resources/AppName", "ms-resource:///Resources/AppName"},
+		{"ms-resource:/Resources/AppName", "ms-resource://Pkg/Resources/AppName"},
+		{"ms-resource://Other/resources/AppName", "ms-resource://Other/resources/AppName"},
+	}
+	for _, tt := range tests {
+		if got := resourceURI("Pkg", tt.value); got != tt.want {
+			t.Errorf("resourceURI(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFrameTitleApp(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Calculator", "Calculator"},
+		{"Inbox \u200e- Mail", "Mail"},
+		{"Photo – 2026 - Photos", "Photos"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := frameTitleApp(tt.title); got != tt.want {
+			t.Errorf("frameTitleApp(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+//go:build linux
+
+package platform
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// wlDisplayID is the object ID of wl_display, which every connection starts with
+const wlDisplayID = 1
+
+// wlHandler receives the events of one object
+type wlHandler func(opcode uint16, args *wlArgs)
+
+// wlConn is a minimal Wayland client. It speaks just enough of the wire
+// protocol to bind globals and follow their events; nothing it uses passes
+// file descriptors. Events are read on their own goroutine and handed to
+// the handler of their object in order.
+type wlConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	mu       sync.Mutex // guards the fields below
+	nextID   uint32
+	handlers map[uint32]wlHandler
+	err      error
+
+	done chan struct{} // closed when the connection ends
+}
+
+// wlSocketPath returns the compositor socket named by WAYLAND_DISPLAY,
+// relative to XDG_RUNTIME_DIR unless it is absolute
+func wlSocketPath() (string, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		display = "wayland-0"
+	}
+	if filepath.IsAbs(display) {
+		return display, nil
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("XDG_RUNTIME_DIR is not set")
+	}
+	return filepath.Join(dir, display), nil
+}
+
+// dialWayland connects to the compositor
+func dialWayland() (*wlConn, error) {
+	path, err := wlSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Wayland compositor: %w", err)
+	}
+	return newWlConn(conn), nil
+}
+
+// newWlConn starts reading events from an open connection
+func newWlConn(conn net.Conn) *wlConn {
+	c := &wlConn{
+		conn:     conn,
+		nextID:   wlDisplayID + 1,
+		handlers: make(map[uint32]wlHandler),
+		done:     make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// newID allocates the ID of an object the client creates
+func (c *wlConn) newID() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	return id
+}
+
+// handle sets the handler of an object's events
+func (c *wlConn) handle(id uint32, handler wlHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[id] = handler
+}
+
+// request sends a request to an object
+func (c *wlConn) request(id uint32, opcode uint16, args ...interface{}) error {
+	message, err := wlMessage(id, opcode, args...)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(message); err != nil {
+		return fmt.Errorf("failed to send Wayland request: %w", err)
+	}
+	return nil
+}
+
+// wlMessage encodes a message to an object. Arguments are uint32 and int32
+// values, strings and byte arrays.
+func wlMessage(id uint32, opcode uint16, args ...interface{}) ([]byte, error) {
+	message := make([]byte, 8, 32)
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			message = binary.NativeEndian.AppendUint32(message, v)
+		case int32:
+			message = binary.NativeEndian.AppendUint32(message, uint32(v))
+		case string:
+			message = binary.NativeEndian.AppendUint32(message, uint32(len(v)+1))
+			message = append(message, v...)
+			message = append(message, make([]byte, wlPadding(len(v)+1)-len(v))...)
+		case []byte:
+			message = binary.NativeEndian.AppendUint32(message, uint32(len(v)))
+			message = append(message, v...)
+			message = append(message, make([]byte, wlPadding(len(v))-len(v))...)
+		default:
+			return nil, fmt.Errorf("unsupported Wayland argument %T", arg)
+		}
+	}
+	binary.NativeEndian.PutUint32(message, id)
+	binary.NativeEndian.PutUint32(message[4:], uint32(len(message))<<16|uint32(opcode))
+	return message, nil
+}
+
+// roundtrip waits until the compositor has handled every request sent so
+// far, and so sent every event they cause
+func (c *wlConn) roundtrip(timeout time.Duration) error {
+	id := c.newID()
+	synced := make(chan struct{})
+	var once sync.Once
+	c.handle(id, func(opcode uint16, args *wlArgs) {
+		once.Do(func() { close(synced) })
+	})
+	if err := c.request(wlDisplayID, 0, id); err != nil { // wl_display.sync
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-synced:
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-timer.C:
+		return fmt.Errorf("Wayland compositor did not answer within %s", timeout)
+	}
+}
+
+// Err returns why the connection ended, or nil while it is open
+func (c *wlConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection
+func (c *wlConn) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// readLoop dispatches events until the connection ends
+func (c *wlConn) readLoop() {
+	header := make([]byte, 8)
+	var err error
+	for {
+		if _, err = io.ReadFull(c.conn, header); err != nil {
+			break
+		}
+		id := binary.NativeEndian.Uint32(header)
+		word := binary.NativeEndian.Uint32(header[4:])
+		size, opcode := word>>16, uint16(word)
+		if size < 8 {
+			err = fmt.Errorf("malformed Wayland message of %d bytes", size)
+			break
+		}
+		body := make([]byte, size-8)
+		if _, err = io.ReadFull(c.conn, body); err != nil {
+			break
+		}
+
+		args := &wlArgs{data: body}
+		if id == wlDisplayID {
+			switch opcode {
+			case 0: // error
+				object, code, message := args.Uint(), args.Uint(), args.String()
+				err = fmt.Errorf("Wayland protocol error %d on object %d: %s", code, object, message)
+			case 1: // delete_id
+				deleted := args.Uint()
+				c.mu.Lock()
+				delete(c.handlers, deleted)
+				c.mu.Unlock()
+			}
+			if err != nil {
+				break
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		handler := c.handlers[id]
+		c.mu.Unlock()
+		if handler != nil {
+			handler(opcode, args)
+		}
+	}
+
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+		err = fmt.Errorf("Wayland connection closed")
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// wlPadding rounds n up to the 32-bit words of the wire format
+func wlPadding(n int) int {
+	return (n + 3) &^ 3
+}
+
+// wlArgs reads the arguments of an event in order. Reading past the end
+// yields zero values.
+type wlArgs struct {
+	data []byte
+}
+
+// Uint reads a uint, object or new_id argument
+func (a *wlArgs) Uint() uint32 {
+	if len(a.data) < 4 {
+		a.data = nil
+		return 0
+	}
+	v := binary.NativeEndian.Uint32(a.data)
+	a.data = a.data[4:]
+	return v
+}
+
+// Array reads an array argument
+func (a *wlArgs) Array() []byte {
+	n := int(a.Uint())
+	if n > len(a.data) {
+		a.data = nil
+		return nil
+	}
+	v := a.data[:n]
+	a.data = a.data[min(wlPadding(n), len(a.data)):]
+	return v
+}
+
+// String reads a string argument
+func (a *wlArgs) String() string {
+	v := a.Array()
+	if len(v) > 0 && v[len(v)-1] == 0 {
+		v = v[:len(v)-1]
+	}
+	return string(v)
+}
+
+// wlGlobal is a global object the compositor announces in the registry
+type wlGlobal struct {
+	name    uint32
+	iface   string
+	version uint32
+}
+
+// wlRegistry lists the compositor's globals
+type wlRegistry struct {
+	conn    *wlConn
+	id      uint32
+	mu      sync.Mutex
+	globals map[string]wlGlobal
+}
+
+// registry gets the registry and waits for the globals it announces
+func (c *wlConn) registry(timeout time.Duration) (*wlRegistry, error) {
+	r := &wlRegistry{conn: c, id: c.newID(), globals: make(map[string]wlGlobal)}
+	c.handle(r.id, func(opcode uint16, args *wlArgs) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		switch opcode {
+		case 0: // global
+			g := wlGlobal{name: args.Uint(), iface: args.String(), version: args.Uint()}
+			if _, ok := r.globals[g.iface]; !ok {
+				r.globals[g.iface] = g
+			}
+		case 1: // global_remove
+			name := args.Uint()
+			for iface, g := range r.globals {
+				if g.name == name {
+					delete(r.globals, iface)
+				}
+			}
+		}
+	})
+	if err := c.request(wlDisplayID, 1, r.id); err != nil { // wl_display.get_registry
+		return nil, err
+	}
+	if err := c.roundtrip(timeout); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// bind binds the first global of an interface at no more than version and
+// returns the new object's ID. ok is false when there is no such global.
+func (r *wlRegistry) bind(iface string, version uint32, handler wlHandler) (id uint32, ok bool, err error) {
+	r.mu.Lock()
+	g, ok := r.globals[iface]
+	r.mu.Unlock()
+	if !ok {
+		return 0, false, nil
+	}
+
+	id = r.conn.newID()
+	if handler != nil {
+		r.conn.handle(id, handler)
+	}
+	if err := r.conn.request(r.id, 0, g.name, iface, min(version, g.version), id); err != nil { // wl_registry.bind
+		return 0, true, err
+	}
+	return id, true, nil
+}
@@ -0,0 +1,94 @@
+package platform
+
+import "errors"
+
+// errAPIUnavailable is returned by a Win32 wrapper when this Windows version
+// does not export the function it calls
+var errAPIUnavailable = errors.New("win32 API not available")
+
+// windowAPI wraps GetForegroundWindow, GetWindowTextW and GetClassNameW
+type windowAPI interface {
+	ForegroundWindow() (uintptr, error)
+	WindowText(hwnd uintptr) (string, error)
+	ClassName(hwnd uintptr) (string, error)
+}
+
+// processAPI wraps GetWindowThreadProcessId and QueryFullProcessImageNameW
+type processAPI interface {
+	WindowProcessID(hwnd uintptr) (uint32, error)
+	ImagePath(pid uint32) (string, error)
+}
+
+// inputAPI wraps GetLastInputInfo and GetTickCount64
+type inputAPI interface {
+	LastInputTick() (uint32, error)
+	TickCount() (uint64, error)
+}
+
+// desktopAPI wraps OpenInputDesktop
+type desktopAPI interface {
+	// InputDesktopAvailable reports whether the input desktop can be
+	// opened, which it cannot while the lock screen is shown
+	InputDesktopAvailable() (bool, error)
+}
+
+// sessionAPI wraps WTSQuerySessionInformationW and
+// WTSRegisterSessionNotification
+type sessionAPI interface {
+	SessionLocked() (bool, error)
+	// Subscribe calls handler with every WM_WTSSESSION_CHANGE code for the
+	// current session until stop is called
+	Subscribe(handler func(event uint32)) (stop func(), err error)
+}
+
+// notificationAPI wraps SHQueryUserNotificationState
+type notificationAPI interface {
+	// Fullscreen reports whether a fullscreen application, a game or a
+	// presentation has the screen
+	Fullscreen() (bool, error)
+}
+
+// monitorAPI wraps MonitorFromWindow, GetMonitorInfoW and
+// EnumDisplayMonitors
+type monitorAPI interface {
+	// WindowMonitor returns the area of the monitor showing most of the window
+	WindowMonitor(hwnd uintptr) (screenRect, error)
+	// Monitors returns the areas of all monitors of the desktop
+	Monitors() ([]screenRect, error)
+}
+
+// foregroundAPI wraps SetWinEventHook for EVENT_SYSTEM_FOREGROUND
+type foregroundAPI interface {
+	// WatchForeground calls handler whenever another window comes to the
+	// foreground until stop is called
+	WatchForeground(handler func()) (stop func(), err error)
+}
+
+// packageAPI wraps EnumChildWindows, GetApplicationUserModelId,
+// GetPackageFullName, GetPackagePathByFullName and SHLoadIndirectString,
+// which name the Store apps ApplicationFrameHost shows
+type packageAPI interface {
+	ChildWindows(hwnd uintptr) ([]uintptr, error)
+	// AppUserModelID returns the application user model ID of a packaged
+	// process, such as "Microsoft.WindowsCalculator_8wekyb3d8bbwe!App"
+	AppUserModelID(pid uint32) (string, error)
+	// Package returns the full name of the package of a process and the
+	// directory it is installed in
+	Package(pid uint32) (fullName, dir string, err error)
+	// IndirectString resolves a string such as "@{package?ms-resource://...}"
+	IndirectString(source string) (string, error)
+}
+
+// win32 is the set of Win32 wrappers the Windows detector calls. Tests
+// replace them with fakes.
+type win32 struct {
+	window     windowAPI
+	process    processAPI
+	input      inputAPI
+	desktop    desktopAPI
+	session    sessionAPI
+	notify     notificationAPI
+	monitor    monitorAPI
+	foreground foregroundAPI
+	packages   packageAPI
+}
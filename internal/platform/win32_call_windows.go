@@ -0,0 +1,60 @@
+//go:build windows
+
+package platform
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32   = windows.NewLazySystemDLL("user32.dll")
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	wtsapi32 = windows.NewLazySystemDLL("wtsapi32.dll")
+	shell32  = windows.NewLazySystemDLL("shell32.dll")
+)
+
+// callProc calls proc and returns its result. When the call returns zero
+// the error it set is returned, and errAPIUnavailable when proc does not
+// exist on this Windows version.
+func callProc(proc *windows.LazyProc, args ...uintptr) (uintptr, error) {
+	if err := proc.Find(); err != nil {
+		return 0, fmt.Errorf("%s: %w", proc.Name, errAPIUnavailable)
+	}
+
+	r1, _, err := proc.Call(args...)
+	if r1 == 0 {
+		if errno, ok := err.(syscall.Errno); ok && errno != 0 {
+			return 0, fmt.Errorf("%s: %w", proc.Name, errno)
+		}
+	}
+	return r1, nil
+}
+
+// callStatus calls proc, which returns a Win32 error code: zero on success
+func callStatus(proc *windows.LazyProc, args ...uintptr) error {
+	if err := proc.Find(); err != nil {
+		return fmt.Errorf("%s: %w", proc.Name, errAPIUnavailable)
+	}
+	if status, _, _ := proc.Call(args...); status != 0 {
+		return fmt.Errorf("%s: %w", proc.Name, windows.Errno(status))
+	}
+	return nil
+}
+
+// newWin32 returns the wrappers calling the real Win32 API
+func newWin32() win32 {
+	return win32{
+		window:     windowProcs{},
+		process:    processProcs{},
+		input:      inputProcs{},
+		desktop:    desktopProcs{},
+		session:    sessionProcs{},
+		notify:     notificationProcs{},
+		monitor:    monitorProcs{},
+		foreground: foregroundProcs{},
+		packages:   packageProcs{},
+	}
+}
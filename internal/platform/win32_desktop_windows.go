@@ -0,0 +1,35 @@
+//go:build windows
+
+package platform
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procOpenInputDesktop = user32.NewProc("OpenInputDesktop")
+	procCloseDesktop     = user32.NewProc("CloseDesktop")
+)
+
+// desktopSwitchDesktop is the DESKTOP_SWITCHDESKTOP access right
+const desktopSwitchDesktop = 0x0100
+
+// desktopProcs implements desktopAPI with user32.dll
+type desktopProcs struct{}
+
+// InputDesktopAvailable reports whether the input desktop can be opened.
+// While the lock screen is shown the input desktop is the secure desktop,
+// which a user process is denied.
+func (desktopProcs) InputDesktopAvailable() (bool, error) {
+	desktop, err := callProc(procOpenInputDesktop, 0, 0, desktopSwitchDesktop)
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	callProc(procCloseDesktop, desktop)
+	return true, nil
+}
@@ -0,0 +1,103 @@
+//go:build windows
+
+package platform
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procSetWinEventHook    = user32.NewProc("SetWinEventHook")
+	procUnhookWinEvent     = user32.NewProc("UnhookWinEvent")
+	procPeekMessageW       = user32.NewProc("PeekMessageW")
+	procPostThreadMessageW = user32.NewProc("PostThreadMessageW")
+)
+
+const (
+	eventSystemForeground  = 0x0003
+	wineventOutOfContext   = 0x0000
+	wineventSkipOwnProcess = 0x0002
+	wmQuit                 = 0x0012
+	wmUser                 = 0x0400
+	pmNoRemove             = 0x0000
+)
+
+var (
+	// foregroundHook is the hook procedure; callbacks cannot be freed, so
+	// it is created only once
+	foregroundHook = sync.OnceValue(func() uintptr {
+		return windows.NewCallback(foregroundHookProc)
+	})
+
+	// foregroundHandlers maps each hook to its handler
+	foregroundHandlers sync.Map
+)
+
+// foregroundHookProc passes foreground changes to the hook's handler
+func foregroundHookProc(hook, event, hwnd, object, child, thread, eventTime uintptr) uintptr {
+	if handler, ok := foregroundHandlers.Load(hook); ok {
+		handler.(func())()
+	}
+	return 0
+}
+
+// foregroundProcs implements foregroundAPI with user32.dll
+type foregroundProcs struct{}
+
+// WatchForeground sets an out-of-context event hook for foreground changes
+// and pumps messages for it on a dedicated thread
+func (foregroundProcs) WatchForeground(handler func()) (func(), error) {
+	ready := make(chan uint32)
+	failed := make(chan error)
+	go func() {
+		// An out-of-context hook is called on the thread that set it,
+		// while that thread waits for messages
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hook, err := callProc(procSetWinEventHook,
+			eventSystemForeground, eventSystemForeground,
+			0, foregroundHook(), 0, 0,
+			wineventOutOfContext|wineventSkipOwnProcess)
+		if err == nil && hook == 0 {
+			err = fmt.Errorf("SetWinEventHook failed")
+		}
+		if err != nil {
+			failed <- err
+			return
+		}
+		foregroundHandlers.Store(hook, handler)
+		defer func() {
+			procUnhookWinEvent.Call(hook)
+			foregroundHandlers.Delete(hook)
+		}()
+
+		// Make sure the thread has a message queue before stop can post
+		// to it
+		var m msg
+		procPeekMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, wmUser, wmUser, pmNoRemove)
+		ready <- windows.GetCurrentThreadId()
+
+		for {
+			result, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(result) <= 0 {
+				return
+			}
+			procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return nil, fmt.Errorf("failed to hook foreground changes: %w", err)
+	case thread := <-ready:
+		return func() {
+			procPostThreadMessageW.Call(uintptr(thread), wmQuit, 0, 0)
+		}, nil
+	}
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package platform
+
+import (
+	"errors"
+	"unsafe"
+)
+
+var (
+	procGetLastInputInfo = user32.NewProc("GetLastInputInfo")
+	procGetTickCount64   = kernel32.NewProc("GetTickCount64")
+	procGetTickCount     = kernel32.NewProc("GetTickCount")
+)
+
+// lastInputInfo is the LASTINPUTINFO structure
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// inputProcs implements inputAPI with user32.dll and kernel32.dll
+type inputProcs struct{}
+
+// LastInputTick returns the tick count of the last input event
+func (inputProcs) LastInputTick() (uint32, error) {
+	info := lastInputInfo{cbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	if _, err := callProc(procGetLastInputInfo, uintptr(unsafe.Pointer(&info))); err != nil {
+		return 0, err
+	}
+	return info.dwTime, nil
+}
+
+// TickCount returns the milliseconds since system start. Windows versions
+// without GetTickCount64 use the 32-bit GetTickCount.
+func (inputProcs) TickCount() (uint64, error) {
+	ticks, err := callProc(procGetTickCount64)
+	if errors.Is(err, errAPIUnavailable) {
+		ticks, err = callProc(procGetTickCount)
+	}
+	return uint64(ticks), err
+}
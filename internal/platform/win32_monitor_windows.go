@@ -0,0 +1,81 @@
+//go:build windows
+
+package platform
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procMonitorFromWindow   = user32.NewProc("MonitorFromWindow")
+	procGetMonitorInfoW     = user32.NewProc("GetMonitorInfoW")
+	procEnumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
+)
+
+// monitorDefaultToNull makes MonitorFromWindow return 0 for a window on no
+// monitor
+const monitorDefaultToNull = 0
+
+// monitorInfo is the MONITORINFO structure
+type monitorInfo struct {
+	size    uint32
+	monitor windows.Rect
+	work    windows.Rect
+	flags   uint32
+}
+
+var (
+	// enumMonitorsMu guards enumMonitors while EnumDisplayMonitors fills it
+	enumMonitorsMu sync.Mutex
+	enumMonitors   []screenRect
+
+	// enumMonitorsProc is created once, as callbacks cannot be freed
+	enumMonitorsProc = sync.OnceValue(func() uintptr {
+		return windows.NewCallback(func(monitor, hdc uintptr, rect *windows.Rect, data uintptr) uintptr {
+			enumMonitors = append(enumMonitors, rectOf(*rect))
+			return 1 // continue
+		})
+	})
+)
+
+// rectOf converts a RECT
+func rectOf(r windows.Rect) screenRect {
+	return screenRect{int(r.Left), int(r.Top), int(r.Right - r.Left), int(r.Bottom - r.Top)}
+}
+
+// monitorProcs implements monitorAPI with user32.dll
+type monitorProcs struct{}
+
+// WindowMonitor returns the area of the monitor showing most of the window
+func (monitorProcs) WindowMonitor(hwnd uintptr) (screenRect, error) {
+	monitor, err := callProc(procMonitorFromWindow, hwnd, monitorDefaultToNull)
+	if err != nil {
+		return screenRect{}, err
+	}
+	if monitor == 0 {
+		return screenRect{}, errors.New("window is on no monitor")
+	}
+
+	info := monitorInfo{}
+	info.size = uint32(unsafe.Sizeof(info))
+	if _, err := callProc(procGetMonitorInfoW, monitor, uintptr(unsafe.Pointer(&info))); err != nil {
+		return screenRect{}, err
+	}
+	return rectOf(info.monitor), nil
+}
+
+// Monitors returns the areas of all monitors of the desktop
+func (monitorProcs) Monitors() ([]screenRect, error) {
+	enumMonitorsMu.Lock()
+	defer enumMonitorsMu.Unlock()
+
+	enumMonitors = nil
+	if _, err := callProc(procEnumDisplayMonitors, 0, 0, enumMonitorsProc(), 0); err != nil {
+		return nil, err
+	}
+	return enumMonitors, nil
+}
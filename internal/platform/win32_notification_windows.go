@@ -0,0 +1,39 @@
+//go:build windows
+
+package platform
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+var procSHQueryUserNotificationState = shell32.NewProc("SHQueryUserNotificationState")
+
+// The QUERY_USER_NOTIFICATION_STATE values of a fullscreen application
+const (
+	qunsBusy                 = 2 // a fullscreen application, such as a video player
+	qunsRunningD3DFullScreen = 3
+	qunsPresentationMode     = 4
+)
+
+// notificationProcs implements notificationAPI with shell32.dll
+type notificationProcs struct{}
+
+// Fullscreen asks the shell whether it holds notifications back for a
+// fullscreen application
+func (notificationProcs) Fullscreen() (bool, error) {
+	if err := procSHQueryUserNotificationState.Find(); err != nil {
+		return false, fmt.Errorf("%s: %w", procSHQueryUserNotificationState.Name, errAPIUnavailable)
+	}
+
+	var state uint32
+	// The result is an HRESULT, zero on success
+	if hr, _, _ := procSHQueryUserNotificationState.Call(uintptr(unsafe.Pointer(&state))); hr != 0 {
+		return false, fmt.Errorf("%s: HRESULT 0x%08x", procSHQueryUserNotificationState.Name, uint32(hr))
+	}
+	switch state {
+	case qunsBusy, qunsRunningD3DFullScreen, qunsPresentationMode:
+		return true, nil
+	}
+	return false, nil
+}
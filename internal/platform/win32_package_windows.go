@@ -0,0 +1,136 @@
+//go:build windows
+
+package platform
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	shlwapi = windows.NewLazySystemDLL("shlwapi.dll")
+
+	procEnumChildWindows          = user32.NewProc("EnumChildWindows")
+	procGetApplicationUserModelId = kernel32.NewProc("GetApplicationUserModelId")
+	procGetPackageFullName        = kernel32.NewProc("GetPackageFullName")
+	procGetPackagePathByFullName  = kernel32.NewProc("GetPackagePathByFullName")
+	procSHLoadIndirectString      = shlwapi.NewProc("SHLoadIndirectString")
+)
+
+// The longest application user model ID and package full name, in
+// characters with the terminating null
+const (
+	applicationUserModelIDMaxLength = 130
+	packageFullNameMaxLength        = 128
+)
+
+var (
+	// enumChildrenMu guards enumChildren while EnumChildWindows fills it
+	enumChildrenMu sync.Mutex
+	enumChildren   []uintptr
+
+	// enumChildrenProc is created once, as callbacks cannot be freed
+	enumChildrenProc = sync.OnceValue(func() uintptr {
+		return windows.NewCallback(func(hwnd, data uintptr) uintptr {
+			enumChildren = append(enumChildren, hwnd)
+			return 1 // continue
+		})
+	})
+)
+
+// packageProcs implements packageAPI with user32.dll, kernel32.dll and
+// shlwapi.dll
+type packageProcs struct{}
+
+// ChildWindows returns the child windows of the window
+func (packageProcs) ChildWindows(hwnd uintptr) ([]uintptr, error) {
+	if err := procEnumChildWindows.Find(); err != nil {
+		return nil, fmt.Errorf("%s: %w", procEnumChildWindows.Name, errAPIUnavailable)
+	}
+
+	enumChildrenMu.Lock()
+	defer enumChildrenMu.Unlock()
+
+	enumChildren = nil
+	// The result of EnumChildWindows means nothing
+	procEnumChildWindows.Call(hwnd, enumChildrenProc(), 0)
+	return enumChildren, nil
+}
+
+// AppUserModelID returns the application user model ID of a packaged
+// process
+func (packageProcs) AppUserModelID(pid uint32) (string, error) {
+	handle, err := callProc(procOpenProcess, windows.PROCESS_QUERY_LIMITED_INFORMATION, 0, uintptr(pid))
+	if err != nil {
+		return "", err
+	}
+	defer callProc(procCloseHandle, handle)
+
+	var buf [applicationUserModelIDMaxLength]uint16
+	length := uint32(len(buf))
+	if err := callStatus(procGetApplicationUserModelId,
+		handle,
+		uintptr(unsafe.Pointer(&length)),
+		uintptr(unsafe.Pointer(&buf[0])),
+	); err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf[:]), nil
+}
+
+// Package returns the full name of the package of a process and the
+// directory it is installed in
+func (packageProcs) Package(pid uint32) (string, string, error) {
+	handle, err := callProc(procOpenProcess, windows.PROCESS_QUERY_LIMITED_INFORMATION, 0, uintptr(pid))
+	if err != nil {
+		return "", "", err
+	}
+	defer callProc(procCloseHandle, handle)
+
+	var name [packageFullNameMaxLength]uint16
+	length := uint32(len(name))
+	if err := callStatus(procGetPackageFullName,
+		handle,
+		uintptr(unsafe.Pointer(&length)),
+		uintptr(unsafe.Pointer(&name[0])),
+	); err != nil {
+		return "", "", err
+	}
+
+	var dir [windows.MAX_LONG_PATH]uint16
+	length = uint32(len(dir))
+	if err := callStatus(procGetPackagePathByFullName,
+		uintptr(unsafe.Pointer(&name[0])),
+		uintptr(unsafe.Pointer(&length)),
+		uintptr(unsafe.Pointer(&dir[0])),
+	); err != nil {
+		return "", "", err
+	}
+	return windows.UTF16ToString(name[:]), windows.UTF16ToString(dir[:]), nil
+}
+
+// IndirectString resolves an indirect string from a package's resources
+func (packageProcs) IndirectString(source string) (string, error) {
+	if err := procSHLoadIndirectString.Find(); err != nil {
+		return "", fmt.Errorf("%s: %w", procSHLoadIndirectString.Name, errAPIUnavailable)
+	}
+	in, err := windows.UTF16PtrFromString(source)
+	if err != nil {
+		return "", err
+	}
+
+	var buf [512]uint16
+	// The result is an HRESULT, zero on success
+	if hr, _, _ := procSHLoadIndirectString.Call(
+		uintptr(unsafe.Pointer(in)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		0,
+	); hr != 0 {
+		return "", fmt.Errorf("%s: HRESULT 0x%08x", procSHLoadIndirectString.Name, uint32(hr))
+	}
+	return windows.UTF16ToString(buf[:]), nil
+}
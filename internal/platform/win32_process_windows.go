@@ -0,0 +1,49 @@
+//go:build windows
+
+package platform
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGetWindowThreadProcessId   = user32.NewProc("GetWindowThreadProcessId")
+	procOpenProcess                = kernel32.NewProc("OpenProcess")
+	procCloseHandle                = kernel32.NewProc("CloseHandle")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+// processProcs implements processAPI with user32.dll and kernel32.dll
+type processProcs struct{}
+
+// WindowProcessID returns the ID of the process that created the window
+func (processProcs) WindowProcessID(hwnd uintptr) (uint32, error) {
+	var pid uint32
+	if _, err := callProc(procGetWindowThreadProcessId, hwnd, uintptr(unsafe.Pointer(&pid))); err != nil {
+		return 0, err
+	}
+	return pid, nil
+}
+
+// ImagePath returns the full path of the process executable
+func (processProcs) ImagePath(pid uint32) (string, error) {
+	handle, err := callProc(procOpenProcess, windows.PROCESS_QUERY_LIMITED_INFORMATION, 0, uintptr(pid))
+	if err != nil {
+		return "", err
+	}
+	defer callProc(procCloseHandle, handle)
+
+	var buf [windows.MAX_LONG_PATH]uint16
+	size := uint32(len(buf))
+	if _, err := callProc(procQueryFullProcessImageNameW,
+		handle,
+		0,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	); err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf[:size]), nil
+}
@@ -0,0 +1,208 @@
+//go:build windows
+
+package platform
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procWTSQuerySessionInformationW = wtsapi32.NewProc("WTSQuerySessionInformationW")
+	procWTSFreeMemory               = wtsapi32.NewProc("WTSFreeMemory")
+)
+
+const (
+	wtsCurrentSession   = 0xFFFFFFFF
+	wtsSessionInfoEx    = 25
+	wtsSessionStateLock = 0
+)
+
+// wtsInfoEx is the level 1 WTSINFOEXW structure up to SessionFlags
+type wtsInfoEx struct {
+	level        uint32
+	_            uint32
+	sessionID    uint32
+	sessionState uint32
+	sessionFlags int32
+}
+
+// sessionProcs implements sessionAPI with wtsapi32.dll
+type sessionProcs struct{}
+
+// SessionLocked reports whether the current session is locked
+func (sessionProcs) SessionLocked() (bool, error) {
+	var info *wtsInfoEx
+	var size uint32
+	if _, err := callProc(procWTSQuerySessionInformationW,
+		0, // WTS_CURRENT_SERVER_HANDLE
+		wtsCurrentSession,
+		wtsSessionInfoEx,
+		uintptr(unsafe.Pointer(&info)),
+		uintptr(unsafe.Pointer(&size)),
+	); err != nil {
+		return false, err
+	}
+	defer callProc(procWTSFreeMemory, uintptr(unsafe.Pointer(info)))
+
+	locked := info.sessionFlags == wtsSessionStateLock
+
+	// Windows 7 and Server 2008 R2 report the lock flags reversed
+	if version := windows.RtlGetVersion(); version.MajorVersion == 6 && version.MinorVersion == 1 {
+		locked = !locked
+	}
+	return locked, nil
+}
+
+var (
+	procWTSRegisterSessionNotification   = wtsapi32.NewProc("WTSRegisterSessionNotification")
+	procWTSUnRegisterSessionNotification = wtsapi32.NewProc("WTSUnRegisterSessionNotification")
+	procRegisterClassExW                 = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW                  = user32.NewProc("CreateWindowExW")
+	procDestroyWindow                    = user32.NewProc("DestroyWindow")
+	procDefWindowProcW                   = user32.NewProc("DefWindowProcW")
+	procGetMessageW                      = user32.NewProc("GetMessageW")
+	procDispatchMessageW                 = user32.NewProc("DispatchMessageW")
+	procPostMessageW                     = user32.NewProc("PostMessageW")
+	procPostQuitMessage                  = user32.NewProc("PostQuitMessage")
+	procGetModuleHandleW                 = kernel32.NewProc("GetModuleHandleW")
+)
+
+const (
+	wmDestroy            = 0x0002
+	wmClose              = 0x0010
+	wmWTSSessionChange   = 0x02B1
+	notifyForThisSession = 0
+
+	// hwndMessage is HWND_MESSAGE, the parent of message-only windows
+	hwndMessage = ^uintptr(2)
+)
+
+// sessionWindowClass is the class of the hidden windows receiving session
+// change notifications
+var sessionWindowClass = windows.StringToUTF16Ptr("ActimeSessionNotify")
+
+var (
+	// registerSessionClass registers sessionWindowClass once; callbacks
+	// cannot be freed, so the window procedure is created only once too
+	registerSessionClass = sync.OnceValue(func() error {
+		instance, err := callProc(procGetModuleHandleW, 0)
+		if err != nil {
+			return err
+		}
+		class := wndClassEx{
+			wndProc:   windows.NewCallback(sessionWindowProc),
+			instance:  instance,
+			className: sessionWindowClass,
+		}
+		class.size = uint32(unsafe.Sizeof(class))
+		_, err = callProc(procRegisterClassExW, uintptr(unsafe.Pointer(&class)))
+		return err
+	})
+
+	// sessionHandlers maps each notification window to its handler
+	sessionHandlers sync.Map
+)
+
+// wndClassEx is the WNDCLASSEXW structure
+type wndClassEx struct {
+	size       uint32
+	style      uint32
+	wndProc    uintptr
+	clsExtra   int32
+	wndExtra   int32
+	instance   uintptr
+	icon       uintptr
+	cursor     uintptr
+	background uintptr
+	menuName   *uint16
+	className  *uint16
+	iconSm     uintptr
+}
+
+// msg is the MSG structure
+type msg struct {
+	hwnd     uintptr
+	message  uint32
+	wParam   uintptr
+	lParam   uintptr
+	time     uint32
+	pt       [2]int32
+	lPrivate uint32
+}
+
+// sessionWindowProc passes session change notifications to the window's
+// handler and tears the window down when it is closed
+func sessionWindowProc(hwnd, message, wParam, lParam uintptr) uintptr {
+	switch message {
+	case wmWTSSessionChange:
+		if handler, ok := sessionHandlers.Load(hwnd); ok {
+			handler.(func(uint32))(uint32(wParam))
+		}
+		return 0
+	case wmClose:
+		callProc(procWTSUnRegisterSessionNotification, hwnd)
+		procDestroyWindow.Call(hwnd)
+		return 0
+	case wmDestroy:
+		sessionHandlers.Delete(hwnd)
+		procPostQuitMessage.Call(0)
+		return 0
+	}
+	result, _, _ := procDefWindowProcW.Call(hwnd, message, wParam, lParam)
+	return result
+}
+
+// Subscribe creates a hidden message-only window registered for session
+// change notifications and runs its message loop on a dedicated thread
+func (sessionProcs) Subscribe(handler func(event uint32)) (func(), error) {
+	if err := registerSessionClass(); err != nil {
+		return nil, err
+	}
+
+	ready := make(chan uintptr)
+	failed := make(chan error)
+	go func() {
+		// A window only receives messages on the thread that created it
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hwnd, err := callProc(procCreateWindowExW,
+			0, uintptr(unsafe.Pointer(sessionWindowClass)), 0, 0,
+			0, 0, 0, 0,
+			hwndMessage, 0, 0, 0)
+		if err != nil {
+			failed <- err
+			return
+		}
+		sessionHandlers.Store(hwnd, handler)
+		if _, err := callProc(procWTSRegisterSessionNotification, hwnd, notifyForThisSession); err != nil {
+			procDestroyWindow.Call(hwnd)
+			failed <- err
+			return
+		}
+		ready <- hwnd
+
+		var m msg
+		for {
+			result, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(result) <= 0 {
+				return
+			}
+			procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return nil, fmt.Errorf("failed to subscribe to session notifications: %w", err)
+	case hwnd := <-ready:
+		return func() {
+			procPostMessageW.Call(hwnd, wmClose, 0, 0)
+		}, nil
+	}
+}
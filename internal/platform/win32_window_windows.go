@@ -0,0 +1,50 @@
+//go:build windows
+
+package platform
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGetForegroundWindow  = user32.NewProc("GetForegroundWindow")
+	procGetWindowTextLengthW = user32.NewProc("GetWindowTextLengthW")
+	procGetWindowTextW       = user32.NewProc("GetWindowTextW")
+	procGetClassNameW        = user32.NewProc("GetClassNameW")
+)
+
+// windowProcs implements windowAPI with user32.dll
+type windowProcs struct{}
+
+// ForegroundWindow returns the handle of the foreground window, or 0
+func (windowProcs) ForegroundWindow() (uintptr, error) {
+	return callProc(procGetForegroundWindow)
+}
+
+// WindowText returns the title of the window
+func (windowProcs) WindowText(hwnd uintptr) (string, error) {
+	// Size the buffer from the title length when it can be asked for
+	size := uintptr(maxTitleLength)
+	if length, err := callProc(procGetWindowTextLengthW, hwnd); err == nil && length > 0 {
+		size = length
+	}
+
+	buf := make([]uint16, size+1)
+	n, err := callProc(procGetWindowTextW, hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf[:n]), nil
+}
+
+// ClassName returns the class name of the window
+func (windowProcs) ClassName(hwnd uintptr) (string, error) {
+	var buf [256]uint16
+	n, err := callProc(procGetClassNameW, hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf[:n]), nil
+}
@@ -1,57 +1,105 @@
-//go:build windows
-
 package platform
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
-	"unsafe"
+	"unicode/utf8"
 
-	"golang.org/x/sys/windows"
+	"github.com/weii/actime/pkg/logger"
 )
 
-var (
-	user32               = windows.NewLazyDLL("user32.dll")
-	procGetForegroundWindow = user32.NewProc("GetForegroundWindow")
-	procGetWindowTextW      = user32.NewProc("GetWindowTextW")
-	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
-	procGetLastInputInfo    = user32.NewProc("GetLastInputInfo")
-	procGetClassNameW       = user32.NewProc("GetClassNameW")
-
-	kernel32           = windows.NewLazyDLL("kernel32.dll")
-	procOpenProcess         = kernel32.NewProc("OpenProcess")
-	procCloseHandle         = kernel32.NewProc("CloseHandle")
-	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
-	procWTSGetSessionConsoleSessionId = kernel32.NewProc("WTSGetActiveConsoleSessionId")
-
-	wtsapi32           = windows.NewLazyDLL("wtsapi32.dll")
-	procWTSQuerySessionInformationW   = wtsapi32.NewProc("WTSQuerySessionInformationW")
-)
+// maxTitleLength is the longest window title kept, in characters
+const maxTitleLength = 512
 
-// LASTINPUTINFO contains information about the last input event
-type LASTINPUTINFO struct {
-	CBSize uint32
-	DwTime uint32
+// lockScreenClasses are window classes of the lock screen, checked when
+// neither the session state nor the input desktop can be queried
+var lockScreenClasses = []string{
+	"LockScreen",
+	"Windows.UI.Core.CoreWindow",
+	"ApplicationFrameWindow",
 }
 
-// WindowsDetector implements Detector for Windows
+// WindowsDetector implements Detector for Windows. Every Win32 call goes
+// through lazily loaded DLLs, so the detector builds without cgo and keeps
+// working when an older Windows lacks one of them.
 type WindowsDetector struct {
+	api         win32
 	initialized bool
+
+	// sessions follows session change notifications; nil when they could
+	// not be subscribed to
+	sessions     *sessionMachine
+	stopSessions func()
+
+	// events carries foreground and session changes to the tracker. It
+	// outlives Close, so a tracker keeps it across reinitializing.
+	events         chan WindowEvent
+	stopForeground func()
+
+	// packageNames caches the display names of Store apps by application
+	// user model ID
+	packageNames map[string]string
 }
 
-// NewWindowsDetector creates a new Windows detector
-func NewWindowsDetector() *WindowsDetector {
-	return &WindowsDetector{}
+// newWindowsDetector creates a Windows detector calling the given wrappers
+func newWindowsDetector(api win32) *WindowsDetector {
+	return &WindowsDetector{api: api, events: make(chan WindowEvent, 1), packageNames: make(map[string]string)}
 }
 
-// Initialize initializes the Windows detector
+// Initialize initializes the Windows detector and subscribes to session
+// change and foreground window notifications. Without them the lock state
+// and the active window are polled only.
 func (d *WindowsDetector) Initialize() error {
+	sessions := newSessionMachine()
+	stop, err := d.api.session.Subscribe(func(event uint32) {
+		sessions.handle(event, time.Now())
+		d.notify(WindowEventSession)
+	})
+	if err == nil {
+		d.sessions = sessions
+		d.stopSessions = stop
+	}
+
+	if stop, err := d.api.foreground.WatchForeground(func() {
+		d.notify(WindowEventForeground)
+	}); err == nil {
+		d.stopForeground = stop
+	}
+
 	d.initialized = true
 	return nil
 }
 
+// notify hands an event to the tracker unless one is waiting already: the
+// tracker reads the current state when it takes it
+func (d *WindowsDetector) notify(kind string) {
+	select {
+	case d.events <- WindowEvent{Kind: kind, Time: time.Now()}:
+	default:
+	}
+}
+
+// Events returns the foreground and session changes, or nil when neither
+// could be subscribed to
+func (d *WindowsDetector) Events() <-chan WindowEvent {
+	if d.stopForeground == nil && d.stopSessions == nil {
+		return nil
+	}
+	return d.events
+}
+
+// SessionState returns the state of the user's session as last notified,
+// or "" when notifications are not available
+func (d *WindowsDetector) SessionState() string {
+	if d.sessions == nil {
+		return ""
+	}
+	return d.sessions.describe()
+}
+
 // GetActiveWindow returns the active window information
 func (d *WindowsDetector) GetActiveWindow() (*WindowInfo, error) {
 	if !d.initialized {
@@ -59,117 +107,219 @@ func (d *WindowsDetector) GetActiveWindow() (*WindowInfo, error) {
 	}
 
 	// Get foreground window handle
-	hwnd, _, _ := procGetForegroundWindow.Call()
+	hwnd, err := d.api.window.ForegroundWindow()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get foreground window: %w", err)
+	}
 	if hwnd == 0 {
-		return nil, fmt.Errorf("no foreground window")
+		return NoWindow, nil
+	}
+
+	// A window without a readable title is still tracked by its app
+	windowTitle, err := d.api.window.WindowText(hwnd)
+	if err != nil {
+		windowTitle = ""
 	}
 
-	// Get window title
-	var titleBuf [512]uint16
-	procGetWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&titleBuf[0])), uintptr(len(titleBuf)))
-	windowTitle := syscall.UTF16ToString(titleBuf[:])
+	appName, path, pid := d.resolveApp(hwnd)
+	if strings.EqualFold(appName, frameHostExe) {
+		appName, path, pid = d.resolveFramedApp(hwnd, windowTitle, appName, path, pid)
+	}
+
+	return &WindowInfo{
+		AppName:      appName,
+		WindowTitle:  truncateTitle(CleanTitle(windowTitle), maxTitleLength),
+		PID:          int32(pid),
+		ExePath:      path,
+		MonitorIndex: d.monitorIndex(hwnd),
+	}, nil
+}
 
-	// Get process ID
-	var pid uint32
-	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+// monitorIndex returns the number of the monitor showing the window, or nil
+// when it cannot be told. Windows has no API for the virtual desktop of a
+// window short of COM, so the workspace stays unknown.
+func (d *WindowsDetector) monitorIndex(hwnd uintptr) *int {
+	monitor, err := d.api.monitor.WindowMonitor(hwnd)
+	if err != nil {
+		return nil
+	}
+	monitors, err := d.api.monitor.Monitors()
+	if err != nil {
+		return nil
+	}
+	index := monitorIndex(monitor, monitors)
+	if index < 0 {
+		return nil
+	}
+	return &index
+}
+
+// resolveApp returns the executable name and path of the window's process.
+// Elevated and protected processes cannot be opened, so the window class
+// is used instead, and "Unknown" when that fails too; the path is then
+// unknown.
+func (d *WindowsDetector) resolveApp(hwnd uintptr) (name, path string, pid uint32) {
+	pid, err := d.api.process.WindowProcessID(hwnd)
+	if err != nil {
+		pid = 0
+	}
 
-	// Get process name
-	appName := "Unknown"
 	if pid != 0 {
-		// Open process
-		hProcess, _, _ := procOpenProcess.Call(
-			windows.PROCESS_QUERY_LIMITED_INFORMATION,
-			0,
-			uintptr(pid),
-		)
-		if hProcess != 0 {
-			defer procCloseHandle.Call(hProcess)
-
-			// Get full process image name
-			var nameBuf [260]uint16
-			var size uint32 = uint32(len(nameBuf))
-			ret, _, _ := procQueryFullProcessImageNameW.Call(
-				hProcess,
-				0,
-				uintptr(unsafe.Pointer(&nameBuf[0])),
-				uintptr(unsafe.Pointer(&size)),
-			)
-			if ret != 0 {
-				fullPath := syscall.UTF16ToString(nameBuf[:size])
-				// Extract just the filename
-				parts := strings.Split(fullPath, "\\")
-				if len(parts) > 0 {
-					appName = parts[len(parts)-1]
-				}
+		if path, err := d.api.process.ImagePath(pid); err == nil && path != "" {
+			return path[strings.LastIndexAny(path, `\/`)+1:], path, pid
+		}
+	}
+
+	if className, err := d.api.window.ClassName(hwnd); err == nil && className != "" {
+		return className, "", pid
+	}
+	return "Unknown", "", pid
+}
+
+// resolveFramedApp names the Store app ApplicationFrameHost shows in hwnd,
+// returning its display name, executable path and process ID. The app's
+// own process owns the core window inside the frame. An app that is
+// suspended or minimized has none, and is named after the frame's title;
+// without a title the frame host is returned unchanged.
+func (d *WindowsDetector) resolveFramedApp(hwnd uintptr, title, name, path string, pid uint32) (string, string, uint32) {
+	children, err := d.api.packages.ChildWindows(hwnd)
+	if err != nil {
+		children = nil
+	}
+	for _, child := range children {
+		if class, err := d.api.window.ClassName(child); err != nil || class != coreWindowClass {
+			continue
+		}
+		childPID, err := d.api.process.WindowProcessID(child)
+		if err != nil || childPID == 0 || childPID == pid {
+			continue
+		}
+		if displayName := d.packageDisplayName(childPID); displayName != "" {
+			childPath, err := d.api.process.ImagePath(childPID)
+			if err != nil {
+				childPath = ""
 			}
+			return displayName, childPath, childPID
 		}
 	}
 
-	// Get window class name
-	var classNameBuf [256]uint16
-	procGetClassNameW.Call(hwnd, uintptr(unsafe.Pointer(&classNameBuf[0])), uintptr(len(classNameBuf)))
-	className := syscall.UTF16ToString(classNameBuf[:])
+	if app := frameTitleApp(CleanTitle(title)); app != "" {
+		return app, path, pid
+	}
+	return name, path, pid
+}
+
+// packageDisplayName returns the display name of a packaged process from
+// its manifest, or its package name when the manifest cannot be read. It
+// returns "" when the process has no application user model ID.
+func (d *WindowsDetector) packageDisplayName(pid uint32) string {
+	aumid, err := d.api.packages.AppUserModelID(pid)
+	if err != nil || aumid == "" {
+		return ""
+	}
+	if name, ok := d.packageNames[aumid]; ok {
+		return name
+	}
 
-	// Use class name as fallback if app name is unknown
-	if appName == "Unknown" && className != "" {
-		appName = className
+	packageName, appID := aumidParts(aumid)
+	name, err := d.readDisplayName(pid, appID)
+	if err != nil {
+		logger.GetLogger().Debug("Failed to read the display name of a Store app", "aumid", aumid, "error", err)
+		name = packageName
 	}
+	d.packageNames[aumid] = name
+	return name
+}
 
-	return &WindowInfo{
-		AppName:     appName,
-		WindowTitle: windowTitle,
-		PID:         int32(pid),
-	}, nil
+// readDisplayName reads the display name of application appID from the
+// manifest of the process's package, resolving it from the package's
+// resources when the manifest refers to them
+func (d *WindowsDetector) readDisplayName(pid uint32, appID string) (string, error) {
+	fullName, dir, err := d.api.packages.Package(pid)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "AppxManifest.xml"))
+	if err != nil {
+		return "", err
+	}
+	packageName, displayName, err := manifestDisplayName(data, appID)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(displayName, "ms-resource:") {
+		displayName, err = d.api.packages.IndirectString("@{" + fullName + "?" + resourceURI(packageName, displayName) + "}")
+		if err != nil {
+			return "", err
+		}
+	}
+	if displayName == "" {
+		return "", fmt.Errorf("empty display name")
+	}
+	return displayName, nil
+}
+
+// truncateTitle shortens title to at most max characters, marking the cut
+// with an ellipsis
+func truncateTitle(title string, max int) string {
+	if utf8.RuneCountInString(title) <= max {
+		return title
+	}
+
+	runes := []rune(title)
+	return strings.TrimRight(string(runes[:max-1]), " ") + "…"
 }
 
-// GetIdleTime returns the idle time using GetLastInputInfo
+// GetIdleTime returns the time since the last input event
 func (d *WindowsDetector) GetIdleTime() (time.Duration, error) {
 	if !d.initialized {
 		return 0, fmt.Errorf("detector not initialized")
 	}
 
-	var lii LASTINPUTINFO
-	lii.CBSize = uint32(unsafe.Sizeof(lii))
-
-	ret, _, _ := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&lii)))
-	if ret == 0 {
-		return 0, fmt.Errorf("failed to get last input info")
+	lastInput, err := d.api.input.LastInputTick()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last input info: %w", err)
+	}
+	now, err := d.api.input.TickCount()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get tick count: %w", err)
 	}
 
-	// GetTickCount64 returns the number of milliseconds since system startup
-	tickCount, _, _ := kernel32.NewProc("GetTickCount64").Call()
-
-	// Calculate idle time: current tick count - last input tick count
-	idleTime := time.Duration(uint64(tickCount) - uint64(lii.DwTime)) * time.Millisecond
-
-	return idleTime, nil
+	// The last input tick is 32 bits and wraps after 49.7 days; the 32-bit
+	// difference stays correct across the wrap
+	return time.Duration(uint32(now)-lastInput) * time.Millisecond, nil
 }
 
-// IsScreenLocked returns true if the screen is locked
+// IsScreenLocked returns true if the screen is locked. A session that was
+// disconnected, by fast user switching or a closed remote desktop, counts
+// as locked. Otherwise the session state is asked; Windows versions without
+// it fall back to checking whether the input desktop can be opened, and
+// then to the foreground window class.
 func (d *WindowsDetector) IsScreenLocked() (bool, error) {
 	if !d.initialized {
 		return false, fmt.Errorf("detector not initialized")
 	}
 
-	// Check if the workstation is locked
-	// This is done by checking if the foreground window is the lock screen
-	hwnd, _, _ := procGetForegroundWindow.Call()
-	if hwnd == 0 {
-		return false, nil
+	if d.sessions != nil && d.sessions.state() != SessionActive {
+		return true, nil
 	}
 
-	// Get window class name
-	var classNameBuf [256]uint16
-	procGetClassNameW.Call(hwnd, uintptr(unsafe.Pointer(&classNameBuf[0])), uintptr(len(classNameBuf)))
-	className := syscall.UTF16ToString(classNameBuf[:])
+	if locked, err := d.api.session.SessionLocked(); err == nil {
+		return locked, nil
+	}
 
-	// Check for common lock screen window classes
-	lockScreenClasses := []string{
-		"LockScreen",
-		"Windows.UI.Core.CoreWindow",
-		"ApplicationFrameWindow",
+	if available, err := d.api.desktop.InputDesktopAvailable(); err == nil {
+		return !available, nil
 	}
 
+	hwnd, err := d.api.window.ForegroundWindow()
+	if err != nil || hwnd == 0 {
+		return false, nil
+	}
+	className, err := d.api.window.ClassName(hwnd)
+	if err != nil {
+		return false, nil
+	}
 	for _, lockClass := range lockScreenClasses {
 		if strings.Contains(className, lockClass) {
 			return true, nil
@@ -179,8 +329,46 @@ func (d *WindowsDetector) IsScreenLocked() (bool, error) {
 	return false, nil
 }
 
+// IsMediaPlaying returns true if a fullscreen application, such as a video
+// player or a presentation, has the screen
+func (d *WindowsDetector) IsMediaPlaying() (bool, error) {
+	if !d.initialized {
+		return false, fmt.Errorf("detector not initialized")
+	}
+
+	fullscreen, err := d.api.notify.Fullscreen()
+	if err != nil {
+		return false, fmt.Errorf("failed to get notification state: %w", err)
+	}
+	return fullscreen, nil
+}
+
+// Capabilities reports how the active window, the idle time and the lock
+// state are read
+func (d *WindowsDetector) Capabilities() []Capability {
+	lock := Capability{Name: CapabilityLock, Supported: true, Method: "WTS session notifications"}
+	if d.sessions == nil {
+		lock.Method = "WTSQuerySessionInformation"
+		lock.Hint = "session notifications are not available, so fast user switching is only noticed by polling"
+	}
+	return []Capability{
+		{Name: CapabilityActiveWindow, Supported: true, Method: "GetForegroundWindow"},
+		{Name: CapabilityIdle, Supported: true, Method: "GetLastInputInfo"},
+		lock,
+	}
+}
+
 // Close cleans up Windows resources
 func (d *WindowsDetector) Close() error {
+	if d.stopSessions != nil {
+		d.stopSessions()
+		d.stopSessions = nil
+	}
+	if d.stopForeground != nil {
+		d.stopForeground()
+		d.stopForeground = nil
+	}
+	d.sessions = nil
 	d.initialized = false
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,517 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// fakeWin32 implements every Win32 wrapper interface. Unset errors make the
+// call succeed with the configured value.
+type fakeWin32 struct {
+	hwnd       uintptr
+	title      string
+	titleErr   error
+	className  string
+	classErr   error
+	pid        uint32
+	pidErr     error
+	path       string
+	pathErr    error
+	lastInput  uint32
+	tickCount  uint64
+	locked     bool
+	sessionErr error
+	desktop    bool
+	desktopErr error
+	fullscreen bool
+	monitor    screenRect
+	monitors   []screenRect
+	monitorErr error
+
+	// notify delivers session change notifications once subscribed
+	notify       func(event uint32)
+	subscribeErr error
+	stopped      bool
+
+	// foreground delivers foreground changes once hooked
+	foreground    func()
+	foregroundErr error
+	unhooked      bool
+
+	// Store apps: the windows inside a frame, what differs for them and
+	// their processes from the frame, and the package of those processes
+	children     []uintptr
+	childClasses map[uintptr]string
+	childPIDs    map[uintptr]uint32
+	childPaths   map[uint32]string
+	aumids       map[uint32]string
+	packageDir   string
+	resources    map[string]string
+	packageReads int
+}
+
+func (f *fakeWin32) ForegroundWindow() (uintptr, error)             { return f.hwnd, nil }
+func (f *fakeWin32) WindowText(hwnd uintptr) (string, error)        { return f.title, f.titleErr }
+func (f *fakeWin32) LastInputTick() (uint32, error)                 { return f.lastInput, nil }
+func (f *fakeWin32) TickCount() (uint64, error)                     { return f.tickCount, nil }
+func (f *fakeWin32) SessionLocked() (bool, error)                   { return f.locked, f.sessionErr }
+func (f *fakeWin32) InputDesktopAvailable() (bool, error)           { return f.desktop, f.desktopErr }
+func (f *fakeWin32) Fullscreen() (bool, error)                      { return f.fullscreen, nil }
+func (f *fakeWin32) WindowMonitor(hwnd uintptr) (screenRect, error) { return f.monitor, f.monitorErr }
+func (f *fakeWin32) Monitors() ([]screenRect, error)                { return f.monitors, nil }
+
+func (f *fakeWin32) ClassName(hwnd uintptr) (string, error) {
+	if class, ok := f.childClasses[hwnd]; ok {
+		return class, nil
+	}
+	return f.className, f.classErr
+}
+
+func (f *fakeWin32) WindowProcessID(hwnd uintptr) (uint32, error) {
+	if pid, ok := f.childPIDs[hwnd]; ok {
+		return pid, nil
+	}
+	return f.pid, f.pidErr
+}
+
+func (f *fakeWin32) ImagePath(pid uint32) (string, error) {
+	if path, ok := f.childPaths[pid]; ok {
+		return path, nil
+	}
+	return f.path, f.pathErr
+}
+
+func (f *fakeWin32) ChildWindows(hwnd uintptr) ([]uintptr, error) { return f.children, nil }
+
+func (f *fakeWin32) AppUserModelID(pid uint32) (string, error) {
+	if aumid, ok := f.aumids[pid]; ok {
+		return aumid, nil
+	}
+	return "", errors.New("not a packaged process")
+}
+
+func (f *fakeWin32) Package(pid uint32) (string, string, error) {
+	f.packageReads++
+	return "Microsoft.WindowsCalculator_11.2_x64__8wekyb3d8bbwe", f.packageDir, nil
+}
+
+func (f *fakeWin32) IndirectString(source string) (string, error) {
+	if value, ok := f.resources[source]; ok {
+		return value, nil
+	}
+	return "", errors.New("resource not found")
+}
+
+func (f *fakeWin32) Subscribe(handler func(event uint32)) (func(), error) {
+	if f.subscribeErr != nil {
+		return nil, f.subscribeErr
+	}
+	f.notify = handler
+	return func() { f.stopped = true }, nil
+}
+
+func (f *fakeWin32) WatchForeground(handler func()) (func(), error) {
+	if f.foregroundErr != nil {
+		return nil, f.foregroundErr
+	}
+	f.foreground = handler
+	return func() { f.unhooked = true }, nil
+}
+
+func newFakeWindowsDetector(t *testing.T, api *fakeWin32) *WindowsDetector {
+	t.Helper()
+	d := newWindowsDetector(win32{window: api, process: api, input: api, desktop: api, session: api, notify: api, monitor: api, foreground: api, packages: api})
+	if err := d.Initialize(); err != nil {
+		t.Fatalf("Failed to initialize detector: %v", err)
+	}
+	return d
+}
+
+func TestWindowsDetectorResolvesApp(t *testing.T) {
+	denied := errors.New("access denied")
+	tests := []struct {
+		name     string
+		api      fakeWin32
+		want     string
+		wantPath string
+	}{
+		{
+			name:     "executable name from the image path",
+			api:      fakeWin32{pid: 42, path: `C:\Program Files\Editor\editor.exe`, className: "EditorWindow"},
+			want:     "editor.exe",
+			wantPath: `C:\Program Files\Editor\editor.exe`,
+		},
+		{
+			name: "elevated process falls back to the window class",
+			api:  fakeWin32{pid: 42, pathErr: denied, className: "ConsoleWindowClass"},
+			want: "ConsoleWindowClass",
+		},
+		{
+			name: "missing API falls back to the window class",
+			api:  fakeWin32{pid: 42, pathErr: errAPIUnavailable, className: "Notepad"},
+			want: "Notepad",
+		},
+		{
+			name: "no process ID",
+			api:  fakeWin32{pidErr: denied, path: `C:\never.exe`, className: "Shell_TrayWnd"},
+			want: "Shell_TrayWnd",
+		},
+		{
+			name: "nothing resolves",
+			api:  fakeWin32{pid: 42, pathErr: denied, classErr: denied},
+			want: "Unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.api.hwnd = 1
+			tt.api.title = "main.go"
+			d := newFakeWindowsDetector(t, &tt.api)
+
+			info, err := d.GetActiveWindow()
+			if err != nil {
+				t.Fatalf("GetActiveWindow failed: %v", err)
+			}
+			if info.AppName != tt.want {
+				t.Errorf("Expected app %q, got %q", tt.want, info.AppName)
+			}
+			if info.ExePath != tt.wantPath {
+				t.Errorf("Expected path %q, got %q", tt.wantPath, info.ExePath)
+			}
+			if info.WindowTitle != "main.go" {
+				t.Errorf("Expected title main.go, got %q", info.WindowTitle)
+			}
+		})
+	}
+}
+
+func TestWindowsDetectorTitles(t *testing.T) {
+	long := strings.Repeat("界", maxTitleLength+10)
+	d := newFakeWindowsDetector(t, &fakeWin32{hwnd: 1, title: long, path: `C:\editor.exe`, pid: 1})
+
+	info, err := d.GetActiveWindow()
+	if err != nil {
+		t.Fatalf("GetActiveWindow failed: %v", err)
+	}
+	if n := utf8.RuneCountInString(info.WindowTitle); n != maxTitleLength {
+		t.Errorf("Expected a %d character title, got %d", maxTitleLength, n)
+	}
+	if !strings.HasSuffix(info.WindowTitle, "…") || !utf8.ValidString(info.WindowTitle) {
+		t.Errorf("Expected a valid title ending in an ellipsis, got %q", info.WindowTitle[len(info.WindowTitle)-12:])
+	}
+
+	// Junk is cleaned before the title is returned
+	d = newFakeWindowsDetector(t, &fakeWin32{hwnd: 1, title: " \x00report\x00.docx\r\n", path: `C:\editor.exe`, pid: 1})
+	info, err = d.GetActiveWindow()
+	if err != nil || info.WindowTitle != "report.docx" {
+		t.Errorf("Expected a cleaned title, got %+v, %v", info, err)
+	}
+	d = newFakeWindowsDetector(t, &fakeWin32{hwnd: 1, title: "\x00\x00 ", path: `C:\editor.exe`, pid: 1})
+	if info, err = d.GetActiveWindow(); err != nil || info.WindowTitle != "" {
+		t.Errorf("Expected an empty title, got %+v, %v", info, err)
+	}
+
+	// An unreadable title does not lose the window
+	d = newFakeWindowsDetector(t, &fakeWin32{hwnd: 1, titleErr: errAPIUnavailable, path: `C:\editor.exe`, pid: 1})
+	info, err = d.GetActiveWindow()
+	if err != nil || info.AppName != "editor.exe" || info.WindowTitle != "" {
+		t.Errorf("Expected editor.exe without a title, got %+v, %v", info, err)
+	}
+
+	// Without a foreground window there is nothing to track, which is
+	// not an error
+	d = newFakeWindowsDetector(t, &fakeWin32{})
+	if info, err := d.GetActiveWindow(); err != nil || info != NoWindow {
+		t.Errorf("Expected NoWindow without a foreground window, got %+v, %v", info, err)
+	}
+}
+
+func TestWindowsDetectorIdleTimeAcrossTickWrap(t *testing.T) {
+	d := newFakeWindowsDetector(t, &fakeWin32{
+		// The 64-bit tick count passed 2^32; the last input was 3s earlier
+		lastInput: 0xFFFFF000,
+		tickCount: 1<<32 + 3000 - 0x1000,
+	})
+
+	idle, err := d.GetIdleTime()
+	if err != nil {
+		t.Fatalf("GetIdleTime failed: %v", err)
+	}
+	if idle != 3*time.Second {
+		t.Errorf("Expected 3s idle, got %v", idle)
+	}
+}
+
+func TestWindowsDetectorScreenLockFallbacks(t *testing.T) {
+	tests := []struct {
+		name string
+		api  fakeWin32
+		want bool
+	}{
+		{
+			name: "session state",
+			api:  fakeWin32{locked: true, desktop: true},
+			want: true,
+		},
+		{
+			name: "input desktop when the session state is unavailable",
+			api:  fakeWin32{sessionErr: errAPIUnavailable, desktop: false},
+			want: true,
+		},
+		{
+			name: "window class when nothing else is available",
+			api:  fakeWin32{sessionErr: errAPIUnavailable, desktopErr: errAPIUnavailable, hwnd: 1, className: "LockScreenControllerProxyWindow"},
+			want: true,
+		},
+		{
+			name: "session state without notifications",
+			api:  fakeWin32{locked: true, subscribeErr: errAPIUnavailable},
+			want: true,
+		},
+		{
+			name: "unlocked",
+			api:  fakeWin32{sessionErr: errAPIUnavailable, desktopErr: errAPIUnavailable, hwnd: 1, className: "Notepad"},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newFakeWindowsDetector(t, &tt.api)
+			locked, err := d.IsScreenLocked()
+			if err != nil {
+				t.Fatalf("IsScreenLocked failed: %v", err)
+			}
+			if locked != tt.want {
+				t.Errorf("Expected locked=%v, got %v", tt.want, locked)
+			}
+		})
+	}
+}
+
+func TestWindowsDetectorFollowsSessionChanges(t *testing.T) {
+	api := &fakeWin32{sessionErr: errAPIUnavailable, desktopErr: errAPIUnavailable, hwnd: 1, className: "Notepad"}
+	d := newFakeWindowsDetector(t, api)
+
+	steps := []struct {
+		event  uint32
+		state  string
+		locked bool
+	}{
+		// Another user takes the console through fast user switching
+		{wtsSessionLock, SessionLocked, true},
+		{wtsConsoleDisconnect, SessionDisconnected, true},
+		// and hands it back; the session stays locked until the password
+		{wtsConsoleConnect, SessionLocked, true},
+		{wtsSessionUnlock, SessionActive, false},
+		// A remote desktop client disconnects without locking
+		{wtsRemoteDisconnect, SessionDisconnected, true},
+		{wtsRemoteConnect, SessionActive, false},
+		{wtsSessionLogoff, SessionLoggedOff, true},
+		{wtsSessionLogon, SessionActive, false},
+	}
+
+	if state := d.SessionState(); state != SessionActive {
+		t.Fatalf("Expected an active session at start, got %q", state)
+	}
+	for _, step := range steps {
+		api.notify(step.event)
+
+		if state := d.sessions.state(); state != step.state {
+			t.Errorf("After %s: expected state %q, got %q", wtsEventNames[step.event], step.state, state)
+		}
+		if !strings.Contains(d.SessionState(), wtsEventNames[step.event]) {
+			t.Errorf("After %s: expected the event in %q", wtsEventNames[step.event], d.SessionState())
+		}
+		locked, err := d.IsScreenLocked()
+		if err != nil {
+			t.Fatalf("IsScreenLocked failed: %v", err)
+		}
+		if locked != step.locked {
+			t.Errorf("After %s: expected locked=%v, got %v", wtsEventNames[step.event], step.locked, locked)
+		}
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !api.stopped {
+		t.Error("Expected Close to stop the notifications")
+	}
+}
+
+func TestWindowsDetectorIsMediaPlaying(t *testing.T) {
+	api := &fakeWin32{}
+	d := newFakeWindowsDetector(t, api)
+
+	if playing, err := d.IsMediaPlaying(); err != nil || playing {
+		t.Errorf("Expected no media playing, got %v, %v", playing, err)
+	}
+	api.fullscreen = true
+	if playing, err := d.IsMediaPlaying(); err != nil || !playing {
+		t.Errorf("Expected a fullscreen application to count as media playing, got %v, %v", playing, err)
+	}
+}
+
+func TestWindowsDetectorMonitorIndex(t *testing.T) {
+	// The laptop screen is below and left of the primary monitor
+	primary := screenRect{0, 0, 2560, 1440}
+	laptop := screenRect{-1920, 400, 1920, 1080}
+	api := &fakeWin32{hwnd: 1, pid: 1, path: `C:\editor.exe`, monitor: primary, monitors: []screenRect{primary, laptop}}
+	d := newFakeWindowsDetector(t, api)
+
+	info, err := d.GetActiveWindow()
+	if err != nil {
+		t.Fatalf("GetActiveWindow failed: %v", err)
+	}
+	if info.MonitorIndex == nil || *info.MonitorIndex != 1 {
+		t.Errorf("Expected monitor 1, got %v", info.MonitorIndex)
+	}
+	if info.Workspace != nil {
+		t.Errorf("Expected no workspace, got %d", *info.Workspace)
+	}
+
+	api.monitorErr = errAPIUnavailable
+	if info, err := d.GetActiveWindow(); err != nil || info.MonitorIndex != nil {
+		t.Errorf("Expected an unknown monitor, got %v, %v", info.MonitorIndex, err)
+	}
+}
+
+func TestWindowsDetectorEvents(t *testing.T) {
+	api := &fakeWin32{}
+	d := newFakeWindowsDetector(t, api)
+	events := d.Events()
+	if events == nil {
+		t.Fatal("Expected events once subscribed")
+	}
+
+	api.foreground()
+	// A waiting event is enough; more are dropped instead of blocking
+	api.foreground()
+	select {
+	case event := <-events:
+		if event.Kind != WindowEventForeground {
+			t.Errorf("Expected a foreground event, got %q", event.Kind)
+		}
+	default:
+		t.Fatal("Expected a foreground event")
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("Expected a single waiting event, got another %q", event.Kind)
+	default:
+	}
+
+	api.notify(wtsSessionLock)
+	if event := <-events; event.Kind != WindowEventSession {
+		t.Errorf("Expected a session event, got %q", event.Kind)
+	}
+
+	d.Close()
+	if !api.unhooked {
+		t.Error("Expected Close to unhook foreground changes")
+	}
+
+	unavailable := errors.New("unavailable")
+	d = newFakeWindowsDetector(t, &fakeWin32{subscribeErr: unavailable, foregroundErr: unavailable})
+	if d.Events() != nil {
+		t.Error("Expected no events without notifications")
+	}
+}
+
+func TestWindowsDetectorResolvesStoreApps(t *testing.T) {
+	const manifest = `<?xml version="1.0" encoding="utf-8"?>
+<Package xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10"
+         xmlns:uap="http://schemas.microsoft.com/appx/manifest/uap/windows10">
+  <Identity Name="Microsoft.WindowsCalculator" Publisher="CN=Microsoft Corporation" Version="11.2.0.0"/>
+  <Properties><DisplayName>ms-resource:AppStoreName</DisplayName></Properties>
+  <Applications>
+    <Application Id="App" Executable="CalculatorApp.exe">
+      <uap:VisualElements DisplayName="ms-resource:AppName"/>
+    </Application>
+  </Applications>
+</Package>`
+	withManifest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(withManifest, "AppxManifest.xml"), []byte(manifest), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	resources := map[string]string{
+		"@{Microsoft.WindowsCalculator_11.2_x64__8wekyb3d8bbwe?ms-resource://Microsoft.WindowsCalculator/resources/AppName}": "Calculator",
+	}
+
+	tests := []struct {
+		name       string
+		children   []uintptr
+		packageDir string
+		title      string
+		want       string
+		wantPath   string
+	}{
+		{
+			name:       "display name from the manifest",
+			children:   []uintptr{2, 3},
+			packageDir: withManifest,
+			title:      "Calculator",
+			want:       "Calculator",
+			wantPath:   `C:\Program Files\WindowsApps\Calculator\CalculatorApp.exe`,
+		},
+		{
+			name:       "package name without a manifest",
+			children:   []uintptr{2, 3},
+			packageDir: t.TempDir(),
+			title:      "Calculator",
+			want:       "Microsoft.WindowsCalculator",
+			wantPath:   `C:\Program Files\WindowsApps\Calculator\CalculatorApp.exe`,
+		},
+		{
+			name:     "suspended app named after the frame title",
+			children: []uintptr{2},
+			title:    "Inbox \u200e- Mail",
+			want:     "Mail",
+			wantPath: `C:\Windows\System32\ApplicationFrameHost.exe`,
+		},
+		{
+			name:     "nothing to go by",
+			want:     "ApplicationFrameHost.exe",
+			wantPath: `C:\Windows\System32\ApplicationFrameHost.exe`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeWin32{
+				hwnd:         1,
+				title:        tt.title,
+				pid:          10,
+				path:         `C:\Windows\System32\ApplicationFrameHost.exe`,
+				children:     tt.children,
+				childClasses: map[uintptr]string{2: "ApplicationFrameInputSinkWindow", 3: coreWindowClass},
+				childPIDs:    map[uintptr]uint32{3: 20},
+				childPaths:   map[uint32]string{20: `C:\Program Files\WindowsApps\Calculator\CalculatorApp.exe`},
+				aumids:       map[uint32]string{20: "Microsoft.WindowsCalculator_8wekyb3d8bbwe!App"},
+				packageDir:   tt.packageDir,
+				resources:    resources,
+			}
+			d := newFakeWindowsDetector(t, api)
+
+			for i := 0; i < 2; i++ {
+				info, err := d.GetActiveWindow()
+				if err != nil {
+					t.Fatalf("GetActiveWindow failed: %v", err)
+				}
+				if info.AppName != tt.want || info.ExePath != tt.wantPath {
+					t.Errorf("Expected %q at %q, got %q at %q", tt.want, tt.wantPath, info.AppName, info.ExePath)
+				}
+			}
+			if api.packageReads > 1 {
+				t.Errorf("Expected the package to be read once, got %d reads", api.packageReads)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package platform
+
+import (
+	"sync"
+	"time"
+)
+
+// Session states reported by SessionStateReporter
+const (
+	SessionActive       = "active"
+	SessionLocked       = "locked"
+	SessionDisconnected = "disconnected"
+	SessionLoggedOff    = "logged off"
+)
+
+// WM_WTSSESSION_CHANGE notification codes
+const (
+	wtsConsoleConnect    uint32 = 0x1
+	wtsConsoleDisconnect uint32 = 0x2
+	wtsRemoteConnect     uint32 = 0x3
+	wtsRemoteDisconnect  uint32 = 0x4
+	wtsSessionLogon      uint32 = 0x5
+	wtsSessionLogoff     uint32 = 0x6
+	wtsSessionLock       uint32 = 0x7
+	wtsSessionUnlock     uint32 = 0x8
+)
+
+// wtsEventNames names the notification codes for logs and status output
+var wtsEventNames = map[uint32]string{
+	wtsConsoleConnect:    "WTS_CONSOLE_CONNECT",
+	wtsConsoleDisconnect: "WTS_CONSOLE_DISCONNECT",
+	wtsRemoteConnect:     "WTS_REMOTE_CONNECT",
+	wtsRemoteDisconnect:  "WTS_REMOTE_DISCONNECT",
+	wtsSessionLogon:      "WTS_SESSION_LOGON",
+	wtsSessionLogoff:     "WTS_SESSION_LOGOFF",
+	wtsSessionLock:       "WTS_SESSION_LOCK",
+	wtsSessionUnlock:     "WTS_SESSION_UNLOCK",
+}
+
+// sessionMachine follows the session change notifications of the user's
+// Windows session. When another user takes the console through fast user
+// switching, or the remote desktop client disconnects, the session is no
+// longer in front of anyone even though it is not locked.
+type sessionMachine struct {
+	mu        sync.Mutex
+	connected bool
+	locked    bool
+	loggedOff bool
+	lastEvent uint32
+	changedAt time.Time
+}
+
+// newSessionMachine starts in a connected, unlocked session. A lock that
+// happened before is still seen by polling the session state.
+func newSessionMachine() *sessionMachine {
+	return &sessionMachine{connected: true}
+}
+
+// handle applies one WM_WTSSESSION_CHANGE notification
+func (m *sessionMachine) handle(event uint32, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch event {
+	case wtsConsoleConnect, wtsRemoteConnect:
+		m.connected = true
+	case wtsConsoleDisconnect, wtsRemoteDisconnect:
+		m.connected = false
+	case wtsSessionLogon:
+		m.connected = true
+		m.loggedOff = false
+	case wtsSessionLogoff:
+		m.loggedOff = true
+	case wtsSessionLock:
+		m.locked = true
+	case wtsSessionUnlock:
+		// Unlocking requires someone at the session
+		m.locked = false
+		m.connected = true
+	default:
+		return
+	}
+	m.lastEvent = event
+	m.changedAt = now
+}
+
+// state returns the current session state
+func (m *sessionMachine) state() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case m.loggedOff:
+		return SessionLoggedOff
+	case !m.connected:
+		return SessionDisconnected
+	case m.locked:
+		return SessionLocked
+	default:
+		return SessionActive
+	}
+}
+
+// describe returns the state with the notification that caused it
+func (m *sessionMachine) describe() string {
+	state := m.state()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastEvent == 0 {
+		return state
+	}
+	return state + " (" + wtsEventNames[m.lastEvent] + " at " + m.changedAt.Format("15:04:05") + ")"
+}
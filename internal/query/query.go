@@ -0,0 +1,333 @@
+// Package query translates the options of `actime query` into SQL. Only
+// the columns and operators listed here are accepted, and every value is
+// bound as a parameter, so a query can read the database but never run
+// statements of its own.
+//
+// A filter is a column, an operator and a value with nothing in between,
+// for example app~firefox, date>=2024-05-01 or seconds>1h. The operators
+// are = != < <= > >= and, for text columns, ~ (contains) and !~ (does not
+// contain). Text comparisons ignore case. Dates are YYYY-MM-DD; start and
+// end also take a time, YYYY-MM-DD HH:MM; seconds take a number or a
+// duration such as 90s or 1h30m.
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the type of a column's values
+type Kind int
+
+const (
+	Text Kind = iota
+	Int
+	Date
+	Time
+)
+
+// Sources that can be queried
+const (
+	FromSessions = "sessions"
+	FromDaily    = "daily"
+)
+
+// Count is the selectable number of rows in a group
+const Count = "count"
+
+// dateLayout is the layout of date values
+const dateLayout = "2006-01-02"
+
+// column maps a name of the query language to SQL
+type column struct {
+	name string
+	expr string
+	kind Kind
+}
+
+// sources lists the columns of each source in their default order
+var sources = map[string]struct {
+	table   string
+	columns []column
+}{
+	FromSessions: {"sessions", []column{
+		{"date", "substr(start_time, 1, 10)", Date},
+		{"start", "start_time", Time},
+		{"end", "end_time", Time},
+		{"app", "app_name", Text},
+		{"title", "COALESCE(window_title, '')", Text},
+		{"seconds", "duration_seconds", Int},
+		{"source", "source", Text},
+		{"exe", "COALESCE(exe_path, '')", Text},
+	}},
+	FromDaily: {"daily_stats", []column{
+		{"date", "date", Date},
+		{"app", "app_name", Text},
+		{"seconds", "total_seconds", Int},
+		{"source", "source", Text},
+	}},
+}
+
+// operators are tried longest first, so <= is not read as <
+var operators = []string{"!=", "!~", "<=", ">=", "=", "~", "<", ">"}
+
+// Query is a query as given on the command line
+type Query struct {
+	From    string   // FromSessions or FromDaily, FromSessions when empty
+	Select  []string // columns to return; all of them when empty
+	Where   []string // filters, all of which must match
+	GroupBy []string
+	Order   []string // columns to sort by, descending with a leading -
+	Limit   int      // no limit when zero
+}
+
+// Column describes a column of the result
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// Statement is a query translated to SQL
+type Statement struct {
+	SQL     string
+	Args    []interface{}
+	Columns []Column
+}
+
+// Build translates q into a parameterized statement. Unknown columns,
+// operators and malformed values are errors naming what is accepted.
+func Build(q Query) (*Statement, error) {
+	from := q.From
+	if from == "" {
+		from = FromSessions
+	}
+	source, ok := sources[from]
+	if !ok {
+		return nil, fmt.Errorf("unknown --from %q (expected %s or %s)", from, FromSessions, FromDaily)
+	}
+	if q.Limit < 0 {
+		return nil, fmt.Errorf("invalid --limit %d", q.Limit)
+	}
+
+	lookup := func(name, option string) (column, error) {
+		for _, c := range source.columns {
+			if c.name == name {
+				return c, nil
+			}
+		}
+		names := make([]string, len(source.columns))
+		for i, c := range source.columns {
+			names[i] = c.name
+		}
+		return column{}, fmt.Errorf("unknown column %q in %s (columns of %s: %s)", name, option, from, strings.Join(names, ", "))
+	}
+
+	// Grouping
+	var groupExprs []string
+	grouped := make(map[string]bool)
+	for _, name := range q.GroupBy {
+		c, err := lookup(name, "--group-by")
+		if err != nil {
+			return nil, err
+		}
+		if grouped[name] {
+			return nil, fmt.Errorf("column %q is repeated in --group-by", name)
+		}
+		grouped[name] = true
+		groupExprs = append(groupExprs, c.expr)
+	}
+
+	// Selected columns; a grouped query sums seconds and may count rows
+	names := q.Select
+	if len(names) == 0 {
+		if len(q.GroupBy) > 0 {
+			names = append(append([]string{}, q.GroupBy...), "seconds")
+		} else {
+			for _, c := range source.columns {
+				names = append(names, c.name)
+			}
+		}
+	}
+	stmt := &Statement{}
+	var selects []string
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if selected[name] {
+			return nil, fmt.Errorf("column %q is repeated in --select", name)
+		}
+		selected[name] = true
+
+		if name == Count {
+			if len(q.GroupBy) == 0 {
+				return nil, fmt.Errorf("%s needs --group-by", Count)
+			}
+			selects = append(selects, "COUNT(*)")
+			stmt.Columns = append(stmt.Columns, Column{Name: Count, Kind: Int})
+			continue
+		}
+
+		c, err := lookup(name, "--select")
+		if err != nil {
+			return nil, err
+		}
+		expr := c.expr
+		if len(q.GroupBy) > 0 && !grouped[name] {
+			if c.kind != Int {
+				return nil, fmt.Errorf("column %q must be in --group-by or left out of --select", name)
+			}
+			expr = "SUM(" + expr + ")"
+		}
+		selects = append(selects, expr)
+		stmt.Columns = append(stmt.Columns, Column{Name: c.name, Kind: c.kind})
+	}
+
+	sql := "SELECT " + strings.Join(selects, ", ") + " FROM " + source.table
+
+	// Filters
+	var conditions []string
+	for _, filter := range q.Where {
+		name, op, value, err := splitFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		c, err := lookup(name, "--where")
+		if err != nil {
+			return nil, err
+		}
+		condition, arg, err := compare(c, op, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", filter, err)
+		}
+		conditions = append(conditions, condition)
+		stmt.Args = append(stmt.Args, arg)
+	}
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(groupExprs) > 0 {
+		sql += " GROUP BY " + strings.Join(groupExprs, ", ")
+	}
+
+	// Ordering refers to the result columns by position
+	var orders []string
+	for _, name := range q.Order {
+		direction := "ASC"
+		if strings.HasPrefix(name, "-") {
+			name, direction = name[1:], "DESC"
+		}
+		position := -1
+		for i, c := range stmt.Columns {
+			if c.Name == name {
+				position = i + 1
+			}
+		}
+		if position < 0 {
+			return nil, fmt.Errorf("cannot order by %q: it is not a selected column", name)
+		}
+		orders = append(orders, fmt.Sprintf("%d %s", position, direction))
+	}
+	if len(orders) > 0 {
+		sql += " ORDER BY " + strings.Join(orders, ", ")
+	}
+
+	if q.Limit > 0 {
+		sql += " LIMIT ?"
+		stmt.Args = append(stmt.Args, q.Limit)
+	}
+
+	stmt.SQL = sql
+	return stmt, nil
+}
+
+// splitFilter splits a filter into column, operator and value
+func splitFilter(filter string) (name, op, value string, err error) {
+	end := strings.IndexFunc(filter, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r == '_')
+	})
+	if end < 0 {
+		end = len(filter)
+	}
+	if end == 0 {
+		return "", "", "", fmt.Errorf("invalid filter %q: expected <column><operator><value>, for example app~firefox", filter)
+	}
+	name, rest := filter[:end], filter[end:]
+	for _, candidate := range operators {
+		if strings.HasPrefix(rest, candidate) {
+			return name, candidate, rest[len(candidate):], nil
+		}
+	}
+	return "", "", "", fmt.Errorf("invalid filter %q: unknown operator (expected one of %s)", filter, strings.Join(sortedOperators(), " "))
+}
+
+// sortedOperators lists the operators for error messages
+func sortedOperators() []string {
+	ops := append([]string{}, operators...)
+	sort.Strings(ops)
+	return ops
+}
+
+// compare returns the SQL condition of one filter and the value to bind
+func compare(c column, op, value string) (string, interface{}, error) {
+	if op == "~" || op == "!~" {
+		if c.kind != Text {
+			return "", nil, fmt.Errorf("operator %s only applies to text columns, not %s", op, c.name)
+		}
+		not := ""
+		if op == "!~" {
+			not = "NOT "
+		}
+		return fmt.Sprintf(`%s %sLIKE ? ESCAPE '\'`, c.expr, not), "%" + escapeLike(value) + "%", nil
+	}
+
+	var arg interface{}
+	switch c.kind {
+	case Text:
+		return fmt.Sprintf("%s %s ? COLLATE NOCASE", c.expr, op), value, nil
+	case Int:
+		seconds, err := parseSeconds(value)
+		if err != nil {
+			return "", nil, err
+		}
+		arg = seconds
+	case Date:
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			return "", nil, fmt.Errorf("invalid date %q for %s (expected YYYY-MM-DD)", value, c.name)
+		}
+		arg = value
+	case Time:
+		t, err := parseTime(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid time %q for %s (expected YYYY-MM-DD or YYYY-MM-DD HH:MM)", value, c.name)
+		}
+		arg = t
+	}
+	return fmt.Sprintf("%s %s ?", c.expr, op), arg, nil
+}
+
+// parseSeconds reads a number of seconds or a duration
+func parseSeconds(value string) (int64, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seconds %q (expected a number or a duration such as 1h30m)", value)
+	}
+	return int64(d.Seconds()), nil
+}
+
+// parseTime reads a local day or a local time of day
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(dateLayout, value, time.Local)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,189 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   Query
+		sql     string
+		args    []interface{}
+		columns []string
+	}{
+		{
+			name:    "all session columns",
+			query:   Query{},
+			sql:     "SELECT substr(start_time, 1, 10), start_time, end_time, app_name, COALESCE(window_title, ''), duration_seconds, source, COALESCE(exe_path, '') FROM sessions",
+			columns: []string{"date", "start", "end", "app", "title", "seconds", "source", "exe"},
+		},
+		{
+			name:    "daily totals of an app",
+			query:   Query{From: FromDaily, Select: []string{"date", "seconds"}, Where: []string{"app=Firefox"}},
+			sql:     "SELECT date, total_seconds FROM daily_stats WHERE app_name = ? COLLATE NOCASE",
+			args:    []interface{}{"Firefox"},
+			columns: []string{"date", "seconds"},
+		},
+		{
+			name: "grouped and ordered",
+			query: Query{
+				Select:  []string{"app", "seconds", "count"},
+				Where:   []string{"app~fire", "date>=2024-05-01"},
+				GroupBy: []string{"app"},
+				Order:   []string{"-seconds", "app"},
+				Limit:   20,
+			},
+			sql: "SELECT app_name, SUM(duration_seconds), COUNT(*) FROM sessions" +
+				` WHERE app_name LIKE ? ESCAPE '\' AND substr(start_time, 1, 10) >= ?` +
+				" GROUP BY app_name ORDER BY 2 DESC, 1 ASC LIMIT ?",
+			args:    []interface{}{"%fire%", "2024-05-01", 20},
+			columns: []string{"app", "seconds", "count"},
+		},
+		{
+			name:    "grouping selects the groups and seconds by default",
+			query:   Query{From: FromDaily, GroupBy: []string{"date", "app"}},
+			sql:     "SELECT date, app_name, SUM(total_seconds) FROM daily_stats GROUP BY date, app_name",
+			columns: []string{"date", "app", "seconds"},
+		},
+		{
+			name:    "durations and not contains",
+			query:   Query{Select: []string{"title"}, Where: []string{"seconds>1h30m", "title!~50%_off", "seconds<=90"}},
+			sql:     `SELECT COALESCE(window_title, '') FROM sessions WHERE duration_seconds > ? AND COALESCE(window_title, '') NOT LIKE ? ESCAPE '\' AND duration_seconds <= ?`,
+			args:    []interface{}{int64(5400), `%50\%\_off%`, int64(90)},
+			columns: []string{"title"},
+		},
+		{
+			name:    "times are local",
+			query:   Query{Select: []string{"start"}, Where: []string{"start>=2026-01-05 14:00", "end<2026-01-06"}},
+			sql:     "SELECT start_time FROM sessions WHERE start_time >= ? AND end_time < ?",
+			args:    []interface{}{time.Date(2026, 1, 5, 14, 0, 0, 0, time.Local), time.Date(2026, 1, 6, 0, 0, 0, 0, time.Local)},
+			columns: []string{"start"},
+		},
+		{
+			name:    "operators are read longest first",
+			query:   Query{Select: []string{"app"}, Where: []string{"source!=manual", "app<=m", "app>a"}},
+			sql:     "SELECT app_name FROM sessions WHERE source != ? COLLATE NOCASE AND app_name <= ? COLLATE NOCASE AND app_name > ? COLLATE NOCASE",
+			args:    []interface{}{"manual", "m", "a"},
+			columns: []string{"app"},
+		},
+		{
+			name:    "empty values are allowed",
+			query:   Query{Select: []string{"app"}, Where: []string{"title="}},
+			sql:     "SELECT app_name FROM sessions WHERE COALESCE(window_title, '') = ? COLLATE NOCASE",
+			args:    []interface{}{""},
+			columns: []string{"app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := Build(tt.query)
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+			if stmt.SQL != tt.sql {
+				t.Errorf("Unexpected SQL:\ngot:  %s\nwant: %s", stmt.SQL, tt.sql)
+			}
+			if len(stmt.Args) != 0 || len(tt.args) != 0 {
+				if !reflect.DeepEqual(stmt.Args, tt.args) {
+					t.Errorf("Expected args %#v, got %#v", tt.args, stmt.Args)
+				}
+			}
+			var columns []string
+			for _, column := range stmt.Columns {
+				columns = append(columns, column.Name)
+			}
+			if !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("Expected columns %v, got %v", tt.columns, columns)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"unknown source", Query{From: "gaps"}, `unknown --from "gaps" (expected sessions or daily)`},
+		{"unknown column", Query{Select: []string{"window_title"}}, `unknown column "window_title" in --select (columns of sessions: date, start, end, app, title, seconds, source, exe)`},
+		{"column of the other source", Query{From: FromDaily, Select: []string{"title"}}, `unknown column "title" in --select (columns of daily: date, app, seconds, source)`},
+		{"unknown filter column", Query{Where: []string{"id>0"}}, `unknown column "id" in --where`},
+		{"unknown group column", Query{GroupBy: []string{"hour"}}, `unknown column "hour" in --group-by`},
+		{"repeated column", Query{Select: []string{"app", "app"}}, `column "app" is repeated in --select`},
+		{"repeated group", Query{GroupBy: []string{"app", "app"}}, `column "app" is repeated in --group-by`},
+		{"count without groups", Query{Select: []string{"count"}}, "count needs --group-by"},
+		{"ungrouped text column", Query{Select: []string{"app", "title"}, GroupBy: []string{"app"}}, `column "title" must be in --group-by or left out of --select`},
+		{"order by unselected column", Query{Select: []string{"app"}, Order: []string{"seconds"}}, `cannot order by "seconds": it is not a selected column`},
+		{"no operator", Query{Where: []string{"firefox"}}, `invalid filter "firefox": unknown operator (expected one of != !~ < <= = > >= ~)`},
+		{"no column", Query{Where: []string{"=firefox"}}, `invalid filter "=firefox": expected <column><operator><value>`},
+		{"space before operator", Query{Where: []string{"app = firefox"}}, `invalid filter "app = firefox": unknown operator`},
+		{"contains on a number", Query{Where: []string{"seconds~5"}}, `invalid filter "seconds~5": operator ~ only applies to text columns, not seconds`},
+		{"contains on a date", Query{Where: []string{"date!~2024"}}, `operator !~ only applies to text columns, not date`},
+		{"bad seconds", Query{Where: []string{"seconds>lots"}}, `invalid seconds "lots" (expected a number or a duration such as 1h30m)`},
+		{"bad date", Query{Where: []string{"date>=2024-13-01"}}, `invalid date "2024-13-01" for date (expected YYYY-MM-DD)`},
+		{"bad time", Query{Where: []string{"start<noon"}}, `invalid time "noon" for start (expected YYYY-MM-DD or YYYY-MM-DD HH:MM)`},
+		{"negative limit", Query{Limit: -1}, "invalid --limit -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build(tt.query)
+			if err == nil {
+				t.Fatalf("Expected an error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %q", tt.want, err.Error())
+			}
+		})
+	}
+}
+
+func TestBuildRejectsInjection(t *testing.T) {
+	// Anything reaching the SQL must come from the fixed column list
+	rejected := []Query{
+		{Select: []string{"app; DROP TABLE sessions"}},
+		{Select: []string{"app FROM sessions --"}},
+		{Select: []string{"(SELECT 1)"}},
+		{GroupBy: []string{"app, 1"}},
+		{Order: []string{"1; DELETE FROM sessions"}},
+		{Select: []string{"app"}, Order: []string{"-app DESC, (SELECT 1)"}},
+		{Where: []string{"1=1"}},
+		{Where: []string{"app_name='x'"}},
+		{Where: []string{"app)=x"}},
+		{From: "sessions; DROP TABLE sessions"},
+	}
+	for _, q := range rejected {
+		if stmt, err := Build(q); err == nil {
+			t.Errorf("Expected %+v to be rejected, got %q", q, stmt.SQL)
+		}
+	}
+
+	// Values are bound, never spliced into the statement: the SQL is the
+	// same as for a harmless value
+	values := []string{
+		"x' OR '1'='1",
+		"x\"; DROP TABLE sessions; --",
+		"%' UNION SELECT sql FROM sqlite_master --",
+	}
+	for _, prefix := range []string{"app=", "title~", "source!="} {
+		plain, err := Build(Query{Select: []string{"app"}, Where: []string{prefix + "x"}})
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		for _, value := range values {
+			stmt, err := Build(Query{Select: []string{"app"}, Where: []string{prefix + value}})
+			if err != nil {
+				t.Fatalf("Build(%q) failed: %v", prefix+value, err)
+			}
+			if stmt.SQL != plain.SQL {
+				t.Errorf("Expected %q to be bound, got %q", prefix+value, stmt.SQL)
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package report builds higher-level summaries over tracked usage data
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+const (
+	// MinCoverage is the tracked/active-span ratio below which a day is flagged
+	MinCoverage = 0.5
+
+	// MaxAppDaySeconds is the most time a single app can possibly get in one day
+	MaxAppDaySeconds = 24 * 60 * 60
+)
+
+// WarningKind identifies the type of a data-quality warning
+type WarningKind string
+
+const (
+	// WarningLowCoverage means only a small part of the day's active span was tracked
+	WarningLowCoverage WarningKind = "low_coverage"
+
+	// WarningImpossibleTotal means an app was credited with more than 24 hours in one day
+	WarningImpossibleTotal WarningKind = "impossible_total"
+
+	// WarningMissingDay means a weekday has no data although its neighbours do
+	WarningMissingDay WarningKind = "missing_day"
+)
+
+// Warning describes a single data-quality problem
+type Warning struct {
+	Kind    WarningKind
+	Date    time.Time
+	AppName string
+	Message string
+}
+
+// DayCoverage describes how much of a day's activity was actually tracked.
+// GapSeconds is the part of the span recorded as idle, locked or suspended:
+// the daemon was running then, there was just nothing to track.
+type DayCoverage struct {
+	Date           time.Time
+	TrackedSeconds int64
+	GapSeconds     int64
+	SpanSeconds    int64
+}
+
+// Ratio returns the share of the active span that was tracked or recorded
+// as a gap, between 0 and 1
+func (c DayCoverage) Ratio() float64 {
+	if c.SpanSeconds <= 0 {
+		return 0
+	}
+	ratio := float64(c.TrackedSeconds+c.GapSeconds) / float64(c.SpanSeconds)
+	if ratio > 1 {
+		return 1
+	}
+	return ratio
+}
+
+// QualityReport is the result of a data-quality pass over a date range
+type QualityReport struct {
+	Start    time.Time
+	End      time.Time
+	Coverage []DayCoverage
+	Warnings []Warning
+}
+
+// CheckQuality runs the data-quality heuristics for the inclusive range
+// [start, end]. Coverage is computed from sessions and gaps (tracked plus
+// idle, locked and suspended time versus the span between the first and the
+// last recorded activity of each day), while the per-app totals come from
+// daily stats.
+func CheckQuality(stats []*storage.DailyStats, sessions []*storage.Session, gaps []*storage.Gap, start, end time.Time) *QualityReport {
+	report := &QualityReport{
+		Start: truncateDay(start),
+		End:   truncateDay(end),
+	}
+
+	report.Coverage = dayCoverage(sessions, gaps)
+	for _, day := range report.Coverage {
+		if day.SpanSeconds > 0 && day.Ratio() < MinCoverage {
+			report.Warnings = append(report.Warnings, Warning{
+				Kind: WarningLowCoverage,
+				Date: day.Date,
+				Message: fmt.Sprintf("only %.0f%% of the active span was tracked or recorded as idle, locked or suspended; the daemon was probably stopped or paused",
+					day.Ratio()*100),
+			})
+		}
+	}
+
+	daysWithData := make(map[string]bool)
+	for _, stat := range stats {
+		if stat.TotalSeconds > 0 {
+			daysWithData[dayKey(stat.Date)] = true
+		}
+		if stat.TotalSeconds > MaxAppDaySeconds {
+			report.Warnings = append(report.Warnings, Warning{
+				Kind:    WarningImpossibleTotal,
+				Date:    truncateDay(stat.Date),
+				AppName: stat.AppName,
+				Message: fmt.Sprintf("%s has %.1fh recorded, more than a day can hold; sessions were probably counted twice",
+					stat.AppName, float64(stat.TotalSeconds)/3600),
+			})
+		}
+	}
+	for _, day := range report.Coverage {
+		if day.TrackedSeconds > 0 {
+			daysWithData[dayKey(day.Date)] = true
+		}
+	}
+
+	// A weekday without data is only suspicious when the days around it have
+	// data, otherwise it is most likely a holiday or the edge of the history
+	for day := report.Start; !day.After(report.End); day = day.AddDate(0, 0, 1) {
+		if isWeekend(day) || daysWithData[dayKey(day)] {
+			continue
+		}
+		if daysWithData[dayKey(previousWeekday(day))] && daysWithData[dayKey(nextWeekday(day))] {
+			report.Warnings = append(report.Warnings, Warning{
+				Kind:    WarningMissingDay,
+				Date:    day,
+				Message: "no data on a weekday surrounded by tracked days; the daemon was probably not running",
+			})
+		}
+	}
+
+	sort.SliceStable(report.Warnings, func(i, j int) bool {
+		if !report.Warnings[i].Date.Equal(report.Warnings[j].Date) {
+			return report.Warnings[i].Date.Before(report.Warnings[j].Date)
+		}
+		return report.Warnings[i].Kind < report.Warnings[j].Kind
+	})
+
+	return report
+}
+
+// dayCoverage groups sessions by start day and computes tracked time and
+// span. Idle, locked and suspended gaps count for the part that falls within
+// a day's span.
+func dayCoverage(sessions []*storage.Session, gaps []*storage.Gap) []DayCoverage {
+	type span struct {
+		first, last time.Time
+		tracked     int64
+	}
+	days := make(map[string]*span)
+	var keys []string
+
+	for _, session := range sessions {
+		key := dayKey(session.StartTime)
+		day, ok := days[key]
+		if !ok {
+			day = &span{first: session.StartTime, last: session.EndTime}
+			days[key] = day
+			keys = append(keys, key)
+		}
+		if session.StartTime.Before(day.first) {
+			day.first = session.StartTime
+		}
+		if session.EndTime.After(day.last) {
+			day.last = session.EndTime
+		}
+		day.tracked += session.DurationSeconds
+	}
+
+	sort.Strings(keys)
+	coverage := make([]DayCoverage, 0, len(keys))
+	for _, key := range keys {
+		day := days[key]
+		coverage = append(coverage, DayCoverage{
+			Date:           truncateDay(day.first),
+			TrackedSeconds: day.tracked,
+			GapSeconds:     gapSeconds(gaps, day.first, day.last),
+			SpanSeconds:    int64(day.last.Sub(day.first).Seconds()),
+		})
+	}
+	return coverage
+}
+
+// gapSeconds sums the idle, locked and suspended time of gaps within
+// [first, last]
+func gapSeconds(gaps []*storage.Gap, first, last time.Time) int64 {
+	var total time.Duration
+	for _, gap := range gaps {
+		switch gap.Kind {
+		case storage.GapIdle, storage.GapLocked, storage.GapSuspended:
+		default:
+			continue
+		}
+		start, end := gap.StartTime, gap.EndTime
+		if start.Before(first) {
+			start = first
+		}
+		if end.After(last) {
+			end = last
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return int64(total.Seconds())
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func dayKey(t time.Time) string {
+	return t.Format(storage.DateLayout)
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+func previousWeekday(t time.Time) time.Time {
+	t = t.AddDate(0, 0, -1)
+	for isWeekend(t) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+func nextWeekday(t time.Time) time.Time {
+	t = t.AddDate(0, 0, 1)
+	for isWeekend(t) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
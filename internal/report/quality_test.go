@@ -0,0 +1,218 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(storage.DateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func session(start string, minutes int64) *storage.Session {
+	t, err := time.Parse("2006-01-02 15:04", start)
+	if err != nil {
+		panic(err)
+	}
+	return &storage.Session{
+		AppName:         "editor",
+		StartTime:       t,
+		EndTime:         t.Add(time.Duration(minutes) * time.Minute),
+		DurationSeconds: minutes * 60,
+	}
+}
+
+func gap(kind, start string, minutes int64) *storage.Gap {
+	t, err := time.Parse("2006-01-02 15:04", start)
+	if err != nil {
+		panic(err)
+	}
+	return &storage.Gap{Kind: kind, StartTime: t, EndTime: t.Add(time.Duration(minutes) * time.Minute)}
+}
+
+func stat(date, app string, seconds int64) *storage.DailyStats {
+	return &storage.DailyStats{AppName: app, Date: day(date), TotalSeconds: seconds}
+}
+
+func TestCheckQuality(t *testing.T) {
+	tests := []struct {
+		name     string
+		stats    []*storage.DailyStats
+		sessions []*storage.Session
+		gaps     []*storage.Gap
+		start    string
+		end      string
+		want     []WarningKind
+	}{
+		{
+			name:  "empty range",
+			start: "2026-01-05",
+			end:   "2026-01-09",
+		},
+		{
+			name: "fully covered day",
+			stats: []*storage.DailyStats{
+				stat("2026-01-05", "editor", 3*3600),
+			},
+			sessions: []*storage.Session{
+				session("2026-01-05 09:00", 120),
+				session("2026-01-05 11:00", 60),
+			},
+			start: "2026-01-05",
+			end:   "2026-01-05",
+		},
+		{
+			name: "daemon off for most of the day",
+			stats: []*storage.DailyStats{
+				stat("2026-01-05", "editor", 2*3600),
+			},
+			sessions: []*storage.Session{
+				session("2026-01-05 09:00", 60),
+				session("2026-01-05 17:00", 60),
+			},
+			start: "2026-01-05",
+			end:   "2026-01-05",
+			want:  []WarningKind{WarningLowCoverage},
+		},
+		{
+			name: "long idle gap is covered",
+			stats: []*storage.DailyStats{
+				stat("2026-01-05", "editor", 2*3600),
+			},
+			sessions: []*storage.Session{
+				session("2026-01-05 09:00", 60),
+				session("2026-01-05 17:00", 60),
+			},
+			gaps: []*storage.Gap{
+				gap(storage.GapIdle, "2026-01-05 10:00", 5*60),
+				gap(storage.GapLocked, "2026-01-05 15:00", 2*60),
+			},
+			start: "2026-01-05",
+			end:   "2026-01-05",
+		},
+		{
+			name: "more than 24 hours for one app",
+			stats: []*storage.DailyStats{
+				stat("2026-01-05", "editor", 30*3600),
+				stat("2026-01-05", "browser", 3600),
+			},
+			start: "2026-01-05",
+			end:   "2026-01-05",
+			want:  []WarningKind{WarningImpossibleTotal},
+		},
+		{
+			name: "weekday gap surrounded by data",
+			stats: []*storage.DailyStats{
+				stat("2026-01-05", "editor", 3600),
+				stat("2026-01-07", "editor", 3600),
+			},
+			start: "2026-01-05",
+			end:   "2026-01-07",
+			want:  []WarningKind{WarningMissingDay},
+		},
+		{
+			name: "monday gap bridged over the weekend",
+			stats: []*storage.DailyStats{
+				stat("2026-01-09", "editor", 3600),
+				stat("2026-01-13", "editor", 3600),
+			},
+			start: "2026-01-09",
+			end:   "2026-01-13",
+			want:  []WarningKind{WarningMissingDay},
+		},
+		{
+			name: "weekend without data is fine",
+			stats: []*storage.DailyStats{
+				stat("2026-01-09", "editor", 3600),
+				stat("2026-01-12", "editor", 3600),
+			},
+			start: "2026-01-09",
+			end:   "2026-01-12",
+		},
+		{
+			name: "gap at the edge of the history is fine",
+			stats: []*storage.DailyStats{
+				stat("2026-01-06", "editor", 3600),
+			},
+			start: "2026-01-05",
+			end:   "2026-01-07",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := CheckQuality(tt.stats, tt.sessions, tt.gaps, day(tt.start), day(tt.end))
+
+			if len(report.Warnings) != len(tt.want) {
+				t.Fatalf("Expected %d warnings, got %d: %+v", len(tt.want), len(report.Warnings), report.Warnings)
+			}
+			for i, kind := range tt.want {
+				if report.Warnings[i].Kind != kind {
+					t.Errorf("Expected warning %d to be %s, got %s", i, kind, report.Warnings[i].Kind)
+				}
+				if report.Warnings[i].Message == "" {
+					t.Errorf("Expected warning %d to have an explanation", i)
+				}
+			}
+		})
+	}
+}
+
+func TestDayCoverage(t *testing.T) {
+	sessions := []*storage.Session{
+		session("2026-01-05 09:00", 30),
+		session("2026-01-05 10:30", 30),
+		session("2026-01-06 14:00", 60),
+	}
+
+	coverage := dayCoverage(sessions, nil)
+	if len(coverage) != 2 {
+		t.Fatalf("Expected 2 days, got %d", len(coverage))
+	}
+
+	first := coverage[0]
+	if first.TrackedSeconds != 3600 {
+		t.Errorf("Expected 3600 tracked seconds, got %d", first.TrackedSeconds)
+	}
+	if first.SpanSeconds != 7200 {
+		t.Errorf("Expected 7200 span seconds, got %d", first.SpanSeconds)
+	}
+	if first.Ratio() != 0.5 {
+		t.Errorf("Expected coverage 0.5, got %v", first.Ratio())
+	}
+
+	if coverage[1].Ratio() != 1 {
+		t.Errorf("Expected full coverage for a single session, got %v", coverage[1].Ratio())
+	}
+}
+
+func TestDayCoverageClipsGaps(t *testing.T) {
+	sessions := []*storage.Session{
+		session("2026-01-05 10:00", 60),
+		session("2026-01-05 13:00", 60),
+	}
+	gaps := []*storage.Gap{
+		// Locked overnight until the first activity of the day
+		gap(storage.GapLocked, "2026-01-04 22:00", 12*60),
+		gap(storage.GapIdle, "2026-01-05 11:00", 90),
+		// After the last activity of the day
+		gap(storage.GapSuspended, "2026-01-05 14:30", 60),
+	}
+
+	coverage := dayCoverage(sessions, gaps)
+	if len(coverage) != 1 {
+		t.Fatalf("Expected 1 day, got %d", len(coverage))
+	}
+	if coverage[0].GapSeconds != 5400 {
+		t.Errorf("Expected 5400 gap seconds, got %d", coverage[0].GapSeconds)
+	}
+	if coverage[0].Ratio() != 0.875 {
+		t.Errorf("Expected coverage 0.875, got %v", coverage[0].Ratio())
+	}
+}
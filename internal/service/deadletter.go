@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// MaxWriteAttempts is how many flushes a session may fail before it is
+// moved to the dead-letter file
+const MaxWriteAttempts = 3
+
+// DeadLetter is a session the daemon gave up writing, one line of the
+// dead-letter file
+type DeadLetter struct {
+	FailedAt        time.Time `json:"failed_at"`
+	Error           string    `json:"error"`
+	Attempts        int       `json:"attempts"`
+	App             string    `json:"app"`
+	Title           string    `json:"title,omitempty"`
+	RawTitle        string    `json:"raw_title,omitempty"`
+	Domain          string    `json:"domain,omitempty"`
+	ExePath         string    `json:"exe_path,omitempty"`
+	MonitorIndex    *int      `json:"monitor_index,omitempty"`
+	Workspace       *int      `json:"workspace,omitempty"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	Source          string    `json:"source,omitempty"`
+}
+
+// Session returns the session the dead letter holds
+func (d *DeadLetter) Session() *storage.Session {
+	return &storage.Session{
+		AppName:         d.App,
+		WindowTitle:     d.Title,
+		RawTitle:        d.RawTitle,
+		Domain:          d.Domain,
+		ExePath:         d.ExePath,
+		MonitorIndex:    d.MonitorIndex,
+		Workspace:       d.Workspace,
+		StartTime:       d.Start,
+		EndTime:         d.End,
+		DurationSeconds: d.DurationSeconds,
+		Source:          d.Source,
+	}
+}
+
+// newDeadLetter records session and why it could not be written
+func newDeadLetter(session *storage.Session, attempts int, err error, now time.Time) *DeadLetter {
+	return &DeadLetter{
+		FailedAt:        now,
+		Error:           err.Error(),
+		Attempts:        attempts,
+		App:             session.AppName,
+		Title:           session.WindowTitle,
+		RawTitle:        session.RawTitle,
+		Domain:          session.Domain,
+		ExePath:         session.ExePath,
+		MonitorIndex:    session.MonitorIndex,
+		Workspace:       session.Workspace,
+		Start:           session.StartTime,
+		End:             session.EndTime,
+		DurationSeconds: session.DurationSeconds,
+		Source:          session.Source,
+	}
+}
+
+// DeadLetterPath returns the dead-letter file kept next to the database
+func DeadLetterPath(databasePath string) string {
+	return filepath.Join(filepath.Dir(databasePath), "deadletter.jsonl")
+}
+
+// AppendDeadLetters adds letters to the dead-letter file
+func AppendDeadLetters(path string, letters []*DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, letter := range letters {
+		if err := enc.Encode(letter); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to encode dead letter: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+	return f.Close()
+}
+
+// ReadDeadLetters reads the dead-letter file; a missing file holds none
+func ReadDeadLetters(path string) ([]*DeadLetter, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	defer f.Close()
+
+	var letters []*DeadLetter
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return nil, fmt.Errorf("invalid dead letter on line %d: %w", line, err)
+		}
+		letters = append(letters, &letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter file: %w", err)
+	}
+	return letters, nil
+}
+
+// CountDeadLetters counts the letters in the dead-letter file without
+// decoding them; a missing file holds none
+func CountDeadLetters(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read dead-letter file: %w", err)
+	}
+	return count, nil
+}
+
+// ReplayDeadLetters writes the sessions of the dead-letter file to db.
+// Sessions that fail again are written back to the file with their new
+// error. The file is moved aside first, so letters the daemon adds
+// meanwhile are kept.
+func ReplayDeadLetters(db *storage.DB, path string) (replayed, failed int, err error) {
+	replaying := path + ".replaying"
+	if err := os.Rename(path, replaying); os.IsNotExist(err) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("failed to move dead-letter file aside: %w", err)
+	}
+
+	letters, err := ReadDeadLetters(replaying)
+	if err != nil {
+		os.Rename(replaying, path)
+		return 0, 0, err
+	}
+
+	sessions := make([]*storage.Session, len(letters))
+	bySession := make(map[*storage.Session]*DeadLetter, len(letters))
+	for i, letter := range letters {
+		sessions[i] = letter.Session()
+		bySession[sessions[i]] = letter
+	}
+
+	stored, rowErrs, err := writeSessions(context.Background(), db, sessions)
+	if err != nil {
+		os.Rename(replaying, path)
+		return 0, 0, err
+	}
+
+	var retry []*DeadLetter
+	now := time.Now()
+	for _, rowErr := range rowErrs {
+		letter := bySession[rowErr.Session]
+		retry = append(retry, newDeadLetter(rowErr.Session, letter.Attempts+1, rowErr.Err, now))
+	}
+	if err := AppendDeadLetters(path, retry); err != nil {
+		return 0, 0, err
+	}
+	if err := os.Remove(replaying); err != nil {
+		return 0, 0, fmt.Errorf("failed to remove replayed dead letters: %w", err)
+	}
+
+	return len(stored), len(retry), nil
+}
+
+// writeSessions inserts sessions together with their daily and hourly
+// totals. It returns the stored sessions and the per-row errors of the
+// others, whose rows and totals were both undone. When nothing is stored,
+// err says why and every session may be written again.
+func writeSessions(ctx context.Context, db *storage.DB, sessions []*storage.Session) (stored []*storage.Session, failed []storage.RowError, err error) {
+	if err := db.WriteSessionsContext(ctx, sessions); err != nil {
+		batchErr, ok := storage.AsBatchError(err)
+		if !ok {
+			return nil, nil, fmt.Errorf("failed to write sessions: %w", err)
+		}
+		failed = batchErr.Failed
+	}
+
+	rejected := make(map[*storage.Session]bool, len(failed))
+	for _, rowErr := range failed {
+		rejected[rowErr.Session] = true
+	}
+	for _, session := range sessions {
+		if !rejected[session] {
+			stored = append(stored, session)
+		}
+	}
+	return stored, failed, nil
+}
+
+// rejectInvalid splits off the sessions no write can store sensibly: those
+// longer than max, a cap the tracker never lets a session reach, and those
+// ending before they start. A zero max does not cap durations.
+func rejectInvalid(sessions []*storage.Session, max time.Duration) (valid []*storage.Session, rejected []storage.RowError) {
+	for _, session := range sessions {
+		switch {
+		case max > 0 && time.Duration(session.DurationSeconds)*time.Second > max:
+			rejected = append(rejected, storage.RowError{
+				Session: session,
+				Err:     fmt.Errorf("duration %ds exceeds the maximum of %s", session.DurationSeconds, max),
+			})
+		case !session.EndTime.IsZero() && session.EndTime.Before(session.StartTime):
+			rejected = append(rejected, storage.RowError{
+				Session: session,
+				Err:     fmt.Errorf("ends at %s before it starts at %s", session.EndTime.Format(time.RFC3339), session.StartTime.Format(time.RFC3339)),
+			})
+		default:
+			valid = append(valid, session)
+		}
+	}
+	return valid, rejected
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestFlushMovesPoisonSessionsToDeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+	cfg := testConfig(dir)
+
+	svc, err := NewServiceWithDetector(cfg, &fakeDetector{})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer svc.db.Close()
+
+	day := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	good := func(offset time.Duration) *storage.Session {
+		start := day.Add(offset)
+		return &storage.Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60}
+	}
+
+	// A session without a start time cannot be stored
+	poison := &storage.Session{AppName: "editor", WindowTitle: "poison", DurationSeconds: 60}
+	svc.sessionBuffer = []*storage.Session{good(0), poison, good(time.Hour)}
+
+	for attempt := 1; attempt <= MaxWriteAttempts; attempt++ {
+		if err := svc.flushSessions(); err == nil {
+			t.Fatalf("Expected flush %d to report the poison session", attempt)
+		}
+		if attempt < MaxWriteAttempts && (len(svc.retryBuffer) != 1 || svc.retryBuffer[0] != poison) {
+			t.Fatalf("Expected the poison session to be retried after flush %d, got %d sessions", attempt, len(svc.retryBuffer))
+		}
+
+		// New sessions keep being written meanwhile
+		svc.sessionBuffer = append(svc.sessionBuffer, good(time.Duration(attempt)*2*time.Hour))
+	}
+	if len(svc.retryBuffer) != 0 {
+		t.Errorf("Expected no retries after %d attempts, got %d", MaxWriteAttempts, len(svc.retryBuffer))
+	}
+	if err := svc.flushSessions(); err != nil {
+		t.Errorf("Expected the last flush to succeed, got %v", err)
+	}
+
+	sessions, err := svc.db.GetSessions(&storage.StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 2+MaxWriteAttempts {
+		t.Errorf("Expected every good session to be stored, got %d", len(sessions))
+	}
+
+	path := DeadLetterPath(cfg.Database.Path)
+	letters, err := ReadDeadLetters(path)
+	if err != nil {
+		t.Fatalf("Failed to read dead letters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].Title != "poison" || letters[0].Attempts != MaxWriteAttempts || letters[0].Error == "" {
+		t.Fatalf("Expected one dead letter for the poison session, got %+v", letters)
+	}
+	if got := svc.snapshot().Buffer.DeadLetters; got != 1 {
+		t.Errorf("Expected the snapshot to count 1 dead letter, got %d", got)
+	}
+
+	// Replaying a session that still cannot be stored keeps it
+	replayed, failed, err := ReplayDeadLetters(svc.db, path)
+	if err != nil || replayed != 0 || failed != 1 {
+		t.Errorf("Expected the poison session to fail again, got %d replayed, %d failed, %v", replayed, failed, err)
+	}
+	letters, _ = ReadDeadLetters(path)
+	if len(letters) != 1 || letters[0].Attempts != MaxWriteAttempts+1 {
+		t.Fatalf("Expected the dead letter to be kept with one more attempt, got %+v", letters)
+	}
+
+	// Once repaired, it is written and the file is emptied
+	letters[0].Start = day.Add(10 * time.Hour)
+	if err := writeLetters(path, letters); err != nil {
+		t.Fatalf("Failed to rewrite dead letters: %v", err)
+	}
+	replayed, failed, err = ReplayDeadLetters(svc.db, path)
+	if err != nil || replayed != 1 || failed != 0 {
+		t.Errorf("Expected the repaired session to be replayed, got %d replayed, %d failed, %v", replayed, failed, err)
+	}
+	if letters, _ := ReadDeadLetters(path); len(letters) != 0 {
+		t.Errorf("Expected no dead letters left, got %d", len(letters))
+	}
+}
+
+// writeLetters replaces the dead-letter file with letters
+func writeLetters(path string, letters []*DeadLetter) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return AppendDeadLetters(path, letters)
+}
+
+func TestSnapshotCountsDeadLettersFromStartup(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+	cfg := testConfig(dir)
+
+	// Left by an earlier run
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	session := &storage.Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60}
+	letters := []*DeadLetter{
+		newDeadLetter(session, MaxWriteAttempts, os.ErrInvalid, start),
+		newDeadLetter(session, MaxWriteAttempts, os.ErrInvalid, start),
+	}
+	if err := AppendDeadLetters(DeadLetterPath(cfg.Database.Path), letters); err != nil {
+		t.Fatalf("Failed to write dead letters: %v", err)
+	}
+
+	svc, err := NewServiceWithDetector(cfg, &fakeDetector{})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer svc.db.Close()
+
+	if got := svc.snapshot().Buffer.DeadLetters; got != 2 {
+		t.Errorf("Expected the snapshot to count 2 dead letters, got %d", got)
+	}
+
+	svc.writeDeadLetters(letters[:1])
+	if got := svc.snapshot().Buffer.DeadLetters; got != 3 {
+		t.Errorf("Expected the snapshot to count 3 dead letters, got %d", got)
+	}
+}
+
+func TestFlushDeadLettersSessionsWhoseTotalsFail(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+	cfg := testConfig(dir)
+
+	svc, err := NewServiceWithDetector(cfg, &fakeDetector{})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer svc.db.Close()
+
+	// The session can be inserted, but its hourly total is refused
+	conn, err := sql.Open("sqlite", cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = conn.Exec(`CREATE TRIGGER refuse_broken BEFORE INSERT ON hourly_stats
+	WHEN NEW.app_name = 'broken' BEGIN SELECT RAISE(ABORT, 'refused'); END`)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	svc.sessionBuffer = []*storage.Session{
+		{AppName: "editor", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600},
+		{AppName: "broken", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60},
+	}
+	for attempt := 1; attempt <= MaxWriteAttempts; attempt++ {
+		if err := svc.flushSessions(); err == nil {
+			t.Fatalf("Expected flush %d to report the broken session", attempt)
+		}
+	}
+	if len(svc.retryBuffer) != 0 {
+		t.Errorf("Expected no retries after %d attempts, got %d", MaxWriteAttempts, len(svc.retryBuffer))
+	}
+
+	letters, err := ReadDeadLetters(DeadLetterPath(cfg.Database.Path))
+	if err != nil {
+		t.Fatalf("Failed to read dead letters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].App != "broken" {
+		t.Fatalf("Expected the broken session to be dead-lettered, got %+v", letters)
+	}
+
+	sessions, err := svc.db.GetSessions(&storage.StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].AppName != "editor" {
+		t.Errorf("Expected only the editor's session to be stored, got %+v", sessions)
+	}
+	stats, err := svc.db.GetDailyStats(&storage.StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].AppName != "editor" || stats[0].TotalSeconds != 3600 {
+		t.Errorf("Expected the broken session's daily total to be undone, got %+v", stats)
+	}
+}
+
+func TestReplayWithoutDeadLetters(t *testing.T) {
+	db, err := storage.NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	replayed, failed, err := ReplayDeadLetters(db, filepath.Join(t.TempDir(), "deadletter.jsonl"))
+	if err != nil || replayed != 0 || failed != 0 {
+		t.Errorf("Expected nothing to replay, got %d, %d, %v", replayed, failed, err)
+	}
+}
+
+func TestFlushDeadLettersRunawaySessions(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+	cfg := testConfig(dir)
+	cfg.Monitor.MaxSessionDuration = 12 * time.Hour
+
+	svc, err := NewServiceWithDetector(cfg, &fakeDetector{})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer svc.db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	svc.sessionBuffer = []*storage.Session{
+		{AppName: "editor", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600},
+		{AppName: "editor", WindowTitle: "runaway", StartTime: start, EndTime: start.Add(40 * time.Hour), DurationSeconds: 40 * 3600},
+		{AppName: "editor", WindowTitle: "inverted", StartTime: start, EndTime: start.Add(-time.Minute), DurationSeconds: 60},
+	}
+
+	// Both bad sessions are dead-lettered at once instead of retried
+	if err := svc.flushSessions(); err != nil {
+		t.Fatalf("Expected the valid session to be written, got %v", err)
+	}
+	if len(svc.retryBuffer) != 0 {
+		t.Errorf("Expected nothing to retry, got %d sessions", len(svc.retryBuffer))
+	}
+
+	letters, err := ReadDeadLetters(DeadLetterPath(cfg.Database.Path))
+	if err != nil {
+		t.Fatalf("Failed to read dead letters: %v", err)
+	}
+	if len(letters) != 2 || letters[0].Title != "runaway" || letters[1].Title != "inverted" {
+		t.Fatalf("Expected the runaway and inverted sessions as dead letters, got %+v", letters)
+	}
+
+	sessions, err := svc.db.GetSessions(&storage.StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].DurationSeconds != 3600 {
+		t.Errorf("Expected only the valid session to be stored, got %d", len(sessions))
+	}
+}
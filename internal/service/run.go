@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/weii/actime/internal/config"
+)
+
+// RunForeground runs the service attached to the terminal until Ctrl+C.
+// Logs go to the terminal as well as the log file; verbose enables debug
+// logging.
+func RunForeground(verbose bool) error {
+	fmt.Println("Running Actime in foreground mode...")
+	fmt.Println("Press Ctrl+C to stop")
+
+	if err := run(true, verbose); err != nil {
+		return err
+	}
+
+	fmt.Println("Actime stopped")
+	return nil
+}
+
+// RunDaemon runs the service in the detached process spawned by `actimed start`
+func RunDaemon() error {
+	return run(false, false)
+}
+
+// run is the code path shared by the daemon and foreground mode
+func run(foreground, verbose bool) error {
+	// Load configuration
+	cfg, err := config.Load(config.DefaultConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if verbose {
+		cfg.Logging.Level = "debug"
+	}
+
+	// Create service
+	svc, err := NewService(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	svc.foreground = foreground
+
+	// Run until SIGINT or SIGTERM
+	if err := svc.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+
+	return nil
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/export"
 	"github.com/weii/actime/internal/platform"
+	"github.com/weii/actime/internal/stats"
 	"github.com/weii/actime/internal/storage"
 	"github.com/weii/actime/pkg/logger"
 )
@@ -19,18 +23,72 @@ import (
 type Service struct {
 	config          *core.Config
 	db              *storage.DB
+	detector        platform.Detector
 	tracker         *core.Tracker
 	ctx             context.Context
 	cancel          context.CancelFunc
-	running         bool
+	running         atomic.Bool
 	sessionBuffer   []*storage.Session
+	retryBuffer     []*storage.Session
+	writeAttempts   map[*storage.Session]int
+	deadLetterPath  string
+	gapBuffer       []*storage.Gap
 	sessionMutex    sync.Mutex
 	batchInterval   time.Duration
 	batchTicker     *time.Ticker
+	startedAt       time.Time
+	lastFlushAt     time.Time
+	lastFlushErr    error
+	sessionsFlushed atomic.Int64
+	flushErrors     atomic.Int64
+	deadLettered    atomic.Int64
+	deadLetters     atomic.Int64
+	foreground      bool
+	loops           sync.WaitGroup
+	done            chan struct{}
 }
 
-// NewService creates a new service instance
+// NewService creates a new service instance using the platform detector
 func NewService(cfg *core.Config) (*Service, error) {
+	// Initialize platform detector
+	if err := platform.InitializePlatformDetector(cfg.Monitor.Detectors, cfg.Monitor.DetectorTimeout); err != nil {
+		return nil, fmt.Errorf("failed to initialize platform detector: %w", err)
+	}
+
+	svc, err := NewServiceWithDetector(cfg, platform.PlatformDetector)
+	if err != nil {
+		platform.ClosePlatformDetector()
+		return nil, err
+	}
+	if cfg.Monitor.IdleSource == "evdev" {
+		if err := platform.UseEvdevIdle(); err != nil {
+			logger.GetLogger().Warn("Cannot read idle time from input devices, falling back to the detector's own idle source",
+				"error", err)
+		}
+	}
+	logCapabilities(platform.PlatformDetector)
+
+	return svc, nil
+}
+
+// logCapabilities logs once what the detector can tell, so a log shows why
+// tracking records nothing or never pauses
+func logCapabilities(detector platform.Detector) {
+	log := logger.GetLogger()
+	for _, capability := range platform.ProbeCapabilities(detector) {
+		if capability.Working && capability.Hint == "" {
+			log.Info("Detector capability", "capability", capability.Name, "method", capability.Method)
+			continue
+		}
+		log.Warn("Detector capability limited", "capability", capability.Name,
+			"supported", capability.Supported, "working", capability.Working,
+			"method", capability.Method, "detail", capability.Detail, "hint", capability.Hint)
+	}
+}
+
+// NewServiceWithDetector creates a new service instance that tracks with the
+// given, already initialized detector. The service closes it on shutdown.
+func NewServiceWithDetector(cfg *core.Config, detector platform.Detector) (*Service, error) {
 	// Initialize logger
 	if err := logger.Init(
 		cfg.Logging.Level,
@@ -42,42 +100,91 @@ func NewService(cfg *core.Config) (*Service, error) {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
-	// Initialize database
-	db, err := storage.NewDB(cfg.Database.Path)
+	// Initialize database. A corrupted file is replaced by what can be
+	// salvaged from it, so tracking continues instead of crash-looping.
+	db, recovery, err := storage.OpenOrRecover(cfg.Database.Path, storage.Options{
+		MaxReadConns: cfg.Database.MaxReadConns,
+		BusyTimeout:  cfg.Database.BusyTimeout,
+		SlowQuery:    cfg.Database.SlowQuery,
+	})
+	if recovery != nil {
+		logRecovery(cfg.Database.Path, recovery)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	// Initialize platform detector
-	if err := platform.InitializePlatformDetector(); err != nil {
-		return nil, fmt.Errorf("failed to initialize platform detector: %w", err)
-	}
-
 	// Initialize tracker
-	tracker := core.NewTracker(cfg, platform.PlatformDetector)
+	tracker := core.NewTracker(cfg, detector)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Service{
+	svc := &Service{
 		config:        cfg,
 		db:            db,
+		detector:      detector,
 		tracker:       tracker,
 		ctx:           ctx,
 		cancel:        cancel,
-		running:       false,
-		sessionBuffer: make([]*storage.Session, 0),
-		batchInterval: 60 * time.Second, // Batch write every 60 seconds
-	}, nil
+		sessionBuffer:  make([]*storage.Session, 0),
+		writeAttempts:  make(map[*storage.Session]int),
+		deadLetterPath: DeadLetterPath(cfg.Database.Path),
+		batchInterval:  60 * time.Second, // Batch write every 60 seconds
+		done:          make(chan struct{}),
+	}
+
+	// The file is counted once; the snapshot then follows what the daemon
+	// adds to it
+	letters, err := CountDeadLetters(svc.deadLetterPath)
+	if err != nil {
+		logger.GetLogger().Warn("Failed to count dead letters", "error", err)
+	}
+	svc.deadLetters.Store(int64(letters))
+
+	return svc, nil
 }
 
-// Start starts the service
+// logRecovery records how a corrupted database was replaced
+func logRecovery(path string, recovery *storage.Recovery) {
+	log := logger.GetLogger()
+	log.Error("Database was corrupted and has been moved aside",
+		"path", path,
+		"moved_to", recovery.CorruptPath)
+
+	if recovery.SalvageErr != nil {
+		log.Error("Failed to salvage the corrupted database, continuing with an empty one",
+			"error", recovery.SalvageErr)
+		return
+	}
+	log.Warn("Salvaged rows from the corrupted database into a new one",
+		"sessions", recovery.Salvage.Sessions,
+		"daily_stats", recovery.Salvage.DailyStats,
+		"gaps", recovery.Salvage.Gaps,
+		"unreadable", recovery.Salvage.Unreadable)
+}
+
+// Start runs the service until SIGINT or SIGTERM is received
 func (s *Service) Start() error {
-	if s.running {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return s.Run(ctx)
+}
+
+// Run starts the service and blocks until ctx is cancelled or Stop is
+// called. On the way out the tracker is stopped and buffered sessions are
+// flushed, so both the daemon and foreground mode persist everything.
+func (s *Service) Run(ctx context.Context) error {
+	if s.running.Load() {
 		return fmt.Errorf("service is already running")
 	}
 
 	log := logger.GetLogger()
-	log.Info("Starting Actime service")
+	if s.foreground {
+		log.Info("Starting Actime service in foreground mode")
+	} else {
+		log.Info("Starting Actime service")
+	}
 
 	// Check and lock PID file
 	if err := CheckAndLockPIDFile(PIDFile); err != nil {
@@ -90,57 +197,97 @@ func (s *Service) Start() error {
 		return fmt.Errorf("failed to start tracker: %w", err)
 	}
 
-	s.running = true
-
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Start monitoring loop
-	go s.monitorLoop()
+	s.running.Store(true)
+	s.startedAt = time.Now()
 
-	// Start batch write loop
+	// Start monitoring, batch write, status snapshot, retention and
+	// automatic export loops
 	s.batchTicker = time.NewTicker(s.batchInterval)
-	go s.batchWriteLoop()
+	for _, loop := range []func(){s.monitorLoop, s.batchWriteLoop, s.statusLoop, s.retentionLoop, s.autoExportLoop, s.backupLoop} {
+		s.loops.Add(1)
+		go func(loop func()) {
+			defer s.loops.Done()
+			loop()
+		}(loop)
+	}
 
-	// Wait for shutdown signal
-	<-sigChan
-	log.Info("Received shutdown signal")
+	// Wait for shutdown
+	select {
+	case <-ctx.Done():
+		log.Info("Received shutdown signal")
+	case <-s.ctx.Done():
+	}
 
-	s.Stop()
+	s.shutdown()
+	close(s.done)
 	return nil
 }
 
-// Stop stops the service
+// ShutdownFlushTimeout bounds the final flush at shutdown, so a write stuck
+// on a locked database cannot keep the daemon from exiting
+const ShutdownFlushTimeout = 10 * time.Second
+
+// StopTimeout bounds how long Stop waits for the service to shut down
+const StopTimeout = ShutdownFlushTimeout + 5*time.Second
+
+// Stop asks a running service to shut down and waits until it has, or
+// until StopTimeout has passed
 func (s *Service) Stop() error {
-	if !s.running {
+	if !s.running.Load() {
 		return fmt.Errorf("service is not running")
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), StopTimeout)
+	defer cancel()
+
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("service did not stop within %s", StopTimeout)
+	}
+}
+
+// shutdown stops the loops and the tracker, flushes buffered sessions and
+// releases every resource held by the service
+func (s *Service) shutdown() {
 	log := logger.GetLogger()
 	log.Info("Stopping Actime service")
 
-	s.running = false
+	s.running.Store(false)
 	s.cancel()
 
+	// Wait for the loops, so none of them buffers a session after the final
+	// flush or rewrites the status file after it is removed
+	s.loops.Wait()
+
 	// Stop tracker
 	if err := s.tracker.Stop(); err != nil {
 		log.Error("Failed to stop tracker", "error", err)
 	}
+	s.bufferGaps()
 
 	// Stop batch ticker
 	if s.batchTicker != nil {
 		s.batchTicker.Stop()
 	}
 
-	// Flush remaining sessions
-	if err := s.flushSessions(); err != nil {
+	// Flush remaining sessions. There is no later flush to retry those
+	// that fail or time out, so they go to the dead-letter file.
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownFlushTimeout)
+	err := s.flushSessionsContext(ctx)
+	cancel()
+	if err != nil {
 		log.Error("Failed to flush sessions", "error", err)
+		s.deadLetterRetries(err)
 	}
 
-	// Close platform detector
-	if err := platform.ClosePlatformDetector(); err != nil {
-		log.Error("Failed to close platform detector", "error", err)
+	// Close detector
+	if s.detector != nil {
+		if err := s.detector.Close(); err != nil {
+			log.Error("Failed to close platform detector", "error", err)
+		}
 	}
 
 	// Close database
@@ -150,9 +297,9 @@ func (s *Service) Stop() error {
 		}
 	}
 
-	// Close logger
-	if err := logger.Close(); err != nil {
-		log.Error("Failed to close logger", "error", err)
+	// Remove status snapshot
+	if err := os.Remove(StatusFile); err != nil && !os.IsNotExist(err) {
+		log.Error("Failed to remove status file", "error", err)
 	}
 
 	// Remove PID file
@@ -161,7 +308,11 @@ func (s *Service) Stop() error {
 	}
 
 	log.Info("Service stopped")
-	return nil
+
+	// Close logger
+	if err := logger.Close(); err != nil {
+		log.Error("Failed to close logger", "error", err)
+	}
 }
 
 // monitorLoop is the main monitoring loop
@@ -180,6 +331,7 @@ func (s *Service) monitorLoop() {
 			if currentSession != nil {
 				s.bufferSession(currentSession)
 			}
+			s.bufferGaps()
 			log.Debug("Monitoring tick")
 		}
 	}
@@ -199,6 +351,308 @@ func (s *Service) batchWriteLoop() {
 	}
 }
 
+// statusLoop periodically publishes the status snapshot read by `actimed status`
+func (s *Service) statusLoop() {
+	ticker := time.NewTicker(StatusInterval)
+	defer ticker.Stop()
+
+	s.writeStatus()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.writeStatus()
+		}
+	}
+}
+
+// RetentionInterval is how often the daemon applies the retention policy
+const RetentionInterval = 24 * time.Hour
+
+// retentionLoop prunes sessions older than Retention.Days and daily
+// statistics older than Retention.DailyStatsDays at startup and once a day
+// after that
+func (s *Service) retentionLoop() {
+	if s.config.Retention.Days <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(RetentionInterval)
+	defer ticker.Stop()
+
+	s.applyRetention()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.applyRetention()
+		}
+	}
+}
+
+// applyRetention prunes what fell out of the retention windows
+func (s *Service) applyRetention() {
+	s.pruneSessions()
+	if s.config.Retention.DailyStatsDays > 0 {
+		s.pruneDailyStats()
+	}
+}
+
+// retentionCutoff returns the first day kept when keeping days days
+func retentionCutoff(days int) time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d-days, 0, 0, 0, 0, time.Local)
+}
+
+// pruneDailyStats deletes the daily statistics that fell out of their
+// retention window
+func (s *Service) pruneDailyStats() {
+	log := logger.GetLogger()
+	before := retentionCutoff(s.config.Retention.DailyStatsDays)
+	deleted, err := s.db.PruneDailyStats(before)
+	if err != nil {
+		log.Error("Failed to prune old daily stats", "before", before.Format(storage.DateLayout), "error", err)
+		return
+	}
+	if deleted > 0 {
+		log.Info("Pruned old daily stats", "before", before.Format(storage.DateLayout), "deleted", deleted)
+	}
+}
+
+// pruneSessions deletes the sessions that fell out of the retention window,
+// archiving them to Retention.ExportDir first when it is set
+func (s *Service) pruneSessions() {
+	log := logger.GetLogger()
+	before := retentionCutoff(s.config.Retention.Days)
+
+	deleted, manifest, err := export.PruneSessions(s.db, before, s.config.Retention.ExportDir)
+	if err != nil {
+		log.Error("Failed to prune old sessions", "before", before.Format(storage.DateLayout), "error", err)
+		return
+	}
+	if deleted == 0 {
+		return
+	}
+	if manifest != nil {
+		log.Info("Pruned old sessions", "before", manifest.Before, "deleted", deleted,
+			"archive", filepath.Join(s.config.Retention.ExportDir, manifest.File))
+		return
+	}
+	log.Info("Pruned old sessions", "before", before.Format(storage.DateLayout), "deleted", deleted)
+}
+
+// backupLoop copies the database to Database.Backup.Dir every
+// Database.Backup.Interval, keeping the newest Database.Backup.Keep copies
+func (s *Service) backupLoop() {
+	if s.config.Database.Backup.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.Database.Backup.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.backup()
+		}
+	}
+}
+
+// backup flushes buffered sessions, writes a new backup and removes the
+// ones beyond Database.Backup.Keep
+func (s *Service) backup() {
+	log := logger.GetLogger()
+	if err := s.flushSessions(); err != nil {
+		log.Warn("Failed to flush sessions before backup", "error", err)
+	}
+
+	dir := s.config.Database.Backup.Dir
+	path := filepath.Join(dir, storage.BackupName(time.Now()))
+	if err := s.db.BackupTo(path); err != nil {
+		log.Error("Failed to back up database", "path", path, "error", err)
+		return
+	}
+	log.Info("Backed up database", "path", path)
+
+	removed, err := storage.PruneBackups(dir, s.config.Database.Backup.Keep)
+	if err != nil {
+		log.Error("Failed to remove old backups", "dir", dir, "error", err)
+	}
+	if len(removed) > 0 {
+		log.Info("Removed old backups", "dir", dir, "removed", len(removed))
+	}
+}
+
+// AutoExportDelay is how long after local midnight the finished day is
+// exported, leaving time for its last sessions to be flushed
+const AutoExportDelay = 5 * time.Minute
+
+// autoExportLoop exports the days missed while the daemon was not running
+// at startup, then every finished day shortly after local midnight
+func (s *Service) autoExportLoop() {
+	if !s.config.Export.Auto.Enabled {
+		return
+	}
+
+	s.exportFinishedDays()
+	for {
+		timer := time.NewTimer(time.Until(nextAutoExport(time.Now())))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.exportFinishedDays()
+		}
+	}
+}
+
+// nextAutoExport returns when the day running at now is exported
+func nextAutoExport(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Add(AutoExportDelay)
+}
+
+// exportFinishedDays flushes buffered sessions and exports every finished
+// day not yet in Export.Auto.Dir
+func (s *Service) exportFinishedDays() {
+	log := logger.GetLogger()
+	if err := s.flushSessions(); err != nil {
+		log.Warn("Failed to flush sessions before export", "error", err)
+	}
+
+	auto := s.config.Export.Auto
+	written, err := export.CatchUp(s.db, auto.Dir, time.Now(), auto.CatchUpDays)
+	for _, day := range written {
+		log.Info("Exported day", "date", day.Format(storage.DateLayout), "dir", auto.Dir)
+	}
+	if err != nil {
+		log.Error("Failed to export finished days", "dir", auto.Dir, "error", err)
+	}
+}
+
+// writeStatus writes the current status snapshot to StatusFile
+func (s *Service) writeStatus() {
+	if err := WriteSnapshot(StatusFile, s.snapshot()); err != nil {
+		logger.GetLogger().Debug("Failed to write status snapshot", "error", err)
+	}
+}
+
+// snapshot collects the current state of the service
+func (s *Service) snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		PID:        os.Getpid(),
+		StartedAt:  s.startedAt,
+		UpdatedAt:  time.Now(),
+		Foreground: s.foreground,
+		Detector: DetectorStatus{
+			Type:        detectorType(s.detector),
+			ErrorsTotal: s.tracker.DetectorErrors(),
+		},
+		Counters: s.counters(),
+	}
+	if reporter, ok := s.detector.(platform.SessionStateReporter); ok {
+		snapshot.Detector.SessionState = reporter.SessionState()
+	}
+	if reporter, ok := s.detector.(platform.HealthReporter); ok {
+		for _, health := range reporter.DetectorHealth() {
+			member := DetectorMember{
+				Name:      health.Name,
+				Healthy:   health.Healthy,
+				Failures:  health.Failures,
+				LastError: health.LastError,
+			}
+			if !health.LastOK.IsZero() {
+				lastOK := health.LastOK
+				member.LastOKAt = &lastOK
+			}
+			snapshot.Detector.Members = append(snapshot.Detector.Members, member)
+		}
+	}
+
+	if session := s.tracker.GetCurrentSession(); session != nil {
+		snapshot.Current = &CurrentSession{
+			App:             session.AppName,
+			Title:           session.WindowTitle,
+			Since:           session.StartTime,
+			DurationSeconds: session.DurationSeconds,
+		}
+	}
+
+	s.sessionMutex.Lock()
+	pending := stats.MergeSessions(s.retryBuffer, s.sessionBuffer)
+	snapshot.Buffer.PendingSessions = len(s.retryBuffer) + len(s.sessionBuffer)
+	if !s.lastFlushAt.IsZero() {
+		lastFlushAt := s.lastFlushAt
+		snapshot.Buffer.LastFlushAt = &lastFlushAt
+	}
+	if s.lastFlushErr != nil {
+		snapshot.Buffer.LastFlushError = s.lastFlushErr.Error()
+	}
+	s.sessionMutex.Unlock()
+
+	snapshot.Buffer.DeadLetters = int(s.deadLetters.Load())
+
+	// The current session may be newer than its last buffered checkpoint
+	if session := s.tracker.GetCurrentSession(); session != nil {
+		pending = stats.MergeSessions(pending, []*storage.Session{{
+			AppName:         session.AppName,
+			WindowTitle:     session.WindowTitle,
+			StartTime:       session.StartTime,
+			EndTime:         session.EndTime,
+			DurationSeconds: session.DurationSeconds,
+			MonitorIndex:    session.MonitorIndex,
+		}})
+	}
+	for _, session := range pending {
+		snapshot.Sessions = append(snapshot.Sessions, LiveSession{
+			App:             session.AppName,
+			Title:           session.WindowTitle,
+			Start:           session.StartTime,
+			End:             session.EndTime,
+			DurationSeconds: session.DurationSeconds,
+			MonitorIndex:    session.MonitorIndex,
+		})
+	}
+
+	today, _ := time.Parse(storage.DateLayout, time.Now().Format(storage.DateLayout))
+	daily, err := s.db.GetDailyStats(&storage.StatsQuery{StartDate: today, EndDate: today})
+	if err == nil {
+		for _, stat := range daily {
+			snapshot.TodaySeconds += stat.TotalSeconds
+		}
+	}
+
+	return snapshot
+}
+
+// counters collects the totals of the tracker and the service since the
+// service started
+func (s *Service) counters() Counters {
+	tracker := s.tracker.Counters()
+	counters := Counters{
+		Since:                   s.startedAt,
+		TicksTotal:              tracker.Ticks,
+		DetectorErrorsTotal:     tracker.DetectorErrors,
+		SessionsStartedTotal:    tracker.SessionsStarted,
+		SessionsEndedTotal:      tracker.SessionsEnded,
+		PausesTotal:             tracker.Pauses,
+		DetectorReconnectsTotal: tracker.Reconnects,
+		SessionsFlushedTotal:    s.sessionsFlushed.Load(),
+		FlushErrorsTotal:        s.flushErrors.Load(),
+		DeadLettersTotal:        s.deadLettered.Load(),
+	}
+	if !tracker.LastDetectorOK.IsZero() {
+		counters.LastDetectorOKAt = &tracker.LastDetectorOK
+	}
+	return counters
+}
+
 // bufferSession adds a session to the buffer
 func (s *Service) bufferSession(session *core.Session) {
 	s.sessionMutex.Lock()
@@ -208,17 +662,22 @@ func (s *Service) bufferSession(session *core.Session) {
 	storageSession := &storage.Session{
 		AppName:         session.AppName,
 		WindowTitle:     session.WindowTitle,
+		RawTitle:        session.RawTitle,
+		Domain:          session.Domain,
+		ExePath:         session.ExePath,
+		MonitorIndex:    session.MonitorIndex,
+		Workspace:       session.Workspace,
 		StartTime:       session.StartTime,
 		EndTime:         session.EndTime,
 		DurationSeconds: session.DurationSeconds,
 	}
 
-	// Check if we already have a session for this app/window in the buffer
-	// If yes, update it instead of adding a new one
+	// The current session is buffered on every tick with the same start
+	// and a growing duration; replace the earlier checkpoint of it
 	for i, bufSession := range s.sessionBuffer {
 		if bufSession.AppName == storageSession.AppName &&
 			bufSession.WindowTitle == storageSession.WindowTitle &&
-			bufSession.EndTime.Equal(storageSession.StartTime) {
+			bufSession.StartTime.Equal(storageSession.StartTime) {
 			// Update existing session
 			s.sessionBuffer[i] = storageSession
 			return
@@ -229,14 +688,75 @@ func (s *Service) bufferSession(session *core.Session) {
 	s.sessionBuffer = append(s.sessionBuffer, storageSession)
 }
 
-// flushSessions writes all buffered sessions to the database
+// bufferGaps moves the gaps closed by the tracker into the buffer
+func (s *Service) bufferGaps() {
+	gaps := s.tracker.TakeGaps()
+	if len(gaps) == 0 {
+		return
+	}
+
+	s.sessionMutex.Lock()
+	defer s.sessionMutex.Unlock()
+
+	for _, gap := range gaps {
+		s.gapBuffer = append(s.gapBuffer, &storage.Gap{
+			Kind:      gap.Kind,
+			StartTime: gap.Start,
+			EndTime:   gap.End,
+		})
+	}
+}
+
+// flushSessions writes all buffered sessions to the database and records
+// the outcome for the status snapshot
 func (s *Service) flushSessions() error {
+	return s.flushSessionsContext(context.Background())
+}
+
+// flushSessionsContext is flushSessions with a context bounding the writes
+func (s *Service) flushSessionsContext(ctx context.Context) error {
+	err := s.writeBufferedSessions(ctx)
+	if err != nil {
+		s.flushErrors.Add(1)
+	}
+
+	s.sessionMutex.Lock()
+	s.lastFlushAt = time.Now()
+	s.lastFlushErr = err
+	s.sessionMutex.Unlock()
+
+	return err
+}
+
+// writeBufferedSessions drains the session and gap buffers into the
+// database. Sessions that fail are tried again on the next flush, together
+// with the new ones.
+func (s *Service) writeBufferedSessions(ctx context.Context) error {
 	s.sessionMutex.Lock()
-	sessions := make([]*storage.Session, len(s.sessionBuffer))
-	copy(sessions, s.sessionBuffer)
+	sessions := make([]*storage.Session, 0, len(s.retryBuffer)+len(s.sessionBuffer))
+	sessions = append(sessions, s.retryBuffer...)
+	sessions = append(sessions, s.sessionBuffer...)
+	s.retryBuffer = nil
 	s.sessionBuffer = s.sessionBuffer[:0] // Clear buffer
+	gaps := s.gapBuffer
+	s.gapBuffer = nil
 	s.sessionMutex.Unlock()
 
+	if err := s.db.InsertGaps(gaps); err != nil {
+		return fmt.Errorf("failed to insert gaps: %w", err)
+	}
+
+	// Writing a runaway or inverted session again cannot help
+	sessions, rejected := rejectInvalid(sessions, s.config.Monitor.MaxSessionDuration)
+	if len(rejected) > 0 {
+		now := time.Now()
+		letters := make([]*DeadLetter, len(rejected))
+		for i, rowErr := range rejected {
+			letters[i] = newDeadLetter(rowErr.Session, 1, rowErr.Err, now)
+		}
+		s.writeDeadLetters(letters)
+	}
+
 	if len(sessions) == 0 {
 		return nil
 	}
@@ -244,20 +764,96 @@ func (s *Service) flushSessions() error {
 	log := logger.GetLogger()
 	log.Info("Flushing sessions to database", "count", len(sessions))
 
-	// Batch insert sessions
-	if err := s.db.BatchInsertSessions(sessions); err != nil {
-		return fmt.Errorf("failed to batch insert sessions: %w", err)
+	stored, failed, err := writeSessions(ctx, s.db, sessions)
+	if err != nil {
+		// Nothing was written, so the whole batch is tried again
+		failed = make([]storage.RowError, len(sessions))
+		for i, session := range sessions {
+			failed[i] = storage.RowError{Session: session, Err: err}
+		}
+		s.retryLater(failed)
+		return err
 	}
 
-	// Update daily statistics
-	if err := s.db.UpdateDailyStatsBatch(sessions); err != nil {
-		return fmt.Errorf("failed to update daily stats: %w", err)
+	s.sessionMutex.Lock()
+	for _, session := range stored {
+		delete(s.writeAttempts, session)
 	}
+	s.sessionMutex.Unlock()
+	s.sessionsFlushed.Add(int64(len(stored)))
 
+	if len(failed) > 0 {
+		s.retryLater(failed)
+		return &storage.BatchError{Failed: failed}
+	}
 	return nil
 }
 
+// retryLater keeps failed sessions for the next flush. A session that has
+// failed MaxWriteAttempts times is moved to the dead-letter file instead,
+// so one bad row cannot stall every later write.
+func (s *Service) retryLater(failed []storage.RowError) {
+	var letters []*DeadLetter
+	now := time.Now()
+
+	s.sessionMutex.Lock()
+	for _, rowErr := range failed {
+		s.writeAttempts[rowErr.Session]++
+		attempts := s.writeAttempts[rowErr.Session]
+		if attempts >= MaxWriteAttempts {
+			delete(s.writeAttempts, rowErr.Session)
+			letters = append(letters, newDeadLetter(rowErr.Session, attempts, rowErr.Err, now))
+			continue
+		}
+		s.retryBuffer = append(s.retryBuffer, rowErr.Session)
+	}
+	s.sessionMutex.Unlock()
+
+	s.writeDeadLetters(letters)
+}
+
+// writeDeadLetters appends letters to the dead-letter file
+func (s *Service) writeDeadLetters(letters []*DeadLetter) {
+	if len(letters) == 0 {
+		return
+	}
+	log := logger.GetLogger()
+	if err := AppendDeadLetters(s.deadLetterPath, letters); err != nil {
+		log.Error("Failed to write dead letters, sessions are lost", "count", len(letters), "error", err)
+		return
+	}
+	s.deadLettered.Add(int64(len(letters)))
+	s.deadLetters.Add(int64(len(letters)))
+	log.Warn("Moved sessions that could not be written to the dead-letter file",
+		"count", len(letters),
+		"path", s.deadLetterPath)
+}
+
+// deadLetterRetries moves every session waiting to be retried to the
+// dead-letter file
+func (s *Service) deadLetterRetries(cause error) {
+	s.sessionMutex.Lock()
+	retry := s.retryBuffer
+	s.retryBuffer = nil
+	s.sessionMutex.Unlock()
+	if len(retry) == 0 {
+		return
+	}
+
+	letters := make([]*DeadLetter, len(retry))
+	now := time.Now()
+	for i, session := range retry {
+		letters[i] = newDeadLetter(session, s.writeAttempts[session], cause, now)
+	}
+	if err := AppendDeadLetters(s.deadLetterPath, letters); err != nil {
+		logger.GetLogger().Error("Failed to write dead letters, sessions are lost", "count", len(letters), "error", err)
+		return
+	}
+	s.deadLettered.Add(int64(len(letters)))
+	s.deadLetters.Add(int64(len(letters)))
+}
+
 // IsRunning returns true if the service is running
 func (s *Service) IsRunning() bool {
-	return s.running
+	return s.running.Load()
 }
\ No newline at end of file
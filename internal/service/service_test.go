@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/platform"
+	"github.com/weii/actime/internal/storage"
+)
+
+// fakeDetector reports an active user in a single window, titled main.go
+// unless title is set
+type fakeDetector struct {
+	closed atomic.Bool
+	title  string
+}
+
+func (d *fakeDetector) GetActiveWindow() (*platform.WindowInfo, error) {
+	title := d.title
+	if title == "" {
+		title = "main.go"
+	}
+	return &platform.WindowInfo{AppName: "editor", WindowTitle: title, PID: 1}, nil
+}
+
+func (d *fakeDetector) GetIdleTime() (time.Duration, error) { return 0, nil }
+func (d *fakeDetector) Initialize() error                   { return nil }
+func (d *fakeDetector) IsScreenLocked() (bool, error)       { return false, nil }
+
+func (d *fakeDetector) Close() error {
+	d.closed.Store(true)
+	return nil
+}
+
+// useTempRuntimeFiles points the PID and status files into a test directory
+func useTempRuntimeFiles(t *testing.T, dir string) {
+	t.Helper()
+	pidFile, statusFile := PIDFile, StatusFile
+	PIDFile = filepath.Join(dir, "actime.pid")
+	StatusFile = filepath.Join(dir, "actime.status.json")
+	t.Cleanup(func() {
+		PIDFile, StatusFile = pidFile, statusFile
+	})
+}
+
+func testConfig(dir string) *core.Config {
+	cfg := &core.Config{}
+	cfg.Database.Path = filepath.Join(dir, "actime.db")
+	cfg.Logging.Level = "error"
+	cfg.Logging.File = filepath.Join(dir, "actime.log")
+	cfg.Monitor.CheckInterval = 20 * time.Millisecond
+	cfg.Monitor.ActivityWindow = 5 * time.Minute
+	return cfg
+}
+
+func TestRunFlushesSessionsOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+	cfg := testConfig(dir)
+
+	detector := &fakeDetector{}
+	svc, err := NewServiceWithDetector(cfg, detector)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc.foreground = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(ctx) }()
+
+	// Let the tracker record a few ticks, well before the first batch write
+	time.Sleep(300 * time.Millisecond)
+	if _, err := os.Stat(PIDFile); err != nil {
+		t.Errorf("Expected a PID file while running: %v", err)
+	}
+	snapshot, err := ReadSnapshot(StatusFile)
+	if err != nil {
+		t.Fatalf("Expected a status snapshot while running: %v", err)
+	}
+	if !snapshot.Foreground {
+		t.Error("Expected the snapshot to be marked as foreground")
+	}
+
+	// Nothing is flushed yet, so the open session is only in memory; publish
+	// it now instead of waiting for the next status interval
+	svc.writeStatus()
+	live, err := ReadLiveSessions(time.Now())
+	if err != nil {
+		t.Fatalf("Expected live sessions from the running service: %v", err)
+	}
+	if len(live) != 1 || live[0].AppName != "editor" || live[0].DurationSeconds == 0 {
+		t.Errorf("Expected one open editor session, got %+v", live)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Service did not shut down")
+	}
+
+	if !detector.closed.Load() {
+		t.Error("Expected the detector to be closed")
+	}
+	if _, err := ReadLiveSessions(time.Now()); !errors.Is(err, ErrDaemonUnreachable) {
+		t.Errorf("Expected the daemon to be unreachable after shutdown, got %v", err)
+	}
+	for _, path := range []string{PIDFile, StatusFile} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed on shutdown", filepath.Base(path))
+		}
+	}
+
+	db, err := storage.OpenReadOnly(cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	sessions, err := db.GetSessions(&storage.StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read sessions: %v", err)
+	}
+	if len(sessions) == 0 {
+		t.Fatal("Expected the buffered sessions to be flushed on shutdown")
+	}
+	if sessions[0].AppName != "editor" || sessions[0].WindowTitle != "main.go" {
+		t.Errorf("Unexpected session: %+v", sessions[0])
+	}
+}
+
+func TestJunkTitlesAreCleanedBeforeStorage(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+	cfg := testConfig(dir)
+
+	svc, err := NewServiceWithDetector(cfg, &fakeDetector{title: "\x00 main.go\x07\r\n\x00"})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(ctx) }()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned an error: %v", err)
+	}
+
+	db, err := storage.OpenReadOnly(cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	sessions, err := db.GetSessions(&storage.StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read sessions: %v", err)
+	}
+	if len(sessions) == 0 {
+		t.Fatal("Expected sessions to be stored")
+	}
+	for _, session := range sessions {
+		if session.WindowTitle != "main.go" {
+			t.Errorf("Expected a cleaned title in the database, got %q", session.WindowTitle)
+		}
+	}
+}
+
+func TestServiceCounters(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+
+	svc, err := NewServiceWithDetector(testConfig(dir), &fakeDetector{})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	defer svc.db.Close()
+	svc.startedAt = time.Now()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	svc.bufferSession(&core.Session{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60})
+	svc.bufferSession(&core.Session{AppName: "browser", WindowTitle: "Docs", StartTime: start.Add(time.Minute), EndTime: start.Add(2 * time.Minute), DurationSeconds: 60})
+	// Ends before it starts, so it goes straight to the dead-letter file
+	svc.bufferSession(&core.Session{AppName: "editor", WindowTitle: "broken", StartTime: start, EndTime: start.Add(-time.Minute)})
+	if err := svc.flushSessions(); err != nil {
+		t.Fatalf("Failed to flush sessions: %v", err)
+	}
+
+	// A closed database fails the next flush
+	svc.bufferSession(&core.Session{AppName: "editor", WindowTitle: "main.go", StartTime: start.Add(time.Hour), EndTime: start.Add(time.Hour)})
+	svc.db.Close()
+	if err := svc.flushSessions(); err == nil {
+		t.Fatal("Expected the flush to a closed database to fail")
+	}
+
+	counters := svc.snapshot().Counters
+	if counters.SessionsFlushedTotal != 2 || counters.DeadLettersTotal != 1 || counters.FlushErrorsTotal != 1 {
+		t.Errorf("Expected 2 sessions flushed, 1 dead letter and 1 flush error, got %+v", counters)
+	}
+	if !counters.Since.Equal(svc.startedAt) {
+		t.Errorf("Expected the counters to run since %v, got %v", svc.startedAt, counters.Since)
+	}
+}
+
+func TestStopWaitsForShutdown(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+
+	svc, err := NewServiceWithDetector(testConfig(dir), &fakeDetector{})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(context.Background()) }()
+
+	// Wait for the service to come up
+	deadline := time.Now().Add(5 * time.Second)
+	for !svc.IsRunning() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := svc.Stop(); err != nil {
+		t.Fatalf("Failed to stop service: %v", err)
+	}
+	if _, err := os.Stat(PIDFile); !os.IsNotExist(err) {
+		t.Error("Expected Stop to return after the PID file was removed")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run returned an error: %v", err)
+	}
+}
+
+func TestNewServiceRecoversCorruptDatabase(t *testing.T) {
+	dir := t.TempDir()
+	useTempRuntimeFiles(t, dir)
+	cfg := testConfig(dir)
+
+	// Seed a database and truncate it halfway, like a power loss would
+	db, err := storage.NewDB(cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := make([]*storage.Session, 2000)
+	for i := range sessions {
+		begin := start.Add(time.Duration(i) * time.Minute)
+		sessions[i] = &storage.Session{
+			AppName:         "editor",
+			WindowTitle:     strings.Repeat("x", 200),
+			StartTime:       begin,
+			EndTime:         begin.Add(time.Minute),
+			DurationSeconds: 60,
+		}
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	db.Close()
+	info, err := os.Stat(cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+	if err := os.Truncate(cfg.Database.Path, info.Size()/2); err != nil {
+		t.Fatalf("Failed to truncate database: %v", err)
+	}
+
+	svc, err := NewServiceWithDetector(cfg, &fakeDetector{})
+	if err != nil {
+		t.Fatalf("Expected the daemon to recover, got %v", err)
+	}
+	defer svc.db.Close()
+
+	moved, _ := filepath.Glob(cfg.Database.Path + ".corrupt-*")
+	if len(moved) == 0 {
+		t.Error("Expected the corrupted file to be moved aside")
+	}
+
+	salvaged, err := svc.db.GetSessions(&storage.StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read the recovered database: %v", err)
+	}
+	if len(salvaged) == 0 {
+		t.Error("Expected intact sessions to be salvaged")
+	}
+}
+
+func TestNextAutoExport(t *testing.T) {
+	zone := time.FixedZone("CET", 3600)
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2026, 1, 5, 14, 0, 0, 0, zone), time.Date(2026, 1, 6, 0, 5, 0, 0, zone)},
+		// Just after midnight the next export is the following night
+		{time.Date(2026, 1, 6, 0, 1, 0, 0, zone), time.Date(2026, 1, 7, 0, 5, 0, 0, zone)},
+		{time.Date(2026, 12, 31, 23, 59, 0, 0, zone), time.Date(2027, 1, 1, 0, 5, 0, 0, zone)},
+	}
+	for _, tt := range tests {
+		if got := nextAutoExport(tt.now); !got.Equal(tt.want) {
+			t.Errorf("nextAutoExport(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
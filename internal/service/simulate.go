@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/weii/actime/internal/core"
+	"github.com/weii/actime/internal/platform"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSimulationSpeed is how many simulated seconds a simulation plays
+// per real second
+const DefaultSimulationSpeed = 1000
+
+// SimulationScript is the activity a simulation replays
+type SimulationScript struct {
+	// Start is when the simulated activity begins, in local time as
+	// "2006-01-02 15:04"; the current time when empty
+	Start string           `yaml:"start"`
+	Steps []SimulationStep `yaml:"steps"`
+}
+
+// SimulationStep is one stretch of the same activity. A step with no app
+// has no window focused.
+type SimulationStep struct {
+	App   string        `yaml:"app"`
+	Title string        `yaml:"title"`
+	For   time.Duration `yaml:"for"`
+	// Idle means no input during the step: the idle time grows from zero
+	Idle bool `yaml:"idle"`
+	// Locked means the screen is locked during the step
+	Locked bool `yaml:"locked"`
+}
+
+// LoadSimulationScript reads a simulation script
+func LoadSimulationScript(path string) (*SimulationScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	var script SimulationScript
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to parse script: %w", err)
+	}
+	if _, _, err := script.mockSteps(); err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+// Duration returns how long the script's activity lasts
+func (s *SimulationScript) Duration() time.Duration {
+	var total time.Duration
+	for _, step := range s.Steps {
+		total += step.For
+	}
+	return total
+}
+
+// mockSteps expands the script into one detector step per second, the
+// interval the tracker counts in, and returns when the first one is
+func (s *SimulationScript) mockSteps() ([]platform.MockStep, time.Time, error) {
+	start := time.Now().Truncate(time.Second)
+	if s.Start != "" {
+		var err error
+		start, err = time.ParseInLocation("2006-01-02 15:04", s.Start, time.Local)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid start %q (expected YYYY-MM-DD HH:MM): %w", s.Start, err)
+		}
+	}
+	if len(s.Steps) == 0 {
+		return nil, time.Time{}, fmt.Errorf("script has no steps")
+	}
+
+	var steps []platform.MockStep
+	for i, step := range s.Steps {
+		if step.For < time.Second {
+			return nil, time.Time{}, fmt.Errorf("step %d lasts less than a second: set for", i+1)
+		}
+		var window *platform.WindowInfo
+		if step.App != "" {
+			window = &platform.WindowInfo{AppName: step.App, WindowTitle: step.Title}
+		}
+		for elapsed := time.Duration(0); elapsed < step.For; elapsed += time.Second {
+			mock := platform.MockStep{Window: window, Locked: step.Locked}
+			if step.Idle {
+				mock.Idle = elapsed
+			}
+			steps = append(steps, mock)
+		}
+	}
+	return steps, start, nil
+}
+
+// RunSimulation replays script through the real service, tracker and
+// database at speed simulated seconds per real second, writing to the
+// database at dbPath. The configuration supplies the tracking rules;
+// retention and automatic export are off, and the PID, status and log
+// files go to a temporary directory so a running daemon is not disturbed.
+// It returns the number of sessions written.
+func RunSimulation(cfg *core.Config, script *SimulationScript, dbPath string, speed int, verbose bool) (int64, error) {
+	steps, start, err := script.mockSteps()
+	if err != nil {
+		return 0, err
+	}
+	if speed <= 0 {
+		return 0, fmt.Errorf("invalid speed %d", speed)
+	}
+
+	dir, err := os.MkdirTemp("", "actime-simulate-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	pidFile, statusFile := PIDFile, StatusFile
+	PIDFile = filepath.Join(dir, "actime.pid")
+	StatusFile = filepath.Join(dir, "actime.status.json")
+	defer func() { PIDFile, StatusFile = pidFile, statusFile }()
+
+	simulated := *cfg
+	simulated.Database.Path = dbPath
+	simulated.Monitor.CheckInterval = max(time.Second/time.Duration(speed), time.Microsecond)
+	simulated.Retention.Days = 0
+	simulated.Export.Auto.Enabled = false
+	simulated.Logging.File = filepath.Join(dir, "actime.log")
+	simulated.Logging.Level = "warn"
+	if verbose {
+		simulated.Logging.Level = "debug"
+	}
+
+	detector := platform.NewMockDetector(steps, start, time.Second)
+	if err := detector.Initialize(); err != nil {
+		return 0, err
+	}
+	svc, err := NewServiceWithDetector(&simulated, detector)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create service: %w", err)
+	}
+	svc.tracker.UseClock(detector.Now)
+	svc.foreground = true
+
+	// The service stops once the script is played out; its last tick or
+	// so may not have been buffered yet, as when a daemon stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-detector.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := svc.Run(ctx); err != nil {
+		return 0, err
+	}
+	return svc.sessionsFlushed.Load(), nil
+}
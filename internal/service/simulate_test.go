@@ -0,0 +1,126 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+func TestRunSimulationWritesScriptedSessions(t *testing.T) {
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "day.yaml")
+	if err := os.WriteFile(scriptPath, []byte(`
+start: "2026-01-05 09:00"
+steps:
+  - app: editor
+    title: main.go
+    for: 20s
+  - app: firefox
+    title: Inbox
+    for: 10s
+  - locked: true
+    for: 10s
+  - app: editor
+    title: main.go
+    for: 10s
+`), 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	script, err := LoadSimulationScript(scriptPath)
+	if err != nil {
+		t.Fatalf("Failed to load script: %v", err)
+	}
+	dbPath := filepath.Join(dir, "simulated.db")
+	flushed, err := RunSimulation(testConfig(dir), script, dbPath, 200, false)
+	if err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	if flushed == 0 {
+		t.Fatal("Expected sessions to be written")
+	}
+
+	db, err := storage.OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	sessions, err := db.GetSessions(&storage.StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read sessions: %v", err)
+	}
+	// Each session is one row, however often it was buffered and flushed
+	var apps []string
+	for _, session := range sessions {
+		apps = append(apps, session.AppName)
+	}
+	if len(sessions) != 3 || apps[0] != "editor" || apps[1] != "firefox" || apps[2] != "editor" {
+		t.Fatalf("Expected editor, firefox and editor sessions, got %v", apps)
+	}
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	if !sessions[0].StartTime.Equal(start) {
+		t.Errorf("Expected the first session at the script's start %v, got %v", start, sessions[0].StartTime)
+	}
+	if !sessions[1].StartTime.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("Expected firefox on the simulated clock at 09:00:20, got %v", sessions[1].StartTime)
+	}
+	if seconds := sessions[0].DurationSeconds; seconds < 15 || seconds > 20 {
+		t.Errorf("Expected about 20s of editor, got %ds", seconds)
+	}
+
+	// The daily totals match the timeline: 30s of editor and 10s of firefox,
+	// less the last tick or so of each session
+	daily, err := db.GetDailyStats(&storage.StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to read daily stats: %v", err)
+	}
+	totals := make(map[string]int64)
+	for _, stat := range daily {
+		totals[stat.AppName] += stat.TotalSeconds
+	}
+	if len(totals) != 2 || totals["editor"] < 20 || totals["editor"] > 30 || totals["firefox"] < 5 || totals["firefox"] > 10 {
+		t.Errorf("Expected about 30s of editor and 10s of firefox, got %v", totals)
+	}
+	var recorded int64
+	for _, session := range sessions {
+		recorded += session.DurationSeconds
+	}
+	if recorded != totals["editor"]+totals["firefox"] {
+		t.Errorf("Expected the daily totals to add up to the %ds of sessions, got %v", recorded, totals)
+	}
+
+	gaps, err := db.GetGaps(&storage.StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read gaps: %v", err)
+	}
+	if len(gaps) != 1 || gaps[0].Kind != storage.GapLocked || !gaps[0].StartTime.Equal(start.Add(30*time.Second)) {
+		t.Errorf("Expected a locked gap from 09:00:30, got %+v", gaps)
+	}
+}
+
+func TestLoadSimulationScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"no steps", "start: \"2026-01-05 09:00\"\n"},
+		{"step without duration", "steps:\n  - app: editor\n"},
+		{"invalid start", "start: tomorrow\nsteps:\n  - app: editor\n    for: 1m\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "script.yaml")
+			if err := os.WriteFile(path, []byte(tt.script), 0644); err != nil {
+				t.Fatalf("Failed to write script: %v", err)
+			}
+			if _, err := LoadSimulationScript(path); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+const (
+	// StatusInterval is how often the daemon refreshes its status snapshot
+	StatusInterval = 5 * time.Second
+
+	// statusStaleAfter is the age after which a snapshot is ignored
+	statusStaleAfter = 3 * StatusInterval
+)
+
+var (
+	// StatusFile is the path to the status snapshot written by the daemon.
+	// The snapshot holds window titles, so it lives in a directory of the
+	// user's own rather than the shared temporary directory.
+	StatusFile = filepath.Join(statusDir(), "actime.status.json")
+)
+
+// statusDir returns the per-user directory of the status snapshot:
+// $XDG_RUNTIME_DIR when set, otherwise ~/.actime
+func statusDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".actime")
+	}
+	return os.TempDir()
+}
+
+// Snapshot is the daemon's view of its own state, written to StatusFile
+type Snapshot struct {
+	PID          int             `json:"pid"`
+	StartedAt    time.Time       `json:"started_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Foreground   bool            `json:"foreground,omitempty"`
+	Current      *CurrentSession `json:"current,omitempty"`
+	TodaySeconds int64           `json:"today_seconds"`
+	Buffer       BufferStatus    `json:"buffer"`
+	Detector     DetectorStatus  `json:"detector"`
+	Counters     Counters        `json:"counters"`
+
+	// Sessions are the sessions not yet written to the database, including
+	// the current one
+	Sessions []LiveSession `json:"sessions,omitempty"`
+}
+
+// LiveSession is a session held in the daemon's memory
+type LiveSession struct {
+	App             string    `json:"app"`
+	Title           string    `json:"title"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	MonitorIndex    *int      `json:"monitor_index,omitempty"`
+}
+
+// CurrentSession describes the session the tracker is recording right now
+type CurrentSession struct {
+	App             string    `json:"app"`
+	Title           string    `json:"title"`
+	Since           time.Time `json:"since"`
+	DurationSeconds int64     `json:"duration_seconds"`
+}
+
+// BufferStatus describes the sessions waiting to be written to the database
+type BufferStatus struct {
+	PendingSessions int        `json:"pending_sessions"`
+	LastFlushAt     *time.Time `json:"last_flush_at,omitempty"`
+	LastFlushError  string     `json:"last_flush_error,omitempty"`
+	// DeadLetters is the number of sessions in the dead-letter file, as
+	// counted when the daemon started plus those it added since
+	DeadLetters int `json:"dead_letters,omitempty"`
+}
+
+// DetectorStatus describes the platform detector used by the tracker
+type DetectorStatus struct {
+	Type        string `json:"type"`
+	ErrorsTotal int64  `json:"errors_total"`
+	// SessionState is the login session state for detectors that follow
+	// it, such as the Windows one
+	SessionState string `json:"session_state,omitempty"`
+	// Members are the detectors of a composed detector in priority order
+	Members []DetectorMember `json:"members,omitempty"`
+}
+
+// Counters are running totals kept by the daemon since it started. They
+// only grow and are reset by a restart, which Since tells apart from a
+// quiet day. The names follow the Prometheus conventions.
+type Counters struct {
+	Since                   time.Time        `json:"since"`
+	TicksTotal              int64            `json:"ticks_total"`
+	DetectorErrorsTotal     map[string]int64 `json:"detector_errors_total"`
+	SessionsStartedTotal    int64            `json:"sessions_started_total"`
+	SessionsEndedTotal      int64            `json:"sessions_ended_total"`
+	PausesTotal             map[string]int64 `json:"pauses_total"`
+	DetectorReconnectsTotal int64            `json:"detector_reconnects_total"`
+	SessionsFlushedTotal    int64            `json:"sessions_flushed_total"`
+	FlushErrorsTotal        int64            `json:"flush_errors_total"`
+	DeadLettersTotal        int64            `json:"dead_letters_total"`
+	LastDetectorOKAt        *time.Time       `json:"last_detector_ok_at,omitempty"`
+}
+
+// DetectorMember describes one detector of a composed detector
+type DetectorMember struct {
+	Name      string     `json:"name"`
+	Healthy   bool       `json:"healthy"`
+	Failures  int64      `json:"failures"`
+	LastError string     `json:"last_error,omitempty"`
+	LastOKAt  *time.Time `json:"last_ok_at,omitempty"`
+}
+
+// Status is the machine-readable output of `actimed status --json`.
+// Fields that only the daemon can provide are omitted when Reachable is false.
+type Status struct {
+	Running       bool            `json:"running"`
+	Reachable     bool            `json:"reachable"`
+	PID           int             `json:"pid,omitempty"`
+	UptimeSeconds int64           `json:"uptime_seconds,omitempty"`
+	Foreground    bool            `json:"foreground,omitempty"`
+	Version       string          `json:"version"`
+	Current       *CurrentSession `json:"current,omitempty"`
+	TodaySeconds  *int64          `json:"today_seconds,omitempty"`
+	Buffer        *BufferStatus   `json:"buffer,omitempty"`
+	Detector      *DetectorStatus `json:"detector,omitempty"`
+	Counters      *Counters       `json:"counters,omitempty"`
+}
+
+// HealthCheck is the result of a single `actimed health` check
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Pass    bool   `json:"pass"`
+	Message string `json:"message"`
+}
+
+// Health is the machine-readable output of `actimed health --json`
+type Health struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// WriteSnapshot atomically replaces the status file with the snapshot. The
+// file is readable by its owner only, and is staged under a random name so
+// nobody can plant the temporary file in advance.
+func WriteSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode status snapshot: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create status directory: %w", err)
+	}
+	// CreateTemp creates the file with mode 0600
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write status snapshot: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write status snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace status snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// ReadSnapshot reads the status snapshot written by the daemon
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode status snapshot: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+// ErrDaemonUnreachable is returned by ReadLiveSessions and
+// ReadCurrentSession when no running daemon has published a fresh snapshot
+var ErrDaemonUnreachable = errors.New("daemon is not reachable")
+
+// ReadLiveSessions returns the sessions the running daemon has not written
+// to the database yet, as published in its status snapshot
+func ReadLiveSessions(now time.Time) ([]*storage.Session, error) {
+	snapshot, err := readLiveSnapshot(now)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*storage.Session, 0, len(snapshot.Sessions))
+	for _, live := range snapshot.Sessions {
+		sessions = append(sessions, &storage.Session{
+			AppName:         live.App,
+			WindowTitle:     live.Title,
+			StartTime:       live.Start,
+			EndTime:         live.End,
+			DurationSeconds: live.DurationSeconds,
+			MonitorIndex:    live.MonitorIndex,
+		})
+	}
+
+	return sessions, nil
+}
+
+// ReadCurrentSession returns the session the running daemon is recording
+// right now, or nil when it is paused or idle
+func ReadCurrentSession(now time.Time) (*CurrentSession, error) {
+	snapshot, err := readLiveSnapshot(now)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Current, nil
+}
+
+// readLiveSnapshot reads the snapshot of the running daemon, as long as it
+// belongs to the PID in the PID file and is fresh
+func readLiveSnapshot(now time.Time) (*Snapshot, error) {
+	pid, err := ReadPIDFile(PIDFile)
+	if err != nil || !IsProcessRunning(pid) {
+		return nil, ErrDaemonUnreachable
+	}
+
+	snapshot, err := ReadSnapshot(StatusFile)
+	if err != nil || snapshot.PID != pid || now.Sub(snapshot.UpdatedAt) > statusStaleAfter {
+		return nil, ErrDaemonUnreachable
+	}
+	return snapshot, nil
+}
+
+// BuildStatus combines PID file information with the daemon's snapshot.
+// A snapshot is only trusted when it belongs to the running PID and is fresh;
+// otherwise the daemon is reported as unreachable.
+func BuildStatus(version string, running bool, pid int, snapshot *Snapshot, now time.Time) *Status {
+	status := &Status{
+		Running: running,
+		Version: version,
+	}
+	if running {
+		status.PID = pid
+	}
+
+	if !running || snapshot == nil || snapshot.PID != pid || now.Sub(snapshot.UpdatedAt) > statusStaleAfter {
+		return status
+	}
+
+	status.Reachable = true
+	status.UptimeSeconds = int64(now.Sub(snapshot.StartedAt).Seconds())
+	status.Foreground = snapshot.Foreground
+	status.Current = snapshot.Current
+	todaySeconds := snapshot.TodaySeconds
+	status.TodaySeconds = &todaySeconds
+	buffer := snapshot.Buffer
+	status.Buffer = &buffer
+	detector := snapshot.Detector
+	status.Detector = &detector
+	counters := snapshot.Counters
+	status.Counters = &counters
+
+	return status
+}
+
+// CheckHealth runs the health checks over a status built by BuildStatus
+func CheckHealth(status *Status) *Health {
+	health := &Health{Healthy: true}
+
+	add := func(name string, pass bool, message string) {
+		health.Checks = append(health.Checks, HealthCheck{Name: name, Pass: pass, Message: message})
+		if !pass {
+			health.Healthy = false
+		}
+	}
+
+	if status.Running {
+		add("process", true, fmt.Sprintf("daemon is running (PID: %d)", status.PID))
+	} else {
+		add("process", false, "daemon is not running; start it with 'actimed start'")
+	}
+
+	if status.Reachable {
+		add("status", true, "daemon is publishing its status")
+	} else {
+		add("status", false, "no recent status snapshot from the daemon; check 'actimed log'")
+	}
+
+	if status.Buffer != nil {
+		if status.Buffer.LastFlushError != "" {
+			add("flush", false, "last flush failed: "+status.Buffer.LastFlushError)
+		} else {
+			add("flush", true, "sessions are being written to the database")
+		}
+	}
+
+	return health
+}
+
+// detectorType returns a short name for a detector implementation
+func detectorType(detector interface{}) string {
+	name := fmt.Sprintf("%T", detector)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "Detector")
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var statusNow = time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+
+func testSnapshot() *Snapshot {
+	lastFlush := statusNow.Add(-30 * time.Second)
+	return &Snapshot{
+		PID:       4242,
+		StartedAt: statusNow.Add(-2 * time.Hour),
+		UpdatedAt: statusNow.Add(-2 * time.Second),
+		Current: &CurrentSession{
+			App:             "code",
+			Title:           "main.go",
+			Since:           statusNow.Add(-5 * time.Minute),
+			DurationSeconds: 300,
+		},
+		TodaySeconds: 7200,
+		Buffer: BufferStatus{
+			PendingSessions: 3,
+			LastFlushAt:     &lastFlush,
+		},
+		Detector: DetectorStatus{
+			Type:        "X11",
+			ErrorsTotal: 1,
+		},
+		Counters: Counters{
+			Since:                statusNow.Add(-2 * time.Hour),
+			TicksTotal:           7200,
+			DetectorErrorsTotal:  map[string]int64{"idle": 0, "lock": 1, "window": 0},
+			SessionsStartedTotal: 40,
+			SessionsEndedTotal:   39,
+			PausesTotal:          map[string]int64{"idle": 2, "locked": 1},
+			SessionsFlushedTotal: 36,
+			LastDetectorOKAt:     &lastFlush,
+		},
+	}
+}
+
+func encode(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	return string(data)
+}
+
+func TestBuildStatusReachable(t *testing.T) {
+	status := BuildStatus("0.1.0", true, 4242, testSnapshot(), statusNow)
+
+	want := `{"running":true,"reachable":true,"pid":4242,"uptime_seconds":7200,"version":"0.1.0",` +
+		`"current":{"app":"code","title":"main.go","since":"2026-01-05T11:55:00Z","duration_seconds":300},` +
+		`"today_seconds":7200,` +
+		`"buffer":{"pending_sessions":3,"last_flush_at":"2026-01-05T11:59:30Z"},` +
+		`"detector":{"type":"X11","errors_total":1},` +
+		`"counters":{"since":"2026-01-05T10:00:00Z","ticks_total":7200,"detector_errors_total":{"idle":0,"lock":1,"window":0},` +
+		`"sessions_started_total":40,"sessions_ended_total":39,"pauses_total":{"idle":2,"locked":1},"detector_reconnects_total":0,` +
+		`"sessions_flushed_total":36,"flush_errors_total":0,"dead_letters_total":0,"last_detector_ok_at":"2026-01-05T11:59:30Z"}}`
+	if got := encode(t, status); got != want {
+		t.Errorf("Unexpected status JSON:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestBuildStatusUnreachable(t *testing.T) {
+	stale := testSnapshot()
+	stale.UpdatedAt = statusNow.Add(-time.Hour)
+
+	otherPID := testSnapshot()
+	otherPID.PID = 1
+
+	tests := []struct {
+		name     string
+		running  bool
+		snapshot *Snapshot
+		want     string
+	}{
+		{
+			name:    "no snapshot",
+			running: true,
+			want:    `{"running":true,"reachable":false,"pid":4242,"version":"0.1.0"}`,
+		},
+		{
+			name:     "stale snapshot",
+			running:  true,
+			snapshot: stale,
+			want:     `{"running":true,"reachable":false,"pid":4242,"version":"0.1.0"}`,
+		},
+		{
+			name:     "snapshot from another process",
+			running:  true,
+			snapshot: otherPID,
+			want:     `{"running":true,"reachable":false,"pid":4242,"version":"0.1.0"}`,
+		},
+		{
+			name:     "stopped",
+			running:  false,
+			snapshot: testSnapshot(),
+			want:     `{"running":false,"reachable":false,"version":"0.1.0"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := BuildStatus("0.1.0", tt.running, 4242, tt.snapshot, statusNow)
+			if got := encode(t, status); got != tt.want {
+				t.Errorf("Unexpected status JSON:\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildStatusIdleDaemon(t *testing.T) {
+	snapshot := testSnapshot()
+	snapshot.Current = nil
+	snapshot.TodaySeconds = 0
+
+	status := BuildStatus("0.1.0", true, 4242, snapshot, statusNow)
+	got := encode(t, status)
+
+	// A paused daemon has no current session, but today's total is still
+	// reported even when it is zero
+	want := `{"running":true,"reachable":true,"pid":4242,"uptime_seconds":7200,"version":"0.1.0",` +
+		`"today_seconds":0,` +
+		`"buffer":{"pending_sessions":3,"last_flush_at":"2026-01-05T11:59:30Z"},` +
+		`"detector":{"type":"X11","errors_total":1},` +
+		`"counters":{"since":"2026-01-05T10:00:00Z","ticks_total":7200,"detector_errors_total":{"idle":0,"lock":1,"window":0},` +
+		`"sessions_started_total":40,"sessions_ended_total":39,"pauses_total":{"idle":2,"locked":1},"detector_reconnects_total":0,` +
+		`"sessions_flushed_total":36,"flush_errors_total":0,"dead_letters_total":0,"last_detector_ok_at":"2026-01-05T11:59:30Z"}}`
+	if got != want {
+		t.Errorf("Unexpected status JSON:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	failing := testSnapshot()
+	failing.Buffer.LastFlushError = "database is locked"
+
+	tests := []struct {
+		name    string
+		status  *Status
+		healthy bool
+		checks  string
+	}{
+		{
+			name:    "healthy",
+			status:  BuildStatus("0.1.0", true, 4242, testSnapshot(), statusNow),
+			healthy: true,
+			checks:  "process:true status:true flush:true ",
+		},
+		{
+			name:    "flush error",
+			status:  BuildStatus("0.1.0", true, 4242, failing, statusNow),
+			healthy: false,
+			checks:  "process:true status:true flush:false ",
+		},
+		{
+			name:    "stopped",
+			status:  BuildStatus("0.1.0", false, 0, nil, statusNow),
+			healthy: false,
+			checks:  "process:false status:false ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := CheckHealth(tt.status)
+			if health.Healthy != tt.healthy {
+				t.Errorf("Expected healthy=%v, got %v", tt.healthy, health.Healthy)
+			}
+
+			checks := ""
+			for _, check := range health.Checks {
+				if check.Message == "" {
+					t.Errorf("Expected check %s to have a message", check.Name)
+				}
+				checks += check.Name + ":" + map[bool]string{true: "true", false: "false"}[check.Pass] + " "
+			}
+			if checks != tt.checks {
+				t.Errorf("Expected checks %q, got %q", tt.checks, checks)
+			}
+		})
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+
+	if err := WriteSnapshot(path, testSnapshot()); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	snapshot, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+
+	if encode(t, snapshot) != encode(t, testSnapshot()) {
+		t.Errorf("Snapshot changed in a round trip:\ngot:  %s\nwant: %s", encode(t, snapshot), encode(t, testSnapshot()))
+	}
+}
+
+func TestWriteSnapshotIsPrivate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status.json")
+
+	// A file left by an older version is replaced, not written through
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write old snapshot: %v", err)
+	}
+	if err := WriteSnapshot(path, testSnapshot()); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat snapshot: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("Expected no staging file left, got %v", matches)
+	}
+}
@@ -1,12 +1,9 @@
-//go:build linux || windows
+//go:build linux || windows || darwin
 
 package service
 
 import (
 	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/kardianos/service"
 	"github.com/weii/actime/internal/config"
@@ -131,42 +128,3 @@ func RunService() error {
 
 	return nil
 }
-
-// RunForeground runs the Actime in foreground mode
-func RunForeground() error {
-	fmt.Println("Running Actime in foreground mode...")
-	fmt.Println("Press Ctrl+C to stop")
-
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Load configuration
-	cfg, err := config.Load(config.DefaultConfigPath)
-	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
-	}
-
-	// Create service
-	svc, err := NewService(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to create service: %w", err)
-	}
-
-	// Start service
-	if err := svc.Start(); err != nil {
-		return fmt.Errorf("failed to start service: %w", err)
-	}
-
-	// Wait for shutdown signal
-	<-sigChan
-	fmt.Println("\nReceived shutdown signal")
-
-	// Stop service
-	if err := svc.Stop(); err != nil {
-		return fmt.Errorf("failed to stop service: %w", err)
-	}
-
-	fmt.Println("Actime stopped")
-	return nil
-}
\ No newline at end of file
@@ -0,0 +1,97 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// Break is a gap between two sessions on the same day
+type Break struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns the length of the break
+func (b Break) Duration() time.Duration {
+	return b.End.Sub(b.Start)
+}
+
+// BreakSummary describes how tracked time was split by breaks
+type BreakSummary struct {
+	Breaks []Break
+	// TotalBreakSeconds is the combined length of all breaks
+	TotalBreakSeconds int64
+	// LongestFocusSeconds is the longest stretch of activity without a break
+	LongestFocusSeconds int64
+	// FocusStretches is the number of stretches of activity between breaks
+	FocusStretches int
+}
+
+// BreakAnalysis finds the gaps of at least minBreak between sessions in the
+// query range. Gaps that span midnight are not counted as breaks, so every
+// day starts a new stretch of activity.
+//
+//	summary, err := stats.BreakAnalysis(db, &storage.StatsQuery{StartDate: day, EndDate: day}, 5*time.Minute)
+//	fmt.Println(len(summary.Breaks), summary.LongestFocusSeconds)
+func BreakAnalysis(r SessionReader, query *storage.StatsQuery, minBreak time.Duration) (*BreakSummary, error) {
+	sessions, err := r.GetSessions(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	return findBreaks(sessions, minBreak), nil
+}
+
+// findBreaks walks the sessions in start order and splits them into
+// stretches of activity at every gap of at least minBreak
+func findBreaks(sessions []*storage.Session, minBreak time.Duration) *BreakSummary {
+	sorted := make([]*storage.Session, len(sessions))
+	copy(sorted, sessions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	summary := &BreakSummary{}
+	var stretchStart, stretchEnd time.Time
+	closeStretch := func() {
+		if stretchEnd.IsZero() {
+			return
+		}
+		summary.FocusStretches++
+		if seconds := int64(stretchEnd.Sub(stretchStart).Seconds()); seconds > summary.LongestFocusSeconds {
+			summary.LongestFocusSeconds = seconds
+		}
+	}
+
+	for _, session := range sorted {
+		start := session.StartTime.In(time.Local)
+		end := start.Add(time.Duration(session.DurationSeconds) * time.Second)
+
+		newStretch := stretchEnd.IsZero()
+		if !newStretch && !sameDay(stretchEnd, start) {
+			closeStretch()
+			newStretch = true
+		} else if !newStretch && start.Sub(stretchEnd) >= minBreak {
+			closeStretch()
+			summary.Breaks = append(summary.Breaks, Break{Start: stretchEnd, End: start})
+			summary.TotalBreakSeconds += int64(start.Sub(stretchEnd).Seconds())
+			newStretch = true
+		}
+
+		if newStretch {
+			stretchStart, stretchEnd = start, end
+		} else if end.After(stretchEnd) {
+			stretchEnd = end
+		}
+	}
+	closeStretch()
+
+	return summary
+}
+
+// sameDay reports whether a and b fall on the same local calendar day
+func sameDay(a, b time.Time) bool {
+	return localDay(a).Equal(localDay(b))
+}
@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+)
+
+// Delta is the change of one application's time between two ranges
+type Delta struct {
+	AppName string
+	Before  int64
+	After   int64
+	Change  int64
+	// Percent is the relative change; it is zero when Before is zero
+	Percent float64
+}
+
+// Compare matches two sets of totals by application and returns the change
+// for every application present in either set. The largest absolute changes
+// come first, ties ordered by name.
+//
+//	lastWeek, _ := stats.AppTotals(db, previous)
+//	thisWeek, _ := stats.AppTotals(db, current)
+//	for _, d := range stats.Compare(lastWeek, thisWeek) {
+//		fmt.Printf("%s %+d\n", d.AppName, d.Change)
+//	}
+func Compare(before, after []AppTotal) []Delta {
+	// Match applications case-insensitively, as SumByApp groups them
+	deltas := make(map[string]*Delta)
+	get := func(app string) *Delta {
+		key := strings.ToLower(app)
+		d, ok := deltas[key]
+		if !ok {
+			d = &Delta{AppName: app}
+			deltas[key] = d
+		}
+		if app < d.AppName {
+			d.AppName = app
+		}
+		return d
+	}
+
+	for _, total := range before {
+		get(total.AppName).Before += total.TotalSeconds
+	}
+	for _, total := range after {
+		get(total.AppName).After += total.TotalSeconds
+	}
+
+	result := make([]Delta, 0, len(deltas))
+	for _, d := range deltas {
+		d.Change = d.After - d.Before
+		if d.Before > 0 {
+			d.Percent = float64(d.Change) / float64(d.Before) * 100
+		}
+		result = append(result, *d)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		ci, cj := abs(result[i].Change), abs(result[j].Change)
+		if ci != cj {
+			return ci > cj
+		}
+		return lessApp(result[i].AppName, result[j].AppName)
+	})
+
+	return result
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
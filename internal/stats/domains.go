@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// DomainTotal is the time one application spent on one site
+type DomainTotal struct {
+	AppName string
+	Domain  string
+	Seconds int64
+}
+
+// DomainTotals sums the tracked time of browser sessions per application
+// and site. Applications come largest total first, and the sites of each
+// largest first; ties are broken by name. Sessions without a domain are
+// left out. Names that differ only in case are one application or site.
+func DomainTotals(sessions []*storage.Session) []DomainTotal {
+	type key struct{ app, domain string }
+	totals := make(map[key]*DomainTotal)
+	appSeconds := make(map[string]int64)
+	names := make(map[string]string)
+	for _, session := range sessions {
+		if session.Domain == "" || session.DurationSeconds <= 0 {
+			continue
+		}
+		name := appname.Clean(session.AppName)
+		k := key{strings.ToLower(name), strings.ToLower(session.Domain)}
+		if current, ok := names[k.app]; !ok || name < current {
+			names[k.app] = name
+		}
+		total, ok := totals[k]
+		if !ok {
+			total = &DomainTotal{Domain: session.Domain}
+			totals[k] = total
+		}
+		if session.Domain < total.Domain {
+			total.Domain = session.Domain
+		}
+		total.Seconds += session.DurationSeconds
+		appSeconds[k.app] += session.DurationSeconds
+	}
+
+	result := make([]DomainTotal, 0, len(totals))
+	for k, total := range totals {
+		total.AppName = names[k.app]
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := strings.ToLower(result[i].AppName), strings.ToLower(result[j].AppName)
+		if a != b {
+			if appSeconds[a] != appSeconds[b] {
+				return appSeconds[a] > appSeconds[b]
+			}
+			return lessApp(result[i].AppName, result[j].AppName)
+		}
+		if result[i].Seconds != result[j].Seconds {
+			return result[i].Seconds > result[j].Seconds
+		}
+		return strings.ToLower(result[i].Domain) < strings.ToLower(result[j].Domain)
+	})
+	return result
+}
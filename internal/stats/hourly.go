@@ -0,0 +1,209 @@
+// Package stats computes aggregates over tracked sessions and daily statistics
+package stats
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// HourBucket holds the time recorded in one hour-of-day slot over a range
+type HourBucket struct {
+	Hour        int
+	Seconds     int64
+	Occurrences int
+}
+
+// Average returns the seconds per occurrence of the hour in the range
+func (b HourBucket) Average() float64 {
+	if b.Occurrences == 0 {
+		return 0
+	}
+	return float64(b.Seconds) / float64(b.Occurrences)
+}
+
+// HourOfDay distributes session time over the 24 hours of the day for the
+// inclusive day range [start, end]. Sessions crossing an hour boundary are
+// split between the hours they cover. Occurrences counts how often each hour
+// has started within the range, so hours later than now on the current day
+// are not counted and averages are not diluted by time that has not happened.
+func HourOfDay(sessions []*storage.Session, start, end, now time.Time) [24]HourBucket {
+	var buckets [24]HourBucket
+	for hour := range buckets {
+		buckets[hour].Hour = hour
+	}
+
+	from, to := rangeBounds(start, end)
+	for _, session := range sessions {
+		splitByHour(session, from, to, func(slot time.Time, seconds int64) {
+			buckets[slot.Hour()].Seconds += seconds
+		})
+	}
+
+	forEachHourSlot(from, to, now, func(slot time.Time) {
+		buckets[slot.Hour()].Occurrences++
+	})
+
+	return buckets
+}
+
+// HourOfDayStats is HourOfDay over hourly statistics instead of sessions,
+// which spares reading every session of a long range
+func HourOfDayStats(rows []*storage.HourlyStats, start, end, now time.Time) [24]HourBucket {
+	var buckets [24]HourBucket
+	for hour := range buckets {
+		buckets[hour].Hour = hour
+	}
+
+	first, last := dateOf(start), dateOf(end)
+	for _, row := range rows {
+		date := dateOf(row.Date)
+		if date.Before(first) || date.After(last) || row.Hour < 0 || row.Hour >= 24 {
+			continue
+		}
+		buckets[row.Hour].Seconds += row.TotalSeconds
+	}
+
+	from, to := rangeBounds(start, end)
+	forEachHourSlot(from, to, now, func(slot time.Time) {
+		buckets[slot.Hour()].Occurrences++
+	})
+
+	return buckets
+}
+
+// WeekdayHour is like HourOfDay but keeps a separate set of hours for every
+// weekday, indexed by time.Weekday. Weekdays occur a different number of
+// times in most ranges, which the per-bucket Occurrences account for.
+func WeekdayHour(sessions []*storage.Session, start, end, now time.Time) [7][24]HourBucket {
+	var buckets [7][24]HourBucket
+	for weekday := range buckets {
+		for hour := range buckets[weekday] {
+			buckets[weekday][hour].Hour = hour
+		}
+	}
+
+	from, to := rangeBounds(start, end)
+	for _, session := range sessions {
+		splitByHour(session, from, to, func(slot time.Time, seconds int64) {
+			buckets[slot.Weekday()][slot.Hour()].Seconds += seconds
+		})
+	}
+
+	forEachHourSlot(from, to, now, func(slot time.Time) {
+		buckets[slot.Weekday()][slot.Hour()].Occurrences++
+	})
+
+	return buckets
+}
+
+// AppHour is the time one application was used in one hour of one day
+type AppHour struct {
+	Date    time.Time
+	Hour    int
+	AppName string
+	Seconds int64
+}
+
+// HourlyByApp splits sessions into the hours of the inclusive day range
+// [start, end] the same way HourlyMatrix does, keeping applications apart.
+// Application names are cleaned and matched case-insensitively; with
+// mergeApps all applications share one row per hour and AppName is empty.
+// Only hours with time are returned, ordered by date, hour and application.
+func HourlyByApp(sessions []*storage.Session, start, end time.Time, mergeApps bool) []AppHour {
+	type cell struct {
+		date time.Time
+		hour int
+		app  string
+	}
+
+	from, to := rangeBounds(start, end)
+	names := make(map[string]string)
+	seconds := make(map[cell]int64)
+	for _, session := range sessions {
+		key := ""
+		if !mergeApps {
+			name := appname.Clean(session.AppName)
+			key = strings.ToLower(name)
+			if _, ok := names[key]; !ok {
+				names[key] = name
+			}
+		}
+		splitByHour(session, from, to, func(slot time.Time, n int64) {
+			seconds[cell{dateOf(slot), slot.Hour(), key}] += n
+		})
+	}
+
+	rows := make([]AppHour, 0, len(seconds))
+	for c, n := range seconds {
+		if n == 0 {
+			continue
+		}
+		rows = append(rows, AppHour{Date: c.date, Hour: c.hour, AppName: names[c.app], Seconds: n})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Hour != b.Hour {
+			return a.Hour < b.Hour
+		}
+		return strings.ToLower(a.AppName) < strings.ToLower(b.AppName)
+	})
+	return rows
+}
+
+// rangeBounds converts an inclusive day range into local [from, to) instants
+func rangeBounds(start, end time.Time) (time.Time, time.Time) {
+	return localDay(start), localDay(end).AddDate(0, 0, 1)
+}
+
+// localDay returns local midnight of the calendar day of t
+func localDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// splitByHour calls fn for every hour slot the session covers within
+// [from, to). The session is taken to last DurationSeconds from its start,
+// which is the time that was actually counted as active.
+func splitByHour(session *storage.Session, from, to time.Time, fn func(slot time.Time, seconds int64)) {
+	cursor := session.StartTime.In(time.Local)
+	sessionEnd := cursor.Add(time.Duration(session.DurationSeconds) * time.Second)
+	if cursor.Before(from) {
+		cursor = from
+	}
+	if sessionEnd.After(to) {
+		sessionEnd = to
+	}
+
+	for cursor.Before(sessionEnd) {
+		y, m, d := cursor.Date()
+		slot := time.Date(y, m, d, cursor.Hour(), 0, 0, 0, cursor.Location())
+		next := slot.Add(time.Hour)
+		if next.After(sessionEnd) {
+			next = sessionEnd
+		}
+		fn(cursor, int64(next.Sub(cursor).Seconds()))
+		cursor = next
+	}
+}
+
+// forEachHourSlot calls fn with the start of every hour in [from, to) that
+// is not after now
+func forEachHourSlot(from, to, now time.Time, fn func(slot time.Time)) {
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		y, m, d := day.Date()
+		for hour := 0; hour < 24; hour++ {
+			slot := time.Date(y, m, d, hour, 0, 0, 0, time.Local)
+			if slot.After(now) {
+				return
+			}
+			fn(slot)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+func at(day string, hour, minute int) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func sessionAt(app string, start time.Time, seconds int64) *storage.Session {
+	return &storage.Session{
+		AppName:         app,
+		StartTime:       start,
+		EndTime:         start.Add(time.Duration(seconds) * time.Second),
+		DurationSeconds: seconds,
+	}
+}
+
+func TestHourOfDaySplitsAcrossHours(t *testing.T) {
+	sessions := []*storage.Session{
+		// 09:40 - 10:20 contributes 20 minutes to each hour
+		sessionAt("editor", at("2026-01-05", 9, 40), 40*60),
+	}
+
+	start := at("2026-01-05", 0, 0)
+	buckets := HourOfDay(sessions, start, start, at("2026-01-06", 0, 0))
+
+	if buckets[9].Seconds != 20*60 || buckets[10].Seconds != 20*60 {
+		t.Errorf("Expected 1200s in hours 9 and 10, got %d and %d", buckets[9].Seconds, buckets[10].Seconds)
+	}
+	for hour, bucket := range buckets {
+		if bucket.Hour != hour {
+			t.Errorf("Expected bucket %d to report hour %d, got %d", hour, hour, bucket.Hour)
+		}
+		if bucket.Occurrences != 1 {
+			t.Errorf("Expected hour %d to occur once, got %d", hour, bucket.Occurrences)
+		}
+	}
+}
+
+func TestHourOfDayClipsToRange(t *testing.T) {
+	sessions := []*storage.Session{
+		// 23:30 on the 4th to 00:30 on the 5th, only the second half is in range
+		sessionAt("editor", at("2026-01-04", 23, 30), 3600),
+	}
+
+	start := at("2026-01-05", 0, 0)
+	buckets := HourOfDay(sessions, start, start, at("2026-01-06", 0, 0))
+
+	if buckets[23].Seconds != 0 {
+		t.Errorf("Expected nothing before the range, got %d", buckets[23].Seconds)
+	}
+	if buckets[0].Seconds != 1800 {
+		t.Errorf("Expected 1800s in hour 0, got %d", buckets[0].Seconds)
+	}
+}
+
+func TestHourOfDayAverageWithPartialDay(t *testing.T) {
+	sessions := []*storage.Session{
+		sessionAt("editor", at("2026-01-05", 9, 0), 3600),
+		sessionAt("editor", at("2026-01-06", 9, 0), 1800),
+		sessionAt("editor", at("2026-01-07", 9, 0), 600),
+		sessionAt("editor", at("2026-01-05", 15, 0), 3600),
+		sessionAt("editor", at("2026-01-06", 15, 0), 3600),
+	}
+
+	// It is 12:00 on the last day, so hour 9 occurred three times but
+	// hour 15 only twice
+	start := at("2026-01-05", 0, 0)
+	end := at("2026-01-07", 0, 0)
+	buckets := HourOfDay(sessions, start, end, at("2026-01-07", 12, 0))
+
+	if buckets[9].Occurrences != 3 || buckets[15].Occurrences != 2 {
+		t.Fatalf("Expected 3 and 2 occurrences, got %d and %d", buckets[9].Occurrences, buckets[15].Occurrences)
+	}
+	if got := buckets[9].Average(); got != 2000 {
+		t.Errorf("Expected an average of 2000s at 09:00, got %v", got)
+	}
+	if got := buckets[15].Average(); got != 3600 {
+		t.Errorf("Expected an average of 3600s at 15:00, got %v", got)
+	}
+	if got := buckets[20].Average(); got != 0 {
+		t.Errorf("Expected an empty hour to average 0, got %v", got)
+	}
+}
+
+func TestWeekdayHourUnequalDayCounts(t *testing.T) {
+	// Monday 2026-01-05 through Monday 2026-01-12: two Mondays, one of
+	// every other weekday
+	sessions := []*storage.Session{
+		sessionAt("editor", at("2026-01-05", 10, 0), 3600),
+		sessionAt("editor", at("2026-01-12", 10, 0), 1200),
+		sessionAt("editor", at("2026-01-06", 10, 0), 600),
+	}
+
+	start := at("2026-01-05", 0, 0)
+	end := at("2026-01-12", 0, 0)
+	buckets := WeekdayHour(sessions, start, end, at("2026-02-01", 0, 0))
+
+	monday := buckets[time.Monday][10]
+	if monday.Occurrences != 2 {
+		t.Fatalf("Expected Monday 10:00 to occur twice, got %d", monday.Occurrences)
+	}
+	if monday.Average() != 2400 {
+		t.Errorf("Expected Monday 10:00 to average 2400s, got %v", monday.Average())
+	}
+
+	tuesday := buckets[time.Tuesday][10]
+	if tuesday.Occurrences != 1 || tuesday.Average() != 600 {
+		t.Errorf("Expected Tuesday 10:00 to average 600s over 1 occurrence, got %v over %d",
+			tuesday.Average(), tuesday.Occurrences)
+	}
+}
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// DefaultLaunchGap is the break after which returning to the same app
+// counts as a new launch
+const DefaultLaunchGap = 5 * time.Minute
+
+// AppLaunches is how often an app was launched on one day
+type AppLaunches struct {
+	AppName string
+	Date    time.Time
+	Count   int
+}
+
+// Launches counts how often each app was brought to the front per day, a
+// proxy for how often it pulled attention. Switching to an app from a
+// different one is a launch. Coming back to the same app is only a launch
+// when tracking stopped for at least minGap in between, as it does while
+// the screen is locked or the user is idle; shorter pauses continue the
+// previous launch. A launch belongs to the day it starts on.
+//
+// sessions must be sorted by start time, as MergeSessions returns them.
+func Launches(sessions []*storage.Session, minGap time.Duration) []*AppLaunches {
+	type appDay struct {
+		app  string
+		date string
+	}
+
+	var launches []*AppLaunches
+	index := make(map[appDay]*AppLaunches)
+	for _, session := range CoalesceSessions(sessions, minGap, false) {
+		name := appname.Clean(session.AppName)
+		date := session.StartTime.Format(storage.DateLayout)
+		key := appDay{strings.ToLower(name), date}
+		launch, ok := index[key]
+		if !ok {
+			day, _ := time.Parse(storage.DateLayout, date)
+			launch = &AppLaunches{AppName: name, Date: day}
+			index[key] = launch
+			launches = append(launches, launch)
+		}
+		launch.Count++
+	}
+	return launches
+}
+
+// LaunchesByApp adds up launches per app over all days, keyed by the
+// lower-case app name
+func LaunchesByApp(launches []*AppLaunches) map[string]int {
+	totals := make(map[string]int)
+	for _, launch := range launches {
+		totals[strings.ToLower(launch.AppName)] += launch.Count
+	}
+	return totals
+}
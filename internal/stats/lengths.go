@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// SessionLength summarizes how long the sessions of one application were.
+// Lengths are in seconds.
+type SessionLength struct {
+	AppName string
+	Count   int
+	Total   int64
+	Mean    float64
+	Median  float64
+	P90     float64
+	Max     int64
+}
+
+// SessionLengthOptions controls SessionLengthStats
+type SessionLengthOptions struct {
+	// Coalesce merges sessions of one app that follow each other with less
+	// than this in between before they are measured, as CoalesceSessions
+	// does; nothing is merged when zero
+	Coalesce time.Duration
+}
+
+// SessionLengthStats computes the count, mean, median, 90th percentile and
+// maximum session length of every application, largest total first.
+//
+// A session's length is its tracked duration, not the span from start to
+// end: the tracker ends a session when the screen locks or the user goes
+// idle, so idle time is never part of it, and sessions it split at
+// monitor.max_session_duration count as separate sessions. Sessions
+// without any tracked time are left out. Stored checkpoints must already
+// be merged, as MergeSessions does, and sessions must be sorted by start
+// time. Percentiles interpolate linearly between the nearest ranks, so
+// the median of an even count is the mean of the middle two.
+func SessionLengthStats(sessions []*storage.Session, opts SessionLengthOptions) []SessionLength {
+	if opts.Coalesce > 0 {
+		sessions = CoalesceSessions(sessions, opts.Coalesce, false)
+	}
+
+	lengths := make(map[string][]int64)
+	names := make(map[string]string)
+	for _, session := range sessions {
+		if session.DurationSeconds <= 0 {
+			continue
+		}
+		name := appname.Clean(session.AppName)
+		key := strings.ToLower(name)
+		if current, ok := names[key]; !ok || name < current {
+			names[key] = name
+		}
+		lengths[key] = append(lengths[key], session.DurationSeconds)
+	}
+
+	result := make([]SessionLength, 0, len(lengths))
+	for key, values := range lengths {
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		stat := SessionLength{
+			AppName: names[key],
+			Count:   len(values),
+			Median:  percentile(values, 0.5),
+			P90:     percentile(values, 0.9),
+			Max:     values[len(values)-1],
+		}
+		for _, v := range values {
+			stat.Total += v
+		}
+		stat.Mean = float64(stat.Total) / float64(stat.Count)
+		result = append(result, stat)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return lessApp(result[i].AppName, result[j].AppName)
+	})
+	return result
+}
+
+// percentile returns the p-th quantile (0 to 1) of sorted values,
+// interpolating between the two nearest ranks
+func percentile(sorted []int64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	position := p * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	if lower >= len(sorted)-1 {
+		return float64(sorted[len(sorted)-1])
+	}
+	fraction := position - float64(lower)
+	return float64(sorted[lower]) + fraction*float64(sorted[lower+1]-sorted[lower])
+}
@@ -0,0 +1,179 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// Period is the size of the buckets produced by Bucketize
+type Period string
+
+const (
+	// PeriodWeek groups days into weeks starting on Monday
+	PeriodWeek Period = "week"
+
+	// PeriodMonth groups days into calendar months
+	PeriodMonth Period = "month"
+)
+
+// Matrix holds time per application for a series of dates. Dates are in
+// ascending order, Apps are ordered by their total over all dates, and
+// Seconds is indexed as Seconds[date][app].
+type Matrix struct {
+	Dates   []time.Time
+	Apps    []string
+	Seconds [][]int64
+}
+
+// DateTotal returns the combined time of all applications on one date
+func (m *Matrix) DateTotal(i int) int64 {
+	var sum int64
+	for _, seconds := range m.Seconds[i] {
+		sum += seconds
+	}
+	return sum
+}
+
+// DailyMatrix returns a date x app matrix for the query. When both ends of
+// the range are set, every day of the range gets a row, including days
+// without data; otherwise only days with data are included.
+func DailyMatrix(r DailyStatsReader, query *storage.StatsQuery) (*Matrix, error) {
+	rows, err := r.GetDailyStats(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily stats: %w", err)
+	}
+
+	var dates []time.Time
+	if !query.StartDate.IsZero() && !query.EndDate.IsZero() {
+		for day := dateOf(query.StartDate); !day.After(dateOf(query.EndDate)); day = day.AddDate(0, 0, 1) {
+			dates = append(dates, day)
+		}
+	}
+
+	return buildMatrix(rows, dates), nil
+}
+
+// buildMatrix lays rows out on the given dates, adding any dates that only
+// appear in the rows
+func buildMatrix(rows []*storage.DailyStats, dates []time.Time) *Matrix {
+	dateIndex := make(map[time.Time]int)
+	for _, date := range dates {
+		dateIndex[date] = -1
+	}
+	for _, row := range rows {
+		if _, ok := dateIndex[dateOf(row.Date)]; !ok {
+			dateIndex[dateOf(row.Date)] = -1
+			dates = append(dates, dateOf(row.Date))
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	for i, date := range dates {
+		dateIndex[date] = i
+	}
+
+	totals := SumByApp(rows)
+	appIndex := make(map[string]int, len(totals))
+	matrix := &Matrix{
+		Dates:   dates,
+		Apps:    make([]string, len(totals)),
+		Seconds: make([][]int64, len(dates)),
+	}
+	for i, total := range totals {
+		matrix.Apps[i] = total.AppName
+		appIndex[strings.ToLower(total.AppName)] = i
+	}
+	for i := range matrix.Seconds {
+		matrix.Seconds[i] = make([]int64, len(totals))
+	}
+
+	for _, row := range rows {
+		matrix.Seconds[dateIndex[dateOf(row.Date)]][appIndex[strings.ToLower(appname.Clean(row.AppName))]] += row.TotalSeconds
+	}
+
+	return matrix
+}
+
+// Bucketize folds a daily matrix into weekly or monthly buckets. The dates
+// of the result are the first day of each bucket.
+func Bucketize(daily *Matrix, period Period) (*Matrix, error) {
+	var bucketStart func(time.Time) time.Time
+	switch period {
+	case PeriodWeek:
+		bucketStart = func(t time.Time) time.Time {
+			offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+			return t.AddDate(0, 0, -offset)
+		}
+	case PeriodMonth:
+		bucketStart = func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported period: %s", period)
+	}
+
+	result := &Matrix{Apps: daily.Apps}
+	index := make(map[time.Time]int)
+	for i, date := range daily.Dates {
+		start := bucketStart(date)
+		j, ok := index[start]
+		if !ok {
+			j = len(result.Dates)
+			index[start] = j
+			result.Dates = append(result.Dates, start)
+			result.Seconds = append(result.Seconds, make([]int64, len(daily.Apps)))
+		}
+		for k, seconds := range daily.Seconds[i] {
+			result.Seconds[j][k] += seconds
+		}
+	}
+
+	return result, nil
+}
+
+// DayHours holds the time recorded in each hour of one day
+type DayHours struct {
+	Date  time.Time
+	Hours [24]int64
+}
+
+// HourlyMatrix returns a date x hour matrix built from hourly statistics,
+// with a row for every day of the query range. Hours are in the local time
+// zone the sessions were recorded in, and sessions crossing an hour boundary
+// are split.
+func HourlyMatrix(r HourlyStatsReader, query *storage.StatsQuery) ([]DayHours, error) {
+	if query.StartDate.IsZero() || query.EndDate.IsZero() {
+		return nil, fmt.Errorf("hourly matrix needs a start and end date")
+	}
+	rows, err := r.GetHourlyStats(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hourly stats: %w", err)
+	}
+
+	from, to := rangeBounds(query.StartDate, query.EndDate)
+	var days []DayHours
+	index := make(map[time.Time]int)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		index[dateOf(day)] = len(days)
+		days = append(days, DayHours{Date: dateOf(day)})
+	}
+
+	for _, row := range rows {
+		if i, ok := index[dateOf(row.Date)]; ok && row.Hour >= 0 && row.Hour < 24 {
+			days[i].Hours[row.Hour] += row.TotalSeconds
+		}
+	}
+
+	return days, nil
+}
+
+// dateOf returns the calendar day of t as midnight UTC, the form used for
+// daily_stats dates
+func dateOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"sort"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// MonitorTotal is the time tracked on one monitor
+type MonitorTotal struct {
+	MonitorIndex *int // nil for sessions whose monitor is not known
+	Seconds      int64
+}
+
+// MonitorTotals sums the tracked time of sessions per monitor, in the order
+// of the monitors. Sessions recorded before monitors were, or by detectors
+// that cannot tell, are summed last as unknown.
+func MonitorTotals(sessions []*storage.Session) []MonitorTotal {
+	totals := make(map[int]int64)
+	var unknown int64
+	for _, session := range sessions {
+		if session.DurationSeconds <= 0 {
+			continue
+		}
+		if session.MonitorIndex == nil {
+			unknown += session.DurationSeconds
+			continue
+		}
+		totals[*session.MonitorIndex] += session.DurationSeconds
+	}
+
+	indexes := make([]int, 0, len(totals))
+	for index := range totals {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	result := make([]MonitorTotal, 0, len(indexes)+1)
+	for _, index := range indexes {
+		index := index
+		result = append(result, MonitorTotal{MonitorIndex: &index, Seconds: totals[index]})
+	}
+	if unknown > 0 {
+		result = append(result, MonitorTotal{Seconds: unknown})
+	}
+	return result
+}
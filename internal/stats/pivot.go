@@ -0,0 +1,117 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// OtherApp is the column that gathers the apps beyond the top N of a pivot
+const OtherApp = "Other"
+
+// Unit is the unit of the cells of a wide table
+type Unit string
+
+const (
+	UnitSeconds Unit = "seconds"
+	UnitMinutes Unit = "minutes"
+	UnitHours   Unit = "hours"
+)
+
+// ParseUnit parses a --unit value
+func ParseUnit(s string) (Unit, error) {
+	switch unit := Unit(s); unit {
+	case UnitSeconds, UnitMinutes, UnitHours:
+		return unit, nil
+	default:
+		return "", fmt.Errorf("unsupported unit: %s (expected seconds, minutes or hours)", s)
+	}
+}
+
+// Pivot lays daily rows out as a date x app matrix for spreadsheets. Every
+// day from start to end gets a row, days without data included; zero ends
+// are taken from the first and last day with data. With top > 0 only the
+// top apps get a column and the rest are added up in an Other column.
+func Pivot(rows []*storage.DailyStats, start, end time.Time, top int) *Matrix {
+	for _, row := range rows {
+		date := dateOf(row.Date)
+		if start.IsZero() || date.Before(dateOf(start)) {
+			start = date
+		}
+		if end.IsZero() || date.After(dateOf(end)) {
+			end = date
+		}
+	}
+
+	var dates []time.Time
+	if !start.IsZero() {
+		for day := dateOf(start); !day.After(dateOf(end)); day = day.AddDate(0, 0, 1) {
+			dates = append(dates, day)
+		}
+	}
+
+	return buildMatrix(rows, dates).TopApps(top)
+}
+
+// TopApps returns the matrix with only its n largest apps and an Other
+// column holding the rest. The matrix is returned as is when it has no more
+// than n apps or n is not positive.
+func (m *Matrix) TopApps(n int) *Matrix {
+	if n <= 0 || len(m.Apps) <= n {
+		return m
+	}
+
+	result := &Matrix{
+		Dates:   m.Dates,
+		Apps:    append(append([]string{}, m.Apps[:n]...), OtherApp),
+		Seconds: make([][]int64, len(m.Seconds)),
+	}
+	for i, row := range m.Seconds {
+		result.Seconds[i] = make([]int64, n+1)
+		copy(result.Seconds[i], row[:n])
+		for _, seconds := range row[n:] {
+			result.Seconds[i][n] += seconds
+		}
+	}
+	return result
+}
+
+// WideTable renders the matrix as rows of cells: a header of Date, the apps
+// and Total, one row per date and a final Total row. Seconds are whole
+// numbers; minutes and hours have precision decimals.
+func WideTable(m *Matrix, unit Unit, precision int) [][]string {
+	format := func(seconds int64) string {
+		switch unit {
+		case UnitMinutes:
+			return strconv.FormatFloat(float64(seconds)/60, 'f', precision, 64)
+		case UnitHours:
+			return strconv.FormatFloat(float64(seconds)/3600, 'f', precision, 64)
+		default:
+			return strconv.FormatInt(seconds, 10)
+		}
+	}
+
+	header := append(append([]string{"Date"}, m.Apps...), "Total")
+	table := [][]string{header}
+
+	appTotals := make([]int64, len(m.Apps))
+	var total int64
+	for i, date := range m.Dates {
+		row := []string{date.Format(storage.DateLayout)}
+		for j, seconds := range m.Seconds[i] {
+			row = append(row, format(seconds))
+			appTotals[j] += seconds
+		}
+		dateTotal := m.DateTotal(i)
+		total += dateTotal
+		table = append(table, append(row, format(dateTotal)))
+	}
+
+	footer := []string{"Total"}
+	for _, seconds := range appTotals {
+		footer = append(footer, format(seconds))
+	}
+	return append(table, append(footer, format(total)))
+}
@@ -0,0 +1,225 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// GapReader is the part of the storage layer that presence reports read
+type GapReader interface {
+	SessionReader
+	GetGaps(query *storage.StatsQuery) ([]*storage.Gap, error)
+}
+
+// DayPresence compares the time spent at the computer on one day with the
+// time tracked in applications
+type DayPresence struct {
+	Date time.Time
+	// First and Last are the first and last tracked activity of the day, so
+	// a day the daemon started late begins when tracking began
+	First time.Time
+	Last  time.Time
+	// PresenceSeconds is First to Last minus locked, idle and uncovered time
+	PresenceSeconds int64
+	// TrackedSeconds is the time covered by sessions
+	TrackedSeconds int64
+	LockedSeconds  int64
+	IdleSeconds    int64
+	// UncoveredSeconds are gaps without sessions or gap records, when the
+	// daemon was not running
+	UncoveredSeconds int64
+}
+
+// UntrackedSeconds returns the presence time not covered by sessions, such
+// as menus, window switching and short idles
+func (d DayPresence) UntrackedSeconds() int64 {
+	if d.TrackedSeconds >= d.PresenceSeconds {
+		return 0
+	}
+	return d.PresenceSeconds - d.TrackedSeconds
+}
+
+// UntrackedPercent returns UntrackedSeconds as a share of presence time
+func (d DayPresence) UntrackedPercent() float64 {
+	if d.PresenceSeconds == 0 {
+		return 0
+	}
+	return float64(d.UntrackedSeconds()) / float64(d.PresenceSeconds) * 100
+}
+
+// DailyPresence reports presence per day in the query range. Gaps between
+// sessions count as presence unless a locked or idle gap covers them or they
+// are at least uncoveredAfter long without any record, which means nothing
+// was tracking. Pass the monitor's activity window: the tracker records an
+// idle gap for any longer pause while it runs.
+func DailyPresence(r GapReader, query *storage.StatsQuery, uncoveredAfter time.Duration) ([]DayPresence, error) {
+	sessions, err := r.GetSessions(&storage.StatsQuery{StartDate: query.StartDate, EndDate: query.EndDate})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	gaps, err := r.GetGaps(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gaps: %w", err)
+	}
+	return Presence(sessions, gaps, uncoveredAfter), nil
+}
+
+// Presence computes DayPresence for every day with tracked sessions, in date
+// order. Imported sessions are ignored since no gaps are known for them.
+func Presence(sessions []*storage.Session, gaps []*storage.Gap, uncoveredAfter time.Duration) []DayPresence {
+	tracked := make([]*storage.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if storage.IsTracked(session.Source) {
+			tracked = append(tracked, session)
+		}
+	}
+
+	// Sessions are split at midnight so every part belongs to its own day
+	activity := make(map[time.Time][]interval)
+	for _, session := range MergeSessions(tracked) {
+		start := session.StartTime.In(time.Local)
+		end := start.Add(time.Duration(session.DurationSeconds) * time.Second)
+		for _, part := range splitAtMidnight(interval{start, end}) {
+			day := localDay(part.start)
+			activity[day] = append(activity[day], part)
+		}
+	}
+
+	var locked, idle []interval
+	for _, gap := range gaps {
+		span := interval{gap.StartTime.In(time.Local), gap.EndTime.In(time.Local)}
+		// A suspended machine is as out of reach as a locked one
+		if gap.Kind == storage.GapLocked || gap.Kind == storage.GapSuspended {
+			locked = append(locked, span)
+		} else {
+			idle = append(idle, span)
+		}
+	}
+	locked = mergeIntervals(locked)
+	away := mergeIntervals(append(append([]interval{}, locked...), idle...))
+
+	days := make([]DayPresence, 0, len(activity))
+	for day, parts := range activity {
+		covered := mergeIntervals(parts)
+		if len(covered) == 0 {
+			continue
+		}
+		result := DayPresence{
+			Date:  day,
+			First: covered[0].start,
+			Last:  covered[len(covered)-1].end,
+		}
+		result.TrackedSeconds = seconds(totalLength(covered))
+
+		var lockedTime, awayTime, uncovered time.Duration
+		for i := 1; i < len(covered); i++ {
+			hole := interval{covered[i-1].end, covered[i].start}
+			lockedTime += hole.length() - totalLength(subtract(hole, locked))
+			rest := subtract(hole, away)
+			awayTime += hole.length() - totalLength(rest)
+			for _, part := range rest {
+				if part.length() >= uncoveredAfter {
+					uncovered += part.length()
+				}
+			}
+		}
+
+		result.LockedSeconds = seconds(lockedTime)
+		result.IdleSeconds = seconds(awayTime - lockedTime)
+		result.UncoveredSeconds = seconds(uncovered)
+		result.PresenceSeconds = seconds(result.Last.Sub(result.First) - awayTime - uncovered)
+		days = append(days, result)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.Before(days[j].Date)
+	})
+	return days
+}
+
+// interval is a half-open span of time
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+func (i interval) length() time.Duration {
+	return i.end.Sub(i.start)
+}
+
+// mergeIntervals sorts the intervals and joins the overlapping ones
+func mergeIntervals(spans []interval) []interval {
+	sorted := make([]interval, 0, len(spans))
+	for _, span := range spans {
+		if span.end.After(span.start) {
+			sorted = append(sorted, span)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start.Before(sorted[j].start)
+	})
+
+	var merged []interval
+	for _, span := range sorted {
+		if n := len(merged); n > 0 && !span.start.After(merged[n-1].end) {
+			if span.end.After(merged[n-1].end) {
+				merged[n-1].end = span.end
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// subtract returns the parts of span not covered by cuts, which must be
+// merged
+func subtract(span interval, cuts []interval) []interval {
+	var rest []interval
+	for _, cut := range cuts {
+		if !cut.end.After(span.start) {
+			continue
+		}
+		if !cut.start.Before(span.end) {
+			break
+		}
+		if cut.start.After(span.start) {
+			rest = append(rest, interval{span.start, cut.start})
+		}
+		span.start = cut.end
+		if !span.end.After(span.start) {
+			return rest
+		}
+	}
+	return append(rest, span)
+}
+
+// totalLength sums the lengths of the intervals
+func totalLength(spans []interval) time.Duration {
+	var total time.Duration
+	for _, span := range spans {
+		total += span.length()
+	}
+	return total
+}
+
+// splitAtMidnight cuts an interval at every local midnight it crosses
+func splitAtMidnight(span interval) []interval {
+	var parts []interval
+	for {
+		next := localDay(span.start).AddDate(0, 0, 1)
+		if !span.end.After(next) {
+			return append(parts, span)
+		}
+		parts = append(parts, interval{span.start, next})
+		span.start = next
+	}
+}
+
+// seconds converts a duration to whole seconds
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
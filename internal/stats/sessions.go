@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+	"github.com/weii/actime/internal/title"
+)
+
+// sessionKey identifies one tracked session across its checkpoints
+type sessionKey struct {
+	app   string
+	title string
+	start int64
+}
+
+// MergeSessions combines session lists from the database and the daemon's
+// memory. A session is written again as it grows, so rows with the same
+// app, title and start are checkpoints of one session and the longest one
+// wins. The result is sorted by start time.
+func MergeSessions(lists ...[]*storage.Session) []*storage.Session {
+	merged := make(map[sessionKey]*storage.Session)
+	for _, list := range lists {
+		for _, session := range list {
+			key := sessionKey{session.AppName, session.WindowTitle, session.StartTime.UnixNano()}
+			if existing, ok := merged[key]; ok && existing.DurationSeconds >= session.DurationSeconds {
+				continue
+			}
+			merged[key] = session
+		}
+	}
+
+	sessions := make([]*storage.Session, 0, len(merged))
+	for _, session := range merged {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].StartTime.Equal(sessions[j].StartTime) {
+			return sessions[i].StartTime.Before(sessions[j].StartTime)
+		}
+		if sessions[i].AppName != sessions[j].AppName {
+			return lessApp(sessions[i].AppName, sessions[j].AppName)
+		}
+		return sessions[i].WindowTitle < sessions[j].WindowTitle
+	})
+
+	return sessions
+}
+
+// FilterSessions keeps sessions that overlap [since, until) and belong to
+// app, compared case-insensitively. Zero times and an empty app do not
+// filter. With a positive limit only the most recent sessions are kept.
+// sessions must be sorted by start time.
+func FilterSessions(sessions []*storage.Session, since, until time.Time, app string, limit int) []*storage.Session {
+	var filtered []*storage.Session
+	for _, session := range sessions {
+		if !since.IsZero() && !session.EndTime.After(since) {
+			continue
+		}
+		if !until.IsZero() && !session.StartTime.Before(until) {
+			continue
+		}
+		if app != "" && !strings.EqualFold(session.AppName, app) {
+			continue
+		}
+		filtered = append(filtered, session)
+	}
+
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+
+	return filtered
+}
+
+// Unsaved returns the part of the live sessions that the database does not
+// hold yet. A live session may already have been written as a shorter
+// checkpoint, identified as in MergeSessions; only the time beyond the
+// longest stored checkpoint is kept, so nothing is counted twice.
+func Unsaved(persisted, live []*storage.Session) []*storage.Session {
+	stored := make(map[sessionKey]int64)
+	for _, session := range persisted {
+		key := sessionKey{session.AppName, session.WindowTitle, session.StartTime.UnixNano()}
+		if session.DurationSeconds > stored[key] {
+			stored[key] = session.DurationSeconds
+		}
+	}
+
+	var unsaved []*storage.Session
+	for _, session := range live {
+		key := sessionKey{session.AppName, session.WindowTitle, session.StartTime.UnixNano()}
+		extra := session.DurationSeconds - stored[key]
+		if extra <= 0 {
+			continue
+		}
+		part := *session
+		part.DurationSeconds = extra
+		unsaved = append(unsaved, &part)
+	}
+	return unsaved
+}
+
+// SessionDailyStats adds up sessions per app and start date, the way the
+// daemon credits them to daily_stats
+func SessionDailyStats(sessions []*storage.Session) []*storage.DailyStats {
+	type appDay struct {
+		app  string
+		date string
+	}
+
+	var rows []*storage.DailyStats
+	index := make(map[appDay]*storage.DailyStats)
+	for _, session := range sessions {
+		date := session.StartTime.Format(storage.DateLayout)
+		key := appDay{session.AppName, date}
+		row, ok := index[key]
+		if !ok {
+			day, _ := time.Parse(storage.DateLayout, date)
+			row = &storage.DailyStats{AppName: session.AppName, Date: day}
+			index[key] = row
+			rows = append(rows, row)
+		}
+		row.TotalSeconds += session.DurationSeconds
+	}
+	return rows
+}
+
+// CoalesceSessions merges runs of sessions of the same app, and with
+// byTitle of the same window title, that follow each other with less than
+// maxGap in between into one logical session. Focus that flickered away
+// for a second or two before capture-time debouncing left many tiny
+// sessions; merged they give meaningful session counts and lengths.
+// Titles are compared sanitized, so near-duplicates stored before
+// title.Sanitize existed still match.
+//
+// Durations are added up, so the total is unchanged. A merged session runs
+// from the first start to the last end and keeps the title of its longest
+// part. sessions must be sorted by start time and are not modified.
+func CoalesceSessions(sessions []*storage.Session, maxGap time.Duration, byTitle bool) []*storage.Session {
+	var merged []*storage.Session
+	var longest int64
+	for _, session := range sessions {
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			gap := session.StartTime.Sub(sessionEnd(last))
+			if gap < maxGap && strings.EqualFold(last.AppName, session.AppName) &&
+				(!byTitle || title.Sanitize(last.WindowTitle) == title.Sanitize(session.WindowTitle)) {
+				if end := sessionEnd(session); end.After(last.EndTime) {
+					last.EndTime = end
+				}
+				last.DurationSeconds += session.DurationSeconds
+				if session.DurationSeconds > longest {
+					longest = session.DurationSeconds
+					last.WindowTitle = session.WindowTitle
+					last.RawTitle = session.RawTitle
+				}
+				continue
+			}
+		}
+
+		copied := *session
+		copied.EndTime = sessionEnd(session)
+		merged = append(merged, &copied)
+		longest = session.DurationSeconds
+	}
+	return merged
+}
+
+// sessionEnd returns when a session ended, derived from its duration when
+// no end time was stored
+func sessionEnd(session *storage.Session) time.Time {
+	if session.EndTime.IsZero() {
+		return session.StartTime.Add(time.Duration(session.DurationSeconds) * time.Second)
+	}
+	return session.EndTime
+}
@@ -0,0 +1,132 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// DailyStatsReader is the storage needed for aggregates over daily statistics
+type DailyStatsReader interface {
+	GetDailyStats(query *storage.StatsQuery) ([]*storage.DailyStats, error)
+}
+
+// HourlyStatsReader is the storage needed for aggregates over hourly
+// statistics
+type HourlyStatsReader interface {
+	GetHourlyStats(query *storage.StatsQuery) ([]*storage.HourlyStats, error)
+}
+
+// SessionReader is the storage needed for aggregates over raw sessions
+type SessionReader interface {
+	GetSessions(query *storage.StatsQuery) ([]*storage.Session, error)
+}
+
+// AppTotal is the total time spent in one application over a range
+type AppTotal struct {
+	AppName      string
+	TotalSeconds int64
+}
+
+// AppTotals returns the per-application totals for the query, largest first.
+//
+//	totals, err := stats.AppTotals(db, &storage.StatsQuery{StartDate: day, EndDate: day})
+//	for _, total := range totals {
+//		fmt.Println(total.AppName, total.TotalSeconds)
+//	}
+func AppTotals(r DailyStatsReader, query *storage.StatsQuery) ([]AppTotal, error) {
+	rows, err := r.GetDailyStats(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily stats: %w", err)
+	}
+	return SumByApp(rows), nil
+}
+
+// SumByApp aggregates daily rows into per-application totals, largest first.
+// Ties are broken by application name so the order is stable. Names that
+// differ only in case are one application, reported under the spelling
+// that sorts first.
+func SumByApp(rows []*storage.DailyStats) []AppTotal {
+	return AddToTotals(nil, rows)
+}
+
+// AddToTotals adds daily rows, such as the live ones not yet saved, to
+// per-application totals from storage.DB.GetTopApps. The result is merged
+// and ordered like SumByApp.
+func AddToTotals(totals []*storage.AppTotal, rows []*storage.DailyStats) []AppTotal {
+	merged := make(map[string]*AppTotal)
+	add := func(appName string, seconds int64) {
+		name := appname.Clean(appName)
+		key := strings.ToLower(name)
+		total, ok := merged[key]
+		if !ok {
+			total = &AppTotal{AppName: name}
+			merged[key] = total
+		}
+		if name < total.AppName {
+			total.AppName = name
+		}
+		total.TotalSeconds += seconds
+	}
+	for _, total := range totals {
+		add(total.AppName, total.TotalSeconds)
+	}
+	for _, row := range rows {
+		add(row.AppName, row.TotalSeconds)
+	}
+
+	result := make([]AppTotal, 0, len(merged))
+	for _, total := range merged {
+		result = append(result, *total)
+	}
+	sortAppTotals(result)
+
+	return result
+}
+
+// Sum returns the combined time of all totals
+func Sum(totals []AppTotal) int64 {
+	var sum int64
+	for _, total := range totals {
+		sum += total.TotalSeconds
+	}
+	return sum
+}
+
+// sortAppTotals orders totals by time descending, then by name
+func sortAppTotals(totals []AppTotal) {
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].TotalSeconds != totals[j].TotalSeconds {
+			return totals[i].TotalSeconds > totals[j].TotalSeconds
+		}
+		return lessApp(totals[i].AppName, totals[j].AppName)
+	})
+}
+
+// SortDailyStats orders daily rows chronologically, then like AppTotals:
+// time descending, then by name. It gives exports a stable row order.
+func SortDailyStats(rows []*storage.DailyStats) {
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Date.Equal(rows[j].Date) {
+			return rows[i].Date.Before(rows[j].Date)
+		}
+		if rows[i].TotalSeconds != rows[j].TotalSeconds {
+			return rows[i].TotalSeconds > rows[j].TotalSeconds
+		}
+		return lessApp(rows[i].AppName, rows[j].AppName)
+	})
+}
+
+// lessApp is the secondary order of every aggregate: application names
+// ascending, ignoring case, with the exact spelling as the last resort so
+// the order never depends on the input order
+func lessApp(a, b string) bool {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	if la != lb {
+		return la < lb
+	}
+	return a < b
+}
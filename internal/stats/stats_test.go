@@ -0,0 +1,1075 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/storage"
+)
+
+// fakeStore is an in-memory DailyStatsReader, HourlyStatsReader,
+// SessionReader and GapReader
+type fakeStore struct {
+	daily    []*storage.DailyStats
+	hourly   []*storage.HourlyStats
+	sessions []*storage.Session
+	gaps     []*storage.Gap
+	err      error
+}
+
+func (f *fakeStore) GetDailyStats(query *storage.StatsQuery) ([]*storage.DailyStats, error) {
+	return f.daily, f.err
+}
+
+func (f *fakeStore) GetHourlyStats(query *storage.StatsQuery) ([]*storage.HourlyStats, error) {
+	return f.hourly, f.err
+}
+
+func (f *fakeStore) GetSessions(query *storage.StatsQuery) ([]*storage.Session, error) {
+	return f.sessions, f.err
+}
+
+func (f *fakeStore) GetGaps(query *storage.StatsQuery) ([]*storage.Gap, error) {
+	return f.gaps, f.err
+}
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func daily(date, app string, seconds int64) *storage.DailyStats {
+	return &storage.DailyStats{Date: day(date), AppName: app, TotalSeconds: seconds}
+}
+
+// withLocal runs the rest of the test with loc as the local time zone
+func withLocal(t *testing.T, loc *time.Location) {
+	t.Helper()
+	saved := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = saved })
+}
+
+func TestAppTotals(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []*storage.DailyStats
+		want []AppTotal
+	}{
+		{
+			name: "empty",
+			want: []AppTotal{},
+		},
+		{
+			name: "single day",
+			rows: []*storage.DailyStats{
+				daily("2026-01-05", "editor", 300),
+				daily("2026-01-05", "browser", 600),
+			},
+			want: []AppTotal{{"browser", 600}, {"editor", 300}},
+		},
+		{
+			name: "summed across days with ties ordered by name",
+			rows: []*storage.DailyStats{
+				daily("2026-01-05", "term", 100),
+				daily("2026-01-06", "term", 200),
+				daily("2026-01-06", "chat", 300),
+				daily("2026-01-06", "mail\x00", 50),
+			},
+			want: []AppTotal{{"chat", 300}, {"term", 300}, {"mail", 50}},
+		},
+		{
+			name: "case variants folded into one app",
+			rows: []*storage.DailyStats{
+				daily("2026-01-05", "firefox", 50),
+				daily("2026-01-06", "Firefox", 100),
+			},
+			want: []AppTotal{{"Firefox", 150}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AppTotals(&fakeStore{daily: tt.rows}, &storage.StatsQuery{})
+			if err != nil {
+				t.Fatalf("AppTotals failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAppTotalsError(t *testing.T) {
+	store := &fakeStore{err: errors.New("disk I/O error")}
+	if _, err := AppTotals(store, &storage.StatsQuery{}); err == nil {
+		t.Error("Expected the storage error to be returned")
+	}
+}
+
+func TestAddToTotals(t *testing.T) {
+	saved := []*storage.AppTotal{{AppName: "editor", TotalSeconds: 600}, {AppName: "browser", TotalSeconds: 500}}
+	live := []*storage.DailyStats{
+		daily("2026-01-05", "Browser", 200),
+		daily("2026-01-05", "chat\x00", 100),
+	}
+
+	want := []AppTotal{{"Browser", 700}, {"editor", 600}, {"chat", 100}}
+	if got := AddToTotals(saved, live); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestAddTitleSessions(t *testing.T) {
+	stored := []*storage.TitleStats{{WindowTitle: "main.go", TotalSeconds: 600}, {WindowTitle: "db.go", TotalSeconds: 300}}
+	live := []*storage.Session{
+		{AppName: "Code", WindowTitle: " db.go\x00", DurationSeconds: 300},
+		{AppName: "Code", WindowTitle: "notes.md", DurationSeconds: 30},
+	}
+
+	want := []TitleTotal{{"db.go", 600}, {"main.go", 600}, {"notes.md", 30}}
+	if got := AddTitleSessions(stored, live); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestDailyMatrix(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    []*storage.DailyStats
+		query   storage.StatsQuery
+		dates   []string
+		apps    []string
+		seconds [][]int64
+	}{
+		{
+			name:  "empty open range",
+			dates: nil,
+			apps:  []string{},
+		},
+		{
+			name:    "empty closed range has a row per day",
+			query:   storage.StatsQuery{StartDate: day("2026-01-05"), EndDate: day("2026-01-06")},
+			dates:   []string{"2026-01-05", "2026-01-06"},
+			apps:    []string{},
+			seconds: [][]int64{{}, {}},
+		},
+		{
+			name: "single day",
+			rows: []*storage.DailyStats{
+				daily("2026-01-05", "editor", 300),
+				daily("2026-01-05", "browser", 600),
+			},
+			query:   storage.StatsQuery{StartDate: day("2026-01-05"), EndDate: day("2026-01-05")},
+			dates:   []string{"2026-01-05"},
+			apps:    []string{"browser", "editor"},
+			seconds: [][]int64{{600, 300}},
+		},
+		{
+			name: "gaps are filled",
+			rows: []*storage.DailyStats{
+				daily("2026-01-07", "editor", 100),
+				daily("2026-01-05", "editor", 300),
+				daily("2026-01-05", "browser", 50),
+			},
+			query:   storage.StatsQuery{StartDate: day("2026-01-05"), EndDate: day("2026-01-07")},
+			dates:   []string{"2026-01-05", "2026-01-06", "2026-01-07"},
+			apps:    []string{"editor", "browser"},
+			seconds: [][]int64{{300, 50}, {0, 0}, {100, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			matrix, err := DailyMatrix(&fakeStore{daily: tt.rows}, &query)
+			if err != nil {
+				t.Fatalf("DailyMatrix failed: %v", err)
+			}
+
+			var dates []string
+			for _, date := range matrix.Dates {
+				dates = append(dates, date.Format("2006-01-02"))
+			}
+			if !reflect.DeepEqual(dates, tt.dates) {
+				t.Errorf("Expected dates %v, got %v", tt.dates, dates)
+			}
+			if !reflect.DeepEqual(matrix.Apps, tt.apps) {
+				t.Errorf("Expected apps %v, got %v", tt.apps, matrix.Apps)
+			}
+			if len(tt.seconds) > 0 && !reflect.DeepEqual(matrix.Seconds, tt.seconds) {
+				t.Errorf("Expected seconds %v, got %v", tt.seconds, matrix.Seconds)
+			}
+		})
+	}
+}
+
+func TestBucketize(t *testing.T) {
+	// 2026-01-04 is a Sunday, 2026-01-05 a Monday
+	daily := &Matrix{
+		Dates:   []time.Time{day("2026-01-04"), day("2026-01-05"), day("2026-01-11"), day("2026-02-01")},
+		Apps:    []string{"editor", "browser"},
+		Seconds: [][]int64{{10, 1}, {20, 2}, {30, 3}, {40, 4}},
+	}
+
+	tests := []struct {
+		name    string
+		matrix  *Matrix
+		period  Period
+		dates   []time.Time
+		seconds [][]int64
+	}{
+		{
+			name:   "empty",
+			matrix: &Matrix{},
+			period: PeriodWeek,
+		},
+		{
+			name:    "weeks start on Monday",
+			matrix:  daily,
+			period:  PeriodWeek,
+			dates:   []time.Time{day("2025-12-29"), day("2026-01-05"), day("2026-01-26")},
+			seconds: [][]int64{{10, 1}, {50, 5}, {40, 4}},
+		},
+		{
+			name:    "months",
+			matrix:  daily,
+			period:  PeriodMonth,
+			dates:   []time.Time{day("2026-01-01"), day("2026-02-01")},
+			seconds: [][]int64{{60, 6}, {40, 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Bucketize(tt.matrix, tt.period)
+			if err != nil {
+				t.Fatalf("Bucketize failed: %v", err)
+			}
+			if !reflect.DeepEqual(got.Dates, tt.dates) {
+				t.Errorf("Expected dates %v, got %v", tt.dates, got.Dates)
+			}
+			if !reflect.DeepEqual(got.Seconds, tt.seconds) {
+				t.Errorf("Expected seconds %v, got %v", tt.seconds, got.Seconds)
+			}
+		})
+	}
+
+	if _, err := Bucketize(daily, Period("year")); err == nil {
+		t.Error("Expected an error for an unsupported period")
+	}
+}
+
+func TestHourlyMatrix(t *testing.T) {
+	hour := func(app, date string, h int, seconds int64) *storage.HourlyStats {
+		return &storage.HourlyStats{AppName: app, Date: day(date), Hour: h, TotalSeconds: seconds}
+	}
+	tests := []struct {
+		name string
+		rows []*storage.HourlyStats
+		days int
+		want map[[2]int]int64 // {day index, hour} -> seconds
+	}{
+		{
+			name: "empty",
+			days: 1,
+			want: map[[2]int]int64{},
+		},
+		{
+			name: "applications added up per hour",
+			rows: []*storage.HourlyStats{
+				hour("editor", "2026-01-05", 9, 1200),
+				hour("browser", "2026-01-05", 9, 300),
+				hour("editor", "2026-01-05", 10, 1200),
+			},
+			days: 1,
+			want: map[[2]int]int64{{0, 9}: 1500, {0, 10}: 1200},
+		},
+		{
+			name: "rows outside the range left out",
+			rows: []*storage.HourlyStats{
+				hour("editor", "2026-01-04", 23, 600),
+				hour("editor", "2026-01-06", 0, 600),
+				hour("editor", "2026-01-07", 1, 600),
+			},
+			days: 2,
+			want: map[[2]int]int64{{1, 0}: 600},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &storage.StatsQuery{
+				StartDate: time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local),
+				EndDate:   time.Date(2026, 1, 4+tt.days, 0, 0, 0, 0, time.Local),
+			}
+
+			days, err := HourlyMatrix(&fakeStore{hourly: tt.rows}, query)
+			if err != nil {
+				t.Fatalf("HourlyMatrix failed: %v", err)
+			}
+			if len(days) != tt.days {
+				t.Fatalf("Expected %d days, got %d", tt.days, len(days))
+			}
+
+			for i, d := range days {
+				for hour, seconds := range d.Hours {
+					if want := tt.want[[2]int{i, hour}]; seconds != want {
+						t.Errorf("Day %d hour %d: expected %ds, got %ds", i, hour, want, seconds)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := HourlyMatrix(&fakeStore{}, &storage.StatsQuery{}); err == nil {
+		t.Error("Expected an error for an open range")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name   string
+		before []AppTotal
+		after  []AppTotal
+		want   []Delta
+	}{
+		{
+			name: "empty",
+			want: []Delta{},
+		},
+		{
+			name:   "changed, new and dropped apps",
+			before: []AppTotal{{"editor", 1000}, {"chat", 400}},
+			after:  []AppTotal{{"editor", 1500}, {"browser", 200}},
+			want: []Delta{
+				{AppName: "editor", Before: 1000, After: 1500, Change: 500, Percent: 50},
+				{AppName: "chat", Before: 400, After: 0, Change: -400, Percent: -100},
+				{AppName: "browser", Before: 0, After: 200, Change: 200},
+			},
+		},
+		{
+			name:   "ties ordered by name",
+			before: []AppTotal{{"b", 100}, {"a", 100}},
+			after:  []AppTotal{{"b", 200}, {"a", 0}},
+			want: []Delta{
+				{AppName: "a", Before: 100, After: 0, Change: -100, Percent: -100},
+				{AppName: "b", Before: 100, After: 200, Change: 100, Percent: 100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compare(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBreakAnalysis(t *testing.T) {
+	tests := []struct {
+		name     string
+		location *time.Location
+		sessions []*storage.Session
+		breaks   int
+		total    int64
+		longest  int64
+		stretch  int
+	}{
+		{
+			name:     "empty",
+			location: time.UTC,
+		},
+		{
+			name:     "single day with one break",
+			location: time.UTC,
+			sessions: []*storage.Session{
+				// Out of order on purpose
+				sessionAt("browser", time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC), 1800),
+				sessionAt("editor", time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC), 1200),
+				// 1 minute gap is below the threshold
+				sessionAt("term", time.Date(2026, 1, 5, 9, 21, 0, 0, time.UTC), 600),
+			},
+			breaks:  1,
+			total:   1740, // 09:31 - 10:00
+			longest: 1860, // 09:00 - 09:31
+			stretch: 2,
+		},
+		{
+			// 22:00 UTC and 23:30 UTC fall on different days in UTC+1
+			name:     "midnight ends a stretch in the local time zone",
+			location: time.FixedZone("CET", 3600),
+			sessions: []*storage.Session{
+				sessionAt("editor", time.Date(2026, 1, 5, 22, 0, 0, 0, time.UTC), 600),
+				sessionAt("editor", time.Date(2026, 1, 5, 23, 30, 0, 0, time.UTC), 600),
+			},
+			breaks:  0,
+			longest: 600,
+			stretch: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withLocal(t, tt.location)
+
+			summary, err := BreakAnalysis(&fakeStore{sessions: tt.sessions}, &storage.StatsQuery{}, 5*time.Minute)
+			if err != nil {
+				t.Fatalf("BreakAnalysis failed: %v", err)
+			}
+			if len(summary.Breaks) != tt.breaks {
+				t.Errorf("Expected %d breaks, got %d", tt.breaks, len(summary.Breaks))
+			}
+			if summary.TotalBreakSeconds != tt.total {
+				t.Errorf("Expected %ds of breaks, got %d", tt.total, summary.TotalBreakSeconds)
+			}
+			if summary.LongestFocusSeconds != tt.longest {
+				t.Errorf("Expected longest focus of %ds, got %d", tt.longest, summary.LongestFocusSeconds)
+			}
+			if summary.FocusStretches != tt.stretch {
+				t.Errorf("Expected %d stretches, got %d", tt.stretch, summary.FocusStretches)
+			}
+		})
+	}
+}
+
+func TestMergeSessionsKeepsLongestCheckpoint(t *testing.T) {
+	start := time.Date(2026, 1, 5, 14, 0, 0, 0, time.Local)
+	checkpoint := func(app, title string, offset, seconds int64) *storage.Session {
+		s := start.Add(time.Duration(offset) * time.Second)
+		return &storage.Session{
+			AppName:         app,
+			WindowTitle:     title,
+			StartTime:       s,
+			EndTime:         s.Add(time.Duration(seconds) * time.Second),
+			DurationSeconds: seconds,
+		}
+	}
+
+	// The database holds two flushed checkpoints of the open session; the
+	// daemon's memory holds a longer one and the current session
+	persisted := []*storage.Session{
+		checkpoint("editor", "main.go", 0, 60),
+		checkpoint("editor", "main.go", 0, 120),
+		checkpoint("browser", "docs", -600, 300),
+	}
+	live := []*storage.Session{
+		checkpoint("editor", "main.go", 0, 90),
+		checkpoint("editor", "main.go", 0, 180),
+		checkpoint("chat", "general", 180, 20),
+	}
+
+	merged := MergeSessions(persisted, live)
+
+	var got []string
+	for _, s := range merged {
+		got = append(got, s.AppName+"/"+s.WindowTitle+"/"+time.Duration(s.DurationSeconds*int64(time.Second)).String())
+	}
+	want := []string{"browser/docs/5m0s", "editor/main.go/3m0s", "chat/general/20s"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestMergeSessionsAcrossDatabaseRoundTrip(t *testing.T) {
+	db, err := storage.NewDB(t.TempDir() + "/actime.db")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Start times carry sub-second precision from the tracker
+	start := time.Now().Truncate(time.Microsecond)
+	session := &storage.Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60}
+	if err := db.InsertSession(session); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+
+	persisted, err := db.GetSessions(&storage.StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read sessions: %v", err)
+	}
+	live := []*storage.Session{{AppName: "editor", StartTime: start, EndTime: start.Add(2 * time.Minute), DurationSeconds: 120}}
+
+	merged := MergeSessions(persisted, live)
+	if len(merged) != 1 || merged[0].DurationSeconds != 120 {
+		t.Errorf("Expected the stored and live checkpoints to merge, got %d sessions", len(merged))
+	}
+}
+
+func TestFilterSessions(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 1, 5, hour, minute, 0, 0, time.Local)
+	}
+	sessions := []*storage.Session{
+		{AppName: "editor", StartTime: at(13, 0), EndTime: at(13, 30)},
+		{AppName: "editor", StartTime: at(13, 50), EndTime: at(14, 10)}, // overlaps since
+		{AppName: "Browser", StartTime: at(14, 15), EndTime: at(14, 20)},
+		{AppName: "editor", StartTime: at(14, 30), EndTime: at(15, 0)},
+		{AppName: "editor", StartTime: at(16, 0), EndTime: at(16, 5)}, // starts at until
+	}
+
+	tests := []struct {
+		name  string
+		app   string
+		limit int
+		want  []int
+	}{
+		{"range", "", 0, []int{1, 2, 3}},
+		{"app ignores case", "browser", 0, []int{2}},
+		{"limit keeps the most recent", "", 2, []int{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FilterSessions(sessions, at(14, 0), at(16, 0), tt.app, tt.limit)
+			var want []*storage.Session
+			for _, i := range tt.want {
+				want = append(want, sessions[i])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected sessions %v, got %d sessions", tt.want, len(got))
+			}
+		})
+	}
+}
+
+func TestAggregatesAreDeterministicWithTies(t *testing.T) {
+	rows := []*storage.DailyStats{
+		daily("2026-01-06", "zed", 300),
+		daily("2026-01-05", "Browser", 300),
+		daily("2026-01-05", "apple", 300),
+		daily("2026-01-05", "chat", 600),
+		daily("2026-01-06", "Apple", 300),
+		daily("2026-01-06", "browser", 300),
+	}
+
+	wantTotals := []AppTotal{{"Apple", 600}, {"Browser", 600}, {"chat", 600}, {"zed", 300}}
+	wantRows := []string{
+		"2026-01-05 chat 600", "2026-01-05 apple 300", "2026-01-05 Browser 300",
+		"2026-01-06 Apple 300", "2026-01-06 browser 300", "2026-01-06 zed 300",
+	}
+
+	for run := 0; run < 50; run++ {
+		// Feed the rows in a different order on every run
+		shuffled := make([]*storage.DailyStats, len(rows))
+		for i, j := range rand.Perm(len(rows)) {
+			shuffled[i] = rows[j]
+		}
+
+		if got := SumByApp(shuffled); !reflect.DeepEqual(got, wantTotals) {
+			t.Fatalf("Run %d: expected totals %v, got %v", run, wantTotals, got)
+		}
+
+		SortDailyStats(shuffled)
+		var got []string
+		for _, row := range shuffled {
+			got = append(got, fmt.Sprintf("%s %s %d", row.Date.Format(storage.DateLayout), row.AppName, row.TotalSeconds))
+		}
+		if !reflect.DeepEqual(got, wantRows) {
+			t.Fatalf("Run %d: expected rows %v, got %v", run, wantRows, got)
+		}
+
+		matrix := buildMatrix(shuffled, nil)
+		if !reflect.DeepEqual(matrix.Apps, []string{"Apple", "Browser", "chat", "zed"}) {
+			t.Fatalf("Run %d: unexpected matrix apps %v", run, matrix.Apps)
+		}
+	}
+}
+
+func TestCompareMatchesCaseVariants(t *testing.T) {
+	before := []AppTotal{{"Firefox", 100}, {"editor", 50}}
+	after := []AppTotal{{"firefox", 150}, {"Editor", 100}}
+
+	want := []Delta{
+		{AppName: "Editor", Before: 50, After: 100, Change: 50, Percent: 100},
+		{AppName: "Firefox", Before: 100, After: 150, Change: 50, Percent: 50},
+	}
+	if got := Compare(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDailyPresence(t *testing.T) {
+	withLocal(t, time.UTC)
+	clock := func(d, h, m int) time.Time {
+		return time.Date(2026, 1, d, h, m, 0, 0, time.UTC)
+	}
+	imported := sessionAt("rescuetime", clock(5, 7, 0), 3600)
+	imported.Source = "rescuetime"
+
+	store := &fakeStore{
+		sessions: []*storage.Session{
+			// The daemon started late, at 10:00
+			sessionAt("editor", clock(5, 10, 0), 3600),
+			// A shortened checkpoint of the same session
+			sessionAt("editor", clock(5, 10, 0), 1800),
+			// A 2 minute pause is below the idle threshold and not recorded
+			sessionAt("browser", clock(5, 11, 2), 3480),
+			sessionAt("editor", clock(5, 13, 0), 3600),
+			sessionAt("editor", clock(5, 14, 20), 2400),
+			// The daemon was not running from 15:00 to 16:00
+			sessionAt("term", clock(5, 16, 0), 3600),
+			imported,
+			// A short second day
+			sessionAt("editor", clock(6, 9, 0), 1800),
+			sessionAt("editor", clock(6, 9, 40), 1200),
+		},
+		gaps: []*storage.Gap{
+			// Locked for lunch
+			{Kind: storage.GapLocked, StartTime: clock(5, 12, 0), EndTime: clock(5, 13, 0)},
+			// Idle since 13:55, which overlaps the session paused at 14:00
+			{Kind: storage.GapIdle, StartTime: clock(5, 13, 55), EndTime: clock(5, 14, 20)},
+			// Idle turning into locked
+			{Kind: storage.GapIdle, StartTime: clock(6, 9, 30), EndTime: clock(6, 9, 35)},
+			{Kind: storage.GapLocked, StartTime: clock(6, 9, 35), EndTime: clock(6, 9, 40)},
+		},
+	}
+
+	days, err := DailyPresence(store, &storage.StatsQuery{}, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("DailyPresence failed: %v", err)
+	}
+
+	want := []DayPresence{
+		{
+			Date:             day("2026-01-05"),
+			First:            clock(5, 10, 0),
+			Last:             clock(5, 17, 0),
+			PresenceSeconds:  16800, // 7h - 1h locked - 20m idle - 1h uncovered
+			TrackedSeconds:   16680,
+			LockedSeconds:    3600,
+			IdleSeconds:      1200,
+			UncoveredSeconds: 3600,
+		},
+		{
+			Date:            day("2026-01-06"),
+			First:           clock(6, 9, 0),
+			Last:            clock(6, 10, 0),
+			PresenceSeconds: 3000,
+			TrackedSeconds:  3000,
+			LockedSeconds:   300,
+			IdleSeconds:     300,
+		},
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Fatalf("Unexpected presence:\n got %+v\nwant %+v", days, want)
+	}
+
+	if got := days[0].UntrackedSeconds(); got != 120 {
+		t.Errorf("Expected the short idle to be untracked presence, got %ds", got)
+	}
+	if got := fmt.Sprintf("%.2f", days[0].UntrackedPercent()); got != "0.71" {
+		t.Errorf("Expected 0.71%% untracked, got %s", got)
+	}
+	if got := days[1].UntrackedSeconds(); got != 0 {
+		t.Errorf("Expected nothing untracked on the second day, got %ds", got)
+	}
+}
+
+func TestPresenceSplitsAtMidnight(t *testing.T) {
+	withLocal(t, time.UTC)
+	late := sessionAt("editor", time.Date(2026, 1, 5, 23, 30, 0, 0, time.UTC), 3600)
+
+	days := Presence([]*storage.Session{late}, nil, 5*time.Minute)
+	if len(days) != 2 {
+		t.Fatalf("Expected 2 days, got %d", len(days))
+	}
+	for _, d := range days {
+		if d.PresenceSeconds != 1800 || d.TrackedSeconds != 1800 {
+			t.Errorf("Expected 30m on %s, got %+v", d.Date.Format("2006-01-02"), d)
+		}
+	}
+}
+
+func TestUnsavedSkipsStoredCheckpoints(t *testing.T) {
+	start := time.Date(2026, 1, 5, 14, 0, 0, 0, time.Local)
+	session := func(app, title string, offset, seconds int64) *storage.Session {
+		s := start.Add(time.Duration(offset) * time.Second)
+		return &storage.Session{
+			AppName:         app,
+			WindowTitle:     title,
+			StartTime:       s,
+			EndTime:         s.Add(time.Duration(seconds) * time.Second),
+			DurationSeconds: seconds,
+		}
+	}
+
+	// The open session was checkpointed twice; a finished one was flushed
+	persisted := []*storage.Session{
+		session("editor", "main.go", 0, 60),
+		session("editor", "main.go", 0, 120),
+		session("browser", "docs", -600, 300),
+	}
+	live := []*storage.Session{
+		session("editor", "main.go", 0, 200),
+		session("browser", "docs", -600, 300),
+		session("editor", "util.go", 0, 30),
+		session("chat", "general", 200, 40),
+	}
+
+	var got []string
+	for _, s := range Unsaved(persisted, live) {
+		got = append(got, fmt.Sprintf("%s/%s/%d", s.AppName, s.WindowTitle, s.DurationSeconds))
+	}
+	want := []string{"editor/main.go/80", "editor/util.go/30", "chat/general/40"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	rows := SessionDailyStats(Unsaved(persisted, live))
+	totals := SumByApp(rows)
+	if len(totals) != 2 || totals[0].AppName != "editor" || totals[0].TotalSeconds != 110 || totals[1].TotalSeconds != 40 {
+		t.Errorf("Unexpected unsaved totals %+v", totals)
+	}
+	if len(rows) != 2 || rows[0].Date.Format(storage.DateLayout) != "2026-01-05" {
+		t.Errorf("Expected one row per app on 2026-01-05, got %d rows", len(rows))
+	}
+}
+
+func TestCoalesceSessions(t *testing.T) {
+	start := time.Date(2026, 1, 5, 14, 0, 0, 0, time.Local)
+	session := func(app, title string, offset, seconds int64) *storage.Session {
+		s := start.Add(time.Duration(offset) * time.Second)
+		return &storage.Session{
+			AppName:         app,
+			WindowTitle:     title,
+			StartTime:       s,
+			EndTime:         s.Add(time.Duration(seconds) * time.Second),
+			DurationSeconds: seconds,
+		}
+	}
+
+	// Focus flickered between two editor titles; the browser interrupts
+	sessions := []*storage.Session{
+		session("editor", "a.go", 0, 10),
+		session("editor", "b.go", 11, 30),
+		session("Editor", "a.go", 42, 5),
+		session("browser", "docs", 47, 60),
+		session("editor", "a.go", 108, 10),
+	}
+
+	tests := []struct {
+		name    string
+		byTitle bool
+		want    []string
+	}{
+		{"by app", false, []string{"editor/b.go/45s", "browser/docs/1m0s", "editor/a.go/10s"}},
+		{"by title", true, []string{"editor/a.go/10s", "editor/b.go/30s", "Editor/a.go/5s", "browser/docs/1m0s", "editor/a.go/10s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range CoalesceSessions(sessions, 2*time.Second, tt.byTitle) {
+				got = append(got, s.AppName+"/"+s.WindowTitle+"/"+time.Duration(s.DurationSeconds*int64(time.Second)).String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// The input is left as it was
+	if sessions[0].DurationSeconds != 10 || sessions[0].WindowTitle != "a.go" {
+		t.Errorf("Expected the input untouched, got %+v", sessions[0])
+	}
+}
+
+func TestCoalesceSessionsPreservesTotalsAndOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	apps := []string{"editor", "browser", "chat"}
+
+	for round := 0; round < 200; round++ {
+		var sessions []*storage.Session
+		var total int64
+		at := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+		for i := rng.Intn(50); i >= 0; i-- {
+			seconds := int64(rng.Intn(30) + 1)
+			sessions = append(sessions, &storage.Session{
+				AppName:         apps[rng.Intn(len(apps))],
+				WindowTitle:     fmt.Sprintf("title %d", rng.Intn(3)),
+				StartTime:       at,
+				EndTime:         at.Add(time.Duration(seconds) * time.Second),
+				DurationSeconds: seconds,
+			})
+			total += seconds
+			at = at.Add(time.Duration(seconds+int64(rng.Intn(5))) * time.Second)
+		}
+
+		maxGap := time.Duration(rng.Intn(4)) * time.Second
+		merged := CoalesceSessions(sessions, maxGap, rng.Intn(2) == 0)
+
+		var sum int64
+		for i, s := range merged {
+			sum += s.DurationSeconds
+			if i > 0 && s.StartTime.Before(merged[i-1].EndTime) {
+				t.Fatalf("Round %d: session %d starts before the previous one ends", round, i)
+			}
+		}
+		if sum != total {
+			t.Fatalf("Round %d: expected %ds in total, got %ds", round, total, sum)
+		}
+		if len(merged) > len(sessions) {
+			t.Fatalf("Round %d: coalescing added sessions", round)
+		}
+	}
+}
+
+func TestPivotFillsMissingDates(t *testing.T) {
+	rows := []*storage.DailyStats{
+		daily("2026-01-08", "editor", 600),
+		daily("2026-01-05", "editor", 1800),
+		daily("2026-01-05", "browser", 900),
+	}
+
+	table := WideTable(Pivot(rows, time.Time{}, time.Time{}, 0), UnitMinutes, 1)
+	want := [][]string{
+		{"Date", "editor", "browser", "Total"},
+		{"2026-01-05", "30.0", "15.0", "45.0"},
+		{"2026-01-06", "0.0", "0.0", "0.0"},
+		{"2026-01-07", "0.0", "0.0", "0.0"},
+		{"2026-01-08", "10.0", "0.0", "10.0"},
+		{"Total", "40.0", "15.0", "55.0"},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("Expected %v, got %v", want, table)
+	}
+
+	// An explicit range adds days without data at both ends
+	matrix := Pivot(rows, day("2026-01-04"), day("2026-01-09"), 0)
+	if len(matrix.Dates) != 6 {
+		t.Errorf("Expected 6 days, got %d", len(matrix.Dates))
+	}
+
+	if got := WideTable(Pivot(nil, time.Time{}, time.Time{}, 0), UnitSeconds, 0); len(got) != 2 {
+		t.Errorf("Expected only a header and a total row, got %v", got)
+	}
+}
+
+func TestPivotGroupsOtherApps(t *testing.T) {
+	rows := []*storage.DailyStats{
+		daily("2026-01-05", "editor", 7200),
+		daily("2026-01-05", "browser", 3600),
+		daily("2026-01-05", "chat", 900),
+		daily("2026-01-06", "music", 1800),
+		daily("2026-01-06", "Chat", 900),
+	}
+
+	table := WideTable(Pivot(rows, time.Time{}, time.Time{}, 2), UnitHours, 2)
+	want := [][]string{
+		{"Date", "editor", "browser", "Other", "Total"},
+		{"2026-01-05", "2.00", "1.00", "0.25", "3.25"},
+		{"2026-01-06", "0.00", "0.00", "0.75", "0.75"},
+		{"Total", "2.00", "1.00", "1.00", "4.00"},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("Expected %v, got %v", want, table)
+	}
+
+	// No Other column when every app fits
+	if matrix := Pivot(rows, time.Time{}, time.Time{}, 4); len(matrix.Apps) != 4 || matrix.Apps[3] == OtherApp {
+		t.Errorf("Expected the 4 apps without Other, got %v", matrix.Apps)
+	}
+}
+
+func TestLaunches(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	session := func(app string, offset, seconds time.Duration) *storage.Session {
+		s := start.Add(offset)
+		return &storage.Session{AppName: app, StartTime: s, EndTime: s.Add(seconds), DurationSeconds: int64(seconds.Seconds())}
+	}
+
+	tests := []struct {
+		name     string
+		sessions []*storage.Session
+		want     map[string]int
+	}{
+		{
+			name: "back-to-back switches",
+			sessions: []*storage.Session{
+				session("editor", 0, time.Minute),
+				session("browser", time.Minute, time.Minute),
+				session("editor", 2*time.Minute, time.Minute),
+				session("Browser", 3*time.Minute, time.Minute),
+			},
+			want: map[string]int{"editor": 2, "browser": 2},
+		},
+		{
+			name: "resuming after a short idle",
+			sessions: []*storage.Session{
+				session("editor", 0, time.Minute),
+				session("editor", 4*time.Minute, time.Minute),
+			},
+			want: map[string]int{"editor": 1},
+		},
+		{
+			name: "resuming after a long idle",
+			sessions: []*storage.Session{
+				session("editor", 0, time.Minute),
+				session("editor", 6*time.Minute, time.Minute),
+			},
+			want: map[string]int{"editor": 2},
+		},
+		{
+			name: "another title of the same app",
+			sessions: []*storage.Session{
+				{AppName: "editor", WindowTitle: "a.go", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60},
+				{AppName: "editor", WindowTitle: "b.go", StartTime: start.Add(time.Minute), EndTime: start.Add(2 * time.Minute), DurationSeconds: 60},
+			},
+			want: map[string]int{"editor": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LaunchesByApp(Launches(tt.sessions, DefaultLaunchGap))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// Launches are counted per day
+	launches := Launches([]*storage.Session{
+		session("editor", 0, time.Minute),
+		session("editor", 24*time.Hour, time.Minute),
+	}, DefaultLaunchGap)
+	if len(launches) != 2 || launches[1].Date.Format("2006-01-02") != "2026-01-06" {
+		t.Errorf("Expected one launch on each day, got %+v", launches)
+	}
+}
+
+func TestSessionLengthStats(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	offset := int64(0)
+	session := func(app string, seconds int64) *storage.Session {
+		s := start.Add(time.Duration(offset) * time.Second)
+		offset += seconds + 600
+		return &storage.Session{AppName: app, StartTime: s, EndTime: s.Add(time.Duration(seconds) * time.Second), DurationSeconds: seconds}
+	}
+
+	// Many quick looks and one long stretch: the mean is pulled far above
+	// the median
+	sessions := []*storage.Session{
+		session("editor", 60),
+		session("browser", 10),
+		session("editor", 60),
+		session("Editor", 60),
+		session("browser", 20),
+		session("editor", 60),
+		session("editor", 3600),
+		session("chat", 30),
+		session("chat", 0),
+	}
+
+	got := SessionLengthStats(sessions, SessionLengthOptions{})
+	for i := range got {
+		round := func(v float64) float64 { return math.Round(v*1000) / 1000 }
+		got[i].Mean, got[i].Median, got[i].P90 = round(got[i].Mean), round(got[i].Median), round(got[i].P90)
+	}
+	want := []SessionLength{
+		{AppName: "Editor", Count: 5, Total: 3840, Mean: 768, Median: 60, P90: 2184, Max: 3600},
+		{AppName: "browser", Count: 2, Total: 30, Mean: 15, Median: 15, P90: 19, Max: 20},
+		{AppName: "chat", Count: 1, Total: 30, Mean: 30, Median: 30, P90: 30, Max: 30},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// Coalescing first measures runs of one app as single sessions
+	quick := []*storage.Session{session("editor", 60)}
+	quick = append(quick, &storage.Session{AppName: "editor", StartTime: quick[0].EndTime.Add(30 * time.Second), EndTime: quick[0].EndTime.Add(90 * time.Second), DurationSeconds: 60})
+	got = SessionLengthStats(quick, SessionLengthOptions{Coalesce: 2 * time.Minute})
+	if len(got) != 1 || got[0].Count != 1 || got[0].Max != 120 {
+		t.Errorf("Expected one coalesced session of 120s, got %+v", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		values []int64
+		p      float64
+		want   float64
+	}{
+		{nil, 0.5, 0},
+		{[]int64{7}, 0.5, 7},
+		{[]int64{7}, 0.9, 7},
+		{[]int64{10, 20}, 0.5, 15},
+		{[]int64{10, 20}, 0.9, 19},
+		{[]int64{10, 20, 30}, 0.5, 20},
+		{[]int64{10, 20, 30, 40}, 0.5, 25},
+		{[]int64{10, 20, 30, 40}, 0.9, 37},
+		{[]int64{10, 20, 30, 40}, 1, 40},
+		{[]int64{10, 20, 30, 40}, 0, 10},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.values, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestDomainTotals(t *testing.T) {
+	session := func(app, domain string, seconds int64) *storage.Session {
+		return &storage.Session{AppName: app, Domain: domain, DurationSeconds: seconds}
+	}
+	sessions := []*storage.Session{
+		session("firefox", "github.com", 600),
+		session("chrome", "mail.google.com", 300),
+		session("Firefox", "GitHub.com", 120),
+		session("firefox", "youtube.com", 900),
+		session("chrome", "github.com", 300),
+		session("firefox", "", 5000),
+		session("editor", "", 7000),
+		session("chrome", "x.com", 0),
+	}
+
+	got := DomainTotals(sessions)
+	want := []DomainTotal{
+		{AppName: "Firefox", Domain: "youtube.com", Seconds: 900},
+		{AppName: "Firefox", Domain: "GitHub.com", Seconds: 720},
+		{AppName: "chrome", Domain: "github.com", Seconds: 300},
+		{AppName: "chrome", Domain: "mail.google.com", Seconds: 300},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestMonitorTotals(t *testing.T) {
+	first, second := 0, 1
+	session := func(monitor *int, seconds int64) *storage.Session {
+		return &storage.Session{AppName: "editor", MonitorIndex: monitor, DurationSeconds: seconds}
+	}
+	sessions := []*storage.Session{
+		session(&second, 300),
+		session(nil, 200),
+		session(&first, 600),
+		session(&second, 100),
+		session(&first, 0),
+	}
+
+	got := MonitorTotals(sessions)
+	want := []MonitorTotal{
+		{MonitorIndex: &first, Seconds: 600},
+		{MonitorIndex: &second, Seconds: 400},
+		{Seconds: 200},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
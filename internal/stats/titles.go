@@ -0,0 +1,49 @@
+package stats
+
+import (
+	"sort"
+
+	"github.com/weii/actime/internal/appname"
+	"github.com/weii/actime/internal/storage"
+)
+
+// TitleTotal is the time spent under one window title
+type TitleTotal struct {
+	Title   string
+	Seconds int64
+}
+
+// AddTitleSessions adds sessions, such as the live ones not yet saved, to
+// the per-title totals from storage.DB.GetTitleStats. Titles are cleaned
+// as GetTitleStats does, and the result is largest first with ties ordered
+// by title.
+func AddTitleSessions(stored []*storage.TitleStats, sessions []*storage.Session) []TitleTotal {
+	merged := make(map[string]*TitleTotal)
+	add := func(title string, seconds int64) {
+		title = appname.Clean(title)
+		total, ok := merged[title]
+		if !ok {
+			total = &TitleTotal{Title: title}
+			merged[title] = total
+		}
+		total.Seconds += seconds
+	}
+	for _, stat := range stored {
+		add(stat.WindowTitle, stat.TotalSeconds)
+	}
+	for _, session := range sessions {
+		add(session.WindowTitle, session.DurationSeconds)
+	}
+
+	result := make([]TitleTotal, 0, len(merged))
+	for _, total := range merged {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Seconds != result[j].Seconds {
+			return result[i].Seconds > result[j].Seconds
+		}
+		return result[i].Title < result[j].Title
+	})
+	return result
+}
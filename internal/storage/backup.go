@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// backupPattern matches the names BackupName gives, and only those are
+// removed by PruneBackups
+const backupPattern = "actime-????????-??????.db"
+
+// BackupName returns the file name of a backup taken at t. Names sort in
+// the order the backups were taken.
+func BackupName(t time.Time) string {
+	return "actime-" + t.Format("20060102-150405") + ".db"
+}
+
+// BackupTo writes a consistent copy of the database to path while it stays
+// in use. The copy is taken with VACUUM INTO on a read-only connection of
+// its own, so it sees a single snapshot of the database and writers carry
+// on meanwhile. It is written next to path, checked and synced before it is
+// renamed into place, so path never holds a partial copy. An existing file
+// at path is not overwritten.
+func (db *DB) BackupTo(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup target already exists: %s", path)
+	}
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat database: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// The query_only read pool refuses VACUUM INTO, but a connection
+	// opened read-only may write the copy
+	conn, err := sql.Open("sqlite", readOnlyDSN(db.path, info))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	conn.SetMaxOpenConns(1)
+	defer conn.Close()
+
+	// Left over by an interrupted backup; VACUUM INTO refuses to overwrite
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale backup: %w", err)
+	}
+	if _, err := conn.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	if err := conn.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+
+	if err := verifyCopy(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	return nil
+}
+
+// PruneBackups removes the oldest backups in dir, keeping the newest keep.
+// Only files named by BackupName are considered. It returns the paths it
+// removed.
+func PruneBackups(dir string, keep int) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, backupPattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	keep = max(keep, 0)
+	if len(paths) <= keep {
+		return nil, nil
+	}
+
+	sort.Strings(paths)
+	var removed []string
+	for _, path := range paths[:len(paths)-keep] {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RowError is a session of a batch that could not be written
+type RowError struct {
+	Session *Session
+	Err     error
+}
+
+// BatchError is returned by the batch writes when some sessions could not
+// be written. The other sessions of the batch were committed.
+type BatchError struct {
+	Failed []RowError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Failed) == 1 {
+		return fmt.Sprintf("failed to write 1 session: %v", e.Failed[0].Err)
+	}
+	return fmt.Sprintf("failed to write %d sessions, first: %v", len(e.Failed), e.Failed[0].Err)
+}
+
+// Sessions returns the sessions that could not be written
+func (e *BatchError) Sessions() []*Session {
+	sessions := make([]*Session, len(e.Failed))
+	for i, failed := range e.Failed {
+		sessions[i] = failed.Session
+	}
+	return sessions
+}
+
+// AsBatchError returns the BatchError in err's chain, if any
+func AsBatchError(err error) (*BatchError, bool) {
+	var batchErr *BatchError
+	ok := errors.As(err, &batchErr)
+	return batchErr, ok
+}
+
+// checkSession rejects sessions no write path can store sensibly, so one
+// bad row is reported instead of being written
+func checkSession(session *Session) error {
+	switch {
+	case session == nil:
+		return fmt.Errorf("missing session")
+	case session.AppName == "":
+		return fmt.Errorf("missing app name")
+	case session.StartTime.IsZero():
+		return fmt.Errorf("missing start time")
+	case session.DurationSeconds < 0:
+		return fmt.Errorf("negative duration %d", session.DurationSeconds)
+	}
+	return nil
+}
+
+// batchResult collects the per-row errors of a batch
+type batchResult struct {
+	failed []RowError
+}
+
+// add records the error of session, if any, and reports whether it failed
+func (r *batchResult) add(session *Session, err error) bool {
+	if err == nil {
+		return false
+	}
+	r.failed = append(r.failed, RowError{Session: session, Err: err})
+	return true
+}
+
+// err returns a BatchError if any row failed
+func (r *batchResult) err() error {
+	if len(r.failed) == 0 {
+		return nil
+	}
+	return &BatchError{Failed: r.failed}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// readRetries is how many more times a read is tried when the database
+	// stayed busy for the whole busy timeout, as it can while another
+	// process checkpoints or recovers the WAL
+	readRetries = 3
+
+	// readRetryDelay is the pause before the first retry; it doubles for
+	// each one after
+	readRetryDelay = 50 * time.Millisecond
+)
+
+// IsBusy reports whether err means the database was locked by another
+// connection or process
+func IsBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return true
+		}
+	}
+	return false
+}
+
+// retryBusy calls fn until it returns an error other than a busy one, or
+// retries more times, and returns its last error. It stops waiting when
+// ctx is done.
+func retryBusy(ctx context.Context, retries int, fn func() error) error {
+	delay := readRetryDelay
+	err := fn()
+	for i := 0; i < retries && IsBusy(err); i++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+		err = fn()
+	}
+	return err
+}
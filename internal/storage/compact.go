@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Compact rebuilds the database in place with VACUUM, returning the free
+// pages left by deleted rows to the file system, and reports the size of the
+// database and its write-ahead log before and after. Unlike SecureCompact it
+// works on an open database, but other processes reading it make the final
+// checkpoint leave the log behind until they are done.
+func (db *DB) Compact() (before, after int64, err error) {
+	if err := db.checkpoint(); err != nil {
+		return 0, 0, err
+	}
+	if before, err = db.fileSize(); err != nil {
+		return 0, 0, err
+	}
+	if _, err := db.conn.Exec("VACUUM"); err != nil {
+		return 0, 0, fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	// VACUUM goes through the log; moving it back shrinks the main file
+	if err := db.checkpoint(); err != nil {
+		return 0, 0, err
+	}
+	if after, err = db.fileSize(); err != nil {
+		return 0, 0, err
+	}
+	return before, after, nil
+}
+
+// checkpoint moves the write-ahead log into the main file and empties it
+func (db *DB) checkpoint() error {
+	var busy, logged, checkpointed int
+	if err := db.conn.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logged, &checkpointed); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// fileSize returns the size of the database file and its write-ahead log
+func (db *DB) fileSize() (int64, error) {
+	var size int64
+	for _, name := range []string{db.path, db.path + "-wal"} {
+		info, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat database: %w", err)
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// SecureCompact rewrites the database at path into a new file holding only
+// its live rows, so rows deleted earlier cannot be recovered from free pages
+// or an old write-ahead log. The copy is written next to the database with
+// VACUUM INTO and checked before it replaces the original, which is left in
+// place until then; a crash leaves either the old or the new file, never a
+// mix. Page size and other header settings carry over, and the copy is
+// opened in WAL mode like any database.
+//
+// No other connection may have the database open, as it would keep writing
+// to the replaced file.
+func SecureCompact(path string) error {
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)",
+		filepath.ToSlash(path), DefaultBusyTimeout.Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	conn.SetMaxOpenConns(1)
+	defer conn.Close()
+
+	// Move everything into the main file and empty the log, which may
+	// still hold pages of deleted rows
+	var busy, logged, checkpointed int
+	if err := conn.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logged, &checkpointed); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("database is in use by another connection")
+	}
+
+	tmp := fmt.Sprintf("%s.compact-%s", path, time.Now().Format("20060102-150405"))
+	if _, err := os.Stat(tmp); err == nil {
+		return fmt.Errorf("compaction target already exists: %s", tmp)
+	}
+	if _, err := conn.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rewrite database: %w", err)
+	}
+	if err := conn.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+
+	if err := verifyCopy(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// The log was emptied above and is removed on close. One left over now
+	// would be replayed into the new file, so it is better to stop here.
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 {
+		os.Remove(tmp)
+		return fmt.Errorf("database is in use by another connection")
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to remove %s: %w", filepath.Base(path+suffix), err)
+		}
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace database: %w", err)
+	}
+	return nil
+}
+
+// verifyCopy checks a copy written with VACUUM INTO and syncs it to disk
+// before it is moved into place
+func verifyCopy(path string) error {
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)", filepath.ToSlash(path)))
+	if err != nil {
+		return fmt.Errorf("failed to open database copy: %w", err)
+	}
+	err = checkIntegrity(conn)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("database copy failed the integrity check: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open database copy: %w", err)
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync database copy: %w", err)
+	}
+	return nil
+}
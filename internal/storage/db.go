@@ -1,40 +1,169 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
+	"github.com/weii/actime/internal/title"
 	_ "modernc.org/sqlite"
 )
 
-// DB represents the database connection
+// ErrDatabaseNotFound is returned by OpenReadOnly when the database file does not exist
+var ErrDatabaseNotFound = errors.New("database not found")
+
+// Defaults for Options
+const (
+	DefaultMaxReadConns = 4
+	DefaultBusyTimeout  = 5 * time.Second
+)
+
+// Options tunes the connections opened by NewDBWithOptions
+type Options struct {
+	// MaxReadConns limits the pool used for queries
+	MaxReadConns int
+	// BusyTimeout is how long a connection waits for a lock held by another
+	// connection or process before failing with SQLITE_BUSY
+	BusyTimeout time.Duration
+	// SlowQuery is the duration above which a statement is logged at debug
+	// level
+	SlowQuery time.Duration
+}
+
+// withDefaults fills unset options
+func (o Options) withDefaults() Options {
+	if o.MaxReadConns <= 0 {
+		o.MaxReadConns = DefaultMaxReadConns
+	}
+	if o.BusyTimeout <= 0 {
+		o.BusyTimeout = DefaultBusyTimeout
+	}
+	if o.SlowQuery <= 0 {
+		o.SlowQuery = DefaultSlowQuery
+	}
+	return o
+}
+
+// DB represents the database connection. All writes go through a single
+// writer connection, so writers in this process queue in database/sql
+// instead of competing for the SQLite lock; queries use a separate pool.
 type DB struct {
-	conn *sql.DB
+	conn *handle   // writer, at most one connection
+	read *handle   // readers
+	snap *snapshot // set on views made by Snapshot
+	slow *slowQueries
 	path string
 }
 
-// NewDB creates a new database connection
+// NewDB creates a new database connection with default options
 func NewDB(path string) (*DB, error) {
-	conn, err := sql.Open("sqlite", path)
+	return NewDBWithOptions(path, Options{})
+}
+
+// NewDBWithOptions creates a new database connection, creating the schema
+// if needed
+func NewDBWithOptions(path string, opts Options) (*DB, error) {
+	opts = opts.withDefaults()
+	busyTimeout := opts.BusyTimeout.Milliseconds()
+
+	// WAL lets readers, including other processes, keep reading while the
+	// writer commits; NORMAL sync is durable enough in WAL mode
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)",
+		filepath.ToSlash(path), busyTimeout))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	conn.SetMaxOpenConns(1)
+	conn.SetMaxIdleConns(1)
 
 	db := &DB{
-		conn: conn,
+		slow: newSlowQueries(opts.SlowQuery),
 		path: path,
 	}
+	db.conn = &handle{DB: conn, slow: db.slow}
 
-	// Initialize database schema
+	// Initialize database schema before readers may look at it. The whole
+	// file is only checked by CheckIntegrity; a damaged one is reported as
+	// ErrCorrupt by the first query that reaches a bad page.
 	if err := db.initSchema(); err != nil {
 		conn.Close()
+		if IsCorrupt(err) {
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, path, err)
+		}
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	// query_only keeps a write from slipping past the writer connection
+	read, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=query_only(1)",
+		filepath.ToSlash(path), busyTimeout))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	read.SetMaxOpenConns(opts.MaxReadConns)
+	read.SetMaxIdleConns(opts.MaxReadConns)
+	db.read = &handle{DB: read, slow: db.slow, retries: readRetries}
+
 	return db, nil
 }
 
+// OpenReadOnly opens an existing database for reading only. The schema is
+// not created, and a missing file is reported as ErrDatabaseNotFound instead
+// of creating an empty database. Files without write permission, such as
+// backups, are opened as immutable so no locks or journals are needed.
+func OpenReadOnly(path string) (*DB, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat database: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("database path is a directory: %s", path)
+	}
+
+	conn, err := sql.Open("sqlite", readOnlyDSN(path, info))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Fail early when the file is not a database
+	if _, err := conn.Exec("SELECT count(*) FROM sqlite_master"); err != nil {
+		conn.Close()
+		if IsCorrupt(err) {
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, path, err)
+		}
+		return nil, fmt.Errorf("failed to read database: %w", err)
+	}
+
+	// Writes fail on this connection, so it doubles as the writer
+	slow := newSlowQueries(DefaultSlowQuery)
+	read := &handle{DB: conn, slow: slow, retries: readRetries}
+	return &DB{
+		conn: read,
+		read: read,
+		slow: slow,
+		path: path,
+	}, nil
+}
+
+// readOnlyDSN returns the data source name that opens the database at path
+// for reading only, as immutable when the file has no write permission
+func readOnlyDSN(path string, info os.FileInfo) string {
+	dsn := fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(%d)",
+		filepath.ToSlash(path), DefaultBusyTimeout.Milliseconds())
+	if info.Mode().Perm()&0222 == 0 {
+		dsn += "&immutable=1"
+	}
+	return dsn
+}
+
 // initSchema creates the database tables if they don't exist
 func (db *DB) initSchema() error {
 	schema := `
@@ -42,47 +171,260 @@ func (db *DB) initSchema() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		app_name TEXT NOT NULL,
 		window_title TEXT,
+		raw_title TEXT,
+		domain TEXT,
+		exe_path TEXT,
+		monitor_index INTEGER,
+		workspace INTEGER,
 		start_time DATETIME NOT NULL,
 		end_time DATETIME,
 		duration_seconds INTEGER NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		source TEXT NOT NULL DEFAULT 'tracker',
+		category TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_sessions_app_name ON sessions(app_name);
 	CREATE INDEX IF NOT EXISTS idx_sessions_start_time ON sessions(start_time);
 
+	-- Applications are grouped and filtered case-insensitively
+	CREATE INDEX IF NOT EXISTS idx_sessions_app_name_nocase ON sessions(app_name COLLATE NOCASE);
+
+	-- Periods the tracker paused because the screen was locked or the user
+	-- was idle
+	CREATE TABLE IF NOT EXISTS gaps (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_gaps_start_time ON gaps(start_time);
+
+	-- Maintenance that rewrote stored data, such as scrubbing titles
+	CREATE TABLE IF NOT EXISTS maintenance_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		rows_affected INTEGER NOT NULL DEFAULT 0,
+		performed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	` + schemaVersionTable + dailyStatsTable + dailyStatsIndexes
+
+	_, err := db.conn.Exec(schema)
+	if err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	if err := db.migrate(); err != nil {
+		return err
+	}
+
+	// Imported and merged sessions are identified by their source and
+	// start, so importing the same file twice does not duplicate them
+	if _, err := db.conn.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_import_key
+	ON sessions(source, app_name, window_title, start_time) WHERE source NOT IN ('tracker', 'manual')
+	`); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	if _, err := db.conn.Exec("CREATE INDEX IF NOT EXISTS idx_sessions_source ON sessions(source, start_time)"); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	return nil
+}
+
+// sessionTriggers keep sessions.updated_at: a new session starts with its
+// created_at, and any change to its data moves it to now. Keeping it in
+// triggers covers every write path, including renames, scrubs and repairs.
+const sessionTriggers = `
+	CREATE TRIGGER IF NOT EXISTS sessions_updated_at_insert
+	AFTER INSERT ON sessions WHEN NEW.updated_at IS NULL
+	BEGIN
+		UPDATE sessions SET updated_at = NEW.created_at WHERE id = NEW.id;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS sessions_updated_at_update
+	AFTER UPDATE OF app_name, window_title, raw_title, start_time, end_time, duration_seconds, source ON sessions
+	BEGIN
+		UPDATE sessions SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.id;
+	END;
+`
+
+// migrateUpdatedAt adds sessions.updated_at to databases created before it
+// existed, starting every row at its created_at, and creates the triggers
+// that maintain it
+func migrateUpdatedAt(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "sessions", "updated_at")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := addColumn(tx, "sessions", "updated_at", "DATETIME"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE sessions SET updated_at = created_at WHERE updated_at IS NULL"); err != nil {
+			return fmt.Errorf("failed to backfill updated_at: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(sessionTriggers); err != nil {
+		return fmt.Errorf("failed to create triggers: %w", err)
+	}
+	return nil
+}
+
+// migrateSourceNames names the sources of rows written before sources were
+// named: tracked rows had an empty source and imported rows the bare tool
+// name. Databases from that time have idx_sessions_source_key, which only
+// covered imported rows and is dropped here, so this runs once.
+func migrateSourceNames(tx *sql.Tx) error {
+	var count int
+	if err := tx.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_sessions_source_key'",
+	).Scan(&count); err != nil {
+		return fmt.Errorf("failed to inspect indexes: %w", err)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	// The old index would reject tracked rows once they share a source
+	statements := []string{"DROP INDEX idx_sessions_source_key"}
+	for _, table := range []string{"sessions", "daily_stats"} {
+		statements = append(statements,
+			fmt.Sprintf("UPDATE %s SET source = '%s' WHERE source = ''", table, SourceTracker),
+			fmt.Sprintf("UPDATE %s SET source = '%s' || source WHERE source NOT IN ('%s', '%s') AND instr(source, ':') = 0",
+				table, SourceImportPrefix, SourceTracker, SourceManual),
+		)
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to migrate sources: %w", err)
+		}
+	}
+	return nil
+}
+
+// sourceOf returns the source to store for a row, the tracker by default
+func sourceOf(source string) string {
+	if source == "" {
+		return SourceTracker
+	}
+	return source
+}
+
+// dailyStatsTable creates daily_stats. Rows are kept per source, so
+// imported totals can be replaced or deleted without touching tracked ones.
+const dailyStatsTable = `
 	CREATE TABLE IF NOT EXISTS daily_stats (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		app_name TEXT NOT NULL,
 		date DATE NOT NULL,
 		total_seconds INTEGER NOT NULL,
-		UNIQUE(app_name, date)
+		source TEXT NOT NULL DEFAULT 'tracker',
+		UNIQUE(app_name, date, source)
 	);
+`
 
+// dailyStatsIndexes creates the daily_stats indexes
+const dailyStatsIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_daily_stats_date ON daily_stats(date);
-	`
+	CREATE INDEX IF NOT EXISTS idx_daily_stats_app_name_nocase ON daily_stats(app_name COLLATE NOCASE, date);
+`
 
-	_, err := db.conn.Exec(schema)
+// migrateDailyStatsSource rebuilds a daily_stats table created before the
+// source column. The unique constraint changes, which ALTER TABLE cannot do.
+func migrateDailyStatsSource(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "daily_stats", "source")
+	if err != nil || exists {
+		return err
+	}
+
+	for _, stmt := range []string{
+		"ALTER TABLE daily_stats RENAME TO daily_stats_old",
+		dailyStatsTable,
+		`INSERT INTO daily_stats (id, app_name, date, total_seconds)
+		SELECT id, app_name, date, total_seconds FROM daily_stats_old`,
+		"DROP TABLE daily_stats_old",
+		dailyStatsIndexes,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to migrate daily_stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether a table has the given column
+func (db *DB) hasColumn(table, column string) (bool, error) {
+	return columnExists(db.conn, table, column)
+}
+
+// columnExists reports whether a table has the given column, as seen by q
+func columnExists(q querier, table, column string) (bool, error) {
+	rows, err := q.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
 	if err != nil {
-		return fmt.Errorf("failed to create schema: %w", err)
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, fmt.Errorf("failed to scan column: %w", err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+
+	return false, nil
+}
+
+// addColumn adds a column to an existing table unless it is already there
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
 	}
 
 	return nil
 }
 
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 // InsertSession inserts a new session into the database
 func (db *DB) InsertSession(session *Session) error {
 	query := `
-	INSERT INTO sessions (app_name, window_title, start_time, end_time, duration_seconds)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO sessions (app_name, window_title, raw_title, domain, exe_path, monitor_index, workspace, start_time, end_time, duration_seconds, source)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := db.conn.Exec(query,
 		session.AppName,
-		session.WindowTitle,
+		title.Sanitize(session.WindowTitle),
+		nullString(session.RawTitle),
+		nullString(session.Domain),
+		nullString(session.ExePath),
+		session.MonitorIndex,
+		session.Workspace,
 		session.StartTime,
 		session.EndTime,
 		session.DurationSeconds,
+		sourceOf(session.Source),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert session: %w", err)
@@ -97,38 +439,80 @@ func (db *DB) InsertSession(session *Session) error {
 	return nil
 }
 
-// GetDailyStats retrieves daily statistics for the given date range
-func (db *DB) GetDailyStats(query *StatsQuery) ([]*DailyStats, error) {
-	sqlQuery := `
-	SELECT app_name, date, SUM(total_seconds) as total_seconds
-	FROM daily_stats
-	WHERE 1=1
-	`
+// dailyStatsFilter returns the conditions on daily_stats for the date
+// range, application and source of a query, to follow "WHERE 1=1"
+func dailyStatsFilter(query *StatsQuery) (string, []interface{}) {
+	// daily_stats.date is stored as YYYY-MM-DD text, so bind dates in the
+	// same form; binding a time.Time would compare against a full timestamp
+	filter := ""
 	args := []interface{}{}
-
 	if !query.StartDate.IsZero() {
-		sqlQuery += " AND date >= ?"
-		args = append(args, query.StartDate)
+		filter += " AND date >= ?"
+		args = append(args, query.StartDate.Format(DateLayout))
 	}
 
 	if !query.EndDate.IsZero() {
-		sqlQuery += " AND date <= ?"
-		args = append(args, query.EndDate)
+		filter += " AND date <= ?"
+		args = append(args, query.EndDate.Format(DateLayout))
 	}
 
 	if query.AppName != "" {
-		sqlQuery += " AND app_name = ?"
+		filter += " AND app_name = ? COLLATE NOCASE"
 		args = append(args, query.AppName)
 	}
 
-	sqlQuery += " GROUP BY app_name, date ORDER BY date DESC"
+	if query.Source != "" {
+		filter += " AND source = ?"
+		args = append(args, query.Source)
+	}
+	return filter, args
+}
+
+// GetDailyStats retrieves daily statistics for the given date range, one
+// row per application and day, ordered as the query asks
+func (db *DB) GetDailyStats(query *StatsQuery) ([]*DailyStats, error) {
+	return db.GetDailyStatsContext(context.Background(), query)
+}
+
+// GetDailyStatsContext is GetDailyStats with a context; cancelling it
+// aborts the query
+func (db *DB) GetDailyStatsContext(ctx context.Context, query *StatsQuery) ([]*DailyStats, error) {
+	sqlQuery := `
+	SELECT MIN(app_name), date, SUM(total_seconds) as total_seconds
+	FROM daily_stats
+	WHERE 1=1
+	`
+	orderBy, err := dailyStatsOrder(query)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, args := dailyStatsFilter(query)
+	sqlQuery += filter
+
+	// The top applications are ranked by their total over the same range
+	if query.TopApps > 0 {
+		sqlQuery += `
+		AND app_name COLLATE NOCASE IN (
+			SELECT MIN(app_name) FROM daily_stats WHERE 1=1` + filter + `
+			GROUP BY app_name COLLATE NOCASE
+			ORDER BY SUM(total_seconds) DESC, MIN(app_name) COLLATE NOCASE
+			LIMIT ?
+		)`
+		args = append(args, args...)
+		args = append(args, query.TopApps)
+	}
+
+	// Spellings that differ only in case are one application; the group is
+	// reported under its first spelling in sort order
+	sqlQuery += " GROUP BY app_name COLLATE NOCASE, date ORDER BY " + orderBy
 
 	if query.Limit > 0 {
 		sqlQuery += " LIMIT ?"
 		args = append(args, query.Limit)
 	}
 
-	rows, err := db.conn.Query(sqlQuery, args...)
+	rows, err := db.reader().QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query daily stats: %w", err)
 	}
@@ -140,27 +524,196 @@ func (db *DB) GetDailyStats(query *StatsQuery) ([]*DailyStats, error) {
 		if err := rows.Scan(&stat.AppName, &stat.Date, &stat.TotalSeconds); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
+		// Totals of all sources are added up unless the query names one
+		stat.Source = query.Source
 		stats = append(stats, &stat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate daily stats: %w", err)
+	}
 
 	return stats, nil
 }
 
-// Close closes the database connection
+// GetTopApps returns the total of each application over the query range,
+// largest first, summed in the database rather than from one row per
+// application and day. Dates, AppName and Source filter as for
+// GetDailyStats, and Limit, when positive, keeps that many applications.
+// Spellings that differ only in case are one application, reported under
+// the first in sort order.
+func (db *DB) GetTopApps(query *StatsQuery) ([]*AppTotal, error) {
+	return db.GetTopAppsContext(context.Background(), query)
+}
+
+// GetTopAppsContext is GetTopApps with a context; cancelling it aborts the
+// query
+func (db *DB) GetTopAppsContext(ctx context.Context, query *StatsQuery) ([]*AppTotal, error) {
+	filter, args := dailyStatsFilter(query)
+	sqlQuery := `
+	SELECT MIN(app_name), SUM(total_seconds) AS total
+	FROM daily_stats
+	WHERE 1=1` + filter + `
+	GROUP BY app_name COLLATE NOCASE
+	ORDER BY total DESC, MIN(app_name) COLLATE NOCASE, MIN(app_name)
+	`
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := db.reader().QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top apps: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []*AppTotal
+	for rows.Next() {
+		var total AppTotal
+		if err := rows.Scan(&total.AppName, &total.TotalSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		totals = append(totals, &total)
+	}
+	return totals, rows.Err()
+}
+
+// dailyStatsOrder returns the ORDER BY clause for GetDailyStats. Ties are
+// broken by the other key and then by name, so the order is stable.
+func dailyStatsOrder(query *StatsQuery) (string, error) {
+	direction := "DESC"
+	switch query.Direction {
+	case "", Descending:
+	case Ascending:
+		direction = "ASC"
+	default:
+		return "", fmt.Errorf("invalid direction: %s (expected %s or %s)", query.Direction, Ascending, Descending)
+	}
+
+	switch query.OrderBy {
+	case "", OrderByDate:
+		return "date " + direction + ", total_seconds DESC, MIN(app_name) COLLATE NOCASE, MIN(app_name)", nil
+	case OrderByTotal:
+		return "total_seconds " + direction + ", date DESC, MIN(app_name) COLLATE NOCASE, MIN(app_name)", nil
+	default:
+		return "", fmt.Errorf("invalid order: %s (expected %s or %s)", query.OrderBy, OrderByDate, OrderByTotal)
+	}
+}
+
+// GetSessions retrieves sessions that started within the given date range.
+// Both StartDate and EndDate are inclusive calendar days.
+func (db *DB) GetSessions(query *StatsQuery) ([]*Session, error) {
+	return db.GetSessionsContext(context.Background(), query)
+}
+
+// GetSessionsContext is GetSessions with a context; cancelling it aborts
+// the query
+func (db *DB) GetSessionsContext(ctx context.Context, query *StatsQuery) ([]*Session, error) {
+	sqlQuery := `
+	SELECT id, app_name, COALESCE(window_title, ''), COALESCE(raw_title, ''), COALESCE(domain, ''), COALESCE(exe_path, ''), monitor_index, workspace, start_time, end_time, duration_seconds, source, COALESCE(category, ''),
+		created_at, updated_at
+	FROM sessions
+	WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if !query.StartDate.IsZero() {
+		sqlQuery += " AND start_time >= ?"
+		args = append(args, dayStart(query.StartDate))
+	}
+
+	if !query.EndDate.IsZero() {
+		sqlQuery += " AND start_time < ?"
+		args = append(args, dayStart(query.EndDate).AddDate(0, 0, 1))
+	}
+
+	if query.AppName != "" {
+		sqlQuery += " AND app_name = ? COLLATE NOCASE"
+		args = append(args, query.AppName)
+	}
+
+	if query.Source != "" {
+		sqlQuery += " AND source = ?"
+		args = append(args, query.Source)
+	}
+
+	sqlQuery += " ORDER BY start_time ASC, id ASC"
+
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := db.reader().QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var session Session
+		var createdAt, updatedAt sql.NullTime
+		if err := rows.Scan(
+			&session.ID,
+			&session.AppName,
+			&session.WindowTitle,
+			&session.RawTitle,
+			&session.Domain,
+			&session.ExePath,
+			&session.MonitorIndex,
+			&session.Workspace,
+			&session.StartTime,
+			&session.EndTime,
+			&session.DurationSeconds,
+			&session.Source,
+			&session.Category,
+			&createdAt,
+			&updatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		session.CreatedAt = createdAt.Time
+		session.UpdatedAt = updatedAt.Time
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// dayStart returns midnight of the given day in the local time zone
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// Close closes the database connections
 func (db *DB) Close() error {
-	return db.conn.Close()
+	var readErr error
+	if db.read != db.conn {
+		readErr = db.read.Close()
+	}
+	if err := db.conn.Close(); err != nil {
+		return err
+	}
+	return readErr
 }
 
-// UpdateDailyStats updates or inserts daily statistics
+// UpdateDailyStats updates or inserts daily statistics. Only the day is
+// known, so the hourly statistics are left alone.
 func (db *DB) UpdateDailyStats(appName string, date time.Time, seconds int64) error {
 	query := `
-	INSERT INTO daily_stats (app_name, date, total_seconds)
-	VALUES (?, ?, ?)
-	ON CONFLICT(app_name, date) DO UPDATE SET
+	INSERT INTO daily_stats (app_name, date, total_seconds, source)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(app_name, date, source) DO UPDATE SET
 	total_seconds = total_seconds + ?
 	`
 
-	_, err := db.conn.Exec(query, appName, date, seconds, seconds)
+	_, err := db.conn.Exec(query, appName, date, seconds, SourceTracker, seconds)
 	if err != nil {
 		return fmt.Errorf("failed to update daily stats: %w", err)
 	}
@@ -168,13 +721,22 @@ func (db *DB) UpdateDailyStats(appName string, date time.Time, seconds int64) er
 	return nil
 }
 
-// BatchInsertSessions inserts multiple sessions in a single transaction
+// BatchInsertSessions inserts multiple sessions in a single transaction.
+// Sessions that cannot be written are skipped and returned in a
+// *BatchError; the others are committed.
 func (db *DB) BatchInsertSessions(sessions []*Session) error {
+	return db.BatchInsertSessionsContext(context.Background(), sessions)
+}
+
+// BatchInsertSessionsContext is BatchInsertSessions with a context. When
+// ctx is done before the commit, nothing is written and its error is
+// returned.
+func (db *DB) BatchInsertSessionsContext(ctx context.Context, sessions []*Session) error {
 	if len(sessions) == 0 {
 		return nil
 	}
 
-	tx, err := db.conn.Begin()
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -186,43 +748,67 @@ func (db *DB) BatchInsertSessions(sessions []*Session) error {
 	}()
 
 	query := `
-	INSERT INTO sessions (app_name, window_title, start_time, end_time, duration_seconds)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO sessions (app_name, window_title, raw_title, domain, exe_path, monitor_index, workspace, start_time, end_time, duration_seconds, source)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	stmt, err := tx.Prepare(query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
+	// A failed statement only undoes itself, so the rest of the batch
+	// can still be committed
+	var result batchResult
 	for _, session := range sessions {
-		_, err = stmt.Exec(
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf("failed to insert sessions: %w", err)
+		}
+		if result.add(session, checkSession(session)) {
+			continue
+		}
+		_, rowErr := stmt.ExecContext(ctx,
 			session.AppName,
-			session.WindowTitle,
+			title.Sanitize(session.WindowTitle),
+			nullString(session.RawTitle),
+			nullString(session.Domain),
+			nullString(session.ExePath),
+			session.MonitorIndex,
+			session.Workspace,
 			session.StartTime,
 			session.EndTime,
 			session.DurationSeconds,
+			sourceOf(session.Source),
 		)
-		if err != nil {
-			return fmt.Errorf("failed to insert session: %w", err)
+		if rowErr != nil {
+			result.add(session, fmt.Errorf("failed to insert session: %w", rowErr))
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	return result.err()
 }
 
-// UpdateDailyStatsBatch updates daily statistics for multiple sessions
+// UpdateDailyStatsBatch updates daily and hourly statistics for multiple
+// sessions. Like BatchInsertSessions, it commits what it can and returns the
+// sessions that could not be counted in a *BatchError.
 func (db *DB) UpdateDailyStatsBatch(sessions []*Session) error {
+	return db.UpdateDailyStatsBatchContext(context.Background(), sessions)
+}
+
+// UpdateDailyStatsBatchContext is UpdateDailyStatsBatch with a context.
+// When ctx is done before the commit, nothing is counted and its error is
+// returned.
+func (db *DB) UpdateDailyStatsBatchContext(ctx context.Context, sessions []*Session) error {
 	if len(sessions) == 0 {
 		return nil
 	}
 
-	tx, err := db.conn.Begin()
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -234,34 +820,1128 @@ func (db *DB) UpdateDailyStatsBatch(sessions []*Session) error {
 	}()
 
 	query := `
-	INSERT INTO daily_stats (app_name, date, total_seconds)
-	VALUES (?, ?, ?)
-	ON CONFLICT(app_name, date) DO UPDATE SET
+	INSERT INTO daily_stats (app_name, date, total_seconds, source)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(app_name, date, source) DO UPDATE SET
 	total_seconds = total_seconds + ?
 	`
 
-	stmt, err := tx.Prepare(query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
+	hourly, err := tx.PrepareContext(ctx, addHourlyStats)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer hourly.Close()
+
+	var result batchResult
 	for _, session := range sessions {
-		date := session.StartTime.Format("2006-01-02")
-		_, err = stmt.Exec(
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf("failed to update daily stats: %w", err)
+		}
+		if result.add(session, checkSession(session)) {
+			continue
+		}
+		date := session.StartTime.Format(DateLayout)
+		_, rowErr := stmt.ExecContext(ctx,
 			session.AppName,
 			date,
 			session.DurationSeconds,
+			sourceOf(session.Source),
 			session.DurationSeconds,
 		)
-		if err != nil {
-			return fmt.Errorf("failed to update daily stats: %w", err)
+		if rowErr != nil {
+			result.add(session, fmt.Errorf("failed to update daily stats: %w", rowErr))
+			continue
+		}
+		if rowErr := addSessionHours(hourly, session, sourceOf(session.Source)); rowErr != nil {
+			result.add(session, rowErr)
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
-}
\ No newline at end of file
+	return result.err()
+}
+
+// WriteSessions inserts sessions and counts them in the daily and hourly
+// statistics, each session in the same transaction as its totals. Writing a
+// later checkpoint of a stored session extends it instead. A session
+// that cannot be inserted or counted is undone on its own, so its row and
+// its totals never disagree, and returned in a *BatchError; the others are
+// committed.
+func (db *DB) WriteSessions(sessions []*Session) error {
+	return db.WriteSessionsContext(context.Background(), sessions)
+}
+
+// WriteSessionsContext is WriteSessions with a context. When ctx is done
+// before the commit, nothing is written and its error is returned.
+func (db *DB) WriteSessionsContext(ctx context.Context, sessions []*Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	find, err := tx.PrepareContext(ctx, `
+	SELECT id, duration_seconds FROM sessions
+	WHERE source = ? AND app_name = ? AND COALESCE(window_title, '') = ? AND start_time = ?
+	ORDER BY duration_seconds DESC LIMIT 1
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer find.Close()
+
+	insert, err := tx.PrepareContext(ctx, `
+	INSERT INTO sessions (app_name, window_title, raw_title, domain, exe_path, monitor_index, workspace, start_time, end_time, duration_seconds, source)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer insert.Close()
+
+	update, err := tx.PrepareContext(ctx, "UPDATE sessions SET end_time = ?, duration_seconds = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer update.Close()
+
+	daily, err := tx.PrepareContext(ctx, `
+	INSERT INTO daily_stats (app_name, date, total_seconds, source)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(app_name, date, source) DO UPDATE SET
+	total_seconds = total_seconds + excluded.total_seconds
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer daily.Close()
+
+	hourly, err := tx.PrepareContext(ctx, addHourlyStats)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer hourly.Close()
+
+	// Each session is written under a savepoint, so a failure undoes its
+	// row and whatever part of its totals was already added
+	var result batchResult
+	for _, session := range sessions {
+		if err = ctx.Err(); err != nil {
+			return fmt.Errorf("failed to write sessions: %w", err)
+		}
+		if result.add(session, checkSession(session)) {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, "SAVEPOINT session"); err != nil {
+			return fmt.Errorf("failed to create savepoint: %w", err)
+		}
+		rowErr := writeSession(ctx, &sessionWriter{find, insert, update, daily, hourly}, session)
+		if rowErr != nil {
+			result.add(session, rowErr)
+			if _, err = tx.ExecContext(ctx, "ROLLBACK TO session"); err != nil {
+				return fmt.Errorf("failed to roll back to savepoint: %w", err)
+			}
+		}
+		if _, err = tx.ExecContext(ctx, "RELEASE session"); err != nil {
+			return fmt.Errorf("failed to release savepoint: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result.err()
+}
+
+// sessionWriter holds the statements WriteSessionsContext writes with
+type sessionWriter struct {
+	find, insert, update, daily, hourly *sql.Stmt
+}
+
+// writeSession stores one session and adds it to the daily and hourly
+// statistics. A session already stored with the same app, title and start
+// is an earlier checkpoint of it: the row is extended and only the time it
+// grew by is added, so a session written on every flush counts once.
+func writeSession(ctx context.Context, w *sessionWriter, session *Session) error {
+	source := sourceOf(session.Source)
+	windowTitle := title.Sanitize(session.WindowTitle)
+
+	var id, stored int64
+	err := w.find.QueryRowContext(ctx, source, session.AppName, windowTitle, session.StartTime).Scan(&id, &stored)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to look up session: %w", err)
+	case stored >= session.DurationSeconds:
+		return nil
+	default:
+		if _, err := w.update.ExecContext(ctx, session.EndTime, session.DurationSeconds, id); err != nil {
+			return fmt.Errorf("failed to update session: %w", err)
+		}
+		return addSessionTime(ctx, w, session, stored, source)
+	}
+
+	if _, err := w.insert.ExecContext(ctx,
+		session.AppName,
+		windowTitle,
+		nullString(session.RawTitle),
+		nullString(session.Domain),
+		nullString(session.ExePath),
+		session.MonitorIndex,
+		session.Workspace,
+		session.StartTime,
+		session.EndTime,
+		session.DurationSeconds,
+		source,
+	); err != nil {
+		return fmt.Errorf("failed to insert session: %w", err)
+	}
+	return addSessionTime(ctx, w, session, 0, source)
+}
+
+// addSessionTime adds the time of a session past its first counted seconds
+// to the day it started and the hours it covered
+func addSessionTime(ctx context.Context, w *sessionWriter, session *Session, counted int64, source string) error {
+	seconds := session.DurationSeconds - counted
+	if _, err := w.daily.ExecContext(ctx, session.AppName, session.StartTime.Format(DateLayout), seconds, source); err != nil {
+		return fmt.Errorf("failed to update daily stats: %w", err)
+	}
+	return addSessionHours(w.hourly, &Session{
+		AppName:         session.AppName,
+		StartTime:       session.StartTime.Add(time.Duration(counted) * time.Second),
+		DurationSeconds: seconds,
+	}, source)
+}
+
+// GetAppNames returns every distinct application name in sessions and daily_stats
+func (db *DB) GetAppNames() ([]string, error) {
+	rows, err := db.reader().Query(`
+	SELECT app_name FROM sessions
+	UNION
+	SELECT app_name FROM daily_stats
+	ORDER BY app_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query app names: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// RenameApp renames an application in sessions, daily_stats and
+// hourly_stats. The old name matches regardless of case, as in the stats
+// queries, so every spelling is renamed; rows already named exactly to are
+// left as they are. Totals are merged into any existing rows of the new
+// name. It returns the number of sessions that were renamed.
+func (db *DB) RenameApp(from, to string) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE sessions SET app_name = ? WHERE app_name = ? COLLATE NOCASE AND app_name <> ?", to, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rename sessions: %w", err)
+	}
+	renamed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+	INSERT INTO daily_stats (app_name, date, total_seconds, source)
+	SELECT ?, date, total_seconds, source FROM daily_stats WHERE app_name = ? COLLATE NOCASE AND app_name <> ?
+	ON CONFLICT(app_name, date, source) DO UPDATE SET
+	total_seconds = total_seconds + excluded.total_seconds
+	`, to, from, to); err != nil {
+		return 0, fmt.Errorf("failed to merge daily stats: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM daily_stats WHERE app_name = ? COLLATE NOCASE AND app_name <> ?", from, to); err != nil {
+		return 0, fmt.Errorf("failed to delete merged daily stats: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+	INSERT INTO hourly_stats (app_name, date, hour, total_seconds, source)
+	SELECT ?, date, hour, total_seconds, source FROM hourly_stats WHERE app_name = ? COLLATE NOCASE AND app_name <> ?
+	ON CONFLICT(app_name, date, hour, source) DO UPDATE SET
+	total_seconds = total_seconds + excluded.total_seconds
+	`, to, from, to); err != nil {
+		return 0, fmt.Errorf("failed to merge hourly stats: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM hourly_stats WHERE app_name = ? COLLATE NOCASE AND app_name <> ?", from, to); err != nil {
+		return 0, fmt.Errorf("failed to delete merged hourly stats: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return renamed, nil
+}
+
+// CountAppSessions returns the number of sessions of an application,
+// matching its name regardless of case
+func (db *DB) CountAppSessions(appName string) (int64, error) {
+	var count int64
+	if err := db.reader().QueryRow("SELECT COUNT(*) FROM sessions WHERE app_name = ? COLLATE NOCASE", appName).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteApp deletes an application from sessions, daily_stats and
+// hourly_stats, matching its name regardless of case, and returns the
+// number of sessions that were deleted
+func (db *DB) DeleteApp(appName string) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM sessions WHERE app_name = ? COLLATE NOCASE", appName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM daily_stats WHERE app_name = ? COLLATE NOCASE", appName); err != nil {
+		return 0, fmt.Errorf("failed to delete daily stats: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM hourly_stats WHERE app_name = ? COLLATE NOCASE", appName); err != nil {
+		return 0, fmt.Errorf("failed to delete hourly stats: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// GetAppTitles returns every distinct application and window title pair
+func (db *DB) GetAppTitles() ([]*AppTitle, error) {
+	rows, err := db.reader().Query(`
+	SELECT DISTINCT app_name, window_title FROM sessions
+	WHERE window_title IS NOT NULL
+	ORDER BY app_name, window_title
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query window titles: %w", err)
+	}
+	defer rows.Close()
+
+	var titles []*AppTitle
+	for rows.Next() {
+		var title AppTitle
+		if err := rows.Scan(&title.AppName, &title.WindowTitle); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		titles = append(titles, &title)
+	}
+
+	return titles, rows.Err()
+}
+
+// RenameTitle replaces a window title of one application, whose name
+// matches regardless of case, and returns the number of sessions that were
+// changed
+func (db *DB) RenameTitle(appName, from, to string) (int64, error) {
+	result, err := db.conn.Exec(
+		"UPDATE sessions SET window_title = ? WHERE app_name = ? COLLATE NOCASE AND window_title = ?",
+		to, appName, from)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rename window title: %w", err)
+	}
+
+	renamed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return renamed, nil
+}
+
+// Import writes sessions and daily totals from another tracker or device,
+// tagged with source, in one transaction. Sessions already imported from the same
+// source are skipped and only new ones are added to the daily and hourly
+// totals. Daily rows replace the imported total for their app and date; as
+// they have no time of day, they add nothing to the hourly totals. Importing the
+// same data again therefore changes nothing.
+func (db *DB) Import(source string, sessions []*Session, daily []*DailyStats) (*ImportResult, error) {
+	if err := ValidateSource(source); err != nil {
+		return nil, err
+	}
+	if source == SourceTracker || source == SourceManual {
+		return nil, fmt.Errorf("cannot import into source %s", source)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertSession, err := tx.Prepare(`
+	INSERT OR IGNORE INTO sessions (app_name, window_title, start_time, end_time, duration_seconds, source, category)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer insertSession.Close()
+
+	addDaily, err := tx.Prepare(`
+	INSERT INTO daily_stats (app_name, date, total_seconds, source)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(app_name, date, source) DO UPDATE SET
+	total_seconds = total_seconds + excluded.total_seconds
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer addDaily.Close()
+
+	addHourly, err := tx.Prepare(addHourlyStats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer addHourly.Close()
+
+	result := &ImportResult{}
+	for _, session := range sessions {
+		res, err := insertSession.Exec(
+			session.AppName,
+			session.WindowTitle,
+			session.StartTime,
+			session.EndTime,
+			session.DurationSeconds,
+			source,
+			nullString(session.Category),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert session: %w", err)
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		if inserted == 0 {
+			result.SkippedSessions++
+			continue
+		}
+		result.Sessions++
+
+		if _, err := addDaily.Exec(session.AppName, session.StartTime.Format(DateLayout), session.DurationSeconds, source); err != nil {
+			return nil, fmt.Errorf("failed to update daily stats: %w", err)
+		}
+		if err := addSessionHours(addHourly, session, source); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, stat := range daily {
+		if _, err := tx.Exec(`
+		INSERT INTO daily_stats (app_name, date, total_seconds, source)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(app_name, date, source) DO UPDATE SET
+		total_seconds = excluded.total_seconds
+		`, stat.AppName, stat.Date.Format(DateLayout), stat.TotalSeconds, source); err != nil {
+			return nil, fmt.Errorf("failed to import daily stats: %w", err)
+		}
+		result.DailyStats++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// DeleteSource deletes the sessions of query.Source that started in the
+// query's date range, a zero StartDate or EndDate leaving that side open,
+// and recomputes the source's daily totals for those dates from the
+// sessions that remain, in one transaction, so the totals never disagree
+// with the sessions. Totals without sessions, such as imported daily
+// totals, are removed too. Other sources are not touched. It returns the
+// number of sessions deleted and of daily totals that were removed.
+func (db *DB) DeleteSource(query *StatsQuery) (sessions, days int64, err error) {
+	if err := ValidateSource(query.Source); err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := sourceRange(query)
+	result, err := tx.Exec("DELETE FROM sessions WHERE "+where, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	if sessions, err = result.RowsAffected(); err != nil {
+		return 0, 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	// The rebuild reads through the transaction, so it sees the deletion
+	before, err := countDailyStats(tx, query)
+	if err != nil {
+		return 0, 0, err
+	}
+	rebuild, err := readStatsRebuild(tx, query)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to recompute daily stats: %w", err)
+	}
+	if err := rebuild.apply(tx, nil); err != nil {
+		return 0, 0, fmt.Errorf("failed to recompute daily stats: %w", err)
+	}
+	after, err := countDailyStats(tx, query)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return sessions, before - after, nil
+}
+
+// CountSource counts the sessions and daily totals DeleteSource would
+// delete
+func (db *DB) CountSource(query *StatsQuery) (sessions, days int64, err error) {
+	if err := ValidateSource(query.Source); err != nil {
+		return 0, 0, err
+	}
+
+	where, args := sourceRange(query)
+	if err := db.reader().QueryRow("SELECT COUNT(*) FROM sessions WHERE "+where, args...).Scan(&sessions); err != nil {
+		return 0, 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	if days, err = countDailyStats(db.reader(), query); err != nil {
+		return 0, 0, err
+	}
+	return sessions, days, nil
+}
+
+// sourceRange returns the condition selecting the sessions of query.Source
+// that started in the query's date range
+func sourceRange(query *StatsQuery) (string, []interface{}) {
+	where := "source = ?"
+	args := []interface{}{query.Source}
+	if !query.StartDate.IsZero() {
+		where += " AND start_time >= ?"
+		args = append(args, dayStart(query.StartDate))
+	}
+	if !query.EndDate.IsZero() {
+		where += " AND start_time < ?"
+		args = append(args, dayStart(query.EndDate).AddDate(0, 0, 1))
+	}
+	return where, args
+}
+
+// countDailyStats counts the daily totals of query.Source in the range
+func countDailyStats(q querier, query *StatsQuery) (int64, error) {
+	where := "source = ?"
+	args := []interface{}{query.Source}
+	if !query.StartDate.IsZero() {
+		where += " AND date >= ?"
+		args = append(args, query.StartDate.Format(DateLayout))
+	}
+	if !query.EndDate.IsZero() {
+		where += " AND date <= ?"
+		args = append(args, query.EndDate.Format(DateLayout))
+	}
+
+	var count int64
+	if err := q.QueryRow("SELECT COUNT(*) FROM daily_stats WHERE "+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count daily stats: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteSessions deletes the sessions the filter selects and takes their
+// time off the daily and hourly totals they were added to, in one
+// transaction, so the totals never disagree with the sessions. The filter
+// matches AppName regardless of case, Source exactly, and sessions that
+// started in the date range, a zero StartDate or EndDate leaving that side
+// open; an empty AppName or Source matches every one. At least an
+// application or a source is required. Totals that drop to zero are
+// removed. It returns the number of sessions deleted and of daily totals
+// that were removed.
+func (db *DB) DeleteSessions(filter StatsQuery) (sessions, days int64, err error) {
+	if filter.AppName == "" && filter.Source == "" {
+		return 0, 0, fmt.Errorf("deleting sessions requires an application or a source")
+	}
+	where, args := sessionFilter(&filter)
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The writer allows one connection, so the sessions are read before
+	// the totals are updated
+	type dayKey struct{ app, date, source string }
+	dayTotals := make(map[dayKey]int64)
+	hourTotals := make(map[hourCell]int64)
+	rows, err := tx.Query("SELECT app_name, start_time, duration_seconds, source FROM sessions WHERE "+where, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	for rows.Next() {
+		var appName, source string
+		var start time.Time
+		var seconds int64
+		if err := rows.Scan(&appName, &start, &seconds, &source); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan row: %w", err)
+		}
+		// Sessions count towards the day they started, as in
+		// UpdateDailyStatsBatch, and towards every hour they cover
+		dayTotals[dayKey{appName, start.Format(DateLayout), source}] += seconds
+		splitHours(start, seconds, func(date string, hour int, n int64) {
+			hourTotals[hourCell{appName, date, hour, source}] += n
+		})
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, 0, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+	rows.Close()
+
+	result, err := tx.Exec("DELETE FROM sessions WHERE "+where, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	if sessions, err = result.RowsAffected(); err != nil {
+		return 0, 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	for key, seconds := range dayTotals {
+		if _, err := tx.Exec(
+			"UPDATE daily_stats SET total_seconds = total_seconds - ? WHERE app_name = ? AND date = ? AND source = ?",
+			seconds, key.app, key.date, key.source); err != nil {
+			return 0, 0, fmt.Errorf("failed to update daily stats: %w", err)
+		}
+		result, err := tx.Exec(
+			"DELETE FROM daily_stats WHERE app_name = ? AND date = ? AND source = ? AND total_seconds <= 0",
+			key.app, key.date, key.source)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to delete daily stats: %w", err)
+		}
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		days += removed
+	}
+
+	for cell, seconds := range hourTotals {
+		if _, err := tx.Exec(
+			"UPDATE hourly_stats SET total_seconds = total_seconds - ? WHERE app_name = ? AND date = ? AND hour = ? AND source = ?",
+			seconds, cell.app, cell.date, cell.hour, cell.source); err != nil {
+			return 0, 0, fmt.Errorf("failed to update hourly stats: %w", err)
+		}
+		if _, err := tx.Exec(
+			"DELETE FROM hourly_stats WHERE app_name = ? AND date = ? AND hour = ? AND source = ? AND total_seconds <= 0",
+			cell.app, cell.date, cell.hour, cell.source); err != nil {
+			return 0, 0, fmt.Errorf("failed to delete hourly stats: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return sessions, days, nil
+}
+
+// CountSessions counts the sessions DeleteSessions would delete
+func (db *DB) CountSessions(filter StatsQuery) (int64, error) {
+	where, args := sessionFilter(&filter)
+	var count int64
+	if err := db.reader().QueryRow("SELECT COUNT(*) FROM sessions WHERE "+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// sessionFilter returns the condition selecting the sessions of the
+// query's application and source that started in its date range
+func sessionFilter(query *StatsQuery) (string, []interface{}) {
+	where := "1=1"
+	var args []interface{}
+	if query.AppName != "" {
+		where += " AND app_name = ? COLLATE NOCASE"
+		args = append(args, query.AppName)
+	}
+	if query.Source != "" {
+		where += " AND source = ?"
+		args = append(args, query.Source)
+	}
+	if !query.StartDate.IsZero() {
+		where += " AND start_time >= ?"
+		args = append(args, dayStart(query.StartDate))
+	}
+	if !query.EndDate.IsZero() {
+		where += " AND start_time < ?"
+		args = append(args, dayStart(query.EndDate).AddDate(0, 0, 1))
+	}
+	return where, args
+}
+
+// HasSessionsWithoutDailyStats reports whether the date range has sessions
+// but no daily statistics, e.g. after restoring a partial backup. It only
+// checks for existence, so it is cheap enough to run when a query is empty.
+func (db *DB) HasSessionsWithoutDailyStats(query *StatsQuery) (bool, error) {
+	sessionsWhere, dailyWhere := "1=1", "1=1"
+	var sessionArgs, dailyArgs []interface{}
+
+	if !query.StartDate.IsZero() {
+		sessionsWhere += " AND start_time >= ?"
+		sessionArgs = append(sessionArgs, dayStart(query.StartDate))
+		dailyWhere += " AND date >= ?"
+		dailyArgs = append(dailyArgs, query.StartDate.Format(DateLayout))
+	}
+	if !query.EndDate.IsZero() {
+		sessionsWhere += " AND start_time < ?"
+		sessionArgs = append(sessionArgs, dayStart(query.EndDate).AddDate(0, 0, 1))
+		dailyWhere += " AND date <= ?"
+		dailyArgs = append(dailyArgs, query.EndDate.Format(DateLayout))
+	}
+
+	var missing bool
+	err := db.reader().QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sessions WHERE "+sessionsWhere+") AND NOT EXISTS(SELECT 1 FROM daily_stats WHERE "+dailyWhere+")",
+		append(sessionArgs, dailyArgs...)...,
+	).Scan(&missing)
+	if err != nil {
+		return false, fmt.Errorf("failed to check daily stats: %w", err)
+	}
+
+	return missing, nil
+}
+
+// RecomputeDailyStats rebuilds the daily and hourly statistics of one
+// source, the tracker unless the query names another, for the date range
+// from sessions; a zero StartDate or EndDate leaves that side open. Each
+// session counts once, at its longest checkpoint. Sessions are streamed, so memory grows with the number of app-days and app-hours,
+// not sessions. Hourly totals also take the sessions of the day before the
+// range, which may run into it. Rows of other
+// sources are left alone. progress, if not nil, is called after each day is
+// written. It returns the number of days written.
+func (db *DB) RecomputeDailyStats(query *StatsQuery, progress func(done, total int)) (int, error) {
+	// Sessions are read in the transaction, so none flushed meanwhile is
+	// left out of the totals
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rebuild, err := readStatsRebuild(tx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := rebuild.apply(tx, progress); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(rebuild.dates), nil
+}
+
+// statsRebuild holds the daily and hourly statistics of one source and date
+// range as recomputed from sessions, until apply replaces the stored ones
+type statsRebuild struct {
+	source       string
+	deleteQuery  string
+	hourlyDelete string
+	deleteArgs   []interface{}
+	days         map[string]map[string]int64
+	dates        []string
+	hours        map[hourCell]int64
+}
+
+// longestCheckpoint and checkpointKey select each session once at its
+// longest: the tracker writes a growing checkpoint of a session on every
+// flush, all with the same app, title and start
+const (
+	longestCheckpoint = "MAX(duration_seconds)"
+	checkpointKey     = "source, app_name, COALESCE(window_title, ''), start_time"
+)
+
+// readStatsRebuild recomputes the statistics RecomputeDailyStats writes
+// from the sessions q sees
+func readStatsRebuild(q querier, query *StatsQuery) (*statsRebuild, error) {
+	source := sourceOf(query.Source)
+	sqlQuery := "SELECT app_name, start_time, " + longestCheckpoint + " FROM sessions WHERE source = ?"
+	deleteQuery := "DELETE FROM daily_stats WHERE source = ?"
+	args := []interface{}{source}
+	deleteArgs := []interface{}{source}
+
+	if !query.StartDate.IsZero() {
+		sqlQuery += " AND start_time >= ?"
+		args = append(args, dayStart(query.StartDate))
+		deleteQuery += " AND date >= ?"
+		deleteArgs = append(deleteArgs, query.StartDate.Format(DateLayout))
+	}
+	if !query.EndDate.IsZero() {
+		sqlQuery += " AND start_time < ?"
+		args = append(args, dayStart(query.EndDate).AddDate(0, 0, 1))
+		deleteQuery += " AND date <= ?"
+		deleteArgs = append(deleteArgs, query.EndDate.Format(DateLayout))
+	}
+	sqlQuery += " GROUP BY " + checkpointKey
+
+	rows, err := q.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	// Sessions count towards the day they started, as in UpdateDailyStatsBatch
+	days := make(map[string]map[string]int64)
+	for rows.Next() {
+		var appName string
+		var start time.Time
+		var seconds int64
+		if err := rows.Scan(&appName, &start, &seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		date := start.Format(DateLayout)
+		if days[date] == nil {
+			days[date] = make(map[string]int64)
+		}
+		days[date][appName] += seconds
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+	rows.Close()
+
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	hourlyWhere := "source = ?"
+	hourlyArgs := []interface{}{source}
+	hourlyDelete := "DELETE FROM hourly_stats WHERE source = ?"
+	var first, last string
+	if !query.StartDate.IsZero() {
+		first = query.StartDate.Format(DateLayout)
+		hourlyWhere += " AND start_time >= ?"
+		hourlyArgs = append(hourlyArgs, dayStart(query.StartDate).AddDate(0, 0, -1))
+		hourlyDelete += " AND date >= ?"
+	}
+	if !query.EndDate.IsZero() {
+		last = query.EndDate.Format(DateLayout)
+		hourlyWhere += " AND start_time < ?"
+		hourlyArgs = append(hourlyArgs, dayStart(query.EndDate).AddDate(0, 0, 1))
+		hourlyDelete += " AND date <= ?"
+	}
+	hours, err := sessionHours(q, hourlyWhere, hourlyArgs, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsRebuild{
+		source:       source,
+		deleteQuery:  deleteQuery,
+		hourlyDelete: hourlyDelete,
+		deleteArgs:   deleteArgs,
+		days:         days,
+		dates:        dates,
+		hours:        hours,
+	}, nil
+}
+
+// apply replaces the stored statistics of the rebuilt range in tx
+func (r *statsRebuild) apply(tx *sql.Tx, progress func(done, total int)) error {
+	if _, err := tx.Exec(r.deleteQuery, r.deleteArgs...); err != nil {
+		return fmt.Errorf("failed to delete daily stats: %w", err)
+	}
+	// The daily statistics are deleted for the same source and dates
+	if _, err := tx.Exec(r.hourlyDelete, r.deleteArgs...); err != nil {
+		return fmt.Errorf("failed to delete hourly stats: %w", err)
+	}
+	if err := insertHourCells(tx, r.hours); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO daily_stats (app_name, date, total_seconds, source) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, date := range r.dates {
+		for appName, seconds := range r.days[date] {
+			if _, err := stmt.Exec(appName, date, seconds, r.source); err != nil {
+				return fmt.Errorf("failed to insert daily stats: %w", err)
+			}
+		}
+		if progress != nil {
+			progress(i+1, len(r.dates))
+		}
+	}
+	return nil
+}
+
+// InsertGaps stores locked and idle periods recorded by the tracker
+func (db *DB) InsertGaps(gaps []*Gap) error {
+	if len(gaps) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.Prepare(`INSERT INTO gaps (kind, start_time, end_time) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, gap := range gaps {
+		if _, err = stmt.Exec(gap.Kind, gap.StartTime, gap.EndTime); err != nil {
+			return fmt.Errorf("failed to insert gap: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetGaps returns the locked and idle periods that start in the query
+// range, in start order. Gaps starting the day before are included too, so
+// one running past midnight is not lost.
+func (db *DB) GetGaps(query *StatsQuery) ([]*Gap, error) {
+	sqlQuery := `
+	SELECT id, kind, start_time, end_time
+	FROM gaps
+	WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if !query.StartDate.IsZero() {
+		sqlQuery += " AND start_time >= ?"
+		args = append(args, dayStart(query.StartDate).AddDate(0, 0, -1))
+	}
+
+	if !query.EndDate.IsZero() {
+		sqlQuery += " AND start_time < ?"
+		args = append(args, dayStart(query.EndDate).AddDate(0, 0, 1))
+	}
+
+	sqlQuery += " ORDER BY start_time ASC, id ASC"
+
+	rows, err := db.reader().Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gaps: %w", err)
+	}
+	defer rows.Close()
+
+	var gaps []*Gap
+	for rows.Next() {
+		var gap Gap
+		if err := rows.Scan(&gap.ID, &gap.Kind, &gap.StartTime, &gap.EndTime); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		gaps = append(gaps, &gap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate gaps: %w", err)
+	}
+
+	return gaps, nil
+}
+
+// CountSessionsBefore counts the sessions that started before the given day
+func (db *DB) CountSessionsBefore(before time.Time) (int64, error) {
+	var count int64
+	if err := db.reader().QueryRow(`SELECT COUNT(*) FROM sessions WHERE start_time < ?`, dayStart(before)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// CountDailyStatsBefore counts the daily statistics of the days before the
+// given day
+func (db *DB) CountDailyStatsBefore(before time.Time) (int64, error) {
+	var count int64
+	if err := db.reader().QueryRow(`SELECT COUNT(*) FROM daily_stats WHERE date < ?`, before.Format(DateLayout)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count daily stats: %w", err)
+	}
+	return count, nil
+}
+
+// PruneDailyStats deletes the daily and hourly statistics of the days
+// before the given day and returns how many daily rows were deleted.
+// Sessions are kept, so recomputing the daily statistics brings back those
+// of days that still have sessions.
+func (db *DB) PruneDailyStats(before time.Time) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM daily_stats WHERE date < ?`, before.Format(DateLayout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete daily stats: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted daily stats: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM hourly_stats WHERE date < ?`, before.Format(DateLayout)); err != nil {
+		return 0, fmt.Errorf("failed to delete hourly stats: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+// PruneSessions deletes the sessions that started before the given day and
+// returns how many were deleted. Daily statistics are kept. When archive is
+// set, it receives the complete sessions first and they are only deleted if
+// it succeeds. Everything runs in one write transaction, so a failure at any
+// step leaves the database unchanged.
+func (db *DB) PruneSessions(before time.Time, archive func([]*Session) error) (int64, error) {
+	cutoff := dayStart(before)
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sessions []*Session
+	if archive != nil {
+		rows, err := tx.Query(`
+		SELECT id, app_name, COALESCE(window_title, ''), COALESCE(raw_title, ''), COALESCE(domain, ''), COALESCE(exe_path, ''), monitor_index, workspace, start_time, end_time,
+			duration_seconds, source, COALESCE(category, ''), created_at, updated_at
+		FROM sessions
+		WHERE start_time < ?
+		ORDER BY start_time ASC, id ASC
+		`, cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query sessions: %w", err)
+		}
+		for rows.Next() {
+			var session Session
+			var createdAt, updatedAt sql.NullTime
+			if err := rows.Scan(
+				&session.ID,
+				&session.AppName,
+				&session.WindowTitle,
+				&session.RawTitle,
+				&session.Domain,
+				&session.ExePath,
+				&session.MonitorIndex,
+				&session.Workspace,
+				&session.StartTime,
+				&session.EndTime,
+				&session.DurationSeconds,
+				&session.Source,
+				&session.Category,
+				&createdAt,
+				&updatedAt,
+			); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("failed to scan row: %w", err)
+			}
+			session.CreatedAt = createdAt.Time
+			session.UpdatedAt = updatedAt.Time
+			sessions = append(sessions, &session)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, fmt.Errorf("failed to iterate sessions: %w", err)
+		}
+
+		if err := archive(sessions); err != nil {
+			return 0, fmt.Errorf("failed to archive sessions: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM sessions WHERE start_time < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted sessions: %w", err)
+	}
+
+	// The writer connection is held, so nothing can have changed in between
+	if archive != nil && deleted != int64(len(sessions)) {
+		return 0, fmt.Errorf("deleted %d sessions but archived %d", deleted, len(sessions))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deleted, nil
+}
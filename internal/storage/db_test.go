@@ -0,0 +1,2694 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+)
+
+// newTestDB creates a database with one session in a temporary directory
+func newTestDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "actime.db")
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	session := &Session{
+		AppName:         "editor",
+		WindowTitle:     "main.go",
+		StartTime:       start,
+		EndTime:         start.Add(10 * time.Minute),
+		DurationSeconds: 600,
+	}
+	if err := db.InsertSession(session); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+
+	return path
+}
+
+func TestOpenReadOnlyReadsBackup(t *testing.T) {
+	data, err := os.ReadFile(newTestDB(t))
+	if err != nil {
+		t.Fatalf("Failed to read database: %v", err)
+	}
+
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	if err := os.WriteFile(backup, data, 0400); err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+
+	db, err := OpenReadOnly(backup)
+	if err != nil {
+		t.Fatalf("Failed to open read-only backup: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	sessions, err := db.GetSessions(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to query backup: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].AppName != "editor" {
+		t.Errorf("Expected the editor session, got %+v", sessions)
+	}
+
+	if err := db.InsertSession(&Session{AppName: "x", StartTime: day, EndTime: day}); err == nil {
+		t.Error("Expected writes to a read-only database to fail")
+	}
+}
+
+func TestOpenReadOnlyWhileWriterIsOpen(t *testing.T) {
+	path := newTestDB(t)
+
+	writer, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open writer: %v", err)
+	}
+	defer writer.Close()
+
+	reader, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.GetSessions(&StatsQuery{}); err != nil {
+		t.Errorf("Failed to read while a writer is open: %v", err)
+	}
+}
+
+func TestOpenReadOnlyMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "typo.db")
+
+	_, err := OpenReadOnly(path)
+	if !errors.Is(err, ErrDatabaseNotFound) {
+		t.Fatalf("Expected ErrDatabaseNotFound, got %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected no database file to be created")
+	}
+}
+
+func TestOpenReadOnlyNotADatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("this is not a database, just some text"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, err := OpenReadOnly(path); err == nil {
+		t.Error("Expected an error for a file that is not a database")
+	}
+}
+
+func TestRenameAppMergesDailyStats(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "code\x00", WindowTitle: "a", StartTime: start, EndTime: start, DurationSeconds: 100},
+		{AppName: "code", WindowTitle: "b", StartTime: start, EndTime: start, DurationSeconds: 50},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	renamed, err := db.RenameApp("code\x00", "code")
+	if err != nil {
+		t.Fatalf("Failed to rename app: %v", err)
+	}
+	if renamed != 1 {
+		t.Errorf("Expected 1 renamed session, got %d", renamed)
+	}
+
+	names, err := db.GetAppNames()
+	if err != nil {
+		t.Fatalf("Failed to get app names: %v", err)
+	}
+	if len(names) != 1 || names[0] != "code" {
+		t.Errorf("Expected only the clean name to remain, got %q", names)
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].TotalSeconds != 150 {
+		t.Errorf("Expected one merged row of 150s, got %+v", stats)
+	}
+}
+
+func TestRenameAppMatchesAnyCase(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "firefox", WindowTitle: "a", StartTime: start, EndTime: start, DurationSeconds: 100},
+		{AppName: "Firefox", WindowTitle: "b", StartTime: start, EndTime: start, DurationSeconds: 50},
+		{AppName: "FIREFOX", WindowTitle: "c", StartTime: start, EndTime: start, DurationSeconds: 25},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	// Titles are renamed under any spelling of the app
+	renamed, err := db.RenameTitle("FIREFOX", "b", "inbox")
+	if err != nil {
+		t.Fatalf("Failed to rename title: %v", err)
+	}
+	if renamed != 1 {
+		t.Errorf("Expected 1 renamed title, got %d", renamed)
+	}
+
+	// Renaming to another spelling leaves the rows already named so alone
+	renamed, err = db.RenameApp("FIREFOX", "Firefox")
+	if err != nil {
+		t.Fatalf("Failed to rename app: %v", err)
+	}
+	if renamed != 2 {
+		t.Errorf("Expected 2 renamed sessions, got %d", renamed)
+	}
+
+	names, err := db.GetAppNames()
+	if err != nil {
+		t.Fatalf("Failed to get app names: %v", err)
+	}
+	if len(names) != 1 || names[0] != "Firefox" {
+		t.Errorf("Expected only the new spelling to remain, got %q", names)
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].AppName != "Firefox" || stats[0].TotalSeconds != 175 {
+		t.Errorf("Expected one merged row of 175s, got %+v", stats)
+	}
+
+	hourly, err := db.GetHourlyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get hourly stats: %v", err)
+	}
+	var seconds int64
+	for _, stat := range hourly {
+		seconds += stat.TotalSeconds
+	}
+	if seconds != 175 {
+		t.Errorf("Expected 175s of hourly stats to be kept, got %d", seconds)
+	}
+}
+
+func TestDeleteApp(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "gnome-shell", WindowTitle: "", StartTime: start, EndTime: start, DurationSeconds: 20},
+		{AppName: "gnome-shell", WindowTitle: "Activities", StartTime: start.Add(time.Minute), EndTime: start, DurationSeconds: 10},
+		{AppName: "Gnome-Shell", WindowTitle: "Overview", StartTime: start.Add(2 * time.Minute), EndTime: start, DurationSeconds: 5},
+		{AppName: "code", WindowTitle: "b", StartTime: start, EndTime: start, DurationSeconds: 50},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	// Every spelling is counted and deleted
+	if count, err := db.CountAppSessions("gnome-shell"); err != nil || count != 3 {
+		t.Errorf("Expected 3 sessions to delete, got %d (%v)", count, err)
+	}
+	deleted, err := db.DeleteApp("gnome-shell")
+	if err != nil {
+		t.Fatalf("Failed to delete app: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 deleted sessions, got %d", deleted)
+	}
+
+	names, err := db.GetAppNames()
+	if err != nil {
+		t.Fatalf("Failed to get app names: %v", err)
+	}
+	if len(names) != 1 || names[0] != "code" {
+		t.Errorf("Expected only code to remain, got %q", names)
+	}
+}
+
+func TestPruneDailyStatsKeepsSessions(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	monday := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	tuesday := monday.AddDate(0, 0, 1)
+	sessions := []*Session{
+		{AppName: "code", WindowTitle: "a", StartTime: monday, EndTime: monday, DurationSeconds: 50},
+		{AppName: "code", WindowTitle: "b", StartTime: tuesday, EndTime: tuesday, DurationSeconds: 30},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	if count, err := db.CountDailyStatsBefore(tuesday); err != nil || count != 1 {
+		t.Errorf("Expected 1 daily stats row to delete, got %d (%v)", count, err)
+	}
+	deleted, err := db.PruneDailyStats(tuesday)
+	if err != nil {
+		t.Fatalf("Failed to prune daily stats: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted row, got %d", deleted)
+	}
+
+	daily, err := db.GetDailyStats(&StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(daily) != 1 || daily[0].TotalSeconds != 30 {
+		t.Errorf("Expected only Tuesday's 30 seconds to remain, got %+v", daily)
+	}
+	if count, err := db.CountSessionsBefore(tuesday.AddDate(0, 0, 1)); err != nil || count != 2 {
+		t.Errorf("Expected both sessions to remain, got %d (%v)", count, err)
+	}
+}
+
+// hourTotals returns the hourly statistics as "date hour" -> seconds
+func hourTotals(t *testing.T, db *DB, query *StatsQuery) map[string]int64 {
+	t.Helper()
+	rows, err := db.GetHourlyStats(query)
+	if err != nil {
+		t.Fatalf("Failed to get hourly stats: %v", err)
+	}
+	totals := make(map[string]int64)
+	for _, row := range rows {
+		totals[fmt.Sprintf("%s %s %02d", row.AppName, row.Date.Format(DateLayout), row.Hour)] += row.TotalSeconds
+	}
+	return totals
+}
+
+func TestHourlyStatsFollowDailyStats(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "editor", WindowTitle: "a", StartTime: day.Add(9*time.Hour + 40*time.Minute), EndTime: day.Add(10*time.Hour + 20*time.Minute), DurationSeconds: 2400},
+		{AppName: "browser", WindowTitle: "b", StartTime: day.Add(23*time.Hour + 50*time.Minute), EndTime: day.Add(24*time.Hour + 10*time.Minute), DurationSeconds: 1200},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	// Sessions are split between hours, running into the next day
+	want := map[string]int64{
+		"editor 2026-01-05 09":  1200,
+		"editor 2026-01-05 10":  1200,
+		"browser 2026-01-05 23": 600,
+		"browser 2026-01-06 00": 600,
+	}
+	if got := hourTotals(t, db, &StatsQuery{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := hourTotals(t, db, &StatsQuery{StartDate: day.AddDate(0, 0, 1), EndDate: day.AddDate(0, 0, 1)}); len(got) != 1 || got["browser 2026-01-06 00"] != 600 {
+		t.Errorf("Expected only the hour after midnight on the 6th, got %v", got)
+	}
+
+	// Recomputing the 6th keeps the part of the session of the 5th
+	if _, err := db.RecomputeDailyStats(&StatsQuery{StartDate: day.AddDate(0, 0, 1), EndDate: day.AddDate(0, 0, 1)}, nil); err != nil {
+		t.Fatalf("Failed to recompute: %v", err)
+	}
+	if got := hourTotals(t, db, &StatsQuery{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after recomputing, got %v", want, got)
+	}
+
+	if _, err := db.RenameApp("browser", "editor"); err != nil {
+		t.Fatalf("Failed to rename: %v", err)
+	}
+	if got := hourTotals(t, db, &StatsQuery{AppName: "EDITOR"}); len(got) != 4 {
+		t.Errorf("Expected the browser's hours under the editor, got %v", got)
+	}
+}
+
+func TestHourlyStatsBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	start := time.Date(2026, 1, 5, 9, 30, 0, 0, time.Local)
+	if err := db.InsertSession(&Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600}); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	// As in a database written before hourly statistics were kept
+	if _, err := db.conn.Exec("DROP TABLE hourly_stats; PRAGMA user_version = 4"); err != nil {
+		t.Fatalf("Failed to drop hourly_stats: %v", err)
+	}
+	db.Close()
+
+	want := map[string]int64{"editor 2026-01-05 09": 1800, "editor 2026-01-05 10": 1800}
+
+	// Read-only, the hours come from the sessions
+	view, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if got := hourTotals(t, view, &StatsQuery{StartDate: start, EndDate: start}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v without the table, got %v", want, got)
+	}
+	view.Close()
+
+	// Opening it for writing fills the table
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	var rows int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM hourly_stats").Scan(&rows); err != nil || rows != 2 {
+		t.Errorf("Expected 2 backfilled rows, got %d (%v)", rows, err)
+	}
+	if got := hourTotals(t, db, &StatsQuery{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v after the backfill, got %v", want, got)
+	}
+}
+
+func TestRenameTitle(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "firefox", WindowTitle: "(3) Inbox", StartTime: start, EndTime: start},
+		{AppName: "firefox", WindowTitle: "(7) Inbox", StartTime: start, EndTime: start},
+		{AppName: "chrome", WindowTitle: "(3) Inbox", StartTime: start, EndTime: start},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	renamed, err := db.RenameTitle("firefox", "(3) Inbox", "Inbox")
+	if err != nil {
+		t.Fatalf("Failed to rename title: %v", err)
+	}
+	if renamed != 1 {
+		t.Errorf("Expected 1 renamed session, got %d", renamed)
+	}
+
+	titles, err := db.GetAppTitles()
+	if err != nil {
+		t.Fatalf("Failed to get titles: %v", err)
+	}
+	var got []string
+	for _, title := range titles {
+		got = append(got, title.AppName+": "+title.WindowTitle)
+	}
+	want := "[chrome: (3) Inbox firefox: (7) Inbox firefox: Inbox]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("Expected titles %s, got %v", want, got)
+	}
+}
+
+func TestSessionUpdatedAt(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	if err := db.InsertSession(&Session{AppName: "firefox", WindowTitle: "(3) Inbox", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60}); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+
+	get := func() *Session {
+		t.Helper()
+		sessions, err := db.GetSessions(&StatsQuery{})
+		if err != nil {
+			t.Fatalf("Failed to get sessions: %v", err)
+		}
+		if len(sessions) != 1 {
+			t.Fatalf("Expected 1 session, got %d", len(sessions))
+		}
+		return sessions[0]
+	}
+
+	inserted := get()
+	if inserted.CreatedAt.IsZero() {
+		t.Fatal("Expected created_at to be set")
+	}
+	if !inserted.UpdatedAt.Equal(inserted.CreatedAt) {
+		t.Errorf("Expected a new session to be updated when created, got %v and %v", inserted.UpdatedAt, inserted.CreatedAt)
+	}
+
+	// Every change moves updated_at on and leaves created_at alone
+	previous := inserted
+	for _, rename := range [][2]string{{"(3) Inbox", "Inbox"}, {"Inbox", "Mail"}} {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := db.RenameTitle("firefox", rename[0], rename[1]); err != nil {
+			t.Fatalf("Failed to rename title: %v", err)
+		}
+		updated := get()
+		if !updated.CreatedAt.Equal(inserted.CreatedAt) {
+			t.Errorf("Expected created_at to stay %v, got %v", inserted.CreatedAt, updated.CreatedAt)
+		}
+		if !updated.UpdatedAt.After(previous.UpdatedAt) {
+			t.Errorf("Expected updated_at to advance past %v, got %v", previous.UpdatedAt, updated.UpdatedAt)
+		}
+		previous = updated
+	}
+}
+
+func TestSessionDetailsRoundTrip(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	first, second := 0, 1
+	sessions := []*Session{
+		{AppName: "firefox", WindowTitle: "Issues - GitHub", Domain: "github.com", ExePath: "/usr/lib/firefox/firefox", MonitorIndex: &second, Workspace: &first, StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60},
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start.Add(time.Minute), EndTime: start.Add(2 * time.Minute), DurationSeconds: 60},
+	}
+	if err := db.InsertSession(sessions[0]); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	if err := db.BatchInsertSessions(sessions[1:]); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	got, err := db.GetSessions(&StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(got) != 2 || got[0].Domain != "github.com" || got[1].Domain != "" {
+		t.Errorf("Expected domains github.com and none, got %+v", got)
+	}
+	if len(got) == 2 && (got[0].ExePath != "/usr/lib/firefox/firefox" || got[1].ExePath != "") {
+		t.Errorf("Expected paths /usr/lib/firefox/firefox and none, got %q and %q", got[0].ExePath, got[1].ExePath)
+	}
+	// Monitor 0 is told apart from an unknown monitor
+	if len(got) == 2 && (got[0].MonitorIndex == nil || *got[0].MonitorIndex != 1 || got[0].Workspace == nil || *got[0].Workspace != 0) {
+		t.Errorf("Expected monitor 1 and workspace 0, got %v and %v", got[0].MonitorIndex, got[0].Workspace)
+	}
+	if len(got) == 2 && (got[1].MonitorIndex != nil || got[1].Workspace != nil) {
+		t.Errorf("Expected no monitor or workspace, got %v and %v", got[1].MonitorIndex, got[1].Workspace)
+	}
+}
+
+func TestAppAliasesAreOneApplication(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	start := day.Add(9 * time.Hour)
+	sessions := []*Session{
+		{AppName: "firefox", StartTime: start, EndTime: start, DurationSeconds: 100},
+		{AppName: "Firefox", StartTime: start, EndTime: start, DurationSeconds: 200},
+		{AppName: "firefox-bin", StartTime: start, EndTime: start, DurationSeconds: 300},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	// Backfill the alias the way `actime db clean-names` does
+	apps, err := appname.NewMapper([]appname.Rule{{Pattern: `^firefox(-bin)?$`, Name: "firefox"}})
+	if err != nil {
+		t.Fatalf("Failed to compile mapping: %v", err)
+	}
+	names, err := db.GetAppNames()
+	if err != nil {
+		t.Fatalf("Failed to get app names: %v", err)
+	}
+	for _, name := range names {
+		if canonical := apps.Canonical(name); canonical != name {
+			if _, err := db.RenameApp(name, canonical); err != nil {
+				t.Fatalf("Failed to rename %s: %v", name, err)
+			}
+		}
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].AppName != "firefox" || stats[0].TotalSeconds != 600 {
+		t.Fatalf("Expected one merged firefox row of 600s, got %+v", stats)
+	}
+
+	for _, spelling := range []string{"firefox", "Firefox", "FIREFOX", apps.Canonical("firefox-bin")} {
+		stats, err := db.GetDailyStats(&StatsQuery{AppName: spelling})
+		if err != nil {
+			t.Fatalf("Failed to filter daily stats by %s: %v", spelling, err)
+		}
+		if len(stats) != 1 || stats[0].TotalSeconds != 600 {
+			t.Errorf("Expected --app %s to match the merged row, got %+v", spelling, stats)
+		}
+
+		sessions, err := db.GetSessions(&StatsQuery{AppName: spelling})
+		if err != nil {
+			t.Fatalf("Failed to filter sessions by %s: %v", spelling, err)
+		}
+		if len(sessions) != 3 {
+			t.Errorf("Expected --app %s to match all 3 sessions, got %d", spelling, len(sessions))
+		}
+	}
+}
+
+func TestCaseVariantsGroupWithoutBackfill(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	for _, app := range []string{"firefox", "Firefox"} {
+		if err := db.UpdateDailyStatsBatch([]*Session{{AppName: app, StartTime: day, DurationSeconds: 60}}); err != nil {
+			t.Fatalf("Failed to update daily stats: %v", err)
+		}
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].AppName != "Firefox" || stats[0].TotalSeconds != 120 {
+		t.Errorf("Expected case variants to be grouped under Firefox, got %+v", stats)
+	}
+}
+
+func TestConcurrentFlushesAndReads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	db, err := NewDBWithOptions(path, Options{MaxReadConns: 2, BusyTimeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	const (
+		flushers          = 4
+		flushesPerFlusher = 20
+		sessionsPerFlush  = 10
+	)
+
+	day := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	errs := make(chan error, 64)
+	var wg sync.WaitGroup
+
+	// Flushes, the way the daemon writes its buffer
+	for f := 0; f < flushers; f++ {
+		wg.Add(1)
+		go func(f int) {
+			defer wg.Done()
+			for i := 0; i < flushesPerFlusher; i++ {
+				sessions := make([]*Session, sessionsPerFlush)
+				for j := range sessions {
+					sessions[j] = &Session{
+						AppName:         fmt.Sprintf("app%d", j%3),
+						WindowTitle:     fmt.Sprintf("flusher %d", f),
+						StartTime:       day,
+						EndTime:         day.Add(time.Second),
+						DurationSeconds: 1,
+					}
+				}
+				if err := db.BatchInsertSessions(sessions); err != nil {
+					errs <- err
+					return
+				}
+				if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(f)
+	}
+
+	// Stats queries on the same handle and an export from a second one
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 3; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		export, err := OpenReadOnly(path)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer export.Close()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := export.GetSessions(&StatsQuery{}); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Unexpected error under concurrency: %v", err)
+	}
+
+	want := int64(flushers * flushesPerFlusher * sessionsPerFlush)
+	sessions, err := db.GetSessions(&StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read sessions: %v", err)
+	}
+	if int64(len(sessions)) != want {
+		t.Errorf("Expected %d sessions, got %d", want, len(sessions))
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to read daily stats: %v", err)
+	}
+	var total int64
+	for _, stat := range stats {
+		total += stat.TotalSeconds
+	}
+	if total != want {
+		t.Errorf("Expected %d seconds in daily stats, got %d", want, total)
+	}
+}
+
+func TestReadPoolRejectsWrites(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.read.Exec("DELETE FROM sessions"); err == nil {
+		t.Error("Expected the read pool to be query-only")
+	}
+}
+
+func TestMigrateDailyStatsSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+
+	// A daily_stats table as created before the source column
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := legacy.Exec(`
+	CREATE TABLE daily_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		date DATE NOT NULL,
+		total_seconds INTEGER NOT NULL,
+		UNIQUE(app_name, date)
+	);
+	INSERT INTO daily_stats (app_name, date, total_seconds) VALUES ('editor', '2026-01-05', 600);
+	`); err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+	legacy.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	// Imported totals for the same app and day live next to tracked ones
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	if _, err := db.Import("import:other", nil, []*DailyStats{{AppName: "editor", Date: day, TotalSeconds: 60}}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch([]*Session{{AppName: "editor", StartTime: day, DurationSeconds: 30}}); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].TotalSeconds != 690 {
+		t.Errorf("Expected 690s for editor after migration, got %+v", stats)
+	}
+}
+
+func TestRecomputeDailyStatsCountsCheckpointsOnce(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Two checkpoints of one session, and another session of the same app
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(30 * time.Minute), DurationSeconds: 1800},
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600},
+		{AppName: "editor", WindowTitle: "db.go", StartTime: start.Add(time.Hour), EndTime: start.Add(70 * time.Minute), DurationSeconds: 600},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if _, err := db.RecomputeDailyStats(&StatsQuery{}, nil); err != nil {
+		t.Fatalf("Failed to recompute: %v", err)
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].TotalSeconds != 4200 {
+		t.Errorf("Expected 4200s for the editor, got %+v", stats)
+	}
+	hourly, err := db.GetHourlyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get hourly stats: %v", err)
+	}
+	var total int64
+	for _, stat := range hourly {
+		total += stat.TotalSeconds
+	}
+	if total != 4200 {
+		t.Errorf("Expected 4200s of hourly stats, got %ds", total)
+	}
+}
+
+func TestRecomputeDailyStatsFromSessionsOnly(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	monday := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	tuesday := monday.AddDate(0, 0, 1)
+	sessions := []*Session{
+		{AppName: "editor", StartTime: monday.Add(9 * time.Hour), EndTime: monday.Add(10 * time.Hour), DurationSeconds: 3600},
+		{AppName: "editor", StartTime: monday.Add(11 * time.Hour), EndTime: monday.Add(11*time.Hour + 10*time.Minute), DurationSeconds: 600},
+		{AppName: "browser", StartTime: tuesday.Add(9 * time.Hour), EndTime: tuesday.Add(9*time.Hour + time.Minute), DurationSeconds: 60},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	// Imported totals have no sessions and must survive the recompute
+	if _, err := db.Import("import:other", nil, []*DailyStats{{AppName: "chat", Date: tuesday, TotalSeconds: 30}}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	query := &StatsQuery{StartDate: monday, EndDate: monday}
+	missing, err := db.HasSessionsWithoutDailyStats(query)
+	if err != nil {
+		t.Fatalf("Failed to check daily stats: %v", err)
+	}
+	if !missing {
+		t.Error("Expected sessions without daily stats to be detected")
+	}
+
+	var calls []int
+	days, err := db.RecomputeDailyStats(&StatsQuery{}, func(done, total int) {
+		if total != 2 {
+			t.Errorf("Expected 2 days in total, got %d", total)
+		}
+		calls = append(calls, done)
+	})
+	if err != nil {
+		t.Fatalf("Failed to recompute: %v", err)
+	}
+	if days != 2 || len(calls) != 2 || calls[1] != 2 {
+		t.Errorf("Expected progress for 2 days, got %d days and calls %v", days, calls)
+	}
+
+	missing, err = db.HasSessionsWithoutDailyStats(query)
+	if err != nil {
+		t.Fatalf("Failed to check daily stats: %v", err)
+	}
+	if missing {
+		t.Error("Expected daily stats to exist after recompute")
+	}
+
+	totals := make(map[string]int64)
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: monday, EndDate: tuesday})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	for _, stat := range stats {
+		totals[stat.Date.Format(DateLayout)+" "+stat.AppName] = stat.TotalSeconds
+	}
+	want := map[string]int64{"2026-01-05 editor": 4200, "2026-01-06 browser": 60, "2026-01-06 chat": 30}
+	if len(totals) != len(want) {
+		t.Errorf("Expected %v, got %v", want, totals)
+	}
+	for key, seconds := range want {
+		if totals[key] != seconds {
+			t.Errorf("Expected %s to be %ds, got %d", key, seconds, totals[key])
+		}
+	}
+
+	// Recomputing a range is idempotent
+	if _, err := db.RecomputeDailyStats(query, nil); err != nil {
+		t.Fatalf("Failed to recompute range: %v", err)
+	}
+	stats, err = db.GetDailyStats(query)
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].TotalSeconds != 4200 {
+		t.Errorf("Expected editor to stay at 4200s, got %+v", stats)
+	}
+}
+
+func TestGetGapsIncludesThoseFromTheDayBefore(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	monday := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	gaps := []*Gap{
+		{Kind: GapLocked, StartTime: monday.Add(-time.Hour), EndTime: monday.Add(7 * time.Hour)},
+		{Kind: GapIdle, StartTime: monday.Add(12 * time.Hour), EndTime: monday.Add(13 * time.Hour)},
+		{Kind: GapIdle, StartTime: monday.AddDate(0, 0, 1).Add(9 * time.Hour), EndTime: monday.AddDate(0, 0, 1).Add(10 * time.Hour)},
+	}
+	if err := db.InsertGaps(gaps); err != nil {
+		t.Fatalf("Failed to insert gaps: %v", err)
+	}
+
+	got, err := db.GetGaps(&StatsQuery{StartDate: monday, EndDate: monday})
+	if err != nil {
+		t.Fatalf("Failed to get gaps: %v", err)
+	}
+	if len(got) != 2 || got[0].Kind != GapLocked || got[1].Kind != GapIdle {
+		t.Fatalf("Expected the overnight lock and the idle gap, got %+v", got)
+	}
+	if !got[0].StartTime.Equal(gaps[0].StartTime) || !got[0].EndTime.Equal(gaps[0].EndTime) {
+		t.Errorf("Expected %v - %v, got %v - %v", gaps[0].StartTime, gaps[0].EndTime, got[0].StartTime, got[0].EndTime)
+	}
+}
+
+// seedCorruptDB writes sessions and daily stats, then truncates the file
+// halfway, as a power loss in the middle of a write might
+func seedCorruptDB(t *testing.T, path string, count int) map[int64]*Session {
+	t.Helper()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := make([]*Session, count)
+	for i := range sessions {
+		begin := start.Add(time.Duration(i) * time.Minute)
+		sessions[i] = &Session{
+			AppName:         fmt.Sprintf("app-%d", i%7),
+			WindowTitle:     fmt.Sprintf("window %d %0200d", i, i),
+			StartTime:       begin,
+			EndTime:         begin.Add(30 * time.Second),
+			DurationSeconds: 30,
+		}
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	seeded := make(map[int64]*Session)
+	stored, err := db.GetSessions(&StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read sessions: %v", err)
+	}
+	for _, session := range stored {
+		seeded[session.ID] = session
+	}
+	db.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+	if err := os.Truncate(path, info.Size()/2); err != nil {
+		t.Fatalf("Failed to truncate database: %v", err)
+	}
+
+	return seeded
+}
+
+func TestNewDBDetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	seedCorruptDB(t, path, 2000)
+
+	_, err := NewDB(path)
+	if !errors.Is(err, ErrCorrupt) || !IsCorrupt(err) {
+		t.Fatalf("Expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a healthy database to pass, got %v", err)
+	}
+}
+
+func TestOpenOrRecoverSalvagesIntactRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	seeded := seedCorruptDB(t, path, 2000)
+
+	db, recovery, err := OpenOrRecover(path, Options{})
+	if err != nil {
+		t.Fatalf("Expected the database to be recovered, got %v", err)
+	}
+	defer db.Close()
+
+	if recovery == nil || recovery.SalvageErr != nil {
+		t.Fatalf("Expected a successful recovery, got %+v", recovery)
+	}
+	if _, err := os.Stat(recovery.CorruptPath); err != nil {
+		t.Errorf("Expected the damaged file to be kept: %v", err)
+	}
+
+	sessions, err := db.GetSessions(&StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to read salvaged sessions: %v", err)
+	}
+	// Half of the file is intact, so roughly half of the rows are too
+	if len(sessions) < len(seeded)/3 || int64(len(sessions)) != recovery.Salvage.Sessions {
+		t.Errorf("Expected at least %d salvaged sessions, got %d (result %+v)", len(seeded)/3, len(sessions), recovery.Salvage)
+	}
+	for _, session := range sessions {
+		want, ok := seeded[session.ID]
+		if !ok || session.WindowTitle != want.WindowTitle || !session.StartTime.Equal(want.StartTime) {
+			t.Fatalf("Salvaged session %d does not match the original: %+v", session.ID, session)
+		}
+	}
+
+	// Dates stay in their column format, so daily stats are still found
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	daily, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day.AddDate(0, 0, 2)})
+	if err != nil {
+		t.Fatalf("Failed to read salvaged daily stats: %v", err)
+	}
+	if int64(len(daily)) != recovery.Salvage.DailyStats || len(daily) == 0 {
+		t.Errorf("Expected %d salvaged daily stats to be queryable, got %d", recovery.Salvage.DailyStats, len(daily))
+	}
+
+	// Tracking continues into the new file
+	if err := db.InsertSession(&Session{AppName: "editor", StartTime: day, EndTime: day, DurationSeconds: 1}); err != nil {
+		t.Errorf("Expected the recovered database to be writable: %v", err)
+	}
+}
+
+func TestOpenOrRecoverLeavesHealthyDatabase(t *testing.T) {
+	path := newTestDB(t)
+
+	db, recovery, err := OpenOrRecover(path, Options{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if recovery != nil {
+		t.Errorf("Expected no recovery for a healthy database, got %+v", recovery)
+	}
+}
+
+func TestSlowQueryHookFires(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	type slowQuery struct {
+		statement string
+		took      time.Duration
+	}
+	var reported []slowQuery
+	db.SetSlowQuery(100*time.Millisecond, func(statement string, took time.Duration) {
+		reported = append(reported, slowQuery{statement, took})
+	})
+
+	// Every statement appears to take 300ms
+	db.slow.since = func(time.Time) time.Duration { return 300 * time.Millisecond }
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	if _, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day}); err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("Expected one slow query, got %+v", reported)
+	}
+	if !strings.HasPrefix(reported[0].statement, "SELECT ") || !strings.Contains(reported[0].statement, " FROM daily_stats ") ||
+		strings.ContainsAny(reported[0].statement, "\n\t") {
+		t.Errorf("Expected the statement shape on one line, got %q", reported[0].statement)
+	}
+	if reported[0].took != 300*time.Millisecond {
+		t.Errorf("Expected 300ms, got %v", reported[0].took)
+	}
+
+	// Fast statements and a disabled check report nothing
+	db.slow.since = func(time.Time) time.Duration { return 10 * time.Millisecond }
+	db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	db.slow.since = func(time.Time) time.Duration { return time.Hour }
+	db.SetSlowQuery(0, nil)
+	db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	if len(reported) != 1 {
+		t.Errorf("Expected no further reports, got %+v", reported[1:])
+	}
+}
+
+func TestGetDailyStatsOrderAndTopApps(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// The editor and the browser lead the week; small apps were used last
+	monday := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	var sessions []*Session
+	for _, usage := range []struct {
+		app     string
+		day     int
+		seconds int64
+	}{
+		{"editor", 0, 18000}, {"editor", 1, 14400}, {"editor", 2, 3600},
+		{"browser", 0, 7200}, {"browser", 1, 10800}, {"Browser", 2, 600},
+		{"chat", 2, 1800}, {"music", 2, 1200}, {"mail", 2, 600},
+	} {
+		start := monday.AddDate(0, 0, usage.day).Add(9 * time.Hour)
+		sessions = append(sessions, &Session{AppName: usage.app, StartTime: start, EndTime: start, DurationSeconds: usage.seconds})
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	week := func(q StatsQuery) []string {
+		t.Helper()
+		q.StartDate, q.EndDate = monday, monday.AddDate(0, 0, 6)
+		rows, err := db.GetDailyStats(&q)
+		if err != nil {
+			t.Fatalf("Failed to get daily stats: %v", err)
+		}
+		var got []string
+		for _, row := range rows {
+			got = append(got, fmt.Sprintf("%s %s %d", row.Date.Format("Mon"), row.AppName, row.TotalSeconds))
+		}
+		return got
+	}
+
+	// Limit alone keeps the most recent app-day rows, not the top apps:
+	// chat makes the cut and the browser, second for the week, does not
+	if got := fmt.Sprint(week(StatsQuery{Limit: 2})); got != "[Wed editor 3600 Wed chat 1800]" {
+		t.Errorf("Unexpected most recent rows %s", got)
+	}
+
+	// TopApps ranks by the total over the range and keeps every day
+	want := "[Wed editor 3600 Wed Browser 600 Tue editor 14400 Tue browser 10800 Mon editor 18000 Mon browser 7200]"
+	if got := fmt.Sprint(week(StatsQuery{TopApps: 2})); got != want {
+		t.Errorf("Expected the rows of the top 2 apps\n%s\ngot\n%s", want, got)
+	}
+
+	// Limit applies after ordering by total
+	if got := fmt.Sprint(week(StatsQuery{OrderBy: OrderByTotal, Limit: 2})); got != "[Mon editor 18000 Tue editor 14400]" {
+		t.Errorf("Unexpected largest rows %s", got)
+	}
+	if got := week(StatsQuery{OrderBy: OrderByTotal, Direction: Ascending, Limit: 2}); fmt.Sprint(got) != "[Wed Browser 600 Wed mail 600]" {
+		t.Errorf("Unexpected smallest rows %v", got)
+	}
+	if got := week(StatsQuery{Direction: Ascending}); got[0] != "Mon editor 18000" {
+		t.Errorf("Expected the oldest day first, got %v", got)
+	}
+
+	if _, err := db.GetDailyStats(&StatsQuery{OrderBy: "app"}); err == nil {
+		t.Error("Expected an error for an unknown order")
+	}
+}
+
+func TestGetTopApps(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	monday := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	var sessions []*Session
+	for _, usage := range []struct {
+		app     string
+		day     int
+		seconds int64
+	}{
+		{"editor", 0, 18000}, {"editor", 1, 14400},
+		{"browser", 0, 7200}, {"Browser", 1, 600},
+		{"chat", 1, 1800}, {"mail", 1, 1800}, {"music", 8, 90000},
+	} {
+		start := monday.AddDate(0, 0, usage.day).Add(9 * time.Hour)
+		sessions = append(sessions, &Session{AppName: usage.app, StartTime: start, EndTime: start, DurationSeconds: usage.seconds})
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	top := func(q StatsQuery) string {
+		t.Helper()
+		q.StartDate, q.EndDate = monday, monday.AddDate(0, 0, 6)
+		totals, err := db.GetTopApps(&q)
+		if err != nil {
+			t.Fatalf("Failed to get top apps: %v", err)
+		}
+		var got []string
+		for _, total := range totals {
+			got = append(got, fmt.Sprintf("%s %d", total.AppName, total.TotalSeconds))
+		}
+		return fmt.Sprint(got)
+	}
+
+	// Totals are over the range, case spellings merge and ties go by name;
+	// music was used the week after
+	if got := top(StatsQuery{}); got != "[editor 32400 Browser 7800 chat 1800 mail 1800]" {
+		t.Errorf("Unexpected totals %s", got)
+	}
+	if got := top(StatsQuery{Limit: 2}); got != "[editor 32400 Browser 7800]" {
+		t.Errorf("Unexpected top 2 %s", got)
+	}
+	if got := top(StatsQuery{AppName: "BROWSER"}); got != "[Browser 7800]" {
+		t.Errorf("Unexpected totals for one app %s", got)
+	}
+	if got := top(StatsQuery{Source: SourceManual}); got != "[]" {
+		t.Errorf("Expected no manual totals, got %s", got)
+	}
+}
+
+func TestGetTitleStats(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	monday := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	var sessions []*Session
+	for _, s := range []struct {
+		app     string
+		title   string
+		day     int
+		seconds int64
+	}{
+		{"Code", "main.go - actime", 0, 1200},
+		{"code", "main.go - actime\x00 ", 0, 600},
+		{"Code", "README.md - actime", 0, 900},
+		{"Code", "", 0, 60},
+		{"Code", "db.go - actime", 1, 3000},
+		{"firefox", "main.go - actime", 0, 5000},
+	} {
+		start := monday.AddDate(0, 0, s.day)
+		sessions = append(sessions, &Session{AppName: s.app, WindowTitle: s.title, StartTime: start, EndTime: start.Add(time.Duration(s.seconds) * time.Second), DurationSeconds: s.seconds})
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	stats, err := db.GetTitleStats("CODE", monday, monday)
+	if err != nil {
+		t.Fatalf("Failed to get title stats: %v", err)
+	}
+	var got []string
+	for _, stat := range stats {
+		got = append(got, fmt.Sprintf("%q %d", stat.WindowTitle, stat.TotalSeconds))
+	}
+	want := `["main.go - actime" 1800 "README.md - actime" 900 "" 60]`
+	if fmt.Sprint(got) != want {
+		t.Errorf("Expected %s, got %s", want, fmt.Sprint(got))
+	}
+
+	byApp, err := db.GetSessionsByApp("code", monday, monday.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(byApp) != 5 {
+		t.Errorf("Expected 5 sessions of Code, got %d", len(byApp))
+	}
+}
+
+func TestGetTitleStatsCountsCheckpointsOnce(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Two checkpoints of one session and a later session with the same title
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "Code", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(10 * time.Minute), DurationSeconds: 600},
+		{AppName: "Code", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(20 * time.Minute), DurationSeconds: 1200},
+		{AppName: "Code", WindowTitle: "main.go", StartTime: start.Add(time.Hour), EndTime: start.Add(65 * time.Minute), DurationSeconds: 300},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	stats, err := db.GetTitleStats("code", start, start)
+	if err != nil {
+		t.Fatalf("Failed to get title stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].WindowTitle != "main.go" || stats[0].TotalSeconds != 1500 {
+		t.Errorf("Expected 1500s for main.go, got %+v", stats)
+	}
+}
+
+// seedSources writes an hour of sessions on two days for the tracker, a
+// manual entry and an import
+func seedSources(t *testing.T, db *DB) (monday, tuesday time.Time) {
+	t.Helper()
+
+	monday = time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	tuesday = monday.AddDate(0, 0, 1)
+	var tracked []*Session
+	for _, day := range []time.Time{monday, tuesday} {
+		start := day.Add(9 * time.Hour)
+		tracked = append(tracked, &Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600})
+	}
+	if err := db.BatchInsertSessions(tracked); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(tracked); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	manual := &Session{AppName: "meeting", StartTime: monday.Add(14 * time.Hour), EndTime: monday.Add(15 * time.Hour), DurationSeconds: 3600, Source: SourceManual}
+	if err := db.InsertSession(manual); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch([]*Session{manual}); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	var imported []*Session
+	var daily []*DailyStats
+	for _, day := range []time.Time{monday, tuesday} {
+		start := day.Add(11 * time.Hour)
+		imported = append(imported, &Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600})
+		daily = append(daily, &DailyStats{AppName: "editor", Date: day, TotalSeconds: 3600})
+	}
+	if _, err := db.Import(ImportSource("rescuetime"), imported, daily); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	return monday, tuesday
+}
+
+func TestSourceFilters(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	monday, tuesday := seedSources(t, db)
+
+	tests := []struct {
+		source   string
+		sessions int
+		seconds  int64
+	}{
+		{"", 5, 5 * 3600},
+		{SourceTracker, 2, 2 * 3600},
+		{SourceManual, 1, 3600},
+		{ImportSource("rescuetime"), 2, 2 * 3600},
+		{MergeSource("laptop"), 0, 0},
+	}
+	for _, tt := range tests {
+		query := &StatsQuery{StartDate: monday, EndDate: tuesday, Source: tt.source}
+		sessions, err := db.GetSessions(query)
+		if err != nil {
+			t.Fatalf("Failed to get sessions: %v", err)
+		}
+		if len(sessions) != tt.sessions {
+			t.Errorf("Expected %d sessions from %q, got %d", tt.sessions, tt.source, len(sessions))
+		}
+		for _, session := range sessions {
+			if tt.source != "" && session.Source != tt.source {
+				t.Errorf("Expected only %q sessions, got one from %q", tt.source, session.Source)
+			}
+		}
+
+		stats, err := db.GetDailyStats(query)
+		if err != nil {
+			t.Fatalf("Failed to get daily stats: %v", err)
+		}
+		var seconds int64
+		for _, stat := range stats {
+			seconds += stat.TotalSeconds
+		}
+		if seconds != tt.seconds {
+			t.Errorf("Expected %ds from %q, got %d", tt.seconds, tt.source, seconds)
+		}
+	}
+}
+
+func TestDeleteSourceLeavesOtherSources(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	monday, tuesday := seedSources(t, db)
+
+	// Only Monday's import is purged
+	query := &StatsQuery{StartDate: monday, EndDate: monday, Source: ImportSource("rescuetime")}
+	sessions, days, err := db.CountSource(query)
+	if err != nil {
+		t.Fatalf("Failed to count: %v", err)
+	}
+	if sessions != 1 || days != 1 {
+		t.Errorf("Expected a dry run to count 1 session and 1 daily total, got %d and %d", sessions, days)
+	}
+
+	sessions, days, err = db.DeleteSource(query)
+	if err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if sessions != 1 || days != 1 {
+		t.Errorf("Expected 1 session and 1 daily total deleted, got %d and %d", sessions, days)
+	}
+
+	counts := make(map[string]int)
+	all, err := db.GetSessions(&StatsQuery{StartDate: monday, EndDate: tuesday})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	for _, session := range all {
+		counts[session.Source]++
+	}
+	want := map[string]int{SourceTracker: 2, SourceManual: 1, ImportSource("rescuetime"): 1}
+	for source, n := range want {
+		if counts[source] != n {
+			t.Errorf("Expected %d sessions from %s, got %d", n, source, counts[source])
+		}
+	}
+
+	// The import's Tuesday total and every other source's totals remain
+	totals := make(map[string]int64)
+	for source := range want {
+		stats, err := db.GetDailyStats(&StatsQuery{StartDate: monday, EndDate: tuesday, Source: source})
+		if err != nil {
+			t.Fatalf("Failed to get daily stats: %v", err)
+		}
+		for _, stat := range stats {
+			totals[stat.Source+" "+stat.Date.Format(DateLayout)] += stat.TotalSeconds
+		}
+	}
+	if len(totals) != 4 || totals["import:rescuetime 2026-01-06"] != 3600 || totals["manual 2026-01-05"] != 3600 ||
+		totals["tracker 2026-01-05"] != 3600 || totals["tracker 2026-01-06"] != 3600 {
+		t.Errorf("Unexpected daily totals after the purge: %v", totals)
+	}
+
+	if _, _, err := db.DeleteSource(&StatsQuery{Source: "rescuetime"}); err == nil {
+		t.Error("Expected a bare tool name to be rejected")
+	}
+}
+
+func TestWriteSessionsUndoesRowWithItsTotals(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// The session of "broken" is inserted, but its daily total is refused
+	if _, err := db.conn.Exec(`CREATE TRIGGER refuse_broken BEFORE INSERT ON daily_stats
+	WHEN NEW.app_name = 'broken' BEGIN SELECT RAISE(ABORT, 'refused'); END`); err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	broken := &Session{AppName: "broken", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60}
+	sessions := []*Session{
+		{AppName: "editor", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600},
+		broken,
+	}
+
+	err = db.WriteSessions(sessions)
+	batchErr, ok := AsBatchError(err)
+	if !ok || len(batchErr.Failed) != 1 || batchErr.Failed[0].Session != broken {
+		t.Fatalf("Expected the broken session to be reported, got %v", err)
+	}
+
+	stored, err := db.GetSessions(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(stored) != 1 || stored[0].AppName != "editor" {
+		t.Errorf("Expected the broken session's row to be undone, got %+v", stored)
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].TotalSeconds != 3600 {
+		t.Errorf("Expected only the editor's total, got %+v", stats)
+	}
+	hourly, err := db.GetHourlyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get hourly stats: %v", err)
+	}
+	if len(hourly) != 1 || hourly[0].AppName != "editor" || hourly[0].TotalSeconds != 3600 {
+		t.Errorf("Expected only the editor's hour, got %+v", hourly)
+	}
+}
+
+func TestWriteSessionsExtendsCheckpoints(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// One session flushed three times, the last checkpoint arriving late
+	start := time.Date(2026, 1, 5, 9, 50, 0, 0, time.Local)
+	for _, seconds := range []int64{600, 1800, 1200} {
+		session := &Session{AppName: "editor", WindowTitle: "main.go", StartTime: start,
+			EndTime: start.Add(time.Duration(seconds) * time.Second), DurationSeconds: seconds}
+		if err := db.WriteSessions([]*Session{session}); err != nil {
+			t.Fatalf("Failed to write %ds checkpoint: %v", seconds, err)
+		}
+	}
+
+	sessions, err := db.GetSessions(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].DurationSeconds != 1800 || !sessions[0].EndTime.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("Expected one 1800s session, got %+v", sessions)
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].TotalSeconds != 1800 {
+		t.Errorf("Expected 1800s of daily stats, got %+v", stats)
+	}
+	hourly, err := db.GetHourlyStats(&StatsQuery{StartDate: start, EndDate: start})
+	if err != nil {
+		t.Fatalf("Failed to get hourly stats: %v", err)
+	}
+	hours := make(map[int]int64)
+	for _, stat := range hourly {
+		hours[stat.Hour] += stat.TotalSeconds
+	}
+	if len(hours) != 2 || hours[9] != 600 || hours[10] != 1200 {
+		t.Errorf("Expected 600s at 9 and 1200s at 10, got %v", hours)
+	}
+}
+
+func TestDeleteSessionsAdjustsTotals(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// The late Monday session runs half an hour into Tuesday
+	monday := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	tuesday := monday.AddDate(0, 0, 1)
+	var sessions []*Session
+	for _, s := range []struct {
+		app     string
+		start   time.Time
+		seconds int64
+	}{
+		{"Signal", monday.Add(9 * time.Hour), 1800},
+		{"signal", monday.Add(23*time.Hour + 30*time.Minute), 3600},
+		{"editor", monday.Add(9 * time.Hour), 3600},
+		{"Signal", tuesday.Add(10 * time.Hour), 600},
+	} {
+		sessions = append(sessions, &Session{AppName: s.app, StartTime: s.start, EndTime: s.start.Add(time.Duration(s.seconds) * time.Second), DurationSeconds: s.seconds})
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	filter := StatsQuery{AppName: "SIGNAL", StartDate: monday, EndDate: monday}
+	if count, err := db.CountSessions(filter); err != nil || count != 2 {
+		t.Errorf("Expected a count of 2 sessions, got %d (%v)", count, err)
+	}
+	deleted, days, err := db.DeleteSessions(filter)
+	if err != nil {
+		t.Fatalf("Failed to delete sessions: %v", err)
+	}
+	if deleted != 2 || days != 2 {
+		t.Errorf("Expected 2 sessions and 2 daily totals deleted, got %d and %d", deleted, days)
+	}
+
+	daily, err := db.GetDailyStats(&StatsQuery{StartDate: monday, EndDate: tuesday, Direction: Ascending})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	var got []string
+	for _, stat := range daily {
+		got = append(got, fmt.Sprintf("%s %s %d", stat.Date.Format("Mon"), stat.AppName, stat.TotalSeconds))
+	}
+	if fmt.Sprint(got) != "[Mon editor 3600 Tue Signal 600]" {
+		t.Errorf("Unexpected daily totals after the delete: %v", got)
+	}
+
+	// The half hour on Tuesday is gone from the hourly totals too
+	hourly, err := db.GetHourlyStats(&StatsQuery{StartDate: tuesday, EndDate: tuesday})
+	if err != nil {
+		t.Fatalf("Failed to get hourly stats: %v", err)
+	}
+	got = nil
+	for _, stat := range hourly {
+		got = append(got, fmt.Sprintf("%d %s %d", stat.Hour, stat.AppName, stat.TotalSeconds))
+	}
+	if fmt.Sprint(got) != "[10 Signal 600]" {
+		t.Errorf("Unexpected hourly totals after the delete: %v", got)
+	}
+
+	if _, _, err := db.DeleteSessions(StatsQuery{StartDate: monday}); err == nil {
+		t.Error("Expected a filter without application or source to be rejected")
+	}
+}
+
+func TestMigrateSourceNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+
+	// Tables as created when tracked rows had no source and imported rows
+	// were tagged with the bare tool name
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := legacy.Exec(`
+	CREATE TABLE sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		window_title TEXT,
+		raw_title TEXT,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		duration_seconds INTEGER NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE UNIQUE INDEX idx_sessions_source_key
+	ON sessions(source, app_name, window_title, start_time) WHERE source != '';
+	CREATE TABLE daily_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		date DATE NOT NULL,
+		total_seconds INTEGER NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		UNIQUE(app_name, date, source)
+	);
+	INSERT INTO sessions (app_name, start_time, duration_seconds) VALUES ('editor', '2026-01-05 09:00:00', 60);
+	INSERT INTO sessions (app_name, start_time, duration_seconds, source) VALUES ('editor', '2026-01-05 10:00:00', 60, 'rescuetime');
+	INSERT INTO daily_stats (app_name, date, total_seconds) VALUES ('editor', '2026-01-05', 60);
+	INSERT INTO daily_stats (app_name, date, total_seconds, source) VALUES ('editor', '2026-01-05', 60, 'rescuetime');
+	`); err != nil {
+		t.Fatalf("Failed to create legacy tables: %v", err)
+	}
+	legacy.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	for _, table := range []string{"sessions", "daily_stats"} {
+		rows, err := db.conn.Query("SELECT source FROM " + table + " ORDER BY id")
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", table, err)
+		}
+		var sources []string
+		for rows.Next() {
+			var source string
+			if err := rows.Scan(&source); err != nil {
+				t.Fatalf("Failed to scan %s: %v", table, err)
+			}
+			sources = append(sources, source)
+		}
+		rows.Close()
+
+		if strings.Join(sources, ",") != "tracker,import:rescuetime" {
+			t.Errorf("Expected %s sources to be named, got %v", table, sources)
+		}
+	}
+
+	// Tracked rows may share a start once they share a source
+	day := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	for i := 0; i < 2; i++ {
+		if err := db.InsertSession(&Session{AppName: "editor", StartTime: day, DurationSeconds: int64(60 * (i + 1))}); err != nil {
+			t.Fatalf("Failed to insert checkpoint %d: %v", i+1, err)
+		}
+	}
+
+	// Rows from before updated_at start out updated when created
+	var stale int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM sessions WHERE updated_at IS NULL OR updated_at != created_at").Scan(&stale); err != nil {
+		t.Fatalf("Failed to read updated_at: %v", err)
+	}
+	if stale != 0 {
+		t.Errorf("Expected updated_at to be backfilled from created_at, %d rows differ", stale)
+	}
+}
+
+func TestBatchWritesSkipBadRows(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	bad := &Session{AppName: "editor", WindowTitle: "broken", DurationSeconds: 60}
+	sessions := []*Session{
+		{AppName: "editor", StartTime: day, EndTime: day.Add(time.Minute), DurationSeconds: 60},
+		bad,
+		{AppName: "browser", StartTime: day.Add(time.Hour), EndTime: day.Add(time.Hour + time.Minute), DurationSeconds: 60},
+	}
+
+	for name, write := range map[string]func([]*Session) error{
+		"BatchInsertSessions":   db.BatchInsertSessions,
+		"UpdateDailyStatsBatch": db.UpdateDailyStatsBatch,
+	} {
+		err := write(sessions)
+		batchErr, ok := AsBatchError(err)
+		if !ok {
+			t.Fatalf("Expected %s to return a BatchError, got %v", name, err)
+		}
+		if failed := batchErr.Sessions(); len(failed) != 1 || failed[0] != bad {
+			t.Errorf("Expected %s to report only the bad session, got %+v", name, batchErr.Failed)
+		}
+		if !strings.Contains(batchErr.Error(), "missing start time") {
+			t.Errorf("Expected the reason in %s's error, got %q", name, batchErr.Error())
+		}
+	}
+
+	stored, err := db.GetSessions(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Errorf("Expected the 2 good sessions to be committed, got %d", len(stored))
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	var total int64
+	for _, stat := range stats {
+		total += stat.TotalSeconds
+	}
+	if total != 120 {
+		t.Errorf("Expected 120s counted for the good sessions, got %d", total)
+	}
+}
+
+func TestRepairOverlongSession(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// A stuck detector left a 40-hour session before the cap existed
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	sessions := []*Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(40 * time.Hour), DurationSeconds: 40 * 3600},
+		{AppName: "browser", WindowTitle: "docs", StartTime: start.Add(-time.Hour), EndTime: start, DurationSeconds: 3600},
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	overlong, err := db.OverlongSessions(12 * time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to find overlong sessions: %v", err)
+	}
+	if len(overlong) != 1 || overlong[0].AppName != "editor" {
+		t.Fatalf("Expected the 40-hour session to be flagged, got %+v", overlong)
+	}
+
+	pieces := SplitSession(overlong[0], 12*time.Hour)
+	var hours []int64
+	for _, piece := range pieces {
+		hours = append(hours, piece.DurationSeconds/3600)
+	}
+	if !reflect.DeepEqual(hours, []int64{12, 12, 12, 4}) || !pieces[3].EndTime.Equal(start.Add(40*time.Hour)) {
+		t.Fatalf("Expected pieces of 12, 12, 12 and 4 hours, got %v", hours)
+	}
+	if truncated := TruncateSession(overlong[0], 12*time.Hour); truncated.DurationSeconds != 12*3600 || !truncated.EndTime.Equal(start.Add(12*time.Hour)) {
+		t.Errorf("Expected a 12-hour session, got %+v", truncated)
+	}
+
+	if err := db.ReplaceSession(overlong[0].ID, pieces); err != nil {
+		t.Fatalf("Failed to replace session: %v", err)
+	}
+	if overlong, err := db.OverlongSessions(12 * time.Hour); err != nil || len(overlong) != 0 {
+		t.Errorf("Expected nothing over the cap after the repair, got %d (%v)", len(overlong), err)
+	}
+
+	stored, err := db.GetSessions(&StatsQuery{AppName: "editor"})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	var total int64
+	for _, session := range stored {
+		total += session.DurationSeconds
+		if session.WindowTitle != "main.go" || session.Source != SourceTracker {
+			t.Errorf("Expected the pieces to keep title and source, got %+v", session)
+		}
+	}
+	if len(stored) != 4 || total != 40*3600 {
+		t.Errorf("Expected 4 pieces adding up to 40 hours, got %d pieces of %ds", len(stored), total)
+	}
+
+	if err := db.ReplaceSession(overlong[0].ID, pieces); err == nil {
+		t.Error("Expected replacing a missing session to fail")
+	}
+}
+
+func TestSnapshotHidesFlushBetweenQueries(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	query := &StatsQuery{StartDate: day, EndDate: day}
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	flushed := 0
+
+	// A flush writes the sessions first and the daily totals after them
+	flush := func() {
+		t.Helper()
+		flushed++
+		session := &Session{
+			AppName:         "editor",
+			StartTime:       start.Add(time.Duration(flushed) * time.Hour),
+			EndTime:         start.Add(time.Duration(flushed)*time.Hour + time.Minute),
+			DurationSeconds: 60,
+		}
+		if err := db.BatchInsertSessions([]*Session{session}); err != nil {
+			t.Fatalf("Failed to insert session: %v", err)
+		}
+		if err := db.UpdateDailyStatsBatch([]*Session{session}); err != nil {
+			t.Fatalf("Failed to update daily stats: %v", err)
+		}
+	}
+
+	// report reads the daily totals, lets a flush happen, then reads the
+	// sessions, returning the seconds seen by each query
+	report := func(r *DB) (daily, sessions int64) {
+		t.Helper()
+		rows, err := r.GetDailyStats(query)
+		if err != nil {
+			t.Fatalf("Failed to get daily stats: %v", err)
+		}
+		for _, row := range rows {
+			daily += row.TotalSeconds
+		}
+
+		flush()
+
+		found, err := r.GetSessions(query)
+		if err != nil {
+			t.Fatalf("Failed to get sessions: %v", err)
+		}
+		for _, session := range found {
+			sessions += session.DurationSeconds
+		}
+		return daily, sessions
+	}
+
+	flush()
+
+	// Without a snapshot the second query sees the flush and the first not
+	if daily, sessions := report(db); daily != 60 || sessions != 120 {
+		t.Errorf("Expected 60s daily and 120s of sessions without a snapshot, got %d and %d", daily, sessions)
+	}
+
+	// In a snapshot both see the state from before the flush
+	var daily, sessions int64
+	if err := db.Snapshot(func(view *DB) error {
+		daily, sessions = report(view)
+		return nil
+	}); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if daily != 120 || sessions != 120 {
+		t.Errorf("Expected 120s from both queries in a snapshot, got %d and %d", daily, sessions)
+	}
+
+	// The flush is visible once the snapshot ends
+	if rows, err := db.GetDailyStats(query); err != nil || len(rows) != 1 || rows[0].TotalSeconds != 180 {
+		t.Errorf("Expected 180s after the snapshot, got %v (%v)", rows, err)
+	}
+}
+
+func TestCompactShrinksFile(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	title := strings.Repeat("a long window title ", 20)
+	sessions := make([]*Session, 0, 5000)
+	for i := 0; i < cap(sessions); i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		sessions = append(sessions, &Session{AppName: "editor", WindowTitle: title, StartTime: at, EndTime: at.Add(time.Minute), DurationSeconds: 60})
+	}
+	if err := db.BatchInsertSessions(sessions); err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+	if _, err := db.PruneSessions(start.AddDate(0, 0, 30), nil); err != nil {
+		t.Fatalf("Failed to delete sessions: %v", err)
+	}
+
+	before, after, err := db.Compact()
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if after >= before/4 {
+		t.Errorf("Expected the file to shrink well below %d bytes, got %d", before, after)
+	}
+	if count, err := db.CountSessionsBefore(start.AddDate(1, 0, 0)); err != nil || count != 0 {
+		t.Errorf("Expected no sessions after compacting, got %d (%v)", count, err)
+	}
+}
+
+func TestSecureCompactRemovesDeletedRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	const sentinel = "sentinel-title-7d1e4c"
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	for _, session := range []*Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600},
+		{AppName: "browser", WindowTitle: sentinel, StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600, Source: SourceManual},
+	} {
+		if err := db.InsertSession(session); err != nil {
+			t.Fatalf("Failed to insert session: %v", err)
+		}
+	}
+	if _, _, err := db.DeleteSource(&StatsQuery{Source: SourceManual}); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	db.Close()
+
+	contains := func() bool {
+		t.Helper()
+		var data []byte
+		for _, suffix := range []string{"", "-wal"} {
+			part, err := os.ReadFile(path + suffix)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatalf("Failed to read database: %v", err)
+			}
+			data = append(data, part...)
+		}
+		return strings.Contains(string(data), sentinel)
+	}
+
+	// A plain delete leaves the title in free pages
+	if !contains() {
+		t.Fatal("Expected the deleted title to remain in the file before compacting")
+	}
+
+	if err := SecureCompact(path); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if contains() {
+		t.Error("Expected the deleted title to be gone after compacting")
+	}
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open compacted database: %v", err)
+	}
+	defer db.Close()
+	sessions, err := db.GetSessions(&StatsQuery{})
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].WindowTitle != "main.go" {
+		t.Errorf("Expected the kept session to survive, got %+v", sessions)
+	}
+	if matches, _ := filepath.Glob(path + ".compact-*"); len(matches) != 0 {
+		t.Errorf("Expected no leftover copy, got %v", matches)
+	}
+}
+
+func TestMetaFollowsMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+
+	// A database from before gaps, the maintenance log and updated_at
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := legacy.Exec(`
+	CREATE TABLE sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		window_title TEXT,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		duration_seconds INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE daily_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		date DATE NOT NULL,
+		total_seconds INTEGER NOT NULL,
+		UNIQUE(app_name, date)
+	);
+	`); err != nil {
+		t.Fatalf("Failed to create legacy tables: %v", err)
+	}
+	legacy.Close()
+
+	meta := func() *Meta {
+		t.Helper()
+		db, err := OpenReadOnly(path)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		meta, err := db.Meta()
+		if err != nil {
+			t.Fatalf("Failed to read meta: %v", err)
+		}
+		return meta
+	}
+
+	before := meta()
+	if before.SchemaVersion != 0 || len(before.Capabilities) != 0 {
+		t.Errorf("Expected an unversioned schema without capabilities, got %+v", before)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	db.Close()
+
+	after := meta()
+	if after.SchemaVersion != SchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", SchemaVersion, after.SchemaVersion)
+	}
+	if got, want := strings.Join(after.Capabilities, ","), "sources,raw_titles,gaps,maintenance_log,updated_at,domains,exe_paths,monitors,hourly_stats,categories"; got != want {
+		t.Errorf("Expected capabilities %s, got %s", want, got)
+	}
+}
+
+// version1Schema is the schema as first recorded, at user_version 1
+const version1Schema = `
+	CREATE TABLE sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		window_title TEXT,
+		raw_title TEXT,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		duration_seconds INTEGER NOT NULL,
+		source TEXT NOT NULL DEFAULT 'tracker',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME
+	);
+	CREATE TABLE daily_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		date DATE NOT NULL,
+		total_seconds INTEGER NOT NULL,
+		source TEXT NOT NULL DEFAULT 'tracker',
+		UNIQUE(app_name, date, source)
+	);
+	CREATE TABLE gaps (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL
+	);
+	CREATE TABLE maintenance_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		rows_affected INTEGER NOT NULL DEFAULT 0,
+		performed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	PRAGMA user_version = 1;
+`
+
+func TestMigrateVersion1Database(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	start := time.Date(2026, 1, 5, 9, 30, 0, 0, time.Local)
+	if _, err := legacy.Exec(version1Schema); err != nil {
+		t.Fatalf("Failed to create version 1 schema: %v", err)
+	}
+	if _, err := legacy.Exec(
+		"INSERT INTO sessions (app_name, window_title, start_time, end_time, duration_seconds) VALUES (?, ?, ?, ?, ?)",
+		"editor", "main.go", start, start.Add(time.Hour), 3600); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	legacy.Close()
+
+	// Opening it twice upgrades it once
+	for i := 0; i < 2; i++ {
+		db, err := NewDB(path)
+		if err != nil {
+			t.Fatalf("Failed to open database (%d): %v", i+1, err)
+		}
+
+		var version int
+		if err := db.conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != SchemaVersion {
+			t.Errorf("Expected schema version %d, got %d (%v)", SchemaVersion, version, err)
+		}
+
+		var applied []string
+		rows, err := db.conn.Query("SELECT version, name FROM schema_version ORDER BY version")
+		if err != nil {
+			t.Fatalf("Failed to read schema_version: %v", err)
+		}
+		for rows.Next() {
+			var v int
+			var name string
+			if err := rows.Scan(&v, &name); err != nil {
+				t.Fatalf("Failed to scan row: %v", err)
+			}
+			applied = append(applied, fmt.Sprint(v))
+		}
+		rows.Close()
+		if got := strings.Join(applied, ","); got != "2,3,4,5,6" {
+			t.Errorf("Expected migrations 2 to 6 recorded, got %s", got)
+		}
+
+		for _, column := range []string{"domain", "exe_path", "monitor_index", "workspace", "category"} {
+			if ok, err := db.hasColumn("sessions", column); err != nil || !ok {
+				t.Errorf("Expected column sessions.%s, got %v (%v)", column, ok, err)
+			}
+		}
+
+		// The old session is readable and its hours were backfilled
+		sessions, err := db.GetSessions(&StatsQuery{})
+		if err != nil || len(sessions) != 1 || sessions[0].WindowTitle != "main.go" {
+			t.Errorf("Expected the version 1 session, got %v (%v)", sessions, err)
+		}
+		want := map[string]int64{"editor 2026-01-05 09": 1800, "editor 2026-01-05 10": 1800}
+		if got := hourTotals(t, db, &StatsQuery{}); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected hourly totals %v, got %v", want, got)
+		}
+		db.Close()
+	}
+}
+
+func TestMigrationsEndAtSchemaVersion(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, m.version)
+		}
+	}
+	if last := migrations[len(migrations)-1].version; last != SchemaVersion {
+		t.Errorf("Expected the last migration to be SchemaVersion %d, got %d", SchemaVersion, last)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Close()
+
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append(append([]migration{}, saved...), migration{SchemaVersion + 1, "broken", func(tx *sql.Tx) error {
+		if err := addColumn(tx, "sessions", "broken", "TEXT"); err != nil {
+			return err
+		}
+		return errors.New("disk full")
+	}})
+
+	if db, err := NewDB(path); err == nil {
+		db.Close()
+		t.Fatal("Expected the failing migration to fail NewDB")
+	}
+
+	view, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer view.Close()
+	meta, err := view.Meta()
+	if err != nil {
+		t.Fatalf("Failed to read meta: %v", err)
+	}
+	if meta.SchemaVersion != SchemaVersion {
+		t.Errorf("Expected the version to stay at %d, got %d", SchemaVersion, meta.SchemaVersion)
+	}
+	if ok, err := view.hasColumn("sessions", "broken"); err != nil || ok {
+		t.Errorf("Expected the column of the failed migration to be rolled back, got %v (%v)", ok, err)
+	}
+}
+
+func TestReadsWhileWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actime.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// The CLI reads through its own read-only connection while the daemon
+	// writes
+	cli, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer cli.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	done := make(chan struct{})
+	errs := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		reader := db
+		if i%2 == 1 {
+			reader = cli
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := reader.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	const batches, perBatch = 50, 20
+	for b := 0; b < batches; b++ {
+		var sessions []*Session
+		for i := 0; i < perBatch; i++ {
+			start := day.Add(time.Duration(b*perBatch+i) * time.Minute)
+			sessions = append(sessions, &Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Minute), DurationSeconds: 60})
+		}
+		if err := db.BatchInsertSessions(sessions); err != nil {
+			t.Fatalf("Failed to insert sessions: %v", err)
+		}
+		if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+			t.Fatalf("Failed to update daily stats: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Read failed while writing: %v", err)
+	}
+
+	stats, err := cli.GetDailyStats(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil || len(stats) != 1 || stats[0].TotalSeconds != batches*perBatch*60 {
+		t.Errorf("Expected %ds of editor, got %v (%v)", batches*perBatch*60, stats, err)
+	}
+}
+
+func TestReadRetriesWhileBusy(t *testing.T) {
+	// Without WAL an exclusive lock keeps readers out
+	path := filepath.Join(t.TempDir(), "locked.db")
+	locker, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer locker.Close()
+	locker.SetMaxOpenConns(1)
+	if _, err := locker.Exec("CREATE TABLE t (n INTEGER); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(0)", filepath.ToSlash(path)))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer conn.Close()
+	once := &handle{DB: conn, slow: newSlowQueries(0)}
+	retrying := &handle{DB: conn, slow: newSlowQueries(0), retries: readRetries}
+
+	if _, err := locker.Exec("BEGIN EXCLUSIVE"); err != nil {
+		t.Fatalf("Failed to lock database: %v", err)
+	}
+	var n int
+	if err := once.QueryRow("SELECT n FROM t").Scan(&n); !IsBusy(err) {
+		t.Fatalf("Expected a busy error without retries, got %v", err)
+	}
+
+	// The lock is released during the retries
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		locker.Exec("COMMIT")
+	}()
+	if err := retrying.QueryRow("SELECT n FROM t").Scan(&n); err != nil || n != 1 {
+		t.Errorf("Expected the read to succeed once the lock was released, got %d (%v)", n, err)
+	}
+}
+
+func TestBackupWhileWriting(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(filepath.Join(dir, "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	const batches, perBatch = 100, 10
+	inserted := make(chan error, 1)
+	go func() {
+		for b := 0; b < batches; b++ {
+			var sessions []*Session
+			for i := 0; i < perBatch; i++ {
+				start := day.Add(time.Duration(b*perBatch+i) * time.Second)
+				sessions = append(sessions, &Session{AppName: "editor", StartTime: start, EndTime: start.Add(time.Second), DurationSeconds: 1})
+			}
+			if err := db.BatchInsertSessions(sessions); err != nil {
+				inserted <- err
+				return
+			}
+		}
+		inserted <- nil
+	}()
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("backup-%d.db", i))
+		if err := db.BackupTo(path); err != nil {
+			t.Fatalf("Failed to back up: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	if err := <-inserted; err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	// Each backup holds whole batches, never part of a transaction
+	for _, path := range paths {
+		backup, err := OpenReadOnly(path)
+		if err != nil {
+			t.Fatalf("Failed to open backup: %v", err)
+		}
+		count, err := backup.CountSessionsBefore(day.AddDate(0, 0, 1))
+		backup.Close()
+		if err != nil {
+			t.Fatalf("Failed to count sessions: %v", err)
+		}
+		if count%perBatch != 0 {
+			t.Errorf("Expected whole batches in %s, got %d sessions", filepath.Base(path), count)
+		}
+	}
+
+	if err := db.BackupTo(paths[0]); err == nil {
+		t.Error("Expected an existing backup not to be overwritten")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("Expected no leftover copy, got %v", matches)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	var names []string
+	for i := 0; i < 5; i++ {
+		names = append(names, BackupName(start.Add(time.Duration(i)*time.Hour)))
+	}
+	for _, name := range append(names, "notes.db") {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	removed, err := PruneBackups(dir, 2)
+	if err != nil {
+		t.Fatalf("Failed to prune backups: %v", err)
+	}
+	if len(removed) != 3 {
+		t.Errorf("Expected 3 backups removed, got %v", removed)
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*"))
+	want := []string{filepath.Join(dir, names[3]), filepath.Join(dir, names[4]), filepath.Join(dir, "notes.db")}
+	if strings.Join(left, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v to be left, got %v", want, left)
+	}
+}
+
+func TestMergeFrom(t *testing.T) {
+	dir := t.TempDir()
+	other, err := NewDB(filepath.Join(dir, "laptop.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	for _, session := range []*Session{
+		{AppName: "editor", WindowTitle: "main.go", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600},
+		{AppName: "browser", StartTime: start.AddDate(0, 0, 1), EndTime: start.AddDate(0, 0, 1).Add(time.Hour), DurationSeconds: 3600},
+		{AppName: "meeting", StartTime: start.Add(2 * time.Hour), EndTime: start.Add(3 * time.Hour), DurationSeconds: 3600, Source: SourceManual},
+		// Came from elsewhere, so it is not merged
+		{AppName: "music", StartTime: start, EndTime: start.Add(time.Hour), DurationSeconds: 3600, Source: ImportSource("rescuetime")},
+	} {
+		if err := other.InsertSession(session); err != nil {
+			t.Fatalf("Failed to insert session: %v", err)
+		}
+	}
+	other.Close()
+
+	db, err := NewDB(filepath.Join(dir, "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	total := func() int64 {
+		t.Helper()
+		stats, err := db.GetDailyStats(&StatsQuery{Source: MergeSource("laptop"), StartDate: start, EndDate: start.AddDate(0, 0, 1)})
+		if err != nil {
+			t.Fatalf("Failed to get daily stats: %v", err)
+		}
+		var sum int64
+		for _, s := range stats {
+			sum += s.TotalSeconds
+		}
+		return sum
+	}
+
+	result, err := db.MergeFrom(filepath.Join(dir, "laptop.db"), "")
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	if result.Source != "merge:laptop" || result.Added != 3 || result.Skipped != 0 || len(result.Conflicts) != 0 {
+		t.Errorf("Expected 3 sessions added to merge:laptop, got %+v", result)
+	}
+	if got := total(); got != 3*3600 {
+		t.Errorf("Expected 3h of merged daily stats, got %ds", got)
+	}
+
+	// Merging again adds nothing, and a session that grew meanwhile keeps
+	// its longer duration
+	other, err = NewDB(filepath.Join(dir, "laptop.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := other.conn.Exec("UPDATE sessions SET duration_seconds = 5400 WHERE app_name = 'editor'"); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+	other.Close()
+
+	result, err = db.MergeFrom(filepath.Join(dir, "laptop.db"), "")
+	if err != nil {
+		t.Fatalf("Failed to merge again: %v", err)
+	}
+	if result.Added != 0 || result.Skipped != 2 || len(result.Conflicts) != 1 {
+		t.Fatalf("Expected 2 skipped and 1 conflict, got %+v", result)
+	}
+	if conflict := result.Conflicts[0]; conflict.AppName != "editor" || conflict.Existing != 3600 || conflict.Incoming != 5400 {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+	if got := total(); got != 3*3600+1800 {
+		t.Errorf("Expected the longer duration in the daily stats, got %ds", got)
+	}
+
+	if _, err := db.MergeFrom(filepath.Join(dir, "actime.db"), "self"); err == nil {
+		t.Error("Expected merging a database into itself to fail")
+	}
+}
+
+func TestMergeFromCollapsesCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	other, err := NewDB(filepath.Join(dir, "laptop.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	// The tracker wrote three checkpoints of one session
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	for _, seconds := range []int64{600, 1200, 1800} {
+		session := &Session{AppName: "editor", WindowTitle: "main.go", StartTime: start,
+			EndTime: start.Add(time.Duration(seconds) * time.Second), DurationSeconds: seconds}
+		if err := other.InsertSession(session); err != nil {
+			t.Fatalf("Failed to insert session: %v", err)
+		}
+	}
+	other.Close()
+
+	db, err := NewDB(filepath.Join(dir, "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for i, want := range []int64{1, 0} {
+		result, err := db.MergeFrom(filepath.Join(dir, "laptop.db"), "")
+		if err != nil {
+			t.Fatalf("Failed to merge (%d): %v", i+1, err)
+		}
+		if result.Added != want || result.Skipped != 1-want || len(result.Conflicts) != 0 {
+			t.Errorf("Expected %d sessions added and no conflicts (%d), got %+v", want, i+1, result)
+		}
+	}
+
+	sessions, err := db.GetSessions(&StatsQuery{Source: MergeSource("laptop")})
+	if err != nil || len(sessions) != 1 || sessions[0].DurationSeconds != 1800 {
+		t.Errorf("Expected the longest checkpoint, got %+v (%v)", sessions, err)
+	}
+	stats, err := db.GetDailyStats(&StatsQuery{Source: MergeSource("laptop"), StartDate: start, EndDate: start})
+	if err != nil || len(stats) != 1 || stats[0].TotalSeconds != 1800 {
+		t.Errorf("Expected 1800s of daily stats, got %+v (%v)", stats, err)
+	}
+}
+
+func TestMergeFromOlderDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "old.db")
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	if _, err := legacy.Exec(version1Schema); err != nil {
+		t.Fatalf("Failed to create version 1 schema: %v", err)
+	}
+	if _, err := legacy.Exec(
+		"INSERT INTO sessions (app_name, window_title, start_time, end_time, duration_seconds) VALUES (?, ?, ?, ?, ?)",
+		"editor", nil, start, start.Add(time.Hour), 3600); err != nil {
+		t.Fatalf("Failed to insert session: %v", err)
+	}
+	legacy.Close()
+
+	db, err := NewDB(filepath.Join(dir, "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Sessions without a title are recognized when merged again
+	for i, want := range []int64{1, 0} {
+		result, err := db.MergeFrom(path, "desktop")
+		if err != nil {
+			t.Fatalf("Failed to merge (%d): %v", i+1, err)
+		}
+		if result.Added != want || result.Skipped != 1-want {
+			t.Errorf("Expected %d sessions added (%d), got %+v", want, i+1, result)
+		}
+	}
+	sessions, err := db.GetSessions(&StatsQuery{Source: MergeSource("desktop")})
+	if err != nil || len(sessions) != 1 || sessions[0].AppName != "editor" {
+		t.Errorf("Expected the merged session, got %+v (%v)", sessions, err)
+	}
+}
+
+func TestCancelledContextAbortsQuery(t *testing.T) {
+	db, err := NewDB(newTestDB(t))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Counting this far takes far longer than the test allows
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var n int64
+	err = db.read.QueryRowContext(ctx, `
+	WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 10000000000)
+	SELECT count(*) FROM c
+	`).Scan(&n)
+	if err == nil {
+		t.Fatalf("Expected the query to be aborted, got %d", n)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Expected the query to stop soon after the deadline, took %s", took)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.Local)
+	if _, err := db.GetSessionsContext(cancelled, &StatsQuery{StartDate: day, EndDate: day}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected sessions to fail with the context, got %v", err)
+	}
+	if _, err := db.GetDailyStatsContext(cancelled, &StatsQuery{StartDate: day, EndDate: day}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected daily stats to fail with the context, got %v", err)
+	}
+	session := &Session{AppName: "browser", StartTime: day.Add(time.Hour), EndTime: day.Add(2 * time.Hour), DurationSeconds: 3600}
+	if err := db.BatchInsertSessionsContext(cancelled, []*Session{session}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the insert to fail with the context, got %v", err)
+	}
+
+	// The pools are still usable, and the cancelled insert wrote nothing
+	sessions, err := db.GetSessions(&StatsQuery{StartDate: day, EndDate: day})
+	if err != nil || len(sessions) != 1 || sessions[0].AppName != "editor" {
+		t.Errorf("Expected only the original session, got %+v (%v)", sessions, err)
+	}
+}
+
+func TestGetDailyStatsIncludesBothEnds(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "actime.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Noon, so neither bound of the range falls on midnight
+	start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.Local)
+	var sessions []*Session
+	for i := 0; i < 3; i++ {
+		at := start.AddDate(0, 0, i)
+		sessions = append(sessions, &Session{AppName: "editor", StartTime: at, EndTime: at.Add(time.Minute), DurationSeconds: 60})
+	}
+	if err := db.UpdateDailyStatsBatch(sessions); err != nil {
+		t.Fatalf("Failed to update daily stats: %v", err)
+	}
+
+	stats, err := db.GetDailyStats(&StatsQuery{StartDate: start, EndDate: start.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to get daily stats: %v", err)
+	}
+	var total int64
+	for _, stat := range stats {
+		total += stat.TotalSeconds
+	}
+	if len(stats) != 2 || total != 120 {
+		t.Errorf("Expected the first and last day of the range, got %d rows with %ds", len(stats), total)
+	}
+}
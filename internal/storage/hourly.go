@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hourlyStatsTable creates hourly_stats, the time of each application in
+// each local hour, kept per source like daily_stats. A session is split
+// between the hours it covers, so unlike daily_stats it can add to the day
+// after the one it started on.
+const hourlyStatsTable = `
+	CREATE TABLE IF NOT EXISTS hourly_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app_name TEXT NOT NULL,
+		date DATE NOT NULL,
+		hour INTEGER NOT NULL,
+		total_seconds INTEGER NOT NULL,
+		source TEXT NOT NULL DEFAULT 'tracker',
+		UNIQUE(app_name, date, hour, source)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_hourly_stats_date ON hourly_stats(date, hour);
+	CREATE INDEX IF NOT EXISTS idx_hourly_stats_app_name_nocase ON hourly_stats(app_name COLLATE NOCASE, date);
+`
+
+// addHourlyStats adds to the hourly totals, merging into existing rows
+const addHourlyStats = `
+	INSERT INTO hourly_stats (app_name, date, hour, total_seconds, source)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(app_name, date, hour, source) DO UPDATE SET
+	total_seconds = total_seconds + excluded.total_seconds
+`
+
+// hourCell is one application's time in one hour of one day of a source
+type hourCell struct {
+	app    string
+	date   string
+	hour   int
+	source string
+}
+
+// splitHours calls fn for every local hour a session covers, with the
+// seconds it spent there. The session is taken to last seconds from its
+// start, which is the time that was actually counted as active, as in
+// stats.HourlyMatrix.
+func splitHours(start time.Time, seconds int64, fn func(date string, hour int, seconds int64)) {
+	cursor := start.In(time.Local)
+	end := cursor.Add(time.Duration(seconds) * time.Second)
+	for cursor.Before(end) {
+		y, m, d := cursor.Date()
+		next := time.Date(y, m, d, cursor.Hour(), 0, 0, 0, time.Local).Add(time.Hour)
+		if next.After(end) {
+			next = end
+		}
+		fn(cursor.Format(DateLayout), cursor.Hour(), int64(next.Sub(cursor).Seconds()))
+		cursor = next
+	}
+}
+
+// addSessionHours adds the hours of a session with stmt, a prepared
+// addHourlyStats
+func addSessionHours(stmt *sql.Stmt, session *Session, source string) error {
+	var err error
+	splitHours(session.StartTime, session.DurationSeconds, func(date string, hour int, seconds int64) {
+		if err == nil {
+			_, err = stmt.Exec(session.AppName, date, hour, seconds, source)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update hourly stats: %w", err)
+	}
+	return nil
+}
+
+// sessionHours sums the hours of the sessions the condition selects, each
+// checkpoint of a session counted once at its longest. Only cells dated
+// from first to last are kept; either may be "" to leave that side open.
+func sessionHours(q querier, where string, args []interface{}, first, last string) (map[hourCell]int64, error) {
+	rows, err := q.Query("SELECT app_name, start_time, "+longestCheckpoint+", source FROM sessions WHERE "+where+" GROUP BY "+checkpointKey, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	cells := make(map[hourCell]int64)
+	for rows.Next() {
+		var appName, source string
+		var start time.Time
+		var seconds int64
+		if err := rows.Scan(&appName, &start, &seconds, &source); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		splitHours(start, seconds, func(date string, hour int, n int64) {
+			if (first == "" || date >= first) && (last == "" || date <= last) {
+				cells[hourCell{appName, date, hour, source}] += n
+			}
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+	return cells, nil
+}
+
+// insertHourCells writes hourly totals into a transaction
+func insertHourCells(tx *sql.Tx, cells map[hourCell]int64) error {
+	stmt, err := tx.Prepare(addHourlyStats)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for cell, seconds := range cells {
+		if _, err := stmt.Exec(cell.app, cell.date, cell.hour, seconds, cell.source); err != nil {
+			return fmt.Errorf("failed to insert hourly stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebuildHourlyStats replaces all hourly statistics with those of the
+// sessions
+func (db *DB) rebuildHourlyStats() error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	cells, err := sessionHours(tx, "1=1", nil, "", "")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM hourly_stats"); err != nil {
+		return fmt.Errorf("failed to delete hourly stats: %w", err)
+	}
+	if err := insertHourCells(tx, cells); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// migrateHourlyStats creates hourly_stats for databases from before it
+// existed and fills it from the sessions
+func migrateHourlyStats(tx *sql.Tx) error {
+	var count int
+	if err := tx.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'hourly_stats'",
+	).Scan(&count); err != nil {
+		return fmt.Errorf("failed to inspect tables: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	// The sessions are read to the end before the first write, as the
+	// transaction has a single connection
+	cells, err := sessionHours(tx, "1=1", nil, "", "")
+	if err != nil {
+		return fmt.Errorf("failed to backfill hourly stats: %w", err)
+	}
+
+	if _, err := tx.Exec(hourlyStatsTable); err != nil {
+		return fmt.Errorf("failed to create hourly_stats: %w", err)
+	}
+	if err := insertHourCells(tx, cells); err != nil {
+		return fmt.Errorf("failed to backfill hourly stats: %w", err)
+	}
+	return nil
+}
+
+// GetHourlyStats returns the time per application and local hour of the
+// days in the query range, one row per application, day and hour with time,
+// ordered by date, hour and application. AppName and Source filter the rows
+// as for GetDailyStats; the ordering and limits of StatsQuery are not used.
+// A database from before hourly statistics were kept, opened read-only, is
+// answered from its sessions.
+func (db *DB) GetHourlyStats(query *StatsQuery) ([]*HourlyStats, error) {
+	var exists bool
+	if err := db.reader().QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'hourly_stats')",
+	).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to inspect tables: %w", err)
+	}
+	if !exists {
+		return db.hourlyStatsFromSessions(query)
+	}
+
+	sqlQuery := `
+	SELECT MIN(app_name), date, hour, SUM(total_seconds)
+	FROM hourly_stats
+	WHERE 1=1
+	`
+	args := []interface{}{}
+	if !query.StartDate.IsZero() {
+		sqlQuery += " AND date >= ?"
+		args = append(args, query.StartDate.Format(DateLayout))
+	}
+	if !query.EndDate.IsZero() {
+		sqlQuery += " AND date <= ?"
+		args = append(args, query.EndDate.Format(DateLayout))
+	}
+	if query.AppName != "" {
+		sqlQuery += " AND app_name = ? COLLATE NOCASE"
+		args = append(args, query.AppName)
+	}
+	if query.Source != "" {
+		sqlQuery += " AND source = ?"
+		args = append(args, query.Source)
+	}
+	sqlQuery += `
+	GROUP BY app_name COLLATE NOCASE, date, hour
+	ORDER BY date, hour, MIN(app_name) COLLATE NOCASE, MIN(app_name)
+	`
+
+	rows, err := db.reader().Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hourly stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*HourlyStats
+	for rows.Next() {
+		var stat HourlyStats
+		if err := rows.Scan(&stat.AppName, &stat.Date, &stat.Hour, &stat.TotalSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		stat.Source = query.Source
+		stats = append(stats, &stat)
+	}
+	return stats, rows.Err()
+}
+
+// hourlyStatsFromSessions is GetHourlyStats for a database without
+// hourly_stats. Sessions from the day before the range are read too, as
+// they may run into it.
+func (db *DB) hourlyStatsFromSessions(query *StatsQuery) ([]*HourlyStats, error) {
+	where := "1=1"
+	var args []interface{}
+	var first, last string
+	if !query.StartDate.IsZero() {
+		where += " AND start_time >= ?"
+		args = append(args, dayStart(query.StartDate).AddDate(0, 0, -1))
+		first = query.StartDate.Format(DateLayout)
+	}
+	if !query.EndDate.IsZero() {
+		where += " AND start_time < ?"
+		args = append(args, dayStart(query.EndDate).AddDate(0, 0, 1))
+		last = query.EndDate.Format(DateLayout)
+	}
+	if query.AppName != "" {
+		where += " AND app_name = ? COLLATE NOCASE"
+		args = append(args, query.AppName)
+	}
+	if query.Source != "" {
+		where += " AND source = ?"
+		args = append(args, query.Source)
+	}
+	cells, err := sessionHours(db.reader(), where, args, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sources are added up and spellings differing in case are one
+	// application, reported under the first spelling in sort order
+	type key struct {
+		app  string
+		date string
+		hour int
+	}
+	merged := make(map[key]*HourlyStats)
+	for cell, seconds := range cells {
+		k := key{strings.ToLower(cell.app), cell.date, cell.hour}
+		stat, ok := merged[k]
+		if !ok {
+			date, _ := time.Parse(DateLayout, cell.date)
+			stat = &HourlyStats{AppName: cell.app, Date: date, Hour: cell.hour, Source: query.Source}
+			merged[k] = stat
+		}
+		if cell.app < stat.AppName {
+			stat.AppName = cell.app
+		}
+		stat.TotalSeconds += seconds
+	}
+
+	stats := make([]*HourlyStats, 0, len(merged))
+	for _, stat := range merged {
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Hour != b.Hour {
+			return a.Hour < b.Hour
+		}
+		return strings.ToLower(a.AppName) < strings.ToLower(b.AppName)
+	})
+	return stats, nil
+}
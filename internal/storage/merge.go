@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mergeColumns are the session columns copied by MergeFrom that databases
+// from older versions may lack; they read as empty there
+var mergeColumns = []string{"raw_title", "domain", "exe_path", "monitor_index", "workspace", "category"}
+
+// MergeDevice returns the device name MergeFrom uses for the database at
+// path when none is given: the file name without its extension
+func MergeDevice(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// MergeFrom copies the sessions another actime database recorded itself,
+// those of its tracker and manual entries, into source merge:<device>. The
+// other database is attached read-only and may come from an older version.
+// Its imported and merged sessions are left out, as they came from
+// elsewhere and may already be here.
+//
+// A session is identified by its app, window title and start, as in the
+// import key, so merging the same file again adds nothing. The checkpoints
+// the tracker wrote for one session count as that session at its longest.
+// When a session was merged before with another duration, the longer one is
+// kept and the pair is reported in Conflicts. The daily and hourly
+// statistics of the source are rebuilt for the dates that changed in the
+// same transaction.
+func (db *DB) MergeFrom(path, device string) (*MergeResult, error) {
+	if device == "" {
+		device = MergeDevice(path)
+	}
+	source := MergeSource(device)
+	if err := ValidateSource(source); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat database: %w", err)
+	}
+	if self, err := os.Stat(db.path); err == nil && os.SameFile(info, self) {
+		return nil, fmt.Errorf("cannot merge a database into itself")
+	}
+
+	return db.mergeSessions(path, source)
+}
+
+// mergeSessions writes the sessions of the database at path to source and
+// rebuilds the statistics of the dates that changed in one transaction. It
+// holds the writer connection until it returns: ATTACH applies to one
+// connection, so the whole merge runs on the same one.
+func (db *DB) mergeSessions(path, source string) (*MergeResult, error) {
+	ctx := context.Background()
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS merged", "file:"+filepath.ToSlash(path)+"?mode=ro"); err != nil {
+		return nil, fmt.Errorf("failed to attach database: %w", err)
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE merged")
+
+	sessions, err := readMergedSessions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	find, err := tx.Prepare(`
+	SELECT id, duration_seconds FROM sessions
+	WHERE source = ? AND app_name = ? AND COALESCE(window_title, '') = ? AND start_time = ?
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer find.Close()
+
+	insert, err := tx.Prepare(`
+	INSERT INTO sessions (app_name, window_title, raw_title, domain, exe_path, monitor_index, workspace, start_time, end_time, duration_seconds, source, category)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer insert.Close()
+
+	result := &MergeResult{Source: source}
+	var first, last time.Time
+	changed := func(start time.Time) {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+	for _, session := range sessions {
+		var id, existing int64
+		err := find.QueryRow(source, session.AppName, session.WindowTitle, session.StartTime).Scan(&id, &existing)
+		switch {
+		case err == sql.ErrNoRows:
+			if _, err := insert.Exec(
+				session.AppName,
+				session.WindowTitle,
+				nullString(session.RawTitle),
+				nullString(session.Domain),
+				nullString(session.ExePath),
+				session.MonitorIndex,
+				session.Workspace,
+				session.StartTime,
+				session.EndTime,
+				session.DurationSeconds,
+				source,
+				nullString(session.Category),
+			); err != nil {
+				return nil, fmt.Errorf("failed to insert session: %w", err)
+			}
+			result.Added++
+			changed(session.StartTime)
+		case err != nil:
+			return nil, fmt.Errorf("failed to look up session: %w", err)
+		case existing == session.DurationSeconds:
+			result.Skipped++
+		default:
+			result.Conflicts = append(result.Conflicts, &MergeConflict{
+				AppName:     session.AppName,
+				WindowTitle: session.WindowTitle,
+				StartTime:   session.StartTime,
+				Existing:    existing,
+				Incoming:    session.DurationSeconds,
+			})
+			if session.DurationSeconds > existing {
+				if _, err := tx.Exec("UPDATE sessions SET end_time = ?, duration_seconds = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+					session.EndTime, session.DurationSeconds, id); err != nil {
+					return nil, fmt.Errorf("failed to update session: %w", err)
+				}
+				changed(session.StartTime)
+			}
+		}
+	}
+
+	if !first.IsZero() {
+		// The day after the last one takes the hours of sessions running
+		// past midnight
+		query := &StatsQuery{Source: source, StartDate: first, EndDate: last.AddDate(0, 0, 1)}
+		rebuild, err := readStatsRebuild(tx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to recompute daily stats: %w", err)
+		}
+		if err := rebuild.apply(tx, nil); err != nil {
+			return nil, fmt.Errorf("failed to recompute daily stats: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// mergeKey identifies a session across databases, as the import key does
+type mergeKey struct {
+	app, title string
+	start      int64
+}
+
+// readMergedSessions reads the tracker and manual sessions of the attached
+// database, one per session
+func readMergedSessions(ctx context.Context, conn *sql.Conn) ([]*Session, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT name FROM pragma_table_info('sessions', 'merged')")
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect database: %w", err)
+	}
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		columns[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to inspect database: %w", err)
+	}
+	if !columns["app_name"] {
+		return nil, fmt.Errorf("not an actime database: no sessions table")
+	}
+
+	selected := make([]string, len(mergeColumns))
+	for i, column := range mergeColumns {
+		selected[i] = "NULL"
+		if columns[column] {
+			selected[i] = column
+		}
+	}
+	where := ""
+	if columns["source"] {
+		where = fmt.Sprintf("WHERE source IN ('%s', '%s')", SourceTracker, SourceManual)
+	}
+
+	rows, err = conn.QueryContext(ctx, fmt.Sprintf(`
+	SELECT app_name, COALESCE(window_title, ''), COALESCE(%s, ''), COALESCE(%s, ''), COALESCE(%s, ''), %s, %s, start_time, end_time, duration_seconds, COALESCE(%s, '')
+	FROM merged.sessions %s
+	ORDER BY start_time, id
+	`, selected[0], selected[1], selected[2], selected[3], selected[4], selected[5], where))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	// The tracker writes a growing checkpoint of a session on every flush;
+	// the longest one stands for the session
+	var sessions []*Session
+	longest := make(map[mergeKey]*Session)
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(
+			&session.AppName,
+			&session.WindowTitle,
+			&session.RawTitle,
+			&session.Domain,
+			&session.ExePath,
+			&session.MonitorIndex,
+			&session.Workspace,
+			&session.StartTime,
+			&session.EndTime,
+			&session.DurationSeconds,
+			&session.Category,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		key := mergeKey{session.AppName, session.WindowTitle, session.StartTime.UnixNano()}
+		if kept, ok := longest[key]; ok {
+			if session.DurationSeconds > kept.DurationSeconds {
+				*kept = session
+			}
+			continue
+		}
+		longest[key] = &session
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import "fmt"
+
+// SchemaVersion is stored in the database's user_version once initSchema
+// has brought it up to date. It is the version of the last of migrations.
+// Databases last opened by a build from before it was recorded read 0.
+const SchemaVersion = 6
+
+// capability is a feature of the schema and how to tell it is there
+type capability struct {
+	name   string
+	table  string
+	column string // the table is enough when empty
+}
+
+// capabilities are checked against the schema itself, so they stay true
+// whichever migrations a database has been through
+var capabilities = []capability{
+	{name: "sources", table: "daily_stats", column: "source"},
+	{name: "raw_titles", table: "sessions", column: "raw_title"},
+	{name: "gaps", table: "gaps"},
+	{name: "maintenance_log", table: "maintenance_log"},
+	{name: "updated_at", table: "sessions", column: "updated_at"},
+	{name: "domains", table: "sessions", column: "domain"},
+	{name: "exe_paths", table: "sessions", column: "exe_path"},
+	{name: "monitors", table: "sessions", column: "monitor_index"},
+	{name: "hourly_stats", table: "hourly_stats"},
+	{name: "categories", table: "sessions", column: "category"},
+}
+
+// Meta describes the schema of a database
+type Meta struct {
+	SchemaVersion int
+	Capabilities  []string
+}
+
+// Meta reads the schema version and lists the capabilities the schema has
+func (db *DB) Meta() (*Meta, error) {
+	meta := &Meta{Capabilities: []string{}}
+	if err := db.reader().QueryRow("PRAGMA user_version").Scan(&meta.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, c := range capabilities {
+		var found bool
+		var err error
+		if c.column == "" {
+			found, err = db.hasTable(c.table)
+		} else {
+			found, err = db.hasColumn(c.table, c.column)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			meta.Capabilities = append(meta.Capabilities, c.name)
+		}
+	}
+	return meta, nil
+}
+
+// hasTable reports whether a table exists
+func (db *DB) hasTable(table string) (bool, error) {
+	var count int
+	if err := db.reader().QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/weii/actime/pkg/logger"
+)
+
+// schemaVersionTable creates schema_version, the history of the migrations
+// applied to a database. The current version is PRAGMA user_version, which
+// each migration sets in the same transaction.
+const schemaVersionTable = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+// migration brings the schema from the previous version to version
+type migration struct {
+	version int
+	name    string
+	apply   func(tx *sql.Tx) error
+}
+
+// migrations are applied in order to databases whose user_version is lower
+// than theirs, each in its own transaction. New databases start at 0 with
+// the latest tables, and databases last opened before versions were
+// recorded also read 0 whatever their shape, so every step checks what is
+// already there. Append new steps and raise SchemaVersion with them.
+var migrations = []migration{
+	{1, "sources, raw titles and updated_at", migrateBaseline},
+	{2, "session domains", func(tx *sql.Tx) error {
+		return addColumn(tx, "sessions", "domain", "TEXT")
+	}},
+	{3, "executable paths", func(tx *sql.Tx) error {
+		return addColumn(tx, "sessions", "exe_path", "TEXT")
+	}},
+	{4, "monitors and workspaces", func(tx *sql.Tx) error {
+		if err := addColumn(tx, "sessions", "monitor_index", "INTEGER"); err != nil {
+			return err
+		}
+		return addColumn(tx, "sessions", "workspace", "INTEGER")
+	}},
+	{5, "hourly statistics", migrateHourlyStats},
+	{6, "session categories", func(tx *sql.Tx) error {
+		return addColumn(tx, "sessions", "category", "TEXT")
+	}},
+}
+
+// migrateBaseline brings a database from before versions were recorded to
+// the first recorded schema
+func migrateBaseline(tx *sql.Tx) error {
+	if err := addColumn(tx, "sessions", "raw_title", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "sessions", "source", "TEXT NOT NULL DEFAULT 'tracker'"); err != nil {
+		return err
+	}
+	if err := migrateDailyStatsSource(tx); err != nil {
+		return err
+	}
+	if err := migrateSourceNames(tx); err != nil {
+		return err
+	}
+	return migrateUpdatedAt(tx)
+}
+
+// migrate applies the migrations the database has not been through. A
+// database from a newer build keeps its version.
+func (db *DB) migrate() error {
+	var current int
+	if err := db.conn.QueryRow("PRAGMA user_version").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := db.applyMigration(m); err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d (%s): %w", m.version, m.name, err)
+		}
+		logger.GetLogger().Info("Migrated database schema", "version", m.version, "migration", m.name)
+	}
+	return nil
+}
+
+// applyMigration runs one migration and records it, all or nothing
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO schema_version (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+		return fmt.Errorf("failed to set schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
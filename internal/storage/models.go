@@ -1,16 +1,86 @@
 package storage
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout used for the daily_stats.date column
+const DateLayout = "2006-01-02"
+
+// Sources of sessions and daily statistics. Imported and merged rows carry
+// the prefix followed by the tool or device they came from.
+const (
+	SourceTracker      = "tracker"
+	SourceManual       = "manual"
+	SourceImportPrefix = "import:"
+	SourceMergePrefix  = "merge:"
+)
+
+// ImportSource returns the source of rows imported from tool
+func ImportSource(tool string) string {
+	return SourceImportPrefix + tool
+}
+
+// MergeSource returns the source of rows merged from device
+func MergeSource(device string) string {
+	return SourceMergePrefix + device
+}
+
+// ValidateSource checks that source is one of the known forms
+func ValidateSource(source string) error {
+	switch {
+	case source == SourceTracker, source == SourceManual:
+		return nil
+	case strings.HasPrefix(source, SourceImportPrefix) && len(source) > len(SourceImportPrefix):
+		return nil
+	case strings.HasPrefix(source, SourceMergePrefix) && len(source) > len(SourceMergePrefix):
+		return nil
+	}
+	return fmt.Errorf("invalid source: %q (expected %s, %s, %s<name> or %s<device>)",
+		source, SourceTracker, SourceManual, SourceImportPrefix, SourceMergePrefix)
+}
+
+// IsTracked reports whether a row comes from the tracker. Sessions not yet
+// written have no source.
+func IsTracked(source string) bool {
+	return source == SourceTracker || source == ""
+}
 
 // Session represents a usage session in the database
 type Session struct {
 	ID              int64     `db:"id"`
 	AppName         string    `db:"app_name"`
 	WindowTitle     string    `db:"window_title"`
+	RawTitle        string    `db:"raw_title"`
+	Domain          string    `db:"domain"`
+	ExePath         string    `db:"exe_path"`
+	MonitorIndex    *int      `db:"monitor_index"` // nil when unknown
+	Workspace       *int      `db:"workspace"`     // nil when unknown
 	StartTime       time.Time `db:"start_time"`
 	EndTime         time.Time `db:"end_time"`
 	DurationSeconds int64     `db:"duration_seconds"`
+	Source          string    `db:"source"`
+	Category        string    `db:"category"` // set by imports that have one
 	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+}
+
+// Gap kinds recorded by the tracker
+const (
+	GapLocked    = "locked"
+	GapIdle      = "idle"
+	GapSuspended = "suspended"
+)
+
+// Gap is a period the tracker paused because the screen was locked or the
+// user was idle
+type Gap struct {
+	ID        int64     `db:"id"`
+	Kind      string    `db:"kind"`
+	StartTime time.Time `db:"start_time"`
+	EndTime   time.Time `db:"end_time"`
 }
 
 // DailyStats represents daily usage statistics in the database
@@ -19,14 +89,105 @@ type DailyStats struct {
 	AppName      string    `db:"app_name"`
 	Date         time.Time `db:"date"`
 	TotalSeconds int64     `db:"total_seconds"`
+	Source       string    `db:"source"`
+}
+
+// AppTotal is the time spent in one application over a range
+type AppTotal struct {
+	AppName      string `db:"app_name"`
+	TotalSeconds int64  `db:"total_seconds"`
+}
+
+// TitleStats is the time an application spent under one window title
+type TitleStats struct {
+	WindowTitle  string `db:"window_title"`
+	TotalSeconds int64  `db:"total_seconds"`
+}
+
+// HourlyStats is the time of an application in one local hour of a day
+type HourlyStats struct {
+	AppName      string    `db:"app_name"`
+	Date         time.Time `db:"date"`
+	Hour         int       `db:"hour"`
+	TotalSeconds int64     `db:"total_seconds"`
+	Source       string    `db:"source"`
 }
 
+// Orders of daily statistics for StatsQuery.OrderBy
+const (
+	OrderByDate  = "date"
+	OrderByTotal = "total"
+)
+
+// Directions for StatsQuery.Direction
+const (
+	Ascending  = "asc"
+	Descending = "desc"
+)
+
 // StatsQuery represents parameters for querying statistics
 type StatsQuery struct {
 	AppName string
 	StartDate time.Time
 	EndDate time.Time
+	// OrderBy sorts daily statistics by OrderByDate, the default, or by
+	// OrderByTotal. Sessions are always ordered by start time.
+	OrderBy string
+	// Direction of OrderBy, Descending by default
+	Direction string
+	// Source keeps only rows from this source
+	Source string
+	// Limit caps the number of rows returned, after ordering. For daily
+	// statistics these are app-day rows, so use TopApps for the top
+	// applications. GetTopApps returns one row per application.
 	Limit int
+	// TopApps keeps only the daily statistics of the TopApps applications
+	// with the most time over the whole range, still one row per app and day
+	TopApps int
+}
+
+// ImportResult counts the rows written by Import
+type ImportResult struct {
+	Sessions        int64
+	SkippedSessions int64
+	DailyStats      int64
+}
+
+// MergeResult counts the sessions written by MergeFrom
+type MergeResult struct {
+	// Source the merged sessions were written to
+	Source string
+	Added  int64
+	// Skipped sessions were already merged with the same duration
+	Skipped int64
+	// Conflicts were already merged with another duration; the longer one
+	// is kept
+	Conflicts []*MergeConflict
+}
+
+// MergeConflict is a merged session whose duration differs from the one
+// merged before
+type MergeConflict struct {
+	AppName     string
+	WindowTitle string
+	StartTime   time.Time
+	Existing    int64
+	Incoming    int64
+}
+
+// AppTitle is a distinct application and window title pair
+type AppTitle struct {
+	AppName     string
+	WindowTitle string
+}
+
+// MaintenanceRecord is an entry of the maintenance log
+type MaintenanceRecord struct {
+	ID           int64
+	Action       string
+	Details      string
+	RowsAffected int64
+	PerformedAt  time.Time
 }
 
 // ExportData represents data for export
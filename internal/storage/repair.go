@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// OverlongSessions returns the sessions longer than max, oldest first
+func (db *DB) OverlongSessions(max time.Duration) ([]*Session, error) {
+	rows, err := db.reader().Query(`
+	SELECT id, app_name, COALESCE(window_title, ''), start_time, end_time, duration_seconds, source
+	FROM sessions
+	WHERE duration_seconds > ?
+	ORDER BY start_time ASC, id ASC
+	`, int64(max/time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.AppName,
+			&session.WindowTitle,
+			&session.StartTime,
+			&session.EndTime,
+			&session.DurationSeconds,
+			&session.Source,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// SplitSession cuts a session into back-to-back pieces of at most max
+func SplitSession(session *Session, max time.Duration) []*Session {
+	maxSeconds := int64(max / time.Second)
+	if maxSeconds <= 0 || session.DurationSeconds <= maxSeconds {
+		return []*Session{session}
+	}
+
+	var pieces []*Session
+	start := session.StartTime
+	for left := session.DurationSeconds; left > 0; left -= maxSeconds {
+		seconds := left
+		if seconds > maxSeconds {
+			seconds = maxSeconds
+		}
+		piece := *session
+		piece.ID = 0
+		piece.StartTime = start
+		piece.EndTime = start.Add(time.Duration(seconds) * time.Second)
+		piece.DurationSeconds = seconds
+		pieces = append(pieces, &piece)
+		start = piece.EndTime
+	}
+	return pieces
+}
+
+// TruncateSession returns the session cut down to at most max
+func TruncateSession(session *Session, max time.Duration) *Session {
+	return SplitSession(session, max)[0]
+}
+
+// ReplaceSession replaces the session with the given ID by pieces, which
+// keep its title, raw title, domain, executable, monitor, workspace and
+// source. Daily statistics are not updated; recompute the affected days
+// afterwards.
+func (db *DB) ReplaceSession(id int64, pieces []*Session) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, piece := range pieces {
+		if _, err := tx.Exec(`
+		INSERT INTO sessions (app_name, window_title, raw_title, domain, exe_path, monitor_index, workspace, start_time, end_time, duration_seconds, source, category)
+		SELECT app_name, window_title, raw_title, domain, exe_path, monitor_index, workspace, ?, ?, ?, source, category FROM sessions WHERE id = ?
+		`, piece.StartTime, piece.EndTime, piece.DurationSeconds, id); err != nil {
+			return fmt.Errorf("failed to insert session piece: %w", err)
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM sessions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	} else if deleted == 0 {
+		return fmt.Errorf("session %d not found", id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package storage
+
+import "fmt"
+
+// Rows runs a query, such as one built by the query package, on the read
+// pool and returns its rows as the driver scans them. The pool is
+// query_only, so a statement that writes fails.
+func (db *DB) Rows(statement string, args ...interface{}) ([][]interface{}, error) {
+	rows, err := db.reader().Query(statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+
+	var result [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrCorrupt is returned when the database file is damaged
+var ErrCorrupt = errors.New("database is corrupted")
+
+// salvageBatch is the number of rows read per query while salvaging. A
+// batch that fails is retried row by row.
+const salvageBatch = 500
+
+// salvageTables are the tables Salvage copies, in order
+var salvageTables = []string{"sessions", "daily_stats", "gaps"}
+
+// SalvageResult counts the rows Salvage recovered per table and the rows it
+// could not read
+type SalvageResult struct {
+	Sessions   int64
+	DailyStats int64
+	Gaps       int64
+	Unreadable int64
+}
+
+// Recovery describes how OpenOrRecover replaced a corrupted database
+type Recovery struct {
+	// CorruptPath is where the damaged file was moved
+	CorruptPath string
+	// Salvage is what was recovered into the new file, nil if salvaging
+	// failed with SalvageErr
+	Salvage    *SalvageResult
+	SalvageErr error
+}
+
+// IsCorrupt reports whether err comes from a damaged database file
+func IsCorrupt(err error) bool {
+	if errors.Is(err, ErrCorrupt) {
+		return true
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+			return true
+		}
+	}
+	return false
+}
+
+// checkIntegrity runs SQLite's quick integrity check, which verifies the
+// structure of every page but skips comparing indexes with their tables
+func checkIntegrity(conn *sql.DB) error {
+	rows, err := conn.Query("PRAGMA quick_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrCorrupt, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CheckIntegrity runs SQLite's quick integrity check over the database and
+// reports a damaged file as ErrCorrupt. It reads every page, so it is left
+// to the daemon's OpenOrRecover and `actime db check` rather than run on
+// every open.
+func (db *DB) CheckIntegrity() error {
+	if err := checkIntegrity(db.conn.DB); err != nil {
+		if IsCorrupt(err) {
+			return fmt.Errorf("%w: %s: %v", ErrCorrupt, db.path, err)
+		}
+		return fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	return nil
+}
+
+// corruptError marks an error of a damaged database file as ErrCorrupt,
+// keeping the SQLite error it wraps
+func corruptError(err error) error {
+	if err == nil || errors.Is(err, ErrCorrupt) || !IsCorrupt(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrCorrupt, err)
+}
+
+// OpenOrRecover opens the database like NewDBWithOptions and checks its
+// integrity, as a file damaged by a power loss may still open. A corrupted
+// file is moved aside to <path>.corrupt-<timestamp>, the rows that can still be
+// read are salvaged into a new file at path, and the new file is opened.
+// The returned Recovery is nil when the database was healthy.
+func OpenOrRecover(path string, opts Options) (*DB, *Recovery, error) {
+	db, err := NewDBWithOptions(path, opts)
+	if err == nil {
+		if err = db.CheckIntegrity(); err != nil {
+			db.Close()
+			db = nil
+		}
+	}
+	if err == nil || !errors.Is(err, ErrCorrupt) {
+		return db, nil, err
+	}
+
+	recovery := &Recovery{
+		CorruptPath: fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405")),
+	}
+
+	// The WAL and shared memory files belong to the damaged database
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, recovery.CorruptPath+suffix); err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to move corrupted database aside: %w", err)
+		}
+	}
+
+	recovery.Salvage, recovery.SalvageErr = Salvage(recovery.CorruptPath, path)
+	if recovery.SalvageErr != nil {
+		// Start from an empty database rather than a half-written one
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(path + suffix)
+		}
+	}
+
+	db, err = NewDBWithOptions(path, opts)
+	if err != nil {
+		return nil, recovery, err
+	}
+	return db, recovery, nil
+}
+
+// Salvage copies every row that can still be read from the damaged
+// database at src into a new database at dst. Rows are read in id ranges;
+// a range that fails is read row by row, so one damaged page loses only the
+// rows stored on it. dst must not exist.
+func Salvage(src, dst string) (*SalvageResult, error) {
+	if _, err := os.Stat(src); err != nil {
+		return nil, fmt.Errorf("failed to open damaged database: %w", err)
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return nil, fmt.Errorf("salvage target already exists: %s", dst)
+	}
+
+	// writable_schema lets SQLite open a file shorter than its header says,
+	// which it otherwise refuses as corrupt; query_only keeps it unchanged
+	from, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=writable_schema(1)&_pragma=query_only(1)", filepath.ToSlash(src)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open damaged database: %w", err)
+	}
+	defer from.Close()
+	from.SetMaxOpenConns(1)
+
+	to, err := NewDB(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create salvage database: %w", err)
+	}
+	defer to.Close()
+
+	result := &SalvageResult{}
+	counts := map[string]*int64{
+		"sessions":    &result.Sessions,
+		"daily_stats": &result.DailyStats,
+		"gaps":        &result.Gaps,
+	}
+
+	for _, table := range salvageTables {
+		columns, err := salvageColumns(from, to, table)
+		if err != nil || len(columns) == 0 {
+			// The table or its schema cannot be read
+			continue
+		}
+
+		copied, unreadable, err := salvageRows(from, to, table, columns)
+		if err != nil {
+			return nil, err
+		}
+		*counts[table] = copied
+		result.Unreadable += unreadable
+	}
+
+	// Hourly statistics are derived from the sessions, which may be all
+	// that could be read
+	if err := to.rebuildHourlyStats(); err != nil {
+		return nil, fmt.Errorf("failed to rebuild hourly stats: %w", err)
+	}
+
+	return result, nil
+}
+
+// tableColumn is a column copied by Salvage
+type tableColumn struct {
+	name string
+	// date is set for DATE and DATETIME columns
+	date    bool
+	notNull bool
+}
+
+// salvageColumns returns the columns of table that both databases have, so
+// a file written by an older version is salvaged too. The constraints are
+// those of the new database, which the rows must satisfy.
+func salvageColumns(from *sql.DB, to *DB, table string) ([]tableColumn, error) {
+	fromColumns, err := tableColumns(from, table)
+	if err != nil {
+		return nil, err
+	}
+	toColumns, err := tableColumns(to.conn.DB, table)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]tableColumn, len(toColumns))
+	for _, column := range toColumns {
+		known[column.name] = column
+	}
+
+	var columns []tableColumn
+	for _, column := range fromColumns {
+		if column, ok := known[column.name]; ok {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// tableColumns lists the columns of table
+func tableColumns(conn *sql.DB, table string) ([]tableColumn, error) {
+	rows, err := conn.Query(`SELECT name, type, "notnull" FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []tableColumn
+	for rows.Next() {
+		var column tableColumn
+		var declType string
+		if err := rows.Scan(&column.name, &declType, &column.notNull); err != nil {
+			return nil, err
+		}
+		column.date = strings.HasPrefix(strings.ToUpper(declType), "DATE")
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// salvageRows copies the readable rows of table and counts the ids that
+// could not be read
+func salvageRows(from *sql.DB, to *DB, table string, columns []tableColumn) (copied, unreadable int64, err error) {
+	// The largest id bounds the scan. Its page may be the damaged one, so
+	// the AUTOINCREMENT counter is the fallback.
+	var maxID sql.NullInt64
+	if err := from.QueryRow("SELECT MAX(id) FROM " + table).Scan(&maxID); err != nil {
+		if err := from.QueryRow("SELECT seq FROM sqlite_sequence WHERE name = ?", table).Scan(&maxID); err != nil {
+			return 0, 0, nil
+		}
+	}
+	if !maxID.Valid {
+		return 0, 0, nil
+	}
+
+	// The unary plus hides the declared column type, so values are copied
+	// exactly as stored instead of being converted to time.Time. Date
+	// columns are selected a second time with their type to validate them.
+	var names, selected []string
+	for _, column := range columns {
+		names = append(names, column.name)
+		selected = append(selected, "+"+column.name)
+	}
+	for _, column := range columns {
+		if column.date {
+			selected = append(selected, column.name)
+		}
+	}
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s WHERE id >= ? AND id < ? ORDER BY id",
+		strings.Join(selected, ", "), table)
+	insertSQL := fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)",
+		table, strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "))
+
+	for low := int64(1); low <= maxID.Int64; low += salvageBatch {
+		rows, err := readRows(from, selectSQL, len(selected), low, low+salvageBatch)
+		if err != nil {
+			rows = nil
+			for id := low; id < low+salvageBatch && id <= maxID.Int64; id++ {
+				row, err := readRows(from, selectSQL, len(selected), id, id+1)
+				if err != nil {
+					unreadable++
+					continue
+				}
+				rows = append(rows, row...)
+			}
+		}
+
+		// Cells near a damaged page can read back as garbage
+		valid := rows[:0]
+		for _, row := range rows {
+			if validRow(columns, row) {
+				valid = append(valid, row[:len(columns)])
+			} else {
+				unreadable++
+			}
+		}
+
+		if len(valid) == 0 {
+			continue
+		}
+		if err := insertRows(to, insertSQL, valid); err != nil {
+			return 0, 0, fmt.Errorf("failed to write salvaged %s: %w", table, err)
+		}
+		copied += int64(len(valid))
+	}
+
+	return copied, unreadable, nil
+}
+
+// validRow checks a row read by salvageRows: NOT NULL columns have a value
+// and date columns hold a date the driver can read
+func validRow(columns []tableColumn, row []interface{}) bool {
+	typed := len(columns)
+	for i, column := range columns {
+		if column.notNull && row[i] == nil {
+			return false
+		}
+		if !column.date {
+			continue
+		}
+		if _, ok := row[typed].(time.Time); !ok && row[typed] != nil {
+			return false
+		}
+		typed++
+	}
+	return true
+}
+
+// readRows runs query for the id range and reads all rows, so an error
+// halfway through fails the whole range
+func readRows(conn *sql.DB, query string, columns int, low, high int64) ([][]interface{}, error) {
+	rows, err := conn.Query(query, low, high)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, columns)
+		pointers := make([]interface{}, columns)
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		result = append(result, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// insertRows writes salvaged rows in one transaction
+func insertRows(to *DB, query string, rows [][]interface{}) error {
+	tx, err := to.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// DefaultTitleBatch is how many sessions UpdateTitles changes per
+// transaction
+const DefaultTitleBatch = 500
+
+// UpdateTitles writes the WindowTitle and RawTitle of sessions, found by
+// ID, in transactions of batchSize rows, so a long rewrite does not hold
+// the write lock against the daemon. An empty RawTitle is stored as NULL.
+// It returns the number of sessions changed; batches committed before an
+// error stay written.
+func (db *DB) UpdateTitles(sessions []*Session, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultTitleBatch
+	}
+
+	var updated int64
+	for start := 0; start < len(sessions); start += batchSize {
+		end := start + batchSize
+		if end > len(sessions) {
+			end = len(sessions)
+		}
+
+		n, err := db.updateTitleBatch(sessions[start:end])
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+	}
+	return updated, nil
+}
+
+// updateTitleBatch writes the titles of one batch in a transaction
+func (db *DB) updateTitleBatch(sessions []*Session) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE sessions SET window_title = ?, raw_title = NULLIF(?, '') WHERE id = ?")
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	var updated int64
+	for _, session := range sessions {
+		result, err := stmt.Exec(session.WindowTitle, session.RawTitle, session.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update session %d: %w", session.ID, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		updated += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+// LogMaintenance records a maintenance action that rewrote stored data
+func (db *DB) LogMaintenance(action, details string, rowsAffected int64) error {
+	if _, err := db.conn.Exec(
+		"INSERT INTO maintenance_log (action, details, rows_affected) VALUES (?, ?, ?)",
+		action, details, rowsAffected); err != nil {
+		return fmt.Errorf("failed to write maintenance log: %w", err)
+	}
+	return nil
+}
+
+// GetMaintenanceLog returns the maintenance log, oldest first
+func (db *DB) GetMaintenanceLog() ([]*MaintenanceRecord, error) {
+	rows, err := db.reader().Query(`
+	SELECT id, action, details, rows_affected, performed_at
+	FROM maintenance_log
+	ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance log: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*MaintenanceRecord
+	for rows.Next() {
+		var record MaintenanceRecord
+		if err := rows.Scan(&record.ID, &record.Action, &record.Details, &record.RowsAffected, &record.PerformedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/weii/actime/pkg/logger"
+)
+
+// DefaultSlowQuery is the default duration above which a statement is
+// reported as slow
+const DefaultSlowQuery = 200 * time.Millisecond
+
+// SlowQueryFunc receives statements that took longer than the slow-query
+// threshold. The statement is its SQL with whitespace collapsed and without
+// arguments.
+type SlowQueryFunc func(statement string, took time.Duration)
+
+// slowQueries decides which statements are reported as slow. The writer and
+// reader handles of a DB share one.
+type slowQueries struct {
+	threshold time.Duration
+	report    SlowQueryFunc
+	since     func(time.Time) time.Duration
+}
+
+// newSlowQueries reports statements slower than threshold at debug level
+func newSlowQueries(threshold time.Duration) *slowQueries {
+	return &slowQueries{
+		threshold: threshold,
+		report:    logSlowQuery,
+		since:     time.Since,
+	}
+}
+
+// logSlowQuery is the default SlowQueryFunc
+func logSlowQuery(statement string, took time.Duration) {
+	logger.GetLogger().Debug("Slow query", "statement", statement, "duration_ms", took.Milliseconds())
+}
+
+// observe reports query if it ran longer than the threshold
+func (s *slowQueries) observe(query string, start time.Time) {
+	if s.threshold <= 0 {
+		return
+	}
+	if took := s.since(start); took >= s.threshold {
+		s.report(strings.Join(strings.Fields(query), " "), took)
+	}
+}
+
+// handle is a connection pool whose statements are timed. Statements run
+// in transactions are not.
+type handle struct {
+	*sql.DB
+	slow *slowQueries
+	// retries is how many more times Query and QueryRow are tried when the
+	// database is busy; writes are never retried
+	retries int
+}
+
+// Query runs a query that returns rows
+func (h *handle) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return h.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext runs a query that returns rows until ctx is done
+func (h *handle) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	var rows *sql.Rows
+	err := retryBusy(ctx, h.retries, func() (err error) {
+		rows, err = h.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	h.slow.observe(query, start)
+	return rows, corruptError(err)
+}
+
+// QueryRow runs a query that returns at most one row
+func (h *handle) QueryRow(query string, args ...interface{}) *sql.Row {
+	return h.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext runs a query that returns at most one row until ctx is
+// done
+func (h *handle) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	var row *sql.Row
+	retryBusy(ctx, h.retries, func() error {
+		row = h.DB.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	h.slow.observe(query, start)
+	return row
+}
+
+// Exec runs a statement that returns no rows
+func (h *handle) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return h.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext runs a statement that returns no rows until ctx is done
+func (h *handle) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := h.DB.ExecContext(ctx, query, args...)
+	h.slow.observe(query, start)
+	return result, corruptError(err)
+}
+
+// SetSlowQuery changes the slow-query threshold and where slow statements
+// are reported; a nil report logs them at debug level and a zero threshold
+// turns the check off. Call it before the DB is shared between goroutines.
+func (db *DB) SetSlowQuery(threshold time.Duration, report SlowQueryFunc) {
+	if report == nil {
+		report = logSlowQuery
+	}
+	db.slow.threshold = threshold
+	db.slow.report = report
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// querier runs read statements, either on the reader pool or inside a
+// snapshot
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// snapshot is a read transaction whose statements are timed like those of
+// a handle
+type snapshot struct {
+	tx   *sql.Tx
+	slow *slowQueries
+}
+
+// Query runs a query that returns rows
+func (s *snapshot) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext runs a query that returns rows until ctx is done
+func (s *snapshot) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := s.tx.QueryContext(ctx, query, args...)
+	s.slow.observe(query, start)
+	return rows, err
+}
+
+// QueryRow runs a query that returns at most one row
+func (s *snapshot) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext runs a query that returns at most one row until ctx is
+// done
+func (s *snapshot) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := s.tx.QueryRowContext(ctx, query, args...)
+	s.slow.observe(query, start)
+	return row
+}
+
+// reader returns where queries run: the snapshot of a view made by
+// Snapshot, otherwise the reader pool
+func (db *DB) reader() querier {
+	if db.snap != nil {
+		return db.snap
+	}
+	return db.read
+}
+
+// Snapshot calls fn with a view of the database in which every query sees
+// the same committed state, even when the daemon flushes in between. Use it
+// when one output is built from several queries, such as sessions and daily
+// totals, that must agree with each other.
+//
+// The view is only valid until fn returns and is meant for reading: writes
+// through it are not part of the snapshot, and it must not be closed.
+func (db *DB) Snapshot(fn func(view *DB) error) error {
+	if db.snap != nil {
+		return fn(db)
+	}
+
+	// A deferred transaction only takes its snapshot at the first read, so
+	// read now to pin the state as of this call
+	var tx *sql.Tx
+	err := retryBusy(context.Background(), db.read.retries, func() error {
+		var err error
+		if tx, err = db.read.Begin(); err != nil {
+			return err
+		}
+		var tables int
+		if err := tx.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&tables); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	view := *db
+	view.snap = &snapshot{tx: tx, slow: db.slow}
+	return fn(&view)
+}
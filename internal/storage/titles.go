@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/weii/actime/internal/appname"
+)
+
+// GetSessionsByApp returns the sessions of one application that started on
+// the days from start to end, in start order. The name matches regardless
+// of case, and a zero start or end leaves that side of the range open.
+func (db *DB) GetSessionsByApp(app string, start, end time.Time) ([]*Session, error) {
+	return db.GetSessions(&StatsQuery{AppName: app, StartDate: start, EndDate: end})
+}
+
+// GetTitleStats returns the time one application spent under each window
+// title in sessions that started on the days from start to end, largest
+// first with ties ordered by title. Titles are cleaned of null bytes and
+// surrounding whitespace the way application names are, so titles that
+// differ only in those are one row; sessions without a title make the row
+// with an empty title. Each session counts once, at its longest checkpoint.
+func (db *DB) GetTitleStats(app string, start, end time.Time) ([]*TitleStats, error) {
+	sqlQuery := `
+	SELECT COALESCE(window_title, '') AS title, ` + longestCheckpoint + ` AS seconds
+	FROM sessions
+	WHERE app_name = ? COLLATE NOCASE
+	`
+	args := []interface{}{app}
+	if !start.IsZero() {
+		sqlQuery += " AND start_time >= ?"
+		args = append(args, dayStart(start))
+	}
+	if !end.IsZero() {
+		sqlQuery += " AND start_time < ?"
+		args = append(args, dayStart(end).AddDate(0, 0, 1))
+	}
+	sqlQuery += " GROUP BY " + checkpointKey
+	sqlQuery = "SELECT title, SUM(seconds) FROM (" + sqlQuery + ") GROUP BY title"
+
+	rows, err := db.reader().Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query title stats: %w", err)
+	}
+	defer rows.Close()
+
+	merged := make(map[string]*TitleStats)
+	for rows.Next() {
+		var raw string
+		var seconds int64
+		if err := rows.Scan(&raw, &seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		title := appname.Clean(raw)
+		stat, ok := merged[title]
+		if !ok {
+			stat = &TitleStats{WindowTitle: title}
+			merged[title] = stat
+		}
+		stat.TotalSeconds += seconds
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate title stats: %w", err)
+	}
+
+	stats := make([]*TitleStats, 0, len(merged))
+	for _, stat := range merged {
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalSeconds != stats[j].TotalSeconds {
+			return stats[i].TotalSeconds > stats[j].TotalSeconds
+		}
+		return stats[i].WindowTitle < stats[j].WindowTitle
+	})
+	return stats, nil
+}
@@ -0,0 +1,30 @@
+package title
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// invisible are the characters that change between refreshes of some
+// titles without changing what is shown: zero-width spaces and joiners
+// that join nothing, and bidirectional controls. The zero-width joiner and
+// non-joiner are kept, they shape emoji and scripts.
+var invisible = strings.NewReplacer(
+	"\u200b", "", // zero width space
+	"\u2060", "", // word joiner
+	"\ufeff", "", // zero width no-break space
+	"\u180e", "", // Mongolian vowel separator
+	"\u061c", "", // Arabic letter mark
+	"\u200e", "", // left-to-right mark
+	"\u200f", "", // right-to-left mark
+	"\u202a", "", "\u202b", "", "\u202c", "", "\u202d", "", "\u202e", "", // embeddings and overrides
+	"\u2066", "", "\u2067", "", "\u2068", "", "\u2069", "", // isolates
+)
+
+// Sanitize returns the form of a title that is compared and stored: the
+// invisible characters above are removed and the rest is put in Unicode
+// NFC, so the same visible title is always the same string
+func Sanitize(title string) string {
+	return norm.NFC.String(invisible.Replace(title))
+}
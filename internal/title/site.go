@@ -0,0 +1,102 @@
+package title
+
+import (
+	"regexp"
+	"strings"
+)
+
+// titleSeparators split a browser title into the page, the site and the
+// browser, as in "Inbox - Gmail - Google Chrome"
+var titleSeparators = regexp.MustCompile(` +[-—–|·•] +`)
+
+// browserNames are what browsers append to the page title
+var browserNames = map[string]bool{
+	"mozilla firefox":           true,
+	"firefox":                   true,
+	"firefox developer edition": true,
+	"firefox nightly":           true,
+	"librewolf":                 true,
+	"tor browser":               true,
+	"zen browser":               true,
+	"google chrome":             true,
+	"chromium":                  true,
+	"microsoft edge":            true,
+	"brave":                     true,
+	"vivaldi":                   true,
+	"opera":                     true,
+	"safari":                    true,
+	"arc":                       true,
+}
+
+// hostPattern matches a title part that is a URL or a bare host name, as
+// some browsers and extensions show. The top-level domains are limited to
+// common ones so file names such as "README.md" are not taken for hosts.
+var hostPattern = regexp.MustCompile(`^(?:[a-z][a-z0-9+.-]*://)?` +
+	`((?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+` +
+	`(?:com|net|org|io|dev|app|edu|gov|info|biz|co|me|tv|ai|so|xyz|cc|uk|de|fr|nl|eu|ca|au|jp|cn|ru|in|br|es|it|se|ch)` +
+	`|localhost)(?::\d+)?(?:[/?#]\S*)?$`)
+
+// knownSites are the domains of sites that name themselves in titles
+var knownSites = map[string]string{
+	"github":          "github.com",
+	"gitlab":          "gitlab.com",
+	"stack overflow":  "stackoverflow.com",
+	"youtube":         "youtube.com",
+	"gmail":           "mail.google.com",
+	"google search":   "google.com",
+	"google docs":     "docs.google.com",
+	"google sheets":   "docs.google.com",
+	"google drive":    "drive.google.com",
+	"google calendar": "calendar.google.com",
+	"wikipedia":       "wikipedia.org",
+	"reddit":          "reddit.com",
+	"hacker news":     "news.ycombinator.com",
+	"x":               "x.com",
+	"twitter":         "twitter.com",
+	"facebook":        "facebook.com",
+	"linkedin":        "linkedin.com",
+	"netflix":         "netflix.com",
+	"twitch":          "twitch.tv",
+	"slack":           "slack.com",
+	"notion":          "notion.so",
+	"figma":           "figma.com",
+	"chatgpt":         "chatgpt.com",
+}
+
+// maxSiteName is the longest title part taken for a site's name; longer
+// ones are page titles
+const maxSiteName = 32
+
+// Site returns the site a browser window shows, read from its title: the
+// host when the title has a URL or host name, else the name the site gives
+// itself in the last part of the title, which is its domain for well-known
+// sites. The browser's own name is ignored. A title that names no site
+// returns "".
+func Site(title string) string {
+	parts := titleSeparators.Split(strings.TrimSpace(title), -1)
+	if n := len(parts); n > 0 && browserNames[strings.ToLower(parts[n-1])] {
+		parts = parts[:n-1]
+	}
+
+	for _, part := range parts {
+		if m := hostPattern.FindStringSubmatch(strings.ToLower(part)); m != nil {
+			return strings.TrimPrefix(m[1], "www.")
+		}
+	}
+
+	for _, part := range parts {
+		if domain, ok := knownSites[strings.ToLower(part)]; ok {
+			return domain
+		}
+	}
+
+	// "Page - Site": a lone part is the page, not the site
+	if len(parts) < 2 {
+		return ""
+	}
+	site := parts[len(parts)-1]
+	if site == "" || len([]rune(site)) > maxSiteName {
+		return ""
+	}
+	return site
+}
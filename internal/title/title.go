@@ -0,0 +1,86 @@
+// Package title normalizes window titles so noisy dynamic parts such as
+// unread counters do not split sessions
+package title
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Rule rewrites the titles of matching applications. App is a regular
+// expression matched against the application name; an empty App matches
+// every application. Every match of Pattern in the title is replaced with
+// Replace, which may refer to capture groups as $1.
+type Rule struct {
+	App     string `yaml:"app,omitempty"`
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace,omitempty"`
+}
+
+// DefaultRules strip unread counters, editor dirty markers and spinners
+var DefaultRules = []Rule{
+	// "(3) Inbox", "(99+) Chat", "[2] Slack"
+	{Pattern: `^\s*[(\[]\d+\+?[)\]]\s*`},
+	// "● main.go - project", "* notes.txt"
+	{Pattern: `^\s*[●•*]\s+`},
+	// "main.go •", "main.go *"
+	{Pattern: `\s+[●•*]\s*$`},
+	// Braille spinners used by terminals and CLIs, e.g. "⠋ building"
+	{Pattern: `^\s*[\x{2800}-\x{28FF}]\s*`},
+}
+
+// compiledRule is a Rule with its expressions compiled
+type compiledRule struct {
+	app     *regexp.Regexp
+	pattern *regexp.Regexp
+	replace string
+}
+
+// Normalizer applies an ordered list of rules to window titles
+type Normalizer struct {
+	rules []compiledRule
+}
+
+// Compile builds a Normalizer from rules. Rules are applied in order, each
+// one to the output of the previous.
+func Compile(rules []Rule) (*Normalizer, error) {
+	n := &Normalizer{}
+	for i, rule := range rules {
+		compiled := compiledRule{replace: rule.Replace}
+
+		if rule.App != "" {
+			app, err := regexp.Compile(rule.App)
+			if err != nil {
+				return nil, fmt.Errorf("invalid app pattern in title rule %d: %w", i+1, err)
+			}
+			compiled.app = app
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in title rule %d: %w", i+1, err)
+		}
+		compiled.pattern = pattern
+
+		n.rules = append(n.rules, compiled)
+	}
+	return n, nil
+}
+
+// Normalize returns the title with all matching rules applied. A nil
+// Normalizer returns the title unchanged.
+func (n *Normalizer) Normalize(appName, title string) string {
+	if n == nil {
+		return title
+	}
+
+	for _, rule := range n.rules {
+		if rule.app != nil && !rule.app.MatchString(appName) {
+			continue
+		}
+		title = rule.pattern.ReplaceAllString(title, rule.replace)
+	}
+
+	return strings.TrimSpace(title)
+}
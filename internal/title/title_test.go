@@ -0,0 +1,126 @@
+package title
+
+import "testing"
+
+func TestDefaultRules(t *testing.T) {
+	n, err := Compile(DefaultRules)
+	if err != nil {
+		t.Fatalf("Failed to compile default rules: %v", err)
+	}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"(3) Inbox — Gmail", "Inbox — Gmail"},
+		{"(99+) Chat", "Chat"},
+		{"[2] Slack | general", "Slack | general"},
+		{"● main.go - actime - Visual Studio Code", "main.go - actime - Visual Studio Code"},
+		{"* notes.txt", "notes.txt"},
+		{"main.go •", "main.go"},
+		{"⠋ go test ./...", "go test ./..."},
+		// Numbers and markers inside the title are kept
+		{"Issue (3) - GitHub", "Issue (3) - GitHub"},
+		{"a * b", "a * b"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := n.Normalize("any", tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRulesAreScopedAndOrdered(t *testing.T) {
+	n, err := Compile([]Rule{
+		{App: "^firefox$", Pattern: ` — Mozilla Firefox$`},
+		{Pattern: `ticket-(\d+)`, Replace: "ticket #$1"},
+		{Pattern: `#(\d+)`, Replace: "[$1]"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	if got := n.Normalize("firefox", "ticket-42 — Mozilla Firefox"); got != "ticket [42]" {
+		t.Errorf("Expected both rules to apply in order, got %q", got)
+	}
+	if got := n.Normalize("chrome", "Page — Mozilla Firefox"); got != "Page — Mozilla Firefox" {
+		t.Errorf("Expected the app-scoped rule to be skipped, got %q", got)
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	if _, err := Compile([]Rule{{Pattern: "("}}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if _, err := Compile([]Rule{{App: "[", Pattern: "x"}}); err == nil {
+		t.Error("Expected an error for an invalid app pattern")
+	}
+}
+
+func TestNilNormalizer(t *testing.T) {
+	var n *Normalizer
+	if got := n.Normalize("app", "(3) Inbox"); got != "(3) Inbox" {
+		t.Errorf("Expected a nil normalizer to keep the title, got %q", got)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"NFD is composed", "Cafe\u0301 - Re\u0301sume\u0301", "Caf\u00e9 - R\u00e9sum\u00e9"},
+		{"NFC is kept", "Caf\u00e9 - R\u00e9sum\u00e9", "Caf\u00e9 - R\u00e9sum\u00e9"},
+		{"Hangul jamo are composed", "\u1112\u1161\u11ab", "\ud55c"},
+		{"zero-width space", "Slack\u200b | general", "Slack | general"},
+		{"byte order mark and word joiner", "\ufeffnotes\u2060.txt", "notes.txt"},
+		{"bidi marks and isolates", "\u200f\u2067\u05e9\u05dc\u05d5\u05dd\u2069 - Chat\u200e", "\u05e9\u05dc\u05d5\u05dd - Chat"},
+		{"emoji sequences are kept", "\U0001F468\u200d\U0001F469\u200d\U0001F467 family", "\U0001F468\u200d\U0001F469\u200d\U0001F467 family"},
+		{"zero-width non-joiner is kept", "\u0645\u06cc\u200c\u062e\u0648\u0627\u0647\u0645", "\u0645\u06cc\u200c\u062e\u0648\u0627\u0647\u0645"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	// Refreshes of one title in different forms compare equal
+	forms := []string{"Caf\u00e9 - Editor", "Cafe\u0301 - Editor", "Caf\u00e9\u200b - Editor", "\u200eCafe\u0301 - Editor"}
+	for _, form := range forms[1:] {
+		if Sanitize(form) != Sanitize(forms[0]) {
+			t.Errorf("Expected %q and %q to sanitize the same", form, forms[0])
+		}
+	}
+}
+
+func TestSite(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"GitHub - Mozilla Firefox", "github.com"},
+		{"Pull requests · weii/actime · GitHub — Mozilla Firefox", "github.com"},
+		{"Inbox (3) - someone@example.com - Gmail - Google Chrome", "mail.google.com"},
+		{"docs.python.org/3/library - Chromium", "docs.python.org"},
+		{"https://www.example.org/path?q=1 - Brave", "example.org"},
+		{"localhost:8080 - Google Chrome", "localhost"},
+		{"Release notes | Acme Wiki - Microsoft Edge", "Acme Wiki"},
+		{"README.md - notes - Google Chrome", "notes"},
+		{"New Tab - Google Chrome", ""},
+		{"Mozilla Firefox", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Site(tt.title); got != tt.want {
+			t.Errorf("Site(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
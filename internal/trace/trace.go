@@ -0,0 +1,115 @@
+// Package trace measures how long the phases of a command take.
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases of a command reported by Summary
+const (
+	Query     = "query"
+	Aggregate = "aggregate"
+	Render    = "render"
+	Write     = "write"
+)
+
+// Phases are the phases Summary reports by default, in order
+var Phases = []string{Query, Aggregate, Render, Write}
+
+// Timer adds up the time spent in each phase of a command. A nil Timer is
+// valid and records nothing, so code can be instrumented unconditionally.
+type Timer struct {
+	mu     sync.Mutex
+	start  time.Time
+	totals map[string]time.Duration
+	now    func() time.Time
+}
+
+// New returns a timer started now
+func New() *Timer {
+	return newTimer(time.Now)
+}
+
+// newTimer returns a timer reading the given clock
+func newTimer(now func() time.Time) *Timer {
+	return &Timer{
+		start:  now(),
+		totals: make(map[string]time.Duration),
+		now:    now,
+	}
+}
+
+// Span is one measured stretch of a phase
+type Span struct {
+	timer *Timer
+	phase string
+	start time.Time
+}
+
+// Start begins a span of phase. Spans of the same phase add up.
+func (t *Timer) Start(phase string) *Span {
+	if t == nil {
+		return nil
+	}
+	return &Span{timer: t, phase: phase, start: t.now()}
+}
+
+// End adds the span's duration to its phase
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.timer.Add(s.phase, s.timer.now().Sub(s.start))
+}
+
+// Add records d as spent in phase
+func (t *Timer) Add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.totals[phase] += d
+}
+
+// Total returns the time recorded for phase
+func (t *Timer) Total(phase string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.totals[phase]
+}
+
+// Elapsed returns the time since the timer was created
+func (t *Timer) Elapsed() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.now().Sub(t.start)
+}
+
+// Summary formats the given phases, or Phases when none are given, followed
+// by the total, as in "query 12.1ms, aggregate 0.4ms, render 1.0ms,
+// write 0.2ms, total 14.3ms". Phases that never ran are shown as 0ms.
+func (t *Timer) Summary(phases ...string) string {
+	if len(phases) == 0 {
+		phases = Phases
+	}
+
+	parts := make([]string, 0, len(phases)+1)
+	for _, phase := range phases {
+		parts = append(parts, fmt.Sprintf("%s %s", phase, milliseconds(t.Total(phase))))
+	}
+	parts = append(parts, "total "+milliseconds(t.Elapsed()))
+	return strings.Join(parts, ", ")
+}
+
+// milliseconds formats d in milliseconds with one decimal
+func milliseconds(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
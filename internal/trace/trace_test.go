@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock advances by step every time it is read
+type fakeClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) read() time.Time {
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+func TestTimerAddsUpSpans(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC), step: 2 * time.Millisecond}
+	timer := newTimer(clock.read)
+
+	// Each span reads the clock twice, so it lasts one step
+	timer.Start(Query).End()
+	timer.Start(Query).End()
+	timer.Start(Render).End()
+	timer.Add(Write, 500*time.Microsecond)
+
+	if got := timer.Total(Query); got != 4*time.Millisecond {
+		t.Errorf("Expected 4ms of queries, got %v", got)
+	}
+
+	want := "query 4.0ms, aggregate 0.0ms, render 2.0ms, write 0.5ms, total 14.0ms"
+	if got := timer.Summary(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := timer.Summary(Render); got != "render 2.0ms, total 16.0ms" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+}
+
+func TestNilTimerRecordsNothing(t *testing.T) {
+	var timer *Timer
+	timer.Start(Query).End()
+	timer.Add(Write, time.Second)
+
+	if got := timer.Total(Write); got != 0 {
+		t.Errorf("Expected nothing recorded, got %v", got)
+	}
+}